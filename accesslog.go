@@ -0,0 +1,320 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AccessLogFormat is the line format of an AccessLog
+type AccessLogFormat int
+
+const (
+	// CommonLogFormat is the NCSA Common Log Format:
+	//
+	//	127.0.0.1 - alice [01/May/2024:09:00:00 +0000] "GET /index.html HTTP/1.1" 200 2326
+	CommonLogFormat AccessLogFormat = iota
+	// CombinedLogFormat is the Common Log Format followed by the quoted Referer and User-Agent
+	CombinedLogFormat
+	// JSONLogFormat writes an AccessLogEntry as a JSON object per line
+	JSONLogFormat
+)
+
+// AccessLogEntry is a request as written by JSONLogFormat
+type AccessLogEntry struct {
+	Time       time.Time `json:"time"`
+	RemoteAddr string    `json:"remote_addr"`
+	User       string    `json:"user,omitempty"`
+	RequestID  string    `json:"request_id,omitempty"`
+	Method     string    `json:"method"`
+	URI        string    `json:"uri"`
+	Proto      string    `json:"proto"`
+	Status     int       `json:"status"`
+	Bytes      int64     `json:"bytes"`
+	Referer    string    `json:"referer,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	DurationMs float64   `json:"duration_ms"`
+}
+
+// AccessLog writes a line for each request, in a format log processors such as GoAccess,
+// AWStats or a log shipper already understand. Write it to a RotatingFile to have the server
+// manage its own log files.
+type AccessLog struct {
+	// Output receives the lines. Defaults to standard output
+	Output io.Writer
+	// Format defaults to CommonLogFormat
+	Format AccessLogFormat
+	// TrustedProxies are believed when finding the client's address
+	TrustedProxies []*net.IPNet
+	// User names the user of a request. Defaults to the user ID stored by RequestContext, then
+	// the basic auth user name
+	User func(r *http.Request) string
+
+	mu sync.Mutex
+}
+
+// Middleware logs each request once it has been served
+func (al *AccessLog) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		cw := newCountingWriter(w)
+		next.ServeHTTP(cw, r)
+
+		e := AccessLogEntry{
+			Time:       start,
+			RemoteAddr: r.RemoteAddr,
+			Method:     r.Method,
+			URI:        r.RequestURI,
+			Proto:      r.Proto,
+			Status:     cw.Status(),
+			Bytes:      cw.Count(),
+			Referer:    r.Referer(),
+			UserAgent:  r.UserAgent(),
+			DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+		}
+		if ip := requestClientIP(r, al.TrustedProxies); ip != nil {
+			e.RemoteAddr = ip.String()
+		}
+		if e.URI == "" {
+			e.URI = r.URL.RequestURI()
+		}
+		e.RequestID, _ = RequestIDFromContext(r.Context())
+		if al.User != nil {
+			e.User = al.User(r)
+		} else if user, ok := UserIDFromContext(r.Context()); ok {
+			e.User = user
+		} else if user, _, ok := r.BasicAuth(); ok {
+			e.User = user
+		}
+		_ = al.Write(e)
+	})
+}
+
+// Write writes an entry, for requests which don't pass through Middleware
+func (al *AccessLog) Write(e AccessLogEntry) error {
+	var line []byte
+	switch al.Format {
+	case JSONLogFormat:
+		var err error
+		if line, err = json.Marshal(e); err != nil {
+			return err
+		}
+		line = append(line, '\n')
+	default:
+		line = formatCommonLog(e, al.Format == CombinedLogFormat)
+	}
+
+	out := al.Output
+	if out == nil {
+		out = os.Stdout
+	}
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	_, err := out.Write(line)
+	return err
+}
+
+func formatCommonLog(e AccessLogEntry, combined bool) []byte {
+	field := func(s string) string {
+		if s == "" {
+			return "-"
+		}
+		return clfEscape(s)
+	}
+	size := "-"
+	if e.Bytes > 0 {
+		size = strconv.FormatInt(e.Bytes, 10)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s - %s [%s] \"%s %s %s\" %d %s",
+		field(e.RemoteAddr), field(e.User), e.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		clfEscape(e.Method), clfEscape(e.URI), clfEscape(e.Proto), e.Status, size)
+	if combined {
+		fmt.Fprintf(&b, " \"%s\" \"%s\"", field(e.Referer), field(e.UserAgent))
+	}
+	b.WriteByte('\n')
+	return []byte(b.String())
+}
+
+// clfEscape escapes quotes, backslashes and control characters, as Apache does, so a client
+// can't forge fields or lines
+func clfEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c == 0x7f:
+			fmt.Fprintf(&b, "\\x%02x", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// RotatingFile is a log file which rotates itself once it reaches MaxSize, or at each
+// Interval, renaming the full file with the time of rotation, as access.log.20240501-090000,
+// and deleting the oldest beyond MaxBackups. It is safe for concurrent use.
+type RotatingFile struct {
+	// Path is the file written to
+	Path string
+	// MaxSize rotates the file before a write would take it over this many bytes. Zero
+	// disables rotation by size
+	MaxSize int64
+	// Interval rotates the file when a write falls in a later interval than the file was
+	// opened in. Intervals are counted from the Unix epoch, so 24 hours rotates at midnight
+	// UTC. Zero disables rotation by time
+	Interval time.Duration
+	// MaxBackups is the number of rotated files kept. Zero keeps them all
+	MaxBackups int
+	// Now defaults to time.Now
+	Now func() time.Time
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	period int64
+}
+
+func (rf *RotatingFile) now() time.Time {
+	if rf.Now != nil {
+		return rf.Now()
+	}
+	return time.Now()
+}
+
+func (rf *RotatingFile) periodOf(t time.Time) int64 {
+	if rf.Interval <= 0 {
+		return 0
+	}
+	return t.UnixNano() / int64(rf.Interval)
+}
+
+// Write appends p to the file, rotating it first if due
+func (rf *RotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	now := rf.now()
+	if rf.file == nil {
+		if err := rf.open(now); err != nil {
+			return 0, err
+		}
+	}
+	if (rf.MaxSize > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.MaxSize) || rf.periodOf(now) != rf.period {
+		if err := rf.rotate(now); err != nil {
+			return 0, err
+		}
+	}
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+// open opens the file for appending, creating it if need be
+func (rf *RotatingFile) open(now time.Time) error {
+	f, err := os.OpenFile(rf.Path, os.O_WRONLY, 0o644)
+	if os.IsNotExist(err) {
+		if err = os.MkdirAll(filepath.Dir(rf.Path), 0o755); err != nil {
+			return err
+		}
+		f, err = os.Create(rf.Path)
+	}
+	if err != nil {
+		return err
+	}
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	rf.file, rf.size = f, size
+	rf.period = rf.periodOf(now)
+	if size > 0 {
+		if info, err := f.Stat(); err == nil {
+			// a file left from before a restart belongs to the interval it was written in
+			rf.period = rf.periodOf(info.ModTime())
+		}
+	}
+	return nil
+}
+
+// Rotate rotates the file now, as when told to by a signal from an external log rotator
+func (rf *RotatingFile) Rotate() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.file == nil {
+		if err := rf.open(rf.now()); err != nil {
+			return err
+		}
+	}
+	return rf.rotate(rf.now())
+}
+
+func (rf *RotatingFile) rotate(now time.Time) error {
+	if err := rf.file.Close(); err != nil {
+		return err
+	}
+	rf.file = nil
+	if rf.size > 0 {
+		backup := rf.Path + "." + now.UTC().Format("20060102-150405")
+		for i := 1; ; i++ {
+			if _, err := os.Stat(backup); os.IsNotExist(err) {
+				break
+			}
+			backup = rf.Path + "." + now.UTC().Format("20060102-150405") + "." + strconv.Itoa(i)
+		}
+		if err := os.Rename(rf.Path, backup); err != nil {
+			return err
+		}
+	}
+	if err := rf.open(now); err != nil {
+		return err
+	}
+	rf.period = rf.periodOf(now)
+	return rf.prune()
+}
+
+// prune deletes the oldest backups beyond MaxBackups
+func (rf *RotatingFile) prune() error {
+	if rf.MaxBackups <= 0 {
+		return nil
+	}
+	backups, err := filepath.Glob(rf.Path + ".[0-9]*")
+	if err != nil {
+		return err
+	}
+	// the timestamps sort in time order
+	sort.Strings(backups)
+	for len(backups) > rf.MaxBackups {
+		if err := os.Remove(backups[0]); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// Close closes the file. A later Write opens it again
+func (rf *RotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.file == nil {
+		return nil
+	}
+	err := rf.file.Close()
+	rf.file = nil
+	return err
+}
@@ -0,0 +1,138 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAccessLog(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte("hello"))
+	})
+
+	var tests = []struct {
+		format AccessLogFormat
+		path   string
+		want   string
+	}{
+		{format: CommonLogFormat, path: "/index.html?x=1", want: `192.0.2.1 - alice [` + `] "GET /index.html?x=1 HTTP/1.1" 200 5` + "\n"},
+		{format: CommonLogFormat, path: "/missing", want: `192.0.2.1 - alice [` + `] "GET /missing HTTP/1.1" 404 19` + "\n"},
+		{format: CombinedLogFormat, path: "/", want: `192.0.2.1 - alice [` + `] "GET / HTTP/1.1" 200 5 "https://example.com/\"quoted\"" "test-agent"` + "\n"},
+	}
+
+	for _, e := range tests {
+		var buf bytes.Buffer
+		al := &AccessLog{Output: &buf, Format: e.format}
+		req := httptest.NewRequest("GET", e.path, nil)
+		req.RemoteAddr = "192.0.2.1:5555"
+		req.SetBasicAuth("alice", "secret")
+		req.Header.Set("Referer", `https://example.com/"quoted"`)
+		req.Header.Set("User-Agent", "test-agent")
+		al.Middleware(handler).ServeHTTP(httptest.NewRecorder(), req)
+
+		// the time varies, so compare around it
+		got := buf.String()
+		open, close := strings.Index(got, "["), strings.Index(got, "]")
+		if open < 0 || close < open {
+			t.Fatalf("no time in %q", got)
+		}
+		if _, err := time.Parse("02/Jan/2006:15:04:05 -0700", got[open+1:close]); err != nil {
+			t.Errorf("bad time: %v", err)
+		}
+		if got = got[:open+1] + got[close:]; got != e.want {
+			t.Errorf("expected %q, got %q", e.want, got)
+		}
+	}
+
+	var buf bytes.Buffer
+	al := &AccessLog{Output: &buf, Format: JSONLogFormat}
+	al.Middleware(handler).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/items", nil))
+	var entry AccessLogEntry
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.Method != "POST" || entry.URI != "/items" || entry.Status != 200 || entry.Bytes != 5 || entry.RemoteAddr != "192.0.2.1" {
+		t.Errorf("unexpected entry %+v", entry)
+	}
+}
+
+func TestClfEscape(t *testing.T) {
+	if got := clfEscape("GET /\"a\\b\n"); got != `GET /\"a\\b\x0a` {
+		t.Errorf("unexpected escape %s", got)
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	rf := &RotatingFile{
+		Path:       filepath.Join(dir, "logs", "access.log"),
+		MaxSize:    11,
+		Interval:   24 * time.Hour,
+		MaxBackups: 2,
+		Now:        func() time.Time { return now },
+	}
+	defer rf.Close()
+
+	write := func(s string) {
+		t.Helper()
+		if _, err := rf.Write([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	backups := func() []string {
+		names, _ := filepath.Glob(rf.Path + ".*")
+		for i, n := range names {
+			names[i] = filepath.Base(n)
+		}
+		return names
+	}
+
+	write("12345\n")
+	write("1234\n")
+	if got := backups(); len(got) != 0 {
+		t.Fatalf("expected no rotation within MaxSize, got %v", got)
+	}
+	now = now.Add(time.Second)
+	write("next\n")
+	if got := backups(); len(got) != 1 || got[0] != "access.log.20240501-090001" {
+		t.Fatalf("expected a rotation by size, got %v", got)
+	}
+
+	// a new day rotates
+	now = now.Add(24 * time.Hour)
+	write("day\n")
+	if got := backups(); len(got) != 2 || got[1] != "access.log.20240502-090001" {
+		t.Fatalf("expected a rotation by time, got %v", got)
+	}
+
+	// only MaxBackups are kept
+	now = now.Add(time.Second)
+	if err := rf.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if got := backups(); len(got) != 2 || got[0] != "access.log.20240502-090001" {
+		t.Errorf("expected the oldest backup to be pruned, got %v", got)
+	}
+
+	// reopening appends
+	write("a\n")
+	rf.Close()
+	_ = os.Chtimes(rf.Path, now, now)
+	write("b\n")
+	data, _ := os.ReadFile(rf.Path)
+	if string(data) != "a\nb\n" {
+		t.Errorf("expected the file to be appended to, got %q", data)
+	}
+}
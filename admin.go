@@ -0,0 +1,442 @@
+package toolkit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Toggle is a boolean switch which can be flipped safely at runtime, such as maintenance mode
+type Toggle struct {
+	on int32
+}
+
+// Enabled reports whether the toggle is on
+func (t *Toggle) Enabled() bool {
+	return atomic.LoadInt32(&t.on) == 1
+}
+
+// Set turns the toggle on or off
+func (t *Toggle) Set(on bool) {
+	var v int32
+	if on {
+		v = 1
+	}
+	atomic.StoreInt32(&t.on, v)
+}
+
+// MaintenanceMiddleware responds to every request with a 503 JSON error while the toggle is on
+func MaintenanceMiddleware(maintenance *Toggle) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if maintenance.Enabled() {
+				var t Tools
+				_ = t.ErrorJSON(w, errors.New("down for maintenance"), http.StatusServiceUnavailable)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RecordedError is an error captured by an ErrorRing
+type RecordedError struct {
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+}
+
+// ErrorRing keeps the most recent errors in memory, for display on the admin endpoints
+type ErrorRing struct {
+	// Size is the number of errors kept. Defaults to 50
+	Size int
+
+	mu     sync.Mutex
+	errors []RecordedError
+}
+
+// Add records an error. Nil errors are ignored.
+func (e *ErrorRing) Add(err error) {
+	if err == nil {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	size := e.Size
+	if size <= 0 {
+		size = 50
+	}
+
+	e.errors = append(e.errors, RecordedError{Time: time.Now(), Message: err.Error()})
+	if len(e.errors) > size {
+		e.errors = e.errors[len(e.errors)-size:]
+	}
+}
+
+// Errors returns the recorded errors, oldest first
+func (e *ErrorRing) Errors() []RecordedError {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	out := make([]RecordedError, len(e.errors))
+	copy(out, e.errors)
+	return out
+}
+
+// Version, Commit and BuildDate describe the build, when set by the linker, e.g.
+//
+//	go build -ldflags "-X github.com/kaliadmen/toolkit.Version=v1.4.0 -X github.com/kaliadmen/toolkit.Commit=$(git rev-parse HEAD)"
+//
+// ReadBuildInfo falls back to the version control information the go command embeds for those
+// left empty.
+var (
+	Version   string
+	Commit    string
+	BuildDate string
+)
+
+// BuildInfo describes the running binary
+type BuildInfo struct {
+	Version   string            `json:"version,omitempty"`
+	Commit    string            `json:"commit,omitempty"`
+	BuildDate string            `json:"build_date,omitempty"`
+	Modified  bool              `json:"modified,omitempty"`
+	GoVersion string            `json:"go_version"`
+	Path      string            `json:"path,omitempty"`
+	Settings  map[string]string `json:"settings,omitempty"`
+}
+
+// ReadBuildInfo returns information about the running binary, from the linker flags and as
+// embedded by the go command
+func ReadBuildInfo() BuildInfo {
+	info := BuildInfo{Version: Version, Commit: Commit, BuildDate: BuildDate, GoVersion: runtime.Version()}
+
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+
+	info.Path = bi.Main.Path
+	if info.Version == "" && bi.Main.Version != "(devel)" {
+		info.Version = bi.Main.Version
+	}
+	info.Settings = make(map[string]string)
+	for _, s := range bi.Settings {
+		info.Settings[s.Key] = s.Value
+	}
+	if info.Commit == "" {
+		info.Commit = info.Settings["vcs.revision"]
+	}
+	if info.BuildDate == "" {
+		// the time of the commit, the closest the go command records to a build date
+		info.BuildDate = info.Settings["vcs.time"]
+	}
+	info.Modified = info.Settings["vcs.modified"] == "true"
+	return info
+}
+
+// String describes the build in a line, for a startup banner, as
+// "example.com/app v1.4.0 (commit 3f2a9c1, built 2024-05-01T09:00:00Z, go1.22.3)"
+func (b BuildInfo) String() string {
+	name := b.Path
+	if name == "" {
+		name = "app"
+	}
+	version := b.Version
+	if version == "" {
+		version = "devel"
+	}
+	details := make([]string, 0, 3)
+	if b.Commit != "" {
+		commit := b.Commit
+		if len(commit) > 7 {
+			commit = commit[:7]
+		}
+		if b.Modified {
+			commit += "+modified"
+		}
+		details = append(details, "commit "+commit)
+	}
+	if b.BuildDate != "" {
+		details = append(details, "built "+b.BuildDate)
+	}
+	details = append(details, b.GoVersion)
+	return name + " " + version + " (" + strings.Join(details, ", ") + ")"
+}
+
+// RuntimeStats is a snapshot of the Go runtime
+type RuntimeStats struct {
+	Goroutines   int     `json:"goroutines"`
+	NumCPU       int     `json:"num_cpu"`
+	HeapAlloc    uint64  `json:"heap_alloc"`
+	HeapInuse    uint64  `json:"heap_inuse"`
+	Sys          uint64  `json:"sys"`
+	NumGC        uint32  `json:"num_gc"`
+	PauseTotalMs float64 `json:"pause_total_ms"`
+	Uptime       string  `json:"uptime"`
+	// Summary is the stats in a sentence, as "12 goroutines, 4.2 MB heap, up 3 hours"
+	Summary string `json:"summary"`
+}
+
+var processStart = time.Now()
+
+// ReadRuntimeStats returns the current goroutine count and memory statistics
+func ReadRuntimeStats() RuntimeStats {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	goroutines := runtime.NumGoroutine()
+	uptime := time.Since(processStart)
+	return RuntimeStats{
+		Goroutines:   goroutines,
+		NumCPU:       runtime.NumCPU(),
+		HeapAlloc:    m.HeapAlloc,
+		HeapInuse:    m.HeapInuse,
+		Sys:          m.Sys,
+		NumGC:        m.NumGC,
+		PauseTotalMs: float64(m.PauseTotalNs) / float64(time.Millisecond),
+		Uptime:       uptime.Round(time.Second).String(),
+		Summary:      Pluralize(goroutines, "goroutine") + ", " + ByteSize(m.HeapAlloc).String() + " heap, up " + HumanDuration(uptime),
+	}
+}
+
+// Admin is a mountable bundle of debug endpoints. Mount its Handler under a prefix, for example
+// mux.Handle("/admin/", http.StripPrefix("/admin", admin.Handler())). The endpoints are:
+//
+//	GET  /build            build information
+//	GET  /config           the application config, redacted
+//	GET  /runtime          goroutine and memory statistics
+//	GET  /errors           recent errors
+//	GET  /state            the output of each registered state function, such as rate limiters
+//	GET  /toggles          the current value of each toggle
+//	POST /toggles          set toggles, from a body like {"maintenance": true}
+//	GET  /loglevel         the current log levels
+//	POST /loglevel         set the log level, from a body like {"level": "debug"}, or a
+//	                       component's, from one like {"level": "debug", "component": "storage"}
+type Admin struct {
+	// Tools is used to read and write JSON
+	Tools *Tools
+	// Protect wraps the admin handler, and should be an authentication middleware.
+	// If it is nil, every request is refused.
+	Protect func(http.Handler) http.Handler
+	// Config is the application configuration, shown after redaction
+	Config any
+	// Redactor scrubs sensitive values from the config. If it is nil, the config is not shown
+	Redactor *Redactor
+	// Errors holds the recent errors shown on /errors
+	Errors *ErrorRing
+	// States maps a name to a function reporting the state of a component
+	States map[string]func() any
+	// Toggles maps a name to a runtime switch, such as maintenance mode
+	Toggles map[string]*Toggle
+	// LogLevel is the global level changed by /loglevel
+	LogLevel *LevelVar
+	// LogLevels maps a component to its level, also changed by /loglevel
+	LogLevels map[string]*LevelVar
+	// Audit, if set, receives each change made through the endpoints, such as to keep an
+	// audit log of who turned on debug logging
+	Audit func(ctx context.Context, e AdminChange)
+	// Actor names who made a change, for Audit. Defaults to the user ID stored by
+	// RequestContext, the basic auth user name, or the client's address
+	Actor func(r *http.Request) string
+}
+
+// AdminChange is a change made through the admin endpoints
+type AdminChange struct {
+	Actor string `json:"actor"`
+	// Setting is what was changed, as "toggles.maintenance", "loglevel" or "loglevel.storage"
+	Setting string    `json:"setting"`
+	Old     string    `json:"old"`
+	New     string    `json:"new"`
+	At      time.Time `json:"at"`
+}
+
+func (a *Admin) audit(r *http.Request, setting, old, new string) {
+	if a.Audit != nil {
+		a.Audit(r.Context(), AdminChange{Actor: changeActor(r, a.Actor), Setting: setting, Old: old, New: new, At: time.Now()})
+	}
+}
+
+// changeActor names who made a change with actor, or else by the user ID stored by
+// RequestContext, the basic auth user name or the client's address
+func changeActor(r *http.Request, actor func(r *http.Request) string) string {
+	if actor != nil {
+		return actor(r)
+	}
+	if user, ok := UserIDFromContext(r.Context()); ok {
+		return user
+	}
+	if user, _, ok := r.BasicAuth(); ok {
+		return user
+	}
+	if ip := requestClientIP(r, nil); ip != nil {
+		return ip.String()
+	}
+	return ""
+}
+
+func (a *Admin) tools() *Tools {
+	if a.Tools != nil {
+		return a.Tools
+	}
+	return &Tools{}
+}
+
+// Handler returns the admin endpoints, wrapped in the Protect middleware
+func (a *Admin) Handler() http.Handler {
+	if a.Protect == nil {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_ = a.tools().ErrorJSON(w, errors.New("admin endpoints are not protected"), http.StatusForbidden)
+		})
+	}
+	return a.Protect(http.HandlerFunc(a.serve))
+}
+
+func (a *Admin) serve(w http.ResponseWriter, r *http.Request) {
+	t := a.tools()
+	endpoint := strings.Trim(r.URL.Path, "/")
+
+	if r.Method != http.MethodGet && !(r.Method == http.MethodPost && (endpoint == "toggles" || endpoint == "loglevel")) {
+		w.Header().Set("Allow", "GET, POST")
+		_ = t.ErrorJSON(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch endpoint {
+	case "build":
+		_ = t.WriteJSON(w, http.StatusOK, ReadBuildInfo())
+	case "config":
+		a.serveConfig(w)
+	case "runtime":
+		_ = t.WriteJSON(w, http.StatusOK, ReadRuntimeStats())
+	case "errors":
+		var errs []RecordedError
+		if a.Errors != nil {
+			errs = a.Errors.Errors()
+		}
+		_ = t.WriteJSON(w, http.StatusOK, errs)
+	case "state":
+		states := make(map[string]any, len(a.States))
+		for name, fn := range a.States {
+			states[name] = fn()
+		}
+		_ = t.WriteJSON(w, http.StatusOK, states)
+	case "toggles":
+		a.serveToggles(w, r)
+	case "loglevel":
+		a.serveLogLevel(w, r)
+	default:
+		_ = t.ErrorJSON(w, errors.New("not found"), http.StatusNotFound)
+	}
+}
+
+func (a *Admin) serveConfig(w http.ResponseWriter) {
+	t := a.tools()
+
+	if a.Redactor == nil {
+		_ = t.ErrorJSON(w, errors.New("the config is not shown without a redactor"), http.StatusForbidden)
+		return
+	}
+	raw, err := json.Marshal(a.Config)
+	if err != nil {
+		_ = t.ErrorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(a.Redactor.RedactJSON(raw))
+}
+
+func (a *Admin) serveToggles(w http.ResponseWriter, r *http.Request) {
+	t := a.tools()
+
+	if r.Method == http.MethodPost {
+		var changes map[string]bool
+		if err := t.ReadJSON(w, r, &changes); err != nil {
+			_ = t.ErrorJSON(w, err)
+			return
+		}
+		for name := range changes {
+			if _, ok := a.Toggles[name]; !ok {
+				_ = t.ErrorJSON(w, errors.New("unknown toggle "+name))
+				return
+			}
+		}
+		for name, on := range changes {
+			old := a.Toggles[name].Enabled()
+			a.Toggles[name].Set(on)
+			if old != on {
+				a.audit(r, "toggles."+name, strconv.FormatBool(old), strconv.FormatBool(on))
+			}
+		}
+	}
+
+	// encoding/json writes map keys in order, so the toggles are listed by name
+	out := make(map[string]bool, len(a.Toggles))
+	for name, toggle := range a.Toggles {
+		out[name] = toggle.Enabled()
+	}
+	_ = t.WriteJSON(w, http.StatusOK, out)
+}
+
+func (a *Admin) serveLogLevel(w http.ResponseWriter, r *http.Request) {
+	t := a.tools()
+
+	if a.LogLevel == nil && len(a.LogLevels) == 0 {
+		_ = t.ErrorJSON(w, errors.New("no log level configured"), http.StatusNotFound)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		var req struct {
+			Level string `json:"level"`
+			// Component names one of LogLevels; without it the global level is set
+			Component string `json:"component"`
+		}
+		if err := t.ReadJSON(w, r, &req); err != nil {
+			_ = t.ErrorJSON(w, err)
+			return
+		}
+		level, err := ParseLogLevel(req.Level)
+		if err != nil {
+			_ = t.ErrorJSON(w, err)
+			return
+		}
+		v, setting := a.LogLevel, "loglevel"
+		if req.Component != "" {
+			v, setting = a.LogLevels[req.Component], "loglevel."+req.Component
+		}
+		if v == nil {
+			_ = t.ErrorJSON(w, errors.New("unknown log level component "+req.Component))
+			return
+		}
+		old := v.Level()
+		v.Set(level)
+		if old != level {
+			a.audit(r, setting, old.String(), level.String())
+		}
+	}
+
+	out := map[string]any{}
+	if a.LogLevel != nil {
+		out["level"] = a.LogLevel.Level().String()
+	}
+	if len(a.LogLevels) > 0 {
+		components := make(map[string]string, len(a.LogLevels))
+		for name, v := range a.LogLevels {
+			components[name] = v.Level().String()
+		}
+		out["components"] = components
+	}
+	_ = t.WriteJSON(w, http.StatusOK, out)
+}
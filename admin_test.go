@@ -0,0 +1,199 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdmin_Handler(t *testing.T) {
+	log.SetOutput(io.Discard)
+
+	testTools := Tools{RecentErrors: &ErrorRing{}}
+	testTools.LogError(errors.New("boom"))
+
+	var maintenance Toggle
+	var level LevelVar
+	level.Set(LevelInfo)
+
+	admin := Admin{
+		Tools:   &testTools,
+		Protect: func(next http.Handler) http.Handler { return next },
+		Config: map[string]any{
+			"db_password": "hunter2",
+			"port":        8080,
+		},
+		Redactor: &Redactor{Fields: []string{"db_password"}},
+		Errors:   testTools.RecentErrors,
+		States: map[string]func() any{
+			"limiter": func() any { return map[string]int{"tokens": 3} },
+		},
+		Toggles:  map[string]*Toggle{"maintenance": &maintenance},
+		LogLevel: &level,
+	}
+	handler := admin.Handler()
+
+	var tests = []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		status   int
+		contains string
+		excludes string
+	}{
+		{"build", "GET", "/build", "", http.StatusOK, "go_version", ""},
+		{"config", "GET", "/config", "", http.StatusOK, "8080", "hunter2"},
+		{"runtime", "GET", "/runtime", "", http.StatusOK, "goroutines", ""},
+		{"errors", "GET", "/errors", "", http.StatusOK, "boom", ""},
+		{"state", "GET", "/state", "", http.StatusOK, `"tokens":3`, ""},
+		{"set toggle", "POST", "/toggles", `{"maintenance":true}`, http.StatusOK, `"maintenance":true`, ""},
+		{"unknown toggle", "POST", "/toggles", `{"debug":true}`, http.StatusBadRequest, "unknown toggle", ""},
+		{"set log level", "POST", "/loglevel", `{"level":"debug"}`, http.StatusOK, `"debug"`, ""},
+		{"bad log level", "POST", "/loglevel", `{"level":"loud"}`, http.StatusBadRequest, "unknown log level", ""},
+		{"bad method", "DELETE", "/build", "", http.StatusMethodNotAllowed, "", ""},
+		{"not found", "GET", "/nope", "", http.StatusNotFound, "", ""},
+	}
+
+	for _, e := range tests {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(e.method, e.path, strings.NewReader(e.body)))
+
+		if rr.Code != e.status {
+			t.Errorf("%s: expected status %d, got %d", e.name, e.status, rr.Code)
+		}
+		if !strings.Contains(rr.Body.String(), e.contains) {
+			t.Errorf("%s: expected body to contain %q, got %s", e.name, e.contains, rr.Body.String())
+		}
+		if e.excludes != "" && strings.Contains(rr.Body.String(), e.excludes) {
+			t.Errorf("%s: body should not contain %q", e.name, e.excludes)
+		}
+	}
+
+	if !maintenance.Enabled() {
+		t.Error("maintenance toggle was not switched on")
+	}
+	if level.Level() != LevelDebug {
+		t.Error("log level was not changed, got", level.Level())
+	}
+
+	// the config isn't shown unredacted
+	admin.Redactor = nil
+	rr := httptest.NewRecorder()
+	admin.Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/config", nil))
+	if rr.Code != http.StatusForbidden || strings.Contains(rr.Body.String(), "hunter2") {
+		t.Errorf("expected the config refused without a redactor, got %d %s", rr.Code, rr.Body)
+	}
+
+	// an unprotected admin refuses everything
+	var open Admin
+	rr = httptest.NewRecorder()
+	open.Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/build", nil))
+	if rr.Code != http.StatusForbidden {
+		t.Error("expected unprotected admin to refuse requests, got", rr.Code)
+	}
+}
+
+func TestMaintenanceMiddleware(t *testing.T) {
+	var maintenance Toggle
+	handler := MaintenanceMiddleware(&maintenance)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if rr.Code != http.StatusOK {
+		t.Error("expected 200 when not in maintenance, got", rr.Code)
+	}
+
+	maintenance.Set(true)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Error("expected 503 in maintenance, got", rr.Code)
+	}
+
+	var payload JSONResponse
+	_ = json.NewDecoder(rr.Body).Decode(&payload)
+	if !payload.Error {
+		t.Error("expected a JSON error payload")
+	}
+}
+
+func TestAdmin_LogLevelAudit(t *testing.T) {
+	var global, storage LevelVar
+	global.Set(LevelInfo)
+	storage.Set(LevelWarn)
+	var maintenance Toggle
+	var changes []AdminChange
+	admin := Admin{
+		Protect:   func(next http.Handler) http.Handler { return next },
+		LogLevel:  &global,
+		LogLevels: map[string]*LevelVar{"storage": &storage},
+		Toggles:   map[string]*Toggle{"maintenance": &maintenance},
+		Audit:     func(ctx context.Context, c AdminChange) { changes = append(changes, c) },
+	}
+	handler := admin.Handler()
+
+	var tests = []struct {
+		path, body string
+		status     int
+		contains   string
+	}{
+		{"/loglevel", `{"level":"debug","component":"storage"}`, http.StatusOK, `"storage":"debug"`},
+		{"/loglevel", `{"level":"error"}`, http.StatusOK, `"level":"error"`},
+		{"/loglevel", `{"level":"error"}`, http.StatusOK, `"level":"error"`},
+		{"/loglevel", `{"level":"debug","component":"queue"}`, http.StatusBadRequest, "unknown log level component queue"},
+		{"/toggles", `{"maintenance":true}`, http.StatusOK, `"maintenance":true`},
+	}
+	for _, e := range tests {
+		req := httptest.NewRequest("POST", e.path, strings.NewReader(e.body))
+		req.SetBasicAuth("alice", "secret")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != e.status || !strings.Contains(rr.Body.String(), e.contains) {
+			t.Errorf("%s %s: expected %d containing %q, got %d %s", e.path, e.body, e.status, e.contains, rr.Code, rr.Body.String())
+		}
+	}
+
+	want := []AdminChange{
+		{Actor: "alice", Setting: "loglevel.storage", Old: "warn", New: "debug"},
+		{Actor: "alice", Setting: "loglevel", Old: "info", New: "error"},
+		{Actor: "alice", Setting: "toggles.maintenance", Old: "false", New: "true"},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("expected %d audited changes, got %+v", len(want), changes)
+	}
+	for i, c := range changes {
+		c.At = time.Time{}
+		if c != want[i] {
+			t.Errorf("expected %+v, got %+v", want[i], c)
+		}
+	}
+}
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	var level LevelVar
+	level.Set(LevelWarn)
+	logger := &Logger{Output: log.New(&buf, "", 0), Level: &level, Component: "storage"}
+
+	logger.Debugf("hidden %d", 1)
+	logger.Infof("hidden %d", 2)
+	logger.Warnf("shown %d", 3)
+	logger.Errorf("shown %d", 4)
+	level.Set(LevelDebug)
+	logger.Debugf("shown %d", 5)
+
+	if want := "[storage] warn: shown 3\n[storage] error: shown 4\n[storage] debug: shown 5\n"; buf.String() != want {
+		t.Errorf("expected %q, got %q", want, buf.String())
+	}
+}
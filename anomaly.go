@@ -0,0 +1,221 @@
+package toolkit
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Anomaly metrics and kinds
+const (
+	AnomalyRequests    = "requests"
+	AnomalyErrorRate   = "error_rate"
+	AnomalyUploadBytes = "upload_bytes"
+
+	// AnomalyThreshold is a metric over its configured maximum
+	AnomalyThreshold = "threshold"
+	// AnomalySpike is a metric far above its recent average
+	AnomalySpike = "spike"
+)
+
+// Anomaly is unusual traffic from one key or client
+type Anomaly struct {
+	Key    string `json:"key"`
+	Metric string `json:"metric"`
+	Kind   string `json:"kind"`
+	// Value is the metric in the current window
+	Value float64 `json:"value"`
+	// Limit is the threshold, or for spikes the average of the previous windows times the
+	// spike factor
+	Limit float64   `json:"limit"`
+	At    time.Time `json:"at"`
+}
+
+// AnomalyDetector watches the requests, server error rate, and upload volume of each key or
+// client address over fixed windows, and calls OnAnomaly when one goes over a threshold or
+// spikes far above its recent average. Each anomaly is reported once per window.
+type AnomalyDetector struct {
+	// Key identifies the client of a request. Defaults to the client's IP address
+	Key func(r *http.Request) string
+	// TrustedProxies are believed when finding the client's IP address
+	TrustedProxies []*net.IPNet
+	// Window is the length of a window. Defaults to one minute
+	Window time.Duration
+	// MaxRequests, MaxErrorRate and MaxUploadBytes are thresholds per window. Zero disables
+	// each; MaxErrorRate is a fraction, such as 0.5
+	MaxRequests    int64
+	MaxErrorRate   float64
+	MaxUploadBytes int64
+	// SpikeFactor reports a window whose requests or upload volume is more than this many
+	// times the average of the previous windows. Zero disables spike detection
+	SpikeFactor float64
+	// History is the number of previous windows averaged for spikes. Defaults to 10
+	History int
+	// MinRequests is the number of requests in a window before error rates and spikes are
+	// judged, so a handful of requests can't raise alarms. Defaults to 20
+	MinRequests int64
+	// OnAnomaly receives anomalies, such as to alert or to ban the client
+	OnAnomaly func(ctx context.Context, a Anomaly)
+
+	mu    sync.Mutex
+	keys  map[string]*anomalyKey
+	sweep int64
+}
+
+type anomalyCounts struct {
+	requests, errors, upload int64
+}
+
+type anomalyKey struct {
+	window  int64
+	current anomalyCounts
+	history []anomalyCounts
+	fired   map[string]bool
+}
+
+func (ad *AnomalyDetector) window() time.Duration {
+	if ad.Window > 0 {
+		return ad.Window
+	}
+	return time.Minute
+}
+
+func (ad *AnomalyDetector) history() int {
+	if ad.History > 0 {
+		return ad.History
+	}
+	return 10
+}
+
+func (ad *AnomalyDetector) minRequests() int64 {
+	if ad.MinRequests > 0 {
+		return ad.MinRequests
+	}
+	return 20
+}
+
+// Middleware records each request, by its key, response status and body size
+func (ad *AnomalyDetector) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var key string
+		if ad.Key != nil {
+			key = ad.Key(r)
+		} else if ip := requestClientIP(r, ad.TrustedProxies); ip != nil {
+			key = ip.String()
+		}
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body := countBody(r)
+		cw := newCountingWriter(w)
+
+		next.ServeHTTP(cw, r)
+		ad.Record(r.Context(), key, cw.Status(), body.Count())
+	})
+}
+
+// Record records a request by key, with its response status and upload size, for traffic
+// which doesn't pass through Middleware
+func (ad *AnomalyDetector) Record(ctx context.Context, key string, status int, uploaded int64) {
+	now := time.Now()
+	anomalies := ad.record(key, status, uploaded, now)
+	if ad.OnAnomaly != nil {
+		for _, a := range anomalies {
+			ad.OnAnomaly(ctx, a)
+		}
+	}
+}
+
+func (ad *AnomalyDetector) record(key string, status int, uploaded int64, now time.Time) []Anomaly {
+	ad.mu.Lock()
+	defer ad.mu.Unlock()
+
+	window := now.UnixNano() / int64(ad.window())
+	if ad.keys == nil {
+		ad.keys = make(map[string]*anomalyKey)
+	}
+	if window != ad.sweep {
+		// forget keys which have been quiet for the whole history
+		ad.sweep = window
+		for k, s := range ad.keys {
+			if window-s.window > int64(ad.history()) {
+				delete(ad.keys, k)
+			}
+		}
+	}
+
+	s, ok := ad.keys[key]
+	if !ok {
+		s = &anomalyKey{window: window}
+		ad.keys[key] = s
+	}
+	if window != s.window {
+		s.history = append(s.history, s.current)
+		for gap := window - s.window - 1; gap > 0 && gap <= int64(ad.history()); gap-- {
+			s.history = append(s.history, anomalyCounts{})
+		}
+		if len(s.history) > ad.history() {
+			s.history = s.history[len(s.history)-ad.history():]
+		}
+		s.window, s.current, s.fired = window, anomalyCounts{}, nil
+	}
+
+	s.current.requests++
+	s.current.upload += uploaded
+	if status >= 500 {
+		s.current.errors++
+	}
+
+	var anomalies []Anomaly
+	check := func(metric, kind string, value, limit float64) {
+		if value <= limit || s.fired[metric+kind] {
+			return
+		}
+		if s.fired == nil {
+			s.fired = make(map[string]bool)
+		}
+		s.fired[metric+kind] = true
+		anomalies = append(anomalies, Anomaly{Key: key, Metric: metric, Kind: kind, Value: value, Limit: limit, At: now})
+	}
+
+	c := s.current
+	if ad.MaxRequests > 0 {
+		check(AnomalyRequests, AnomalyThreshold, float64(c.requests), float64(ad.MaxRequests))
+	}
+	if ad.MaxUploadBytes > 0 {
+		check(AnomalyUploadBytes, AnomalyThreshold, float64(c.upload), float64(ad.MaxUploadBytes))
+	}
+	if c.requests < ad.minRequests() {
+		return anomalies
+	}
+	if ad.MaxErrorRate > 0 {
+		check(AnomalyErrorRate, AnomalyThreshold, float64(c.errors)/float64(c.requests), ad.MaxErrorRate)
+	}
+
+	// spikes need a few windows of history to compare against
+	if ad.SpikeFactor > 0 && len(s.history) >= 3 {
+		var requests, upload float64
+		for _, h := range s.history {
+			requests += float64(h.requests)
+			upload += float64(h.upload)
+		}
+		n := float64(len(s.history))
+		// an average of zero would make any traffic a spike
+		check(AnomalyRequests, AnomalySpike, float64(c.requests), ad.SpikeFactor*maxFloat(requests/n, 1))
+		if c.upload > 0 {
+			check(AnomalyUploadBytes, AnomalySpike, float64(c.upload), ad.SpikeFactor*maxFloat(upload/n, 1024))
+		}
+	}
+	return anomalies
+}
+
+func maxFloat(a, b float64) float64 {
+	if a > b {
+		return a
+	}
+	return b
+}
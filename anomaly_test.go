@@ -0,0 +1,96 @@
+package toolkit
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAnomalyDetector_Thresholds(t *testing.T) {
+	var got []Anomaly
+	ad := &AnomalyDetector{
+		Window:         time.Hour,
+		MaxRequests:    30,
+		MaxErrorRate:   0.5,
+		MaxUploadBytes: 100,
+		OnAnomaly:      func(_ context.Context, a Anomaly) { got = append(got, a) },
+	}
+
+	h := ad.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	do := func(path, body string) {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.RemoteAddr = "203.0.113.9:1234"
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// errors alone don't count until there are enough requests
+	for i := 0; i < 15; i++ {
+		do("/fail", "")
+	}
+	if len(got) != 0 {
+		t.Fatalf("expected no anomalies yet, got %+v", got)
+	}
+	for i := 0; i < 16; i++ {
+		do("/fail", "")
+	}
+	do("/", strings.Repeat("x", 200))
+	do("/", strings.Repeat("x", 200))
+
+	var tests = []struct {
+		metric string
+		value  float64
+	}{
+		{AnomalyErrorRate, 1},
+		{AnomalyRequests, 31},
+		{AnomalyUploadBytes, 200},
+	}
+	if len(got) != len(tests) {
+		t.Fatalf("expected %d anomalies, reported once each, but got %+v", len(tests), got)
+	}
+	for i, e := range tests {
+		if got[i].Metric != e.metric || got[i].Kind != AnomalyThreshold || got[i].Value != e.value || got[i].Key != "203.0.113.9" {
+			t.Errorf("%s: unexpected anomaly %+v", e.metric, got[i])
+		}
+	}
+}
+
+func TestAnomalyDetector_Spikes(t *testing.T) {
+	ad := &AnomalyDetector{SpikeFactor: 5, History: 4}
+	start := time.Unix(1700000000, 0)
+
+	record := func(window, requests int) []Anomaly {
+		var anomalies []Anomaly
+		now := start.Add(time.Duration(window) * time.Minute)
+		for i := 0; i < requests; i++ {
+			anomalies = append(anomalies, ad.record("key", 200, 0, now)...)
+		}
+		return anomalies
+	}
+
+	for w := 0; w < 4; w++ {
+		if a := record(w, 20); len(a) != 0 {
+			t.Fatalf("window %d: unexpected anomalies %+v", w, a)
+		}
+	}
+	if a := record(4, 90); len(a) != 0 {
+		t.Errorf("expected 90 requests not to be a spike over an average of 20, got %+v", a)
+	}
+	a := record(5, 200)
+	if len(a) != 1 || a[0].Kind != AnomalySpike || a[0].Value <= a[0].Limit {
+		t.Errorf("expected one spike, got %+v", a)
+	}
+
+	// a quiet key is forgotten, so a burst after a long gap has no history to spike against
+	if a = record(100, 200); len(a) != 0 {
+		t.Errorf("expected no spike without history, got %+v", a)
+	}
+}
@@ -0,0 +1,329 @@
+package toolkit
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// AudienceTag is the struct tag listing the audiences allowed to see a field, for example
+// `audience:"admin,owner"`. Fields without it are visible to every audience.
+const AudienceTag = "audience"
+
+type audienceContextKey struct{}
+
+// AudienceMiddleware resolves the audience of each request, such as "admin", "owner" or
+// "public", and has WriteJSON leave out the fields of the response which are tagged for
+// other audiences. An empty audience only sees untagged fields.
+func AudienceMiddleware(resolve func(r *http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			audience := resolve(r)
+			r = r.WithContext(context.WithValue(r.Context(), audienceContextKey{}, audience))
+			next.ServeHTTP(&audienceWriter{ResponseWriter: w, audience: audience}, r)
+		})
+	}
+}
+
+// AudienceFromContext returns the audience resolved by AudienceMiddleware
+func AudienceFromContext(ctx context.Context) (string, bool) {
+	audience, ok := ctx.Value(audienceContextKey{}).(string)
+	return audience, ok
+}
+
+// audienceWriter carries the audience for WriteJSON to mask the response for
+type audienceWriter struct {
+	http.ResponseWriter
+	audience string
+}
+
+// Flush implements http.Flusher when the underlying writer does
+func (aw *audienceWriter) Flush() {
+	if f, ok := aw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer
+func (aw *audienceWriter) Unwrap() http.ResponseWriter {
+	return aw.ResponseWriter
+}
+
+// responseAudience returns the audience of the response being written to w, if any
+func responseAudience(w http.ResponseWriter) (string, bool) {
+	for {
+		switch v := w.(type) {
+		case *audienceWriter:
+			return v.audience, true
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = v.Unwrap()
+		default:
+			return "", false
+		}
+	}
+}
+
+// MaskFields returns data with the struct fields audience may not see left out. Values with
+// nothing to leave out are returned as they are; otherwise the structs holding masked fields
+// are replaced by values which marshal to the same JSON, minus those fields.
+func MaskFields(data any, audience string) any {
+	v := reflect.ValueOf(data)
+	if !v.IsValid() || !mayMask(v.Type()) {
+		return data
+	}
+	masked, changed := maskValue(v, audience, 0)
+	if !changed {
+		return data
+	}
+	return masked
+}
+
+// audienceAllowed reports whether audience may see a field with tag
+func audienceAllowed(tag reflect.StructTag, audience string) bool {
+	allowed, ok := tag.Lookup(AudienceTag)
+	if !ok {
+		return true
+	}
+	for allowed != "" {
+		var a string
+		a, allowed, _ = strings.Cut(allowed, ",")
+		if audience != "" && strings.TrimSpace(a) == audience {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// marshalsItself reports whether values of typ choose their own JSON, so their fields
+// aren't masked
+func marshalsItself(typ reflect.Type) bool {
+	return typ.Implements(jsonMarshalerType) || typ.Implements(textMarshalerType) ||
+		reflect.PtrTo(typ).Implements(jsonMarshalerType) || reflect.PtrTo(typ).Implements(textMarshalerType)
+}
+
+var mayMaskCache sync.Map // reflect.Type -> bool
+
+// mayMask reports whether values of typ might hold a field with an audience tag, so that
+// most responses are written without being walked
+func mayMask(typ reflect.Type) bool {
+	if cached, ok := mayMaskCache.Load(typ); ok {
+		return cached.(bool)
+	}
+	result := typeMayMask(typ, make(map[reflect.Type]bool))
+	mayMaskCache.Store(typ, result)
+	return result
+}
+
+func typeMayMask(typ reflect.Type, seen map[reflect.Type]bool) bool {
+	if seen[typ] {
+		return false
+	}
+	seen[typ] = true
+
+	switch typ.Kind() {
+	case reflect.Interface:
+		return true
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		return typeMayMask(typ.Elem(), seen)
+	case reflect.Map:
+		return typ.Key().Kind() == reflect.String && typeMayMask(typ.Elem(), seen)
+	case reflect.Struct:
+		if marshalsItself(typ) {
+			return false
+		}
+		for _, f := range TypeFields(typ) {
+			if _, ok := f.Tag.Lookup(AudienceTag); ok || typeMayMask(f.Type, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// maskValue returns v with the fields audience may not see left out, and whether anything
+// was left out
+func maskValue(v reflect.Value, audience string, depth int) (any, bool) {
+	if !v.IsValid() || !v.CanInterface() {
+		return nil, false
+	}
+	if depth > MaxWalkDepth || !mayMask(v.Type()) {
+		return v.Interface(), false
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return v.Interface(), false
+		}
+		masked, changed := maskValue(v.Elem(), audience, depth+1)
+		if !changed {
+			return v.Interface(), false
+		}
+		return masked, true
+	case reflect.Struct:
+		return maskStruct(v, audience, depth)
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return v.Interface(), false
+		}
+		out := make([]any, v.Len())
+		changed := false
+		for i := range out {
+			var c bool
+			out[i], c = maskValue(v.Index(i), audience, depth+1)
+			changed = changed || c
+		}
+		if !changed {
+			return v.Interface(), false
+		}
+		return out, true
+	case reflect.Map:
+		if v.IsNil() {
+			return v.Interface(), false
+		}
+		out := make(map[string]any, v.Len())
+		changed := false
+		iter := v.MapRange()
+		for iter.Next() {
+			var c bool
+			out[iter.Key().String()], c = maskValue(iter.Value(), audience, depth+1)
+			changed = changed || c
+		}
+		if !changed {
+			return v.Interface(), false
+		}
+		return out, true
+	}
+	return v.Interface(), false
+}
+
+// maskStruct masks the fields of a struct. When the only changes are inside interface fields,
+// such as JSONResponse.Data, it returns a copy of the struct so that its type is kept;
+// otherwise it returns a maskedObject.
+func maskStruct(v reflect.Value, audience string, depth int) (any, bool) {
+	if marshalsItself(v.Type()) {
+		return v.Interface(), false
+	}
+
+	obj, replaced, changed, flattened := maskFields(v, audience, depth)
+	if !changed {
+		return v.Interface(), false
+	}
+	if flattened {
+		return obj, true
+	}
+
+	cp := reflect.New(v.Type()).Elem()
+	cp.Set(v)
+	for i, masked := range replaced {
+		if masked == nil {
+			cp.Field(i).Set(reflect.Zero(cp.Field(i).Type()))
+			continue
+		}
+		cp.Field(i).Set(reflect.ValueOf(masked))
+	}
+	return cp.Interface(), true
+}
+
+// maskFields returns the fields of a struct which audience may see, the masked values of
+// its interface fields which changed, whether anything changed, and whether anything other
+// than an interface field changed
+func maskFields(v reflect.Value, audience string, depth int) (obj maskedObject, replaced map[int]any, changed, flattened bool) {
+	for _, f := range TypeFields(v.Type()) {
+		if !audienceAllowed(f.Tag, audience) {
+			changed, flattened = true, true
+			continue
+		}
+
+		fv := v.Field(f.Index)
+		if f.Embedded {
+			// promote the embedded struct's fields, as encoding/json does
+			ev := reflect.Indirect(fv)
+			if !ev.IsValid() {
+				continue
+			}
+			inner, _, c, _ := maskFields(ev, audience, depth+1)
+			obj = append(obj, inner...)
+			if c {
+				changed, flattened = true, true
+			}
+			continue
+		}
+
+		masked, c := maskValue(fv, audience, depth+1)
+		if c {
+			changed = true
+			if f.Type.Kind() == reflect.Interface {
+				if replaced == nil {
+					replaced = make(map[int]any)
+				}
+				replaced[f.Index] = masked
+			} else {
+				flattened = true
+			}
+		}
+
+		if f.OmitEmpty && isEmptyValue(fv) {
+			continue
+		}
+		obj = append(obj, maskedField{name: f.JSONName, value: masked})
+	}
+	return obj, replaced, changed, flattened
+}
+
+// isEmptyValue reports whether omitempty leaves v out, as encoding/json decides it
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+type maskedField struct {
+	name  string
+	value any
+}
+
+// maskedObject is a struct with some fields masked, which marshals to a JSON object with its
+// remaining fields in their original order
+type maskedObject []maskedField
+
+// MarshalJSON implements json.Marshaler
+func (o maskedObject) MarshalJSON() ([]byte, error) {
+	buf := []byte{'{'}
+	for i, f := range o {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		name, err := json.Marshal(f.name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, err
+		}
+		buf = append(append(append(buf, name...), ':'), value...)
+	}
+	return append(buf, '}'), nil
+}
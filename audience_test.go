@@ -0,0 +1,101 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type audienceTimestamps struct {
+	Created time.Time `json:"created"`
+	Deleted string    `json:"deleted,omitempty" audience:"admin"`
+}
+
+type audienceUser struct {
+	audienceTimestamps
+	ID      int      `json:"id"`
+	Name    string   `json:"name"`
+	Email   string   `json:"email" audience:"admin,owner"`
+	Notes   string   `json:"notes,omitempty" audience:"admin"`
+	Friends []string `json:"friends" audience:"owner"`
+}
+
+func TestMaskFields(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	user := audienceUser{
+		audienceTimestamps: audienceTimestamps{Created: created, Deleted: "no"},
+		ID:                 1, Name: "Jo", Email: "jo@example.com", Notes: "vip", Friends: []string{"al"},
+	}
+
+	var tests = []struct {
+		name     string
+		audience string
+		data     any
+		expected string
+	}{
+		{"admin", "admin", user, `{"created":"2024-01-02T03:04:05Z","deleted":"no","id":1,"name":"Jo","email":"jo@example.com","notes":"vip"}`},
+		{"owner", "owner", &user, `{"created":"2024-01-02T03:04:05Z","id":1,"name":"Jo","email":"jo@example.com","friends":["al"]}`},
+		{"public", "public", user, `{"created":"2024-01-02T03:04:05Z","id":1,"name":"Jo"}`},
+		{"no audience", "", user, `{"created":"2024-01-02T03:04:05Z","id":1,"name":"Jo"}`},
+		{"slice", "public", []audienceUser{user}, `[{"created":"2024-01-02T03:04:05Z","id":1,"name":"Jo"}]`},
+		{"map", "public", map[string]any{"user": user}, `{"user":{"created":"2024-01-02T03:04:05Z","id":1,"name":"Jo"}}`},
+		{"untagged", "public", struct{ A int }{1}, `{"A":1}`},
+	}
+
+	for _, e := range tests {
+		out, err := json.Marshal(MaskFields(e.data, e.audience))
+		if err != nil {
+			t.Errorf("%s: %s", e.name, err)
+			continue
+		}
+		if string(out) != e.expected {
+			t.Errorf("%s: expected %s, got %s", e.name, e.expected, out)
+		}
+	}
+}
+
+func TestMaskFields_KeepsEnvelope(t *testing.T) {
+	payload := JSONResponse{Message: "ok", Data: audienceUser{ID: 1, Email: "jo@example.com"}}
+
+	masked, ok := MaskFields(payload, "public").(JSONResponse)
+	if !ok {
+		t.Fatal("expected the envelope to keep its type")
+	}
+	out, _ := json.Marshal(masked.Data)
+	if string(out) != `{"created":"0001-01-01T00:00:00Z","id":1,"name":""}` {
+		t.Errorf("unexpected data %s", out)
+	}
+}
+
+func TestAudienceMiddleware(t *testing.T) {
+	handler := AudienceMiddleware(func(r *http.Request) string {
+		return r.Header.Get("X-Audience")
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if audience, _ := AudienceFromContext(r.Context()); audience != r.Header.Get("X-Audience") {
+			t.Errorf("unexpected audience %q in context", audience)
+		}
+		var tools Tools
+		_ = tools.WriteJSON(w, http.StatusOK, audienceUser{ID: 1, Email: "jo@example.com"})
+	}))
+
+	var tests = []struct {
+		audience string
+		expected string
+	}{
+		{"admin", `{"created":"0001-01-01T00:00:00Z","id":1,"name":"","email":"jo@example.com"}`},
+		{"public", `{"created":"0001-01-01T00:00:00Z","id":1,"name":""}`},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Audience", e.audience)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Body.String() != e.expected {
+			t.Errorf("%s: expected %s, got %s", e.audience, e.expected, rr.Body.String())
+		}
+	}
+}
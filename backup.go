@@ -0,0 +1,462 @@
+package toolkit
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrBackupCorrupt is returned when backed up contents don't match their manifest
+var ErrBackupCorrupt = errors.New("backup is corrupt")
+
+// BackupManifest lists the files in a backup
+type BackupManifest struct {
+	ID        string       `json:"id"`
+	CreatedAt time.Time    `json:"created_at"`
+	Files     []BackupFile `json:"files"`
+}
+
+// BackupFile is a file in a backup
+type BackupFile struct {
+	// Path is slash separated and relative to the directory backed up
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	SHA256  string    `json:"sha256"`
+}
+
+// Backups backs up a local directory, such as the upload directory, to a Storage. File
+// contents are stored once under their SHA-256 and shared between backups, and each backup
+// has a manifest listing every file, so any backup can be restored on its own.
+type Backups struct {
+	// Dir is the directory backed up
+	Dir string
+	// Storage holds the backups
+	Storage Storage
+	// Prefix is prepended to the keys of backups. Defaults to "backups/"
+	Prefix string
+}
+
+func (b *Backups) prefix() string {
+	if b.Prefix != "" {
+		return b.Prefix
+	}
+	return "backups/"
+}
+
+func (b *Backups) objectKey(sum string) string {
+	return b.prefix() + "objects/" + sum[:2] + "/" + sum
+}
+
+func (b *Backups) manifestKey(id string) string {
+	return b.prefix() + "manifests/" + id + ".json"
+}
+
+// Backup backs up the directory and returns the new backup's manifest. An incremental backup
+// trusts the checksums in the latest backup for files whose size and modification time are
+// unchanged, so only changed files are read; otherwise every file is read and hashed.
+func (b *Backups) Backup(ctx context.Context, incremental bool) (*BackupManifest, error) {
+	previous := make(map[string]BackupFile)
+	if incremental {
+		ids, err := b.List(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if len(ids) > 0 {
+			latest, err := b.Manifest(ctx, ids[len(ids)-1])
+			if err != nil {
+				return nil, err
+			}
+			for _, f := range latest.Files {
+				previous[f.Path] = f
+			}
+		}
+	}
+
+	now := time.Now().UTC()
+	manifest := &BackupManifest{ID: now.Format("20060102T150405.000000000Z"), CreatedAt: now}
+
+	err := walkBackupDir(ctx, b.Dir, func(f BackupFile, p string) error {
+		if prev, ok := previous[f.Path]; ok && prev.Size == f.Size && prev.ModTime.Equal(f.ModTime) {
+			manifest.Files = append(manifest.Files, prev)
+			return nil
+		}
+
+		sum, err := fileSHA256(p)
+		if err != nil {
+			return err
+		}
+		f.SHA256 = sum
+
+		// contents already backed up aren't stored again
+		if _, err = b.Storage.Stat(ctx, b.objectKey(sum)); errors.Is(err, ErrNotFound) {
+			file, err := os.Open(p)
+			if err != nil {
+				return err
+			}
+			err = b.Storage.Put(ctx, b.objectKey(sum), file)
+			file.Close()
+			if err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		}
+
+		manifest.Files = append(manifest.Files, f)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err = b.Storage.Put(ctx, b.manifestKey(manifest.ID), bytes.NewReader(out)); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// List returns the IDs of the backups, oldest first
+func (b *Backups) List(ctx context.Context) ([]string, error) {
+	objects, err := b.Storage.List(ctx, b.prefix()+"manifests/")
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, obj := range objects {
+		if id := strings.TrimSuffix(path.Base(obj.Key), ".json"); id != path.Base(obj.Key) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// Manifest returns a backup's manifest
+func (b *Backups) Manifest(ctx context.Context, id string) (*BackupManifest, error) {
+	if id == "" || strings.ContainsAny(id, "/\\") {
+		return nil, ErrNotFound
+	}
+	rc, err := b.Storage.Get(ctx, b.manifestKey(id))
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var manifest BackupManifest
+	if err = json.NewDecoder(rc).Decode(&manifest); err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+// Verify reads every file of a backup, checking it is stored and matches its checksum
+func (b *Backups) Verify(ctx context.Context, id string) error {
+	manifest, err := b.Manifest(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range manifest.Files {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		if !sha256Hex.MatchString(f.SHA256) {
+			return fmt.Errorf("%w: invalid checksum for %s", ErrBackupCorrupt, f.Path)
+		}
+		rc, err := b.Storage.Get(ctx, b.objectKey(f.SHA256))
+		if errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("%w: %s is missing", ErrBackupCorrupt, f.Path)
+		}
+		if err != nil {
+			return err
+		}
+		h := sha256.New()
+		_, err = io.Copy(h, rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+		if hex.EncodeToString(h.Sum(nil)) != f.SHA256 {
+			return fmt.Errorf("%w: %s does not match its checksum", ErrBackupCorrupt, f.Path)
+		}
+	}
+	return nil
+}
+
+// Restore restores a backup into dir, verifying each file against its checksum as it is
+// written. Files already in dir with the right contents are left alone; other files in dir
+// are not removed.
+func (b *Backups) Restore(ctx context.Context, id, dir string) error {
+	manifest, err := b.Manifest(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range manifest.Files {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		p, err := restorePath(dir, f)
+		if err != nil {
+			return err
+		}
+		if !sha256Hex.MatchString(f.SHA256) {
+			return fmt.Errorf("%w: invalid checksum for %s", ErrBackupCorrupt, f.Path)
+		}
+		if sum, err := fileSHA256(p); err == nil && sum == f.SHA256 {
+			continue
+		}
+
+		rc, err := b.Storage.Get(ctx, b.objectKey(f.SHA256))
+		if errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("%w: %s is missing", ErrBackupCorrupt, f.Path)
+		}
+		if err != nil {
+			return err
+		}
+		err = restoreFile(p, f, rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteBackupArchive writes a gzipped tar archive of dir to w, with the manifest as its last
+// entry, for keeping a backup outside a Storage
+func WriteBackupArchive(ctx context.Context, dir string, w io.Writer) (*BackupManifest, error) {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	now := time.Now().UTC()
+	manifest := &BackupManifest{ID: now.Format("20060102T150405.000000000Z"), CreatedAt: now}
+
+	err := walkBackupDir(ctx, dir, func(f BackupFile, p string) error {
+		file, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		hdr := &tar.Header{Name: "files/" + f.Path, Mode: 0644, Size: f.Size, ModTime: f.ModTime, Typeflag: tar.TypeReg}
+		if err = tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		// the size is fixed by the header, in case the file changes while it is read
+		h := sha256.New()
+		if _, err = io.CopyN(io.MultiWriter(tw, h), file, f.Size); err != nil {
+			return err
+		}
+		f.SHA256 = hex.EncodeToString(h.Sum(nil))
+		manifest.Files = append(manifest.Files, f)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err = tw.WriteHeader(&tar.Header{Name: "manifest.json", Mode: 0644, Size: int64(len(out)), ModTime: now, Typeflag: tar.TypeReg}); err != nil {
+		return nil, err
+	}
+	if _, err = tw.Write(out); err != nil {
+		return nil, err
+	}
+	if err = tw.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, gz.Close()
+}
+
+// RestoreBackupArchive restores an archive written by WriteBackupArchive into dir. Files are
+// unpacked to a staging directory inside dir and only moved into place once every file has
+// been checked against the manifest, so a corrupt archive changes nothing.
+func RestoreBackupArchive(ctx context.Context, r io.Reader, dir string) (*BackupManifest, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(gz)
+
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	staging, err := os.MkdirTemp(dir, ".restore-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(staging)
+
+	sums := make(map[string]string)
+	var manifest *BackupManifest
+	for {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrBackupCorrupt, err)
+		}
+
+		switch {
+		case hdr.Name == "manifest.json":
+			manifest = &BackupManifest{}
+			if err = json.NewDecoder(tr).Decode(manifest); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrBackupCorrupt, err)
+			}
+		case strings.HasPrefix(hdr.Name, "files/") && hdr.Typeflag == tar.TypeReg:
+			f := BackupFile{Path: strings.TrimPrefix(hdr.Name, "files/"), ModTime: hdr.ModTime}
+			p, err := restorePath(staging, f)
+			if err != nil {
+				return nil, err
+			}
+			if err = os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+				return nil, err
+			}
+			out, err := os.Create(p)
+			if err != nil {
+				return nil, err
+			}
+			h := sha256.New()
+			_, err = io.Copy(io.MultiWriter(out, h), tr)
+			if closeErr := out.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return nil, err
+			}
+			sums[f.Path] = hex.EncodeToString(h.Sum(nil))
+		}
+	}
+
+	if manifest == nil {
+		return nil, fmt.Errorf("%w: the archive has no manifest", ErrBackupCorrupt)
+	}
+	for _, f := range manifest.Files {
+		if sums[f.Path] != f.SHA256 {
+			return nil, fmt.Errorf("%w: %s does not match its checksum", ErrBackupCorrupt, f.Path)
+		}
+	}
+
+	for _, f := range manifest.Files {
+		staged, _ := restorePath(staging, f)
+		p, _ := restorePath(dir, f)
+		if err = os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return nil, err
+		}
+		if err = os.Rename(staged, p); err != nil {
+			return nil, err
+		}
+		_ = os.Chtimes(p, f.ModTime, f.ModTime)
+	}
+	return manifest, nil
+}
+
+// walkBackupDir calls fn with each regular file under dir, and its path on disk
+func walkBackupDir(ctx context.Context, dir string, fn func(f BackupFile, p string) error) error {
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() && p != dir && strings.HasPrefix(d.Name(), ".restore-") {
+			return filepath.SkipDir
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		return fn(BackupFile{Path: filepath.ToSlash(rel), Size: info.Size(), ModTime: info.ModTime().UTC()}, p)
+	})
+}
+
+// restorePath returns where a backed up file goes under dir, refusing paths which would
+// escape it
+func restorePath(dir string, f BackupFile) (string, error) {
+	clean := path.Clean("/" + f.Path)
+	if f.Path == "" || clean == "/" || strings.Contains(f.Path, "\\") || clean != "/"+f.Path {
+		return "", fmt.Errorf("%w: invalid path %q", ErrBackupCorrupt, f.Path)
+	}
+	return filepath.Join(dir, filepath.FromSlash(clean)), nil
+}
+
+// restoreFile writes r to p through a temporary file, which is only renamed into place if
+// its contents match f's checksum
+func restoreFile(p string, f BackupFile, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".restore-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, h), r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if hex.EncodeToString(h.Sum(nil)) != f.SHA256 {
+		return fmt.Errorf("%w: %s does not match its checksum", ErrBackupCorrupt, f.Path)
+	}
+
+	if err = os.Rename(tmp.Name(), p); err != nil {
+		return err
+	}
+	return os.Chtimes(p, f.ModTime, f.ModTime)
+}
+
+func fileSHA256(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
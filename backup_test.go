@@ -0,0 +1,206 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newBackupTest(t *testing.T) (string, *Backups, *FileStorage) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"a.txt":          "alpha",
+		"nested/b.txt":   "bravo",
+		"nested/c.png":   "charlie",
+		"nested/dupe.md": "alpha",
+	}
+	for name, contents := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		_ = os.MkdirAll(filepath.Dir(p), 0755)
+		if err := os.WriteFile(p, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	store := &FileStorage{Dir: t.TempDir()}
+	return dir, &Backups{Dir: dir, Storage: store}, store
+}
+
+func readTree(t *testing.T, dir string) map[string]string {
+	files := make(map[string]string)
+	_ = filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err == nil && !fi.IsDir() {
+			rel, _ := filepath.Rel(dir, p)
+			b, _ := os.ReadFile(p)
+			files[filepath.ToSlash(rel)] = string(b)
+		}
+		return nil
+	})
+	return files
+}
+
+func TestBackups_BackupRestore(t *testing.T) {
+	dir, b, store := newBackupTest(t)
+	ctx := context.Background()
+
+	full, err := b.Backup(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(full.Files) != 4 {
+		t.Fatalf("expected 4 files but got %d", len(full.Files))
+	}
+	// identical contents are stored once
+	objects, _ := store.List(ctx, "backups/objects/")
+	if len(objects) != 3 {
+		t.Errorf("expected 3 objects but got %d", len(objects))
+	}
+
+	// an incremental backup only reads changed files
+	_ = os.WriteFile(filepath.Join(dir, "a.txt"), []byte("alpha 2"), 0644)
+	later := time.Now().Add(time.Minute)
+	_ = os.Chtimes(filepath.Join(dir, "a.txt"), later, later)
+	_ = os.WriteFile(filepath.Join(dir, "new.txt"), []byte("delta"), 0644)
+	// a file whose size and time are unchanged keeps its old checksum
+	b0, _ := os.Stat(filepath.Join(dir, "nested/b.txt"))
+	_ = os.WriteFile(filepath.Join(dir, "nested/b.txt"), []byte("BRAVO"), 0644)
+	_ = os.Chtimes(filepath.Join(dir, "nested/b.txt"), b0.ModTime(), b0.ModTime())
+
+	inc, err := b.Backup(ctx, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inc.Files) != 5 {
+		t.Fatalf("expected 5 files but got %d", len(inc.Files))
+	}
+
+	ids, err := b.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 2 || ids[0] != full.ID || ids[1] != inc.ID {
+		t.Errorf("expected both backups, oldest first, but got %v", ids)
+	}
+
+	for _, id := range ids {
+		if err = b.Verify(ctx, id); err != nil {
+			t.Errorf("%s: %v", id, err)
+		}
+	}
+
+	restored, err := os.MkdirTemp("", "restore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(restored)
+
+	if err = b.Restore(ctx, full.ID, restored); err != nil {
+		t.Fatal(err)
+	}
+	exp := map[string]string{"a.txt": "alpha", "nested/b.txt": "bravo", "nested/c.png": "charlie", "nested/dupe.md": "alpha"}
+	got := readTree(t, restored)
+	for name, contents := range exp {
+		if got[name] != contents {
+			t.Errorf("%s: expected %q but got %q", name, contents, got[name])
+		}
+	}
+	if len(got) != len(exp) {
+		t.Errorf("expected %d files but got %v", len(exp), got)
+	}
+
+	if err = b.Restore(ctx, inc.ID, restored); err != nil {
+		t.Fatal(err)
+	}
+	if got = readTree(t, restored); got["a.txt"] != "alpha 2" || got["new.txt"] != "delta" || got["nested/b.txt"] != "bravo" {
+		t.Errorf("unexpected restore of the incremental backup %v", got)
+	}
+	fi, _ := os.Stat(filepath.Join(restored, "a.txt"))
+	if !fi.ModTime().Equal(later.Truncate(time.Second)) && !fi.ModTime().Equal(later) {
+		t.Errorf("expected the modification time to be restored, got %v", fi.ModTime())
+	}
+}
+
+func TestBackups_Corrupt(t *testing.T) {
+	_, b, store := newBackupTest(t)
+	ctx := context.Background()
+
+	m, err := b.Backup(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sum string
+	for _, f := range m.Files {
+		if f.Path == "nested/c.png" {
+			sum = f.SHA256
+		}
+	}
+	_ = store.Put(ctx, b.objectKey(sum), strings.NewReader("tampered"))
+
+	if err = b.Verify(ctx, m.ID); !errors.Is(err, ErrBackupCorrupt) {
+		t.Errorf("expected ErrBackupCorrupt but got %v", err)
+	}
+
+	restored, err := os.MkdirTemp("", "restore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(restored)
+	if err = b.Restore(ctx, m.ID, restored); !errors.Is(err, ErrBackupCorrupt) {
+		t.Errorf("expected ErrBackupCorrupt but got %v", err)
+	}
+	if _, err = os.Stat(filepath.Join(restored, "nested/c.png")); !os.IsNotExist(err) {
+		t.Error("expected the corrupt file not to be restored")
+	}
+
+	if _, err = b.Manifest(ctx, "../x"); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound but got %v", err)
+	}
+}
+
+func TestBackupArchive(t *testing.T) {
+	dir, _, _ := newBackupTest(t)
+	ctx := context.Background()
+
+	var archive bytes.Buffer
+	m, err := WriteBackupArchive(ctx, dir, &archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Files) != 4 {
+		t.Fatalf("expected 4 files but got %d", len(m.Files))
+	}
+
+	restored, err := os.MkdirTemp("", "restore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(restored)
+
+	if _, err = RestoreBackupArchive(ctx, bytes.NewReader(archive.Bytes()), restored); err != nil {
+		t.Fatal(err)
+	}
+	got := readTree(t, restored)
+	if len(got) != 4 || got["nested/b.txt"] != "bravo" {
+		t.Errorf("unexpected restore %v", got)
+	}
+
+	// a truncated archive restores nothing
+	empty, err := os.MkdirTemp("", "restore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(empty)
+	if _, err = RestoreBackupArchive(ctx, bytes.NewReader(archive.Bytes()[:archive.Len()/2]), empty); err == nil {
+		t.Error("expected an error for a truncated archive")
+	}
+	if got = readTree(t, empty); len(got) != 0 {
+		t.Errorf("expected nothing restored but got %v", got)
+	}
+}
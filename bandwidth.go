@@ -0,0 +1,92 @@
+package toolkit
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/kaliadmen/toolkit/ioutil"
+)
+
+// BandwidthLimiter caps the rate each client can upload at, with an ioutil.RateLimit per key
+// shared by all of the client's uploads, so one client can't take all of an instance's
+// ingest bandwidth. Reads over the limit wait rather than fail, so uploads slow down instead
+// of breaking. Set it as Tools.Bandwidth to limit UploadFile's multipart copy. The zero value
+// allows 1MB a second per client.
+type BandwidthLimiter struct {
+	// BytesPerSecond is each client's upload rate. Defaults to 1MB
+	BytesPerSecond int64
+	// Burst is the most bytes a client can send at once after being idle. Defaults to
+	// BytesPerSecond
+	Burst int64
+	// Key identifies the client of a request. Defaults to its IP address
+	Key            func(r *http.Request) string
+	TrustedProxies []*net.IPNet
+
+	mu     sync.Mutex
+	limits map[string]*ioutil.RateLimit
+	sweep  time.Time
+}
+
+// KeyOf returns the key a request's upload is limited by
+func (bl *BandwidthLimiter) KeyOf(r *http.Request) string {
+	if bl.Key != nil {
+		return bl.Key(r)
+	}
+	if ip := requestClientIP(r, bl.TrustedProxies); ip != nil {
+		return ip.String()
+	}
+	return r.RemoteAddr
+}
+
+// LimitBody limits the rate r's body is read at, within the limit of its client. UploadFile
+// does so for Tools with a Bandwidth limiter; call it before reading other uploads, such as
+// before parsing a multipart form for Ingest.
+func (bl *BandwidthLimiter) LimitBody(r *http.Request) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return
+	}
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{bl.Reader(r.Context(), bl.KeyOf(r), r.Body), r.Body}
+}
+
+// Reader returns a reader which reads from r within key's limit, for uploads which don't
+// arrive over HTTP. Waiting stops with ctx's error once ctx is done.
+func (bl *BandwidthLimiter) Reader(ctx context.Context, key string, r io.Reader) io.Reader {
+	return bl.limit(key).Reader(ctx, r)
+}
+
+// limit returns the limit shared by key's uploads
+func (bl *BandwidthLimiter) limit(key string) *ioutil.RateLimit {
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+
+	// forget unused limits once a minute, as RateLimiter does
+	if now := time.Now(); now.Sub(bl.sweep) >= time.Minute {
+		bl.sweep = now
+		for k, l := range bl.limits {
+			if l.Full() {
+				delete(bl.limits, k)
+			}
+		}
+	}
+
+	l, ok := bl.limits[key]
+	if !ok {
+		if bl.limits == nil {
+			bl.limits = make(map[string]*ioutil.RateLimit)
+		}
+		rate, burst := bl.BytesPerSecond, bl.Burst
+		if rate <= 0 {
+			rate = 1 << 20
+		}
+		l = ioutil.NewRateLimit(int(rate), int(burst))
+		bl.limits[key] = l
+	}
+	return l
+}
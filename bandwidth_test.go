@@ -0,0 +1,89 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBandwidthLimiter(t *testing.T) {
+	bl := &BandwidthLimiter{BytesPerSecond: 20000, Burst: 2000}
+	var mu sync.Mutex
+	var got int64
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bl.LimitBody(r)
+		n, _ := io.Copy(io.Discard, r.Body)
+		mu.Lock()
+		got += n
+		mu.Unlock()
+	})
+
+	// two uploads from one client share its limit: 6000 bytes at 20000 a second, after a
+	// burst of 2000, take at least 200ms
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := httptest.NewRequest("POST", "/upload", bytes.NewReader(make([]byte, 3000)))
+			h.ServeHTTP(httptest.NewRecorder(), r)
+		}()
+	}
+	wg.Wait()
+	if elapsed := time.Since(start); elapsed < 180*time.Millisecond || got != 6000 {
+		t.Errorf("expected 6000 bytes throttled to about 200ms, got %d in %s", got, elapsed)
+	}
+
+	// another client has its own bucket
+	start = time.Now()
+	r := httptest.NewRequest("POST", "/upload", bytes.NewReader(make([]byte, 2000)))
+	r.RemoteAddr = "192.0.2.7:1234"
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("expected another client's burst to pass at once, took %s", elapsed)
+	}
+}
+
+func TestBandwidthLimiter_Reader(t *testing.T) {
+	bl := &BandwidthLimiter{BytesPerSecond: 100, Burst: 100}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := io.Copy(io.Discard, bl.Reader(ctx, "sftp:alice", strings.NewReader(strings.Repeat("x", 1000))))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected waiting to stop with the context, got %v", err)
+	}
+}
+
+func TestTools_UploadFileBandwidth(t *testing.T) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, _ := mw.CreateFormFile("file", "data.txt")
+	_, _ = part.Write(bytes.Repeat([]byte("x"), 4000))
+	_ = mw.Close()
+
+	req := httptest.NewRequest("POST", "/", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	// over 4000 bytes at 20000 a second, after a burst of 1000, take at least 150ms
+	testTools := Tools{Bandwidth: &BandwidthLimiter{BytesPerSecond: 20000, Burst: 1000}}
+	start := time.Now()
+	uploaded, err := testTools.UploadFile(req, "./testdata/uploads/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = os.Remove("./testdata/uploads/" + uploaded.NewFileName)
+	if elapsed := time.Since(start); elapsed < 140*time.Millisecond || uploaded.FileSize != 4000 {
+		t.Errorf("expected 4000 bytes throttled to at least 150ms, got %d in %s", uploaded.FileSize, elapsed)
+	}
+}
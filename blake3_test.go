@@ -0,0 +1,74 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// blake3Input returns the input of the official BLAKE3 test vectors, the bytes 0 to 250 repeated
+func blake3Input(n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i % 251)
+	}
+	return b
+}
+
+func TestBLAKE3(t *testing.T) {
+	var tests = []struct {
+		input []byte
+		sum   string
+	}{
+		{[]byte(""), "af1349b9f5f9a1a6a0404dea36dcc9499bcb25c9adc112b7cc9a93cae41f3262"},
+		{[]byte("abc"), "6437b3ac38465133ffb63b75273a8db548c558465d79db03fd359c6cd5bd9d85"},
+		{blake3Input(1), "2d3adedff11b61f14c886e35afa036736dcd87a74d27b5c1510225d0f592e213"},
+		{blake3Input(64), "4eed7141ea4a5cd4b788606bd23f46e212af9cacebacdc7d1f4c6dc7f2511b98"},
+		{blake3Input(65), "de1e5fa0be70df6d2be8fffd0e99ceaa8eb6e8c93a63f2d8d1c30ecb6b263dee"},
+		{blake3Input(1024), "42214739f095a406f3fc83deb889744ac00df831c10daa55189b5d121c855af7"},
+		{blake3Input(1025), "d00278ae47eb27b34faecf67b4fe263f82d5412916c1ffd97c8cb7fb814b8444"},
+		{blake3Input(2048), "e776b6028c7cd22a4d0ba182a8bf62205d2ef576467e838ed6f2529b85fba24a"},
+		{blake3Input(3072), "b98cb0ff3623be03326b373de6b9095218513e64f1ee2edd2525c7ad1e5cffd2"},
+		{blake3Input(8193), "bab6c09cb8ce8cf459261398d2e7aef35700bf488116ceb94a36d0f5f1b7bc3b"},
+		{blake3Input(31744), "62b6960e1a44bcc1eb1a611a8d6235b6b4b78f32e7abc4fb4c6cdcce94895c47"},
+		{blake3Input(100000), "d93c23eedaf165a7e0be908ba86f1a7a520d568d2d13cde787c8580c5c72cc54"},
+	}
+
+	for _, e := range tests {
+		h := NewBLAKE3()
+		_, _ = h.Write(e.input)
+		if sum := hex.EncodeToString(h.Sum(nil)); sum != e.sum {
+			t.Errorf("%d bytes: expected %s, got %s", len(e.input), e.sum, sum)
+		}
+	}
+}
+
+func TestBLAKE3_Writes(t *testing.T) {
+	data := blake3Input(5000)
+	whole := NewBLAKE3()
+	_, _ = whole.Write(data)
+	expected := whole.Sum(nil)
+
+	for _, size := range []int{1, 63, 64, 65, 1023, 1024, 1025, 4999} {
+		h := NewBLAKE3()
+		for p := data; len(p) > 0; {
+			n := size
+			if n > len(p) {
+				n = len(p)
+			}
+			_, _ = h.Write(p[:n])
+			p = p[n:]
+			// summing part way through must not change the state
+			h.Sum(nil)
+		}
+		if !bytes.Equal(h.Sum(nil), expected) {
+			t.Errorf("writes of %d bytes: checksum does not match", size)
+		}
+
+		h.Reset()
+		_, _ = h.Write(data)
+		if !bytes.Equal(h.Sum(nil), expected) {
+			t.Errorf("writes of %d bytes: checksum does not match after Reset", size)
+		}
+	}
+}
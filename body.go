@@ -0,0 +1,108 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// BodyTooLargeError is returned when a request body is larger than the limit. ErrorJSON sends
+// it with a 413 status and the limit in the payload's data.
+type BodyTooLargeError struct {
+	Limit int64 `json:"limit"`
+}
+
+func (e *BodyTooLargeError) Error() string {
+	return fmt.Sprintf("body must not be larger than %d bytes", e.Limit)
+}
+
+// asBodyTooLarge converts the error from reading an http.MaxBytesReader into a
+// BodyTooLargeError if the limit was hit, and returns other errors unchanged. This is how
+// an oversized chunked body, whose size isn't known up front, is told apart from bad JSON.
+func asBodyTooLarge(err error, limit int64) error {
+	// MaxBytesReader's error has no type of its own in the Go versions this package supports
+	if err != nil && strings.Contains(err.Error(), "http: request body too large") {
+		return &BodyTooLargeError{Limit: limit}
+	}
+	return err
+}
+
+// ReadTrailers reads whatever is left of the request body and returns the trailers sent
+// after it, such as a checksum of a chunked upload. Call it after ReadJSON, which leaves
+// the body limited to MaxFileSize.
+func (t *Tools) ReadTrailers(w http.ResponseWriter, r *http.Request) (http.Header, error) {
+	if r.Body == nil {
+		return r.Trailer, nil
+	}
+
+	limit := int64(1048576)
+	if t.MaxFileSize > 0 {
+		limit = int64(t.MaxFileSize)
+	}
+
+	// the trailers are only filled in once the body has been read to the end
+	if _, err := io.Copy(io.Discard, http.MaxBytesReader(w, r.Body, limit)); err != nil {
+		return nil, asBodyTooLarge(err, limit)
+	}
+	return r.Trailer, nil
+}
+
+type bufferedBodyContextKey struct{}
+
+// BufferBody returns middleware which reads each request body into memory, up to maxBytes,
+// so that several steps can read it: a signature check can use BufferedBody, and ReadJSON
+// still reads the body as usual. Larger bodies are refused with a 413 JSON error.
+func BufferBody(maxBytes int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := bufferBody(w, r, maxBytes)
+			if err != nil {
+				var t Tools
+				_ = t.ErrorJSON(w, err)
+				return
+			}
+
+			r = r.WithContext(context.WithValue(r.Context(), bufferedBodyContextKey{}, body))
+			RewindBody(r)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func bufferBody(w http.ResponseWriter, r *http.Request, maxBytes int64) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+	defer r.Body.Close()
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBytes))
+	if err != nil {
+		return nil, asBodyTooLarge(err, maxBytes)
+	}
+	return body, nil
+}
+
+// BufferedBody returns the request body buffered by BufferBody, without consuming it
+func BufferedBody(r *http.Request) ([]byte, bool) {
+	body, ok := r.Context().Value(bufferedBodyContextKey{}).([]byte)
+	return body, ok
+}
+
+// RewindBody resets the body of a request buffered by BufferBody to the start, so it can be
+// read again. It reports whether the body was buffered.
+func RewindBody(r *http.Request) bool {
+	body, ok := BufferedBody(r)
+	if !ok {
+		return false
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	return true
+}
@@ -0,0 +1,136 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// chunkedReader hides the length of its contents, so requests are sent chunked
+type chunkedReader struct {
+	io.Reader
+}
+
+func TestTools_ReadJSON_BodyTooLarge(t *testing.T) {
+	testTools := Tools{MaxFileSize: 32}
+
+	var tests = []struct {
+		name     string
+		body     string
+		tooLarge bool
+	}{
+		{"valid", `{"foo":"bar"}`, false},
+		{"malformed", `{"foo":`, false},
+		{"too large", `{"foo":"` + strings.Repeat("x", 100) + `"}`, true},
+		{"second value over limit", `{"foo":"bar"}` + strings.Repeat(" ", 40) + `{}`, true},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("POST", "/", chunkedReader{strings.NewReader(e.body)})
+		req.ContentLength = -1
+		rr := httptest.NewRecorder()
+
+		var data map[string]string
+		err := testTools.ReadJSON(rr, req, &data)
+
+		var tooLarge *BodyTooLargeError
+		if errors.As(err, &tooLarge) != e.tooLarge {
+			t.Errorf("%s: unexpected error %v", e.name, err)
+			continue
+		}
+		if e.name == "valid" && err != nil {
+			t.Errorf("%s: unexpected error %v", e.name, err)
+		}
+		if !e.tooLarge {
+			continue
+		}
+
+		_ = testTools.ErrorJSON(rr, err)
+		if rr.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("%s: expected 413, got %d", e.name, rr.Code)
+		}
+		var resp struct {
+			Data BodyTooLargeError `json:"data"`
+		}
+		_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+		if resp.Data.Limit != 32 {
+			t.Errorf("%s: expected the limit in the payload, got %s", e.name, rr.Body.String())
+		}
+	}
+}
+
+func TestTools_ReadTrailers(t *testing.T) {
+	var testTools Tools
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var data map[string]string
+		if err := testTools.ReadJSON(w, r, &data); err != nil {
+			_ = testTools.ErrorJSON(w, err)
+			return
+		}
+		trailers, err := testTools.ReadTrailers(w, r)
+		if err != nil {
+			_ = testTools.ErrorJSON(w, err)
+			return
+		}
+		_ = testTools.WriteJSON(w, http.StatusOK, map[string]string{"foo": data["foo"], "checksum": trailers.Get("X-Checksum")})
+	}))
+	defer srv.Close()
+
+	req, _ := http.NewRequest("POST", srv.URL, chunkedReader{strings.NewReader(`{"foo":"bar"}`)})
+	req.Trailer = http.Header{"X-Checksum": {"abc123"}}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	body, _ := io.ReadAll(res.Body)
+	if string(body) != `{"checksum":"abc123","foo":"bar"}` {
+		t.Errorf("unexpected response %s", body)
+	}
+}
+
+func TestBufferBody(t *testing.T) {
+	var testTools Tools
+
+	handler := BufferBody(64)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// a signature check reads the raw body first
+		raw, ok := BufferedBody(r)
+		if !ok || string(raw) != `{"foo":"bar"}` {
+			t.Errorf("unexpected buffered body %q", raw)
+		}
+		consumed, _ := io.ReadAll(r.Body)
+
+		// then the handler reads it again
+		if !RewindBody(r) {
+			t.Error("expected the body to be rewound")
+		}
+		var data map[string]string
+		if err := testTools.ReadJSON(w, r, &data); err != nil || data["foo"] != "bar" {
+			t.Errorf("ReadJSON after buffering failed: %v", err)
+		}
+		_ = testTools.WriteJSON(w, http.StatusOK, len(consumed))
+	}))
+
+	var tests = []struct {
+		name     string
+		body     string
+		expected int
+	}{
+		{"small", `{"foo":"bar"}`, http.StatusOK},
+		{"too large", `{"foo":"` + strings.Repeat("x", 100) + `"}`, http.StatusRequestEntityTooLarge},
+	}
+
+	for _, e := range tests {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("POST", "/", strings.NewReader(e.body)))
+		if rr.Code != e.expected {
+			t.Errorf("%s: expected %d, got %d", e.name, e.expected, rr.Code)
+		}
+	}
+}
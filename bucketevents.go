@@ -0,0 +1,337 @@
+package toolkit
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidNotification is wrapped by the errors for bucket notifications which can't be read
+var ErrInvalidNotification = errors.New("invalid bucket notification")
+
+// BucketEvent is an object created in a bucket, as reported by a notification
+type BucketEvent struct {
+	// Provider is s3 or gcs
+	Provider string    `json:"provider"`
+	Bucket   string    `json:"bucket"`
+	Key      string    `json:"key"`
+	Size     int64     `json:"size"`
+	ETag     string    `json:"etag,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// ParseBucketEvents reads the object-created events of a notification, which may be:
+//
+//   - an S3 event notification, as sent to Lambda or SQS, or wrapped in an SNS message
+//   - an S3 event delivered by EventBridge
+//   - a Cloud Storage notification pushed by a Pub/Sub subscription
+//
+// Other events, such as deletions, S3's test event and SNS subscription confirmations, are
+// skipped, so the result may be empty. Notifications in none of the formats are refused with ErrInvalidNotification.
+func ParseBucketEvents(body []byte) ([]BucketEvent, error) {
+	var n struct {
+		// S3, direct or from SNS
+		Records []s3EventRecord `json:"Records"`
+		Type    string          `json:"Type"`
+		Message string          `json:"Message"`
+		Event   string          `json:"Event"`
+		// EventBridge
+		DetailType string         `json:"detail-type"`
+		Source     string         `json:"source"`
+		Time       time.Time      `json:"time"`
+		Detail     *s3EventObject `json:"detail"`
+		// Pub/Sub push
+		PubSub *struct {
+			Attributes map[string]string `json:"attributes"`
+			Data       string            `json:"data"`
+		} `json:"message"`
+	}
+	if err := json.Unmarshal(body, &n); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidNotification, err)
+	}
+
+	switch {
+	case n.Type == "Notification" && n.Message != "":
+		return ParseBucketEvents([]byte(n.Message))
+	case n.Type == "SubscriptionConfirmation" || n.Type == "UnsubscribeConfirmation":
+		return nil, nil
+	case n.Event == "s3:TestEvent":
+		return nil, nil
+	case n.Records != nil:
+		var events []BucketEvent
+		for _, rec := range n.Records {
+			if rec.EventSource != "aws:s3" || !strings.HasPrefix(rec.EventName, "ObjectCreated:") {
+				continue
+			}
+			// keys are form encoded in S3 notifications, with + for spaces
+			key, err := url.QueryUnescape(rec.S3.Object.Key)
+			if err != nil {
+				return nil, fmt.Errorf("%w: bad key %q", ErrInvalidNotification, rec.S3.Object.Key)
+			}
+			events = append(events, rec.S3.event(key, rec.EventTime))
+		}
+		return events, nil
+	case n.Source == "aws.s3" && n.Detail != nil:
+		if n.DetailType != "Object Created" {
+			return nil, nil
+		}
+		return []BucketEvent{n.Detail.event(n.Detail.Object.Key, n.Time)}, nil
+	case n.PubSub != nil:
+		if n.PubSub.Attributes["eventType"] != "OBJECT_FINALIZE" {
+			return nil, nil
+		}
+		data, err := base64.StdEncoding.DecodeString(n.PubSub.Data)
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad message data", ErrInvalidNotification)
+		}
+		var obj struct {
+			Bucket      string    `json:"bucket"`
+			Name        string    `json:"name"`
+			Size        string    `json:"size"`
+			ETag        string    `json:"etag"`
+			TimeCreated time.Time `json:"timeCreated"`
+		}
+		if err = json.Unmarshal(data, &obj); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidNotification, err)
+		}
+		size, _ := strconv.ParseInt(obj.Size, 10, 64)
+		return []BucketEvent{{Provider: "gcs", Bucket: obj.Bucket, Key: obj.Name, Size: size, ETag: obj.ETag, Time: obj.TimeCreated}}, nil
+	}
+	return nil, fmt.Errorf("%w: unknown format", ErrInvalidNotification)
+}
+
+type s3EventRecord struct {
+	EventSource string        `json:"eventSource"`
+	EventName   string        `json:"eventName"`
+	EventTime   time.Time     `json:"eventTime"`
+	S3          s3EventObject `json:"s3"`
+}
+
+type s3EventObject struct {
+	Bucket struct {
+		Name string `json:"name"`
+	} `json:"bucket"`
+	Object struct {
+		Key  string `json:"key"`
+		Size int64  `json:"size"`
+		// eTag in notifications, etag in EventBridge
+		ETag  string `json:"eTag"`
+		ETag2 string `json:"etag"`
+	} `json:"object"`
+}
+
+func (o *s3EventObject) event(key string, at time.Time) BucketEvent {
+	etag := o.Object.ETag
+	if etag == "" {
+		etag = o.Object.ETag2
+	}
+	return BucketEvent{Provider: "s3", Bucket: o.Bucket.Name, Key: key, Size: o.Object.Size, ETag: etag, Time: at}
+}
+
+// BucketNotifications ingests objects uploaded straight to a bucket, such as with presigned
+// URLs, when the bucket notifies it of them. Each object is read with Open and run through
+// Ingest: type checks, scanning, moderation, text extraction and indexing, and storage. The
+// toolkit has no cloud SDK, so Open is given, such as a GetObject call.
+//
+// Notifications aren't signed in a way this checks, so Protect should authenticate them, such
+// as by a secret in the push URL or the Pub/Sub push token.
+type BucketNotifications struct {
+	Ingest *Ingest
+	// Open reads the object of an event
+	Open func(ctx context.Context, e BucketEvent) (io.ReadCloser, error)
+	// Buckets are those whose notifications are accepted. Empty accepts any
+	Buckets []string
+	// Prefix, if set, skips objects whose keys don't start with it
+	Prefix string
+	// Delete, if set, removes each object from the bucket once it's been ingested, for
+	// buckets used only to receive uploads
+	Delete func(ctx context.Context, e BucketEvent) error
+	// Done, if set, is called with the outcome of each object
+	Done func(e BucketEvent, f *UploadedFile, err error)
+	// Runner, if set, ingests in the background, answering notifications with a 202 at once;
+	// otherwise they're answered once ingested, with a 500 if an object failed so the
+	// notification is delivered again
+	Runner Runner
+	// ConfirmSubscription, if set, is called with the topic and SubscribeURL of an SNS
+	// subscription confirmation, and should check the topic is expected before confirming, such
+	// as with ConfirmSNSSubscription. If it is nil, confirmations are refused
+	ConfirmSubscription func(ctx context.Context, topicARN, subscribeURL string) error
+	// Protect wraps the handler, and should authenticate the notifier. If it is nil, every
+	// notification is refused
+	Protect func(http.Handler) http.Handler
+	Tools   *Tools
+}
+
+// Handler accepts notifications as POST requests
+func (bn *BucketNotifications) Handler() http.Handler {
+	if bn.Protect == nil {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var t Tools
+			_ = t.ErrorJSON(w, errors.New("bucket notifications are not protected"), http.StatusForbidden)
+		})
+	}
+	return bn.Protect(http.HandlerFunc(bn.serve))
+}
+
+func (bn *BucketNotifications) serve(w http.ResponseWriter, r *http.Request) {
+	t := bn.Tools
+	if t == nil {
+		t = &Tools{}
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		_ = t.ErrorJSON(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		_ = t.ErrorJSON(w, err)
+		return
+	}
+	if topic, subscribeURL, ok := snsSubscription(body); ok {
+		if bn.ConfirmSubscription == nil {
+			_ = t.ErrorJSON(w, errors.New("sns subscriptions are not confirmed"), http.StatusForbidden)
+			return
+		}
+		if err = bn.ConfirmSubscription(r.Context(), topic, subscribeURL); err != nil {
+			_ = t.ErrorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	events, err := ParseBucketEvents(body)
+	if err != nil {
+		_ = t.ErrorJSON(w, err)
+		return
+	}
+
+	var accepted []BucketEvent
+	for _, e := range events {
+		if !bn.bucketAllowed(e.Bucket) {
+			_ = t.ErrorJSON(w, fmt.Errorf("%w: bucket %q is not accepted", ErrInvalidNotification, e.Bucket), http.StatusForbidden)
+			return
+		}
+		if strings.HasPrefix(e.Key, bn.Prefix) && !strings.HasSuffix(e.Key, "/") {
+			accepted = append(accepted, e)
+		}
+	}
+
+	if bn.Runner != nil {
+		// the request's context ends with the response, so the ingestion gets its own
+		if err = bn.Runner.Go(func() { _ = bn.IngestEvents(context.Background(), accepted) }); err != nil {
+			_ = t.ErrorJSON(w, err, http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	if err = bn.IngestEvents(r.Context(), accepted); err != nil {
+		_ = t.ErrorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// snsSubscription returns the topic and SubscribeURL of an SNS subscription confirmation
+func snsSubscription(body []byte) (topicARN, subscribeURL string, ok bool) {
+	var n struct {
+		Type         string `json:"Type"`
+		TopicArn     string `json:"TopicArn"`
+		SubscribeURL string `json:"SubscribeURL"`
+	}
+	if json.Unmarshal(body, &n) != nil || n.Type != "SubscriptionConfirmation" {
+		return "", "", false
+	}
+	return n.TopicArn, n.SubscribeURL, true
+}
+
+func (bn *BucketNotifications) bucketAllowed(bucket string) bool {
+	if len(bn.Buckets) == 0 {
+		return true
+	}
+	for _, b := range bn.Buckets {
+		if b == bucket {
+			return true
+		}
+	}
+	return false
+}
+
+// IngestEvents ingests the objects of events, for notifications which arrive another way,
+// such as from an SQS queue. Every object is tried, and the failures returned as a MultiError.
+func (bn *BucketNotifications) IngestEvents(ctx context.Context, events []BucketEvent) error {
+	var errs MultiError
+	for _, e := range events {
+		f, err := bn.ingest(ctx, e)
+		if bn.Done != nil {
+			bn.Done(e, f, err)
+		}
+		if err != nil {
+			errs.Append(fmt.Errorf("%s://%s/%s: %w", e.Provider, e.Bucket, e.Key, err))
+		}
+	}
+	return errs.Err()
+}
+
+func (bn *BucketNotifications) ingest(ctx context.Context, e BucketEvent) (*UploadedFile, error) {
+	rc, err := bn.Open(ctx, e)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	f, err := bn.Ingest.File(ctx, e.Key, rc)
+	if err != nil {
+		return nil, err
+	}
+	if bn.Delete != nil {
+		if err = bn.Delete(ctx, e); err != nil {
+			return f, err
+		}
+	}
+	return f, nil
+}
+
+// ConfirmSNSSubscription confirms an SNS subscription by visiting its SubscribeURL, which must
+// be an https URL of SNS. client defaults to http.DefaultClient.
+func ConfirmSNSSubscription(ctx context.Context, client *http.Client, subscribeURL string) error {
+	u, err := url.Parse(subscribeURL)
+	if err != nil || u.Scheme != "https" || !isSNSHost(u.Hostname()) {
+		return fmt.Errorf("%w: %q is not an sns url", ErrInvalidNotification, subscribeURL)
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 1<<20))
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("confirming sns subscription: %s", res.Status)
+	}
+	return nil
+}
+
+// isSNSHost reports whether host is an SNS endpoint, such as sns.us-east-1.amazonaws.com
+func isSNSHost(host string) bool {
+	for _, suffix := range []string{".amazonaws.com", ".amazonaws.com.cn"} {
+		if region := strings.TrimSuffix(host, suffix); region != host && strings.HasPrefix(region, "sns.") {
+			return !strings.Contains(region[len("sns."):], ".") && len(region) > len("sns.")
+		}
+	}
+	return false
+}
@@ -0,0 +1,191 @@
+package toolkit
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const testS3Event = `{"Records": [
+	{"eventSource": "aws:s3", "eventName": "ObjectCreated:Put", "eventTime": "2024-05-01T09:00:00Z",
+	 "s3": {"bucket": {"name": "uploads"}, "object": {"key": "incoming/my+report.txt", "size": 11, "eTag": "abc"}}},
+	{"eventSource": "aws:s3", "eventName": "ObjectRemoved:Delete", "eventTime": "2024-05-01T09:00:00Z",
+	 "s3": {"bucket": {"name": "uploads"}, "object": {"key": "incoming/old.txt"}}}
+]}`
+
+func TestParseBucketEvents(t *testing.T) {
+	sns, _ := json.Marshal(map[string]string{"Type": "Notification", "Message": testS3Event})
+	gcsData := base64.StdEncoding.EncodeToString([]byte(`{"bucket": "media", "name": "a/b.png", "size": "2048", "timeCreated": "2024-05-01T09:00:00Z"}`))
+
+	var tests = []struct {
+		name    string
+		body    string
+		want    []string
+		invalid bool
+	}{
+		{name: "s3", body: testS3Event, want: []string{"s3 uploads incoming/my report.txt 11"}},
+		{name: "sns", body: string(sns), want: []string{"s3 uploads incoming/my report.txt 11"}},
+		{name: "test event", body: `{"Service": "Amazon S3", "Event": "s3:TestEvent"}`},
+		{name: "sns subscription", body: `{"Type": "SubscriptionConfirmation", "SubscribeURL": "https://sns.us-east-1.amazonaws.com/"}`},
+		{
+			name: "eventbridge",
+			body: `{"detail-type": "Object Created", "source": "aws.s3", "time": "2024-05-01T09:00:00Z",
+				"detail": {"bucket": {"name": "uploads"}, "object": {"key": "x y.txt", "size": 3, "etag": "e"}}}`,
+			want: []string{"s3 uploads x y.txt 3"},
+		},
+		{
+			name: "pubsub",
+			body: `{"message": {"attributes": {"eventType": "OBJECT_FINALIZE"}, "data": "` + gcsData + `"}, "subscription": "s"}`,
+			want: []string{"gcs media a/b.png 2048"},
+		},
+		{name: "pubsub delete", body: `{"message": {"attributes": {"eventType": "OBJECT_DELETE"}, "data": ""}}`},
+		{name: "unknown", body: `{"hello": "world"}`, invalid: true},
+		{name: "not json", body: `<xml/>`, invalid: true},
+	}
+	for _, e := range tests {
+		events, err := ParseBucketEvents([]byte(e.body))
+		if e.invalid {
+			if !errors.Is(err, ErrInvalidNotification) {
+				t.Errorf("%s: expected an invalid notification, got %v", e.name, err)
+			}
+			continue
+		}
+		if err != nil || len(events) != len(e.want) {
+			t.Errorf("%s: unexpected %v %v", e.name, events, err)
+			continue
+		}
+		for i, ev := range events {
+			got := strings.Join([]string{ev.Provider, ev.Bucket, ev.Key, strconv.FormatInt(ev.Size, 10)}, " ")
+			if got != e.want[i] || ev.Time.IsZero() {
+				t.Errorf("%s: expected %q, got %q at %v", e.name, e.want[i], got, ev.Time)
+			}
+		}
+	}
+}
+
+func TestBucketNotifications(t *testing.T) {
+	store := &FileStorage{Dir: t.TempDir()}
+	in := &Ingest{Storage: store, Prefix: "in/"}
+	objects := map[string]string{"incoming/my report.txt": "hello world"}
+	var deleted []string
+	var done []*UploadedFile
+	bn := &BucketNotifications{
+		Ingest:  in,
+		Buckets: []string{"uploads"},
+		Prefix:  "incoming/",
+		Open: func(ctx context.Context, e BucketEvent) (io.ReadCloser, error) {
+			body, ok := objects[e.Key]
+			if !ok {
+				return nil, ErrNotFound
+			}
+			return io.NopCloser(strings.NewReader(body)), nil
+		},
+		Delete: func(ctx context.Context, e BucketEvent) error {
+			deleted = append(deleted, e.Key)
+			return nil
+		},
+		Done:    func(e BucketEvent, f *UploadedFile, err error) { done = append(done, f) },
+		Protect: func(next http.Handler) http.Handler { return next },
+	}
+
+	post := func(body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		bn.Handler().ServeHTTP(rr, httptest.NewRequest("POST", "/hooks/s3", strings.NewReader(body)))
+		return rr
+	}
+
+	if rr := post(testS3Event); rr.Code != http.StatusNoContent {
+		t.Fatalf("unexpected %d %s", rr.Code, rr.Body)
+	}
+	if len(done) != 1 || done[0] == nil || done[0].OriginalFileName != "my report.txt" || len(deleted) != 1 {
+		t.Fatalf("expected the object ingested and deleted, got %v %v", done, deleted)
+	}
+	if _, err := store.Stat(context.Background(), "in/"+done[0].NewFileName); err != nil {
+		t.Errorf("object was not stored: %v", err)
+	}
+
+	// an object which can't be read fails the notification, so it's delivered again
+	delete(objects, "incoming/my report.txt")
+	if rr := post(testS3Event); rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected a 500 for a failed object, got %d", rr.Code)
+	}
+
+	other := strings.Replace(testS3Event, `"name": "uploads"`, `"name": "elsewhere"`, 1)
+	if rr := post(other); rr.Code != http.StatusForbidden {
+		t.Errorf("expected another bucket refused, got %d", rr.Code)
+	}
+	if rr := post("nonsense"); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected a bad notification refused, got %d", rr.Code)
+	}
+
+	// sns subscriptions are refused unless confirmed
+	confirmation := `{"Type": "SubscriptionConfirmation", "TopicArn": "arn:aws:sns:us-east-1:123:uploads",
+		"SubscribeURL": "https://sns.us-east-1.amazonaws.com/?Action=ConfirmSubscription&Token=t"}`
+	if rr := post(confirmation); rr.Code != http.StatusForbidden {
+		t.Errorf("expected an unconfirmed subscription refused, got %d", rr.Code)
+	}
+	var confirmed []string
+	bn.ConfirmSubscription = func(ctx context.Context, topicARN, subscribeURL string) error {
+		confirmed = append(confirmed, topicARN, subscribeURL)
+		return nil
+	}
+	if rr := post(confirmation); rr.Code != http.StatusNoContent {
+		t.Errorf("expected the subscription confirmed, got %d %s", rr.Code, rr.Body)
+	}
+	if len(confirmed) != 2 || confirmed[0] != "arn:aws:sns:us-east-1:123:uploads" || !strings.Contains(confirmed[1], "Token=t") {
+		t.Errorf("unexpected confirmation %v", confirmed)
+	}
+
+	bn.Protect = nil
+	if rr := post(testS3Event); rr.Code != http.StatusForbidden {
+		t.Errorf("expected an unprotected handler to refuse, got %d", rr.Code)
+	}
+}
+
+func TestConfirmSNSSubscription(t *testing.T) {
+	var visited string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		visited = r.Host + r.URL.RequestURI()
+	}))
+	defer srv.Close()
+
+	// send every request to the test server, whose certificate is for example.com
+	client := srv.Client()
+	transport := client.Transport.(*http.Transport)
+	transport.TLSClientConfig.ServerName = "example.com"
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, srv.Listener.Addr().String())
+	}
+
+	var tests = []struct {
+		url string
+		ok  bool
+	}{
+		{"https://sns.us-east-1.amazonaws.com/?Action=ConfirmSubscription&Token=t", true},
+		{"https://sns.cn-north-1.amazonaws.com.cn/?Token=t", true},
+		{"http://sns.us-east-1.amazonaws.com/?Token=t", false},
+		{"https://sns.evil.example/?Token=t", false},
+		{"https://sns.us-east-1.evil.example.amazonaws.com/", false},
+		{"https://s3.us-east-1.amazonaws.com/", false},
+		{"https://169.254.169.254/latest/meta-data", false},
+	}
+
+	for _, e := range tests {
+		visited = ""
+		err := ConfirmSNSSubscription(context.Background(), client, e.url)
+		if e.ok && (err != nil || !strings.HasPrefix(e.url, "https://"+visited)) {
+			t.Errorf("%s: expected to be visited, got %q %v", e.url, visited, err)
+		}
+		if !e.ok && (!errors.Is(err, ErrInvalidNotification) || visited != "") {
+			t.Errorf("%s: expected to be refused, got %v", e.url, err)
+		}
+	}
+}
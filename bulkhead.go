@@ -0,0 +1,98 @@
+package toolkit
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrBulkheadFull is returned by Bulkhead when a host has no free slot within MaxWait
+var ErrBulkheadFull = errors.New("too many concurrent requests to host")
+
+// Bulkhead is a RoundTripper which limits the concurrent requests to each downstream host, so
+// a slow partner API holds only its own share of goroutines and connections, leaving the rest
+// for other integrations. A request holds its slot until its response body is closed.
+type Bulkhead struct {
+	// Base defaults to http.DefaultTransport
+	Base http.RoundTripper
+	// MaxPerHost is the number of concurrent requests to a host. Defaults to 10
+	MaxPerHost int
+	// Limits overrides MaxPerHost for the hosts it names, as host or host:port
+	Limits map[string]int
+	// MaxWait is how long a request waits for a slot before failing with ErrBulkheadFull.
+	// Zero fails at once; a negative value waits until the request's context is done
+	MaxWait time.Duration
+
+	mu    sync.Mutex
+	hosts map[string]chan struct{}
+}
+
+func (b *Bulkhead) slots(host string) chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if s, ok := b.hosts[host]; ok {
+		return s
+	}
+	limit := b.MaxPerHost
+	if n, ok := b.Limits[host]; ok {
+		limit = n
+	}
+	if limit <= 0 {
+		limit = 10
+	}
+	if b.hosts == nil {
+		b.hosts = make(map[string]chan struct{})
+	}
+	s := make(chan struct{}, limit)
+	b.hosts[host] = s
+	return s
+}
+
+// InFlight returns the number of requests holding a slot for host
+func (b *Bulkhead) InFlight(host string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.hosts[host])
+}
+
+// RoundTrip sends a request once its host has a free slot
+func (b *Bulkhead) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := b.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	slots := b.slots(req.URL.Host)
+
+	select {
+	case slots <- struct{}{}:
+	default:
+		if b.MaxWait == 0 {
+			return nil, ErrBulkheadFull
+		}
+		var timeout <-chan time.Time
+		if b.MaxWait > 0 {
+			timer := time.NewTimer(b.MaxWait)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		select {
+		case slots <- struct{}{}:
+		case <-timeout:
+			return nil, ErrBulkheadFull
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+
+	var once sync.Once
+	release := func() { once.Do(func() { <-slots }) }
+	res, err := base.RoundTrip(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	res.Body = &cancelOnClose{ReadCloser: res.Body, cancel: release}
+	return res, nil
+}
@@ -0,0 +1,109 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBulkhead_RoundTrip(t *testing.T) {
+	release := make(chan struct{})
+	base := HttpLoopfunc(func(req *http.Request) *http.Response {
+		if req.URL.Host == "slow.example.com" {
+			<-release
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("OK")), Header: make(http.Header)}
+	})
+	b := &Bulkhead{Base: base, MaxPerHost: 2}
+	client := &http.Client{Transport: b}
+
+	// fill the slow host's slots
+	done := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			res, err := client.Get("http://slow.example.com/")
+			if err == nil {
+				res.Body.Close()
+			}
+			done <- err
+		}()
+	}
+	deadline := time.Now().Add(time.Second)
+	for b.InFlight("slow.example.com") < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := client.Get("http://slow.example.com/"); !errors.Is(err, ErrBulkheadFull) {
+		t.Errorf("expected a full bulkhead, got %v", err)
+	}
+	res, err := client.Get("http://fast.example.com/")
+	if err != nil {
+		t.Fatalf("expected other hosts to be unaffected, got %v", err)
+	}
+	if n := b.InFlight("fast.example.com"); n != 1 {
+		t.Errorf("expected the slot to be held until the body is closed, got %d", n)
+	}
+	res.Body.Close()
+	if n := b.InFlight("fast.example.com"); n != 0 {
+		t.Errorf("expected the slot to be released, got %d", n)
+	}
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	}
+	if n := b.InFlight("slow.example.com"); n != 0 {
+		t.Errorf("expected all slots released, got %d", n)
+	}
+}
+
+func TestBulkhead_MaxWait(t *testing.T) {
+	base := HttpLoopfunc(func(req *http.Request) *http.Response {
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("OK")), Header: make(http.Header)}
+	})
+
+	var tests = []struct {
+		name    string
+		maxWait time.Duration
+		ctx     time.Duration
+		freeIn  time.Duration
+		want    error
+	}{
+		{name: "slot freed in time", maxWait: time.Second, freeIn: 10 * time.Millisecond},
+		{name: "wait exceeded", maxWait: 10 * time.Millisecond, freeIn: time.Second, want: ErrBulkheadFull},
+		{name: "context done", maxWait: -1, ctx: 10 * time.Millisecond, freeIn: time.Second, want: context.DeadlineExceeded},
+	}
+
+	for _, e := range tests {
+		b := &Bulkhead{Base: base, MaxPerHost: 1, Limits: map[string]int{"other.example.com": 5}, MaxWait: e.maxWait}
+		held, _ := http.NewRequest(http.MethodGet, "http://api.example.com/", nil)
+		res, err := b.RoundTrip(held)
+		if err != nil {
+			t.Fatal(err)
+		}
+		timer := time.AfterFunc(e.freeIn, func() { res.Body.Close() })
+
+		ctx := context.Background()
+		if e.ctx > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, e.ctx)
+			defer cancel()
+		}
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://api.example.com/", nil)
+		second, err := b.RoundTrip(req)
+		if !errors.Is(err, e.want) {
+			t.Errorf("%s: expected %v, got %v", e.name, e.want, err)
+		}
+		if err == nil {
+			second.Body.Close()
+		}
+		timer.Stop()
+		res.Body.Close()
+	}
+}
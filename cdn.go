@@ -0,0 +1,281 @@
+package toolkit
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CDNPolicy says what a signed CDN URL or cookie grants access to
+type CDNPolicy struct {
+	// Resource is the URL access is granted to, which may end in * to cover a path prefix,
+	// e.g. "https://cdn.example.com/private/*"
+	Resource string
+	Expires  time.Time
+	// NotBefore, if set, is when access starts
+	NotBefore time.Time
+	// SourceIP, if set, restricts access to an address or CIDR range
+	SourceIP string
+}
+
+// cloudFrontPolicy is the JSON policy document CloudFront expects; field order matters for
+// canned policies, which are signed but not sent
+type cloudFrontPolicy struct {
+	Statement []cloudFrontStatement `json:"Statement"`
+}
+
+type cloudFrontStatement struct {
+	Resource  string              `json:"Resource"`
+	Condition cloudFrontCondition `json:"Condition"`
+}
+
+type cloudFrontCondition struct {
+	DateLessThan    map[string]int64  `json:"DateLessThan"`
+	DateGreaterThan map[string]int64  `json:"DateGreaterThan,omitempty"`
+	IPAddress       map[string]string `json:"IpAddress,omitempty"`
+}
+
+// CloudFrontSigner signs URLs and cookies for private content served through Amazon
+// CloudFront, with a key in one of the distribution's trusted key groups
+type CloudFrontSigner struct {
+	// KeyPairID is the ID of the public key registered with CloudFront
+	KeyPairID  string
+	PrivateKey *rsa.PrivateKey
+}
+
+// ParseRSAPrivateKey parses a PEM encoded RSA private key, in PKCS #1 or PKCS #8 form, such as
+// the keys generated for CloudFront
+func ParseRSAPrivateKey(pemBytes []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("no pem block found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("key is not an rsa key")
+	}
+	return rsaKey, nil
+}
+
+// SignURL signs rawURL with a canned policy, which only limits how long it is valid
+func (s *CloudFrontSigner) SignURL(rawURL string, expires time.Time) (string, error) {
+	policy, err := s.policy(CDNPolicy{Resource: rawURL, Expires: expires})
+	if err != nil {
+		return "", err
+	}
+	sig, err := s.sign(policy)
+	if err != nil {
+		return "", err
+	}
+	return appendQuery(rawURL, "Expires="+strconv.FormatInt(expires.Unix(), 10)+"&Signature="+sig+"&Key-Pair-Id="+url.QueryEscape(s.KeyPairID)), nil
+}
+
+// SignURLWithPolicy signs rawURL with a custom policy, whose resource defaults to rawURL
+func (s *CloudFrontSigner) SignURLWithPolicy(rawURL string, p CDNPolicy) (string, error) {
+	if p.Resource == "" {
+		p.Resource = rawURL
+	}
+	policy, err := s.policy(p)
+	if err != nil {
+		return "", err
+	}
+	sig, err := s.sign(policy)
+	if err != nil {
+		return "", err
+	}
+	return appendQuery(rawURL, "Policy="+cloudFrontBase64(policy)+"&Signature="+sig+"&Key-Pair-Id="+url.QueryEscape(s.KeyPairID)), nil
+}
+
+// SignedCookies returns the CloudFront-Policy, CloudFront-Signature and CloudFront-Key-Pair-Id
+// cookies granting access under p, for the CDN's domain and path. Cookies suit streaming
+// media and pages with many private assets, where signing every URL is impractical.
+func (s *CloudFrontSigner) SignedCookies(p CDNPolicy, domain, path string) ([]*http.Cookie, error) {
+	policy, err := s.policy(p)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := s.sign(policy)
+	if err != nil {
+		return nil, err
+	}
+
+	values := [][2]string{
+		{"CloudFront-Policy", cloudFrontBase64(policy)},
+		{"CloudFront-Signature", sig},
+		{"CloudFront-Key-Pair-Id", s.KeyPairID},
+	}
+	cookies := make([]*http.Cookie, 0, len(values))
+	for _, v := range values {
+		cookies = append(cookies, &http.Cookie{
+			Name:     v[0],
+			Value:    v[1],
+			Domain:   domain,
+			Path:     path,
+			Expires:  p.Expires,
+			Secure:   true,
+			HttpOnly: true,
+		})
+	}
+	return cookies, nil
+}
+
+func (s *CloudFrontSigner) policy(p CDNPolicy) ([]byte, error) {
+	if s.PrivateKey == nil || s.KeyPairID == "" {
+		return nil, errors.New("cloudfront signer needs a key pair id and private key")
+	}
+	if p.Resource == "" || p.Expires.IsZero() {
+		return nil, errors.New("cdn policy needs a resource and an expiry")
+	}
+
+	cond := cloudFrontCondition{DateLessThan: map[string]int64{"AWS:EpochTime": p.Expires.Unix()}}
+	if !p.NotBefore.IsZero() {
+		cond.DateGreaterThan = map[string]int64{"AWS:EpochTime": p.NotBefore.Unix()}
+	}
+	if p.SourceIP != "" {
+		cond.IPAddress = map[string]string{"AWS:SourceIp": p.SourceIP}
+	}
+
+	// CloudFront signs the policy as written, so URLs mustn't have & escaped
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(cloudFrontPolicy{Statement: []cloudFrontStatement{{Resource: p.Resource, Condition: cond}}}); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+func (s *CloudFrontSigner) sign(policy []byte) (string, error) {
+	h := sha1.Sum(policy)
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.PrivateKey, crypto.SHA1, h[:])
+	if err != nil {
+		return "", err
+	}
+	return cloudFrontBase64(sig), nil
+}
+
+// cloudFrontBase64 is base64 with the characters CloudFront can't take in URLs replaced
+func cloudFrontBase64(b []byte) string {
+	return strings.NewReplacer("+", "-", "=", "_", "/", "~").Replace(base64.StdEncoding.EncodeToString(b))
+}
+
+func appendQuery(rawURL, query string) string {
+	if strings.Contains(rawURL, "?") {
+		return rawURL + "&" + query
+	}
+	return rawURL + "?" + query
+}
+
+// FastlyTokenSigner signs URLs for Fastly's token authentication. The token is the expiry, in
+// Unix seconds, and the hex HMAC-SHA256 of the path followed by the expiry, joined by an
+// underscore, e.g. ?token=1700000000_4f2a..., which VCL at the edge checks with
+// digest.hmac_sha256 before pulling from the origin.
+type FastlyTokenSigner struct {
+	Key []byte
+	// Param is the query parameter holding the token. Defaults to "token"
+	Param string
+}
+
+func (s *FastlyTokenSigner) param() string {
+	if s.Param != "" {
+		return s.Param
+	}
+	return "token"
+}
+
+func (s *FastlyTokenSigner) token(path string, expires int64) string {
+	mac := hmac.New(sha256.New, s.Key)
+	mac.Write([]byte(path + strconv.FormatInt(expires, 10)))
+	return strconv.FormatInt(expires, 10) + "_" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignURL adds a token to rawURL, valid until expires
+func (s *FastlyTokenSigner) SignURL(rawURL string, expires time.Time) (string, error) {
+	if len(s.Key) == 0 {
+		return "", errors.New("fastly signer has no key")
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	return appendQuery(rawURL, s.param()+"="+s.token(u.Path, expires.Unix())), nil
+}
+
+// Verify checks a URL's token, as the edge does
+func (s *FastlyTokenSigner) Verify(u *url.URL) error {
+	tok := u.Query().Get(s.param())
+	exp, _, ok := strings.Cut(tok, "_")
+	if !ok || len(s.Key) == 0 {
+		return ErrInvalidSignature
+	}
+	expires, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(tok), []byte(s.token(u.Path, expires))) {
+		return ErrInvalidSignature
+	}
+	if time.Now().Unix() > expires {
+		return ErrExpiredSignature
+	}
+	return nil
+}
+
+// OriginAuth restricts handlers, such as downloads fronted by a CDN, to requests from the CDN,
+// which is configured to send a secret header on origin pulls. Several secrets may be
+// accepted at once, so the secret can be rotated without downtime.
+type OriginAuth struct {
+	// Header is the header the CDN sends. Defaults to "X-Origin-Auth"
+	Header  string
+	Secrets []string
+}
+
+// Middleware rejects requests without a valid origin secret with 403 Forbidden, and removes
+// the header from those it passes on
+func (oa *OriginAuth) Middleware(next http.Handler) http.Handler {
+	header := oa.Header
+	if header == "" {
+		header = "X-Origin-Auth"
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := r.Header.Get(header)
+		valid := false
+		for _, secret := range oa.Secrets {
+			if secret != "" && subtle.ConstantTimeCompare([]byte(got), []byte(secret)) == 1 {
+				valid = true
+			}
+		}
+		if !valid {
+			var t Tools
+			_ = t.ErrorJSON(w, errors.New("request did not come through the cdn"), http.StatusForbidden)
+			return
+		}
+
+		r.Header.Del(header)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,217 @@
+package toolkit
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func decodeCloudFrontBase64(s string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(strings.NewReplacer("-", "+", "_", "=", "~", "/").Replace(s))
+}
+
+func newCloudFrontTest(t *testing.T) *CloudFrontSigner {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &CloudFrontSigner{KeyPairID: "K2JCJMDEHXQW5F", PrivateKey: key}
+}
+
+func TestCloudFrontSigner_SignURL(t *testing.T) {
+	s := newCloudFrontTest(t)
+	expires := time.Unix(1700000000, 0)
+
+	signed, err := s.SignURL("https://cdn.example.com/private/a.pdf?v=1&x=2", expires)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("Expires") != "1700000000" || q.Get("Key-Pair-Id") != s.KeyPairID || q.Get("v") != "1" {
+		t.Errorf("unexpected query %v", q)
+	}
+
+	sig, err := decodeCloudFrontBase64(q.Get("Signature"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := `{"Statement":[{"Resource":"https://cdn.example.com/private/a.pdf?v=1&x=2","Condition":{"DateLessThan":{"AWS:EpochTime":1700000000}}}]}`
+	h := sha1.Sum([]byte(policy))
+	if err = rsa.VerifyPKCS1v15(&s.PrivateKey.PublicKey, crypto.SHA1, h[:], sig); err != nil {
+		t.Errorf("expected the signature to verify against the canned policy: %v", err)
+	}
+
+	if _, err = (&CloudFrontSigner{}).SignURL("https://cdn.example.com/a", expires); err == nil {
+		t.Error("expected an error without a key")
+	}
+}
+
+func TestCloudFrontSigner_Policy(t *testing.T) {
+	s := newCloudFrontTest(t)
+	p := CDNPolicy{
+		Resource:  "https://cdn.example.com/private/*",
+		Expires:   time.Unix(1700000000, 0),
+		NotBefore: time.Unix(1600000000, 0),
+		SourceIP:  "192.0.2.0/24",
+	}
+
+	signed, err := s.SignURLWithPolicy("https://cdn.example.com/private/a.pdf", p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(signed)
+	policy, err := decodeCloudFrontBase64(u.Query().Get("Policy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"Resource":"https://cdn.example.com/private/*"`, `"DateGreaterThan":{"AWS:EpochTime":1600000000}`, `"IpAddress":{"AWS:SourceIp":"192.0.2.0/24"}`} {
+		if !strings.Contains(string(policy), want) {
+			t.Errorf("expected policy %s to contain %s", policy, want)
+		}
+	}
+	sig, _ := decodeCloudFrontBase64(u.Query().Get("Signature"))
+	h := sha1.Sum(policy)
+	if err = rsa.VerifyPKCS1v15(&s.PrivateKey.PublicKey, crypto.SHA1, h[:], sig); err != nil {
+		t.Error(err)
+	}
+
+	cookies, err := s.SignedCookies(p, "cdn.example.com", "/private/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make(map[string]string)
+	for _, c := range cookies {
+		if !c.Secure || !c.HttpOnly || c.Domain != "cdn.example.com" || c.Path != "/private/" || !c.Expires.Equal(p.Expires) {
+			t.Errorf("unexpected cookie %+v", c)
+		}
+		names[c.Name] = c.Value
+	}
+	if names["CloudFront-Policy"] != u.Query().Get("Policy") || names["CloudFront-Key-Pair-Id"] != s.KeyPairID || names["CloudFront-Signature"] == "" {
+		t.Errorf("unexpected cookies %v", names)
+	}
+}
+
+func TestParseRSAPrivateKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs8, _ := x509.MarshalPKCS8PrivateKey(key)
+
+	var tests = []struct {
+		name    string
+		pem     []byte
+		wantErr bool
+	}{
+		{"pkcs1", pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), false},
+		{"pkcs8", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}), false},
+		{"not pem", []byte("not a key"), true},
+		{"garbage", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("garbage")}), true},
+	}
+
+	for _, e := range tests {
+		got, err := ParseRSAPrivateKey(e.pem)
+		if e.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected an error", e.name)
+			}
+			continue
+		}
+		if err != nil || !got.Equal(key) {
+			t.Errorf("%s: expected the key back, got %v", e.name, err)
+		}
+	}
+}
+
+func TestFastlyTokenSigner(t *testing.T) {
+	s := &FastlyTokenSigner{Key: []byte("edge secret")}
+
+	signed, err := s.SignURL("https://cdn.example.com/private/a.pdf?v=1", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(signed)
+	if err = s.Verify(u); err != nil {
+		t.Errorf("expected the token to verify: %v", err)
+	}
+
+	other, _ := url.Parse(strings.Replace(signed, "a.pdf", "b.pdf", 1))
+	expired, _ := s.SignURL("https://cdn.example.com/a.pdf", time.Now().Add(-time.Minute))
+	expiredURL, _ := url.Parse(expired)
+	// moving the expiry invalidates the token
+	tok := u.Query().Get("token")
+	_, mac, _ := strings.Cut(tok, "_")
+	later := strconv.FormatInt(time.Now().Add(48*time.Hour).Unix(), 10)
+	extended, _ := url.Parse("https://cdn.example.com/private/a.pdf?token=" + later + "_" + mac)
+	missing, _ := url.Parse("https://cdn.example.com/private/a.pdf")
+
+	var tests = []struct {
+		name string
+		u    *url.URL
+		err  error
+	}{
+		{"other path", other, ErrInvalidSignature},
+		{"expired", expiredURL, ErrExpiredSignature},
+		{"extended", extended, ErrInvalidSignature},
+		{"missing", missing, ErrInvalidSignature},
+	}
+	for _, e := range tests {
+		if err := s.Verify(e.u); !errors.Is(err, e.err) {
+			t.Errorf("%s: expected %v but got %v", e.name, e.err, err)
+		}
+	}
+}
+
+func TestOriginAuth_Middleware(t *testing.T) {
+	oa := &OriginAuth{Secrets: []string{"new secret", "old secret"}}
+
+	var forwarded string
+	h := oa.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.Header.Get("X-Origin-Auth")
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	var tests = []struct {
+		name   string
+		secret string
+		status int
+	}{
+		{"current secret", "new secret", http.StatusOK},
+		{"rotated secret", "old secret", http.StatusOK},
+		{"wrong secret", "guess", http.StatusForbidden},
+		{"missing", "", http.StatusForbidden},
+	}
+
+	for _, e := range tests {
+		forwarded = "unset"
+		req := httptest.NewRequest("GET", "/download/a.pdf", nil)
+		if e.secret != "" {
+			req.Header.Set("X-Origin-Auth", e.secret)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		if rr.Code != e.status {
+			t.Errorf("%s: expected %d but got %d", e.name, e.status, rr.Code)
+		}
+		if e.status == http.StatusOK && forwarded != "" {
+			t.Errorf("%s: expected the secret to be removed before the handler", e.name)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package toolkit
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ChaosFault is a kind of fault injected by Chaos
+type ChaosFault string
+
+// Faults injected by Chaos
+const (
+	// ChaosLatency delays the request before it is handled
+	ChaosLatency ChaosFault = "latency"
+	// ChaosError answers with an error status instead of handling the request
+	ChaosError ChaosFault = "error"
+	// ChaosTruncate handles the request, then sends part of the response body and drops the
+	// connection, or drops it without a response if the body is empty
+	ChaosTruncate ChaosFault = "truncate"
+)
+
+// ChaosFaultHeader is the response header naming the fault injected, where headers can be sent
+const ChaosFaultHeader = "X-Chaos-Fault"
+
+// Chaos is an opt-in middleware injecting latency, errors and truncated responses into a
+// fraction of requests, for testing the retry logic of clients. It does nothing in production
+// unless Force is set.
+type Chaos struct {
+	// Rate is the fraction of requests, from 0 to 1, which get a fault
+	Rate float64
+	// Faults are the kinds of fault injected, one chosen at random for each affected request.
+	// Defaults to all of them
+	Faults []ChaosFault
+	// MaxLatency is the most delay added by ChaosLatency. Defaults to two seconds
+	MaxLatency time.Duration
+	// ErrorStatuses are the statuses ChaosError answers with. Defaults to 500, 502 and 503
+	ErrorStatuses []int
+	// RequestHeader, if set, limits faults to requests with the header, so only clients
+	// under test are affected
+	RequestHeader string
+	// Environment is the app's environment; Chaos does nothing in "production". Defaults to
+	// $APP_ENV
+	Environment string
+	// Force injects faults even in production
+	Force bool
+	// Seed seeds the source faults are drawn from, so a run can be repeated
+	Seed int64
+	// OnFault is called with each fault injected
+	OnFault func(r *http.Request, fault ChaosFault)
+
+	once sync.Once
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+var defaultChaosFaults = []ChaosFault{ChaosLatency, ChaosError, ChaosTruncate}
+
+// Active reports whether faults are injected in the environment
+func (c *Chaos) Active() bool {
+	env := c.Environment
+	if env == "" {
+		env = os.Getenv("APP_ENV")
+	}
+	return c.Rate > 0 && (env != "production" || c.Force)
+}
+
+// fault returns the fault for a request, or "" for none
+func (c *Chaos) fault(r *http.Request) (ChaosFault, time.Duration, int) {
+	if c.RequestHeader != "" && r.Header.Get(c.RequestHeader) == "" {
+		return "", 0, 0
+	}
+	c.once.Do(func() { c.rand = rand.New(rand.NewSource(c.Seed)) })
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.rand.Float64() >= c.Rate {
+		return "", 0, 0
+	}
+	faults := c.Faults
+	if len(faults) == 0 {
+		faults = defaultChaosFaults
+	}
+	fault := faults[c.rand.Intn(len(faults))]
+
+	switch fault {
+	case ChaosLatency:
+		maxLatency := c.MaxLatency
+		if maxLatency <= 0 {
+			maxLatency = 2 * time.Second
+		}
+		return fault, time.Duration(c.rand.Int63n(int64(maxLatency))) + 1, 0
+	case ChaosError:
+		statuses := c.ErrorStatuses
+		if len(statuses) == 0 {
+			statuses = []int{http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable}
+		}
+		return fault, 0, statuses[c.rand.Intn(len(statuses))]
+	}
+	return fault, 0, 0
+}
+
+// Middleware injects faults into the requests to next
+func (c *Chaos) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !c.Active() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		fault, latency, status := c.fault(r)
+		if fault == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if c.OnFault != nil {
+			c.OnFault(r, fault)
+		}
+
+		switch fault {
+		case ChaosLatency:
+			select {
+			case <-time.After(latency):
+			case <-r.Context().Done():
+				return
+			}
+			w.Header().Set(ChaosFaultHeader, string(fault))
+			next.ServeHTTP(w, r)
+
+		case ChaosError:
+			w.Header().Set(ChaosFaultHeader, string(fault))
+			if status == http.StatusServiceUnavailable || status == http.StatusTooManyRequests {
+				w.Header().Set("Retry-After", "1")
+			}
+			var t Tools
+			_ = t.ErrorJSON(w, errors.New("injected fault"), status)
+
+		case ChaosTruncate:
+			rec := &chaosRecorder{header: make(http.Header), status: http.StatusOK}
+			next.ServeHTTP(rec, r)
+			if rec.body.Len() == 0 {
+				// with no body to cut short, drop the connection before the response
+				panic(http.ErrAbortHandler)
+			}
+			for k, v := range rec.header {
+				w.Header()[k] = v
+			}
+			w.Header().Set(ChaosFaultHeader, string(fault))
+			// announce the whole body, so clients can tell it was cut short
+			w.Header().Set("Content-Length", strconv.Itoa(rec.body.Len()))
+			w.WriteHeader(rec.status)
+			_, _ = w.Write(rec.body.Bytes()[:rec.body.Len()/2])
+			if f, ok := w.(http.Flusher); ok {
+				f.Flush()
+			}
+			panic(http.ErrAbortHandler)
+
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// chaosRecorder holds a response so part of it can be sent
+type chaosRecorder struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (cr *chaosRecorder) Header() http.Header {
+	return cr.header
+}
+
+func (cr *chaosRecorder) WriteHeader(status int) {
+	if !cr.wroteHeader {
+		cr.status, cr.wroteHeader = status, true
+	}
+}
+
+func (cr *chaosRecorder) Write(b []byte) (int, error) {
+	cr.wroteHeader = true
+	return cr.body.Write(b)
+}
@@ -0,0 +1,99 @@
+package toolkit
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChaos_Middleware(t *testing.T) {
+	body := strings.Repeat("payload ", 100)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, body)
+	})
+
+	var tests = []struct {
+		name        string
+		chaos       *Chaos
+		header      bool
+		status      int
+		fault       string
+		truncated   bool
+		minDuration time.Duration
+	}{
+		{"off", &Chaos{}, false, http.StatusOK, "", false, 0},
+		{"latency", &Chaos{Rate: 1, Faults: []ChaosFault{ChaosLatency}, MaxLatency: 30 * time.Millisecond}, false, http.StatusOK, "latency", false, 0},
+		{"error", &Chaos{Rate: 1, Faults: []ChaosFault{ChaosError}, ErrorStatuses: []int{http.StatusServiceUnavailable}}, false, http.StatusServiceUnavailable, "error", false, 0},
+		{"truncate", &Chaos{Rate: 1, Faults: []ChaosFault{ChaosTruncate}}, false, http.StatusOK, "truncate", true, 0},
+		{"production", &Chaos{Rate: 1, Faults: []ChaosFault{ChaosError}, Environment: "production"}, false, http.StatusOK, "", false, 0},
+		{"production forced", &Chaos{Rate: 1, Faults: []ChaosFault{ChaosError}, Environment: "production", Force: true, ErrorStatuses: []int{http.StatusBadGateway}}, false, http.StatusBadGateway, "error", false, 0},
+		{"header missing", &Chaos{Rate: 1, Faults: []ChaosFault{ChaosError}, RequestHeader: "X-Chaos"}, false, http.StatusOK, "", false, 0},
+		{"header present", &Chaos{Rate: 1, Faults: []ChaosFault{ChaosError}, RequestHeader: "X-Chaos", ErrorStatuses: []int{http.StatusInternalServerError}}, true, http.StatusInternalServerError, "error", false, 0},
+	}
+
+	for _, e := range tests {
+		var faults []ChaosFault
+		e.chaos.OnFault = func(_ *http.Request, f ChaosFault) { faults = append(faults, f) }
+		srv := httptest.NewServer(e.chaos.Middleware(handler))
+
+		req, _ := http.NewRequest("GET", srv.URL, nil)
+		if e.header {
+			req.Header.Set("X-Chaos", "1")
+		}
+		res, err := srv.Client().Do(req)
+		if err != nil {
+			t.Errorf("%s: %v", e.name, err)
+			srv.Close()
+			continue
+		}
+		got, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		srv.Close()
+
+		if res.StatusCode != e.status || res.Header.Get(ChaosFaultHeader) != e.fault {
+			t.Errorf("%s: unexpected response %d %q", e.name, res.StatusCode, res.Header.Get(ChaosFaultHeader))
+		}
+		if e.truncated != (err != nil) || (!e.truncated && e.status == http.StatusOK && string(got) != body) {
+			t.Errorf("%s: expected truncated %v, got %d bytes and %v", e.name, e.truncated, len(got), err)
+		}
+		if (e.fault != "") != (len(faults) == 1) {
+			t.Errorf("%s: unexpected reported faults %v", e.name, faults)
+		}
+	}
+}
+
+func TestChaos_Rate(t *testing.T) {
+	sequence := func() []bool {
+		c := &Chaos{Rate: 0.3, Faults: []ChaosFault{ChaosError}, Seed: 5, Environment: "test"}
+		h := c.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		var failed []bool
+		for i := 0; i < 200; i++ {
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+			failed = append(failed, rr.Code != http.StatusOK)
+		}
+		return failed
+	}
+
+	first, second := sequence(), sequence()
+	n := 0
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatal("expected the same seed to fail the same requests")
+		}
+		if first[i] {
+			n++
+		}
+	}
+	if n < 30 || n > 90 {
+		t.Errorf("expected about 60 of 200 requests to fail, got %d", n)
+	}
+
+	t.Setenv("APP_ENV", "production")
+	if (&Chaos{Rate: 1}).Active() {
+		t.Error("expected chaos to be off in production")
+	}
+}
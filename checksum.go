@@ -0,0 +1,71 @@
+package toolkit
+
+import (
+	"hash"
+	"sync"
+)
+
+// pipelinedChunkSize is the size of the buffers handed to the hashing goroutine, which matches
+// io.Copy's buffer
+const pipelinedChunkSize = 32 * 1024
+
+// pipelinedHash is a writer which hashes what is written to it in a separate goroutine, so
+// that hashing a large upload overlaps with writing it to disk rather than adding to it
+type pipelinedHash struct {
+	h      hash.Hash
+	chunks chan []byte
+	done   chan struct{}
+	pool   sync.Pool
+	once   sync.Once
+}
+
+func newPipelinedHash(h hash.Hash) *pipelinedHash {
+	ph := &pipelinedHash{
+		h:      h,
+		chunks: make(chan []byte, 16),
+		done:   make(chan struct{}),
+	}
+	ph.pool.New = func() any {
+		b := make([]byte, pipelinedChunkSize)
+		return &b
+	}
+
+	go func() {
+		defer close(ph.done)
+		for chunk := range ph.chunks {
+			ph.h.Write(chunk)
+			if cap(chunk) == pipelinedChunkSize {
+				chunk = chunk[:pipelinedChunkSize]
+				ph.pool.Put(&chunk)
+			}
+		}
+	}()
+	return ph
+}
+
+// Write queues a copy of p to be hashed. It never fails.
+func (ph *pipelinedHash) Write(p []byte) (int, error) {
+	total := len(p)
+	for len(p) > 0 {
+		bp := ph.pool.Get().(*[]byte)
+		n := copy(*bp, p)
+		ph.chunks <- (*bp)[:n]
+		p = p[n:]
+	}
+	return total, nil
+}
+
+// Close stops the hashing goroutine once it has hashed everything written. It is safe to
+// call more than once.
+func (ph *pipelinedHash) Close() {
+	ph.once.Do(func() {
+		close(ph.chunks)
+	})
+	<-ph.done
+}
+
+// Sum waits for everything written to be hashed, and returns the hash
+func (ph *pipelinedHash) Sum() []byte {
+	ph.Close()
+	return ph.h.Sum(nil)
+}
@@ -0,0 +1,106 @@
+package toolkit
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"hash"
+	"io"
+	"mime/multipart"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestPipelinedHash(t *testing.T) {
+	for _, size := range []int{0, 1, pipelinedChunkSize - 1, pipelinedChunkSize, 3*pipelinedChunkSize + 7} {
+		data := bytes.Repeat([]byte{'x'}, size)
+		expected := sha256.Sum256(data)
+
+		ph := newPipelinedHash(sha256.New())
+		n, err := io.Copy(ph, bytes.NewReader(data))
+		if err != nil || n != int64(size) {
+			t.Fatalf("%d bytes: copy returned %d %v", size, n, err)
+		}
+		if !bytes.Equal(ph.Sum(), expected[:]) {
+			t.Errorf("%d bytes: checksum does not match", size)
+		}
+	}
+}
+
+func TestTools_UploadFile_Checksums(t *testing.T) {
+	content := bytes.Repeat([]byte("checksum me\n"), 10000)
+
+	var tests = []struct {
+		name    string
+		newHash func() hash.Hash
+		sum     func() []byte
+	}{
+		{"sha256", nil, func() []byte { s := sha256.Sum256(content); return s[:] }},
+		{"custom", sha512.New, func() []byte { s := sha512.Sum512(content); return s[:] }},
+		{"blake3", NewBLAKE3, func() []byte { h := NewBLAKE3(); _, _ = h.Write(content); return h.Sum(nil) }},
+	}
+
+	for _, e := range tests {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		part, _ := mw.CreateFormFile("file", "data.txt")
+		_, _ = part.Write(content)
+		_ = mw.Close()
+
+		req := httptest.NewRequest("POST", "/", &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+
+		testTools := Tools{Checksums: true, NewHash: e.newHash}
+		uploaded, err := testTools.UploadFile(req, "./testdata/uploads/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = os.Remove("./testdata/uploads/" + uploaded.NewFileName)
+
+		if uploaded.Checksum != hex.EncodeToString(e.sum()) {
+			t.Errorf("%s: unexpected checksum %s", e.name, uploaded.Checksum)
+		}
+	}
+}
+
+// benchmarkUploadChecksum writes 64MB to a temp file while hashing it, as UploadFile does.
+// Pipelining only pays off with more than one CPU, and a disk slower than the page cache.
+func benchmarkUploadChecksum(b *testing.B, newHash func() hash.Hash, pipelined bool) {
+	data := bytes.Repeat([]byte{0xab}, 64<<20)
+	f, err := os.CreateTemp("", "checksum")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = f.Seek(0, io.SeekStart)
+
+		if pipelined {
+			ph := newPipelinedHash(newHash())
+			_, _ = io.Copy(io.MultiWriter(f, ph), bytes.NewReader(data))
+			ph.Sum()
+		} else {
+			h := newHash()
+			_, _ = io.Copy(io.MultiWriter(f, h), bytes.NewReader(data))
+			h.Sum(nil)
+		}
+	}
+}
+
+func BenchmarkUploadChecksum_Serial(b *testing.B) {
+	benchmarkUploadChecksum(b, sha256.New, false)
+}
+
+func BenchmarkUploadChecksum_Pipelined(b *testing.B) {
+	benchmarkUploadChecksum(b, sha256.New, true)
+}
+
+func BenchmarkUploadChecksum_BLAKE3(b *testing.B) {
+	benchmarkUploadChecksum(b, NewBLAKE3, true)
+}
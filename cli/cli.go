@@ -0,0 +1,439 @@
+// Package cli provides the toolkit's operations commands, such as generating keys, signing
+// URLs and collecting garbage in storage, as plain functions and as a command line tool. Apps
+// can run Main from their own binary, adding commands of their own with Register, so every
+// deployment has the same tooling.
+package cli
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kaliadmen/toolkit"
+)
+
+// Command is a subcommand of the tool
+type Command struct {
+	Name string
+	// Usage is a one line description, shown in the list of commands
+	Usage string
+	// Run runs the command with the arguments after its name
+	Run func(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer) error
+}
+
+var (
+	mu       sync.Mutex
+	commands = make(map[string]Command)
+)
+
+// Register adds a command, replacing any built-in command with the same name
+func Register(c Command) {
+	mu.Lock()
+	defer mu.Unlock()
+	commands[c.Name] = c
+}
+
+func init() {
+	Register(Command{Name: "gen-key", Usage: "generate a random key", Run: runGenerateKey})
+	Register(Command{Name: "sign-url", Usage: "sign a URL with the key in $TOOLKIT_SIGNING_KEY", Run: runSignURL})
+	Register(Command{Name: "hash-password", Usage: "hash a password read from stdin", Run: runHashPassword})
+	Register(Command{Name: "migrate", Usage: "copy objects from one storage directory to another", Run: runMigrate})
+	Register(Command{Name: "gc", Usage: "delete objects older than a given age", Run: runGC})
+	Register(Command{Name: "test-webhook", Usage: "send a test event to a webhook", Run: runTestWebhook})
+	Register(Command{Name: "load", Usage: "load test a URL and report latencies", Run: runLoad})
+}
+
+// Main runs the command named by os.Args, and exits with status 0 if it succeeds, 1 if it
+// fails, or 2 if it wasn't used correctly. Interrupts cancel the command's context.
+func Main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	code := Run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
+
+// Run runs the command named by args[0] and returns the exit status Main would
+func Run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	mu.Lock()
+	c, ok := commands[firstArg(args)]
+	mu.Unlock()
+	if !ok {
+		usage(stderr)
+		return 2
+	}
+
+	if err := c.Run(ctx, args[1:], stdin, stdout); err != nil {
+		fmt.Fprintf(stderr, "%s: %v\n", c.Name, err)
+		if errors.As(err, new(usageError)) {
+			return 2
+		}
+		return 1
+	}
+	return 0
+}
+
+func firstArg(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	return args[0]
+}
+
+func usage(w io.Writer) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(w, "usage: <command> [flags]")
+	fmt.Fprintln(w, "\ncommands:")
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-16s %s\n", name, commands[name].Usage)
+	}
+}
+
+// usageError is a command used incorrectly
+type usageError string
+
+func (e usageError) Error() string { return string(e) }
+
+// newFlags returns a flag set for a command which reports errors rather than exiting
+func newFlags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+func parse(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return usageError(err.Error())
+	}
+	return nil
+}
+
+// GenerateKey returns n random bytes, encoded as "hex" or "base64"
+func GenerateKey(n int, encoding string) (string, error) {
+	if n < 1 {
+		return "", usageError("key size must be positive")
+	}
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	switch encoding {
+	case "hex":
+		return hex.EncodeToString(b), nil
+	case "base64":
+		return base64.StdEncoding.EncodeToString(b), nil
+	default:
+		return "", usageError(fmt.Sprintf("unknown encoding %q", encoding))
+	}
+}
+
+func runGenerateKey(_ context.Context, args []string, _ io.Reader, stdout io.Writer) error {
+	fs := newFlags("gen-key")
+	size := fs.Int("bytes", 32, "key size in bytes")
+	encoding := fs.String("encoding", "hex", "hex or base64")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	key, err := GenerateKey(*size, *encoding)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(stdout, key)
+	return err
+}
+
+// SignURL signs rawURL with a toolkit.URLSigner, valid for ttl
+func SignURL(key []byte, rawURL string, ttl time.Duration) (string, error) {
+	s := &toolkit.URLSigner{Key: key}
+	return s.Sign(rawURL, time.Now().Add(ttl))
+}
+
+func runSignURL(_ context.Context, args []string, _ io.Reader, stdout io.Writer) error {
+	fs := newFlags("sign-url")
+	ttl := fs.Duration("ttl", time.Hour, "how long the URL is valid")
+	keyEnv := fs.String("key-env", "TOOLKIT_SIGNING_KEY", "environment variable holding the key")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return usageError("sign-url [-ttl 1h] [-key-env NAME] <url>")
+	}
+	// the key is read from the environment, so it doesn't end up in shell history
+	key := os.Getenv(*keyEnv)
+	if key == "" {
+		return fmt.Errorf("$%s is not set", *keyEnv)
+	}
+
+	signed, err := SignURL([]byte(key), fs.Arg(0), *ttl)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(stdout, signed)
+	return err
+}
+
+func runHashPassword(_ context.Context, args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := newFlags("hash-password")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	// the password is read from stdin, so it doesn't end up in shell history
+	b, err := io.ReadAll(io.LimitReader(stdin, 4096))
+	if err != nil {
+		return err
+	}
+	password := strings.TrimRight(string(b), "\r\n")
+	if password == "" {
+		return usageError("expected a password on stdin")
+	}
+
+	hash, err := toolkit.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(stdout, hash)
+	return err
+}
+
+// MigrateStorage copies every object under prefix from src to dst, skipping objects already
+// in dst with the same size, and returns the number copied. With dryRun, nothing is copied.
+func MigrateStorage(ctx context.Context, src, dst toolkit.Storage, prefix string, dryRun bool) (int, error) {
+	objects, err := src.List(ctx, prefix)
+	if err != nil {
+		return 0, err
+	}
+
+	copied := 0
+	for _, obj := range objects {
+		if info, err := dst.Stat(ctx, obj.Key); err == nil && info.Size == obj.Size {
+			continue
+		}
+		if !dryRun {
+			r, err := src.Get(ctx, obj.Key)
+			if err != nil {
+				return copied, err
+			}
+			err = dst.Put(ctx, obj.Key, r)
+			r.Close()
+			if err != nil {
+				return copied, fmt.Errorf("copying %s: %w", obj.Key, err)
+			}
+		}
+		copied++
+	}
+	return copied, nil
+}
+
+func runMigrate(ctx context.Context, args []string, _ io.Reader, stdout io.Writer) error {
+	fs := newFlags("migrate")
+	prefix := fs.String("prefix", "", "only copy objects whose keys start with this")
+	dryRun := fs.Bool("dry-run", false, "only count the objects which would be copied")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return usageError("migrate [-prefix p] [-dry-run] <from dir> <to dir>")
+	}
+
+	n, err := MigrateStorage(ctx, &toolkit.FileStorage{Dir: fs.Arg(0)}, &toolkit.FileStorage{Dir: fs.Arg(1)}, *prefix, *dryRun)
+	fmt.Fprintf(stdout, "copied %d objects\n", n)
+	return err
+}
+
+// CollectGarbage deletes the objects under prefix last modified more than olderThan ago, and
+// returns their keys. With dryRun, nothing is deleted. Objects which can't be deleted, such as
+// those under a legal hold, are skipped.
+func CollectGarbage(ctx context.Context, s toolkit.Storage, prefix string, olderThan time.Duration, dryRun bool) ([]string, error) {
+	objects, err := s.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := time.Now().Add(-olderThan)
+	var deleted []string
+	for _, obj := range objects {
+		if !obj.ModTime.Before(cutoff) {
+			continue
+		}
+		if !dryRun {
+			err = s.Delete(ctx, obj.Key)
+			if errors.Is(err, toolkit.ErrObjectLocked) {
+				continue
+			}
+			if err != nil {
+				return deleted, err
+			}
+		}
+		deleted = append(deleted, obj.Key)
+	}
+	return deleted, nil
+}
+
+func runGC(ctx context.Context, args []string, _ io.Reader, stdout io.Writer) error {
+	fs := newFlags("gc")
+	prefix := fs.String("prefix", "", "only delete objects whose keys start with this")
+	olderThan := fs.Duration("older-than", 0, "delete objects last modified longer ago than this")
+	dryRun := fs.Bool("dry-run", false, "only list the objects which would be deleted")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	// an age is required, so a typo can't empty the storage
+	if fs.NArg() != 1 || *olderThan <= 0 {
+		return usageError("gc -older-than 720h [-prefix p] [-dry-run] <dir>")
+	}
+
+	store := &toolkit.LockedStorage{Storage: &toolkit.FileStorage{Dir: fs.Arg(0)}}
+	deleted, err := CollectGarbage(ctx, store, *prefix, *olderThan, *dryRun)
+	for _, key := range deleted {
+		fmt.Fprintln(stdout, key)
+	}
+	return err
+}
+
+// TestEvent is the payload SendTestWebhook sends
+type TestEvent struct {
+	Event  string    `json:"event"`
+	ID     string    `json:"id"`
+	SentAt time.Time `json:"sent_at"`
+}
+
+// SendTestWebhook posts a TestEvent to hookURL and returns the response status. If secret is
+// set, the body is signed with HMAC-SHA256 in an X-Signature header of the form
+// sha256=<hex>.
+func SendTestWebhook(ctx context.Context, client *http.Client, hookURL, secret string) (int, error) {
+	id, err := GenerateKey(8, "hex")
+	if err != nil {
+		return 0, err
+	}
+	body, err := json.Marshal(TestEvent{Event: "test", ID: id, SentAt: time.Now().UTC()})
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hookURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		req.Header.Set("X-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+func runTestWebhook(ctx context.Context, args []string, _ io.Reader, stdout io.Writer) error {
+	fs := newFlags("test-webhook")
+	secretEnv := fs.String("secret-env", "", "environment variable holding the signing secret")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return usageError("test-webhook [-secret-env NAME] <url>")
+	}
+
+	var secret string
+	if *secretEnv != "" {
+		secret = os.Getenv(*secretEnv)
+	}
+	status, err := SendTestWebhook(ctx, nil, fs.Arg(0), secret)
+	if status != 0 {
+		fmt.Fprintf(stdout, "status %d\n", status)
+	}
+	return err
+}
+
+// headerFlags collects repeated -H "Name: value" flags
+type headerFlags http.Header
+
+func (h headerFlags) String() string { return "" }
+
+func (h headerFlags) Set(v string) error {
+	name, value, ok := strings.Cut(v, ":")
+	if !ok {
+		return fmt.Errorf("header %q is not Name: value", v)
+	}
+	http.Header(h).Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	return nil
+}
+
+func runLoad(ctx context.Context, args []string, _ io.Reader, stdout io.Writer) error {
+	fs := newFlags("load")
+	header := make(headerFlags)
+	fs.Var(header, "H", "a request header, as Name: value; may be repeated")
+	method := fs.String("method", "", "request method; defaults to GET, or POST with a payload")
+	payloadFile := fs.String("payload", "", "file holding a payload template, rendered with a faker")
+	concurrency := fs.Int("c", 10, "concurrent workers")
+	duration := fs.Duration("d", 10*time.Second, "test duration")
+	requests := fs.Int("n", 0, "stop after this many requests")
+	seed := fs.Int64("seed", 1, "seed of the payload faker")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return usageError("load [-c 10] [-d 10s] [-n N] [-method M] [-payload FILE] [-H 'Name: value'] <url>")
+	}
+
+	lt := &toolkit.LoadTest{
+		URL:         fs.Arg(0),
+		Method:      *method,
+		Header:      http.Header(header),
+		Concurrency: *concurrency,
+		Duration:    *duration,
+		Requests:    *requests,
+		Seed:        *seed,
+	}
+	if *payloadFile != "" {
+		payload, err := os.ReadFile(*payloadFile)
+		if err != nil {
+			return err
+		}
+		lt.Payload = string(payload)
+	}
+
+	result, err := lt.Run(ctx)
+	if err != nil {
+		return err
+	}
+	return result.WriteReport(stdout)
+}
@@ -0,0 +1,174 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kaliadmen/toolkit"
+)
+
+func run(args []string, stdin string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := Run(context.Background(), args, strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestRun(t *testing.T) {
+	t.Setenv("TOOLKIT_SIGNING_KEY", "a signing key for the cli tests")
+
+	var tests = []struct {
+		name   string
+		args   []string
+		stdin  string
+		code   int
+		stdout string
+	}{
+		{"no command", nil, "", 2, ""},
+		{"unknown command", []string{"nope"}, "", 2, ""},
+		{"bad flag", []string{"gen-key", "-nope"}, "", 2, ""},
+		{"bad encoding", []string{"gen-key", "-encoding", "rot13"}, "", 2, ""},
+		{"sign url", []string{"sign-url", "-ttl", "5m", "https://example.com/files/a.pdf"}, "", 0, "https://example.com/files/a.pdf?expires="},
+		{"sign url missing key", []string{"sign-url", "-key-env", "TOOLKIT_TEST_UNSET", "https://example.com/a"}, "", 1, ""},
+		{"hash password", []string{"hash-password"}, "s3cret\n", 0, "pbkdf2-sha256$"},
+		{"hash empty password", []string{"hash-password"}, "\n", 2, ""},
+		{"gc needs an age", []string{"gc", os.TempDir()}, "", 2, ""},
+	}
+
+	old := toolkit.PasswordIterations
+	toolkit.PasswordIterations = 1000
+	t.Cleanup(func() { toolkit.PasswordIterations = old })
+
+	for _, e := range tests {
+		code, stdout, _ := run(e.args, e.stdin)
+		if code != e.code {
+			t.Errorf("%s: expected exit status %d but got %d", e.name, e.code, code)
+		}
+		if !strings.HasPrefix(stdout, e.stdout) {
+			t.Errorf("%s: expected output starting %q but got %q", e.name, e.stdout, stdout)
+		}
+	}
+
+	// the signed url verifies with the same key
+	_, stdout, _ := run([]string{"sign-url", "https://example.com/files/a.pdf"}, "")
+	u, _ := url.Parse(strings.TrimSpace(stdout))
+	s := &toolkit.URLSigner{Key: []byte("a signing key for the cli tests")}
+	if err := s.Verify(u); err != nil {
+		t.Error(err)
+	}
+
+	_, stdout, _ = run([]string{"gen-key", "-bytes", "16"}, "")
+	if b, err := hex.DecodeString(strings.TrimSpace(stdout)); err != nil || len(b) != 16 {
+		t.Errorf("expected a 16 byte hex key, got %q", stdout)
+	}
+
+	// apps can add commands
+	Register(Command{Name: "hello", Run: func(_ context.Context, args []string, _ io.Reader, stdout io.Writer) error {
+		_, err := io.WriteString(stdout, "hello "+strings.Join(args, " "))
+		return err
+	}})
+	if _, stdout, _ = run([]string{"hello", "world"}, ""); stdout != "hello world" {
+		t.Errorf("unexpected output %q", stdout)
+	}
+	if _, _, stderr := run(nil, ""); !strings.Contains(stderr, "hello") || !strings.Contains(stderr, "gen-key") {
+		t.Errorf("expected the usage to list commands, got %q", stderr)
+	}
+}
+
+func TestMigrateAndGC(t *testing.T) {
+	var dirs []string
+	for i := 0; i < 2; i++ {
+		dir, err := os.MkdirTemp("", "cli")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = os.RemoveAll(dir) })
+		dirs = append(dirs, dir)
+	}
+	ctx := context.Background()
+	src, dst := &toolkit.FileStorage{Dir: dirs[0]}, &toolkit.FileStorage{Dir: dirs[1]}
+
+	for _, key := range []string{"uploads/a.txt", "uploads/b.txt", "tmp/old.txt"} {
+		_ = src.Put(ctx, key, strings.NewReader(key))
+	}
+	_ = dst.Put(ctx, "uploads/a.txt", strings.NewReader("uploads/a.txt"))
+
+	if n, err := MigrateStorage(ctx, src, dst, "uploads/", true); err != nil || n != 1 {
+		t.Errorf("expected a dry run to count 1 object, got %d %v", n, err)
+	}
+	if code, stdout, stderr := run([]string{"migrate", "-prefix", "uploads/", dirs[0], dirs[1]}, ""); code != 0 || stdout != "copied 1 objects\n" {
+		t.Errorf("unexpected migrate %d %q %q", code, stdout, stderr)
+	}
+	if _, err := dst.Stat(ctx, "uploads/b.txt"); err != nil {
+		t.Error(err)
+	}
+
+	old := time.Now().Add(-48 * time.Hour)
+	_ = os.Chtimes(filepath.Join(dirs[0], "tmp", "old.txt"), old, old)
+	_ = os.Chtimes(filepath.Join(dirs[0], "uploads", "a.txt"), old, old)
+	_ = toolkit.SetLegalHold(ctx, src, "uploads/a.txt", true)
+
+	code, stdout, _ := run([]string{"gc", "-older-than", "24h", dirs[0]}, "")
+	if code != 0 || stdout != "tmp/old.txt\n" {
+		t.Errorf("expected only the unheld old object to be deleted, got %d %q", code, stdout)
+	}
+	if _, err := src.Stat(ctx, "uploads/a.txt"); err != nil {
+		t.Errorf("expected the held object to be kept: %v", err)
+	}
+}
+
+func TestSendTestWebhook(t *testing.T) {
+	var got http.Header
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+		body, _ = io.ReadAll(r.Body)
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer srv.Close()
+
+	status, err := SendTestWebhook(context.Background(), srv.Client(), srv.URL+"/hook", "hook secret")
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("unexpected result %d %v", status, err)
+	}
+	mac := hmac.New(sha256.New, []byte("hook secret"))
+	mac.Write(body)
+	if got.Get("X-Signature") != "sha256="+hex.EncodeToString(mac.Sum(nil)) || !bytes.Contains(body, []byte(`"event":"test"`)) {
+		t.Errorf("unexpected webhook %q %s", got.Get("X-Signature"), body)
+	}
+
+	if status, err = SendTestWebhook(context.Background(), srv.Client(), srv.URL+"/fail", ""); err == nil || status != http.StatusBadGateway {
+		t.Errorf("expected an error for a 502, got %d %v", status, err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	var hits int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "Bearer t" {
+			hits++
+		}
+	}))
+	defer srv.Close()
+
+	code, stdout, stderr := run([]string{"load", "-c", "1", "-n", "5", "-H", "Authorization: Bearer t", srv.URL}, "")
+	if code != 0 || hits != 5 || !strings.HasPrefix(stdout, "5 requests in") {
+		t.Errorf("unexpected load %d %d %q %q", code, hits, stdout, stderr)
+	}
+	if code, _, _ = run([]string{"load", "-H", "no colon", srv.URL}, ""); code != 2 {
+		t.Errorf("expected a usage error for a bad header, got %d", code)
+	}
+}
@@ -0,0 +1,67 @@
+// Command scaffold generates CRUD handlers and their tests for a struct, writing
+// <type>_handlers.go and <type>_handlers_test.go next to the source file. It is meant to be
+// run by go generate, which sets $GOFILE:
+//
+//	//go:generate go run github.com/kaliadmen/toolkit/cmd/scaffold -type Widget
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kaliadmen/toolkit/scaffold"
+)
+
+func main() {
+	typeName := flag.String("type", "", "the struct to generate handlers for")
+	file := flag.String("file", os.Getenv("GOFILE"), "the Go file declaring the struct; defaults to $GOFILE")
+	force := flag.Bool("force", false, "overwrite existing files")
+	flag.Parse()
+
+	if *typeName == "" || *file == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := run(*file, *typeName, *force); err != nil {
+		fmt.Fprintln(os.Stderr, "scaffold:", err)
+		os.Exit(1)
+	}
+}
+
+func run(file, typeName string, force bool) error {
+	src, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	spec, err := scaffold.Parse(file, src, typeName)
+	if err != nil {
+		return err
+	}
+	handlers, tests, err := scaffold.Generate(spec)
+	if err != nil {
+		return err
+	}
+
+	base := filepath.Join(filepath.Dir(file), strings.ToLower(typeName)+"_handlers")
+	outputs := map[string][]byte{base + ".go": handlers, base + "_test.go": tests}
+	if !force {
+		for name := range outputs {
+			if _, err := os.Stat(name); err == nil {
+				return fmt.Errorf("%s exists; use -force to overwrite it", name)
+			} else if !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+	}
+	for name, src := range outputs {
+		if err := os.WriteFile(name, src, 0644); err != nil {
+			return err
+		}
+		fmt.Println("wrote", name)
+	}
+	return nil
+}
@@ -0,0 +1,9 @@
+// Command toolkit runs the toolkit's operations commands. Run it without arguments to list
+// them.
+package main
+
+import "github.com/kaliadmen/toolkit/cli"
+
+func main() {
+	cli.Main()
+}
@@ -0,0 +1,231 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrNotAcceptable is sent when no registered codec produces a media type the client accepts
+var ErrNotAcceptable = errors.New("none of the accepted media types can be produced")
+
+// ErrUnknownCodec is returned for a name or media type no codec is registered for
+var ErrUnknownCodec = errors.New("no codec is registered")
+
+// Codec encodes and decodes values in one media type. Register codecs with RegisterCodec, once,
+// so that WriteNegotiated, ReadNegotiated and anything else looking codecs up honor them.
+type Codec interface {
+	// ContentType is the media type the codec produces, such as application/json
+	ContentType() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// CodecFuncs adapts a pair of functions to a Codec
+type CodecFuncs struct {
+	Type          string
+	MarshalFunc   func(v any) ([]byte, error)
+	UnmarshalFunc func(data []byte, v any) error
+}
+
+// ContentType returns Type
+func (c CodecFuncs) ContentType() string { return c.Type }
+
+// Marshal calls MarshalFunc
+func (c CodecFuncs) Marshal(v any) ([]byte, error) { return c.MarshalFunc(v) }
+
+// Unmarshal calls UnmarshalFunc
+func (c CodecFuncs) Unmarshal(data []byte, v any) error { return c.UnmarshalFunc(data, v) }
+
+// jsonCodec is the built in JSON codec, which ReadNegotiated reads with ReadJSON
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string                { return "application/json" }
+func (jsonCodec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+var codecs = struct {
+	sync.RWMutex
+	byName map[string]Codec
+	names  []string
+}{
+	byName: map[string]Codec{
+		"json": jsonCodec{},
+		"xml":  CodecFuncs{Type: "application/xml", MarshalFunc: xml.Marshal, UnmarshalFunc: xml.Unmarshal},
+	},
+	names: []string{"json", "xml"},
+}
+
+// RegisterCodec registers c under name, such as "proto", replacing any codec registered under
+// the name before, including the built in "json" and "xml". Codecs are preferred in the order
+// they were first registered when a client accepts several equally.
+func RegisterCodec(name string, c Codec) {
+	codecs.Lock()
+	defer codecs.Unlock()
+	if _, ok := codecs.byName[name]; !ok {
+		codecs.names = append(codecs.names, name)
+	}
+	codecs.byName[name] = c
+}
+
+// LookupCodec returns the codec registered under name, or for the media type name, ignoring
+// its parameters
+func LookupCodec(name string) (Codec, error) {
+	codecs.RLock()
+	defer codecs.RUnlock()
+	if c, ok := codecs.byName[name]; ok {
+		return c, nil
+	}
+	if mediaType, _, err := mime.ParseMediaType(name); err == nil {
+		for _, n := range codecs.names {
+			if c := codecs.byName[n]; strings.EqualFold(c.ContentType(), mediaType) {
+				return c, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%w for %q", ErrUnknownCodec, name)
+}
+
+// Codecs returns the names of the registered codecs, in order of preference
+func Codecs() []string {
+	codecs.RLock()
+	defer codecs.RUnlock()
+	return append([]string(nil), codecs.names...)
+}
+
+type acceptRange struct {
+	mediaType string
+	q         float64
+}
+
+// parseAccept returns the media ranges of an Accept header, most preferred first
+func parseAccept(header string) []acceptRange {
+	var ranges []acceptRange
+	for _, part := range strings.Split(header, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q > 0 {
+			ranges = append(ranges, acceptRange{mediaType: mediaType, q: q})
+		}
+	}
+	// more specific ranges win ties, as the client wrote them to be preferred
+	specificity := func(t string) int {
+		switch {
+		case t == "*/*":
+			return 0
+		case strings.HasSuffix(t, "/*"):
+			return 1
+		}
+		return 2
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		if ranges[i].q != ranges[j].q {
+			return ranges[i].q > ranges[j].q
+		}
+		return specificity(ranges[i].mediaType) > specificity(ranges[j].mediaType)
+	})
+	return ranges
+}
+
+// NegotiateCodec picks the registered codec the request's Accept header prefers. A missing
+// header accepts anything, which is answered with the first codec, JSON unless replaced.
+func NegotiateCodec(r *http.Request) (Codec, error) {
+	accept := r.Header.Get("Accept")
+	if strings.TrimSpace(accept) == "" {
+		accept = "*/*"
+	}
+
+	codecs.RLock()
+	defer codecs.RUnlock()
+	for _, ar := range parseAccept(accept) {
+		for _, name := range codecs.names {
+			c := codecs.byName[name]
+			ct := strings.ToLower(c.ContentType())
+			switch {
+			case ar.mediaType == "*/*",
+				ar.mediaType == ct,
+				strings.HasSuffix(ar.mediaType, "/*") && strings.HasPrefix(ct, strings.TrimSuffix(ar.mediaType, "*")):
+				return c, nil
+			}
+		}
+	}
+	return nil, ErrNotAcceptable
+}
+
+// WriteNegotiated writes data as WriteJSON does, but encoded with the registered codec the
+// client's Accept header prefers. If the client accepts none of them it sends a 406 JSON error
+// and returns ErrNotAcceptable.
+func (t *Tools) WriteNegotiated(w http.ResponseWriter, r *http.Request, status int, data any, headers ...http.Header) error {
+	w.Header().Add("Vary", "Accept")
+	codec, err := NegotiateCodec(r)
+	if err != nil {
+		_ = t.ErrorJSON(w, err, http.StatusNotAcceptable)
+		return err
+	}
+
+	payload, err := t.responsePayload(w, status, data)
+	if err != nil {
+		return err
+	}
+	out, err := codec.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	if len(headers) > 0 {
+		for key, value := range headers[0] {
+			w.Header()[key] = value
+		}
+	}
+	w.Header().Set("Content-Type", codec.ContentType())
+	w.WriteHeader(status)
+	_, err = w.Write(out)
+	return err
+}
+
+// ReadNegotiated decodes the request body into data with the codec registered for its
+// Content-Type, or as JSON if it has none, within the same size limit as ReadJSON. A body in a
+// media type no codec is registered for is refused with an error wrapping ErrUnknownCodec.
+func (t *Tools) ReadNegotiated(w http.ResponseWriter, r *http.Request, data any) error {
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	codec, err := LookupCodec(contentType)
+	if err != nil {
+		return err
+	}
+	if _, ok := codec.(jsonCodec); ok {
+		// keep ReadJSON's checks for trailing data, moderation and transformations
+		return t.ReadJSON(w, r, data)
+	}
+
+	maxBytes := 1048576 // one megabyte
+	if t.MaxFileSize > 0 {
+		maxBytes = t.MaxFileSize
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, int64(maxBytes)))
+	if err != nil {
+		return asBodyTooLarge(err, int64(maxBytes))
+	}
+	if err = codec.Unmarshal(body, data); err != nil {
+		return err
+	}
+	return transformRequest(r, data)
+}
@@ -0,0 +1,169 @@
+package toolkit
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// csvCodec is a toy codec encoding a []string as one CSV line
+var csvCodec = CodecFuncs{
+	Type: "text/csv",
+	MarshalFunc: func(v any) ([]byte, error) {
+		fields, ok := v.([]string)
+		if !ok {
+			return nil, fmt.Errorf("cannot encode %T as csv", v)
+		}
+		return []byte(strings.Join(fields, ",")), nil
+	},
+	UnmarshalFunc: func(data []byte, v any) error {
+		fields, ok := v.(*[]string)
+		if !ok {
+			return fmt.Errorf("cannot decode csv into %T", v)
+		}
+		*fields = strings.Split(string(data), ",")
+		return nil
+	},
+}
+
+// registerTestCodec registers csvCodec for the test, restoring the registry afterwards
+func registerTestCodec(t *testing.T) {
+	t.Helper()
+	codecs.Lock()
+	byName := make(map[string]Codec)
+	for k, v := range codecs.byName {
+		byName[k] = v
+	}
+	names := append([]string(nil), codecs.names...)
+	codecs.Unlock()
+	t.Cleanup(func() {
+		codecs.Lock()
+		codecs.byName, codecs.names = byName, names
+		codecs.Unlock()
+	})
+	RegisterCodec("csv", csvCodec)
+}
+
+func TestLookupCodec(t *testing.T) {
+	registerTestCodec(t)
+
+	var tests = []struct {
+		name        string
+		contentType string
+		wantErr     bool
+	}{
+		{name: "json", contentType: "application/json"},
+		{name: "csv", contentType: "text/csv"},
+		{name: "text/csv; charset=utf-8", contentType: "text/csv"},
+		{name: "APPLICATION/XML", contentType: "application/xml"},
+		{name: "proto", wantErr: true},
+		{name: "application/x-protobuf", wantErr: true},
+	}
+	for _, e := range tests {
+		c, err := LookupCodec(e.name)
+		if e.wantErr {
+			if !errors.Is(err, ErrUnknownCodec) {
+				t.Errorf("%s: expected ErrUnknownCodec, got %v", e.name, err)
+			}
+			continue
+		}
+		if err != nil || c.ContentType() != e.contentType {
+			t.Errorf("%s: expected %s, got %v", e.name, e.contentType, err)
+		}
+	}
+
+	if got := Codecs(); strings.Join(got, ",") != "json,xml,csv" {
+		t.Errorf("unexpected codecs %v", got)
+	}
+}
+
+func TestTools_WriteNegotiated(t *testing.T) {
+	registerTestCodec(t)
+
+	var tests = []struct {
+		accept      string
+		status      int
+		contentType string
+		body        string
+	}{
+		{accept: "", status: http.StatusOK, contentType: "application/json", body: `["a","b"]`},
+		{accept: "*/*", status: http.StatusOK, contentType: "application/json", body: `["a","b"]`},
+		{accept: "text/csv", status: http.StatusOK, contentType: "text/csv", body: "a,b"},
+		{accept: "text/*", status: http.StatusOK, contentType: "text/csv", body: "a,b"},
+		{accept: "application/json;q=0.5, text/csv", status: http.StatusOK, contentType: "text/csv", body: "a,b"},
+		{accept: "*/*;q=0.1, text/csv;q=0.1", status: http.StatusOK, contentType: "text/csv", body: "a,b"},
+		{accept: "text/csv;q=0, */*", status: http.StatusOK, contentType: "application/json", body: `["a","b"]`},
+		{accept: "image/png", status: http.StatusNotAcceptable, contentType: "application/json"},
+	}
+
+	var tools Tools
+	for _, e := range tests {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if e.accept != "" {
+			req.Header.Set("Accept", e.accept)
+		}
+		err := tools.WriteNegotiated(rr, req, http.StatusOK, []string{"a", "b"})
+		if rr.Code != e.status || rr.Header().Get("Content-Type") != e.contentType {
+			t.Errorf("%q: expected %d %s, got %d %s", e.accept, e.status, e.contentType, rr.Code, rr.Header().Get("Content-Type"))
+		}
+		if e.status == http.StatusNotAcceptable {
+			if !errors.Is(err, ErrNotAcceptable) {
+				t.Errorf("%q: expected ErrNotAcceptable, got %v", e.accept, err)
+			}
+			continue
+		}
+		if body := strings.TrimSpace(rr.Body.String()); err != nil || body != e.body {
+			t.Errorf("%q: expected %s, got %s and %v", e.accept, e.body, body, err)
+		}
+		if rr.Header().Get("Vary") != "Accept" {
+			t.Errorf("%q: expected Vary: Accept", e.accept)
+		}
+	}
+}
+
+func TestTools_ReadNegotiated(t *testing.T) {
+	registerTestCodec(t)
+
+	var tests = []struct {
+		contentType string
+		body        string
+		want        string
+		wantErr     bool
+	}{
+		{contentType: "", body: `["a","b"]`, want: "a|b"},
+		{contentType: "application/json", body: `["a"] ["b"]`, wantErr: true},
+		{contentType: "text/csv", body: "a,b,c", want: "a|b|c"},
+		{contentType: "application/x-protobuf", body: "x", wantErr: true},
+	}
+
+	var tools Tools
+	for _, e := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(e.body))
+		if e.contentType != "" {
+			req.Header.Set("Content-Type", e.contentType)
+		}
+		var got []string
+		err := tools.ReadNegotiated(httptest.NewRecorder(), req, &got)
+		if (err != nil) != e.wantErr {
+			t.Errorf("%q: unexpected error %v", e.contentType, err)
+			continue
+		}
+		if !e.wantErr && strings.Join(got, "|") != e.want {
+			t.Errorf("%q: expected %s, got %v", e.contentType, e.want, got)
+		}
+	}
+
+	// the size limit applies to every codec
+	tools.MaxFileSize = 4
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("a,b,c,d"))
+	req.Header.Set("Content-Type", "text/csv")
+	var got []string
+	if err := tools.ReadNegotiated(httptest.NewRecorder(), req, &got); !errors.As(err, new(*BodyTooLargeError)) {
+		t.Errorf("expected a BodyTooLargeError, got %v", err)
+	}
+}
@@ -0,0 +1,230 @@
+// Package concurrency provides small helpers for coordinating goroutines: debouncing a burst of
+// calls into one, throttling a function to a rate, and sharing one call of a function between
+// the callers asking for the same key at once.
+package concurrency
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Debouncer runs Fn once calls to Trigger have stopped for Delay, so a burst of events, such as
+// a file being written in several steps, causes a single run. Fn runs on its own goroutine, and
+// never twice at once. The zero value needs Fn set; it is safe for concurrent use.
+type Debouncer struct {
+	// Fn is the function debounced
+	Fn func()
+	// Delay is the quiet time after the last Trigger before Fn runs. Defaults to 100ms
+	Delay time.Duration
+	// MaxDelay, if set, runs Fn once this long has passed since the first Trigger of a burst,
+	// even if Trigger is still being called
+	MaxDelay time.Duration
+
+	mu      sync.Mutex
+	timer   *time.Timer
+	first   time.Time
+	stopped bool
+	running sync.Mutex
+}
+
+// Trigger starts, or extends, the delay before Fn runs
+func (d *Debouncer) Trigger() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stopped {
+		return
+	}
+	delay := d.Delay
+	if delay <= 0 {
+		delay = 100 * time.Millisecond
+	}
+	now := time.Now()
+	if d.timer == nil {
+		d.first = now
+	} else {
+		d.timer.Stop()
+	}
+	if d.MaxDelay > 0 {
+		if left := d.first.Add(d.MaxDelay).Sub(now); left < delay {
+			delay = left
+		}
+	}
+	d.timer = time.AfterFunc(delay, d.fire)
+}
+
+func (d *Debouncer) fire() {
+	d.mu.Lock()
+	d.timer = nil
+	d.mu.Unlock()
+	d.running.Lock()
+	defer d.running.Unlock()
+	d.Fn()
+}
+
+// Flush runs Fn now if a Trigger is waiting, and reports whether it did
+func (d *Debouncer) Flush() bool {
+	d.mu.Lock()
+	if d.timer == nil || !d.timer.Stop() {
+		d.mu.Unlock()
+		return false
+	}
+	d.mu.Unlock()
+	d.fire()
+	return true
+}
+
+// Stop cancels a waiting Trigger, and ignores those after it
+func (d *Debouncer) Stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.stopped = true
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+}
+
+// Throttler runs functions at most once per Interval. A function passed to Do within the
+// interval of the last run is held back until the interval ends, replacing any function held
+// back before it, so the last one of a burst always runs, as when pushing the latest state of
+// something to clients. The zero value is ready to use, and safe for concurrent use.
+type Throttler struct {
+	// Interval is the least time between runs. Defaults to one second
+	Interval time.Duration
+
+	mu      sync.Mutex
+	last    time.Time
+	pending func()
+	timer   *time.Timer
+}
+
+func (t *Throttler) interval() time.Duration {
+	if t.Interval > 0 {
+		return t.Interval
+	}
+	return time.Second
+}
+
+// Do runs fn now, on the calling goroutine, if the interval since the last run has passed, and
+// reports true. Otherwise it holds fn back to run on its own goroutine when the interval ends,
+// and reports false.
+func (t *Throttler) Do(fn func()) bool {
+	t.mu.Lock()
+	now := time.Now()
+	if t.pending == nil && now.Sub(t.last) >= t.interval() {
+		t.last = now
+		t.mu.Unlock()
+		fn()
+		return true
+	}
+	t.pending = fn
+	if t.timer == nil {
+		t.timer = time.AfterFunc(t.last.Add(t.interval()).Sub(now), t.runPending)
+	}
+	t.mu.Unlock()
+	return false
+}
+
+func (t *Throttler) runPending() {
+	t.mu.Lock()
+	fn := t.pending
+	t.pending, t.timer = nil, nil
+	t.last = time.Now()
+	t.mu.Unlock()
+	if fn != nil {
+		fn()
+	}
+}
+
+// Stop drops a function held back, and reports whether there was one
+func (t *Throttler) Stop() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.timer == nil {
+		return false
+	}
+	t.timer.Stop()
+	t.pending, t.timer = nil, nil
+	return true
+}
+
+// Group shares one call of a function between the callers asking for the same key at once, so
+// that a burst of requests for an uncached value, say, loads it once. The zero value is ready
+// to use, and safe for concurrent use.
+type Group[K comparable, V any] struct {
+	mu    sync.Mutex
+	calls map[K]*call[V]
+}
+
+type call[V any] struct {
+	done    chan struct{}
+	val     V
+	err     error
+	callers int
+}
+
+// Do calls fn for key, unless a call for key is in progress, in which case it waits for that
+// call and returns its results. shared reports whether the results went to more than one
+// caller. If fn panics, the callers waiting for it get an error, and the panic goes on in the
+// caller which ran it.
+func (g *Group[K, V]) Do(key K, fn func() (V, error)) (v V, err error, shared bool) {
+	return g.DoContext(context.Background(), key, fn)
+}
+
+// DoContext is Do, except that a caller waiting for another's call stops waiting when ctx
+// ends, with ctx's error. The call itself isn't cancelled, as other callers may want it.
+func (g *Group[K, V]) DoContext(ctx context.Context, key K, fn func() (V, error)) (v V, err error, shared bool) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[K]*call[V])
+	}
+	if c, ok := g.calls[key]; ok {
+		c.callers++
+		g.mu.Unlock()
+		select {
+		case <-c.done:
+			return c.val, c.err, true
+		case <-ctx.Done():
+			return v, ctx.Err(), true
+		}
+	}
+	c := &call[V]{done: make(chan struct{}), callers: 1}
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	finished := false
+	defer func() {
+		if !finished {
+			r := recover()
+			c.err = fmt.Errorf("concurrency: call for %v panicked: %v", key, r)
+			g.finish(key, c)
+			panic(r)
+		}
+	}()
+	c.val, c.err = fn()
+	finished = true
+	g.finish(key, c)
+
+	g.mu.Lock()
+	shared = c.callers > 1
+	g.mu.Unlock()
+	return c.val, c.err, shared
+}
+
+func (g *Group[K, V]) finish(key K, c *call[V]) {
+	g.mu.Lock()
+	if g.calls[key] == c {
+		delete(g.calls, key)
+	}
+	g.mu.Unlock()
+	close(c.done)
+}
+
+// Forget makes the next call for key run fn, rather than wait for a call in progress
+func (g *Group[K, V]) Forget(key K) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.calls, key)
+}
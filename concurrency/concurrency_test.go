@@ -0,0 +1,166 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDebouncer(t *testing.T) {
+	var runs int32
+	d := &Debouncer{Fn: func() { atomic.AddInt32(&runs, 1) }, Delay: 20 * time.Millisecond}
+	for i := 0; i < 5; i++ {
+		d.Trigger()
+		time.Sleep(2 * time.Millisecond)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if n := atomic.LoadInt32(&runs); n != 1 {
+		t.Errorf("expected one run for the burst, got %d", n)
+	}
+
+	d.Trigger()
+	if !d.Flush() {
+		t.Error("expected Flush to run the waiting trigger")
+	}
+	if n := atomic.LoadInt32(&runs); n != 2 {
+		t.Errorf("expected Flush to run Fn at once, got %d runs", n)
+	}
+	if d.Flush() {
+		t.Error("expected nothing to flush")
+	}
+
+	d.Stop()
+	d.Trigger()
+	time.Sleep(40 * time.Millisecond)
+	if n := atomic.LoadInt32(&runs); n != 2 {
+		t.Errorf("expected no runs after Stop, got %d", n)
+	}
+}
+
+func TestDebouncer_MaxDelay(t *testing.T) {
+	var runs int32
+	d := &Debouncer{Fn: func() { atomic.AddInt32(&runs, 1) }, Delay: 30 * time.Millisecond, MaxDelay: 50 * time.Millisecond}
+	defer d.Stop()
+	for i := 0; i < 20; i++ {
+		d.Trigger()
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := atomic.LoadInt32(&runs); n == 0 {
+		t.Error("expected MaxDelay to run Fn during a long burst")
+	}
+}
+
+func TestThrottler(t *testing.T) {
+	th := &Throttler{Interval: 30 * time.Millisecond}
+	var mu sync.Mutex
+	var got []int
+	record := func(n int) func() {
+		return func() {
+			mu.Lock()
+			defer mu.Unlock()
+			got = append(got, n)
+		}
+	}
+
+	if !th.Do(record(1)) {
+		t.Error("expected the first call to run at once")
+	}
+	if th.Do(record(2)) || th.Do(record(3)) {
+		t.Error("expected calls within the interval to be held back")
+	}
+	time.Sleep(60 * time.Millisecond)
+
+	mu.Lock()
+	if len(got) != 2 || got[0] != 1 || got[1] != 3 {
+		t.Errorf("expected the first and last calls to run, got %v", got)
+	}
+	mu.Unlock()
+
+	th.Do(record(4))
+	th.Do(record(5))
+	if !th.Stop() {
+		t.Error("expected a call to be held back")
+	}
+}
+
+func TestGroup(t *testing.T) {
+	var g Group[string, int]
+	var calls int32
+	release := make(chan struct{})
+	fn := func() (int, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return 42, nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([]int, 5)
+	shared := make([]bool, 5)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _, shared[i] = g.Do("answer", fn)
+		}(i)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("expected one call, got %d", calls)
+	}
+	for i := range results {
+		if results[i] != 42 || !shared[i] {
+			t.Errorf("caller %d: expected the shared result, got %d, %v", i, results[i], shared[i])
+		}
+	}
+
+	// the next call runs fn again
+	if v, _, s := g.Do("answer", func() (int, error) { return 7, nil }); v != 7 || s {
+		t.Errorf("expected a new unshared call, got %d, %v", v, s)
+	}
+}
+
+func TestGroup_Context(t *testing.T) {
+	var g Group[int, string]
+	release := make(chan struct{})
+	defer close(release)
+	go g.Do(1, func() (string, error) {
+		<-release
+		return "slow", nil
+	})
+	time.Sleep(10 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err, _ := g.DoContext(ctx, 1, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the waiter to give up with its context, got %v", err)
+	}
+}
+
+func TestGroup_Panic(t *testing.T) {
+	var g Group[string, int]
+	release := make(chan struct{})
+	waited := make(chan error)
+	go func() {
+		defer func() { _ = recover() }()
+		g.Do("k", func() (int, error) {
+			<-release
+			panic("boom")
+		})
+	}()
+	time.Sleep(10 * time.Millisecond)
+	go func() {
+		_, err, _ := g.Do("k", nil)
+		waited <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	if err := <-waited; err == nil {
+		t.Error("expected the waiter to get an error when the call panicked")
+	}
+}
@@ -0,0 +1,171 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/kaliadmen/toolkit/concurrency"
+)
+
+// Config loads a configuration file into a T and, while watched, reloads it when the file
+// changes. Subscribers registered with OnConfigChange are told of the values which changed,
+// so subsystems such as the log level, rate limits and maintenance mode follow the file
+// without a restart. A reload is applied whole or not at all: a file which fails to parse or
+// validate leaves the previous configuration in effect.
+type Config[T any] struct {
+	// Path is the file, which is YAML if it ends in .yaml or .yml and JSON otherwise
+	Path string
+	// Interval is how often a watched file is checked for changes. Defaults to two seconds
+	Interval time.Duration
+	// Validate, if set, rejects a loaded configuration
+	Validate func(c *T) error
+	// ErrorLog receives errors reloading a watched file
+	ErrorLog func(err error)
+
+	// reload serializes loads, so subscribers see changes in order
+	reload      sync.Mutex
+	mu          sync.RWMutex
+	current     *T
+	sum         [sha256.Size]byte
+	subscribers []func(old, new *T)
+}
+
+// Load reads the file, and applies it if it changed since it was last loaded
+func (c *Config[T]) Load() error {
+	_, err := c.load()
+	return err
+}
+
+func (c *Config[T]) load() (bool, error) {
+	c.reload.Lock()
+	defer c.reload.Unlock()
+
+	data, err := os.ReadFile(c.Path)
+	if err != nil {
+		return false, err
+	}
+	sum := sha256.Sum256(data)
+	c.mu.RLock()
+	unchanged := c.current != nil && sum == c.sum
+	c.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	if ext := filepath.Ext(c.Path); ext == ".yaml" || ext == ".yml" {
+		v, err := parseYAML(data)
+		if err != nil {
+			return false, fmt.Errorf("%s: %w", c.Path, err)
+		}
+		if data, err = json.Marshal(v); err != nil {
+			return false, fmt.Errorf("%s: %w", c.Path, err)
+		}
+	}
+	next := new(T)
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(next); err != nil {
+		return false, fmt.Errorf("%s: %w", c.Path, err)
+	}
+	if c.Validate != nil {
+		if err = c.Validate(next); err != nil {
+			return false, fmt.Errorf("%s: %w", c.Path, err)
+		}
+	}
+
+	c.mu.Lock()
+	old := c.current
+	c.current, c.sum = next, sum
+	subscribers := c.subscribers
+	c.mu.Unlock()
+
+	for _, fn := range subscribers {
+		fn(old, next)
+	}
+	return true, nil
+}
+
+// Get returns the current configuration, or nil before the first Load. It must not be
+// modified, as it is shared with other callers.
+func (c *Config[T]) Get() *T {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.current
+}
+
+// Subscribe calls fn after each change of the configuration, with the previous one, which is
+// nil for the first load. Reloads wait for subscribers to return, so they are called in order.
+func (c *Config[T]) Subscribe(fn func(old, new *T)) {
+	c.reload.Lock()
+	defer c.reload.Unlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.subscribers = append(c.subscribers, fn)
+}
+
+// Watch checks the file for changes every Interval, until ctx is done. A changed file is
+// reloaded once a check finds it unchanged, so one being written in several steps isn't read
+// half way through.
+func (c *Config[T]) Watch(ctx context.Context) {
+	interval := c.Interval
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+	reload := &concurrency.Debouncer{
+		Fn: func() {
+			if _, err := c.load(); err != nil && c.ErrorLog != nil {
+				c.ErrorLog(err)
+			}
+		},
+		Delay: interval * 3 / 2,
+	}
+	defer reload.Stop()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last os.FileInfo
+	for first := true; ; first = false {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// a missing file is left to the load to report, once
+			info, _ := os.Stat(c.Path)
+			if first || (info == nil) != (last == nil) ||
+				info != nil && (info.Size() != last.Size() || !info.ModTime().Equal(last.ModTime())) {
+				reload.Trigger()
+			}
+			last = info
+		}
+	}
+}
+
+// OnConfigChange calls apply with the value field picks from the configuration whenever it
+// changes, and at once if the configuration is loaded, so the subsystem starts in step with
+// the file. For example, to follow a maintenance setting:
+//
+//	OnConfigChange(cfg, func(c *AppConfig) bool { return c.Maintenance }, maintenance.Set)
+func OnConfigChange[T, V any](c *Config[T], field func(c *T) V, apply func(v V)) {
+	c.reload.Lock()
+	defer c.reload.Unlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.current != nil {
+		apply(field(c.current))
+	}
+	c.subscribers = append(c.subscribers, func(old, new *T) {
+		v := field(new)
+		if old == nil || !reflect.DeepEqual(field(old), v) {
+			apply(v)
+		}
+	})
+}
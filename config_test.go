@@ -0,0 +1,146 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testAppConfig struct {
+	LogLevel    string  `json:"log_level"`
+	Maintenance bool    `json:"maintenance"`
+	RateLimit   float64 `json:"rate_limit"`
+}
+
+func TestConfig(t *testing.T) {
+	dir, err := os.MkdirTemp("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	p := filepath.Join(dir, "app.yaml")
+	write := func(s string) {
+		if err := os.WriteFile(p, []byte(s), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := &Config[testAppConfig]{Path: p, Validate: func(c *testAppConfig) error {
+		if _, err := ParseLogLevel(c.LogLevel); err != nil {
+			return err
+		}
+		return nil
+	}}
+	write("log_level: info\nmaintenance: false\nrate_limit: 5\n")
+	if err = cfg.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	var level LevelVar
+	var maintenance Toggle
+	limiter := &RateLimiter{}
+	var rateChanges int
+	OnConfigChange(cfg, func(c *testAppConfig) LogLevel { l, _ := ParseLogLevel(c.LogLevel); return l }, level.Set)
+	OnConfigChange(cfg, func(c *testAppConfig) bool { return c.Maintenance }, maintenance.Set)
+	OnConfigChange(cfg, func(c *testAppConfig) float64 { return c.RateLimit }, func(rate float64) {
+		rateChanges++
+		limiter.SetLimits(rate, int(rate))
+	})
+	if level.Level() != LevelInfo || maintenance.Enabled() || limiter.Rate != 5 || rateChanges != 1 {
+		t.Fatalf("expected the current config to be applied at once")
+	}
+
+	var tests = []struct {
+		name        string
+		file        string
+		isErr       bool
+		level       LogLevel
+		maintenance bool
+		rateChanges int
+	}{
+		{"unchanged", "log_level: info\nmaintenance: false\nrate_limit: 5\n", false, LevelInfo, false, 1},
+		{"maintenance on", "log_level: warn\nmaintenance: true\nrate_limit: 5\n", false, LevelWarn, true, 1},
+		{"invalid level", "log_level: loud\nmaintenance: false\nrate_limit: 1\n", true, LevelWarn, true, 1},
+		{"unknown field", "log_level: info\nmaintenence: false\n", true, LevelWarn, true, 1},
+		{"rate change", "log_level: warn\nmaintenance: true\nrate_limit: 2\n", false, LevelWarn, true, 2},
+	}
+
+	for _, e := range tests {
+		write(e.file)
+		err = cfg.Load()
+		if e.isErr != (err != nil) {
+			t.Errorf("%s: unexpected error %v", e.name, err)
+		}
+		if level.Level() != e.level || maintenance.Enabled() != e.maintenance || rateChanges != e.rateChanges {
+			t.Errorf("%s: unexpected state %v %v %d", e.name, level.Level(), maintenance.Enabled(), rateChanges)
+		}
+	}
+	if cfg.Get().RateLimit != 2 || limiter.Burst != 2 {
+		t.Errorf("unexpected config %+v", cfg.Get())
+	}
+}
+
+func TestConfig_Watch(t *testing.T) {
+	dir, err := os.MkdirTemp("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	p := filepath.Join(dir, "app.json")
+	_ = os.WriteFile(p, []byte(`{"maintenance": false}`), 0644)
+
+	var mu sync.Mutex
+	var errs []error
+	changed := make(chan bool, 10)
+	cfg := &Config[testAppConfig]{Path: p, Interval: 10 * time.Millisecond, ErrorLog: func(err error) {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+	}}
+	cfg.Subscribe(func(old, new *testAppConfig) { changed <- new.Maintenance })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		cfg.Watch(ctx)
+		close(done)
+	}()
+
+	for i, expected := range []bool{false, true} {
+		if i > 0 {
+			_ = os.WriteFile(p, []byte(`{"maintenance": true}`), 0644)
+		}
+		select {
+		case got := <-changed:
+			if got != expected {
+				t.Errorf("expected maintenance %v, got %v", expected, got)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for a reload")
+		}
+	}
+
+	_ = os.WriteFile(p, []byte(`{`), 0644)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		mu.Lock()
+		n := len(errs)
+		mu.Unlock()
+		if n > 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+	if len(errs) == 0 || !cfg.Get().Maintenance {
+		t.Errorf("expected a logged error and the last good config, got %v %+v", errs, cfg.Get())
+	}
+	if err = (&Config[testAppConfig]{Path: filepath.Join(dir, "missing.json")}).Load(); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected a missing file error, got %v", err)
+	}
+}
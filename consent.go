@@ -0,0 +1,200 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrConsentRequired is sent when a user hasn't accepted the current version of a document
+var ErrConsentRequired = errors.New("the current terms must be accepted")
+
+// ConsentEvent records a user accepting a version of a document, such as the terms of service
+type ConsentEvent struct {
+	User       string    `json:"user"`
+	Document   string    `json:"document"`
+	Version    string    `json:"version"`
+	AcceptedAt time.Time `json:"accepted_at"`
+	IP         string    `json:"ip,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+}
+
+// ConsentProvider keeps the documents users have accepted
+type ConsentProvider interface {
+	// AcceptedVersion returns the version of document the user last accepted, or "" if none
+	AcceptedVersion(ctx context.Context, user, document string) (string, error)
+	// RecordAcceptance stores an acceptance
+	RecordAcceptance(ctx context.Context, e ConsentEvent) error
+}
+
+// MemoryConsentProvider keeps acceptances in memory, for tests and single instance apps. The
+// zero value is ready to use.
+type MemoryConsentProvider struct {
+	mu     sync.Mutex
+	events []ConsentEvent
+}
+
+// AcceptedVersion implements ConsentProvider
+func (p *MemoryConsentProvider) AcceptedVersion(_ context.Context, user, document string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i := len(p.events) - 1; i >= 0; i-- {
+		if e := p.events[i]; e.User == user && e.Document == document {
+			return e.Version, nil
+		}
+	}
+	return "", nil
+}
+
+// RecordAcceptance implements ConsentProvider
+func (p *MemoryConsentProvider) RecordAcceptance(_ context.Context, e ConsentEvent) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.events = append(p.events, e)
+	return nil
+}
+
+// Events returns every acceptance by a user, oldest first
+func (p *MemoryConsentProvider) Events(user string) []ConsentEvent {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var events []ConsentEvent
+	for _, e := range p.events {
+		if e.User == user {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// ConsentDetails is the data sent with a refusal, so clients can show the document
+type ConsentDetails struct {
+	Document string `json:"document"`
+	Version  string `json:"version"`
+	Accepted string `json:"accepted,omitempty"`
+}
+
+// Consent requires users to have accepted the current version of a document, such as the
+// terms of service or a privacy policy, before using the routes it guards. Bump Version when
+// the document changes, and users are asked to accept it again.
+type Consent struct {
+	Provider ConsentProvider
+	// Document names the document. Defaults to "terms"
+	Document string
+	// Version is the current version of the document
+	Version string
+	// User identifies the user of a request. Requests without a user pass, so authentication
+	// should run first
+	User func(r *http.Request) string
+	// Exempt lists path prefixes which are never blocked, such as the route that records
+	// acceptance
+	Exempt []string
+	// Status is the status of refusals. Defaults to 451 Unavailable For Legal Reasons; 409
+	// Conflict is also common
+	Status int
+	// TrustedProxies are believed when recording the IP address acceptances came from
+	TrustedProxies []*net.IPNet
+}
+
+func (c *Consent) document() string {
+	if c.Document != "" {
+		return c.Document
+	}
+	return "terms"
+}
+
+// Middleware refuses requests from users who haven't accepted the current version with a JSON
+// error carrying ConsentDetails
+func (c *Consent) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var user string
+		if c.User != nil {
+			user = c.User(r)
+		}
+		if user == "" || c.exempt(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var t Tools
+		accepted, err := c.Provider.AcceptedVersion(r.Context(), user, c.document())
+		if err != nil {
+			_ = t.ErrorJSON(w, err, http.StatusServiceUnavailable)
+			return
+		}
+		if accepted != c.Version {
+			status := c.Status
+			if status == 0 {
+				status = http.StatusUnavailableForLegalReasons
+			}
+			_ = t.WriteJSON(w, status, JSONResponse{
+				Error:   true,
+				Message: ErrConsentRequired.Error(),
+				Data:    ConsentDetails{Document: c.document(), Version: c.Version, Accepted: accepted},
+			})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (c *Consent) exempt(p string) bool {
+	for _, prefix := range c.Exempt {
+		if strings.HasPrefix(p, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Accept records the user of r accepting the current version, with the request's address and
+// user agent
+func (c *Consent) Accept(r *http.Request, user string) (ConsentEvent, error) {
+	e := ConsentEvent{
+		User:       user,
+		Document:   c.document(),
+		Version:    c.Version,
+		AcceptedAt: time.Now().UTC(),
+		UserAgent:  r.UserAgent(),
+	}
+	if ip := requestClientIP(r, c.TrustedProxies); ip != nil {
+		e.IP = ip.String()
+	}
+	return e, c.Provider.RecordAcceptance(r.Context(), e)
+}
+
+// AcceptHandler records acceptance of the current version when the user POSTs to it, and
+// responds with the ConsentEvent. Add its path to Exempt.
+func (c *Consent) AcceptHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var t Tools
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			_ = t.ErrorJSON(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+			return
+		}
+
+		var user string
+		if c.User != nil {
+			user = c.User(r)
+		}
+		if user == "" {
+			_ = t.ErrorJSON(w, errors.New("not signed in"), http.StatusUnauthorized)
+			return
+		}
+
+		e, err := c.Accept(r, user)
+		if err != nil {
+			_ = t.ErrorJSON(w, err, http.StatusServiceUnavailable)
+			return
+		}
+		_ = t.WriteJSON(w, http.StatusOK, e)
+	})
+}
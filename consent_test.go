@@ -0,0 +1,80 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestConsent(t *testing.T) {
+	provider := &MemoryConsentProvider{}
+	c := &Consent{
+		Provider: provider,
+		Version:  "2024-06",
+		User:     func(r *http.Request) string { return r.Header.Get("X-User") },
+		Exempt:   []string{"/terms"},
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/terms/accept", c.AcceptHandler())
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	h := c.Middleware(mux)
+
+	do := func(method, path, user string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if user != "" {
+			req.Header.Set("X-User", user)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	var tests = []struct {
+		name   string
+		method string
+		path   string
+		user   string
+		status int
+	}{
+		{"anonymous", "GET", "/files", "", http.StatusOK},
+		{"not accepted", "GET", "/files", "ana", http.StatusUnavailableForLegalReasons},
+		{"exempt path", "GET", "/terms", "ana", http.StatusOK},
+		{"accept needs post", "GET", "/terms/accept", "ana", http.StatusMethodNotAllowed},
+		{"accept", "POST", "/terms/accept", "ana", http.StatusOK},
+		{"accepted", "GET", "/files", "ana", http.StatusOK},
+		{"other user", "GET", "/files", "ben", http.StatusUnavailableForLegalReasons},
+	}
+
+	for _, e := range tests {
+		rr := do(e.method, e.path, e.user)
+		if rr.Code != e.status {
+			t.Errorf("%s: expected %d but got %d", e.name, e.status, rr.Code)
+		}
+	}
+
+	// a new version has to be accepted again
+	c.Version = "2025-01"
+	c.Status = http.StatusConflict
+	rr := do("GET", "/files", "ana")
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 after the version changed, got %d", rr.Code)
+	}
+	var resp struct {
+		Data ConsentDetails `json:"data"`
+	}
+	_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+	if resp.Data != (ConsentDetails{Document: "terms", Version: "2025-01", Accepted: "2024-06"}) {
+		t.Errorf("unexpected details %+v", resp.Data)
+	}
+
+	do("POST", "/terms/accept", "ana")
+	if rr = do("GET", "/files", "ana"); rr.Code != http.StatusOK {
+		t.Errorf("expected 200 after accepting again, got %d", rr.Code)
+	}
+	events := provider.Events("ana")
+	if len(events) != 2 || events[1].Version != "2025-01" || events[1].IP != "192.0.2.1" {
+		t.Errorf("unexpected acceptance history %+v", events)
+	}
+}
@@ -0,0 +1,129 @@
+package toolkit
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RequestTimeoutHeader carries a request's time budget to downstream services, in seconds
+const RequestTimeoutHeader = "X-Request-Timeout"
+
+type budgetMarginKey struct{}
+
+// DeadlineBudget gives each request a deadline, from the client's RequestTimeoutHeader or a
+// default, so outbound calls made with its context through CallJSONContext,
+// PushJSONToRemoteContext or BudgetTransport stop slightly before it does, leaving time to
+// answer the client rather than outliving it
+type DeadlineBudget struct {
+	// Default is the budget of requests without the header. Zero leaves them unbounded
+	Default time.Duration
+	// Max caps the budgets clients ask for. Zero allows any
+	Max time.Duration
+	// Margin is held back from outbound calls. Defaults to a tenth of the remaining time, at
+	// most one second
+	Margin time.Duration
+}
+
+// Middleware sets the deadline of the requests to next
+func (b *DeadlineBudget) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		budget := b.Default
+		if v := r.Header.Get(RequestTimeoutHeader); v != "" {
+			if seconds, err := strconv.ParseFloat(v, 64); err == nil && seconds > 0 {
+				budget = time.Duration(seconds * float64(time.Second))
+			}
+		}
+		if b.Max > 0 && (budget <= 0 || budget > b.Max) {
+			budget = b.Max
+		}
+
+		ctx := r.Context()
+		if b.Margin > 0 {
+			ctx = context.WithValue(ctx, budgetMarginKey{}, b.Margin)
+		}
+		if budget > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, budget)
+			defer cancel()
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Remaining returns the time left before ctx's deadline, and false if it has none
+func Remaining(ctx context.Context) (time.Duration, bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, false
+	}
+	return time.Until(deadline), true
+}
+
+// OutboundContext returns a context for a call made while handling a request with ctx, whose
+// deadline is the request's less the margin. Without a deadline, ctx is returned as it is.
+func OutboundContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	remaining, ok := Remaining(ctx)
+	if !ok {
+		return ctx, func() {}
+	}
+	margin, ok := ctx.Value(budgetMarginKey{}).(time.Duration)
+	if !ok {
+		margin = remaining / 10
+		if margin > time.Second {
+			margin = time.Second
+		}
+	}
+	return context.WithTimeout(ctx, remaining-margin)
+}
+
+// setTimeoutHeader passes the remaining budget of a request's context to the server
+func setTimeoutHeader(req *http.Request) {
+	if remaining, ok := Remaining(req.Context()); ok && remaining > 0 && req.Header.Get(RequestTimeoutHeader) == "" {
+		req.Header.Set(RequestTimeoutHeader, strconv.FormatFloat(remaining.Seconds(), 'f', 3, 64))
+	}
+}
+
+// BudgetTransport applies OutboundContext to the requests it sends, and tells the server their
+// remaining budget in RequestTimeoutHeader, for clients other than CallJSONContext
+type BudgetTransport struct {
+	// Base defaults to http.DefaultTransport
+	Base http.RoundTripper
+}
+
+// RoundTrip sends a request within the budget of its context
+func (bt *BudgetTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := bt.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if _, ok := Remaining(req.Context()); !ok {
+		return base.RoundTrip(req)
+	}
+
+	ctx, cancel := OutboundContext(req.Context())
+	// a RoundTripper must not modify the caller's request
+	out := req.Clone(ctx)
+	setTimeoutHeader(out)
+	res, err := base.RoundTrip(out)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	// the context must outlive the round trip, until the body is read
+	res.Body = &cancelOnClose{ReadCloser: res.Body, cancel: cancel}
+	return res, nil
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
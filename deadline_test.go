@@ -0,0 +1,154 @@
+package toolkit
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeadlineBudget_Middleware(t *testing.T) {
+	var tests = []struct {
+		name      string
+		budget    DeadlineBudget
+		header    string
+		want      time.Duration
+		hasBudget bool
+	}{
+		{name: "none", hasBudget: false},
+		{name: "default", budget: DeadlineBudget{Default: 2 * time.Second}, want: 2 * time.Second, hasBudget: true},
+		{name: "header", budget: DeadlineBudget{Default: 2 * time.Second}, header: "0.5", want: 500 * time.Millisecond, hasBudget: true},
+		{name: "capped", budget: DeadlineBudget{Max: time.Second}, header: "30", want: time.Second, hasBudget: true},
+		{name: "max without header", budget: DeadlineBudget{Max: time.Second}, want: time.Second, hasBudget: true},
+		{name: "invalid header", budget: DeadlineBudget{Default: 2 * time.Second}, header: "soon", want: 2 * time.Second, hasBudget: true},
+	}
+
+	for _, e := range tests {
+		var remaining time.Duration
+		var ok bool
+		handler := e.budget.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			remaining, ok = Remaining(r.Context())
+		}))
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if e.header != "" {
+			req.Header.Set(RequestTimeoutHeader, e.header)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		if ok != e.hasBudget {
+			t.Errorf("%s: expected deadline %v, got %v", e.name, e.hasBudget, ok)
+			continue
+		}
+		if ok && (remaining > e.want || remaining < e.want-100*time.Millisecond) {
+			t.Errorf("%s: expected about %s remaining, got %s", e.name, e.want, remaining)
+		}
+	}
+}
+
+func TestOutboundContext(t *testing.T) {
+	ctx, cancel := OutboundContext(context.Background())
+	defer cancel()
+	if _, ok := ctx.Deadline(); ok {
+		t.Error("expected no deadline without an inbound one")
+	}
+
+	var tests = []struct {
+		name    string
+		inbound time.Duration
+		margin  time.Duration
+		want    time.Duration
+	}{
+		{name: "tenth", inbound: 2 * time.Second, want: 1800 * time.Millisecond},
+		{name: "at most a second", inbound: 30 * time.Second, want: 29 * time.Second},
+		{name: "margin", inbound: 2 * time.Second, margin: 500 * time.Millisecond, want: 1500 * time.Millisecond},
+	}
+
+	for _, e := range tests {
+		parent := context.Background()
+		if e.margin > 0 {
+			parent = context.WithValue(parent, budgetMarginKey{}, e.margin)
+		}
+		inbound, cancelInbound := context.WithTimeout(parent, e.inbound)
+		ctx, cancel := OutboundContext(inbound)
+		remaining, ok := Remaining(ctx)
+		cancel()
+		cancelInbound()
+
+		if !ok || remaining > e.want || remaining < e.want-100*time.Millisecond {
+			t.Errorf("%s: expected about %s remaining, got %s", e.name, e.want, remaining)
+		}
+	}
+}
+
+func TestTools_CallJSONContext_budget(t *testing.T) {
+	var sent string
+	var remaining time.Duration
+	client := NewTestClient(func(req *http.Request) *http.Response {
+		sent = req.Header.Get(RequestTimeoutHeader)
+		remaining, _ = Remaining(req.Context())
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(`{}`)), Header: make(http.Header)}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var tools Tools
+	if _, err := tools.CallJSONContext(ctx, client, http.MethodGet, "http://example.com/", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if remaining > 900*time.Millisecond {
+		t.Errorf("expected the call to stop before the request, got %s remaining", remaining)
+	}
+	seconds, err := strconv.ParseFloat(sent, 64)
+	if err != nil || seconds <= 0 || seconds > 0.9 {
+		t.Errorf("expected the remaining budget in the header, got %q", sent)
+	}
+
+	sent = ""
+	if _, err := tools.PushJSONToRemoteContext(ctx, client, "http://example.com/", map[string]string{"a": "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if sent == "" {
+		t.Error("expected PushJSONToRemoteContext to send the budget")
+	}
+
+	sent = ""
+	if _, err := tools.CallJSON(client, http.MethodGet, "http://example.com/", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if sent != "" {
+		t.Errorf("expected no budget without a deadline, got %q", sent)
+	}
+}
+
+func TestBudgetTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.Header.Get(RequestTimeoutHeader))
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: &BudgetTransport{}}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Header.Get(RequestTimeoutHeader) != "" {
+		t.Error("expected the caller's request to be left alone")
+	}
+	if seconds, err := strconv.ParseFloat(string(body), 64); err != nil || seconds <= 0 || seconds > 0.9 {
+		t.Errorf("expected the server to get the remaining budget, got %q", body)
+	}
+}
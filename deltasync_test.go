@@ -0,0 +1,90 @@
+package toolkit
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestDeltaSync(t *testing.T) {
+	log := []string{"a", "b", "c", "d", "e"}
+	ds := &DeltaSync[string]{
+		Key:      []byte("0123456789abcdef0123456789abcdef"),
+		PageSize: 2,
+		Scope:    func(r *http.Request) string { return r.Header.Get("X-User") },
+		ChangesSince: func(_ context.Context, cursor string, limit int) (Changes[string], error) {
+			pos := 0
+			if cursor != "" {
+				pos, _ = strconv.Atoi(cursor)
+			}
+			end := pos + limit
+			if end > len(log) {
+				end = len(log)
+			}
+			return Changes[string]{Items: log[pos:end], Cursor: strconv.Itoa(end), More: end < len(log)}, nil
+		},
+	}
+
+	get := func(token, user string) (*httptest.ResponseRecorder, SyncResponse[string]) {
+		req := httptest.NewRequest(http.MethodGet, "/sync?token="+token, nil)
+		req.Header.Set("X-User", user)
+		rr := httptest.NewRecorder()
+		ds.ServeHTTP(rr, req)
+
+		var resp SyncResponse[string]
+		_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+		return rr, resp
+	}
+
+	var synced []string
+	token := ""
+	for i := 0; i < 5; i++ {
+		rr, resp := get(token, "jo")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("unexpected status %d: %s", rr.Code, rr.Body.String())
+		}
+		synced = append(synced, resp.Items...)
+		token = resp.Token
+		if !resp.More {
+			break
+		}
+	}
+	if len(synced) != len(log) {
+		t.Errorf("expected %v, got %v", log, synced)
+	}
+
+	if rr, resp := get(token, "jo"); rr.Code != http.StatusOK || len(resp.Items) != 0 {
+		t.Errorf("expected no changes, got %d %s", rr.Code, rr.Body.String())
+	}
+	if rr, _ := get(token, "al"); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected a token for another user to be refused, got %d", rr.Code)
+	}
+	if rr, _ := get(token+"x", "jo"); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected a tampered token to be refused, got %d", rr.Code)
+	}
+}
+
+func TestDeltaSync_ExpiredToken(t *testing.T) {
+	ds := &DeltaSync[string]{Key: []byte("0123456789abcdef0123456789abcdef")}
+
+	token, _ := ds.IssueToken("5", "")
+	if cursor, err := ds.ParseToken(token, ""); err != nil || cursor != "5" {
+		t.Errorf("expected cursor 5, got %q %v", cursor, err)
+	}
+
+	payload, _ := json.Marshal(changeToken{Cursor: "5", Expires: time.Now().Add(-time.Minute).Unix()})
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	expired := encoded + "." + ds.sign(encoded)
+
+	req := httptest.NewRequest(http.MethodGet, "/sync?token="+expired, nil)
+	rr := httptest.NewRecorder()
+	ds.ServeHTTP(rr, req)
+	if rr.Code != http.StatusGone {
+		t.Errorf("expected 410 for an expired token, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,131 @@
+package toolkit
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Deprecation marks routes as deprecated. Its middleware sends the Deprecation, Sunset and
+// Link headers, counts how often each consumer still calls the routes, and can add a warning
+// to enveloped JSON responses.
+type Deprecation struct {
+	// Since is when the route was deprecated. If zero, the Deprecation header is "true"
+	Since time.Time
+	// Sunset is when the route will stop working. Optional
+	Sunset time.Time
+	// Link is a page describing the deprecation and how to migrate
+	Link string
+	// Successor is the URL of the route which replaces this one
+	Successor string
+	// Warning, if set, is added to JSON responses written in envelope form
+	Warning string
+	// Consumer identifies who made a request once it has been authenticated, for usage counts.
+	// Usage exposes them, so it must return an identifier such as an account ID, and not a
+	// secret such as an API key. Defaults to the user ID in the request's context, set by
+	// RequestContext
+	Consumer func(r *http.Request) string
+	// MaxConsumers is the number of consumers counted; calls by any more are counted as
+	// "other". Defaults to 1000
+	MaxConsumers int
+
+	mu    sync.Mutex
+	usage map[string]int64
+}
+
+// Middleware marks every response of next as deprecated
+func (d *Deprecation) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if d.Since.IsZero() {
+			w.Header().Set("Deprecation", "true")
+		} else {
+			w.Header().Set("Deprecation", "@"+strconv.FormatInt(d.Since.Unix(), 10))
+		}
+		if !d.Sunset.IsZero() {
+			w.Header().Set("Sunset", d.Sunset.UTC().Format(http.TimeFormat))
+		}
+		if d.Link != "" {
+			w.Header().Add("Link", "<"+d.Link+`>; rel="deprecation"`)
+		}
+		if d.Successor != "" {
+			w.Header().Add("Link", "<"+d.Successor+`>; rel="successor-version"`)
+		}
+
+		d.count(r)
+
+		if d.Warning != "" {
+			w = &warningWriter{ResponseWriter: w, warning: d.Warning}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (d *Deprecation) count(r *http.Request) {
+	consumer, _ := UserIDFromContext(r.Context())
+	if d.Consumer != nil {
+		consumer = d.Consumer(r)
+	}
+	if consumer == "" {
+		consumer = "anonymous"
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.usage == nil {
+		d.usage = make(map[string]int64)
+	}
+	maxConsumers := d.MaxConsumers
+	if maxConsumers <= 0 {
+		maxConsumers = 1000
+	}
+	if _, ok := d.usage[consumer]; !ok && len(d.usage) >= maxConsumers {
+		consumer = "other"
+	}
+	d.usage[consumer]++
+}
+
+// Usage returns the number of calls made to the deprecated routes by each consumer
+func (d *Deprecation) Usage() map[string]int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	usage := make(map[string]int64, len(d.usage))
+	for k, v := range d.usage {
+		usage[k] = v
+	}
+	return usage
+}
+
+// warningWriter carries a warning for WriteJSON to add to the envelope
+type warningWriter struct {
+	http.ResponseWriter
+	warning string
+}
+
+// Flush implements http.Flusher when the underlying writer does
+func (ww *warningWriter) Flush() {
+	if f, ok := ww.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer
+func (ww *warningWriter) Unwrap() http.ResponseWriter {
+	return ww.ResponseWriter
+}
+
+// responseWarning returns the warning for the response being written to w, if any
+func responseWarning(w http.ResponseWriter) string {
+	for {
+		switch v := w.(type) {
+		case *warningWriter:
+			return v.warning
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = v.Unwrap()
+		default:
+			return ""
+		}
+	}
+}
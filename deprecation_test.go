@@ -0,0 +1,108 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDeprecation_Middleware(t *testing.T) {
+	d := &Deprecation{
+		Since:     time.Unix(1700000000, 0),
+		Sunset:    time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+		Link:      "https://example.com/docs/migrate",
+		Successor: "/v2/users",
+		Warning:   "this endpoint is deprecated",
+	}
+
+	testTools := Tools{ResponseMode: ResponseEnvelope}
+	handler := d.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = testTools.WriteJSON(w, http.StatusOK, []string{"ada"})
+	}))
+
+	for _, key := range []string{"key-1", "key-1", "key-2", ""} {
+		req := httptest.NewRequest("GET", "/v1/users", nil)
+		if key != "" {
+			req = req.WithContext(ContextWithUserID(req.Context(), key))
+		}
+		// the secret key is never used as the consumer's name
+		req.Header.Set("X-API-Key", "secret")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Header().Get("Deprecation") != "@1700000000" {
+			t.Errorf("unexpected Deprecation header %q", rr.Header().Get("Deprecation"))
+		}
+		if rr.Header().Get("Sunset") != "Tue, 01 Jan 2030 00:00:00 GMT" {
+			t.Errorf("unexpected Sunset header %q", rr.Header().Get("Sunset"))
+		}
+		if links := rr.Header().Values("Link"); len(links) != 2 || links[0] != `<https://example.com/docs/migrate>; rel="deprecation"` {
+			t.Errorf("unexpected Link headers %v", links)
+		}
+
+		var resp JSONResponse
+		_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+		if resp.Warning != d.Warning {
+			t.Errorf("expected warning in envelope, got %s", rr.Body.String())
+		}
+	}
+
+	usage := d.Usage()
+	if usage["key-1"] != 2 || usage["key-2"] != 1 || usage["anonymous"] != 1 {
+		t.Errorf("unexpected usage %v", usage)
+	}
+}
+
+func TestDeprecation_BareResponse(t *testing.T) {
+	d := &Deprecation{Warning: "deprecated"}
+
+	var testTools Tools
+	rr := httptest.NewRecorder()
+	d.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = testTools.WriteJSON(w, http.StatusOK, map[string]int{"n": 1})
+	})).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+
+	if rr.Header().Get("Deprecation") != "true" {
+		t.Errorf("unexpected Deprecation header %q", rr.Header().Get("Deprecation"))
+	}
+	if rr.Body.String() != `{"n":1}` {
+		t.Errorf("bare responses should not be changed, got %s", rr.Body.String())
+	}
+}
+
+func TestDeprecation_EnvelopePointer(t *testing.T) {
+	d := &Deprecation{Warning: "deprecated"}
+
+	var testTools Tools
+	env := &JSONResponse{Message: "ok"}
+	rr := httptest.NewRecorder()
+	d.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = testTools.WriteJSON(w, http.StatusOK, env)
+	})).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+
+	var resp JSONResponse
+	_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+	if resp.Warning != "deprecated" || resp.Message != "ok" {
+		t.Errorf("expected the warning in a *JSONResponse, got %s", rr.Body.String())
+	}
+	if env.Warning != "" {
+		t.Error("the handler's response was changed")
+	}
+}
+
+func TestDeprecation_MaxConsumers(t *testing.T) {
+	d := &Deprecation{MaxConsumers: 2}
+	handler := d.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, key := range []string{"a", "b", "c", "d", "a"} {
+		req := httptest.NewRequest("GET", "/", nil)
+		handler.ServeHTTP(httptest.NewRecorder(), req.WithContext(ContextWithUserID(req.Context(), key)))
+	}
+
+	usage := d.Usage()
+	if len(usage) != 3 || usage["a"] != 2 || usage["b"] != 1 || usage["other"] != 2 {
+		t.Errorf("unexpected usage %v", usage)
+	}
+}
@@ -0,0 +1,169 @@
+package toolkit
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Change is a single field-level difference between two values
+type Change struct {
+	Field string `json:"field"`
+	Old   any    `json:"old"`
+	New   any    `json:"new"`
+}
+
+// Diff compares two values of the same type, typically a record before and after an update
+// decoded with ReadJSON, and returns the changed fields. Field names follow json tags, and
+// nested fields are joined with dots, e.g. "address.city". Values of fields covered by the
+// redactor are reported as changed, but masked.
+func Diff(old, new any, redactor *Redactor) ([]Change, error) {
+	ov, nv := reflect.ValueOf(old), reflect.ValueOf(new)
+	if !ov.IsValid() || !nv.IsValid() {
+		return nil, errors.New("diff: values must not be nil")
+	}
+	if ov.Type() != nv.Type() {
+		return nil, fmt.Errorf("diff: cannot compare %s with %s", ov.Type(), nv.Type())
+	}
+
+	var changes []Change
+	diffValue("", ov, nv, redactor, &changes)
+	return changes, nil
+}
+
+func diffValue(field string, ov, nv reflect.Value, redactor *Redactor, changes *[]Change) {
+	// dereference pointers, treating a nil pointer as a change if the other side is set
+	for ov.Kind() == reflect.Ptr || ov.Kind() == reflect.Interface {
+		if ov.IsNil() || nv.IsNil() {
+			if ov.IsNil() != nv.IsNil() {
+				addChange(field, ov, nv, redactor, changes)
+			}
+			return
+		}
+		ov, nv = ov.Elem(), nv.Elem()
+		if ov.Type() != nv.Type() {
+			addChange(field, ov, nv, redactor, changes)
+			return
+		}
+	}
+
+	switch ov.Kind() {
+	case reflect.Struct:
+		if ov.Type().NumField() == 0 || !hasExportedFields(ov.Type()) {
+			if !reflect.DeepEqual(ov.Interface(), nv.Interface()) {
+				addChange(field, ov, nv, redactor, changes)
+			}
+			return
+		}
+		diffStruct(field, ov, nv, redactor, changes)
+	case reflect.Map:
+		if ov.Type().Key().Kind() != reflect.String {
+			if !reflect.DeepEqual(ov.Interface(), nv.Interface()) {
+				addChange(field, ov, nv, redactor, changes)
+			}
+			return
+		}
+		diffMap(field, ov, nv, redactor, changes)
+	default:
+		if !reflect.DeepEqual(valueOrNil(ov), valueOrNil(nv)) {
+			addChange(field, ov, nv, redactor, changes)
+		}
+	}
+}
+
+func diffStruct(prefix string, ov, nv reflect.Value, redactor *Redactor, changes *[]Change) {
+	for _, f := range TypeFields(ov.Type()) {
+		if f.Embedded {
+			diffValue(prefix, ov.Field(f.Index), nv.Field(f.Index), redactor, changes)
+			continue
+		}
+
+		field := joinField(prefix, f.JSONName)
+		if redactor.IsRedacted(f.JSONName) {
+			if !reflect.DeepEqual(ov.Field(f.Index).Interface(), nv.Field(f.Index).Interface()) {
+				mask := redactor.mask()
+				*changes = append(*changes, Change{Field: field, Old: mask, New: mask})
+			}
+			continue
+		}
+		diffValue(field, ov.Field(f.Index), nv.Field(f.Index), redactor, changes)
+	}
+}
+
+func diffMap(prefix string, ov, nv reflect.Value, redactor *Redactor, changes *[]Change) {
+	keys := make(map[string]reflect.Value)
+	for _, k := range ov.MapKeys() {
+		keys[k.String()] = k
+	}
+	for _, k := range nv.MapKeys() {
+		keys[k.String()] = k
+	}
+
+	names := make([]string, 0, len(keys))
+	for name := range keys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		field := joinField(prefix, name)
+		o, n := ov.MapIndex(keys[name]), nv.MapIndex(keys[name])
+
+		if !o.IsValid() || !n.IsValid() {
+			addChange(field, o, n, redactor, changes)
+			continue
+		}
+		if redactor.IsRedacted(name) {
+			if !reflect.DeepEqual(o.Interface(), n.Interface()) {
+				mask := redactor.mask()
+				*changes = append(*changes, Change{Field: field, Old: mask, New: mask})
+			}
+			continue
+		}
+		diffValue(field, o, n, redactor, changes)
+	}
+}
+
+func addChange(field string, ov, nv reflect.Value, redactor *Redactor, changes *[]Change) {
+	*changes = append(*changes, Change{
+		Field: field,
+		Old:   redactor.RedactValue(valueOrNil(ov)),
+		New:   redactor.RedactValue(valueOrNil(nv)),
+	})
+}
+
+// jsonFieldName returns the name given to a struct field by its json tag, and whether
+// the field is excluded from json entirely
+func jsonFieldName(sf reflect.StructField) (string, bool) {
+	tag := sf.Tag.Get("json")
+	if tag == "-" {
+		return "", true
+	}
+	name, _, _ := strings.Cut(tag, ",")
+	return name, false
+}
+
+func hasExportedFields(typ reflect.Type) bool {
+	for i := 0; i < typ.NumField(); i++ {
+		if typ.Field(i).PkgPath == "" {
+			return true
+		}
+	}
+	return false
+}
+
+func joinField(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+func valueOrNil(v reflect.Value) any {
+	if !v.IsValid() || !v.CanInterface() {
+		return nil
+	}
+	return v.Interface()
+}
@@ -0,0 +1,96 @@
+package toolkit
+
+import (
+	"testing"
+)
+
+type diffAddress struct {
+	City string `json:"city"`
+	Zip  string `json:"zip"`
+}
+
+type diffAudit struct {
+	Version int `json:"version"`
+}
+
+type diffUser struct {
+	diffAudit
+	Name     string            `json:"name"`
+	Email    string            `json:"email"`
+	Password string            `json:"password"`
+	Internal string            `json:"-"`
+	Address  *diffAddress      `json:"address"`
+	Tags     []string          `json:"tags"`
+	Meta     map[string]string `json:"meta"`
+}
+
+func TestDiff(t *testing.T) {
+	old := diffUser{
+		diffAudit: diffAudit{Version: 1},
+		Name:      "Jack",
+		Email:     "jack@example.com",
+		Password:  "old",
+		Internal:  "a",
+		Address:   &diffAddress{City: "Boston", Zip: "02101"},
+		Tags:      []string{"a"},
+		Meta:      map[string]string{"source": "web"},
+	}
+	updated := old
+	updated.Version = 2
+	updated.Email = "jack@example.org"
+	updated.Password = "new"
+	updated.Internal = "b"
+	updated.Address = &diffAddress{City: "Denver", Zip: "02101"}
+	updated.Tags = []string{"a", "b"}
+	updated.Meta = map[string]string{"source": "web", "campaign": "fall"}
+
+	changes, err := Diff(old, updated, &Redactor{Fields: []string{"password"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string][2]any{
+		"version":       {1, 2},
+		"email":         {"jack@example.com", "jack@example.org"},
+		"password":      {defaultRedactMask, defaultRedactMask},
+		"address.city":  {"Boston", "Denver"},
+		"meta.campaign": {nil, "fall"},
+	}
+
+	found := make(map[string]bool)
+	for _, c := range changes {
+		found[c.Field] = true
+		if c.Field == "tags" {
+			continue
+		}
+		want, ok := expected[c.Field]
+		if !ok {
+			t.Errorf("unexpected change to %s", c.Field)
+			continue
+		}
+		if c.Old != want[0] || c.New != want[1] {
+			t.Errorf("%s: expected %v -> %v, got %v -> %v", c.Field, want[0], want[1], c.Old, c.New)
+		}
+	}
+
+	for field := range expected {
+		if !found[field] {
+			t.Errorf("expected a change to %s", field)
+		}
+	}
+	if !found["tags"] {
+		t.Error("expected a change to tags")
+	}
+
+	// unchanged values produce no changes
+	changes, _ = Diff(old, old, nil)
+	if len(changes) != 0 {
+		t.Error("expected no changes, got", changes)
+	}
+
+	// different types cannot be compared
+	_, err = Diff(old, diffAddress{}, nil)
+	if err == nil {
+		t.Error("expected an error comparing different types")
+	}
+}
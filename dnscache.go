@@ -0,0 +1,228 @@
+package toolkit
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/kaliadmen/toolkit/concurrency"
+)
+
+// DNSCache caches host lookups for outbound connections, so high-rate calls such as webhook
+// deliveries don't resolve the same host for every connection, and dials each address family
+// in turn, racing the second after FallbackDelay, so a host with broken IPv6 doesn't stall
+// them. Use its DialContext in an http.Transport:
+//
+//	transport := &http.Transport{DialContext: cache.DialContext}
+type DNSCache struct {
+	// TTL is how long lookups are cached. The standard resolver doesn't report the records'
+	// TTLs, so this should be no longer than the shortest of the hosts'. Defaults to one minute
+	TTL time.Duration
+	// StaleTTL is how long past its TTL an entry is still used when a new lookup fails.
+	// Defaults to zero, so failed lookups fail the dial
+	StaleTTL time.Duration
+	// FallbackDelay is how long the first address family is tried alone before the other is
+	// raced against it. Defaults to 300ms; a negative value dials them one after the other
+	FallbackDelay time.Duration
+	// PreferIPv4 tries IPv4 addresses first, instead of the resolver's order
+	PreferIPv4 bool
+	// Dialer makes the connections. Defaults to a dialer with a 30 second timeout
+	Dialer *net.Dialer
+	// Lookup resolves a host. Defaults to net.DefaultResolver.LookupIPAddr
+	Lookup func(ctx context.Context, host string) ([]net.IPAddr, error)
+
+	mu      sync.Mutex
+	entries map[string]dnsEntry
+	lookups concurrency.Group[string, []net.IPAddr]
+}
+
+type dnsEntry struct {
+	addrs   []net.IPAddr
+	expires time.Time
+}
+
+func (c *DNSCache) ttl() time.Duration {
+	if c.TTL > 0 {
+		return c.TTL
+	}
+	return time.Minute
+}
+
+// LookupIPAddr returns the addresses of host, from the cache while they are fresh. Concurrent
+// lookups of a host share a single query.
+func (c *DNSCache) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IPAddr{{IP: ip}}, nil
+	}
+
+	c.mu.Lock()
+	entry, ok := c.entries[host]
+	c.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.addrs, nil
+	}
+
+	addrs, err, _ := c.lookups.DoContext(ctx, host, func() ([]net.IPAddr, error) {
+		lookup := c.Lookup
+		if lookup == nil {
+			lookup = net.DefaultResolver.LookupIPAddr
+		}
+		addrs, err := lookup(ctx, host)
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.entries == nil {
+			c.entries = make(map[string]dnsEntry)
+		}
+		now := time.Now()
+		switch {
+		case err == nil:
+			c.entries[host] = dnsEntry{addrs: addrs, expires: now.Add(c.ttl())}
+		case ok && now.Before(entry.expires.Add(c.StaleTTL)):
+			addrs, err = entry.addrs, nil
+		default:
+			// the next lookup tries again
+			delete(c.entries, host)
+		}
+		return addrs, err
+	})
+	return addrs, err
+}
+
+// Flush forgets the cached lookups
+func (c *DNSCache) Flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = nil
+}
+
+// DialContext connects to addr through the cache, for http.Transport.DialContext
+func (c *DNSCache) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := c.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	var primaries, fallbacks []string
+	for _, ip := range ips {
+		switch {
+		case network == "tcp4" && ip.IP.To4() == nil, network == "tcp6" && ip.IP.To4() != nil:
+			continue
+		}
+		a := net.JoinHostPort(ip.String(), port)
+		if len(primaries) == 0 || isIPv4(ip.IP) == isIPv4(ips[0].IP) {
+			primaries = append(primaries, a)
+		} else {
+			fallbacks = append(fallbacks, a)
+		}
+	}
+	if len(primaries) == 0 {
+		return nil, &net.AddrError{Err: "no suitable address found", Addr: host}
+	}
+	if c.PreferIPv4 && len(fallbacks) > 0 && !isIPv4(ips[0].IP) {
+		primaries, fallbacks = fallbacks, primaries
+	}
+
+	dialer := c.Dialer
+	if dialer == nil {
+		dialer = &net.Dialer{Timeout: 30 * time.Second}
+	}
+	delay := c.FallbackDelay
+	if delay == 0 {
+		delay = 300 * time.Millisecond
+	}
+	if delay < 0 || len(fallbacks) == 0 {
+		return dialSerial(ctx, dialer, network, append(primaries, fallbacks...))
+	}
+	return dialParallel(ctx, dialer, network, primaries, fallbacks, delay)
+}
+
+func isIPv4(ip net.IP) bool {
+	return ip.To4() != nil
+}
+
+// dialSerial tries the addresses in turn, returning the first error if none connect
+func dialSerial(ctx context.Context, dialer *net.Dialer, network string, addrs []string) (net.Conn, error) {
+	var first error
+	for _, a := range addrs {
+		conn, err := dialer.DialContext(ctx, network, a)
+		if err == nil {
+			return conn, nil
+		}
+		if first == nil {
+			first = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, first
+}
+
+// dialParallel races the fallback addresses against the primaries once delay has passed, or
+// the primaries have failed, as in RFC 8305
+func dialParallel(ctx context.Context, dialer *net.Dialer, network string, primaries, fallbacks []string, delay time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		conn    net.Conn
+		err     error
+		primary bool
+	}
+	results := make(chan result, 2)
+	race := func(addrs []string, primary bool) {
+		conn, err := dialSerial(ctx, dialer, network, addrs)
+		results <- result{conn: conn, err: err, primary: primary}
+	}
+
+	go race(primaries, true)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	var primaryErr error
+	fallbackStarted, pending := false, 1
+	for {
+		select {
+		case <-timer.C:
+			if !fallbackStarted {
+				fallbackStarted = true
+				pending++
+				go race(fallbacks, false)
+			}
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				// close the loser, if it connects after all
+				go func(n int) {
+					for ; n > 0; n-- {
+						if late := <-results; late.conn != nil {
+							late.conn.Close()
+						}
+					}
+				}(pending)
+				return r.conn, nil
+			}
+			if r.primary {
+				primaryErr = r.err
+			}
+			if !fallbackStarted {
+				fallbackStarted = true
+				pending++
+				go race(fallbacks, false)
+				continue
+			}
+			if pending == 0 {
+				if primaryErr != nil {
+					return nil, primaryErr
+				}
+				return nil, r.err
+			}
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDNSCache_LookupIPAddr(t *testing.T) {
+	var mu sync.Mutex
+	lookups := 0
+	var fail bool
+	c := &DNSCache{
+		TTL:      50 * time.Millisecond,
+		StaleTTL: time.Second,
+		Lookup: func(ctx context.Context, host string) ([]net.IPAddr, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			lookups++
+			if fail {
+				return nil, errors.New("no such host")
+			}
+			time.Sleep(10 * time.Millisecond)
+			return []net.IPAddr{{IP: net.ParseIP("192.0.2.1")}}, nil
+		},
+	}
+	count := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return lookups
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if addrs, err := c.LookupIPAddr(context.Background(), "api.example.com"); err != nil || len(addrs) != 1 {
+				t.Errorf("expected an address, got %v %v", addrs, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := count(); n != 1 {
+		t.Errorf("expected concurrent lookups to share one query, got %d", n)
+	}
+
+	if _, err := c.LookupIPAddr(context.Background(), "192.0.2.9"); err != nil || count() != 1 {
+		t.Error("expected IP addresses not to be looked up")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	mu.Lock()
+	fail = true
+	mu.Unlock()
+	if addrs, err := c.LookupIPAddr(context.Background(), "api.example.com"); err != nil || len(addrs) != 1 {
+		t.Errorf("expected the stale entry after a failed lookup, got %v %v", addrs, err)
+	}
+	if n := count(); n != 2 {
+		t.Errorf("expected an expired entry to be looked up again, got %d lookups", n)
+	}
+
+	c.Flush()
+	if _, err := c.LookupIPAddr(context.Background(), "api.example.com"); err == nil {
+		t.Error("expected a failed lookup without a stale entry to fail")
+	}
+}
+
+func TestDNSCache_DialContext(t *testing.T) {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+
+	// 100::1 is a discard prefix, standing in for broken IPv6
+	addrs := []net.IPAddr{{IP: net.ParseIP("100::1")}, {IP: net.ParseIP("127.0.0.1")}}
+	lookup := func(ctx context.Context, host string) ([]net.IPAddr, error) { return addrs, nil }
+
+	var tests = []struct {
+		name    string
+		cache   *DNSCache
+		network string
+		wantErr bool
+	}{
+		{name: "fallback", cache: &DNSCache{Lookup: lookup, FallbackDelay: 20 * time.Millisecond}, network: "tcp"},
+		{name: "prefer ipv4", cache: &DNSCache{Lookup: lookup, PreferIPv4: true}, network: "tcp"},
+		{name: "tcp4", cache: &DNSCache{Lookup: lookup}, network: "tcp4"},
+		{name: "tcp6 only", cache: &DNSCache{Lookup: lookup, Dialer: &net.Dialer{Timeout: 50 * time.Millisecond}}, network: "tcp6", wantErr: true},
+	}
+
+	for _, e := range tests {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		start := time.Now()
+		conn, err := e.cache.DialContext(ctx, e.network, net.JoinHostPort("api.example.com", port))
+		cancel()
+		if e.wantErr {
+			if err == nil {
+				conn.Close()
+				t.Errorf("%s: expected an error", e.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", e.name, err)
+			continue
+		}
+		if got := conn.RemoteAddr().String(); got != ln.Addr().String() {
+			t.Errorf("%s: expected to reach %s, got %s", e.name, ln.Addr(), got)
+		}
+		conn.Close()
+		if time.Since(start) > time.Second {
+			t.Errorf("%s: took %s, stalled on the IPv6 address", e.name, time.Since(start))
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package toolkit
+
+import (
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseRange(t *testing.T) {
+	var tests = []struct {
+		header string
+		want   []ByteRange
+		err    bool
+	}{
+		{"", nil, false},
+		{"bytes=0-9", []ByteRange{{0, 10}}, false},
+		{"bytes=90-", []ByteRange{{90, 10}}, false},
+		{"bytes=-5", []ByteRange{{95, 5}}, false},
+		{"bytes=0-0, 50-200", []ByteRange{{0, 1}, {50, 50}}, false},
+		{"bytes=200-300", nil, true},
+		{"bytes=5-1", nil, true},
+		{"items=0-1", nil, true},
+		{"bytes=-0", nil, true},
+		{"bytes=0-,0-,0-,0-", []ByteRange{{0, 100}}, false},
+		{"bytes=50-59,0-9,5-19,20-29", []ByteRange{{0, 30}, {50, 10}}, false},
+	}
+
+	for _, e := range tests {
+		got, err := ParseRange(e.header, 100)
+		if (err != nil) != e.err {
+			t.Errorf("%q: unexpected error %v", e.header, err)
+			continue
+		}
+		if len(got) != len(e.want) {
+			t.Errorf("%q: expected %v, got %v", e.header, e.want, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != e.want[i] {
+				t.Errorf("%q: expected %v, got %v", e.header, e.want, got)
+			}
+		}
+	}
+}
+
+func TestTools_ServeObject(t *testing.T) {
+	dir, err := os.MkdirTemp("", "toolkit-download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := "0123456789abcdefghijklmnopqrstuvwxyz"
+	store := &FileStorage{Dir: dir}
+	_ = store.Put(context.Background(), "video.txt", strings.NewReader(content))
+
+	var testTools Tools
+	serve := func(rangeHeader string, s Storage) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		rr := httptest.NewRecorder()
+		testTools.ServeObject(rr, req, s, "video.txt", "video.txt")
+		return rr
+	}
+
+	rr := serve("", store)
+	if rr.Code != http.StatusOK || rr.Body.String() != content {
+		t.Error("wrong full response", rr.Code, rr.Body.String())
+	}
+	if rr.Header().Get("Content-Disposition") != `attachment; filename="video.txt"` {
+		t.Error("wrong content disposition", rr.Header().Get("Content-Disposition"))
+	}
+
+	rr = serve("bytes=10-15", store)
+	if rr.Code != http.StatusPartialContent || rr.Body.String() != "abcdef" || rr.Header().Get("Content-Range") != "bytes 10-15/36" {
+		t.Error("wrong single range response", rr.Code, rr.Body.String(), rr.Header().Get("Content-Range"))
+	}
+
+	// multiple ranges, through a backend which can't seek
+	for _, s := range []Storage{store, plainStorage{store}} {
+		rr = serve("bytes=0-1, -2", s)
+		if rr.Code != http.StatusPartialContent {
+			t.Fatal("expected 206 for multiple ranges, got", rr.Code)
+		}
+
+		mediaType, params, _ := mime.ParseMediaType(rr.Header().Get("Content-Type"))
+		if mediaType != "multipart/byteranges" {
+			t.Fatal("wrong content type", mediaType)
+		}
+
+		mr := multipart.NewReader(rr.Body, params["boundary"])
+		var parts []string
+		for {
+			p, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, _ := io.ReadAll(p)
+			parts = append(parts, p.Header.Get("Content-Range")+" "+string(b))
+		}
+
+		if len(parts) != 2 || parts[0] != "bytes 0-1/36 01" || parts[1] != "bytes 34-35/36 yz" {
+			t.Error("wrong parts", parts)
+		}
+	}
+
+	rr = serve("bytes=100-", store)
+	if rr.Code != http.StatusRequestedRangeNotSatisfiable || rr.Header().Get("Content-Range") != "bytes */36" {
+		t.Error("expected 416, got", rr.Code, rr.Header().Get("Content-Range"))
+	}
+
+	rr = httptest.NewRecorder()
+	testTools.ServeObject(rr, httptest.NewRequest("GET", "/", nil), store, "missing.txt", "")
+	if rr.Code != http.StatusNotFound {
+		t.Error("expected 404 for a missing object, got", rr.Code)
+	}
+}
@@ -0,0 +1,142 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrDraining is returned (and sent to clients) when work is refused because a drain is in progress
+var ErrDraining = errors.New("server is shutting down")
+
+// DrainState is a snapshot of a Drainer, suitable for health checks and logging
+type DrainState struct {
+	Draining bool      `json:"draining"`
+	InFlight int       `json:"in_flight"`
+	Started  time.Time `json:"started"`
+}
+
+// Drainer coordinates graceful shutdown between middleware and background jobs. While draining,
+// the middleware rejects new requests with a 503, and in-flight requests, uploads and jobs
+// are allowed to finish. The zero value is ready to use.
+type Drainer struct {
+	// RetryAfter, if set, is sent as the Retry-After header on rejected requests
+	RetryAfter time.Duration
+
+	mu       sync.Mutex
+	draining bool
+	started  time.Time
+	inFlight int
+	idle     chan struct{}
+}
+
+// Track registers a unit of work, such as an upload or a job. It returns a release function
+// that must be called when the work is finished, or ErrDraining if a drain has begun.
+func (d *Drainer) Track() (func(), error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.draining {
+		return nil, ErrDraining
+	}
+	d.inFlight++
+
+	var once sync.Once
+	return func() {
+		once.Do(d.release)
+	}, nil
+}
+
+func (d *Drainer) release() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.inFlight--
+	if d.inFlight == 0 && d.idle != nil {
+		close(d.idle)
+		d.idle = nil
+	}
+}
+
+// Go runs fn in a new goroutine, tracked by the drainer. It returns ErrDraining, and does not
+// run fn, if a drain has begun.
+func (d *Drainer) Go(fn func()) error {
+	release, err := d.Track()
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		defer release()
+		fn()
+	}()
+	return nil
+}
+
+// Middleware rejects new requests with a 503 JSON response while draining, and tracks
+// the requests it lets through so that Drain waits for them.
+func (d *Drainer) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		release, err := d.Track()
+		if err != nil {
+			if d.RetryAfter > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(int(d.RetryAfter.Seconds())))
+			}
+			w.Header().Set("Connection", "close")
+			var t Tools
+			_ = t.ErrorJSON(w, err, http.StatusServiceUnavailable)
+			return
+		}
+		defer release()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Drain stops accepting new work and waits until all tracked work has finished, or ctx is done,
+// in which case the context's error is returned. Calling Drain more than once is safe.
+func (d *Drainer) Drain(ctx context.Context) error {
+	d.mu.Lock()
+	if !d.draining {
+		d.draining = true
+		d.started = time.Now()
+	}
+	if d.inFlight == 0 {
+		d.mu.Unlock()
+		return nil
+	}
+	if d.idle == nil {
+		d.idle = make(chan struct{})
+	}
+	idle := d.idle
+	d.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Draining reports whether a drain has begun
+func (d *Drainer) Draining() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.draining
+}
+
+// State returns a snapshot of the drainer's current state
+func (d *Drainer) State() DrainState {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return DrainState{
+		Draining: d.draining,
+		InFlight: d.inFlight,
+		Started:  d.started,
+	}
+}
@@ -0,0 +1,89 @@
+package toolkit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDrainer_Middleware(t *testing.T) {
+	var d Drainer
+	d.RetryAfter = 5 * time.Second
+
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	handler := d.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-finish
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// start a slow request before draining
+	inFlight := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(inFlight, httptest.NewRequest("GET", "/", nil))
+		close(done)
+	}()
+	<-started
+
+	drained := make(chan error)
+	go func() {
+		drained <- d.Drain(context.Background())
+	}()
+
+	// wait for the drain to begin
+	for !d.Draining() {
+		time.Sleep(time.Millisecond)
+	}
+
+	if d.State().InFlight != 1 {
+		t.Error("expected one request in flight, got", d.State().InFlight)
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Error("expected 503 while draining, got", rr.Code)
+	}
+	if rr.Header().Get("Retry-After") != "5" {
+		t.Error("wrong Retry-After header", rr.Header().Get("Retry-After"))
+	}
+
+	close(finish)
+	<-done
+
+	if err := <-drained; err != nil {
+		t.Error("unexpected error draining:", err)
+	}
+	if inFlight.Code != http.StatusOK {
+		t.Error("in-flight request did not complete, got", inFlight.Code)
+	}
+}
+
+func TestDrainer_Drain(t *testing.T) {
+	var d Drainer
+
+	block := make(chan struct{})
+	defer close(block)
+
+	err := d.Go(func() { <-block })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	err = d.Drain(ctx)
+	if err != context.DeadlineExceeded {
+		t.Error("expected deadline exceeded, got", err)
+	}
+
+	err = d.Go(func() {})
+	if err != ErrDraining {
+		t.Error("expected ErrDraining when starting a job during drain, got", err)
+	}
+}
@@ -0,0 +1,174 @@
+package toolkit
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DirectoryWatcher is an IngestSource which polls a directory, such as the home directory of
+// an SFTP account partners drop files into. Files are handed on once they have stopped
+// changing, since SFTP uploads arrive a piece at a time, and are then moved out of the way.
+type DirectoryWatcher struct {
+	Dir string
+	// Interval is how often the directory is polled. Defaults to 10 seconds
+	Interval time.Duration
+	// SettleTime is how long a file's size and modification time must stay the same before it
+	// is picked up. Defaults to 5 seconds
+	SettleTime time.Duration
+	// DoneDir, if set, is where ingested files are moved to. By default they are deleted
+	DoneDir string
+	// FailedDir, if set, is where rejected files are moved to. By default they are left in
+	// place, and retried when they change
+	FailedDir string
+	// ErrorLog receives errors moving files. Defaults to the standard logger
+	ErrorLog *log.Logger
+
+	seen map[string]dropFile
+}
+
+type dropFile struct {
+	size    int64
+	modTime time.Time
+	since   time.Time
+	failed  bool
+}
+
+// Serve implements IngestSource
+func (dw *DirectoryWatcher) Serve(ctx context.Context, handle func(ctx context.Context, name string, r io.Reader) error) error {
+	interval := dw.Interval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := dw.Poll(ctx, handle); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll looks at the directory once, and hands on the files which have settled
+func (dw *DirectoryWatcher) Poll(ctx context.Context, handle func(ctx context.Context, name string, r io.Reader) error) error {
+	settle := dw.SettleTime
+	if settle <= 0 {
+		settle = 5 * time.Second
+	}
+	if dw.seen == nil {
+		dw.seen = make(map[string]dropFile)
+	}
+
+	entries, err := os.ReadDir(dw.Dir)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	present := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || partialUpload(name) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		present[name] = true
+
+		prev, ok := dw.seen[name]
+		if !ok || prev.size != info.Size() || !prev.modTime.Equal(info.ModTime()) {
+			dw.seen[name] = dropFile{size: info.Size(), modTime: info.ModTime(), since: now}
+			continue
+		}
+		if prev.failed || now.Sub(prev.since) < settle {
+			continue
+		}
+
+		if ctx.Err() != nil {
+			return nil
+		}
+		dw.ingest(ctx, name, handle)
+	}
+
+	for name := range dw.seen {
+		if !present[name] {
+			delete(dw.seen, name)
+		}
+	}
+	return nil
+}
+
+func (dw *DirectoryWatcher) ingest(ctx context.Context, name string, handle func(ctx context.Context, name string, r io.Reader) error) {
+	p := filepath.Join(dw.Dir, name)
+	f, err := os.Open(p)
+	if err != nil {
+		dw.logf("opening %s: %v", p, err)
+		return
+	}
+	err = handle(ctx, name, f)
+	f.Close()
+
+	if err != nil {
+		if dw.FailedDir != "" {
+			dw.move(p, dw.FailedDir)
+			return
+		}
+		state := dw.seen[name]
+		state.failed = true
+		dw.seen[name] = state
+		return
+	}
+
+	if dw.DoneDir != "" {
+		dw.move(p, dw.DoneDir)
+		return
+	}
+	if err = os.Remove(p); err != nil {
+		dw.logf("removing %s: %v", p, err)
+	}
+}
+
+func (dw *DirectoryWatcher) move(p, dir string) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		dw.logf("creating %s: %v", dir, err)
+		return
+	}
+	if err := os.Rename(p, filepath.Join(dir, filepath.Base(p))); err != nil {
+		dw.logf("moving %s: %v", p, err)
+	}
+}
+
+func (dw *DirectoryWatcher) logf(format string, args ...any) {
+	if dw.ErrorLog != nil {
+		dw.ErrorLog.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+// partialUpload reports whether a file name is one clients use while an upload is in
+// progress, such as WinSCP's .filepart files
+func partialUpload(name string) bool {
+	if strings.HasPrefix(name, ".") {
+		return true
+	}
+	for _, ext := range []string{".filepart", ".part", ".partial", ".tmp", ".crdownload"} {
+		if strings.HasSuffix(strings.ToLower(name), ext) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,201 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// ErrTooManyParts is returned for an email with more MIME parts, or deeper nesting, than is accepted
+var ErrTooManyParts = errors.New("email has too many parts")
+
+// maxEmailParts and maxEmailDepth bound the work done for a hostile message
+const (
+	maxEmailParts = 200
+	maxEmailDepth = 10
+)
+
+// EmailMessage is an email whose attachments have been ingested
+type EmailMessage struct {
+	From        string            `json:"from"`
+	To          []string          `json:"to"`
+	Subject     string            `json:"subject"`
+	Date        time.Time         `json:"date"`
+	Text        string            `json:"text,omitempty"`
+	HTML        string            `json:"html,omitempty"`
+	Attachments []EmailAttachment `json:"attachments,omitempty"`
+}
+
+// EmailAttachment is an attachment or inline image of an email, and its upload record
+type EmailAttachment struct {
+	UploadedFile
+	ContentType string `json:"content_type"`
+	// ContentID is the part's Content-ID, without angle brackets, which the HTML body refers
+	// to inline images by, as cid:<ContentID>
+	ContentID string `json:"content_id,omitempty"`
+	Inline    bool   `json:"inline"`
+}
+
+// Email parses a raw RFC 822 message, such as one posted by an inbound email webhook, runs its
+// attachments and inline images through the pipeline, and returns them with the text and HTML
+// bodies. Bodies in character sets other than UTF-8 are returned undecoded.
+func (in *Ingest) Email(ctx context.Context, r io.Reader) (*EmailMessage, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := new(mime.WordDecoder)
+	em := &EmailMessage{}
+	em.Subject, _ = dec.DecodeHeader(msg.Header.Get("Subject"))
+	if from, err := msg.Header.AddressList("From"); err == nil && len(from) > 0 {
+		em.From = from[0].String()
+	}
+	if to, err := msg.Header.AddressList("To"); err == nil {
+		for _, addr := range to {
+			em.To = append(em.To, addr.String())
+		}
+	}
+	em.Date, _ = msg.Header.Date()
+
+	parts := 0
+	err = in.emailPart(ctx, em, emailHeader(msg.Header), msg.Body, 0, &parts)
+	if err != nil {
+		return nil, err
+	}
+	return em, nil
+}
+
+// emailHeader is the subset of a MIME header the parts of an email are read with
+type emailHeader interface {
+	Get(key string) string
+}
+
+func (in *Ingest) emailPart(ctx context.Context, em *EmailMessage, h emailHeader, body io.Reader, depth int, parts *int) error {
+	*parts++
+	if *parts > maxEmailParts || depth > maxEmailDepth {
+		return ErrTooManyParts
+	}
+
+	contentType := h.Get("Content-Type")
+	if contentType == "" {
+		contentType = "text/plain"
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = "application/octet-stream"
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			p, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err = in.emailPart(ctx, em, p.Header, p, depth+1, parts); err != nil {
+				return err
+			}
+		}
+	}
+
+	body = transferDecoder(h.Get("Content-Transfer-Encoding"), body)
+	disposition, dparams, _ := mime.ParseMediaType(h.Get("Content-Disposition"))
+	fileName := dparams["filename"]
+	if fileName == "" {
+		fileName = params["name"]
+	}
+	if decoded, err := new(mime.WordDecoder).DecodeHeader(fileName); err == nil {
+		fileName = decoded
+	}
+	contentID := strings.Trim(h.Get("Content-ID"), "<> ")
+
+	// the first text parts which aren't attachments are the bodies
+	if disposition != "attachment" && fileName == "" {
+		switch {
+		case mediaType == "text/plain" && em.Text == "":
+			text, err := readEmailText(body, in.MaxFileSize)
+			em.Text = text
+			return err
+		case mediaType == "text/html" && em.HTML == "":
+			html, err := readEmailText(body, in.MaxFileSize)
+			em.HTML = html
+			return err
+		case contentID == "" && strings.HasPrefix(mediaType, "text/"):
+			_, err := io.Copy(io.Discard, body)
+			return err
+		}
+	}
+
+	if fileName == "" {
+		fileName = "attachment"
+		if exts, _ := mime.ExtensionsByType(mediaType); len(exts) > 0 {
+			fileName += exts[0]
+		}
+	}
+
+	f, err := in.File(ctx, fileName, body)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fileName, err)
+	}
+	em.Attachments = append(em.Attachments, EmailAttachment{
+		UploadedFile: *f,
+		ContentType:  mediaType,
+		ContentID:    contentID,
+		Inline:       disposition == "inline" || (disposition == "" && contentID != ""),
+	})
+	return nil
+}
+
+// transferDecoder decodes a part's Content-Transfer-Encoding
+func transferDecoder(encoding string, r io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, &base64Cleaner{r: r})
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	}
+	return r
+}
+
+// base64Cleaner drops the line breaks and other whitespace email wraps base64 in, which
+// base64.NewDecoder does not skip on its own in every case
+type base64Cleaner struct {
+	r io.Reader
+}
+
+func (bc *base64Cleaner) Read(p []byte) (int, error) {
+	for {
+		n, err := bc.r.Read(p)
+		clean := p[:0]
+		for _, b := range p[:n] {
+			if b != ' ' && b != '\t' && b != '\r' && b != '\n' {
+				clean = append(clean, b)
+			}
+		}
+		if len(clean) > 0 || err != nil {
+			return len(clean), err
+		}
+	}
+}
+
+func readEmailText(r io.Reader, limit int64) (string, error) {
+	if limit <= 0 {
+		limit = 1024 * 1024 * 1024
+	}
+	var buf bytes.Buffer
+	_, err := io.Copy(&buf, io.LimitReader(r, limit))
+	return buf.String(), err
+}
@@ -0,0 +1,100 @@
+package toolkit
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+const testEmail = "From: Jo Bloggs <jo@example.com>\r\n" +
+	"To: inbox@example.org\r\n" +
+	"Subject: =?UTF-8?Q?Invoice_=E2=82=AC42?=\r\n" +
+	"Date: Mon, 02 Jan 2006 15:04:05 -0700\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=outer\r\n" +
+	"\r\n" +
+	"--outer\r\n" +
+	"Content-Type: multipart/related; boundary=inner\r\n" +
+	"\r\n" +
+	"--inner\r\n" +
+	"Content-Type: multipart/alternative; boundary=alt\r\n" +
+	"\r\n" +
+	"--alt\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"Please find the invoice attached =E2=82=AC\r\n" +
+	"--alt\r\n" +
+	"Content-Type: text/html; charset=utf-8\r\n" +
+	"\r\n" +
+	"<p>Invoice <img src=\"cid:logo@example.com\"></p>\r\n" +
+	"--alt--\r\n" +
+	"--inner\r\n" +
+	"Content-Type: image/gif\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"Content-ID: <logo@example.com>\r\n" +
+	"\r\n" +
+	"R0lGODlhAQABAIAAAAAAAP///yH5BAEAAAAALAAAAAAB\r\n" +
+	"AAEAAAIBRAA7\r\n" +
+	"--inner--\r\n" +
+	"--outer\r\n" +
+	"Content-Type: text/csv; name=\"ignored.csv\"\r\n" +
+	"Content-Disposition: attachment; filename=\"invoice.csv\"\r\n" +
+	"\r\n" +
+	"item,amount\r\nwidget,42\r\n" +
+	"--outer--\r\n"
+
+func TestIngest_Email(t *testing.T) {
+	store := &FileStorage{Dir: t.TempDir()}
+	in := &Ingest{Storage: store, Prefix: "in/"}
+
+	em, err := in.Email(context.Background(), strings.NewReader(testEmail))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if em.Subject != "Invoice €42" || em.From != `"Jo Bloggs" <jo@example.com>` || len(em.To) != 1 {
+		t.Errorf("unexpected headers %q %q %v", em.Subject, em.From, em.To)
+	}
+	if em.Date.IsZero() {
+		t.Error("expected the date to be parsed")
+	}
+	if em.Text != "Please find the invoice attached €" {
+		t.Errorf("unexpected text body %q", em.Text)
+	}
+	if !strings.Contains(em.HTML, "cid:logo@example.com") {
+		t.Errorf("unexpected html body %q", em.HTML)
+	}
+
+	if len(em.Attachments) != 2 {
+		t.Fatalf("expected 2 attachments, got %d", len(em.Attachments))
+	}
+	logo, csv := em.Attachments[0], em.Attachments[1]
+	if !logo.Inline || logo.ContentID != "logo@example.com" || logo.FileSize != 42 || !strings.HasSuffix(logo.NewFileName, ".gif") {
+		t.Errorf("unexpected inline image %+v", logo)
+	}
+	if csv.Inline || csv.OriginalFileName != "invoice.csv" || csv.ContentType != "text/csv" {
+		t.Errorf("unexpected attachment %+v", csv)
+	}
+
+	for _, a := range em.Attachments {
+		if _, err = store.Stat(context.Background(), "in/"+a.NewFileName); err != nil {
+			t.Errorf("%s was not stored", a.OriginalFileName)
+		}
+	}
+}
+
+func TestIngest_EmailTooManyParts(t *testing.T) {
+	in := &Ingest{Storage: &FileStorage{Dir: t.TempDir()}, Prefix: "in/"}
+
+	var b strings.Builder
+	b.WriteString("Content-Type: multipart/mixed; boundary=b\r\n\r\n")
+	for i := 0; i < maxEmailParts+1; i++ {
+		b.WriteString("--b\r\nContent-Type: text/plain\r\n\r\nx\r\n")
+	}
+	b.WriteString("--b--\r\n")
+
+	if _, err := in.Email(context.Background(), strings.NewReader(b.String())); err != ErrTooManyParts {
+		t.Errorf("expected ErrTooManyParts, got %v", err)
+	}
+}
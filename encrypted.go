@@ -0,0 +1,313 @@
+package toolkit
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrDecryptionFailed is returned when a stored object can't be decrypted, because it was
+// encrypted with another master key, or has been corrupted or tampered with
+var ErrDecryptionFailed = errors.New("object could not be decrypted")
+
+// KeyWrapper encrypts and decrypts the data keys of objects with a master key. It may use a
+// local key, as AESKeyWrapper does, or a key management service such as AWS KMS or Vault's
+// transit engine.
+type KeyWrapper interface {
+	WrapKey(ctx context.Context, key []byte) ([]byte, error)
+	UnwrapKey(ctx context.Context, wrapped []byte) ([]byte, error)
+}
+
+// AESKeyWrapper is a KeyWrapper which wraps data keys with AES-256-GCM under a local master
+// key. To rotate the master key, move the old one to OldKeys; objects are decrypted with
+// whichever key wrapped them, and new objects use Key.
+type AESKeyWrapper struct {
+	// Key is the 32 byte master key
+	Key     []byte
+	OldKeys [][]byte
+}
+
+// WrapKey implements KeyWrapper
+func (w *AESKeyWrapper) WrapKey(ctx context.Context, key []byte) ([]byte, error) {
+	aead, err := newGCM(w.Key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, key, nil), nil
+}
+
+// UnwrapKey implements KeyWrapper
+func (w *AESKeyWrapper) UnwrapKey(ctx context.Context, wrapped []byte) ([]byte, error) {
+	for _, k := range append([][]byte{w.Key}, w.OldKeys...) {
+		aead, err := newGCM(k)
+		if err != nil {
+			return nil, err
+		}
+		if len(wrapped) < aead.NonceSize() {
+			break
+		}
+		if key, err := aead.Open(nil, wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():], nil); err == nil {
+			return key, nil
+		}
+	}
+	return nil, ErrDecryptionFailed
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("encryption keys must be 32 bytes, not %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Objects are stored as a header, "TKE1", the length of the wrapped data key as two bytes,
+// and the wrapped key, followed by the contents in segments of encryptedSegment bytes, each
+// sealed with AES-256-GCM. A segment's nonce is its number, with the last byte set on the
+// final segment, so segments can't be reordered, dropped or truncated unnoticed.
+const (
+	encryptedMagic   = "TKE1"
+	encryptedSegment = 64 * 1024
+	encryptedTag     = 16
+)
+
+// EncryptedStorage is a Storage which encrypts objects before storing them in another, using
+// envelope encryption: each object has its own random data key, which is stored with it
+// wrapped by the master key. Objects are encrypted and decrypted as they stream, in 64KB
+// segments, so large files are never buffered. Stat reports the decrypted size, by reading
+// the object's header; List reports the stored sizes, which are slightly larger.
+type EncryptedStorage struct {
+	Storage Storage
+	Keys    KeyWrapper
+}
+
+// Put implements Storage
+func (es *EncryptedStorage) Put(ctx context.Context, key string, r io.Reader) error {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return err
+	}
+	wrapped, err := es.Keys.WrapKey(ctx, dataKey)
+	if err != nil {
+		return err
+	}
+	if len(wrapped) > 0xffff {
+		return errors.New("wrapped data key is too long")
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return err
+	}
+
+	header := make([]byte, 0, len(encryptedMagic)+2+len(wrapped))
+	header = append(header, encryptedMagic...)
+	header = append(header, byte(len(wrapped)>>8), byte(len(wrapped)))
+	header = append(header, wrapped...)
+
+	return es.Storage.Put(ctx, key, &encryptReader{src: r, aead: aead, out: header})
+}
+
+// Get implements Storage
+func (es *EncryptedStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	rc, err := es.Storage.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	wrapped, err := readEncryptedHeader(rc)
+	if err != nil {
+		rc.Close()
+		return nil, err
+	}
+	dataKey, err := es.Keys.UnwrapKey(ctx, wrapped)
+	if err != nil {
+		rc.Close()
+		return nil, err
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		rc.Close()
+		return nil, ErrDecryptionFailed
+	}
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{&decryptReader{src: rc, aead: aead}, rc}, nil
+}
+
+// Stat implements Storage, reporting the decrypted size
+func (es *EncryptedStorage) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	info, err := es.Storage.Stat(ctx, key)
+	if err != nil {
+		return info, err
+	}
+
+	rc, err := es.Storage.Get(ctx, key)
+	if err != nil {
+		return info, err
+	}
+	wrapped, err := readEncryptedHeader(rc)
+	rc.Close()
+	if err != nil {
+		return info, err
+	}
+
+	body := info.Size - int64(len(encryptedMagic)+2+len(wrapped))
+	segments := (body + encryptedSegment + encryptedTag - 1) / (encryptedSegment + encryptedTag)
+	if segments == 0 {
+		segments = 1
+	}
+	info.Size = body - segments*encryptedTag
+	if info.Size < 0 {
+		return info, ErrDecryptionFailed
+	}
+	return info, nil
+}
+
+// Delete implements Storage
+func (es *EncryptedStorage) Delete(ctx context.Context, key string) error {
+	return es.Storage.Delete(ctx, key)
+}
+
+// List implements Storage
+func (es *EncryptedStorage) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	return es.Storage.List(ctx, prefix)
+}
+
+// Copy implements Copier. Objects carry their own wrapped keys, so they are copied as they
+// are stored, server side if the backend can.
+func (es *EncryptedStorage) Copy(ctx context.Context, src, dst string) error {
+	return CopyObject(ctx, es.Storage, src, dst)
+}
+
+func readEncryptedHeader(r io.Reader) ([]byte, error) {
+	header := make([]byte, len(encryptedMagic)+2)
+	if _, err := io.ReadFull(r, header); err != nil || string(header[:len(encryptedMagic)]) != encryptedMagic {
+		return nil, ErrDecryptionFailed
+	}
+	wrapped := make([]byte, int(header[4])<<8|int(header[5]))
+	if _, err := io.ReadFull(r, wrapped); err != nil {
+		return nil, ErrDecryptionFailed
+	}
+	return wrapped, nil
+}
+
+// segmentNonce returns the nonce of the nth segment
+func segmentNonce(n uint64, last bool) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[3:11], n)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// encryptReader reads the header, then the encrypted segments of src
+type encryptReader struct {
+	src   io.Reader
+	aead  cipher.AEAD
+	out   []byte // sealed output not yet read
+	plain []byte // plaintext read ahead, up to a segment and a byte
+	n     uint64
+	done  bool
+}
+
+func (er *encryptReader) Read(p []byte) (int, error) {
+	for len(er.out) == 0 {
+		if er.done {
+			return 0, io.EOF
+		}
+
+		// read a byte past the segment, to know whether it is the last
+		if er.plain == nil {
+			er.plain = make([]byte, 0, encryptedSegment+1)
+		}
+		k, err := io.ReadFull(er.src, er.plain[len(er.plain):encryptedSegment+1])
+		er.plain = er.plain[:len(er.plain)+k]
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return 0, err
+		}
+
+		last := len(er.plain) <= encryptedSegment
+		segment := er.plain
+		if !last {
+			segment = er.plain[:encryptedSegment]
+		}
+		er.out = er.aead.Seal(er.out[:0], segmentNonce(er.n, last), segment, nil)
+		er.n++
+
+		if last {
+			er.done = true
+		} else {
+			er.plain = append(er.plain[:0], er.plain[encryptedSegment])
+		}
+	}
+
+	n := copy(p, er.out)
+	er.out = er.out[n:]
+	return n, nil
+}
+
+// decryptReader reads the decrypted segments of src, which is past the header
+type decryptReader struct {
+	src    io.Reader
+	aead   cipher.AEAD
+	out    []byte // opened output not yet read
+	sealed []byte // ciphertext read ahead, up to a segment and a byte
+	n      uint64
+	done   bool
+}
+
+func (dr *decryptReader) Read(p []byte) (int, error) {
+	const sealedSegment = encryptedSegment + encryptedTag
+
+	for len(dr.out) == 0 {
+		if dr.done {
+			return 0, io.EOF
+		}
+
+		if dr.sealed == nil {
+			dr.sealed = make([]byte, 0, sealedSegment+1)
+		}
+		k, err := io.ReadFull(dr.src, dr.sealed[len(dr.sealed):sealedSegment+1])
+		dr.sealed = dr.sealed[:len(dr.sealed)+k]
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return 0, err
+		}
+
+		last := len(dr.sealed) <= sealedSegment
+		segment := dr.sealed
+		if !last {
+			segment = dr.sealed[:sealedSegment]
+		}
+		out, err := dr.aead.Open(dr.out[:0], segmentNonce(dr.n, last), segment, nil)
+		if err != nil {
+			return 0, ErrDecryptionFailed
+		}
+		dr.out = out
+		dr.n++
+
+		if last {
+			dr.done = true
+		} else {
+			dr.sealed = append(dr.sealed[:0], dr.sealed[sealedSegment])
+		}
+	}
+
+	n := copy(p, dr.out)
+	dr.out = dr.out[n:]
+	return n, nil
+}
@@ -0,0 +1,158 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestEncryptedStorage(t *testing.T) {
+	store := &FileStorage{Dir: t.TempDir()}
+	es := &EncryptedStorage{Storage: store, Keys: &AESKeyWrapper{Key: bytes.Repeat([]byte{1}, 32)}}
+	ctx := context.Background()
+
+	var tests = []struct {
+		name string
+		size int
+	}{
+		{"empty", 0},
+		{"small", 10},
+		{"one segment", encryptedSegment},
+		{"segment and a byte", encryptedSegment + 1},
+		{"several segments", 3*encryptedSegment + 1234},
+	}
+
+	for _, e := range tests {
+		plain := make([]byte, e.size)
+		_, _ = rand.Read(plain)
+
+		if err := es.Put(ctx, "obj", bytes.NewReader(plain)); err != nil {
+			t.Fatalf("%s: %v", e.name, err)
+		}
+
+		rc, err := store.Get(ctx, "obj")
+		if err != nil {
+			t.Fatal(err)
+		}
+		stored, _ := io.ReadAll(rc)
+		rc.Close()
+		if e.size > 16 && bytes.Contains(stored, plain[:16]) {
+			t.Errorf("%s: expected the stored object to be encrypted", e.name)
+		}
+
+		rc, err = es.Get(ctx, "obj")
+		if err != nil {
+			t.Fatalf("%s: %v", e.name, err)
+		}
+		got, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Errorf("%s: %v", e.name, err)
+		}
+		if !bytes.Equal(got, plain) {
+			t.Errorf("%s: expected %d bytes back but got %d", e.name, len(plain), len(got))
+		}
+
+		info, err := es.Stat(ctx, "obj")
+		if err != nil || info.Size != int64(e.size) {
+			t.Errorf("%s: expected size %d but got %d, %v", e.name, e.size, info.Size, err)
+		}
+	}
+}
+
+func TestEncryptedStorage_Tampering(t *testing.T) {
+	store := &FileStorage{Dir: t.TempDir()}
+	es := &EncryptedStorage{Storage: store, Keys: &AESKeyWrapper{Key: bytes.Repeat([]byte{1}, 32)}}
+	ctx := context.Background()
+
+	plain := bytes.Repeat([]byte("secret "), 30000)
+	if err := es.Put(ctx, "obj", bytes.NewReader(plain)); err != nil {
+		t.Fatal(err)
+	}
+	rc, _ := store.Get(ctx, "obj")
+	stored, _ := io.ReadAll(rc)
+	rc.Close()
+
+	read := func(contents []byte) error {
+		_ = store.Put(ctx, "bad", bytes.NewReader(contents))
+		rc, err := es.Get(ctx, "bad")
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		_, err = io.ReadAll(rc)
+		return err
+	}
+
+	flipped := append([]byte(nil), stored...)
+	flipped[len(flipped)-100] ^= 1
+	// cut at a segment boundary, so the last remaining segment isn't marked as last
+	header := len(stored) - (len(plain) + 4*encryptedTag)
+	truncated := stored[:header+encryptedSegment+encryptedTag]
+
+	var tests = []struct {
+		name     string
+		contents []byte
+	}{
+		{"flipped bit", flipped},
+		{"truncated", truncated},
+		{"not encrypted", []byte("plain text")},
+	}
+	for _, e := range tests {
+		if err := read(e.contents); !errors.Is(err, ErrDecryptionFailed) {
+			t.Errorf("%s: expected ErrDecryptionFailed but got %v", e.name, err)
+		}
+	}
+
+	other := &EncryptedStorage{Storage: store, Keys: &AESKeyWrapper{Key: bytes.Repeat([]byte{2}, 32)}}
+	if _, err := other.Get(ctx, "obj"); !errors.Is(err, ErrDecryptionFailed) {
+		t.Errorf("expected ErrDecryptionFailed with another key but got %v", err)
+	}
+}
+
+func TestAESKeyWrapper_Rotation(t *testing.T) {
+	store := &FileStorage{Dir: t.TempDir()}
+	es := &EncryptedStorage{Storage: store, Keys: &AESKeyWrapper{Key: bytes.Repeat([]byte{1}, 32)}}
+	ctx := context.Background()
+
+	if err := es.Put(ctx, "old", strings.NewReader("written before rotation")); err != nil {
+		t.Fatal(err)
+	}
+
+	oldKey := es.Keys.(*AESKeyWrapper).Key
+	es.Keys = &AESKeyWrapper{Key: bytes.Repeat([]byte{3}, 32), OldKeys: [][]byte{oldKey}}
+	if err := es.Put(ctx, "new", strings.NewReader("written after rotation")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"old", "new"} {
+		rc, err := es.Get(ctx, key)
+		if err != nil {
+			t.Fatalf("%s: %v", key, err)
+		}
+		b, _ := io.ReadAll(rc)
+		rc.Close()
+		if !strings.HasPrefix(string(b), "written") {
+			t.Errorf("%s: unexpected contents %q", key, b)
+		}
+	}
+
+	// copies keep their wrapped key
+	if err := CopyObject(ctx, es, "old", "copy"); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := es.Stat(ctx, "copy"); err != nil || info.Size != int64(len("written before rotation")) {
+		t.Errorf("unexpected copy %+v, %v", info, err)
+	}
+	if _, err := store.Stat(ctx, "copy"); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := (&AESKeyWrapper{Key: []byte("short")}).WrapKey(ctx, oldKey); err == nil {
+		t.Error("expected an error for a short key")
+	}
+}
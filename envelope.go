@@ -0,0 +1,65 @@
+package toolkit
+
+import "net/http"
+
+// ResponseMode controls how WriteJSON shapes its output
+type ResponseMode int
+
+const (
+	// ResponseBare writes the data as given. This is the default
+	ResponseBare ResponseMode = iota
+	// ResponseEnvelope wraps the data in a JSONResponse, with Error set for 4xx and 5xx statuses
+	ResponseEnvelope
+)
+
+type bareData struct {
+	data any
+}
+
+type envelopedData struct {
+	data    any
+	message string
+}
+
+// Bare marks data to be written as given by WriteJSON, whatever the ResponseMode
+func Bare(data any) any {
+	return bareData{data: data}
+}
+
+// Enveloped marks data to be wrapped in a JSONResponse by WriteJSON, whatever the ResponseMode,
+// with an optional message
+func Enveloped(data any, message ...string) any {
+	e := envelopedData{data: data}
+	if len(message) > 0 {
+		e.message = message[0]
+	}
+	return e
+}
+
+// applyResponseMode returns the value WriteJSON should marshal
+func (t *Tools) applyResponseMode(status int, data any) any {
+	switch d := data.(type) {
+	case bareData:
+		return d.data
+	case envelopedData:
+		return envelope(status, d.data, d.message)
+	case JSONResponse, *JSONResponse:
+		return data
+	}
+
+	if t.ResponseMode == ResponseEnvelope {
+		return envelope(status, data, "")
+	}
+	return data
+}
+
+func envelope(status int, data any, message string) JSONResponse {
+	if message == "" {
+		message = http.StatusText(status)
+	}
+	return JSONResponse{
+		Error:   status >= http.StatusBadRequest,
+		Message: message,
+		Data:    data,
+	}
+}
@@ -0,0 +1,38 @@
+package toolkit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTools_WriteJSONResponseMode(t *testing.T) {
+	data := map[string]int{"id": 1}
+
+	var tests = []struct {
+		name   string
+		mode   ResponseMode
+		status int
+		data   any
+		want   string
+	}{
+		{"bare by default", ResponseBare, http.StatusOK, data, `{"id":1}`},
+		{"envelope mode", ResponseEnvelope, http.StatusCreated, data, `{"error":false,"message":"Created","data":{"id":1}}`},
+		{"envelope error status", ResponseEnvelope, http.StatusConflict, data, `{"error":true,"message":"Conflict","data":{"id":1}}`},
+		{"bare override", ResponseEnvelope, http.StatusOK, Bare(data), `{"id":1}`},
+		{"envelope override", ResponseBare, http.StatusOK, Enveloped(data, "fetched"), `{"error":false,"message":"fetched","data":{"id":1}}`},
+		{"already enveloped", ResponseEnvelope, http.StatusOK, JSONResponse{Message: "hi"}, `{"error":false,"message":"hi"}`},
+	}
+
+	for _, e := range tests {
+		testTools := Tools{ResponseMode: e.mode}
+		rr := httptest.NewRecorder()
+
+		if err := testTools.WriteJSON(rr, e.status, e.data); err != nil {
+			t.Errorf("%s: %v", e.name, err)
+		}
+		if rr.Body.String() != e.want {
+			t.Errorf("%s: expected %s, got %s", e.name, e.want, rr.Body.String())
+		}
+	}
+}
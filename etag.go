@@ -0,0 +1,151 @@
+package toolkit
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrPreconditionFailed is sent when an If-Match header does not match the current version
+var ErrPreconditionFailed = errors.New("the resource has been modified since it was fetched")
+
+// ErrPreconditionRequired is sent when a mutating request has no If-Match header
+var ErrPreconditionRequired = errors.New("this request must include an If-Match header")
+
+// ConflictDetails is the data sent with a 412 response, so clients can refetch and retry
+type ConflictDetails struct {
+	CurrentETag string `json:"current_etag"`
+}
+
+// EntityTag returns a strong entity tag for a version field, such as a revision number
+// or an updated_at timestamp. Versions which can't be sent as they are, such as those with
+// spaces, are base64 encoded.
+func EntityTag(version any) string {
+	var s string
+	if t, ok := version.(time.Time); ok {
+		s = t.UTC().Format(time.RFC3339Nano)
+	} else {
+		s = fmt.Sprint(version)
+	}
+	for i := 0; i < len(s); i++ {
+		// the characters allowed in entity tags
+		if s[i] <= ' ' || s[i] == '"' || s[i] >= 0x7f {
+			s = base64.RawURLEncoding.EncodeToString([]byte(s))
+			break
+		}
+	}
+	return `"` + s + `"`
+}
+
+// SetETag sets the ETag header for an entity version, for clients to send back in If-Match
+func (t *Tools) SetETag(w http.ResponseWriter, version any) {
+	w.Header().Set("ETag", EntityTag(version))
+}
+
+// VerifyIfMatch checks the If-Match header of a mutating request against the current version
+// of the entity. If it does not match, a 412 JSON error including the current ETag is written
+// and false is returned. A request without If-Match is allowed; use RequireIfMatch to refuse it.
+func (t *Tools) VerifyIfMatch(w http.ResponseWriter, r *http.Request, version any) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return true
+	}
+
+	current := EntityTag(version)
+	if ifMatch(header, current) {
+		return true
+	}
+
+	t.writePreconditionError(w, http.StatusPreconditionFailed, ErrPreconditionFailed, current)
+	return false
+}
+
+// NotModified answers a conditional GET or HEAD: if its If-None-Match header matches the
+// current version of the entity, it writes a 304 and returns true. The ETag header is set
+// either way.
+func (t *Tools) NotModified(w http.ResponseWriter, r *http.Request, version any) bool {
+	current := EntityTag(version)
+	w.Header().Set("ETag", current)
+	if header := r.Header.Get("If-None-Match"); header != "" && ifNoneMatch(header, current) {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// RequireIfMatch is like VerifyIfMatch, but also refuses requests without an If-Match header
+// with a 428 JSON error
+func (t *Tools) RequireIfMatch(w http.ResponseWriter, r *http.Request, version any) bool {
+	if r.Header.Get("If-Match") == "" {
+		t.writePreconditionError(w, http.StatusPreconditionRequired, ErrPreconditionRequired, EntityTag(version))
+		return false
+	}
+	return t.VerifyIfMatch(w, r, version)
+}
+
+func (t *Tools) writePreconditionError(w http.ResponseWriter, status int, err error, current string) {
+	payload := JSONResponse{
+		Error:   true,
+		Message: err.Error(),
+		Data:    ConflictDetails{CurrentETag: current},
+	}
+
+	w.Header().Set("ETag", current)
+	_ = t.WriteJSON(w, status, payload)
+}
+
+// ifMatch reports whether an If-Match header matches the current entity tag. As If-Match uses
+// strong comparison, weak tags never match.
+func ifMatch(header, current string) bool {
+	for _, tag := range parseETags(header) {
+		if tag == "*" || tag == current {
+			return true
+		}
+	}
+	return false
+}
+
+// ifNoneMatch reports whether an If-None-Match header matches the current entity tag, using
+// weak comparison
+func ifNoneMatch(header, current string) bool {
+	for _, tag := range parseETags(header) {
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == current {
+			return true
+		}
+	}
+	return false
+}
+
+// parseETags parses a list of entity tags, such as `"a", W/"b"`, or "*". Parsing stops at the
+// first malformed tag, so a tag can't be matched by a comma or quote inside another.
+func parseETags(header string) []string {
+	var tags []string
+	for s := header; ; {
+		s = strings.TrimLeft(s, " \t,")
+		if s == "" {
+			return tags
+		}
+		if s[0] == '*' {
+			tags = append(tags, "*")
+			s = s[1:]
+		} else {
+			start := s
+			s = strings.TrimPrefix(s, "W/")
+			if s == "" || s[0] != '"' {
+				return tags
+			}
+			end := strings.IndexByte(s[1:], '"')
+			if end < 0 {
+				return tags
+			}
+			s = s[end+2:]
+			tags = append(tags, start[:len(start)-len(s)])
+		}
+		if rest := strings.TrimLeft(s, " \t"); rest != "" && rest[0] != ',' {
+			return tags
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTools_VerifyIfMatch(t *testing.T) {
+	var testTools Tools
+
+	var tests = []struct {
+		name    string
+		ifMatch string
+		require bool
+		ok      bool
+		status  int
+	}{
+		{"no header", "", false, true, http.StatusOK},
+		{"no header required", "", true, false, http.StatusPreconditionRequired},
+		{"match", `"7"`, true, true, http.StatusOK},
+		{"match in list", `"6", "7"`, false, true, http.StatusOK},
+		{"wildcard", `*`, false, true, http.StatusOK},
+		{"stale", `"6"`, false, false, http.StatusPreconditionFailed},
+		{"weak", `W/"7"`, false, false, http.StatusPreconditionFailed},
+		{"comma in tag", `"6,"7"`, false, false, http.StatusPreconditionFailed},
+		{"unquoted", `7`, false, false, http.StatusPreconditionFailed},
+		{"after weak", `W/"6" ,"7"`, false, true, http.StatusOK},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("PUT", "/", nil)
+		if e.ifMatch != "" {
+			req.Header.Set("If-Match", e.ifMatch)
+		}
+		rr := httptest.NewRecorder()
+
+		var ok bool
+		if e.require {
+			ok = testTools.RequireIfMatch(rr, req, 7)
+		} else {
+			ok = testTools.VerifyIfMatch(rr, req, 7)
+		}
+
+		if ok != e.ok || rr.Code != e.status {
+			t.Errorf("%s: expected %v/%d, got %v/%d", e.name, e.ok, e.status, ok, rr.Code)
+		}
+		if ok {
+			continue
+		}
+
+		var payload struct {
+			Error bool            `json:"error"`
+			Data  ConflictDetails `json:"data"`
+		}
+		_ = json.NewDecoder(rr.Body).Decode(&payload)
+		if !payload.Error || payload.Data.CurrentETag != `"7"` {
+			t.Errorf("%s: wrong error payload %+v", e.name, payload)
+		}
+	}
+}
+
+func TestTools_SetETag(t *testing.T) {
+	var testTools Tools
+	rr := httptest.NewRecorder()
+
+	testTools.SetETag(rr, 42)
+	if rr.Header().Get("ETag") != `"42"` {
+		t.Error("wrong etag", rr.Header().Get("ETag"))
+	}
+}
+
+func TestEntityTag(t *testing.T) {
+	var tests = []struct {
+		version any
+		tag     string
+	}{
+		{42, `"42"`},
+		{"rev-3", `"rev-3"`},
+		{time.Date(2024, 5, 1, 9, 0, 0, 500, time.FixedZone("CEST", 7200)), `"2024-05-01T07:00:00.0000005Z"`},
+		{"two words", `"dHdvIHdvcmRz"`},
+		{`say "hi"`, `"c2F5ICJoaSI"`},
+	}
+
+	for _, e := range tests {
+		if tag := EntityTag(e.version); tag != e.tag {
+			t.Errorf("%v: expected %s, got %s", e.version, e.tag, tag)
+		}
+	}
+
+	// the monotonic clock reading is not part of the tag
+	now := time.Now()
+	if EntityTag(now) != EntityTag(now.Round(0)) {
+		t.Error("expected the same tag for the same instant")
+	}
+}
+
+func TestParseETags(t *testing.T) {
+	var tests = []struct {
+		header string
+		tags   []string
+	}{
+		{`"a"`, []string{`"a"`}},
+		{`"a", W/"b" ,"c"`, []string{`"a"`, `W/"b"`, `"c"`}},
+		{`*`, []string{"*"}},
+		{`"a,b", "c"`, []string{`"a,b"`, `"c"`}},
+		{`"a" "b"`, []string{`"a"`}},
+		{`"a", b, "c"`, []string{`"a"`}},
+		{`"a`, nil},
+		{``, nil},
+	}
+
+	for _, e := range tests {
+		if tags := parseETags(e.header); !reflect.DeepEqual(tags, e.tags) {
+			t.Errorf("%s: expected %q, got %q", e.header, e.tags, tags)
+		}
+	}
+}
+
+func TestTools_NotModified(t *testing.T) {
+	var testTools Tools
+
+	var tests = []struct {
+		ifNoneMatch string
+		notModified bool
+	}{
+		{"", false},
+		{`"7"`, true},
+		{`W/"7"`, true},
+		{`"6", "7"`, true},
+		{`*`, true},
+		{`"6"`, false},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		if e.ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", e.ifNoneMatch)
+		}
+		rr := httptest.NewRecorder()
+
+		if testTools.NotModified(rr, req, 7) != e.notModified {
+			t.Errorf("%q: expected %v", e.ifNoneMatch, e.notModified)
+		}
+		if e.notModified && rr.Code != http.StatusNotModified {
+			t.Errorf("%q: expected a 304, got %d", e.ifNoneMatch, rr.Code)
+		}
+		if rr.Header().Get("ETag") != `"7"` {
+			t.Errorf("%q: expected the etag set, got %q", e.ifNoneMatch, rr.Header().Get("ETag"))
+		}
+	}
+}
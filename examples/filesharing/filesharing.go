@@ -0,0 +1,372 @@
+// Package filesharing is a small file-sharing API built from the toolkit, as an example of
+// its parts working together: password logins, uploads run through the ingest pipeline,
+// signed and resumable download links, webhooks, and background export jobs. Its tests drive
+// the whole API over HTTP, so the example can't drift from the toolkit.
+//
+// The API, all JSON:
+//
+//	POST /login                 {"username", "password"} gives a bearer token
+//	POST /files                 multipart upload of one or more files
+//	GET  /files                 the caller's files
+//	POST /files/{id}/share      a signed download link, valid for an hour
+//	GET  /download/{id}         the file, from a signed link, with a resume token
+//	GET  /resume                the rest of a download, from its resume token
+//	POST /exports               starts a CSV export of the caller's files
+//	GET  /exports/{id}          the export's status, and its link once ready
+//	GET  /healthz               health, which fails once the app is shutting down
+//
+// Uploads and finished exports are posted to the webhook, if there is one.
+package filesharing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kaliadmen/toolkit"
+)
+
+// Config sets up an App
+type Config struct {
+	// Storage holds the uploaded files and the exports
+	Storage toolkit.Storage
+	// BaseURL is where the app is served, such as https://files.example.com, for links
+	BaseURL string
+	// Key signs download links and resume tokens. It should be at least 32 random bytes
+	Key []byte
+	// Users maps user names to password hashes from toolkit.HashPassword
+	Users map[string]string
+	// WebhookURL, if set, receives the app's events
+	WebhookURL string
+	// Client makes the webhook calls. Defaults to http.DefaultClient
+	Client *http.Client
+	// UploadBytesPerSecond caps each client's upload rate. Defaults to 10MB
+	UploadBytesPerSecond int64
+}
+
+// File is an uploaded file
+type File struct {
+	ID         string    `json:"id"`
+	Owner      string    `json:"-"`
+	Name       string    `json:"name"`
+	Size       int64     `json:"size"`
+	Checksum   string    `json:"checksum"`
+	UploadedAt time.Time `json:"uploaded_at"`
+	key        string
+}
+
+// Event is a webhook call
+type Event struct {
+	Type string `json:"type"`
+	User string `json:"user,omitempty"`
+	Data any    `json:"data"`
+}
+
+// App is the file-sharing API. Serve its Handler, and call Shutdown when stopping, so uploads
+// and jobs in progress can finish.
+type App struct {
+	config  Config
+	tools   toolkit.Tools
+	drainer toolkit.Drainer
+	ingest  *toolkit.Ingest
+	// bandwidth limits the rate each user's uploads are read at
+	bandwidth *toolkit.BandwidthLimiter
+	signer    *toolkit.URLSigner
+	resume    *toolkit.ResumeTokens
+	exports   *toolkit.ExportManager
+
+	mu           sync.Mutex
+	sessions     map[string]string
+	files        map[string]*File
+	exportOwners map[string]string
+	handler      http.Handler
+	handlerOnce  sync.Once
+}
+
+// New returns an App for config
+func New(config Config) (*App, error) {
+	if config.Storage == nil || len(config.Key) < 32 {
+		return nil, errors.New("filesharing needs storage and a key of at least 32 bytes")
+	}
+	if config.Client == nil {
+		config.Client = http.DefaultClient
+	}
+	a := &App{
+		config:       config,
+		sessions:     make(map[string]string),
+		files:        make(map[string]*File),
+		exportOwners: make(map[string]string),
+	}
+	a.ingest = &toolkit.Ingest{Storage: config.Storage, Prefix: "files/", MaxFileSize: 100 << 20}
+	a.bandwidth = &toolkit.BandwidthLimiter{BytesPerSecond: config.UploadBytesPerSecond, Key: a.sessionUser}
+	if a.bandwidth.BytesPerSecond <= 0 {
+		a.bandwidth.BytesPerSecond = 10 << 20
+	}
+	a.signer = &toolkit.URLSigner{Key: config.Key, CacheSize: 1000}
+	a.resume = &toolkit.ResumeTokens{Key: append([]byte("resume:"), config.Key...), Storage: config.Storage, Tools: &a.tools}
+	a.exports = &toolkit.ExportManager{
+		Storage: config.Storage,
+		Runner:  &a.drainer,
+		Signer:  a.signer,
+		BaseURL: strings.TrimSuffix(config.BaseURL, "/") + "/export-files",
+		TTL:     time.Hour,
+		Resume:  a.resume,
+	}
+	if config.WebhookURL != "" {
+		a.exports.Notify = func(ctx context.Context, e toolkit.Export) error {
+			return a.post(ctx, Event{Type: "export." + e.Status, Data: e})
+		}
+		a.exports.ErrorLog = a.tools.LogError
+	}
+	return a, nil
+}
+
+// Handler returns the API
+func (a *App) Handler() http.Handler {
+	a.handlerOnce.Do(func() {
+		rt := &toolkit.Router{Tools: &a.tools}
+		rt.HandleFunc("POST", "/login", a.login)
+		rt.HandleFunc("POST", "/files", a.upload, a.authenticated)
+		rt.HandleFunc("GET", "/files", a.listFiles, a.authenticated)
+		rt.HandleFunc("POST", "/files/{id}/share", a.share, a.authenticated)
+		rt.HandleFunc("GET", "/download/{id}", a.download)
+		rt.Handle("GET", "/resume", a.resume.Handler())
+		rt.HandleFunc("POST", "/exports", a.startExport, a.authenticated)
+		rt.HandleFunc("GET", "/exports/{id}", a.exportStatus, a.authenticated)
+		rt.Handle("GET", "/export-files/{path...}", http.StripPrefix("/export-files", a.exports.DownloadHandler()))
+		rt.Handle("GET", "/healthz", &toolkit.Health{Tools: &a.tools, Drainer: &a.drainer})
+
+		rc := &toolkit.RequestContext{UserID: a.sessionUser}
+		pn := &toolkit.PathNormalizer{TrailingSlash: toolkit.StripTrailingSlash}
+		a.handler = rc.Middleware(pn.Middleware(rt))
+	})
+	return a.handler
+}
+
+// Shutdown stops taking uploads and jobs, and waits for those in progress, or until ctx ends
+func (a *App) Shutdown(ctx context.Context) error {
+	return a.drainer.Drain(ctx)
+}
+
+// sessionUser returns the user of the request's bearer token
+func (a *App) sessionUser(r *http.Request) string {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.sessions[token]
+}
+
+// authenticated refuses requests without a session with a 401
+func (a *App) authenticated(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := toolkit.UserIDFromContext(r.Context()); !ok {
+			_ = a.tools.ErrorJSON(w, errors.New("log in first"), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *App) login(w http.ResponseWriter, r *http.Request) {
+	var creds struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := a.tools.ReadJSON(w, r, &creds); err != nil {
+		_ = a.tools.ErrorJSON(w, err)
+		return
+	}
+	hash, ok := a.config.Users[creds.Username]
+	if !ok || toolkit.CheckPassword(hash, creds.Password) != nil {
+		_ = a.tools.ErrorJSON(w, errors.New("wrong user name or password"), http.StatusUnauthorized)
+		return
+	}
+
+	token := a.tools.RandomString(32)
+	a.mu.Lock()
+	a.sessions[token] = creds.Username
+	a.mu.Unlock()
+	_ = a.tools.WriteJSON(w, http.StatusOK, map[string]string{"token": token})
+}
+
+// upload ingests each file of a multipart upload at once, reporting the files which failed
+// by their position
+func (a *App) upload(w http.ResponseWriter, r *http.Request) {
+	user, _ := toolkit.UserIDFromContext(r.Context())
+	release, err := a.drainer.Track()
+	if err != nil {
+		_ = a.tools.ErrorJSON(w, err, http.StatusServiceUnavailable)
+		return
+	}
+	defer release()
+
+	a.bandwidth.LimitBody(r)
+	if err = r.ParseMultipartForm(32 << 20); err != nil {
+		_ = a.tools.ErrorJSON(w, err)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+	headers := r.MultipartForm.File["file"]
+	if len(headers) == 0 {
+		_ = a.tools.ErrorJSON(w, errors.New("no files uploaded"))
+		return
+	}
+
+	files, err := toolkit.MapN(r.Context(), 4, headers, func(ctx context.Context, hdr *multipart.FileHeader) (*File, error) {
+		f, err := hdr.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		record, err := a.ingest.File(ctx, hdr.Filename, f)
+		if err != nil {
+			return nil, err
+		}
+		return &File{
+			ID:         a.tools.UUID(),
+			Owner:      user,
+			Name:       record.OriginalFileName,
+			Size:       record.FileSize,
+			Checksum:   record.Checksum,
+			UploadedAt: time.Now().UTC(),
+			key:        a.ingest.Prefix + record.NewFileName,
+		}, nil
+	})
+
+	var stored []*File
+	a.mu.Lock()
+	for _, f := range files {
+		if f != nil {
+			a.files[f.ID] = f
+			stored = append(stored, f)
+		}
+	}
+	a.mu.Unlock()
+	for _, f := range stored {
+		a.notify(Event{Type: "file.uploaded", User: user, Data: f})
+	}
+
+	if err != nil {
+		_ = a.tools.ErrorJSON(w, err, http.StatusUnprocessableEntity)
+		return
+	}
+	_ = a.tools.WriteJSON(w, http.StatusCreated, stored)
+}
+
+func (a *App) listFiles(w http.ResponseWriter, r *http.Request) {
+	_ = a.tools.WriteJSON(w, http.StatusOK, a.filesOf(r))
+}
+
+// filesOf returns the files of the request's user, oldest first
+func (a *App) filesOf(r *http.Request) []*File {
+	user, _ := toolkit.UserIDFromContext(r.Context())
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	files := []*File{}
+	for _, f := range a.files {
+		if f.Owner == user {
+			files = append(files, f)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if !files[i].UploadedAt.Equal(files[j].UploadedAt) {
+			return files[i].UploadedAt.Before(files[j].UploadedAt)
+		}
+		return files[i].Name < files[j].Name
+	})
+	return files
+}
+
+// ownFile returns a file of the request's user
+func (a *App) ownFile(r *http.Request) (*File, bool) {
+	user, _ := toolkit.UserIDFromContext(r.Context())
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	f, ok := a.files[toolkit.PathParam(r, "id")]
+	return f, ok && f.Owner == user
+}
+
+func (a *App) share(w http.ResponseWriter, r *http.Request) {
+	f, ok := a.ownFile(r)
+	if !ok {
+		_ = a.tools.ErrorJSON(w, toolkit.ErrNotFound, http.StatusNotFound)
+		return
+	}
+	expires := time.Now().Add(time.Hour)
+	link, err := a.signer.Sign(strings.TrimSuffix(a.config.BaseURL, "/")+"/download/"+f.ID, expires)
+	if err != nil {
+		_ = a.tools.ErrorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	_ = a.tools.WriteJSON(w, http.StatusOK, map[string]any{"url": link, "expires_at": expires.UTC()})
+}
+
+func (a *App) download(w http.ResponseWriter, r *http.Request) {
+	if err := a.signer.Verify(r.URL); err != nil {
+		_ = a.tools.ErrorJSON(w, err, http.StatusForbidden)
+		return
+	}
+	a.mu.Lock()
+	f, ok := a.files[toolkit.PathParam(r, "id")]
+	a.mu.Unlock()
+	if !ok {
+		_ = a.tools.ErrorJSON(w, toolkit.ErrNotFound, http.StatusNotFound)
+		return
+	}
+	a.resume.ServeObject(w, r, f.key, f.Name)
+}
+
+func (a *App) startExport(w http.ResponseWriter, r *http.Request) {
+	user, _ := toolkit.UserIDFromContext(r.Context())
+	rows := &toolkit.SliceRows{Cols: []string{"id", "name", "size", "checksum", "uploaded_at"}}
+	for _, f := range a.filesOf(r) {
+		rows.Rows = append(rows.Rows, []any{f.ID, f.Name, f.Size, f.Checksum, f.UploadedAt})
+	}
+	e, err := a.exports.Request(toolkit.FormatCSV, rows)
+	if err != nil {
+		_ = a.tools.ErrorJSON(w, err, http.StatusServiceUnavailable)
+		return
+	}
+	a.mu.Lock()
+	a.exportOwners[e.ID] = user
+	a.mu.Unlock()
+	_ = a.tools.WriteJSON(w, http.StatusAccepted, e)
+}
+
+func (a *App) exportStatus(w http.ResponseWriter, r *http.Request) {
+	user, _ := toolkit.UserIDFromContext(r.Context())
+	id := toolkit.PathParam(r, "id")
+	a.mu.Lock()
+	owner := a.exportOwners[id]
+	a.mu.Unlock()
+	e, ok := a.exports.Get(id)
+	if !ok || owner != user {
+		_ = a.tools.ErrorJSON(w, toolkit.ErrNotFound, http.StatusNotFound)
+		return
+	}
+	_ = a.tools.WriteJSON(w, http.StatusOK, e)
+}
+
+// notify posts an event to the webhook in the background, waited for by Shutdown
+func (a *App) notify(e Event) {
+	if a.config.WebhookURL == "" {
+		return
+	}
+	_ = a.drainer.Go(func() {
+		a.tools.LogError(a.post(context.Background(), e))
+	})
+}
+
+func (a *App) post(ctx context.Context, e Event) error {
+	status, err := a.tools.PushJSONToRemoteContext(ctx, a.config.Client, a.config.WebhookURL, e)
+	if err == nil && (status < 200 || status > 299) {
+		err = fmt.Errorf("webhook returned status %d", status)
+	}
+	return err
+}
@@ -0,0 +1,249 @@
+package filesharing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kaliadmen/toolkit"
+)
+
+// testApp serves an App with a user alice, whose password is secret, and a webhook receiver
+// whose events arrive on the returned channel
+func testApp(t *testing.T) (*App, *httptest.Server, <-chan Event) {
+	dir, err := os.MkdirTemp("", "filesharing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	events := make(chan Event, 16)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e Event
+		if err := json.NewDecoder(r.Body).Decode(&e); err == nil {
+			events <- e
+		}
+	}))
+	t.Cleanup(hook.Close)
+
+	// a low iteration count keeps the test fast; hashes record theirs
+	iterations := toolkit.PasswordIterations
+	toolkit.PasswordIterations = 1000
+	hash, err := toolkit.HashPassword("secret")
+	toolkit.PasswordIterations = iterations
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var srv *httptest.Server
+	app, err := New(Config{
+		Storage:    &toolkit.FileStorage{Dir: dir},
+		BaseURL:    "http://placeholder",
+		Key:        []byte("file sharing example key, not secret"),
+		Users:      map[string]string{"alice": hash},
+		WebhookURL: hook.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv = httptest.NewServer(app.Handler())
+	t.Cleanup(srv.Close)
+	app.config.BaseURL = srv.URL
+	app.exports.BaseURL = srv.URL + "/export-files"
+	return app, srv, events
+}
+
+// call makes a request to the app, decoding a JSON response into out if it's set
+func call(t *testing.T, method, url, token string, body io.Reader, contentType string, out any) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != nil {
+		defer resp.Body.Close()
+		if err = json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: %v", method, url, err)
+		}
+	}
+	return resp
+}
+
+func readAll(t *testing.T, resp *http.Response) string {
+	t.Helper()
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func login(t *testing.T, srv *httptest.Server) string {
+	var session struct{ Token string }
+	resp := call(t, "POST", srv.URL+"/login", "", strings.NewReader(`{"username": "alice", "password": "secret"}`), "application/json", &session)
+	if resp.StatusCode != http.StatusOK || session.Token == "" {
+		t.Fatalf("login failed with %d", resp.StatusCode)
+	}
+	return session.Token
+}
+
+func upload(t *testing.T, srv *httptest.Server, token string, files map[string]string) (*http.Response, []File) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for name, contents := range files {
+		part, _ := mw.CreateFormFile("file", name)
+		_, _ = part.Write([]byte(contents))
+	}
+	_ = mw.Close()
+	var stored []File
+	resp := call(t, "POST", srv.URL+"/files", token, &body, mw.FormDataContentType(), nil)
+	if resp.StatusCode == http.StatusCreated {
+		defer resp.Body.Close()
+		_ = json.NewDecoder(resp.Body).Decode(&stored)
+	}
+	return resp, stored
+}
+
+func waitEvent(t *testing.T, events <-chan Event, typ string) Event {
+	t.Helper()
+	for {
+		select {
+		case e := <-events:
+			if e.Type == typ {
+				return e
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no %s event", typ)
+		}
+	}
+}
+
+func TestFileSharing(t *testing.T) {
+	app, srv, events := testApp(t)
+
+	// the API needs a session
+	if resp := call(t, "GET", srv.URL+"/files", "", nil, "", nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected a 401 without a session, got %d", resp.StatusCode)
+	}
+	resp := call(t, "POST", srv.URL+"/login", "", strings.NewReader(`{"username": "alice", "password": "wrong"}`), "application/json", nil)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected a 401 for a wrong password, got %d", resp.StatusCode)
+	}
+	token := login(t, srv)
+
+	// upload two files, which are announced on the webhook
+	resp, stored := upload(t, srv, token, map[string]string{"notes.txt": "0123456789abcdef", "todo.txt": "buy milk"})
+	if resp.StatusCode != http.StatusCreated || len(stored) != 2 {
+		t.Fatalf("upload failed with %d: %v", resp.StatusCode, stored)
+	}
+	waitEvent(t, events, "file.uploaded")
+	waitEvent(t, events, "file.uploaded")
+
+	var files []File
+	call(t, "GET", srv.URL+"/files/", token, nil, "", &files)
+	// the files are uploaded concurrently, so either may be listed first
+	if len(files) == 2 && files[1].Name == "notes.txt" {
+		files[0], files[1] = files[1], files[0]
+	}
+	if len(files) != 2 || files[0].Name != "notes.txt" || files[0].Size != 16 {
+		t.Fatalf("unexpected files %+v", files)
+	}
+
+	// share one, and download it through the signed link without a session
+	var share struct{ URL string }
+	call(t, "POST", srv.URL+"/files/"+files[0].ID+"/share", token, nil, "", &share)
+	resp = call(t, "GET", share.URL, "", nil, "", nil)
+	resumeToken := resp.Header.Get("X-Resume-Token")
+	if body := readAll(t, resp); resp.StatusCode != http.StatusOK || body != "0123456789abcdef" || resumeToken == "" {
+		t.Fatalf("download failed with %d %q", resp.StatusCode, body)
+	}
+	tampered := strings.Replace(share.URL, files[0].ID, files[1].ID, 1)
+	if resp = call(t, "GET", tampered, "", nil, "", nil); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected a tampered link refused, got %d", resp.StatusCode)
+	}
+
+	// a broken download resumes from its token, even without the link
+	req, _ := http.NewRequest("GET", srv.URL+"/resume", nil)
+	req.Header.Set("X-Resume-Token", resumeToken)
+	req.Header.Set("Range", "bytes=10-")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := readAll(t, resp); resp.StatusCode != http.StatusPartialContent || body != "abcdef" {
+		t.Errorf("resume failed with %d %q", resp.StatusCode, body)
+	}
+
+	// export the list in the background, announced on the webhook when ready
+	var export toolkit.Export
+	if resp = call(t, "POST", srv.URL+"/exports", token, nil, "", &export); resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("export failed with %d", resp.StatusCode)
+	}
+	waitEvent(t, events, "export.ready")
+	call(t, "GET", srv.URL+"/exports/"+export.ID, token, nil, "", &export)
+	if export.Status != toolkit.ExportReady || export.URL == "" {
+		t.Fatalf("unexpected export %+v", export)
+	}
+	resp = call(t, "GET", export.URL, "", nil, "", nil)
+	if body := readAll(t, resp); resp.StatusCode != http.StatusOK || !strings.Contains(body, "notes.txt") || !strings.Contains(body, "todo.txt") {
+		t.Errorf("export download failed with %d %q", resp.StatusCode, body)
+	}
+
+	// shutting down waits for the work in progress, then refuses more
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err = app.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if resp = call(t, "GET", srv.URL+"/healthz", "", nil, "", nil); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected unhealthy while shutting down, got %d", resp.StatusCode)
+	}
+	if resp, _ = upload(t, srv, token, map[string]string{"late.txt": "too late"}); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected uploads refused while shutting down, got %d", resp.StatusCode)
+	}
+}
+
+func TestFileSharing_UploadErrors(t *testing.T) {
+	app, srv, _ := testApp(t)
+	app.ingest.MaxFileSize = 1 << 10
+	token := login(t, srv)
+
+	// the files which fail are reported by position, and the others kept
+	big := strings.Repeat("x", 2<<10)
+	resp, _ := upload(t, srv, token, map[string]string{"ok.txt": "fine", "big.txt": big})
+	var body struct {
+		Data []toolkit.ErrorDetail `json:"data"`
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusUnprocessableEntity || len(body.Data) != 1 || body.Data[0].Index == nil {
+		t.Fatalf("unexpected %d %+v", resp.StatusCode, body)
+	}
+
+	var files []File
+	call(t, "GET", srv.URL+"/files", token, nil, "", &files)
+	if len(files) != 1 || files[0].Name != "ok.txt" {
+		t.Errorf("expected the good file kept, got %+v", files)
+	}
+}
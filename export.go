@@ -0,0 +1,348 @@
+package toolkit
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Export statuses
+const (
+	ExportPending = "pending"
+	ExportReady   = "ready"
+	ExportFailed  = "failed"
+)
+
+// FormatZIP is the format of archive exports, from RequestArchive. It isn't a tabular format,
+// so WriteRows and WriteTable don't accept it.
+const FormatZIP ExportFormat = "zip"
+
+// Export describes a requested data export
+type Export struct {
+	ID        string       `json:"id"`
+	Format    ExportFormat `json:"format"`
+	Status    string       `json:"status"`
+	Key       string       `json:"-"`
+	URL       string       `json:"url,omitempty"`
+	Error     string       `json:"error,omitempty"`
+	CreatedAt time.Time    `json:"created_at"`
+	ExpiresAt time.Time    `json:"expires_at,omitempty"`
+}
+
+// Runner runs background work. *Drainer satisfies it, so that exports are waited for on shutdown.
+type Runner interface {
+	Go(fn func()) error
+}
+
+// ExportManager generates exports in the background, stores them, and delivers a signed
+// download link when they are ready
+type ExportManager struct {
+	// Storage holds the generated files
+	Storage Storage
+	// Runner runs the generation. If nil, it runs behind DefaultGuard
+	Runner Runner
+	// Signer signs the download URLs
+	Signer *URLSigner
+	// BaseURL is the URL the download handler is mounted at, e.g. "https://example.com/exports"
+	BaseURL string
+	// Prefix is prepended to storage keys. Defaults to "exports/"
+	Prefix string
+	// TTL is how long an export may be downloaded for. Defaults to 24 hours
+	TTL time.Duration
+	// NeutralizeFormulas escapes CSV and XLSX cells which could be interpreted as formulas
+	NeutralizeFormulas bool
+	// Notify, if set, is called when an export is ready or has failed, e.g. WebhookNotifier or
+	// EmailNotifier
+	Notify func(ctx context.Context, e Export) error
+	// ErrorLog, if set, receives errors returned by Notify
+	ErrorLog func(err error)
+	// Resume, if set, gives downloads resume tokens and range support, so large exports can
+	// be resumed after their URLs expire. Its Storage must be the manager's, and its Handler
+	// mounted alongside DownloadHandler
+	Resume *ResumeTokens
+
+	mu      sync.Mutex
+	exports map[string]*Export
+}
+
+func (m *ExportManager) ttl() time.Duration {
+	if m.TTL > 0 {
+		return m.TTL
+	}
+	return 24 * time.Hour
+}
+
+func (m *ExportManager) prefix() string {
+	if m.Prefix != "" {
+		return m.Prefix
+	}
+	return "exports/"
+}
+
+func (m *ExportManager) logError(err error) {
+	if err != nil && m.ErrorLog != nil {
+		m.ErrorLog(err)
+	}
+}
+
+// Request starts generating an export of rows in the given format, and returns immediately.
+// Use Get, or the Notify callback, to find out when it is ready.
+func (m *ExportManager) Request(format ExportFormat, rows RowIterator) (Export, error) {
+	switch format {
+	case FormatCSV, FormatXLSX, FormatJSON:
+	default:
+		return Export{}, fmt.Errorf("unsupported format %q", format)
+	}
+	if m.Storage == nil || m.Signer == nil {
+		return Export{}, errors.New("export manager needs storage and a signer")
+	}
+
+	return m.start(format, func(w io.Writer) error {
+		if m.NeutralizeFormulas && format != FormatJSON {
+			rows = SafeRows(rows)
+		}
+		return WriteRows(w, format, rows)
+	})
+}
+
+// RequestArchive starts generating a ZIP archive export, written by write, and returns
+// immediately. Use Get, or the Notify callback, to find out when it is ready.
+func (m *ExportManager) RequestArchive(write func(ctx context.Context, zw *zip.Writer) error) (Export, error) {
+	if m.Storage == nil || m.Signer == nil {
+		return Export{}, errors.New("export manager needs storage and a signer")
+	}
+	return m.start(FormatZIP, func(w io.Writer) error {
+		zw := zip.NewWriter(w)
+		if err := write(context.Background(), zw); err != nil {
+			return err
+		}
+		return zw.Close()
+	})
+}
+
+func (m *ExportManager) start(format ExportFormat, write func(w io.Writer) error) (Export, error) {
+	id, err := randomHex(16)
+	if err != nil {
+		return Export{}, err
+	}
+
+	e := &Export{
+		ID:        id,
+		Format:    format,
+		Status:    ExportPending,
+		Key:       m.prefix() + id + "." + string(format),
+		CreatedAt: time.Now(),
+	}
+
+	m.mu.Lock()
+	if m.exports == nil {
+		m.exports = make(map[string]*Export)
+	}
+	m.exports[id] = e
+	// copied before the job starts, as it updates e
+	pending := *e
+	m.mu.Unlock()
+
+	job := func() { m.generate(e, write) }
+	if m.Runner != nil {
+		if err = m.Runner.Go(job); err != nil {
+			m.mu.Lock()
+			delete(m.exports, id)
+			m.mu.Unlock()
+			return Export{}, err
+		}
+	} else {
+		Go(job)
+	}
+
+	return pending, nil
+}
+
+func (m *ExportManager) generate(e *Export, write func(w io.Writer) error) {
+	ctx := context.Background()
+
+	pr, pw := io.Pipe()
+	// a panic in write fails the export, rather than leaving Put to store what was written
+	done := func(err error) { _ = pw.CloseWithError(err) }
+	if err := DefaultGuard.goErr(func() error { return write(pw) }, done); err != nil {
+		done(err)
+	}
+
+	err := m.Storage.Put(ctx, e.Key, pr)
+	pr.CloseWithError(err)
+
+	var signed string
+	expires := time.Now().Add(m.ttl())
+	if err == nil {
+		signed, err = m.Signer.Sign(strings.TrimSuffix(m.BaseURL, "/")+"/"+e.ID, expires)
+	}
+
+	m.mu.Lock()
+	if err != nil {
+		e.Status = ExportFailed
+		e.Error = err.Error()
+	} else {
+		e.Status = ExportReady
+		e.URL = signed
+		e.ExpiresAt = expires
+	}
+	snapshot := *e
+	m.mu.Unlock()
+
+	if m.Notify != nil {
+		m.logError(m.Notify(ctx, snapshot))
+	}
+}
+
+// Get returns the export with the given id
+func (m *ExportManager) Get(id string) (Export, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.exports[id]
+	if !ok {
+		return Export{}, false
+	}
+	return *e, true
+}
+
+// Cleanup deletes the files of expired exports, and forgets them. Call it periodically.
+func (m *ExportManager) Cleanup(ctx context.Context) error {
+	now := time.Now()
+
+	m.mu.Lock()
+	var expired []*Export
+	for id, e := range m.exports {
+		if e.Status == ExportFailed || (e.Status == ExportReady && now.After(e.ExpiresAt)) {
+			expired = append(expired, e)
+			delete(m.exports, id)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, e := range expired {
+		// a failed export may have stored its file before failing, or only part of it; exports
+		// under a legal hold stay in storage, though they are no longer served
+		err := m.Storage.Delete(ctx, e.Key)
+		if err != nil && !errors.Is(err, ErrObjectLocked) && !(e.Status == ExportFailed && errors.Is(err, ErrNotFound)) {
+			return err
+		}
+	}
+	return nil
+}
+
+// DownloadHandler serves exports from their signed URLs. Mount it at BaseURL, e.g.
+// mux.Handle("/exports/", http.StripPrefix("/exports", m.DownloadHandler())).
+func (m *ExportManager) DownloadHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var t Tools
+
+		// the signature covers the full path the client requested
+		if err := m.Signer.Verify(requestURL(r)); err != nil {
+			_ = t.ErrorJSON(w, err, http.StatusForbidden)
+			return
+		}
+
+		e, ok := m.Get(strings.Trim(r.URL.Path, "/"))
+		if !ok || e.Status != ExportReady {
+			_ = t.ErrorJSON(w, ErrNotFound, http.StatusNotFound)
+			return
+		}
+
+		if m.Resume != nil {
+			m.Resume.ServeObject(w, r, e.Key, fmt.Sprintf("export-%s.%s", e.ID, e.Format))
+			return
+		}
+
+		f, err := m.Storage.Get(r.Context(), e.Key)
+		if err != nil {
+			_ = t.ErrorJSON(w, err, http.StatusNotFound)
+			return
+		}
+		defer f.Close()
+
+		w.Header().Set("Content-Type", e.Format.ContentType())
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"export-%s.%s\"", e.ID, e.Format))
+		_, _ = io.Copy(w, f)
+	})
+}
+
+// WebhookNotifier returns an ExportManager Notify function which posts the export as JSON
+// to hookURL, failing on any non-2xx response
+func WebhookNotifier(client *http.Client, hookURL string) func(ctx context.Context, e Export) error {
+	return func(ctx context.Context, e Export) error {
+		var t Tools
+		status, err := t.PushJSONToRemote(client, hookURL, e)
+		if err != nil {
+			return err
+		}
+		if status < 200 || status > 299 {
+			return fmt.Errorf("export webhook returned status %d", status)
+		}
+		return nil
+	}
+}
+
+// EmailNotifier returns an ExportManager Notify function which emails the download link of a
+// ready export, or the reason it failed, to the given recipients through the SMTP server at
+// addr. auth may be nil; the connection is upgraded with STARTTLS when the server offers it.
+func EmailNotifier(addr string, auth smtp.Auth, from string, to ...string) func(ctx context.Context, e Export) error {
+	return func(ctx context.Context, e Export) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		sender, err := mail.ParseAddress(from)
+		if err != nil {
+			return fmt.Errorf("export email sender: %w", err)
+		}
+
+		subject := fmt.Sprintf("Your %s export is ready", e.Format)
+		body := fmt.Sprintf("Your export is ready. Download it before %s from:\r\n\r\n%s\r\n",
+			e.ExpiresAt.UTC().Format(time.RFC1123), e.URL)
+		if e.Status == ExportFailed {
+			subject = fmt.Sprintf("Your %s export failed", e.Format)
+			body = fmt.Sprintf("Your export could not be generated: %s\r\n", e.Error)
+		}
+
+		var msg strings.Builder
+		fmt.Fprintf(&msg, "From: %s\r\n", from)
+		fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+		fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+		fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+		msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+		msg.WriteString(body)
+
+		return smtp.SendMail(addr, auth, sender.Address, to, []byte(msg.String()))
+	}
+}
+
+// requestURL returns the URL of r as the client sent it, before any prefix was stripped
+func requestURL(r *http.Request) *url.URL {
+	u := *r.URL
+	if r.RequestURI != "" {
+		if parsed, err := url.ParseRequestURI(r.RequestURI); err == nil {
+			u.Path = parsed.Path
+		}
+	}
+	return &u
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,193 @@
+package toolkit
+
+import (
+	"archive/zip"
+	"context"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportManager(t *testing.T) {
+	dir, err := os.MkdirTemp("", "toolkit-export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	notified := make(chan Export, 1)
+	var drainer Drainer
+	m := ExportManager{
+		Storage: &FileStorage{Dir: dir},
+		Runner:  &drainer,
+		Signer:  &URLSigner{Key: []byte("export signing key, not very secret")},
+		BaseURL: "https://example.com/exports",
+		Notify: func(ctx context.Context, e Export) error {
+			notified <- e
+			return nil
+		},
+	}
+
+	e, err := m.Request(FormatCSV, testRows())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Status != ExportPending {
+		t.Error("expected a pending export, got", e.Status)
+	}
+
+	var ready Export
+	select {
+	case ready = <-notified:
+	case <-time.After(5 * time.Second):
+		t.Fatal("export was never ready")
+	}
+	if ready.Status != ExportReady || ready.URL == "" {
+		t.Fatal("expected a ready export with a url, got", ready)
+	}
+
+	// download through the signed url
+	u, _ := url.Parse(ready.URL)
+	handler := http.StripPrefix("/exports", m.DownloadHandler())
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", u.RequestURI(), nil))
+	if rr.Code != http.StatusOK {
+		t.Fatal("expected 200 downloading the export, got", rr.Code, rr.Body.String())
+	}
+	if !strings.HasPrefix(rr.Body.String(), "name,qty,note") {
+		t.Error("wrong export contents", rr.Body.String())
+	}
+
+	// a tampered signature is refused
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", strings.Replace(u.RequestURI(), "signature=", "signature=x", 1), nil))
+	if rr.Code != http.StatusForbidden {
+		t.Error("expected 403 with a bad signature, got", rr.Code)
+	}
+
+	// expired exports are cleaned up
+	m.mu.Lock()
+	m.exports[e.ID].ExpiresAt = time.Now().Add(-time.Second)
+	m.mu.Unlock()
+
+	if err = m.Cleanup(context.Background()); err != nil {
+		t.Error(err)
+	}
+	if _, ok := m.Get(e.ID); ok {
+		t.Error("expired export was not forgotten")
+	}
+	if _, err = m.Storage.Stat(context.Background(), "exports/"+e.ID+".csv"); err != ErrNotFound {
+		t.Error("expired export file was not deleted", err)
+	}
+
+	// a panicking write fails the export
+	defer func(l *log.Logger) { DefaultGuard.ErrorLog = l }(DefaultGuard.ErrorLog)
+	DefaultGuard.ErrorLog = log.New(io.Discard, "", 0)
+	if _, err = m.RequestArchive(func(ctx context.Context, zw *zip.Writer) error { panic("boom") }); err != nil {
+		t.Fatal(err)
+	}
+	var failed Export
+	select {
+	case failed = <-notified:
+		if failed.Status != ExportFailed || !strings.Contains(failed.Error, "boom") {
+			t.Errorf("expected a failed export, got %+v", failed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("export never finished")
+	}
+
+	// failed exports are cleaned up, with anything they stored
+	if err = m.Storage.Put(context.Background(), failed.Key, strings.NewReader("partial")); err != nil {
+		t.Fatal(err)
+	}
+	if err = m.Cleanup(context.Background()); err != nil {
+		t.Error(err)
+	}
+	if _, ok := m.Get(failed.ID); ok {
+		t.Error("failed export was not forgotten")
+	}
+	if _, err = m.Storage.Stat(context.Background(), failed.Key); err != ErrNotFound {
+		t.Error("failed export file was not deleted", err)
+	}
+
+	if _, err = m.Request("pdf", testRows()); err == nil {
+		t.Error("expected an error for an unsupported format")
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	client := NewTestClient(func(req *http.Request) *http.Response {
+		return &http.Response{
+			StatusCode: http.StatusInternalServerError,
+			Body:       http.NoBody,
+			Header:     make(http.Header),
+		}
+	})
+
+	notify := WebhookNotifier(client, "http://example.com/hook")
+	if err := notify(context.Background(), Export{ID: "1"}); err == nil {
+		t.Error("expected an error for a 500 response")
+	}
+}
+
+func TestEmailNotifier(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// a minimal SMTP server, which hands over the message it is sent
+	received := make(chan string, 1)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		tc := textproto.NewConn(c)
+		_ = tc.PrintfLine("220 localhost")
+		var data string
+		for {
+			line, err := tc.ReadLine()
+			if err != nil {
+				return
+			}
+			switch line {
+			case "DATA":
+				_ = tc.PrintfLine("354 go ahead")
+				b, _ := tc.ReadDotBytes()
+				data = string(b)
+				_ = tc.PrintfLine("250 ok")
+			case "QUIT":
+				_ = tc.PrintfLine("221 bye")
+				received <- data
+				return
+			default:
+				_ = tc.PrintfLine("250 ok")
+			}
+		}
+	}()
+
+	notify := EmailNotifier(l.Addr().String(), nil, "Exports <exports@example.com>", "jack@example.com")
+	e := Export{ID: "1", Format: FormatCSV, Status: ExportReady, URL: "https://example.com/exports/1?sig=x", ExpiresAt: time.Now()}
+	if err = notify(context.Background(), e); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := <-received
+	for _, want := range []string{"To: jack@example.com", "Subject: Your csv export is ready", e.URL} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("expected %q in the message, got %s", want, msg)
+		}
+	}
+}
@@ -0,0 +1,411 @@
+package toolkit
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+// maxExtractInput is the most of a file the built-in extractors read
+const maxExtractInput = 64 * 1024 * 1024
+
+// Extractor pulls plain text out of a document, such as for a search index
+type Extractor interface {
+	Extract(ctx context.Context, r io.Reader) (string, error)
+}
+
+// ExtractorFunc is a function which implements Extractor
+type ExtractorFunc func(ctx context.Context, r io.Reader) (string, error)
+
+// Extract implements Extractor
+func (f ExtractorFunc) Extract(ctx context.Context, r io.Reader) (string, error) {
+	return f(ctx, r)
+}
+
+// Built-in extractors, which read at most the first 64MB of a file. PDFExtractor only handles
+// text in the standard encodings, which covers most PDFs written by office software; use an
+// ExecExtractor running pdftotext for anything more.
+var (
+	PlainTextExtractor Extractor = ExtractorFunc(extractPlainText)
+	DOCXExtractor      Extractor = ExtractorFunc(extractDOCX)
+	PDFExtractor       Extractor = ExtractorFunc(extractPDF)
+)
+
+// ExecExtractor is an Extractor which runs an external command, which reads the document on
+// stdin and writes text to stdout, e.g. []string{"pdftotext", "-", "-"}
+type ExecExtractor struct {
+	Command []string
+	// Timeout bounds the command. Defaults to 30 seconds
+	Timeout time.Duration
+}
+
+// Extract implements Extractor
+func (e *ExecExtractor) Extract(ctx context.Context, r io.Reader) (string, error) {
+	if len(e.Command) == 0 {
+		return "", errors.New("no extract command")
+	}
+	out, err := runCommand(ctx, e.Timeout, e.Command, r, 0)
+	if err != nil {
+		return "", err
+	}
+	return strings.ToValidUTF8(string(out), ""), nil
+}
+
+// TextExtraction extracts the text of uploaded files and delivers it to an indexing callback.
+// Set it on Tools or Ingest, and it runs after each file is stored, for files with an
+// extractor for their detected type.
+type TextExtraction struct {
+	// Extractors maps MIME types to extractors, adding to or replacing the built-in ones for
+	// text/plain, application/pdf and DOCX. A type's parents are tried too, so text/plain
+	// also covers CSV, JSON and the like.
+	Extractors map[string]Extractor
+	// MaxText is the most text delivered for a file, in bytes. Defaults to 1MB
+	MaxText int
+	// Index receives the text of each file
+	Index func(ctx context.Context, file *UploadedFile, contentType, text string) error
+	// ErrorLog receives errors extracting and indexing, which don't fail the upload. Defaults
+	// to the standard logger
+	ErrorLog *log.Logger
+}
+
+var builtinExtractors = map[string]Extractor{
+	"text/plain":      PlainTextExtractor,
+	"application/pdf": PDFExtractor,
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document": DOCXExtractor,
+}
+
+// extractorFor returns the extractor for a detected type or one of its parents, if any
+func (te *TextExtraction) extractorFor(mt *mimetype.MIME) Extractor {
+	for ; mt != nil; mt = mt.Parent() {
+		for _, extractors := range []map[string]Extractor{te.Extractors, builtinExtractors} {
+			for contentType, e := range extractors {
+				if mt.Is(contentType) {
+					return e
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// run extracts and indexes the text of a stored file, logging any error
+func (te *TextExtraction) run(ctx context.Context, file *UploadedFile, mt *mimetype.MIME, r io.Reader) {
+	if te.Index == nil {
+		return
+	}
+	e := te.extractorFor(mt)
+	if e == nil {
+		return
+	}
+
+	text, err := e.Extract(ctx, r)
+	if err == nil {
+		maxText := te.MaxText
+		if maxText <= 0 {
+			maxText = 1024 * 1024
+		}
+		err = te.Index(ctx, file, mt.String(), truncateText(text, maxText))
+	}
+	if err != nil {
+		if te.ErrorLog != nil {
+			te.ErrorLog.Printf("extracting text from %s: %v", file.NewFileName, err)
+		} else {
+			log.Printf("extracting text from %s: %v", file.NewFileName, err)
+		}
+	}
+}
+
+// truncateText shortens text to at most n bytes, without splitting a character
+func truncateText(text string, n int) string {
+	if len(text) <= n {
+		return text
+	}
+	for n > 0 && !utf8.RuneStart(text[n]) {
+		n--
+	}
+	return text[:n]
+}
+
+func extractPlainText(ctx context.Context, r io.Reader) (string, error) {
+	b, err := io.ReadAll(io.LimitReader(r, maxExtractInput))
+	if err != nil {
+		return "", err
+	}
+	return strings.ToValidUTF8(string(b), ""), nil
+}
+
+// extractDOCX reads the paragraphs of a Word document's body
+func extractDOCX(ctx context.Context, r io.Reader) (string, error) {
+	b, err := io.ReadAll(io.LimitReader(r, maxExtractInput))
+	if err != nil {
+		return "", err
+	}
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return "", err
+	}
+	doc, err := zr.Open("word/document.xml")
+	if err != nil {
+		return "", err
+	}
+	defer doc.Close()
+
+	var text strings.Builder
+	inText := false
+	d := xml.NewDecoder(io.LimitReader(doc, maxExtractInput))
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			switch tok.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				text.WriteByte('\t')
+			case "br", "cr":
+				text.WriteByte('\n')
+			}
+		case xml.EndElement:
+			switch tok.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				text.WriteByte('\n')
+			}
+		case xml.CharData:
+			if inText {
+				text.Write(tok)
+			}
+		}
+	}
+	return strings.TrimSpace(text.String()), nil
+}
+
+// extractPDF reads the strings shown by the text operators of a PDF's content streams
+func extractPDF(ctx context.Context, r io.Reader) (string, error) {
+	b, err := io.ReadAll(io.LimitReader(r, maxExtractInput))
+	if err != nil {
+		return "", err
+	}
+	if !bytes.HasPrefix(b, []byte("%PDF-")) {
+		return "", errors.New("not a pdf")
+	}
+
+	var text strings.Builder
+	for rest := b; ; {
+		i := bytes.Index(rest, []byte("stream"))
+		if i < 0 {
+			break
+		}
+		// the stream's dictionary follows the start of its object
+		dict := rest[:i]
+		if j := bytes.LastIndex(dict, []byte(" obj")); j >= 0 {
+			dict = dict[j:]
+		}
+		start := i + len("stream")
+		if start < len(rest) && rest[start] == '\r' {
+			start++
+		}
+		if start < len(rest) && rest[start] == '\n' {
+			start++
+		}
+		end := bytes.Index(rest[start:], []byte("endstream"))
+		if end < 0 {
+			break
+		}
+		data := rest[start : start+end]
+		rest = rest[start+end+len("endstream"):]
+
+		if bytes.Contains(dict, []byte("/Image")) || bytes.Contains(dict, []byte("/Length1")) {
+			continue // images and embedded fonts
+		}
+		if bytes.Contains(dict, []byte("/FlateDecode")) {
+			zr, err := zlib.NewReader(bytes.NewReader(data))
+			if err != nil {
+				continue
+			}
+			// a truncated stream still yields what was decompressed
+			data, _ = io.ReadAll(io.LimitReader(zr, maxExtractInput))
+		} else if bytes.Contains(dict, []byte("/Filter")) {
+			continue
+		}
+		pdfContentText(&text, data)
+	}
+	return strings.TrimSpace(strings.ToValidUTF8(text.String(), "")), nil
+}
+
+// pdfOperand is an operand in a content stream: a string, a number, or an array bracket
+type pdfOperand struct {
+	text   string
+	number float64
+	kind   byte // '(' for strings, '0' for numbers, '[' or ']'
+}
+
+// pdfContentText writes the text shown by a content stream's operators
+func pdfContentText(text *strings.Builder, data []byte) {
+	var operands []pdfOperand
+	inText := false
+
+	for i := 0; i < len(data); {
+		c := data[i]
+		switch {
+		case c == '(':
+			s, n := pdfLiteralString(data[i:])
+			operands = append(operands, pdfOperand{text: s, kind: '('})
+			i += n
+		case c == '[' || c == ']':
+			operands = append(operands, pdfOperand{kind: c})
+			i++
+		case c == '<' && i+1 < len(data) && data[i+1] != '<':
+			// hex strings are usually glyph ids of embedded fonts, which can't be mapped back
+			end := bytes.IndexByte(data[i:], '>')
+			if end < 0 {
+				return
+			}
+			operands = append(operands, pdfOperand{kind: '('})
+			i += end + 1
+		case c == '%':
+			for i < len(data) && data[i] != '\n' && data[i] != '\r' {
+				i++
+			}
+		case pdfSpace(c) || c == '<' || c == '>' || c == '{' || c == '}' || c == '/':
+			i++
+		default:
+			j := i
+			for j < len(data) && !pdfSpace(data[j]) && !strings.ContainsRune("()<>[]{}/%", rune(data[j])) {
+				j++
+			}
+			word := string(data[i:j])
+			i = j
+			if n, err := strconv.ParseFloat(word, 64); err == nil {
+				operands = append(operands, pdfOperand{number: n, kind: '0'})
+				continue
+			}
+
+			switch word {
+			case "BT":
+				inText = true
+			case "ET":
+				inText = false
+				text.WriteByte('\n')
+			case "Tj", "'", "\"":
+				if inText && len(operands) > 0 {
+					if word != "Tj" {
+						text.WriteByte('\n')
+					}
+					text.WriteString(operands[len(operands)-1].text)
+				}
+			case "TJ":
+				if inText {
+					pdfTextArray(text, operands)
+				}
+			case "T*", "Td", "TD":
+				if inText {
+					text.WriteByte('\n')
+				}
+			}
+			operands = operands[:0]
+		}
+	}
+}
+
+// pdfTextArray writes the strings of a TJ array, with a space for large gaps between them
+func pdfTextArray(text *strings.Builder, operands []pdfOperand) {
+	start := len(operands)
+	for start > 0 && operands[start-1].kind != '[' {
+		start--
+	}
+	for _, op := range operands[start:] {
+		switch op.kind {
+		case ']':
+			return
+		case '0':
+			// gaps are in thousandths of the font size; a large one is a word break
+			if op.number < -200 {
+				text.WriteByte(' ')
+			}
+		default:
+			text.WriteString(op.text)
+		}
+	}
+}
+
+// pdfLiteralString decodes the literal string at the start of data, returning it and the
+// number of bytes it took
+func pdfLiteralString(data []byte) (string, int) {
+	var s strings.Builder
+	depth := 0
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch c {
+		case '(':
+			if depth > 0 {
+				s.WriteByte(c)
+			}
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return s.String(), i + 1
+			}
+			s.WriteByte(c)
+		case '\\':
+			i++
+			if i >= len(data) {
+				break
+			}
+			switch e := data[i]; e {
+			case 'n':
+				s.WriteByte('\n')
+			case 'r':
+				s.WriteByte('\r')
+			case 't':
+				s.WriteByte('\t')
+			case 'b', 'f':
+			case '\r', '\n':
+				// a line continuation
+				if e == '\r' && i+1 < len(data) && data[i+1] == '\n' {
+					i++
+				}
+			default:
+				if e >= '0' && e <= '7' {
+					n := 0
+					for k := 0; k < 3 && i < len(data) && data[i] >= '0' && data[i] <= '7'; k++ {
+						n = n*8 + int(data[i]-'0')
+						i++
+					}
+					i--
+					s.WriteRune(rune(n & 0xff))
+				} else {
+					s.WriteByte(e)
+				}
+			}
+		default:
+			// bytes are mapped as Latin-1, which matches the standard encodings for letters
+			s.WriteRune(rune(c))
+		}
+	}
+	return s.String(), len(data)
+}
+
+func pdfSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
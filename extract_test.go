@@ -0,0 +1,155 @@
+package toolkit
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"context"
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// testPDF returns a PDF with the content stream, compressed if flate is set
+func testPDF(t *testing.T, content string, flate bool) []byte {
+	data, filter := []byte(content), ""
+	if flate {
+		var buf bytes.Buffer
+		zw := zlib.NewWriter(&buf)
+		_, _ = zw.Write(data)
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		data, filter = buf.Bytes(), " /Filter /FlateDecode"
+	}
+
+	var pdf bytes.Buffer
+	pdf.WriteString("%PDF-1.4\n1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n")
+	fmt.Fprintf(&pdf, "4 0 obj\n<< /Length %d%s >>\nstream\n", len(data), filter)
+	pdf.Write(data)
+	pdf.WriteString("\nendstream\nendobj\ntrailer\n<< /Root 1 0 R >>\n%%EOF\n")
+	return pdf.Bytes()
+}
+
+func testDOCX(t *testing.T, body string) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	f, err := zw.Create("word/document.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintf(f, `<?xml version="1.0" encoding="UTF-8"?><w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>%s</w:body></w:document>`, body)
+	if err = zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestPDFExtractor(t *testing.T) {
+	var tests = []struct {
+		name    string
+		content string
+		flate   bool
+		exp     string
+	}{
+		{"show text", "BT /F1 12 Tf 72 712 Td (Hello world) Tj ET", false, "Hello world"},
+		{"compressed", "BT /F1 12 Tf (Quarterly report) Tj T* (Revenue \\(net\\) grew) Tj ET", true, "Quarterly report\nRevenue (net) grew"},
+		{"text array", "BT [(Hel) -20 (lo) -300 (world)] TJ ET", true, "Hello world"},
+		{"escapes", "BT (caf\\351 \\\\ ok) Tj ET", false, "café \\ ok"},
+		{"outside text", "(not text) Tj BT (text) Tj ET", false, "text"},
+	}
+
+	for _, e := range tests {
+		text, err := PDFExtractor.Extract(context.Background(), bytes.NewReader(testPDF(t, e.content, e.flate)))
+		if err != nil {
+			t.Errorf("%s: %v", e.name, err)
+			continue
+		}
+		if text != e.exp {
+			t.Errorf("%s: expected %q but got %q", e.name, e.exp, text)
+		}
+	}
+
+	if _, err := PDFExtractor.Extract(context.Background(), strings.NewReader("hello")); err == nil {
+		t.Error("expected an error for a file which isn't a pdf")
+	}
+}
+
+func TestDOCXExtractor(t *testing.T) {
+	docx := testDOCX(t, `<w:p><w:r><w:t>First</w:t></w:r><w:r><w:tab/><w:t xml:space="preserve">paragraph</w:t></w:r></w:p><w:p><w:r><w:t>Second</w:t><w:br/><w:t>line</w:t></w:r></w:p>`)
+
+	text, err := DOCXExtractor.Extract(context.Background(), bytes.NewReader(docx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := "First\tparagraph\nSecond\nline"; text != exp {
+		t.Errorf("expected %q but got %q", exp, text)
+	}
+
+	if _, err = DOCXExtractor.Extract(context.Background(), strings.NewReader("not a zip")); err == nil {
+		t.Error("expected an error for a file which isn't a docx")
+	}
+}
+
+func TestExecExtractor(t *testing.T) {
+	if _, err := exec.LookPath("tr"); err != nil {
+		t.Skip("tr is not installed")
+	}
+
+	e := &ExecExtractor{Command: []string{"tr", "a-z", "A-Z"}}
+	text, err := e.Extract(context.Background(), strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "HELLO" {
+		t.Errorf("expected HELLO but got %q", text)
+	}
+}
+
+func TestIngest_TextExtraction(t *testing.T) {
+	in := &Ingest{Storage: &FileStorage{Dir: t.TempDir()}, Prefix: "in/"}
+	var logged bytes.Buffer
+	indexed := make(map[string]string)
+	in.TextExtraction = &TextExtraction{
+		MaxText: 12,
+		Index: func(ctx context.Context, file *UploadedFile, contentType, text string) error {
+			if strings.Contains(text, "fail") {
+				return fmt.Errorf("index is down")
+			}
+			indexed[file.OriginalFileName] = text
+			return nil
+		},
+		ErrorLog: log.New(&logged, "", 0),
+	}
+
+	var tests = []struct {
+		name    string
+		content []byte
+		exp     string
+		indexed bool
+	}{
+		{"notes.txt", []byte("meeting notes"), "meeting note", true},
+		{"data.csv", []byte("a,b\n1,2\n"), "a,b\n1,2\n", true},
+		{"report.pdf", testPDF(t, "BT (Summary) Tj ET", true), "Summary", true},
+		{"letter.docx", testDOCX(t, `<w:p><w:r><w:t>Dear all</w:t></w:r></w:p>`), "Dear all", true},
+		{"pixel.gif", []byte("GIF89a\x01\x00\x01\x00\x00\x00\x00;"), "", false},
+		{"broken.txt", []byte("fail"), "", false},
+	}
+
+	for _, e := range tests {
+		if _, err := in.File(context.Background(), e.name, bytes.NewReader(e.content)); err != nil {
+			t.Errorf("%s: %v", e.name, err)
+			continue
+		}
+		text, ok := indexed[e.name]
+		if ok != e.indexed || text != e.exp {
+			t.Errorf("%s: expected %q (%v) but got %q (%v)", e.name, e.exp, e.indexed, text, ok)
+		}
+	}
+
+	if !strings.Contains(logged.String(), "index is down") {
+		t.Errorf("expected the index error to be logged, got %q", logged.String())
+	}
+}
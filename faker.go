@@ -0,0 +1,265 @@
+package toolkit
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"math/rand"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	fakeFirstNames = []string{"Ada", "Alan", "Amara", "Ben", "Carmen", "Chen", "Dara", "Elena", "Femi", "Grace", "Hugo", "Ines", "Jamal", "Kenji", "Lena", "Mateo", "Nadia", "Omar", "Priya", "Quinn", "Rosa", "Sam", "Tariq", "Uma", "Viktor", "Wen", "Yara", "Zoe"}
+	fakeLastNames  = []string{"Adeyemi", "Baker", "Castillo", "Dubois", "Eriksen", "Fischer", "Garcia", "Hughes", "Ito", "Jensen", "Kowalski", "Lopez", "Moreau", "Nguyen", "Okafor", "Patel", "Rossi", "Santos", "Tanaka", "Vargas", "Walker", "Young", "Zhang"}
+	fakeStreets    = []string{"Oak", "Maple", "Cedar", "Elm", "Willow", "Harbor", "Hill", "Lake", "Mill", "Park", "River", "Station", "Sunset", "Union", "Valley"}
+	fakeStreetEnds = []string{"Street", "Avenue", "Road", "Lane", "Drive", "Way", "Court", "Place"}
+	fakeCities     = []string{"Springfield", "Riverton", "Fairview", "Lakewood", "Greenville", "Brookside", "Ashford", "Milltown", "Clearwater", "Northgate", "Westbury", "Kingsport"}
+	fakeCountries  = []string{"US", "CA", "GB", "DE", "FR", "ES", "IT", "NL", "SE", "JP", "AU", "BR", "NG", "IN"}
+	fakeDomains    = []string{"example.com", "example.org", "example.net"}
+	fakeCompanies  = []string{"Labs", "Systems", "Works", "Partners", "Group", "Studio", "Logistics", "Foods"}
+	fakeWords      = strings.Fields("lorem ipsum dolor sit amet consectetur adipiscing elit sed do eiusmod tempor incididunt ut labore et dolore magna aliqua enim ad minim veniam quis nostrud exercitation ullamco laboris nisi aliquip ex ea commodo consequat duis aute irure in reprehenderit voluptate velit esse cillum fugiat nulla pariatur")
+)
+
+// FakeAddress is a postal address from Faker.Address
+type FakeAddress struct {
+	Street     string `json:"street"`
+	City       string `json:"city"`
+	PostalCode string `json:"postal_code"`
+	Country    string `json:"country"`
+}
+
+// Faker generates realistic fake data for tests and demos. Values are drawn from a seeded
+// source, so a Faker with the same seed produces the same values in the same order. Emails use
+// the example.com domains and phone numbers the fictional 555-01xx range, so nothing generated
+// reaches a real person. It is safe for concurrent use, though concurrent callers share one
+// sequence.
+type Faker struct {
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// NewFaker returns a Faker drawing from seed
+func NewFaker(seed int64) *Faker {
+	return &Faker{rand: rand.New(rand.NewSource(seed))}
+}
+
+func (f *Faker) intn(n int) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.rand.Intn(n)
+}
+
+func (f *Faker) pick(list []string) string {
+	return list[f.intn(len(list))]
+}
+
+// Int returns a number from lo to hi, inclusive
+func (f *Faker) Int(lo, hi int) int {
+	if hi <= lo {
+		return lo
+	}
+	return lo + f.intn(hi-lo+1)
+}
+
+// Bool returns true or false
+func (f *Faker) Bool() bool {
+	return f.intn(2) == 1
+}
+
+// FirstName returns a given name
+func (f *Faker) FirstName() string {
+	return f.pick(fakeFirstNames)
+}
+
+// LastName returns a family name
+func (f *Faker) LastName() string {
+	return f.pick(fakeLastNames)
+}
+
+// Name returns a full name
+func (f *Faker) Name() string {
+	return f.FirstName() + " " + f.LastName()
+}
+
+// Email returns an email address at one of the example.com domains
+func (f *Faker) Email() string {
+	first, last := f.FirstName(), f.LastName()
+	return fmt.Sprintf("%s.%s%d@%s", strings.ToLower(first), strings.ToLower(last), f.Int(1, 99), f.pick(fakeDomains))
+}
+
+// Username returns a user name
+func (f *Faker) Username() string {
+	return fmt.Sprintf("%s%s%d", strings.ToLower(f.FirstName()), strings.ToLower(f.LastName()[:1]), f.Int(10, 9999))
+}
+
+// Phone returns a phone number in the fictional 555-0100 to 555-0199 range
+func (f *Faker) Phone() string {
+	return fmt.Sprintf("+1 %03d-555-01%02d", f.Int(201, 989), f.Int(0, 99))
+}
+
+// Company returns a company name
+func (f *Faker) Company() string {
+	return f.LastName() + " " + f.pick(fakeCompanies)
+}
+
+// Address returns a postal address
+func (f *Faker) Address() FakeAddress {
+	return FakeAddress{
+		Street:     fmt.Sprintf("%d %s %s", f.Int(1, 9999), f.pick(fakeStreets), f.pick(fakeStreetEnds)),
+		City:       f.pick(fakeCities),
+		PostalCode: fmt.Sprintf("%05d", f.Int(1000, 99999)),
+		Country:    f.pick(fakeCountries),
+	}
+}
+
+// Word returns a lorem ipsum word
+func (f *Faker) Word() string {
+	return f.pick(fakeWords)
+}
+
+// Words returns n lorem ipsum words, separated by spaces
+func (f *Faker) Words(n int) string {
+	words := make([]string, n)
+	for i := range words {
+		words[i] = f.Word()
+	}
+	return strings.Join(words, " ")
+}
+
+// Sentence returns a capitalized sentence of 4 to 12 words
+func (f *Faker) Sentence() string {
+	s := f.Words(f.Int(4, 12))
+	return strings.ToUpper(s[:1]) + s[1:] + "."
+}
+
+// Paragraph returns 3 to 6 sentences
+func (f *Faker) Paragraph() string {
+	sentences := make([]string, f.Int(3, 6))
+	for i := range sentences {
+		sentences[i] = f.Sentence()
+	}
+	return strings.Join(sentences, " ")
+}
+
+// UUID returns a version 4 UUID drawn from the Faker's source, unlike Tools.UUID
+func (f *Faker) UUID() string {
+	b := make([]byte, 16)
+	f.mu.Lock()
+	f.rand.Read(b)
+	f.mu.Unlock()
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// Time returns a time from the range [from, to), truncated to seconds
+func (f *Faker) Time(from, to time.Time) time.Time {
+	span := to.Sub(from)
+	if span <= 0 {
+		return from
+	}
+	f.mu.Lock()
+	d := time.Duration(f.rand.Int63n(int64(span)))
+	f.mu.Unlock()
+	return from.Add(d).Truncate(time.Second)
+}
+
+// Image returns an encoded width x height image of a gradient and blocks in random colors, in
+// any format EncodeImage supports
+func (f *Faker) Image(width, height int, format ImageFormat) ([]byte, error) {
+	randomColor := func() color.RGBA {
+		return color.RGBA{uint8(f.intn(256)), uint8(f.intn(256)), uint8(f.intn(256)), 255}
+	}
+	from, to := randomColor(), randomColor()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			// blend diagonally from one color to the other
+			t := float64(x+y) / float64(width+height)
+			img.SetRGBA(x, y, color.RGBA{
+				uint8(float64(from.R)*(1-t) + float64(to.R)*t),
+				uint8(float64(from.G)*(1-t) + float64(to.G)*t),
+				uint8(float64(from.B)*(1-t) + float64(to.B)*t),
+				255,
+			})
+		}
+	}
+	for i := f.Int(2, 5); i > 0 && width > 1 && height > 1; i-- {
+		c := randomColor()
+		x0, y0 := f.intn(width), f.intn(height)
+		x1, y1 := x0+1+f.intn(width-x0), y0+1+f.intn(height-y0)
+		for y := y0; y < y1 && y < height; y++ {
+			for x := x0; x < x1 && x < width; x++ {
+				img.SetRGBA(x, y, c)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := EncodeImage(&buf, img, format, 0); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// fakeKinds are the values of fake tags understood by Fill
+var fakeKinds = map[string]func(f *Faker) string{
+	"first_name":  (*Faker).FirstName,
+	"last_name":   (*Faker).LastName,
+	"name":        (*Faker).Name,
+	"email":       (*Faker).Email,
+	"username":    (*Faker).Username,
+	"phone":       (*Faker).Phone,
+	"company":     (*Faker).Company,
+	"street":      func(f *Faker) string { return f.Address().Street },
+	"city":        func(f *Faker) string { return f.pick(fakeCities) },
+	"postal_code": func(f *Faker) string { return f.Address().PostalCode },
+	"country":     func(f *Faker) string { return f.pick(fakeCountries) },
+	"word":        (*Faker).Word,
+	"sentence":    (*Faker).Sentence,
+	"paragraph":   (*Faker).Paragraph,
+	"uuid":        (*Faker).UUID,
+}
+
+// Fill sets the string fields of the struct v points to which have a fake tag, such as
+// `fake:"email"`, recursing into nested structs. The tags are first_name, last_name, name,
+// email, username, phone, company, street, city, postal_code, country, word, sentence,
+// paragraph and uuid.
+func (f *Faker) Fill(v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("fill needs a pointer to a struct, not %T", v)
+	}
+	return f.fill(rv.Elem())
+}
+
+func (f *Faker) fill(v reflect.Value) error {
+	for i := 0; i < v.NumField(); i++ {
+		field, sf := v.Field(i), v.Type().Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		kind := sf.Tag.Get("fake")
+		if kind == "" {
+			if field.Kind() == reflect.Struct {
+				if err := f.fill(field); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		gen, ok := fakeKinds[kind]
+		if !ok {
+			return fmt.Errorf("%s: unknown fake tag %q", sf.Name, kind)
+		}
+		if field.Kind() != reflect.String {
+			return fmt.Errorf("%s: fake tags need a string field", sf.Name)
+		}
+		field.SetString(gen(f))
+	}
+	return nil
+}
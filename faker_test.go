@@ -0,0 +1,103 @@
+package toolkit
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFaker(t *testing.T) {
+	generate := func(f *Faker) []string {
+		a := f.Address()
+		return []string{f.Name(), f.Email(), f.Username(), f.Phone(), f.Company(), a.Street, a.City, a.PostalCode, a.Country, f.Sentence(), f.Paragraph(), f.UUID()}
+	}
+	first, second := generate(NewFaker(7)), generate(NewFaker(7))
+	if strings.Join(first, "|") != strings.Join(second, "|") {
+		t.Errorf("expected the same seed to give the same values, got %v and %v", first, second)
+	}
+	if strings.Join(first, "|") == strings.Join(generate(NewFaker(8)), "|") {
+		t.Error("expected another seed to give other values")
+	}
+
+	var tests = []struct {
+		name    string
+		value   string
+		pattern string
+	}{
+		{"name", first[0], `^[A-Z][a-z]+ [A-Z][a-z]+$`},
+		{"email", first[1], `^[a-z]+\.[a-z]+[0-9]+@example\.(com|org|net)$`},
+		{"phone", first[3], `^\+1 [0-9]{3}-555-01[0-9]{2}$`},
+		{"street", first[5], `^[0-9]+ [A-Z][a-z]+ [A-Z][a-z]+$`},
+		{"postal code", first[7], `^[0-9]{5}$`},
+		{"sentence", first[9], `^[A-Z][a-z ]+\.$`},
+		{"uuid", first[11], `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`},
+	}
+
+	for _, e := range tests {
+		if !regexp.MustCompile(e.pattern).MatchString(e.value) {
+			t.Errorf("%s: %q doesn't match %s", e.name, e.value, e.pattern)
+		}
+	}
+
+	f := NewFaker(1)
+	for i := 0; i < 100; i++ {
+		if n := f.Int(3, 5); n < 3 || n > 5 {
+			t.Fatalf("%d is out of range", n)
+		}
+	}
+	from := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	if tm := f.Time(from, from.Add(time.Hour)); tm.Before(from) || !tm.Before(from.Add(time.Hour)) {
+		t.Errorf("%v is out of range", tm)
+	}
+}
+
+func TestFaker_Image(t *testing.T) {
+	b, err := NewFaker(1).Image(64, 48, ImagePNG)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, format, err := DecodeImage(bytes.NewReader(b), 0)
+	if err != nil || format != ImagePNG || img.Bounds().Dx() != 64 || img.Bounds().Dy() != 48 {
+		t.Errorf("unexpected image %v %v", format, err)
+	}
+	if again, _ := NewFaker(1).Image(64, 48, ImagePNG); !bytes.Equal(b, again) {
+		t.Error("expected the same image from the same seed")
+	}
+	if _, err = NewFaker(1).Image(8, 8, "bmp"); err == nil {
+		t.Error("expected an error for an unsupported format")
+	}
+}
+
+func TestFaker_Fill(t *testing.T) {
+	var user struct {
+		ID      string `fake:"uuid"`
+		Name    string `fake:"name"`
+		Email   string `fake:"email"`
+		Age     int
+		Address struct {
+			City    string `fake:"city"`
+			Country string `fake:"country"`
+		}
+		note string
+	}
+	if err := NewFaker(3).Fill(&user); err != nil {
+		t.Fatal(err)
+	}
+	if user.ID == "" || user.Name == "" || !strings.Contains(user.Email, "@example.") || user.Address.City == "" || user.Address.Country == "" || user.Age != 0 {
+		t.Errorf("unexpected fill %+v", user)
+	}
+
+	var bad struct {
+		N int `fake:"name"`
+	}
+	var unknown struct {
+		S string `fake:"nope"`
+	}
+	for _, v := range []any{&bad, &unknown, user} {
+		if err := NewFaker(3).Fill(v); err == nil {
+			t.Errorf("expected an error filling %T", v)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package toolkit
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Fingerprint identifies the shape of a client, rather than who it claims to be
+type Fingerprint struct {
+	// Header is a hash of the set of header names sent, as clients built from the same
+	// library send the same set. Go's http server does not preserve header order.
+	Header string `json:"header"`
+	// TLS is a JA3-style hash of the TLS client hello, when a TLSFingerprinter is installed
+	TLS       string `json:"tls,omitempty"`
+	UserAgent string `json:"user_agent,omitempty"`
+	IP        string `json:"ip,omitempty"`
+	// Score is the bot score from 0 (human) to 100 (certainly a bot)
+	Score int `json:"score"`
+}
+
+type fingerprintContextKey struct{}
+
+// FingerprintFromContext returns the fingerprint stored by BotDefense's middleware
+func FingerprintFromContext(ctx context.Context) (Fingerprint, bool) {
+	fp, ok := ctx.Value(fingerprintContextKey{}).(Fingerprint)
+	return fp, ok
+}
+
+// TLSFingerprinter records a JA3-style fingerprint of each TLS client hello, so it can be
+// attached to the requests made over that connection. As Go does not expose the list of
+// extensions, that field of the fingerprint is always empty.
+type TLSFingerprinter struct {
+	mu    sync.Mutex
+	conns map[string]string
+}
+
+// Wrap returns a copy of a server tls.Config which records client hellos. Set ConnState as the
+// server's ConnState hook too, so that closed connections are forgotten.
+func (f *TLSFingerprinter) Wrap(cfg *tls.Config) *tls.Config {
+	wrapped := cfg.Clone()
+	next := cfg.GetConfigForClient
+
+	wrapped.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		if hello.Conn != nil {
+			f.mu.Lock()
+			if f.conns == nil {
+				f.conns = make(map[string]string)
+			}
+			f.conns[hello.Conn.RemoteAddr().String()] = ja3Hash(hello)
+			f.mu.Unlock()
+		}
+
+		if next != nil {
+			return next(hello)
+		}
+		return nil, nil
+	}
+	return wrapped
+}
+
+// ConnState forgets the fingerprint of closed connections. Use it as http.Server's ConnState.
+func (f *TLSFingerprinter) ConnState(conn net.Conn, state http.ConnState) {
+	if state != http.StateClosed && state != http.StateHijacked {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.conns, conn.RemoteAddr().String())
+}
+
+// Lookup returns the TLS fingerprint of the connection a request arrived on
+func (f *TLSFingerprinter) Lookup(r *http.Request) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.conns[r.RemoteAddr]
+}
+
+func ja3Hash(hello *tls.ClientHelloInfo) string {
+	var version uint16
+	for _, v := range hello.SupportedVersions {
+		if v > version && !isGREASE(v) {
+			version = v
+		}
+	}
+
+	join := func(values []uint16) string {
+		parts := make([]string, 0, len(values))
+		for _, v := range values {
+			if !isGREASE(v) {
+				parts = append(parts, strconv.Itoa(int(v)))
+			}
+		}
+		return strings.Join(parts, "-")
+	}
+
+	curves := make([]uint16, len(hello.SupportedCurves))
+	for i, c := range hello.SupportedCurves {
+		curves[i] = uint16(c)
+	}
+	points := make([]uint16, len(hello.SupportedPoints))
+	for i, p := range hello.SupportedPoints {
+		points[i] = uint16(p)
+	}
+
+	s := fmt.Sprintf("%d,%s,,%s,%s", version, join(hello.CipherSuites), join(curves), join(points))
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// isGREASE reports whether a value is one of the reserved values browsers send to keep
+// servers tolerant of unknown values, which vary between connections
+func isGREASE(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+// BotDefense fingerprints requests and scores how likely they are to come from a bot, so
+// suspicious clients can be challenged or refused before they reach expensive endpoints.
+type BotDefense struct {
+	// Score returns a bot score from 0 to 100. Defaults to DefaultBotScore
+	Score func(r *http.Request, fp Fingerprint) int
+	// ChallengeAt is the score at which Challenge is served instead of the request. Zero disables it
+	ChallengeAt int
+	// Challenge is served to suspicious clients, such as a captcha page. Defaults to a 429 JSON error
+	Challenge http.Handler
+	// BlockAt is the score at which requests are refused with a 403. Zero disables it
+	BlockAt int
+	// TLS, if set, adds the TLS fingerprint of each request's connection
+	TLS            *TLSFingerprinter
+	TrustedProxies []*net.IPNet
+}
+
+// Fingerprint computes the fingerprint and score of a request
+func (b *BotDefense) Fingerprint(r *http.Request) Fingerprint {
+	names := make([]string, 0, len(r.Header))
+	for name := range r.Header {
+		names = append(names, strings.ToLower(name))
+	}
+	sort.Strings(names)
+	sum := sha256.Sum256([]byte(strings.Join(names, ",")))
+
+	fp := Fingerprint{
+		Header:    hex.EncodeToString(sum[:8]),
+		UserAgent: r.UserAgent(),
+	}
+	if ip := requestClientIP(r, b.TrustedProxies); ip != nil {
+		fp.IP = ip.String()
+	}
+	if b.TLS != nil {
+		fp.TLS = b.TLS.Lookup(r)
+	}
+
+	score := b.Score
+	if score == nil {
+		score = DefaultBotScore
+	}
+	fp.Score = score(r, fp)
+	return fp
+}
+
+// DefaultBotScore scores requests by what browsers always send and scripts often leave out
+func DefaultBotScore(r *http.Request, fp Fingerprint) int {
+	score := 0
+	if fp.UserAgent == "" {
+		score += 50
+	} else if ParseUserAgent(fp.UserAgent).IsBot() {
+		score += 40
+	}
+	if r.Header.Get("Accept") == "" {
+		score += 15
+	}
+	if r.Header.Get("Accept-Language") == "" {
+		score += 20
+	}
+	if r.Header.Get("Accept-Encoding") == "" {
+		score += 15
+	}
+
+	if score > 100 {
+		score = 100
+	}
+	return score
+}
+
+// Middleware stores each request's fingerprint in its context, and challenges or refuses
+// clients whose score is too high
+func (b *BotDefense) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fp := b.Fingerprint(r)
+		r = r.WithContext(context.WithValue(r.Context(), fingerprintContextKey{}, fp))
+
+		var t Tools
+		switch {
+		case b.BlockAt > 0 && fp.Score >= b.BlockAt:
+			_ = t.ErrorJSON(w, errors.New("request refused"), http.StatusForbidden)
+		case b.ChallengeAt > 0 && fp.Score >= b.ChallengeAt:
+			if b.Challenge != nil {
+				b.Challenge.ServeHTTP(w, r)
+				return
+			}
+			_ = t.ErrorJSON(w, errors.New("too many requests"), http.StatusTooManyRequests)
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
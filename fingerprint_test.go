@@ -0,0 +1,85 @@
+package toolkit
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBotDefense_Middleware(t *testing.T) {
+	b := &BotDefense{ChallengeAt: 40, BlockAt: 80}
+	handler := b.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fp, ok := FingerprintFromContext(r.Context()); !ok || fp.Header == "" {
+			t.Error("fingerprint missing from context")
+		}
+	}))
+
+	browser := map[string]string{
+		"User-Agent":      "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+		"Accept":          "text/html",
+		"Accept-Language": "en-US",
+		"Accept-Encoding": "gzip",
+	}
+
+	var tests = []struct {
+		name     string
+		headers  map[string]string
+		expected int
+	}{
+		{"browser", browser, http.StatusOK},
+		{"curl", map[string]string{"User-Agent": "curl/8.0", "Accept": "*/*"}, http.StatusTooManyRequests},
+		{"bare", map[string]string{}, http.StatusForbidden},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("GET", "/upload", nil)
+		for k, v := range e.headers {
+			req.Header.Set(k, v)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != e.expected {
+			t.Errorf("%s: expected %d, got %d", e.name, e.expected, rr.Code)
+		}
+	}
+
+	// the same set of headers gives the same fingerprint, whatever the values
+	r1 := httptest.NewRequest("GET", "/", nil)
+	r1.Header.Set("X-A", "1")
+	r2 := httptest.NewRequest("GET", "/", nil)
+	r2.Header.Set("x-a", "2")
+	if b.Fingerprint(r1).Header != b.Fingerprint(r2).Header {
+		t.Error("expected matching header fingerprints")
+	}
+}
+
+func TestTLSFingerprinter(t *testing.T) {
+	var f TLSFingerprinter
+	b := &BotDefense{TLS: &f}
+
+	var got string
+	srv := httptest.NewUnstartedServer(b.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fp, _ := FingerprintFromContext(r.Context())
+		got = fp.TLS
+	})))
+	srv.TLS = f.Wrap(&tls.Config{})
+	srv.Config.ConnState = f.ConnState
+	srv.StartTLS()
+
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	req.Header.Set("Accept-Language", "en")
+	res, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	srv.Close()
+
+	if len(got) != 32 {
+		t.Errorf("expected a TLS fingerprint, got %q", got)
+	}
+	if len(f.conns) != 0 {
+		t.Errorf("expected closed connections to be forgotten, %d remain", len(f.conns))
+	}
+}
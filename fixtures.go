@@ -0,0 +1,286 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// FixtureKey is the record field naming a fixture record for refs. It is removed before the
+// record is inserted.
+const FixtureKey = "_key"
+
+// InsertFunc inserts a fixture record. It may set fields of the record, such as an ID the
+// database assigned, for later records to refer to.
+type InsertFunc func(ctx context.Context, record map[string]any) error
+
+// FixtureSet is a set of records of one kind, such as the rows of a table
+type FixtureSet struct {
+	// DependsOn names the sets which must be seeded first
+	DependsOn []string         `json:"depends_on"`
+	Records   []map[string]any `json:"records"`
+}
+
+// Seeder loads fixture files and inserts their records, for demo environments and tests. A
+// fixture file maps set names to sets, in JSON or YAML:
+//
+//	users:
+//	  records:
+//	    - _key: alice
+//	      id: "{{ uuid }}"
+//	      email: "alice-{{ randomString 6 }}@example.com"
+//	posts:
+//	  depends_on: [users]
+//	  records:
+//	    - author_id: '{{ ref "users.alice.id" }}'
+//	      title: "Post {{ .Index }}"
+//
+// Strings are text/template templates, with the functions uuid, randomString n, now (in
+// RFC 3339) and ref "set.key.field", and the record's set name and Index in the set as data.
+// A string which is only a ref keeps the referenced value's type. Numbers are float64, as with
+// encoding/json. A Seeder isn't safe for concurrent use.
+type Seeder struct {
+	// Insert holds the function inserting each set's records, by set name
+	Insert map[string]InsertFunc
+	// Funcs are extra template functions
+	Funcs template.FuncMap
+
+	sets   map[string]*FixtureSet
+	seeded map[string]map[string]map[string]any
+}
+
+var fixtureRef = regexp.MustCompile(`^\{\{-?\s*ref\s+"([^"]*)"\s*-?\}\}$`)
+
+// Load adds the sets in a fixture file's contents, which are YAML if name ends in .yaml or
+// .yml and JSON otherwise. Records of a set loaded from several files are seeded in the order
+// they were loaded.
+func (s *Seeder) Load(name string, data []byte) error {
+	if ext := path.Ext(name); ext == ".yaml" || ext == ".yml" {
+		v, err := parseYAML(data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if data, err = json.Marshal(v); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	var sets map[string]FixtureSet
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&sets); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	if s.sets == nil {
+		s.sets = make(map[string]*FixtureSet)
+	}
+	for setName, set := range sets {
+		existing, ok := s.sets[setName]
+		if !ok {
+			existing = &FixtureSet{}
+			s.sets[setName] = existing
+		}
+		existing.DependsOn = append(existing.DependsOn, set.DependsOn...)
+		existing.Records = append(existing.Records, set.Records...)
+	}
+	return nil
+}
+
+// LoadFile loads a fixture file
+func (s *Seeder) LoadFile(filename string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	return s.Load(filename, data)
+}
+
+// LoadFS loads the fixture files in fsys matching pattern, such as "fixtures/*.yaml", in
+// lexical order
+func (s *Seeder) LoadFS(fsys fs.FS, pattern string) error {
+	names, err := fs.Glob(fsys, pattern)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		if err = s.Load(name, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Seed inserts the loaded records, each set after the sets it depends on. Templates are
+// rendered again by every call, so each seeding gets new random values.
+func (s *Seeder) Seed(ctx context.Context) error {
+	order, err := s.order()
+	if err != nil {
+		return err
+	}
+	for _, name := range order {
+		if _, ok := s.Insert[name]; !ok && len(s.sets[name].Records) > 0 {
+			return fmt.Errorf("no insert function for fixture set %s", name)
+		}
+	}
+
+	s.seeded = make(map[string]map[string]map[string]any)
+	var t Tools
+	funcs := template.FuncMap{
+		"uuid":         t.UUID,
+		"randomString": t.RandomString,
+		"now":          func() string { return time.Now().UTC().Format(time.RFC3339) },
+		"ref":          s.ref,
+	}
+	for k, f := range s.Funcs {
+		funcs[k] = f
+	}
+
+	for _, name := range order {
+		s.seeded[name] = make(map[string]map[string]any)
+		for i, fixture := range s.sets[name].Records {
+			if err = ctx.Err(); err != nil {
+				return err
+			}
+			data := struct {
+				Set   string
+				Index int
+			}{name, i}
+			v, err := renderFixture(fixture, funcs, data, s.ref)
+			if err != nil {
+				return fmt.Errorf("fixture %s[%d]: %w", name, i, err)
+			}
+			record := v.(map[string]any)
+			key, _ := record[FixtureKey].(string)
+			delete(record, FixtureKey)
+
+			if err = s.Insert[name](ctx, record); err != nil {
+				return fmt.Errorf("inserting fixture %s[%d]: %w", name, i, err)
+			}
+			if key != "" {
+				s.seeded[name][key] = record
+			}
+		}
+	}
+	return nil
+}
+
+// Record returns a seeded record by its set and key, as inserted
+func (s *Seeder) Record(set, key string) (map[string]any, bool) {
+	r, ok := s.seeded[set][key]
+	return r, ok
+}
+
+func (s *Seeder) ref(name string) (any, error) {
+	parts := strings.SplitN(name, ".", 3)
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("ref %q is not set.key.field", name)
+	}
+	record, ok := s.seeded[parts[0]][parts[1]]
+	if !ok {
+		return nil, fmt.Errorf("ref %q: no such record has been seeded", name)
+	}
+	v, ok := record[parts[2]]
+	if !ok {
+		return nil, fmt.Errorf("ref %q: the record has no such field", name)
+	}
+	return v, nil
+}
+
+// order sorts the sets so each comes after its dependencies
+func (s *Seeder) order() ([]string, error) {
+	names := make([]string, 0, len(s.sets))
+	for name := range s.sets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var order []string
+	state := make(map[string]int) // 1 while visiting, 2 once ordered
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case 1:
+			return fmt.Errorf("fixture dependency cycle: %s -> %s", strings.Join(path, " -> "), name)
+		case 2:
+			return nil
+		}
+		set, ok := s.sets[name]
+		if !ok {
+			return fmt.Errorf("fixture set %s depends on unknown set %s", path[len(path)-1], name)
+		}
+		state[name] = 1
+		for _, dep := range set.DependsOn {
+			if err := visit(dep, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = 2
+		order = append(order, name)
+		return nil
+	}
+	for _, name := range names {
+		if err := visit(name, nil); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// renderFixture copies a fixture value, rendering the templates in its strings
+func renderFixture(v any, funcs template.FuncMap, data any, ref func(string) (any, error)) (any, error) {
+	switch v := v.(type) {
+	case string:
+		if !strings.Contains(v, "{{") {
+			return v, nil
+		}
+		if m := fixtureRef.FindStringSubmatch(v); m != nil {
+			return ref(m[1])
+		}
+		tmpl, err := template.New("fixture").Funcs(funcs).Option("missingkey=error").Parse(v)
+		if err != nil {
+			return nil, err
+		}
+		var b strings.Builder
+		if err = tmpl.Execute(&b, data); err != nil {
+			return nil, err
+		}
+		return b.String(), nil
+
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, e := range v {
+			r, err := renderFixture(e, funcs, data, ref)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = r
+		}
+		return out, nil
+
+	case []any:
+		out := make([]any, len(v))
+		for i, e := range v {
+			r, err := renderFixture(e, funcs, data, ref)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = r
+		}
+		return out, nil
+	}
+	return v, nil
+}
@@ -0,0 +1,116 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestSeeder_Seed(t *testing.T) {
+	fsys := fstest.MapFS{
+		"fixtures/posts.json": {Data: []byte(`{"posts": {"depends_on": ["users"], "records": [
+			{"author_id": "{{ ref \"users.alice.id\" }}", "title": "Post {{ .Index }} by {{ ref \"users.alice.name\" }}", "tags": ["{{ .Set }}"]}
+		]}}`)},
+		"fixtures/users.yaml": {Data: []byte(`
+users:
+  records:
+    - _key: alice
+      name: Alice
+      token: "{{ randomString 8 }}"
+    - _key: bob
+      name: Bob
+      external_id: "{{ uuid }}"
+      manager: '{{ ref "users.alice.id" }}'
+`)},
+		"fixtures/readme.txt": {Data: []byte("not a fixture")},
+	}
+
+	var inserted []string
+	nextID := 0.0
+	insert := func(set string) InsertFunc {
+		return func(_ context.Context, record map[string]any) error {
+			nextID++
+			record["id"] = nextID
+			inserted = append(inserted, set)
+			return nil
+		}
+	}
+
+	s := &Seeder{Insert: map[string]InsertFunc{"users": insert("users"), "posts": insert("posts")}}
+	if err := s.LoadFS(fsys, "fixtures/*.*son"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.LoadFS(fsys, "fixtures/*.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Seed(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(inserted, ",") != "users,users,posts" {
+		t.Errorf("expected users before posts, got %v", inserted)
+	}
+	alice, _ := s.Record("users", "alice")
+	bob, _ := s.Record("users", "bob")
+	if _, ok := alice[FixtureKey]; ok || len(alice["token"].(string)) != 8 {
+		t.Errorf("unexpected record %v", alice)
+	}
+	if bob["manager"] != 1.0 || len(bob["external_id"].(string)) != 36 {
+		t.Errorf("expected a typed ref and a uuid, got %v", bob)
+	}
+
+	// posts have no key, so check them through a second seeding
+	var post map[string]any
+	s.Insert["posts"] = func(_ context.Context, record map[string]any) error {
+		post = record
+		return nil
+	}
+	if err := s.Seed(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if post["author_id"] != 4.0 || post["title"] != "Post 0 by Alice" || post["tags"].([]any)[0] != "posts" {
+		t.Errorf("unexpected post %v", post)
+	}
+}
+
+func TestSeeder_Errors(t *testing.T) {
+	noop := func(context.Context, map[string]any) error { return nil }
+	var tests = []struct {
+		name    string
+		file    string
+		fixture string
+		inserts []string
+		errText string
+	}{
+		{"cycle", "f.json", `{"a": {"depends_on": ["b"], "records": [{}]}, "b": {"depends_on": ["a"], "records": [{}]}}`, []string{"a", "b"}, "cycle: a -> b -> a"},
+		{"unknown dependency", "f.json", `{"a": {"depends_on": ["nope"]}}`, nil, "unknown set nope"},
+		{"no insert function", "f.json", `{"a": {"records": [{}]}}`, nil, "no insert function"},
+		{"missing ref", "f.yml", "a:\n  records:\n    - x: '{{ ref \"a.nope.id\" }}'\n", []string{"a"}, "no such record"},
+		{"bad template", "f.json", `{"a": {"records": [{"x": "{{ nope }}"}]}}`, []string{"a"}, "nope"},
+		{"unknown field", "f.json", `{"a": {"rows": []}}`, nil, "unknown field"},
+		{"bad yaml", "f.yaml", "a:\n  records: [\n", nil, "yaml"},
+	}
+
+	for _, e := range tests {
+		s := &Seeder{Insert: make(map[string]InsertFunc)}
+		for _, name := range e.inserts {
+			s.Insert[name] = noop
+		}
+		err := s.Load(e.file, []byte(e.fixture))
+		if err == nil {
+			err = s.Seed(context.Background())
+		}
+		if err == nil || !strings.Contains(err.Error(), e.errText) {
+			t.Errorf("%s: expected an error containing %q, got %v", e.name, e.errText, err)
+		}
+	}
+
+	failed := errors.New("insert failed")
+	s := &Seeder{Insert: map[string]InsertFunc{"a": func(context.Context, map[string]any) error { return failed }}}
+	_ = s.Load("f.json", []byte(`{"a": {"records": [{}]}}`))
+	if err := s.Seed(context.Background()); !errors.Is(err, failed) {
+		t.Errorf("expected the insert error, got %v", err)
+	}
+}
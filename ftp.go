@@ -0,0 +1,648 @@
+package toolkit
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FTPStorage is a Storage on an FTP server, such as a partner's drop for generated exports.
+// With TLS set it uses explicit FTPS (AUTH TLS), protecting both the control and data
+// connections. Connections are pooled between operations. It implements RangeGetter, so
+// interrupted downloads resume from an offset, and Resume continues interrupted uploads.
+type FTPStorage struct {
+	// Addr is the server's host and port. The port defaults to 21
+	Addr string
+	// Username and Password default to an anonymous login
+	Username string
+	Password string
+	// Dir is the directory on the server that keys are relative to. Defaults to the login
+	// directory
+	Dir string
+	// TLS, if set, secures the connections with explicit FTPS
+	TLS *tls.Config
+	// ImplicitTLS uses TLS from the start, as on port 990, rather than AUTH TLS. TLS must be set
+	ImplicitTLS bool
+	// MaxIdle is the number of idle connections kept for reuse. Defaults to 2
+	MaxIdle int
+	// Timeout limits each command, and each read or write of a transfer, without a context
+	// deadline. Defaults to 30 seconds
+	Timeout time.Duration
+
+	mu       sync.Mutex
+	idle     []*ftpConn
+	tlsCache tls.ClientSessionCache
+}
+
+type ftpConn struct {
+	conn net.Conn
+	text *textproto.Conn
+	host string
+	tls  *tls.Config
+	// deadline is the operation's context deadline, or zero to allow timeout for each step
+	deadline time.Time
+	timeout  time.Duration
+	// broken connections are not returned to the pool
+	broken bool
+}
+
+// ftpError is a negative reply from the server
+type ftpError struct {
+	Code int
+	Msg  string
+}
+
+func (e *ftpError) Error() string {
+	return fmt.Sprintf("ftp: %d %s", e.Code, e.Msg)
+}
+
+func isFTPNotFound(err error) bool {
+	var fe *ftpError
+	return errors.As(err, &fe) && fe.Code == 550
+}
+
+func (fs *FTPStorage) path(key string) (string, error) {
+	clean := path.Clean("/" + key)
+	if key == "" || clean == "/" || strings.ContainsAny(key, "\r\n") {
+		return "", ErrInvalidKey
+	}
+	if fs.Dir == "" {
+		return strings.TrimPrefix(clean, "/"), nil
+	}
+	return path.Join(fs.Dir, clean), nil
+}
+
+func (fs *FTPStorage) timeout() time.Duration {
+	if fs.Timeout > 0 {
+		return fs.Timeout
+	}
+	return 30 * time.Second
+}
+
+// conn takes a pooled connection, or dials a new one
+func (fs *FTPStorage) conn(ctx context.Context) (*ftpConn, error) {
+	deadline, _ := ctx.Deadline()
+
+	fs.mu.Lock()
+	for len(fs.idle) > 0 {
+		c := fs.idle[len(fs.idle)-1]
+		fs.idle = fs.idle[:len(fs.idle)-1]
+		fs.mu.Unlock()
+		c.deadline, c.timeout = deadline, fs.timeout()
+		// the server may have closed an idle connection
+		if _, err := c.cmd(200, "NOOP"); err == nil {
+			return c, nil
+		}
+		c.conn.Close()
+		fs.mu.Lock()
+	}
+	if fs.TLS != nil && fs.tlsCache == nil {
+		fs.tlsCache = tls.NewLRUClientSessionCache(8)
+	}
+	fs.mu.Unlock()
+	return fs.dial(ctx, deadline)
+}
+
+func (fs *FTPStorage) dial(ctx context.Context, ctxDeadline time.Time) (*ftpConn, error) {
+	addr := fs.Addr
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "21")
+	}
+	host, _, _ := net.SplitHostPort(addr)
+
+	var tlsConfig *tls.Config
+	if fs.TLS != nil {
+		tlsConfig = fs.TLS.Clone()
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = host
+		}
+		// servers commonly require data connections to resume the control connection's session
+		if tlsConfig.ClientSessionCache == nil {
+			tlsConfig.ClientSessionCache = fs.tlsCache
+		}
+	}
+
+	deadline := ctxDeadline
+	if deadline.IsZero() {
+		deadline = time.Now().Add(fs.timeout())
+	}
+	dialer := net.Dialer{Deadline: deadline}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	_ = conn.SetDeadline(deadline)
+	if fs.ImplicitTLS {
+		if tlsConfig == nil {
+			conn.Close()
+			return nil, errors.New("ftp: implicit TLS needs a TLS config")
+		}
+		conn = tls.Client(conn, tlsConfig)
+	}
+	c := &ftpConn{conn: conn, text: textproto.NewConn(conn), host: host, deadline: ctxDeadline, timeout: fs.timeout()}
+
+	if _, _, err = c.text.ReadResponse(220); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if tlsConfig != nil && !fs.ImplicitTLS {
+		if _, err = c.cmd(234, "AUTH TLS"); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		c.conn = tls.Client(conn, tlsConfig)
+		c.text = textproto.NewConn(c.conn)
+	}
+	if tlsConfig != nil {
+		c.tls = tlsConfig
+		if _, err = c.cmd(200, "PBSZ 0"); err == nil {
+			_, err = c.cmd(200, "PROT P")
+		}
+		if err != nil {
+			c.conn.Close()
+			return nil, err
+		}
+	}
+
+	user, password := fs.Username, fs.Password
+	if user == "" {
+		user, password = "anonymous", "anonymous@"
+	}
+	code, err := c.cmd(0, "USER %s", user)
+	if err == nil && code == 331 {
+		_, err = c.cmd(230, "PASS %s", password)
+	} else if err == nil && code != 230 {
+		err = &ftpError{Code: code, Msg: "unexpected reply to USER"}
+	}
+	if err == nil {
+		_, err = c.cmd(200, "TYPE I")
+	}
+	if err != nil {
+		c.conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// release returns a connection to the pool, or closes it
+func (fs *FTPStorage) release(c *ftpConn) {
+	maxIdle := fs.MaxIdle
+	if maxIdle <= 0 {
+		maxIdle = 2
+	}
+	fs.mu.Lock()
+	if !c.broken && len(fs.idle) < maxIdle {
+		_ = c.conn.SetDeadline(time.Time{})
+		fs.idle = append(fs.idle, c)
+		fs.mu.Unlock()
+		return
+	}
+	fs.mu.Unlock()
+	if !c.broken {
+		_, _ = c.cmd(221, "QUIT")
+	}
+	c.conn.Close()
+}
+
+// Close closes the idle connections
+func (fs *FTPStorage) Close() error {
+	fs.mu.Lock()
+	idle := fs.idle
+	fs.idle = nil
+	fs.mu.Unlock()
+	for _, c := range idle {
+		_, _ = c.cmd(221, "QUIT")
+		c.conn.Close()
+	}
+	return nil
+}
+
+// extend sets the connection's deadline for the next step of an operation
+func (c *ftpConn) extend(conn net.Conn) {
+	if c.deadline.IsZero() {
+		_ = conn.SetDeadline(time.Now().Add(c.timeout))
+	} else {
+		_ = conn.SetDeadline(c.deadline)
+	}
+}
+
+// cmd sends a command and reads its reply, which must have the expected code, or its first
+// digit if expected is below 10. An expected code of zero accepts any positive reply.
+func (c *ftpConn) cmd(expected int, format string, args ...any) (int, error) {
+	c.extend(c.conn)
+	if _, err := c.text.Cmd(format, args...); err != nil {
+		c.broken = true
+		return 0, err
+	}
+	return c.reply(expected)
+}
+
+func (c *ftpConn) reply(expected int) (int, error) {
+	code, msg, err := c.text.ReadResponse(0)
+	if err != nil {
+		var perr textproto.ProtocolError
+		if !errors.As(err, &perr) {
+			c.broken = true
+		}
+		return code, err
+	}
+	ok := code < 400
+	if expected > 0 {
+		ok = code == expected
+		if expected < 10 {
+			ok = code/100 == expected
+		}
+	}
+	if !ok {
+		return code, &ftpError{Code: code, Msg: msg}
+	}
+	return code, nil
+}
+
+// data opens a passive data connection, preferring EPSV
+func (c *ftpConn) data(ctx context.Context) (net.Conn, error) {
+	var port string
+	if _, err := c.text.Cmd("EPSV"); err != nil {
+		c.broken = true
+		return nil, err
+	}
+	code, msg, err := c.text.ReadResponse(229)
+	if err == nil {
+		// "Entering Extended Passive Mode (|||port|)"
+		start, end := strings.Index(msg, "(|||"), strings.LastIndex(msg, "|)")
+		if start < 0 || end < start+4 {
+			return nil, fmt.Errorf("ftp: invalid EPSV reply %q", msg)
+		}
+		port = msg[start+4 : end]
+	} else {
+		if code == 0 {
+			c.broken = true
+			return nil, err
+		}
+		if _, err = c.text.Cmd("PASV"); err != nil {
+			c.broken = true
+			return nil, err
+		}
+		if _, msg, err = c.text.ReadResponse(227); err != nil {
+			return nil, err
+		}
+		// "Entering Passive Mode (h1,h2,h3,h4,p1,p2)"; the address is ignored, as it is often
+		// a private one behind NAT
+		start, end := strings.Index(msg, "("), strings.Index(msg, ")")
+		if start < 0 || end < start {
+			return nil, fmt.Errorf("ftp: invalid PASV reply %q", msg)
+		}
+		parts := strings.Split(msg[start+1:end], ",")
+		if len(parts) != 6 {
+			return nil, fmt.Errorf("ftp: invalid PASV reply %q", msg)
+		}
+		hi, _ := strconv.Atoi(parts[4])
+		lo, _ := strconv.Atoi(parts[5])
+		port = strconv.Itoa(hi<<8 | lo)
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(c.host, port))
+	if err != nil {
+		return nil, err
+	}
+	c.extend(conn)
+	if c.tls != nil {
+		conn = tls.Client(conn, c.tls)
+	}
+	if c.deadline.IsZero() {
+		return &ftpDataConn{Conn: conn, c: c}, nil
+	}
+	return conn, nil
+}
+
+// ftpDataConn extends the deadline of a data connection before each read or write, so that
+// a transfer may take longer than the timeout as long as it makes progress
+type ftpDataConn struct {
+	net.Conn
+	c *ftpConn
+}
+
+func (d *ftpDataConn) Read(p []byte) (int, error) {
+	d.c.extend(d.Conn)
+	return d.Conn.Read(p)
+}
+
+func (d *ftpDataConn) Write(p []byte) (int, error) {
+	d.c.extend(d.Conn)
+	return d.Conn.Write(p)
+}
+
+// transfer opens a data connection and sends a transfer command on it
+func (c *ftpConn) transfer(ctx context.Context, format string, args ...any) (net.Conn, error) {
+	conn, err := c.data(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = c.cmd(1, format, args...); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// finish closes a data connection and reads the transfer's final reply
+func (c *ftpConn) finish(conn net.Conn) error {
+	if err := conn.Close(); err != nil {
+		c.broken = true
+	}
+	// the transfer may have outlasted the deadline set when it started
+	c.extend(c.conn)
+	_, err := c.reply(2)
+	return err
+}
+
+// mkdirs creates the directories of p, ignoring those which exist
+func (c *ftpConn) mkdirs(p string) {
+	dir := path.Dir(p)
+	if dir == "." || dir == "/" {
+		return
+	}
+	prefix := ""
+	if strings.HasPrefix(dir, "/") {
+		prefix = "/"
+	}
+	for _, part := range strings.Split(strings.Trim(dir, "/"), "/") {
+		prefix = path.Join(prefix, part)
+		_, _ = c.cmd(257, "MKD %s", prefix)
+	}
+}
+
+func (fs *FTPStorage) upload(ctx context.Context, command, key string, r io.Reader) error {
+	p, err := fs.path(key)
+	if err != nil {
+		return err
+	}
+	c, err := fs.conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer fs.release(c)
+
+	c.mkdirs(p)
+	conn, err := c.transfer(ctx, "%s %s", command, p)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(conn, contextReader{ctx, r}); err != nil {
+		conn.Close()
+		c.broken = true
+		return err
+	}
+	return c.finish(conn)
+}
+
+// Put uploads the object
+func (fs *FTPStorage) Put(ctx context.Context, key string, r io.Reader) error {
+	return fs.upload(ctx, "STOR", key, r)
+}
+
+// Resume continues an interrupted upload of r to key, skipping the bytes the server already
+// has and appending the rest
+func (fs *FTPStorage) Resume(ctx context.Context, key string, r io.ReadSeeker) error {
+	var offset int64
+	info, err := fs.Stat(ctx, key)
+	switch {
+	case err == nil:
+		offset = info.Size
+	case !errors.Is(err, ErrNotFound):
+		return err
+	}
+	if _, err = r.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	return fs.upload(ctx, "APPE", key, r)
+}
+
+// Get opens the object for reading. The connection is held until the reader is closed.
+func (fs *FTPStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	return fs.GetRange(ctx, key, 0, -1)
+}
+
+// GetRange opens length bytes of the object from offset, or the rest of it if length is
+// negative
+func (fs *FTPStorage) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	p, err := fs.path(key)
+	if err != nil {
+		return nil, err
+	}
+	c, err := fs.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if offset > 0 {
+		if _, err = c.cmd(350, "REST %d", offset); err != nil {
+			fs.release(c)
+			return nil, err
+		}
+	}
+	conn, err := c.transfer(ctx, "RETR %s", p)
+	if err != nil {
+		fs.release(c)
+		if isFTPNotFound(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	var r io.Reader = conn
+	if length >= 0 {
+		r = io.LimitReader(conn, length)
+	}
+	return &ftpReader{Reader: r, conn: conn, c: c, fs: fs, partial: length >= 0}, nil
+}
+
+type ftpReader struct {
+	io.Reader
+	conn    net.Conn
+	c       *ftpConn
+	fs      *FTPStorage
+	partial bool
+	once    sync.Once
+}
+
+func (r *ftpReader) Close() error {
+	var err error
+	r.once.Do(func() {
+		if r.partial {
+			// an aborted transfer leaves the control connection's state unclear
+			r.conn.Close()
+			r.c.broken = true
+		} else {
+			err = r.c.finish(r.conn)
+		}
+		r.fs.release(r.c)
+	})
+	return err
+}
+
+// Stat describes the object, from its size and modification time
+func (fs *FTPStorage) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	p, err := fs.path(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	c, err := fs.conn(ctx)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	defer fs.release(c)
+
+	if _, err = c.text.Cmd("SIZE %s", p); err != nil {
+		c.broken = true
+		return ObjectInfo{}, err
+	}
+	_, msg, err := c.text.ReadResponse(213)
+	if err != nil {
+		if isFTPNotFound(asFTPError(err)) {
+			return ObjectInfo{}, ErrNotFound
+		}
+		return ObjectInfo{}, asFTPError(err)
+	}
+	size, err := strconv.ParseInt(strings.TrimSpace(msg), 10, 64)
+	if err != nil {
+		return ObjectInfo{}, fmt.Errorf("ftp: invalid SIZE reply %q", msg)
+	}
+
+	info := ObjectInfo{Key: key, Size: size}
+	if _, err = c.text.Cmd("MDTM %s", p); err != nil {
+		c.broken = true
+		return ObjectInfo{}, err
+	}
+	if _, msg, err = c.text.ReadResponse(213); err == nil {
+		info.ModTime, _ = parseFTPTime(strings.TrimSpace(msg))
+	}
+	return info, nil
+}
+
+// asFTPError converts the error of a reply with an unexpected code to an *ftpError
+func asFTPError(err error) error {
+	var perr *textproto.Error
+	if errors.As(err, &perr) {
+		return &ftpError{Code: perr.Code, Msg: perr.Msg}
+	}
+	return err
+}
+
+func parseFTPTime(v string) (time.Time, error) {
+	if len(v) > 14 && v[14] == '.' {
+		return time.Parse("20060102150405.999", v)
+	}
+	return time.Parse("20060102150405", v)
+}
+
+// Delete removes the object
+func (fs *FTPStorage) Delete(ctx context.Context, key string) error {
+	p, err := fs.path(key)
+	if err != nil {
+		return err
+	}
+	c, err := fs.conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer fs.release(c)
+
+	if _, err = c.cmd(250, "DELE %s", p); err != nil && !isFTPNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// List describes the objects under prefix, walking the directories with MLSD
+func (fs *FTPStorage) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	c, err := fs.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer fs.release(c)
+
+	// start from the deepest directory the prefix names
+	start := ""
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		start = prefix[:i]
+	}
+
+	var objects []ObjectInfo
+	var walk func(dir string) error
+	walk = func(dir string) error {
+		p := fs.Dir
+		if dir != "" {
+			p = path.Join(fs.Dir, dir)
+		}
+		if p == "" {
+			p = "."
+		}
+		conn, err := c.transfer(ctx, "MLSD %s", p)
+		if err != nil {
+			if isFTPNotFound(err) {
+				return nil
+			}
+			return err
+		}
+		data, err := io.ReadAll(conn)
+		if err != nil {
+			conn.Close()
+			c.broken = true
+			return err
+		}
+		if err = c.finish(conn); err != nil {
+			return err
+		}
+
+		for _, line := range strings.Split(string(data), "\n") {
+			facts, name, ok := strings.Cut(strings.TrimRight(line, "\r"), " ")
+			if !ok || name == "" {
+				continue
+			}
+			key := name
+			if dir != "" {
+				key = dir + "/" + name
+			}
+			info := ObjectInfo{Key: key}
+			kind := ""
+			for _, fact := range strings.Split(facts, ";") {
+				k, v, _ := strings.Cut(fact, "=")
+				switch strings.ToLower(k) {
+				case "type":
+					kind = strings.ToLower(v)
+				case "size":
+					info.Size, _ = strconv.ParseInt(v, 10, 64)
+				case "modify":
+					info.ModTime, _ = parseFTPTime(v)
+				}
+			}
+			switch {
+			case kind == "dir" && (strings.HasPrefix(key+"/", prefix) || strings.HasPrefix(prefix, key+"/")):
+				if err = walk(key); err != nil {
+					return err
+				}
+			case kind == "file" && strings.HasPrefix(key, prefix):
+				objects = append(objects, info)
+			}
+		}
+		return nil
+	}
+	if err = walk(start); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
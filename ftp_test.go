@@ -0,0 +1,471 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testFTPServer is a minimal FTP server over a directory, for testing FTPStorage
+type testFTPServer struct {
+	ln      net.Listener
+	root    string
+	tls     *tls.Config
+	noEPSV  bool
+	mu      sync.Mutex
+	logins  int
+	wg      sync.WaitGroup
+	closing chan struct{}
+}
+
+func newTestFTPServer(t *testing.T, tlsConfig *tls.Config, noEPSV bool) *testFTPServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testFTPServer{ln: ln, root: t.TempDir(), tls: tlsConfig, noEPSV: noEPSV, closing: make(chan struct{})}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.serve(conn)
+			}()
+		}
+	}()
+	t.Cleanup(func() {
+		close(s.closing)
+		ln.Close()
+		s.wg.Wait()
+	})
+	return s
+}
+
+func (s *testFTPServer) serve(conn net.Conn) {
+	defer conn.Close()
+	go func() {
+		<-s.closing
+		conn.Close()
+	}()
+
+	text := textproto.NewConn(conn)
+	reply := func(code int, msg string) { _ = text.PrintfLine("%d %s", code, msg) }
+	reply(220, "ready")
+
+	var (
+		user     string
+		loggedIn bool
+		private  bool
+		offset   int64
+		passive  net.Listener
+	)
+	defer func() {
+		if passive != nil {
+			passive.Close()
+		}
+	}()
+	file := func(arg string) string {
+		return filepath.Join(s.root, filepath.FromSlash(strings.TrimPrefix(arg, "/")))
+	}
+	// accept takes the data connection for a transfer
+	accept := func() (net.Conn, bool) {
+		if passive == nil {
+			reply(425, "use PASV or EPSV first")
+			return nil, false
+		}
+		dc, err := passive.Accept()
+		passive.Close()
+		passive = nil
+		if err != nil {
+			reply(425, "no data connection")
+			return nil, false
+		}
+		reply(150, "opening data connection")
+		if private {
+			dc = tls.Server(dc, s.tls)
+		}
+		return dc, true
+	}
+
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(line, " ")
+		cmd = strings.ToUpper(cmd)
+		if !loggedIn && cmd != "USER" && cmd != "PASS" && cmd != "AUTH" && cmd != "PBSZ" && cmd != "PROT" && cmd != "QUIT" {
+			reply(530, "not logged in")
+			continue
+		}
+
+		switch cmd {
+		case "AUTH":
+			if s.tls == nil {
+				reply(502, "no TLS")
+				continue
+			}
+			reply(234, "starting TLS")
+			conn = tls.Server(conn, s.tls)
+			text = textproto.NewConn(conn)
+		case "PBSZ":
+			reply(200, "ok")
+		case "PROT":
+			private = arg == "P"
+			reply(200, "ok")
+		case "USER":
+			user = arg
+			reply(331, "password please")
+		case "PASS":
+			if user != "partner" || arg != "secret" {
+				reply(530, "login incorrect")
+				continue
+			}
+			loggedIn = true
+			s.mu.Lock()
+			s.logins++
+			s.mu.Unlock()
+			reply(230, "logged in")
+		case "TYPE", "NOOP":
+			reply(200, "ok")
+		case "EPSV", "PASV":
+			if cmd == "EPSV" && s.noEPSV {
+				reply(502, "not implemented")
+				continue
+			}
+			if passive, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+				reply(425, err.Error())
+				continue
+			}
+			port := passive.Addr().(*net.TCPAddr).Port
+			if cmd == "EPSV" {
+				reply(229, fmt.Sprintf("Entering Extended Passive Mode (|||%d|)", port))
+			} else {
+				// advertise an unreachable address, which the client should ignore
+				reply(227, fmt.Sprintf("Entering Passive Mode (10,0,0,1,%d,%d)", port>>8, port&0xff))
+			}
+		case "REST":
+			offset, _ = strconv.ParseInt(arg, 10, 64)
+			reply(350, "restarting")
+		case "STOR", "APPE":
+			var existing []byte
+			if cmd == "APPE" {
+				existing, _ = os.ReadFile(file(arg))
+			}
+			f, err := os.Create(file(arg))
+			if err == nil {
+				if _, err = f.Write(existing); err != nil {
+					f.Close()
+				}
+			}
+			if err != nil {
+				reply(553, err.Error())
+				continue
+			}
+			dc, ok := accept()
+			if !ok {
+				f.Close()
+				continue
+			}
+			_, err = io.Copy(f, dc)
+			dc.Close()
+			f.Close()
+			if err != nil {
+				reply(426, err.Error())
+				continue
+			}
+			reply(226, "transfer complete")
+		case "RETR":
+			f, err := os.Open(file(arg))
+			if err != nil {
+				reply(550, "no such file")
+				continue
+			}
+			_, _ = f.Seek(offset, io.SeekStart)
+			offset = 0
+			dc, ok := accept()
+			if !ok {
+				f.Close()
+				continue
+			}
+			_, _ = io.Copy(dc, f)
+			dc.Close()
+			f.Close()
+			reply(226, "transfer complete")
+		case "SIZE", "MDTM":
+			info, err := os.Stat(file(arg))
+			if err != nil || info.IsDir() {
+				reply(550, "no such file")
+				continue
+			}
+			if cmd == "SIZE" {
+				reply(213, strconv.FormatInt(info.Size(), 10))
+			} else {
+				reply(213, info.ModTime().UTC().Format("20060102150405"))
+			}
+		case "DELE":
+			if err := os.Remove(file(arg)); err != nil {
+				reply(550, "no such file")
+				continue
+			}
+			reply(250, "deleted")
+		case "MKD":
+			if err := os.Mkdir(file(arg), 0755); err != nil {
+				reply(550, "exists")
+				continue
+			}
+			reply(257, "created")
+		case "MLSD":
+			entries, err := os.ReadDir(file(arg))
+			if err != nil {
+				reply(550, "no such directory")
+				continue
+			}
+			dc, ok := accept()
+			if !ok {
+				continue
+			}
+			fmt.Fprintf(dc, "type=cdir;modify=20240101000000; .\r\n")
+			for _, e := range entries {
+				info, _ := e.Info()
+				kind := "file"
+				if e.IsDir() {
+					kind = "dir"
+				}
+				fmt.Fprintf(dc, "type=%s;size=%d;modify=%s; %s\r\n", kind, info.Size(), info.ModTime().UTC().Format("20060102150405"), e.Name())
+			}
+			dc.Close()
+			reply(226, "listing complete")
+		case "QUIT":
+			reply(221, "bye")
+			return
+		default:
+			reply(502, "not implemented")
+		}
+	}
+}
+
+func (s *testFTPServer) loginCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.logins
+}
+
+// testFTPTLS returns server and client TLS configs for localhost
+func testFTPTLS(t *testing.T) (*tls.Config, *tls.Config) {
+	ca := newTestCA(t)
+	certPEM, keyPEM := ca.issue(t, 2, "localhost")
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	return &tls.Config{Certificates: []tls.Certificate{cert}}, &tls.Config{RootCAs: roots, ServerName: "localhost"}
+}
+
+func TestFTPStorage(t *testing.T) {
+	serverTLS, clientTLS := testFTPTLS(t)
+	var tests = []struct {
+		name   string
+		tls    bool
+		noEPSV bool
+	}{
+		{name: "plain"},
+		{name: "pasv", noEPSV: true},
+		{name: "ftps", tls: true},
+	}
+
+	for _, e := range tests {
+		var server *testFTPServer
+		fs := &FTPStorage{Username: "partner", Password: "secret", Dir: "/drop"}
+		if e.tls {
+			server = newTestFTPServer(t, serverTLS, e.noEPSV)
+			fs.TLS = clientTLS
+		} else {
+			server = newTestFTPServer(t, nil, e.noEPSV)
+		}
+		fs.Addr = server.ln.Addr().String()
+		if err := os.Mkdir(filepath.Join(server.root, "drop"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		ctx := context.Background()
+
+		for _, key := range []string{"exports/a.csv", "exports/2024/b.csv", "readme.txt"} {
+			if err := fs.Put(ctx, key, strings.NewReader("contents of "+key)); err != nil {
+				t.Fatalf("%s: put %s: %v", e.name, key, err)
+			}
+		}
+
+		r, err := fs.Get(ctx, "exports/a.csv")
+		if err != nil {
+			t.Fatalf("%s: %v", e.name, err)
+		}
+		data, _ := io.ReadAll(r)
+		if err = r.Close(); err != nil || string(data) != "contents of exports/a.csv" {
+			t.Errorf("%s: expected the contents, got %q %v", e.name, data, err)
+		}
+
+		r, err = fs.GetRange(ctx, "exports/a.csv", 12, 7)
+		if err != nil {
+			t.Fatalf("%s: %v", e.name, err)
+		}
+		data, _ = io.ReadAll(r)
+		r.Close()
+		if string(data) != "exports" {
+			t.Errorf("%s: expected a range, got %q", e.name, data)
+		}
+
+		info, err := fs.Stat(ctx, "readme.txt")
+		if err != nil || info.Size != int64(len("contents of readme.txt")) || info.ModTime.IsZero() {
+			t.Errorf("%s: unexpected info %+v %v", e.name, info, err)
+		}
+		if _, err = fs.Stat(ctx, "missing.txt"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: expected ErrNotFound, got %v", e.name, err)
+		}
+		if _, err = fs.Get(ctx, "missing.txt"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: expected ErrNotFound, got %v", e.name, err)
+		}
+
+		objects, err := fs.List(ctx, "exports/")
+		if err != nil {
+			t.Fatalf("%s: %v", e.name, err)
+		}
+		var keys []string
+		for _, o := range objects {
+			keys = append(keys, o.Key)
+		}
+		if got := strings.Join(keys, ","); got != "exports/2024/b.csv,exports/a.csv" {
+			t.Errorf("%s: unexpected listing %s", e.name, got)
+		}
+		if objects, _ = fs.List(ctx, ""); len(objects) != 3 {
+			t.Errorf("%s: expected 3 objects, got %d", e.name, len(objects))
+		}
+
+		if err = fs.Delete(ctx, "readme.txt"); err != nil {
+			t.Errorf("%s: %v", e.name, err)
+		}
+		if err = fs.Delete(ctx, "readme.txt"); err != nil {
+			t.Errorf("%s: expected deleting a missing object to succeed, got %v", e.name, err)
+		}
+		if _, err = os.Stat(filepath.Join(server.root, "drop", "readme.txt")); !os.IsNotExist(err) {
+			t.Errorf("%s: expected the file to be deleted", e.name)
+		}
+
+		// the ranged read aborts its transfer, so its connection isn't reused
+		if n := server.loginCount(); n != 2 {
+			t.Errorf("%s: expected pooled connections, got %d logins", e.name, n)
+		}
+		fs.Close()
+	}
+}
+
+func TestFTPStorage_Resume(t *testing.T) {
+	server := newTestFTPServer(t, nil, false)
+	fs := &FTPStorage{Addr: server.ln.Addr().String(), Username: "partner", Password: "secret"}
+	defer fs.Close()
+
+	content := bytes.Repeat([]byte("0123456789"), 100)
+	// an interrupted upload left the first part
+	if err := os.WriteFile(filepath.Join(server.root, "export.csv"), content[:374], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Resume(context.Background(), "export.csv", bytes.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := os.ReadFile(filepath.Join(server.root, "export.csv"))
+	if !bytes.Equal(got, content) {
+		t.Errorf("expected the upload to be completed, got %d bytes", len(got))
+	}
+
+	if err := fs.Resume(context.Background(), "new.csv", bytes.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ = os.ReadFile(filepath.Join(server.root, "new.csv")); !bytes.Equal(got, content) {
+		t.Errorf("expected a new upload, got %d bytes", len(got))
+	}
+}
+
+func TestFTPStorage_errors(t *testing.T) {
+	server := newTestFTPServer(t, nil, false)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	fs := &FTPStorage{Addr: server.ln.Addr().String(), Username: "partner", Password: "wrong"}
+	if err := fs.Put(ctx, "a.txt", strings.NewReader("a")); err == nil || !strings.Contains(err.Error(), "530") {
+		t.Errorf("expected a login failure, got %v", err)
+	}
+
+	fs = &FTPStorage{Addr: server.ln.Addr().String(), Username: "partner", Password: "secret"}
+	defer fs.Close()
+	var tests = []string{"", "/", "a\r\nDELE b"}
+	for _, key := range tests {
+		if err := fs.Put(ctx, key, strings.NewReader("a")); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("%q: expected ErrInvalidKey, got %v", key, err)
+		}
+	}
+
+	// a connection closed by the server is replaced
+	if err := fs.Put(ctx, "a.txt", strings.NewReader("a")); err != nil {
+		t.Fatal(err)
+	}
+	fs.mu.Lock()
+	for _, c := range fs.idle {
+		c.conn.Close()
+	}
+	fs.mu.Unlock()
+	if _, err := fs.Stat(ctx, "a.txt"); err != nil {
+		t.Errorf("expected a new connection, got %v", err)
+	}
+}
+
+// slowReader returns one byte at a time, pausing before each
+type slowReader struct {
+	data  []byte
+	pause time.Duration
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+	time.Sleep(r.pause)
+	p[0], r.data = r.data[0], r.data[1:]
+	return 1, nil
+}
+
+func TestFTPStorage_Timeout(t *testing.T) {
+	server := newTestFTPServer(t, nil, false)
+	fs := &FTPStorage{Addr: server.ln.Addr().String(), Username: "partner", Password: "secret", Timeout: 100 * time.Millisecond}
+	defer fs.Close()
+
+	// a transfer which makes progress may outlast the timeout
+	if err := fs.Put(context.Background(), "slow.txt", &slowReader{data: []byte("slowly"), pause: 50 * time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(server.root, "slow.txt")); string(got) != "slowly" {
+		t.Errorf("unexpected upload %q", got)
+	}
+	if _, err := fs.Stat(context.Background(), "slow.txt"); err != nil {
+		t.Errorf("expected the connection to be reusable, got %v", err)
+	}
+}
@@ -0,0 +1,182 @@
+package toolkit
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrErasureIncomplete is returned when a subject's data couldn't be erased from every source,
+// or erasure couldn't be verified
+var ErrErasureIncomplete = errors.New("subject data was not fully erased")
+
+// SubjectDataSource is one place an app keeps personal data, such as a table of orders or a
+// bucket of uploads, registered with SubjectData to take part in exports and erasure
+type SubjectDataSource struct {
+	// Name identifies the source, and is the directory its files are exported to
+	Name string
+	// Export, if set, adds the subject's data to an export as files, such as orders.json
+	Export func(ctx context.Context, subject string, add func(name string, r io.Reader) error) error
+	// Erase, if set, deletes or anonymizes the subject's data
+	Erase func(ctx context.Context, subject string) error
+	// Exists, if set, reports whether any of the subject's data is left, to verify erasure
+	Exists func(ctx context.Context, subject string) (bool, error)
+}
+
+// SubjectDataEvent is a step of an export or erasure, recorded in the audit trail
+type SubjectDataEvent struct {
+	// Action is "export" or "erase"
+	Action  string    `json:"action"`
+	Subject string    `json:"subject"`
+	Source  string    `json:"source,omitempty"`
+	Status  string    `json:"status"`
+	Error   string    `json:"error,omitempty"`
+	At      time.Time `json:"at"`
+}
+
+// ErasureResult is the outcome of erasing a subject's data from one source
+type ErasureResult struct {
+	Source string `json:"source"`
+	Erased bool   `json:"erased"`
+	// Verified is set when the source's Exists reported nothing left
+	Verified bool   `json:"verified"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ErasureReport is the outcome of erasing a subject's data
+type ErasureReport struct {
+	Subject string          `json:"subject"`
+	Sources []ErasureResult `json:"sources"`
+	At      time.Time       `json:"at"`
+}
+
+// SubjectData handles data subject requests, such as those under the GDPR: it collects a
+// subject's data from every registered source into a downloadable archive, and erases it from
+// them, verifying that nothing is left. Each step is recorded through Audit.
+type SubjectData struct {
+	// Exports generates and delivers the archives
+	Exports *ExportManager
+	// Audit, if set, receives each step of exports and erasures, such as to keep an audit log
+	Audit func(ctx context.Context, e SubjectDataEvent)
+
+	mu      sync.Mutex
+	sources []SubjectDataSource
+}
+
+// Register adds a source of subject data
+func (sd *SubjectData) Register(source SubjectDataSource) {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	sd.sources = append(sd.sources, source)
+}
+
+func (sd *SubjectData) registered() []SubjectDataSource {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	return append([]SubjectDataSource(nil), sd.sources...)
+}
+
+func (sd *SubjectData) audit(ctx context.Context, action, subject, source string, err error) {
+	if sd.Audit == nil {
+		return
+	}
+	e := SubjectDataEvent{Action: action, Subject: subject, Source: source, Status: "ok", At: time.Now()}
+	if err != nil {
+		e.Status = "failed"
+		e.Error = err.Error()
+	}
+	sd.Audit(ctx, e)
+}
+
+// Export starts collecting the subject's data into a ZIP archive, with a directory for each
+// source and a manifest.json listing them, and returns immediately. The export fails if any
+// source does, rather than deliver incomplete data. Use the ExportManager's Get or Notify to
+// find out when it is ready.
+func (sd *SubjectData) Export(subject string) (Export, error) {
+	if sd.Exports == nil {
+		return Export{}, errors.New("subject data needs an export manager")
+	}
+	sources := sd.registered()
+
+	return sd.Exports.RequestArchive(func(ctx context.Context, zw *zip.Writer) error {
+		var names []string
+		for _, src := range sources {
+			if src.Export == nil {
+				continue
+			}
+			err := src.Export(ctx, subject, func(name string, r io.Reader) error {
+				clean := path.Clean("/" + name)
+				if name == "" || clean == "/" || strings.Contains(name, "\\") {
+					return fmt.Errorf("invalid export file name %q", name)
+				}
+				w, err := zw.Create(src.Name + clean)
+				if err != nil {
+					return err
+				}
+				_, err = io.Copy(w, r)
+				return err
+			})
+			sd.audit(ctx, "export", subject, src.Name, err)
+			if err != nil {
+				return fmt.Errorf("exporting %s: %w", src.Name, err)
+			}
+			names = append(names, src.Name)
+		}
+
+		w, err := zw.Create("manifest.json")
+		if err != nil {
+			return err
+		}
+		return json.NewEncoder(w).Encode(map[string]any{
+			"subject":      subject,
+			"sources":      names,
+			"generated_at": time.Now().UTC(),
+		})
+	})
+}
+
+// Erase erases the subject's data from every source, and verifies it with the sources which
+// can tell whether any is left. Every source is tried even if one fails; ErrErasureIncomplete
+// is returned with the report if any failed or still has data.
+func (sd *SubjectData) Erase(ctx context.Context, subject string) (*ErasureReport, error) {
+	report := &ErasureReport{Subject: subject, At: time.Now()}
+	complete := true
+
+	for _, src := range sd.registered() {
+		if src.Erase == nil {
+			continue
+		}
+		res := ErasureResult{Source: src.Name}
+
+		err := src.Erase(ctx, subject)
+		if err == nil {
+			res.Erased = true
+			if src.Exists != nil {
+				var left bool
+				if left, err = src.Exists(ctx, subject); err == nil && left {
+					err = errors.New("data is left after erasure")
+				}
+				res.Verified = err == nil
+			}
+		}
+		if err != nil {
+			res.Error = err.Error()
+			complete = false
+		}
+
+		sd.audit(ctx, "erase", subject, src.Name, err)
+		report.Sources = append(report.Sources, res)
+	}
+
+	if !complete {
+		return report, ErrErasureIncomplete
+	}
+	return report, nil
+}
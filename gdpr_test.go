@@ -0,0 +1,168 @@
+package toolkit
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newSubjectDataTest(t *testing.T) (*SubjectData, chan Export, *[]SubjectDataEvent) {
+	notified := make(chan Export, 1)
+	var (
+		mu     sync.Mutex
+		events []SubjectDataEvent
+	)
+	sd := &SubjectData{
+		Exports: &ExportManager{
+			Storage: &FileStorage{Dir: t.TempDir()},
+			Signer:  &URLSigner{Key: []byte("export signing key, not very secret")},
+			BaseURL: "https://example.com/exports",
+			Notify: func(ctx context.Context, e Export) error {
+				notified <- e
+				return nil
+			},
+		},
+		Audit: func(_ context.Context, e SubjectDataEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, e)
+		},
+	}
+	return sd, notified, &events
+}
+
+func TestSubjectData_Export(t *testing.T) {
+	sd, notified, events := newSubjectDataTest(t)
+
+	sd.Register(SubjectDataSource{
+		Name: "orders",
+		Export: func(_ context.Context, subject string, add func(string, io.Reader) error) error {
+			return add("orders.json", strings.NewReader(`[{"user":"`+subject+`"}]`))
+		},
+	})
+	sd.Register(SubjectDataSource{
+		Name: "uploads",
+		Export: func(_ context.Context, _ string, add func(string, io.Reader) error) error {
+			if err := add("avatars/me.png", strings.NewReader("png")); err != nil {
+				return err
+			}
+			return add("../escape.txt", strings.NewReader("x"))
+		},
+	})
+	sd.Register(SubjectDataSource{Name: "erase only", Erase: func(context.Context, string) error { return nil }})
+
+	if _, err := sd.Export("user-1"); err != nil {
+		t.Fatal(err)
+	}
+	var ready Export
+	select {
+	case ready = <-notified:
+	case <-time.After(5 * time.Second):
+		t.Fatal("export was never ready")
+	}
+	if ready.Status != ExportReady || ready.Format != FormatZIP {
+		t.Fatalf("expected a ready zip export, got %+v", ready)
+	}
+
+	u, _ := url.Parse(ready.URL)
+	rr := httptest.NewRecorder()
+	http.StripPrefix("/exports", sd.Exports.DownloadHandler()).ServeHTTP(rr, httptest.NewRequest("GET", u.RequestURI(), nil))
+	if rr.Header().Get("Content-Type") != "application/zip" {
+		t.Errorf("unexpected content type %q", rr.Header().Get("Content-Type"))
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(rr.Body.Bytes()), int64(rr.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	for _, f := range zr.File {
+		rc, _ := f.Open()
+		b, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(b)
+	}
+	if files["orders/orders.json"] != `[{"user":"user-1"}]` || files["uploads/avatars/me.png"] != "png" || files["uploads/escape.txt"] != "x" {
+		t.Errorf("unexpected archive %v", files)
+	}
+	if !strings.Contains(files["manifest.json"], `"sources":["orders","uploads"]`) {
+		t.Errorf("unexpected manifest %s", files["manifest.json"])
+	}
+	if len(*events) != 2 || (*events)[0].Action != "export" || (*events)[0].Status != "ok" {
+		t.Errorf("unexpected audit trail %+v", *events)
+	}
+
+	// a failing source fails the export
+	sd.Register(SubjectDataSource{
+		Name:   "broken",
+		Export: func(context.Context, string, func(string, io.Reader) error) error { return errors.New("db down") },
+	})
+	if _, err = sd.Export("user-1"); err != nil {
+		t.Fatal(err)
+	}
+	if failed := <-notified; failed.Status != ExportFailed || !strings.Contains(failed.Error, "db down") {
+		t.Errorf("expected a failed export, got %+v", failed)
+	}
+}
+
+func TestSubjectData_Erase(t *testing.T) {
+	sd, _, events := newSubjectDataTest(t)
+
+	data := map[string]bool{"orders": true, "uploads": true, "sticky": true}
+	source := func(name string, eraseErr error, erases bool) SubjectDataSource {
+		return SubjectDataSource{
+			Name: name,
+			Erase: func(context.Context, string) error {
+				if eraseErr == nil && erases {
+					data[name] = false
+				}
+				return eraseErr
+			},
+			Exists: func(context.Context, string) (bool, error) { return data[name], nil },
+		}
+	}
+	sd.Register(source("orders", nil, true))
+	sd.Register(source("uploads", errors.New("bucket unavailable"), true))
+	sd.Register(source("sticky", nil, false))
+
+	report, err := sd.Erase(context.Background(), "user-1")
+	if !errors.Is(err, ErrErasureIncomplete) {
+		t.Errorf("expected ErrErasureIncomplete but got %v", err)
+	}
+
+	var tests = []struct {
+		source   string
+		erased   bool
+		verified bool
+	}{
+		{"orders", true, true},
+		{"uploads", false, false},
+		{"sticky", true, false},
+	}
+	for i, e := range tests {
+		res := report.Sources[i]
+		if res.Source != e.source || res.Erased != e.erased || res.Verified != e.verified || (res.Error == "") != e.verified {
+			t.Errorf("%s: unexpected result %+v", e.source, res)
+		}
+		if ev := (*events)[i]; ev.Action != "erase" || ev.Source != e.source || (ev.Status == "ok") != e.verified {
+			t.Errorf("%s: unexpected audit event %+v", e.source, ev)
+		}
+	}
+
+	// once every source is clear, erasure succeeds
+	sd2, _, _ := newSubjectDataTest(t)
+	data["orders"] = true
+	sd2.Register(source("orders", nil, true))
+	if _, err = sd2.Erase(context.Background(), "user-1"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,143 @@
+package toolkit
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// ErrCountryBlocked is sent to clients in countries or regions a GeoBlock refuses
+var ErrCountryBlocked = errors.New("not available in your country or region")
+
+// GeoDecision records why a GeoBlock let a request through or refused it
+type GeoDecision struct {
+	IP       string      `json:"ip,omitempty"`
+	Location GeoLocation `json:"location"`
+	Allowed  bool        `json:"allowed"`
+	// Reason is "allowed", "denied", "not allowed", "unknown", or "bypass"
+	Reason string `json:"reason"`
+}
+
+// GeoBlock restricts routes, such as downloads subject to export controls, by the country or
+// region of the client. Entries in Allow and Deny are ISO 3166-1 alpha-2 country codes, such
+// as "IR", or country and ISO 3166-2 region codes, such as "UA-43"; a region entry takes
+// precedence over its country's.
+type GeoBlock struct {
+	GeoIP *GeoIP
+	// Allow, if not empty, lists the only places served
+	Allow []string
+	// Deny lists places refused
+	Deny []string
+	// AllowUnknown serves clients whose location can't be found, which are refused by default
+	AllowUnknown bool
+	// BypassTokens are accepted in the bypass header to skip the check, such as for auditors
+	// or partners with licences
+	BypassTokens []string
+	// BypassHeader is the header carrying a bypass token. Defaults to "X-Geo-Bypass"
+	BypassHeader string
+	// Audit, if set, receives every decision, such as to keep a compliance log
+	Audit func(r *http.Request, d GeoDecision)
+}
+
+// Decide returns the decision for r, using the location GeoIP.Middleware stored in the
+// context if there is one
+func (gb *GeoBlock) Decide(r *http.Request) GeoDecision {
+	var d GeoDecision
+	if ip := requestClientIP(r, gb.GeoIP.TrustedProxies); ip != nil {
+		d.IP = ip.String()
+	}
+
+	if gb.bypassed(r) {
+		d.Allowed, d.Reason = true, "bypass"
+		return d
+	}
+
+	loc, ok := GeoFromContext(r.Context())
+	if !ok {
+		var err error
+		if loc, err = gb.GeoIP.Locate(r); err != nil && gb.GeoIP.ErrorLog != nil {
+			gb.GeoIP.ErrorLog(err)
+		}
+	}
+	d.Location = loc
+
+	switch {
+	case loc.Country == "":
+		d.Allowed, d.Reason = gb.AllowUnknown, "unknown"
+	case geoListed(gb.Deny, loc) && !geoRegionListed(gb.Allow, loc):
+		d.Reason = "denied"
+	case len(gb.Allow) > 0 && !geoListed(gb.Allow, loc):
+		d.Reason = "not allowed"
+	case geoRegionListed(gb.Deny, loc):
+		d.Reason = "denied"
+	default:
+		d.Allowed, d.Reason = true, "allowed"
+	}
+	return d
+}
+
+func (gb *GeoBlock) bypassHeader() string {
+	if gb.BypassHeader != "" {
+		return gb.BypassHeader
+	}
+	return "X-Geo-Bypass"
+}
+
+func (gb *GeoBlock) bypassed(r *http.Request) bool {
+	got := r.Header.Get(gb.bypassHeader())
+	if got == "" {
+		return false
+	}
+	for _, token := range gb.BypassTokens {
+		if token != "" && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// geoListed reports whether the location's country or region is in the list
+func geoListed(list []string, loc GeoLocation) bool {
+	for _, entry := range list {
+		if strings.EqualFold(entry, loc.Country) {
+			return true
+		}
+	}
+	return geoRegionListed(list, loc)
+}
+
+// geoRegionListed reports whether the location's region is in the list
+func geoRegionListed(list []string, loc GeoLocation) bool {
+	if loc.Region == "" {
+		return false
+	}
+	for _, entry := range list {
+		if strings.EqualFold(entry, loc.Country+"-"+loc.Region) {
+			return true
+		}
+	}
+	return false
+}
+
+// Middleware refuses requests from blocked places with a 451 Unavailable For Legal Reasons
+// JSON error
+func (gb *GeoBlock) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d := gb.Decide(r)
+		if gb.Audit != nil {
+			gb.Audit(r, d)
+		}
+		if !d.Allowed {
+			var t Tools
+			_ = t.ErrorJSON(w, ErrCountryBlocked, http.StatusUnavailableForLegalReasons)
+			return
+		}
+
+		// the bypass token is a credential, and isn't passed on
+		if d.Reason == "bypass" {
+			r.Header.Del(gb.bypassHeader())
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,78 @@
+package toolkit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGeoBlock(t *testing.T) {
+	geo := &GeoIP{Reader: StaticGeoIP{
+		"198.51.100.0/24": {Country: "US"},
+		"203.0.113.0/24":  {Country: "UA"},
+		"203.0.113.0/28":  {Country: "UA", Region: "43"},
+		"192.0.2.0/24":    {Country: "IR"},
+	}}
+
+	var audited []GeoDecision
+	var tests = []struct {
+		name   string
+		block  GeoBlock
+		remote string
+		bypass string
+		status int
+		reason string
+	}{
+		{"allowed", GeoBlock{Deny: []string{"IR"}}, "198.51.100.1", "", http.StatusOK, "allowed"},
+		{"denied country", GeoBlock{Deny: []string{"ir"}}, "192.0.2.1", "", http.StatusUnavailableForLegalReasons, "denied"},
+		{"denied region", GeoBlock{Deny: []string{"UA-43"}}, "203.0.113.1", "", http.StatusUnavailableForLegalReasons, "denied"},
+		{"rest of country", GeoBlock{Deny: []string{"UA-43"}}, "203.0.113.100", "", http.StatusOK, "allowed"},
+		{"allowed region in denied country", GeoBlock{Deny: []string{"UA"}, Allow: []string{"UA-43"}}, "203.0.113.1", "", http.StatusOK, "allowed"},
+		{"not in allow list", GeoBlock{Allow: []string{"US"}}, "203.0.113.100", "", http.StatusUnavailableForLegalReasons, "not allowed"},
+		{"unknown", GeoBlock{Deny: []string{"IR"}}, "10.0.0.1", "", http.StatusUnavailableForLegalReasons, "unknown"},
+		{"unknown allowed", GeoBlock{Deny: []string{"IR"}, AllowUnknown: true}, "10.0.0.1", "", http.StatusOK, "unknown"},
+		{"bypass", GeoBlock{Deny: []string{"IR"}, BypassTokens: []string{"auditor"}}, "192.0.2.1", "auditor", http.StatusOK, "bypass"},
+		{"wrong bypass", GeoBlock{Deny: []string{"IR"}, BypassTokens: []string{"auditor"}}, "192.0.2.1", "guess", http.StatusUnavailableForLegalReasons, "denied"},
+	}
+
+	for _, e := range tests {
+		audited = nil
+		gb := e.block
+		gb.GeoIP = geo
+		gb.Audit = func(_ *http.Request, d GeoDecision) { audited = append(audited, d) }
+
+		var forwarded string
+		h := gb.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			forwarded = r.Header.Get("X-Geo-Bypass")
+		}))
+
+		req := httptest.NewRequest("GET", "/download", nil)
+		req.RemoteAddr = e.remote + ":1234"
+		if e.bypass != "" {
+			req.Header.Set("X-Geo-Bypass", e.bypass)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		if rr.Code != e.status {
+			t.Errorf("%s: expected %d but got %d", e.name, e.status, rr.Code)
+		}
+		if len(audited) != 1 || audited[0].Reason != e.reason || audited[0].IP != e.remote {
+			t.Errorf("%s: unexpected audit %+v", e.name, audited)
+		}
+		if forwarded != "" {
+			t.Errorf("%s: expected the bypass token not to be passed on", e.name)
+		}
+	}
+}
+
+func TestGeoBlock_Context(t *testing.T) {
+	gb := &GeoBlock{GeoIP: &GeoIP{Reader: StaticGeoIP{}}, Allow: []string{"FR"}}
+
+	// a location already found by GeoIP.Middleware is used
+	req := httptest.NewRequest("GET", "/", nil)
+	req = req.WithContext(ContextWithGeo(req.Context(), GeoLocation{Country: "FR"}))
+	if d := gb.Decide(req); !d.Allowed {
+		t.Errorf("expected the location in the context to be used, got %+v", d)
+	}
+}
@@ -0,0 +1,94 @@
+package toolkit
+
+import (
+	"context"
+	"net"
+	"net/http"
+)
+
+// GeoLocation is the result of a GeoIP lookup. Country is an ISO 3166-1 alpha-2 code, and
+// Region an ISO 3166-2 subdivision code without the country prefix.
+type GeoLocation struct {
+	Country string `json:"country,omitempty"`
+	Region  string `json:"region,omitempty"`
+	City    string `json:"city,omitempty"`
+}
+
+// GeoIPReader looks up the location of an IP address. Wrap a MaxMind (MMDB) reader, or any
+// other database, to satisfy it. Lookups of unknown addresses should return an empty location
+// rather than an error.
+type GeoIPReader interface {
+	Lookup(ip net.IP) (GeoLocation, error)
+}
+
+type geoContextKey struct{}
+
+// GeoFromContext returns the location stored in ctx by GeoIP.Middleware
+func GeoFromContext(ctx context.Context) (GeoLocation, bool) {
+	loc, ok := ctx.Value(geoContextKey{}).(GeoLocation)
+	return loc, ok
+}
+
+// ContextWithGeo returns a copy of ctx carrying loc
+func ContextWithGeo(ctx context.Context, loc GeoLocation) context.Context {
+	return context.WithValue(ctx, geoContextKey{}, loc)
+}
+
+// GeoIP looks up the location of clients
+type GeoIP struct {
+	Reader GeoIPReader
+	// TrustedProxies are the proxies whose X-Forwarded-For headers are believed
+	TrustedProxies []*net.IPNet
+	// ErrorLog, if set, receives lookup errors. Requests continue without a location
+	ErrorLog func(err error)
+}
+
+// Locate returns the location of the client which made r
+func (g *GeoIP) Locate(r *http.Request) (GeoLocation, error) {
+	ip := requestClientIP(r, g.TrustedProxies)
+	if ip == nil {
+		return GeoLocation{}, nil
+	}
+	return g.Reader.Lookup(ip)
+}
+
+// Middleware stores the client's location in the request context, for GeoFromContext
+func (g *GeoIP) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		loc, err := g.Locate(r)
+		if err != nil {
+			if g.ErrorLog != nil {
+				g.ErrorLog(err)
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(ContextWithGeo(r.Context(), loc)))
+	})
+}
+
+// StaticGeoIP is a GeoIPReader backed by a list of ranges, useful for tests and for
+// private address space
+type StaticGeoIP map[string]GeoLocation
+
+// Lookup returns the location of the first range containing ip. Ranges are CIDRs, and the
+// most specific match wins.
+func (s StaticGeoIP) Lookup(ip net.IP) (GeoLocation, error) {
+	var best GeoLocation
+	bestBits := -1
+
+	for cidr, loc := range s {
+		nets, err := ParseCIDRs(cidr)
+		if err != nil {
+			return GeoLocation{}, err
+		}
+		if !nets[0].Contains(ip) {
+			continue
+		}
+		if bits, _ := nets[0].Mask.Size(); bits > bestBits {
+			best, bestBits = loc, bits
+		}
+	}
+	return best, nil
+}
@@ -0,0 +1,68 @@
+package toolkit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted, err := ParseCIDRs("10.0.0.0/8", "192.168.1.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		name   string
+		remote string
+		xff    string
+		want   string
+	}{
+		{"direct", "203.0.113.9:1234", "", "203.0.113.9"},
+		{"untrusted proxy", "203.0.113.9:1234", "198.51.100.1", "203.0.113.9"},
+		{"trusted proxy", "10.1.2.3:1234", "198.51.100.1", "198.51.100.1"},
+		{"spoofed chain", "10.1.2.3:1234", "1.1.1.1, 198.51.100.1, 192.168.1.1", "198.51.100.1"},
+		{"ipv6", "[2001:db8::1]:443", "", "2001:db8::1"},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = e.remote
+		if e.xff != "" {
+			req.Header.Set("X-Forwarded-For", e.xff)
+		}
+
+		if got := ClientIP(req, trusted); got.String() != e.want {
+			t.Errorf("%s: expected %s, got %s", e.name, e.want, got)
+		}
+	}
+}
+
+func TestGeoIP_Middleware(t *testing.T) {
+	geo := GeoIP{
+		Reader: StaticGeoIP{
+			"203.0.113.0/24": {Country: "DE"},
+			"203.0.113.0/28": {Country: "DE", Region: "BY", City: "Munich"},
+		},
+	}
+
+	var got GeoLocation
+	var found bool
+	handler := geo.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, found = GeoFromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "203.0.113.5:1234"
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if !found || got.Region != "BY" {
+		t.Errorf("expected the most specific location, got %+v", got)
+	}
+
+	req.RemoteAddr = "198.51.100.1:1234"
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if !found || got.Country != "" {
+		t.Errorf("expected an empty location for an unknown address, got %+v", got)
+	}
+}
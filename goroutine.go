@@ -0,0 +1,162 @@
+package toolkit
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+)
+
+// PanicError is a panic recovered by a Guard
+type PanicError struct {
+	// Name is the Guard's name, if it has one
+	Name  string
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	if e.Name != "" {
+		return fmt.Sprintf("%s: goroutine panicked: %v", e.Name, e.Value)
+	}
+	return fmt.Sprintf("goroutine panicked: %v", e.Value)
+}
+
+// Unwrap returns the panic value if it is an error
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// Guard runs background goroutines behind a panic boundary: a panic is logged with its stack
+// and reported, instead of crashing the process. Goroutines started with GoCtx may also be
+// restarted after a panic, backing off between restarts, for loops which must keep running,
+// such as a queue consumer. A Guard satisfies Runner, so it can run an ExportManager's jobs or
+// a RetryQueue's calls; set its Runner to a *Drainer to have them waited for on shutdown too.
+// The zero value is ready to use, and safe for concurrent use.
+type Guard struct {
+	// Name is prefixed to the errors of the goroutines, to tell subsystems apart in logs
+	Name string
+	// Runner starts the goroutines. If nil, a plain goroutine is used
+	Runner Runner
+	// ErrorLog receives panics, with their stacks. Defaults to the standard logger
+	ErrorLog *log.Logger
+	// Report, if set, is also given each *PanicError, e.g. ErrorRing.Add
+	Report func(err error)
+	// Restart makes GoCtx run the function again after it panics, until ctx ends
+	Restart bool
+	// RestartDelay is the wait before the first restart, doubling for each one after it up to
+	// MaxRestartDelay. A run lasting longer than MaxRestartDelay resets it. Defaults to one
+	// second
+	RestartDelay time.Duration
+	// MaxRestartDelay defaults to one minute
+	MaxRestartDelay time.Duration
+
+	panics int64
+}
+
+// DefaultGuard is used by Go and GoCtx
+var DefaultGuard = &Guard{}
+
+// Go runs fn in a new goroutine behind DefaultGuard's panic boundary
+func Go(fn func()) {
+	_ = DefaultGuard.Go(fn)
+}
+
+// GoCtx runs fn in a new goroutine behind DefaultGuard's panic boundary
+func GoCtx(ctx context.Context, fn func(ctx context.Context)) {
+	_ = DefaultGuard.GoCtx(ctx, fn)
+}
+
+// Panics returns the number of panics the guard has recovered
+func (g *Guard) Panics() int64 {
+	return atomic.LoadInt64(&g.panics)
+}
+
+func (g *Guard) start(fn func()) error {
+	if g.Runner == nil {
+		go fn()
+		return nil
+	}
+	return g.Runner.Go(fn)
+}
+
+// Go runs fn in a new goroutine, recovering a panic. It returns the Runner's error, such as
+// ErrDraining, if fn couldn't be started.
+func (g *Guard) Go(fn func()) error {
+	return g.start(func() {
+		_ = g.protect(fn)
+	})
+}
+
+// GoCtx runs fn in a new goroutine, recovering a panic and, if Restart is set, running fn again
+// after it until ctx ends. It returns the Runner's error if fn couldn't be started.
+func (g *Guard) GoCtx(ctx context.Context, fn func(ctx context.Context)) error {
+	return g.start(func() {
+		delay := g.RestartDelay
+		if delay <= 0 {
+			delay = time.Second
+		}
+		maxDelay := g.MaxRestartDelay
+		if maxDelay <= 0 {
+			maxDelay = time.Minute
+		}
+
+		wait := delay
+		for {
+			started := time.Now()
+			if g.protect(func() { fn(ctx) }) == nil || !g.Restart || ctx.Err() != nil {
+				return
+			}
+			if time.Since(started) > maxDelay {
+				wait = delay
+			}
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			if wait *= 2; wait > maxDelay {
+				wait = maxDelay
+			}
+		}
+	})
+}
+
+// goErr runs fn like Go, then gives done fn's error, or the *PanicError if it panicked
+func (g *Guard) goErr(fn func() error, done func(err error)) error {
+	return g.start(func() {
+		var err error
+		if p := g.protect(func() { err = fn() }); p != nil {
+			err = p
+		}
+		done(err)
+	})
+}
+
+// protect runs fn, returning its panic if it didn't return
+func (g *Guard) protect(fn func()) (err *PanicError) {
+	ok := false
+	defer func() {
+		if ok {
+			return
+		}
+		err = &PanicError{Name: g.Name, Value: recover(), Stack: debug.Stack()}
+		atomic.AddInt64(&g.panics, 1)
+		if g.ErrorLog != nil {
+			g.ErrorLog.Printf("%v\n%s", err, err.Stack)
+		} else {
+			log.Printf("%v\n%s", err, err.Stack)
+		}
+		if g.Report != nil {
+			g.Report(err)
+		}
+	}()
+	fn()
+	ok = true
+	return nil
+}
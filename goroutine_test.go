@@ -0,0 +1,123 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGuard_Go(t *testing.T) {
+	var buf bytes.Buffer
+	var mu sync.Mutex
+	reported := make(chan error, 1)
+	g := &Guard{
+		Name:     "worker",
+		ErrorLog: log.New(&syncWriter{w: &buf, mu: &mu}, "", 0),
+		Report:   func(err error) { reported <- err },
+	}
+
+	if err := g.Go(func() { panic("boom") }); err != nil {
+		t.Fatal(err)
+	}
+	var err error
+	select {
+	case err = <-reported:
+	case <-time.After(time.Second):
+		t.Fatal("expected the panic to be reported")
+	}
+
+	var pe *PanicError
+	if !errors.As(err, &pe) || pe.Value != "boom" || len(pe.Stack) == 0 {
+		t.Fatalf("expected a *PanicError with a stack, got %#v", err)
+	}
+	if err.Error() != "worker: goroutine panicked: boom" {
+		t.Errorf("unexpected message %q", err.Error())
+	}
+	mu.Lock()
+	logged := buf.String()
+	mu.Unlock()
+	if !strings.Contains(logged, "worker: goroutine panicked: boom") || !strings.Contains(logged, "goroutine_test.go") {
+		t.Errorf("expected the panic and its stack to be logged, got %q", logged)
+	}
+	if g.Panics() != 1 {
+		t.Errorf("expected one panic, got %d", g.Panics())
+	}
+
+	errPanic := errors.New("panic value")
+	_ = g.Go(func() { panic(errPanic) })
+	if err := <-reported; !errors.Is(err, errPanic) {
+		t.Errorf("expected an error panic value to be unwrapped, got %v", err)
+	}
+}
+
+func TestGuard_Restart(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	runs := make(chan int, 10)
+	n := 0
+	g := &Guard{
+		ErrorLog:     log.New(&bytes.Buffer{}, "", 0),
+		Restart:      true,
+		RestartDelay: time.Millisecond,
+	}
+	_ = g.GoCtx(ctx, func(ctx context.Context) {
+		n++
+		runs <- n
+		if n < 3 {
+			panic("again")
+		}
+	})
+
+	for want := 1; want <= 3; want++ {
+		select {
+		case got := <-runs:
+			if got != want {
+				t.Fatalf("expected run %d, got %d", want, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected run %d", want)
+		}
+	}
+	// a run which returns isn't restarted
+	select {
+	case <-runs:
+		t.Error("expected no run after fn returned")
+	case <-time.After(20 * time.Millisecond):
+	}
+	if g.Panics() != 2 {
+		t.Errorf("expected 2 panics, got %d", g.Panics())
+	}
+}
+
+func TestGuard_Runner(t *testing.T) {
+	d := &Drainer{}
+	g := &Guard{Runner: d, ErrorLog: log.New(&bytes.Buffer{}, "", 0)}
+	done := make(chan struct{})
+	_ = g.Go(func() {
+		defer close(done)
+		panic("tracked")
+	})
+	<-done
+	if err := d.Drain(context.Background()); err != nil {
+		t.Fatalf("expected the drain to finish after the panic, got %v", err)
+	}
+	if err := g.Go(func() {}); !errors.Is(err, ErrDraining) {
+		t.Errorf("expected ErrDraining, got %v", err)
+	}
+}
+
+type syncWriter struct {
+	w  *bytes.Buffer
+	mu *sync.Mutex
+}
+
+func (s *syncWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(p)
+}
@@ -0,0 +1,297 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// GRPCCode is a gRPC status code
+type GRPCCode int
+
+// gRPC status codes
+const (
+	GRPCOK GRPCCode = iota
+	GRPCCanceled
+	GRPCUnknown
+	GRPCInvalidArgument
+	GRPCDeadlineExceeded
+	GRPCNotFound
+	GRPCAlreadyExists
+	GRPCPermissionDenied
+	GRPCResourceExhausted
+	GRPCFailedPrecondition
+	GRPCAborted
+	GRPCOutOfRange
+	GRPCUnimplemented
+	GRPCInternal
+	GRPCUnavailable
+	GRPCDataLoss
+	GRPCUnauthenticated
+)
+
+var grpcCodeNames = []string{
+	"OK", "CANCELLED", "UNKNOWN", "INVALID_ARGUMENT", "DEADLINE_EXCEEDED", "NOT_FOUND",
+	"ALREADY_EXISTS", "PERMISSION_DENIED", "RESOURCE_EXHAUSTED", "FAILED_PRECONDITION", "ABORTED",
+	"OUT_OF_RANGE", "UNIMPLEMENTED", "INTERNAL", "UNAVAILABLE", "DATA_LOSS", "UNAUTHENTICATED",
+}
+
+func (c GRPCCode) String() string {
+	if c >= 0 && int(c) < len(grpcCodeNames) {
+		return grpcCodeNames[c]
+	}
+	return "CODE(" + strconv.Itoa(int(c)) + ")"
+}
+
+// HTTPStatus returns the HTTP status gRPC-gateway uses for the code
+func (c GRPCCode) HTTPStatus() int {
+	switch c {
+	case GRPCOK:
+		return http.StatusOK
+	case GRPCCanceled:
+		return 499
+	case GRPCInvalidArgument, GRPCOutOfRange:
+		return http.StatusBadRequest
+	case GRPCDeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case GRPCNotFound:
+		return http.StatusNotFound
+	case GRPCAlreadyExists, GRPCAborted:
+		return http.StatusConflict
+	case GRPCPermissionDenied:
+		return http.StatusForbidden
+	case GRPCUnauthenticated:
+		return http.StatusUnauthorized
+	case GRPCResourceExhausted:
+		return http.StatusTooManyRequests
+	case GRPCFailedPrecondition:
+		return http.StatusBadRequest
+	case GRPCUnimplemented:
+		return http.StatusNotImplemented
+	case GRPCUnavailable:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// GRPCCodeFromHTTP returns the gRPC code for an HTTP status, the inverse of HTTPStatus
+func GRPCCodeFromHTTP(status int) GRPCCode {
+	switch status {
+	case http.StatusOK, http.StatusCreated, http.StatusAccepted, http.StatusNoContent:
+		return GRPCOK
+	case 499:
+		return GRPCCanceled
+	case http.StatusBadRequest, http.StatusUnprocessableEntity, http.StatusRequestEntityTooLarge:
+		return GRPCInvalidArgument
+	case http.StatusUnauthorized:
+		return GRPCUnauthenticated
+	case http.StatusForbidden:
+		return GRPCPermissionDenied
+	case http.StatusNotFound:
+		return GRPCNotFound
+	case http.StatusConflict:
+		return GRPCAborted
+	case http.StatusPreconditionFailed:
+		return GRPCFailedPrecondition
+	case http.StatusTooManyRequests:
+		return GRPCResourceExhausted
+	case http.StatusNotImplemented:
+		return GRPCUnimplemented
+	case http.StatusServiceUnavailable, http.StatusBadGateway:
+		return GRPCUnavailable
+	case http.StatusGatewayTimeout, http.StatusRequestTimeout:
+		return GRPCDeadlineExceeded
+	}
+	if status >= 200 && status < 300 {
+		return GRPCOK
+	}
+	if status >= 400 && status < 500 {
+		return GRPCFailedPrecondition
+	}
+	return GRPCUnknown
+}
+
+// GRPCError is an error in the shape of a google.rpc.Status, as gRPC-gateway writes it
+type GRPCError struct {
+	Code    GRPCCode `json:"code"`
+	Message string   `json:"message"`
+	Details []any    `json:"details"`
+}
+
+func (e *GRPCError) Error() string {
+	return fmt.Sprintf("rpc error: code = %s desc = %s", e.Code, e.Message)
+}
+
+// grpcSentinels are the codes of the toolkit's own errors
+var grpcSentinels = []struct {
+	err  error
+	code GRPCCode
+}{
+	{ErrNotFound, GRPCNotFound},
+	{ErrInvalidKey, GRPCInvalidArgument},
+	{ErrTooDeep, GRPCInvalidArgument},
+	{ErrInvalidWindow, GRPCInvalidArgument},
+	{ErrPreconditionFailed, GRPCFailedPrecondition},
+	{ErrPreconditionRequired, GRPCFailedPrecondition},
+	{ErrRateLimited, GRPCResourceExhausted},
+	{ErrBanned, GRPCResourceExhausted},
+	{ErrQuotaExceeded, GRPCResourceExhausted},
+	{ErrBulkheadFull, GRPCResourceExhausted},
+	{ErrDraining, GRPCUnavailable},
+	{ErrNotSupported, GRPCUnimplemented},
+	{ErrUnsupportedVersion, GRPCUnimplemented},
+	{ErrObjectLocked, GRPCFailedPrecondition},
+	{ErrConsentRequired, GRPCPermissionDenied},
+	{ErrCountryBlocked, GRPCPermissionDenied},
+}
+
+// GRPCCodeOf returns the gRPC code of err: a GRPCError's own, the code of a StatusError's HTTP
+// status, or the codes of context errors and the toolkit's errors, such as ErrNotFound
+func GRPCCodeOf(err error) GRPCCode {
+	var ge *GRPCError
+	var se *StatusError
+	var tooLarge *BodyTooLargeError
+	switch {
+	case err == nil:
+		return GRPCOK
+	case errors.As(err, &ge):
+		return ge.Code
+	case errors.As(err, &se):
+		return GRPCCodeFromHTTP(se.Status)
+	case errors.As(err, &tooLarge):
+		return GRPCInvalidArgument
+	case errors.Is(err, context.DeadlineExceeded):
+		return GRPCDeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		return GRPCCanceled
+	}
+	for _, s := range grpcSentinels {
+		if errors.Is(err, s.err) {
+			return s.code
+		}
+	}
+	return GRPCUnknown
+}
+
+// GRPCErrorJSON writes err as a toolkit JSON error, with the HTTP status of its gRPC code, so
+// errors from gRPC backends reach clients like the handler's own
+func (t *Tools) GRPCErrorJSON(w http.ResponseWriter, err error) error {
+	return t.ErrorJSON(w, err, GRPCCodeOf(err).HTTPStatus())
+}
+
+// GRPCGateway exposes a toolkit JSON handler as a gRPC-gateway compatible endpoint. Successful
+// responses pass through; error responses, such as those written by ErrorJSON, are rewritten
+// as google.rpc.Status bodies with the gRPC code of their status, and the code is also sent in
+// the Grpc-Status header.
+func GRPCGateway(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gw := &gatewayWriter{ResponseWriter: w}
+		next.ServeHTTP(gw, r)
+		if gw.status < 400 {
+			return
+		}
+
+		// take the message of a JSONResponse, or the text of a plain error
+		message := http.StatusText(gw.status)
+		var payload JSONResponse
+		if err := json.Unmarshal(gw.body.Bytes(), &payload); err == nil && payload.Message != "" {
+			message = payload.Message
+		} else if text := string(bytes.TrimSpace(gw.body.Bytes())); text != "" && err != nil {
+			message = text
+		}
+
+		code := GRPCCodeFromHTTP(gw.status)
+		body, _ := json.Marshal(GRPCError{Code: code, Message: message, Details: []any{}})
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Grpc-Status", strconv.Itoa(int(code)))
+		w.Header().Del("Content-Length")
+		w.WriteHeader(gw.status)
+		_, _ = w.Write(body)
+	})
+}
+
+// gatewayWriter passes successful responses through, and holds back error responses
+type gatewayWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (gw *gatewayWriter) WriteHeader(status int) {
+	if gw.status != 0 {
+		return
+	}
+	gw.status = status
+	if status < 400 {
+		gw.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (gw *gatewayWriter) Write(b []byte) (int, error) {
+	if gw.status == 0 {
+		gw.WriteHeader(http.StatusOK)
+	}
+	if gw.status >= 400 {
+		return gw.body.Write(b)
+	}
+	return gw.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher when the underlying writer does
+func (gw *gatewayWriter) Flush() {
+	if f, ok := gw.ResponseWriter.(http.Flusher); ok && gw.status < 400 {
+		f.Flush()
+	}
+}
+
+// CallGRPC calls a method of a gRPC backend through its gRPC-gateway, or other HTTP/JSON
+// transcoding, endpoint, like CallJSONContext. Errors the backend reports are returned as
+// *GRPCError, which GRPCErrorJSON maps back to the HTTP status a toolkit handler would use.
+func (t *Tools) CallGRPC(ctx context.Context, client *http.Client, method, url string, data, out any) error {
+	ctx, cancel := OutboundContext(ctx)
+	defer cancel()
+
+	var body io.Reader
+	if data != nil {
+		jsonData, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(jsonData)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return err
+	}
+	if data != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	request.Header.Set("Accept", "application/json")
+	setTimeoutHeader(request)
+
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		ge := &GRPCError{}
+		raw, _ := io.ReadAll(io.LimitReader(response.Body, 1<<16))
+		if json.Unmarshal(raw, ge) != nil || ge.Code == GRPCOK {
+			ge = &GRPCError{Code: GRPCCodeFromHTTP(response.StatusCode), Message: fmt.Sprintf("%s %s returned status %d", method, url, response.StatusCode)}
+		}
+		return ge
+	}
+	if out != nil && response.StatusCode != http.StatusNoContent {
+		if err = json.NewDecoder(response.Body).Decode(out); err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package toolkit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGRPCCode_HTTPStatus(t *testing.T) {
+	var tests = []struct {
+		code   GRPCCode
+		status int
+		name   string
+	}{
+		{code: GRPCOK, status: http.StatusOK, name: "OK"},
+		{code: GRPCInvalidArgument, status: http.StatusBadRequest, name: "INVALID_ARGUMENT"},
+		{code: GRPCNotFound, status: http.StatusNotFound, name: "NOT_FOUND"},
+		{code: GRPCPermissionDenied, status: http.StatusForbidden, name: "PERMISSION_DENIED"},
+		{code: GRPCUnauthenticated, status: http.StatusUnauthorized, name: "UNAUTHENTICATED"},
+		{code: GRPCResourceExhausted, status: http.StatusTooManyRequests, name: "RESOURCE_EXHAUSTED"},
+		{code: GRPCUnavailable, status: http.StatusServiceUnavailable, name: "UNAVAILABLE"},
+		{code: GRPCDeadlineExceeded, status: http.StatusGatewayTimeout, name: "DEADLINE_EXCEEDED"},
+		{code: GRPCDataLoss, status: http.StatusInternalServerError, name: "DATA_LOSS"},
+		{code: GRPCCode(42), status: http.StatusInternalServerError, name: "CODE(42)"},
+	}
+
+	for _, e := range tests {
+		if got := e.code.HTTPStatus(); got != e.status {
+			t.Errorf("%s: expected status %d, got %d", e.name, e.status, got)
+		}
+		if got := e.code.String(); got != e.name {
+			t.Errorf("expected %s, got %s", e.name, got)
+		}
+		if e.code <= GRPCUnauthenticated && e.code != GRPCDataLoss {
+			if got := GRPCCodeFromHTTP(e.status); got.HTTPStatus() != e.status {
+				t.Errorf("%s: expected status %d to map back, got %s", e.name, e.status, got)
+			}
+		}
+	}
+}
+
+func TestGRPCCodeOf(t *testing.T) {
+	var tests = []struct {
+		name string
+		err  error
+		want GRPCCode
+	}{
+		{name: "nil", err: nil, want: GRPCOK},
+		{name: "grpc", err: fmt.Errorf("wrapped: %w", &GRPCError{Code: GRPCNotFound}), want: GRPCNotFound},
+		{name: "status", err: &StatusError{Status: http.StatusTooManyRequests}, want: GRPCResourceExhausted},
+		{name: "too large", err: &BodyTooLargeError{}, want: GRPCInvalidArgument},
+		{name: "deadline", err: context.DeadlineExceeded, want: GRPCDeadlineExceeded},
+		{name: "canceled", err: context.Canceled, want: GRPCCanceled},
+		{name: "not found", err: fmt.Errorf("loading: %w", ErrNotFound), want: GRPCNotFound},
+		{name: "rate limited", err: ErrRateLimited, want: GRPCResourceExhausted},
+		{name: "other", err: errors.New("boom"), want: GRPCUnknown},
+	}
+
+	for _, e := range tests {
+		if got := GRPCCodeOf(e.err); got != e.want {
+			t.Errorf("%s: expected %s, got %s", e.name, e.want, got)
+		}
+	}
+}
+
+func TestGRPCGateway(t *testing.T) {
+	var tools Tools
+	var tests = []struct {
+		name     string
+		handler  http.HandlerFunc
+		status   int
+		wantCode GRPCCode
+		wantBody string
+		message  string
+	}{
+		{name: "success", handler: func(w http.ResponseWriter, r *http.Request) {
+			_ = tools.WriteJSON(w, http.StatusOK, map[string]string{"id": "1"})
+		}, status: http.StatusOK, wantBody: `{"id":"1"}`},
+		{name: "json error", handler: func(w http.ResponseWriter, r *http.Request) {
+			_ = tools.ErrorJSON(w, errors.New("widget not found"), http.StatusNotFound)
+		}, status: http.StatusNotFound, wantCode: GRPCNotFound, message: "widget not found"},
+		{name: "text error", handler: func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+		}, status: http.StatusTooManyRequests, wantCode: GRPCResourceExhausted, message: "slow down"},
+		{name: "empty error", handler: func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+		}, status: http.StatusForbidden, wantCode: GRPCPermissionDenied, message: "Forbidden"},
+	}
+
+	for _, e := range tests {
+		rr := httptest.NewRecorder()
+		GRPCGateway(e.handler).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/widgets/1", nil))
+		if rr.Code != e.status {
+			t.Errorf("%s: expected status %d, got %d", e.name, e.status, rr.Code)
+		}
+		if e.wantBody != "" {
+			if got := rr.Body.String(); got != e.wantBody+"\n" && got != e.wantBody {
+				t.Errorf("%s: expected %s, got %s", e.name, e.wantBody, got)
+			}
+			continue
+		}
+		var ge GRPCError
+		if err := json.Unmarshal(rr.Body.Bytes(), &ge); err != nil {
+			t.Errorf("%s: %v", e.name, err)
+			continue
+		}
+		if ge.Code != e.wantCode || ge.Message != e.message || ge.Details == nil {
+			t.Errorf("%s: expected %s %q, got %+v", e.name, e.wantCode, e.message, ge)
+		}
+		if got := rr.Header().Get("Grpc-Status"); got != fmt.Sprint(int(e.wantCode)) {
+			t.Errorf("%s: expected Grpc-Status %d, got %s", e.name, e.wantCode, got)
+		}
+	}
+}
+
+func TestTools_CallGRPC(t *testing.T) {
+	backend := httptest.NewServer(GRPCGateway(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var tools Tools
+		if r.URL.Path == "/v1/widgets/1" {
+			_ = tools.WriteJSON(w, http.StatusOK, map[string]string{"name": "sprocket"})
+			return
+		}
+		_ = tools.ErrorJSON(w, errors.New("widget not found"), http.StatusNotFound)
+	})))
+	defer backend.Close()
+
+	var tools Tools
+	var out struct {
+		Name string `json:"name"`
+	}
+	if err := tools.CallGRPC(context.Background(), backend.Client(), http.MethodGet, backend.URL+"/v1/widgets/1", nil, &out); err != nil || out.Name != "sprocket" {
+		t.Fatalf("expected the widget, got %+v %v", out, err)
+	}
+
+	err := tools.CallGRPC(context.Background(), backend.Client(), http.MethodGet, backend.URL+"/v1/widgets/2", nil, nil)
+	var ge *GRPCError
+	if !errors.As(err, &ge) || ge.Code != GRPCNotFound || ge.Message != "widget not found" {
+		t.Fatalf("expected a NOT_FOUND error, got %v", err)
+	}
+
+	// the error reaches the handler's client with the same status
+	rr := httptest.NewRecorder()
+	_ = tools.GRPCErrorJSON(rr, err)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", rr.Code)
+	}
+}
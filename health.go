@@ -0,0 +1,105 @@
+package toolkit
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// HealthReport is the body of a Health response
+type HealthReport struct {
+	// Status is ok, draining or failing
+	Status string            `json:"status"`
+	Build  BuildInfo         `json:"build"`
+	Uptime string            `json:"uptime"`
+	Drain  *DrainState       `json:"drain,omitempty"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// Health is a health check endpoint for load balancers and orchestrators. It answers with a
+// HealthReport: the build, so a rollout can be followed, and the result of each check, with a
+// 200 when all pass and a 503 when one fails or the server is draining.
+type Health struct {
+	// Tools is used to write JSON
+	Tools *Tools
+	// Drainer, if set, makes the endpoint fail while draining, so the server is taken out of
+	// rotation before it stops
+	Drainer *Drainer
+	// Checks maps a name to a check of a dependency, such as a database ping. They run at
+	// once, each bounded by Timeout
+	Checks map[string]func(ctx context.Context) error
+	// Timeout bounds each check. Defaults to 5 seconds
+	Timeout time.Duration
+}
+
+// ServeHTTP runs the checks and writes the report
+func (h *Health) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	t := h.Tools
+	if t == nil {
+		t = &Tools{}
+	}
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+
+	report := HealthReport{
+		Status: "ok",
+		Build:  ReadBuildInfo(),
+		Uptime: time.Since(processStart).Round(time.Second).String(),
+	}
+	// settings are for the admin endpoints, not every load balancer probe
+	report.Build.Settings = nil
+
+	if len(h.Checks) > 0 {
+		names := make([]string, 0, len(h.Checks))
+		for name := range h.Checks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		results := make([]error, len(names))
+		var wg sync.WaitGroup
+		for i, name := range names {
+			i, check := i, h.Checks[name]
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			done := func(err error) {
+				cancel()
+				results[i] = err
+				wg.Done()
+			}
+			wg.Add(1)
+			// a panicking check is reported as failing
+			if err := DefaultGuard.goErr(func() error { return check(ctx) }, done); err != nil {
+				done(err)
+			}
+		}
+		wg.Wait()
+
+		report.Checks = make(map[string]string, len(names))
+		for i, name := range names {
+			report.Checks[name] = "ok"
+			if results[i] != nil {
+				report.Checks[name] = results[i].Error()
+				report.Status = "failing"
+			}
+		}
+	}
+
+	if h.Drainer != nil {
+		state := h.Drainer.State()
+		report.Drain = &state
+		if state.Draining {
+			report.Status = "draining"
+		}
+	}
+
+	status := http.StatusOK
+	if report.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	_ = t.WriteJSON(w, status, report)
+}
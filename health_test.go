@@ -0,0 +1,91 @@
+package toolkit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHealth(t *testing.T) {
+	defer func(l *log.Logger) { DefaultGuard.ErrorLog = l }(DefaultGuard.ErrorLog)
+	DefaultGuard.ErrorLog = log.New(io.Discard, "", 0)
+
+	drainer := &Drainer{}
+	var tests = []struct {
+		name       string
+		checks     map[string]func(ctx context.Context) error
+		drain      bool
+		wantStatus int
+		want       string
+	}{
+		{name: "no checks", wantStatus: http.StatusOK, want: "ok"},
+		{name: "passing", checks: map[string]func(context.Context) error{
+			"db": func(context.Context) error { return nil },
+		}, wantStatus: http.StatusOK, want: "ok"},
+		{name: "failing", checks: map[string]func(context.Context) error{
+			"db":    func(context.Context) error { return nil },
+			"redis": func(context.Context) error { return errors.New("connection refused") },
+		}, wantStatus: http.StatusServiceUnavailable, want: "failing"},
+		{name: "panicking", checks: map[string]func(context.Context) error{
+			"cache": func(context.Context) error { panic("nil map") },
+		}, wantStatus: http.StatusServiceUnavailable, want: "failing"},
+		{name: "draining", drain: true, wantStatus: http.StatusServiceUnavailable, want: "draining"},
+	}
+
+	for _, e := range tests {
+		if e.drain {
+			_ = drainer.Drain(context.Background())
+		}
+		h := &Health{Drainer: drainer, Checks: e.checks}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest("GET", "/healthz", nil))
+
+		if rr.Code != e.wantStatus {
+			t.Errorf("%s: expected status %d, got %d", e.name, e.wantStatus, rr.Code)
+		}
+		var report HealthReport
+		if err := json.NewDecoder(rr.Body).Decode(&report); err != nil {
+			t.Fatalf("%s: %v", e.name, err)
+		}
+		if report.Status != e.want {
+			t.Errorf("%s: expected status %q, got %q", e.name, e.want, report.Status)
+		}
+		if report.Build.GoVersion == "" || report.Build.Settings != nil {
+			t.Errorf("%s: expected the build without its settings, got %+v", e.name, report.Build)
+		}
+		if e.name == "failing" && report.Checks["redis"] != "connection refused" {
+			t.Errorf("%s: expected the failing check's error, got %v", e.name, report.Checks)
+		}
+	}
+}
+
+func TestBuildInfo(t *testing.T) {
+	defer func(v, c, d string) { Version, Commit, BuildDate = v, c, d }(Version, Commit, BuildDate)
+	Version, Commit, BuildDate = "v1.4.0", "3f2a9c1d5e7b", "2024-05-01T09:00:00Z"
+
+	info := ReadBuildInfo()
+	if info.Version != "v1.4.0" || info.Commit != "3f2a9c1d5e7b" || info.BuildDate != "2024-05-01T09:00:00Z" {
+		t.Errorf("expected the linker values, got %+v", info)
+	}
+
+	var tests = []struct {
+		info BuildInfo
+		want string
+	}{
+		{info: BuildInfo{Path: "example.com/app", Version: "v1.4.0", Commit: "3f2a9c1d5e7b", BuildDate: "2024-05-01T09:00:00Z", GoVersion: "go1.22.3"},
+			want: "example.com/app v1.4.0 (commit 3f2a9c1, built 2024-05-01T09:00:00Z, go1.22.3)"},
+		{info: BuildInfo{Path: "example.com/app", Commit: "3f2a9c1", Modified: true, GoVersion: "go1.22.3"},
+			want: "example.com/app devel (commit 3f2a9c1+modified, go1.22.3)"},
+		{info: BuildInfo{GoVersion: "go1.22.3"}, want: "app devel (go1.22.3)"},
+	}
+	for _, e := range tests {
+		if got := e.info.String(); got != e.want {
+			t.Errorf("expected %q, got %q", e.want, got)
+		}
+	}
+}
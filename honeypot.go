@@ -0,0 +1,159 @@
+package toolkit
+
+import (
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultHoneypotPaths are paths which only vulnerability scanners request on a site which
+// isn't running the software they belong to. A trailing "*" matches any suffix.
+var DefaultHoneypotPaths = []string{
+	"/wp-login.php",
+	"/wp-admin*",
+	"/xmlrpc.php",
+	"/.env",
+	"/.git/*",
+	"/phpmyadmin*",
+	"/admin.php",
+	"/config.php",
+	"/vendor/phpunit/*",
+	"/cgi-bin/*",
+}
+
+// decoyLoginPage is served to scanners, so they waste time trying to log in
+const decoyLoginPage = `<!DOCTYPE html>
+<html><head><title>Log In</title></head>
+<body><form method="post"><input name="log"><input name="pwd" type="password"><input type="submit" value="Log In"></form></body>
+</html>
+`
+
+// Honeypot catches requests for scanner paths, bans the client in the rate limiter, and
+// wastes the scanner's time with a slow or decoy response
+type Honeypot struct {
+	// Paths are the paths to trap. Defaults to DefaultHoneypotPaths
+	Paths []string
+	// Limiter is told to ban clients which hit a trap. Behind a reverse proxy, set its
+	// TrustedProxies, or use RequestContext, or every client would share the proxy's address
+	// and one scanner would ban them all. Until then, private and loopback addresses, which
+	// are likely the proxy's, are not banned
+	Limiter *RateLimiter
+	// BanFor is how long clients are banned for. Defaults to one hour
+	BanFor time.Duration
+	// Tarpit is how long to drip the response out for. Zero serves the decoy immediately
+	Tarpit time.Duration
+	// MaxTarpits is the most responses dripped at once; beyond it the decoy is served
+	// immediately, so the tarpit cannot be used to exhaust the server. Defaults to 100
+	MaxTarpits int
+	// Decoy is served to trapped clients. Defaults to a fake login page
+	Decoy http.Handler
+
+	tarpits int32
+}
+
+// Trapped reports whether a request is for one of the honeypot's paths
+func (h *Honeypot) Trapped(r *http.Request) bool {
+	paths := h.Paths
+	if paths == nil {
+		paths = DefaultHoneypotPaths
+	}
+
+	p := strings.ToLower(r.URL.Path)
+	for _, trap := range paths {
+		if strings.HasSuffix(trap, "*") {
+			if strings.HasPrefix(p, strings.TrimSuffix(trap, "*")) {
+				return true
+			}
+		} else if p == trap {
+			return true
+		}
+	}
+	return false
+}
+
+// Middleware traps requests for the honeypot's paths, and passes the rest through
+func (h *Honeypot) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !h.Trapped(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// ServeHTTP bans the client and serves the decoy, so the honeypot can also be mounted directly
+func (h *Honeypot) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.Limiter != nil {
+		banFor := h.BanFor
+		if banFor <= 0 {
+			banFor = time.Hour
+		}
+		if !h.maybeProxy(r) {
+			h.Limiter.Ban(h.Limiter.KeyOf(r), banFor)
+		}
+	}
+
+	if h.Tarpit > 0 {
+		maxTarpits := h.MaxTarpits
+		if maxTarpits <= 0 {
+			maxTarpits = 100
+		}
+		if atomic.AddInt32(&h.tarpits, 1) <= int32(maxTarpits) {
+			defer atomic.AddInt32(&h.tarpits, -1)
+			h.drip(w, r)
+			return
+		}
+		atomic.AddInt32(&h.tarpits, -1)
+	}
+
+	if h.Decoy != nil {
+		h.Decoy.ServeHTTP(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write([]byte(decoyLoginPage))
+}
+
+// maybeProxy reports whether the limiter would key r by an address which may be a reverse
+// proxy's, as no proxies are trusted and the address is private or loopback
+func (h *Honeypot) maybeProxy(r *http.Request) bool {
+	if h.Limiter.Key != nil || len(h.Limiter.TrustedProxies) > 0 {
+		return false
+	}
+	if _, ok := ClientIPFromContext(r.Context()); ok {
+		return false
+	}
+	ip := ClientIP(r, nil)
+	return ip != nil && (ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast())
+}
+
+// drip writes the decoy page a byte at a time, spread over the tarpit duration
+func (h *Honeypot) drip(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+
+	interval := h.Tarpit / time.Duration(len(decoyLoginPage))
+	if interval <= 0 {
+		interval = time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for i := 0; i < len(decoyLoginPage); i++ {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+
+		if _, err := w.Write([]byte{decoyLoginPage[i]}); err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
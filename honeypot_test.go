@@ -0,0 +1,97 @@
+package toolkit
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHoneypot_Middleware(t *testing.T) {
+	limiter := &RateLimiter{Rate: 100, Burst: 100}
+	hp := &Honeypot{Limiter: limiter}
+	handler := limiter.Middleware(hp.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("app"))
+	})))
+
+	var tests = []struct {
+		path     string
+		expected string
+	}{
+		{"/", "app"},
+		{"/wp-login.php", "<form"},
+		{"/WP-ADMIN/setup.php", "<form"},
+		{"/.git/config", "<form"},
+		{"/.github", "app"},
+	}
+
+	for i, e := range tests {
+		req := httptest.NewRequest("GET", e.path, nil)
+		req.RemoteAddr = "203.0.113." + string(rune('1'+i)) + ":1234"
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if !strings.Contains(rr.Body.String(), e.expected) {
+			t.Errorf("%s: expected %q in %q", e.path, e.expected, rr.Body.String())
+		}
+
+		// a trapped client is banned from the whole app
+		banned := e.expected != "app"
+		if limiter.Banned(strings.Split(req.RemoteAddr, ":")[0]) != banned {
+			t.Errorf("%s: expected banned to be %v", e.path, banned)
+		}
+		if banned {
+			rr = httptest.NewRecorder()
+			req = httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = "203.0.113." + string(rune('1'+i)) + ":1234"
+			handler.ServeHTTP(rr, req)
+			if rr.Code != http.StatusTooManyRequests {
+				t.Errorf("%s: expected banned client to get 429, got %d", e.path, rr.Code)
+			}
+		}
+	}
+}
+
+func TestHoneypot_Proxy(t *testing.T) {
+	_, proxies, _ := net.ParseCIDR("10.0.0.0/8")
+	var tests = []struct {
+		name    string
+		limiter *RateLimiter
+		banned  bool
+	}{
+		{name: "no trusted proxies", limiter: &RateLimiter{}},
+		{name: "trusted proxies", limiter: &RateLimiter{TrustedProxies: []*net.IPNet{proxies}}, banned: true},
+	}
+	for _, e := range tests {
+		hp := &Honeypot{Limiter: e.limiter}
+		req := httptest.NewRequest("GET", "/wp-login.php", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		hp.ServeHTTP(httptest.NewRecorder(), req)
+		if e.limiter.Banned("10.0.0.1") != e.banned {
+			t.Errorf("%s: expected the private address banned to be %v", e.name, e.banned)
+		}
+	}
+}
+
+func TestHoneypot_Tarpit(t *testing.T) {
+	hp := &Honeypot{Tarpit: 100 * time.Millisecond, MaxTarpits: 1}
+
+	start := time.Now()
+	rr := httptest.NewRecorder()
+	hp.ServeHTTP(rr, httptest.NewRequest("GET", "/wp-login.php", nil))
+	if time.Since(start) < 90*time.Millisecond {
+		t.Error("expected the response to be dripped slowly")
+	}
+	if rr.Body.String() != decoyLoginPage {
+		t.Error("expected the full decoy page")
+	}
+
+	// with the tarpit full, the decoy is served immediately
+	hp.tarpits = 1
+	start = time.Now()
+	hp.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/wp-login.php", nil))
+	if time.Since(start) > 50*time.Millisecond {
+		t.Error("expected the decoy to be served immediately")
+	}
+}
@@ -0,0 +1,244 @@
+package toolkit
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ByteSize is a number of bytes, which formats itself for people
+type ByteSize int64
+
+var (
+	decimalUnits = []string{"B", "kB", "MB", "GB", "TB", "PB", "EB"}
+	binaryUnits  = []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+)
+
+// String formats b in decimal units, as 1.4 MB
+func (b ByteSize) String() string {
+	return formatSize(int64(b), 1000, decimalUnits)
+}
+
+// IEC formats b in binary units, as 1.4 MiB
+func (b ByteSize) IEC() string {
+	return formatSize(int64(b), 1024, binaryUnits)
+}
+
+func formatSize(n int64, base float64, units []string) string {
+	sign := ""
+	v := float64(n)
+	if v < 0 {
+		sign, v = "-", -v
+	}
+	unit := 0
+	for v >= base && unit < len(units)-1 {
+		v /= base
+		unit++
+	}
+	if unit == 0 {
+		return sign + strconv.FormatInt(int64(v), 10) + " B"
+	}
+	// one decimal below 10, as in 1.4 MB, and none above, as in 14 MB
+	s := strconv.FormatFloat(v, 'f', 0, 64)
+	if v < 10 {
+		s = strings.TrimSuffix(strconv.FormatFloat(v, 'f', 1, 64), ".0")
+	}
+	return sign + s + " " + units[unit]
+}
+
+// Comma formats n with commas between each group of three digits, as 1,234,567
+func Comma(n int64) string {
+	s := strconv.FormatInt(n, 10)
+	sign := ""
+	if n < 0 {
+		sign, s = "-", s[1:]
+	}
+	var b strings.Builder
+	for i, c := range s {
+		if i > 0 && (len(s)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(c)
+	}
+	return sign + b.String()
+}
+
+// Humanizer formats times, durations and counts for people. The zero value writes English;
+// set its funcs to translate. It's safe for concurrent use once set up.
+type Humanizer struct {
+	// Plural picks the form of a word for n things. Defaults to singular for 1 and plural
+	// otherwise
+	Plural func(n int, singular, plural string) string
+	// Units names n units of time, where unit is second, minute, hour, day, month or year, as
+	// "3 minutes". Defaults to English through Plural
+	Units func(n int, unit string) string
+	// Relative phrases an amount of time, as written by Units, in the past or the future, as
+	// "3 minutes ago" or "in 3 minutes". Defaults to English
+	Relative func(amount string, future bool) string
+	// Now is written for times within a few seconds of now. Defaults to "just now"
+	Now string
+	// Ordinal writes the ordinal of n, as 1st. Defaults to English
+	Ordinal func(n int) string
+}
+
+func (h *Humanizer) plural(n int, singular, plural string) string {
+	if h.Plural != nil {
+		return h.Plural(n, singular, plural)
+	}
+	if n == 1 || n == -1 {
+		return singular
+	}
+	return plural
+}
+
+func (h *Humanizer) units(n int, unit string) string {
+	if h.Units != nil {
+		return h.Units(n, unit)
+	}
+	return strconv.Itoa(n) + " " + h.plural(n, unit, unit+"s")
+}
+
+// Pluralize writes n with the form of a word for n things, as "1 file" or "3 files". An empty
+// plural defaults to the English plural of singular.
+func (h *Humanizer) Pluralize(n int, singular, plural string) string {
+	if plural == "" {
+		plural = englishPlural(singular)
+	}
+	return strconv.Itoa(n) + " " + h.plural(n, singular, plural)
+}
+
+// englishPlural forms the plural of regular English nouns
+func englishPlural(word string) string {
+	lower := strings.ToLower(word)
+	switch {
+	case strings.HasSuffix(lower, "s"), strings.HasSuffix(lower, "x"), strings.HasSuffix(lower, "z"),
+		strings.HasSuffix(lower, "ch"), strings.HasSuffix(lower, "sh"):
+		return word + "es"
+	case len(lower) > 1 && strings.HasSuffix(lower, "y") && !strings.ContainsAny(lower[len(lower)-2:len(lower)-1], "aeiou"):
+		return word[:len(word)-1] + "ies"
+	}
+	return word + "s"
+}
+
+// timeUnits are the units of RelativeTime and Duration, largest first
+var timeUnits = []struct {
+	name string
+	size time.Duration
+}{
+	{"year", 365 * 24 * time.Hour},
+	{"month", 30 * 24 * time.Hour},
+	{"day", 24 * time.Hour},
+	{"hour", time.Hour},
+	{"minute", time.Minute},
+	{"second", time.Second},
+}
+
+// RelativeTime describes t relative to now in its largest whole unit, as "3 minutes ago" or
+// "in 2 days"
+func (h *Humanizer) RelativeTime(t, now time.Time) string {
+	d := t.Sub(now)
+	future := d > 0
+	if !future {
+		d = -d
+	}
+	if d < 5*time.Second {
+		if h.Now != "" {
+			return h.Now
+		}
+		return "just now"
+	}
+
+	amount := ""
+	for _, u := range timeUnits {
+		if d >= u.size {
+			amount = h.units(int(d/u.size), u.name)
+			break
+		}
+	}
+	if h.Relative != nil {
+		return h.Relative(amount, future)
+	}
+	if future {
+		return "in " + amount
+	}
+	return amount + " ago"
+}
+
+// Duration describes d in its two largest units, rounded down, as "2 hours 5 minutes"
+func (h *Humanizer) Duration(d time.Duration) string {
+	if d < 0 {
+		d = -d
+	}
+	if d < time.Second {
+		return h.units(0, "second")
+	}
+	var parts []string
+	for _, u := range timeUnits {
+		if d >= u.size {
+			parts = append(parts, h.units(int(d/u.size), u.name))
+			d %= u.size
+			if len(parts) == 2 || d < time.Second {
+				break
+			}
+		} else if len(parts) > 0 {
+			// don't skip a unit, as in 1 day 10 seconds
+			break
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// OrdinalOf writes the ordinal of n, as 1st, 2nd or 11th
+func (h *Humanizer) OrdinalOf(n int) string {
+	if h.Ordinal != nil {
+		return h.Ordinal(n)
+	}
+	suffix := "th"
+	switch abs := int(math.Abs(float64(n))); {
+	case abs%100 >= 11 && abs%100 <= 13:
+	case abs%10 == 1:
+		suffix = "st"
+	case abs%10 == 2:
+		suffix = "nd"
+	case abs%10 == 3:
+		suffix = "rd"
+	}
+	return strconv.Itoa(n) + suffix
+}
+
+// Funcs returns the helpers as template functions, named bytes, ibytes, comma, ago, duration,
+// ordinal and plural, for the Funcs method of text/template or html/template
+func (h *Humanizer) Funcs() map[string]any {
+	return map[string]any{
+		"bytes":    func(n int64) string { return ByteSize(n).String() },
+		"ibytes":   func(n int64) string { return ByteSize(n).IEC() },
+		"comma":    Comma,
+		"ago":      func(t time.Time) string { return h.RelativeTime(t, time.Now()) },
+		"duration": h.Duration,
+		"ordinal":  h.OrdinalOf,
+		"plural":   func(n int, singular string) string { return h.Pluralize(n, singular, "") },
+	}
+}
+
+var english Humanizer
+
+// RelativeTime describes t relative to now in English, as "3 minutes ago"
+func RelativeTime(t time.Time) string {
+	return english.RelativeTime(t, time.Now())
+}
+
+// HumanDuration describes d in English, as "2 hours 5 minutes"
+func HumanDuration(d time.Duration) string {
+	return english.Duration(d)
+}
+
+// Ordinal writes the English ordinal of n, as 1st
+func Ordinal(n int) string {
+	return english.OrdinalOf(n)
+}
+
+// Pluralize writes n with the English form of a word for n things, as "3 files"
+func Pluralize(n int, singular string) string {
+	return english.Pluralize(n, singular, "")
+}
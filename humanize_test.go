@@ -0,0 +1,166 @@
+package toolkit
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"text/template"
+	"time"
+)
+
+func TestByteSize(t *testing.T) {
+	var tests = []struct {
+		n       int64
+		decimal string
+		binary  string
+	}{
+		{n: 0, decimal: "0 B", binary: "0 B"},
+		{n: 999, decimal: "999 B", binary: "999 B"},
+		{n: 1000, decimal: "1 kB", binary: "1000 B"},
+		{n: 1400000, decimal: "1.4 MB", binary: "1.3 MiB"},
+		{n: 14200000, decimal: "14 MB", binary: "14 MiB"},
+		{n: 1 << 30, decimal: "1.1 GB", binary: "1 GiB"},
+		{n: -2500, decimal: "-2.5 kB", binary: "-2.4 KiB"},
+	}
+	for _, e := range tests {
+		if got := ByteSize(e.n).String(); got != e.decimal {
+			t.Errorf("%d: expected %s, got %s", e.n, e.decimal, got)
+		}
+		if got := ByteSize(e.n).IEC(); got != e.binary {
+			t.Errorf("%d: expected %s, got %s", e.n, e.binary, got)
+		}
+	}
+	if got := fmt.Sprint(ByteSize(2048)); got != "2 kB" {
+		t.Errorf("expected ByteSize to be a Stringer, got %s", got)
+	}
+}
+
+func TestComma(t *testing.T) {
+	var tests = []struct {
+		n    int64
+		want string
+	}{
+		{0, "0"}, {999, "999"}, {1000, "1,000"}, {1234567, "1,234,567"}, {-1234, "-1,234"},
+	}
+	for _, e := range tests {
+		if got := Comma(e.n); got != e.want {
+			t.Errorf("%d: expected %s, got %s", e.n, e.want, got)
+		}
+	}
+}
+
+func TestRelativeTime(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	var tests = []struct {
+		d    time.Duration
+		want string
+	}{
+		{d: 0, want: "just now"},
+		{d: -3 * time.Second, want: "just now"},
+		{d: -30 * time.Second, want: "30 seconds ago"},
+		{d: -time.Minute, want: "1 minute ago"},
+		{d: -3*time.Minute - 20*time.Second, want: "3 minutes ago"},
+		{d: 2 * time.Hour, want: "in 2 hours"},
+		{d: -36 * time.Hour, want: "1 day ago"},
+		{d: -45 * 24 * time.Hour, want: "1 month ago"},
+		{d: 800 * 24 * time.Hour, want: "in 2 years"},
+	}
+	var h Humanizer
+	for _, e := range tests {
+		if got := h.RelativeTime(now.Add(e.d), now); got != e.want {
+			t.Errorf("%v: expected %q, got %q", e.d, e.want, got)
+		}
+	}
+
+	// translated through the hooks
+	fr := Humanizer{
+		Now: "à l'instant",
+		Units: func(n int, unit string) string {
+			names := map[string]string{"second": "seconde", "minute": "minute", "hour": "heure", "day": "jour", "month": "mois", "year": "an"}
+			name := names[unit]
+			if n > 1 && unit != "month" {
+				name += "s"
+			}
+			return fmt.Sprintf("%d %s", n, name)
+		},
+		Relative: func(amount string, future bool) string {
+			if future {
+				return "dans " + amount
+			}
+			return "il y a " + amount
+		},
+	}
+	if got := fr.RelativeTime(now.Add(-3*time.Minute), now); got != "il y a 3 minutes" {
+		t.Errorf("unexpected translation %q", got)
+	}
+	if got := fr.RelativeTime(now.Add(2*time.Hour), now); got != "dans 2 heures" {
+		t.Errorf("unexpected translation %q", got)
+	}
+	if got := fr.RelativeTime(now, now); got != "à l'instant" {
+		t.Errorf("unexpected translation %q", got)
+	}
+}
+
+func TestHumanDuration(t *testing.T) {
+	var tests = []struct {
+		d    time.Duration
+		want string
+	}{
+		{d: 500 * time.Millisecond, want: "0 seconds"},
+		{d: time.Second, want: "1 second"},
+		{d: 90 * time.Second, want: "1 minute 30 seconds"},
+		{d: 2*time.Hour + 5*time.Minute + 10*time.Second, want: "2 hours 5 minutes"},
+		{d: 24*time.Hour + 10*time.Second, want: "1 day"},
+		{d: -3 * time.Hour, want: "3 hours"},
+	}
+	for _, e := range tests {
+		if got := HumanDuration(e.d); got != e.want {
+			t.Errorf("%v: expected %q, got %q", e.d, e.want, got)
+		}
+	}
+}
+
+func TestOrdinalAndPluralize(t *testing.T) {
+	var ordinals = []struct {
+		n    int
+		want string
+	}{
+		{1, "1st"}, {2, "2nd"}, {3, "3rd"}, {4, "4th"}, {11, "11th"}, {12, "12th"}, {13, "13th"},
+		{21, "21st"}, {102, "102nd"}, {111, "111th"}, {0, "0th"}, {-1, "-1st"},
+	}
+	for _, e := range ordinals {
+		if got := Ordinal(e.n); got != e.want {
+			t.Errorf("Ordinal(%d): expected %s, got %s", e.n, e.want, got)
+		}
+	}
+
+	var plurals = []struct {
+		n        int
+		singular string
+		want     string
+	}{
+		{1, "file", "1 file"}, {0, "file", "0 files"}, {3, "box", "3 boxes"}, {2, "match", "2 matches"},
+		{2, "entry", "2 entries"}, {2, "key", "2 keys"}, {2, "status", "2 statuses"},
+	}
+	for _, e := range plurals {
+		if got := Pluralize(e.n, e.singular); got != e.want {
+			t.Errorf("Pluralize(%d, %s): expected %s, got %s", e.n, e.singular, e.want, got)
+		}
+	}
+	var h Humanizer
+	if got := h.Pluralize(2, "child", "children"); got != "2 children" {
+		t.Errorf("expected an irregular plural, got %s", got)
+	}
+}
+
+func TestHumanizer_Funcs(t *testing.T) {
+	var h Humanizer
+	tmpl := template.Must(template.New("t").Funcs(h.Funcs()).Parse(`{{bytes .Size}}, {{plural .Count "file"}}, {{ordinal 2}}, {{comma 1500}}`))
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, map[string]any{"Size": int64(1400000), "Count": 3}); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != "1.4 MB, 3 files, 2nd, 1,500" {
+		t.Errorf("unexpected template output %q", got)
+	}
+}
@@ -0,0 +1,164 @@
+package toolkit
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+// ErrImageTooLarge is returned when an image has more pixels than allowed, which guards
+// against decompression bombs
+var ErrImageTooLarge = errors.New("image has too many pixels")
+
+// ImageFormat is an encoded image format
+type ImageFormat string
+
+// Image formats supported by the standard library
+const (
+	ImageJPEG ImageFormat = "jpeg"
+	ImagePNG  ImageFormat = "png"
+	ImageGIF  ImageFormat = "gif"
+)
+
+// ContentType returns the MIME type of the format
+func (f ImageFormat) ContentType() string {
+	return "image/" + string(f)
+}
+
+// DefaultMaxPixels is the most pixels DecodeImage accepts when no limit is given
+const DefaultMaxPixels = 50 * 1000 * 1000
+
+// DecodeImage decodes a JPEG, PNG or GIF image, or an image in the format of a registered
+// ImageCodec, refusing images with more than maxPixels pixels before decoding them. A
+// maxPixels of 0 means DefaultMaxPixels.
+func DecodeImage(r io.Reader, maxPixels int) (image.Image, ImageFormat, error) {
+	if maxPixels <= 0 {
+		maxPixels = DefaultMaxPixels
+	}
+
+	// the header is read twice, once for the size and once to decode
+	br := bufio.NewReaderSize(r, 256*1024)
+	header, _ := br.Peek(256 * 1024)
+
+	if codec := imageCodecFor(header); codec != nil {
+		img, err := codec.Decode(br, maxPixels)
+		if err != nil {
+			return nil, "", err
+		}
+		return img, codec.Format(), nil
+	}
+
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(header))
+	if err != nil {
+		return nil, "", err
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > maxPixels {
+		return nil, "", ErrImageTooLarge
+	}
+
+	img, _, err := image.Decode(br)
+	if err != nil {
+		return nil, "", err
+	}
+	return img, ImageFormat(format), nil
+}
+
+// EncodeImage encodes img in format, using a registered ImageEncoder for formats the standard
+// library doesn't support. Quality, from 1 to 100, applies to lossy formats; 0 means 85.
+func EncodeImage(w io.Writer, img image.Image, format ImageFormat, quality int) error {
+	if quality <= 0 || quality > 100 {
+		quality = 85
+	}
+
+	switch format {
+	case ImageJPEG:
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+	case ImagePNG:
+		return png.Encode(w, img)
+	case ImageGIF:
+		return gif.Encode(w, img, nil)
+	default:
+		if e := imageEncoderFor(format); e != nil {
+			return e.Encode(w, img, quality)
+		}
+		return fmt.Errorf("unsupported image format %q", format)
+	}
+}
+
+// FitSize returns the largest size with the aspect ratio of a width x height image which fits
+// within maxWidth x maxHeight, without enlarging it. A zero maximum leaves that side unbounded.
+func FitSize(width, height, maxWidth, maxHeight int) (int, int) {
+	if width <= 0 || height <= 0 {
+		return 0, 0
+	}
+
+	scale := 1.0
+	if maxWidth > 0 && width > maxWidth {
+		scale = float64(maxWidth) / float64(width)
+	}
+	if maxHeight > 0 && float64(height)*scale > float64(maxHeight) {
+		scale = float64(maxHeight) / float64(height)
+	}
+
+	w, h := int(float64(width)*scale+0.5), int(float64(height)*scale+0.5)
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+	return w, h
+}
+
+// ResizeImage scales src to width x height, averaging the source pixels under each output
+// pixel, which keeps thumbnails of detailed images smooth
+func ResizeImage(src image.Image, width, height int) *image.RGBA {
+	b := src.Bounds()
+	rgba, ok := src.(*image.RGBA)
+	if !ok || b.Min != (image.Point{}) {
+		rgba = image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+		draw.Draw(rgba, rgba.Bounds(), src, b.Min, draw.Src)
+	}
+	sw, sh := b.Dx(), b.Dy()
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := y * sh / height
+		y1 := (y + 1) * sh / height
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+
+		for x := 0; x < width; x++ {
+			x0 := x * sw / width
+			x1 := (x + 1) * sw / width
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var r, g, bl, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				row := rgba.Pix[sy*rgba.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r += uint32(p[0])
+					g += uint32(p[1])
+					bl += uint32(p[2])
+					a += uint32(p[3])
+					n++
+				}
+			}
+
+			d := dst.Pix[y*dst.Stride+x*4:]
+			d[0], d[1], d[2], d[3] = uint8(r/n), uint8(g/n), uint8(bl/n), uint8(a/n)
+		}
+	}
+	return dst
+}
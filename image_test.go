@@ -0,0 +1,69 @@
+package toolkit
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func testImage(w, h int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			// alternate black and white columns, which average to grey
+			if x%2 == 0 {
+				img.Set(x, y, color.White)
+			} else {
+				img.Set(x, y, color.Black)
+			}
+		}
+	}
+	return img
+}
+
+func TestFitSize(t *testing.T) {
+	var tests = []struct {
+		w, h, maxW, maxH int
+		expW, expH       int
+	}{
+		{1000, 500, 200, 200, 200, 100},
+		{500, 1000, 200, 200, 100, 200},
+		{100, 50, 200, 200, 100, 50},
+		{1000, 500, 200, 0, 200, 100},
+		{1000, 500, 0, 50, 100, 50},
+		{1000, 1, 10, 10, 10, 1},
+	}
+
+	for _, e := range tests {
+		w, h := FitSize(e.w, e.h, e.maxW, e.maxH)
+		if w != e.expW || h != e.expH {
+			t.Errorf("%dx%d in %dx%d: expected %dx%d, got %dx%d", e.w, e.h, e.maxW, e.maxH, e.expW, e.expH, w, h)
+		}
+	}
+}
+
+func TestResizeImage(t *testing.T) {
+	dst := ResizeImage(testImage(100, 50), 10, 5)
+	if dst.Bounds().Dx() != 10 || dst.Bounds().Dy() != 5 {
+		t.Fatalf("unexpected size %v", dst.Bounds())
+	}
+	if c := dst.RGBAAt(3, 2); c.R < 120 || c.R > 135 || c.A != 255 {
+		t.Errorf("expected columns to be averaged to grey, got %v", c)
+	}
+}
+
+func TestDecodeImage(t *testing.T) {
+	var buf bytes.Buffer
+	_ = png.Encode(&buf, testImage(40, 30))
+
+	img, format, err := DecodeImage(bytes.NewReader(buf.Bytes()), 0)
+	if err != nil || format != ImagePNG || img.Bounds().Dx() != 40 {
+		t.Errorf("unexpected decode: %v %s %v", img.Bounds(), format, err)
+	}
+
+	if _, _, err = DecodeImage(bytes.NewReader(buf.Bytes()), 1000); err != ErrImageTooLarge {
+		t.Errorf("expected ErrImageTooLarge, got %v", err)
+	}
+}
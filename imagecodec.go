@@ -0,0 +1,262 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Image formats which need a registered codec
+const (
+	ImageHEIC ImageFormat = "heic"
+	ImageAVIF ImageFormat = "avif"
+	ImageWebP ImageFormat = "webp"
+)
+
+// ImageCodec decodes an image format the standard library doesn't support, such as the HEIC
+// photos iPhones upload. Register codecs with RegisterImageCodec; DecodeImage, the thumbnail
+// handler and Ingest's image conversion then use them. A codec may wrap a cgo binding such as
+// libheif, or an external command with ExecImageCodec.
+type ImageCodec interface {
+	Format() ImageFormat
+	// Match reports whether header, the first bytes of a file, is in the codec's format
+	Match(header []byte) bool
+	// Decode decodes an image, refusing images with more than maxPixels pixels
+	Decode(r io.Reader, maxPixels int) (image.Image, error)
+}
+
+// ImageEncoder encodes an image format the standard library doesn't support, such as WebP.
+// An ImageCodec which also implements ImageEncoder is registered as both.
+type ImageEncoder interface {
+	Format() ImageFormat
+	Encode(w io.Writer, img image.Image, quality int) error
+}
+
+var imageCodecs = struct {
+	sync.RWMutex
+	decoders []ImageCodec
+	encoders map[ImageFormat]ImageEncoder
+}{encoders: make(map[ImageFormat]ImageEncoder)}
+
+// RegisterImageCodec adds a codec for DecodeImage to try before the standard library's
+// formats, and registers it as an encoder too if it implements ImageEncoder
+func RegisterImageCodec(c ImageCodec) {
+	imageCodecs.Lock()
+	defer imageCodecs.Unlock()
+
+	imageCodecs.decoders = append(imageCodecs.decoders, c)
+	if e, ok := c.(ImageEncoder); ok {
+		imageCodecs.encoders[e.Format()] = e
+	}
+}
+
+// RegisterImageEncoder adds an encoder for EncodeImage to use for its format
+func RegisterImageEncoder(e ImageEncoder) {
+	imageCodecs.Lock()
+	defer imageCodecs.Unlock()
+
+	imageCodecs.encoders[e.Format()] = e
+}
+
+// imageCodecFor returns the registered codec which matches header, if any
+func imageCodecFor(header []byte) ImageCodec {
+	imageCodecs.RLock()
+	defer imageCodecs.RUnlock()
+
+	for _, c := range imageCodecs.decoders {
+		if c.Match(header) {
+			return c
+		}
+	}
+	return nil
+}
+
+func imageEncoderFor(format ImageFormat) ImageEncoder {
+	imageCodecs.RLock()
+	defer imageCodecs.RUnlock()
+
+	return imageCodecs.encoders[format]
+}
+
+// heifBrands are the ISO base media file format brands of HEIC and AVIF images
+var heifBrands = map[ImageFormat][]string{
+	ImageHEIC: {"heic", "heix", "heim", "heis", "hevc", "hevx", "mif1", "msf1"},
+	ImageAVIF: {"avif", "avis"},
+}
+
+// MatchImageFormat reports whether header is a HEIC, AVIF or WebP file, from its signature
+func MatchImageFormat(format ImageFormat, header []byte) bool {
+	if format == ImageWebP {
+		return len(header) >= 12 && string(header[0:4]) == "RIFF" && string(header[8:12]) == "WEBP"
+	}
+
+	brands, ok := heifBrands[format]
+	if !ok || len(header) < 12 || string(header[4:8]) != "ftyp" {
+		return false
+	}
+	for _, brand := range brands {
+		if string(header[8:12]) == brand {
+			return true
+		}
+	}
+	return false
+}
+
+// ExecImageCodec is an ImageCodec which runs external commands, such as ImageMagick, libheif's
+// heif-convert, or cwebp. The decode command reads the image on stdin and writes a PNG to
+// stdout, e.g. []string{"magick", "heic:-", "png:-"}. The encode command, if set, reads a PNG
+// on stdin and writes the format to stdout, e.g. []string{"cwebp", "-q", "{quality}", "-o",
+// "-", "--", "-"}; {quality} is replaced by the quality.
+type ExecImageCodec struct {
+	ImageFormat   ImageFormat
+	DecodeCommand []string
+	EncodeCommand []string
+	// Timeout bounds each command. Defaults to 30 seconds
+	Timeout time.Duration
+}
+
+// Format implements ImageCodec
+func (c *ExecImageCodec) Format() ImageFormat {
+	return c.ImageFormat
+}
+
+// Match implements ImageCodec
+func (c *ExecImageCodec) Match(header []byte) bool {
+	return len(c.DecodeCommand) > 0 && MatchImageFormat(c.ImageFormat, header)
+}
+
+// Decode implements ImageCodec
+func (c *ExecImageCodec) Decode(r io.Reader, maxPixels int) (image.Image, error) {
+	if len(c.DecodeCommand) == 0 {
+		return nil, fmt.Errorf("no decode command for %s images", c.ImageFormat)
+	}
+
+	// the PNG can't be larger than its pixels at 16-bit RGBA, with a filter byte a row, and
+	// some room for framing and metadata
+	var maxOutput int64
+	if maxPixels > 0 {
+		maxOutput = int64(maxPixels)*9 + 1<<20
+	}
+	out, err := runCommand(context.Background(), c.Timeout, c.DecodeCommand, r, maxOutput)
+	if errors.Is(err, errOutputTooLarge) {
+		return nil, ErrImageTooLarge
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := png.DecodeConfig(bytes.NewReader(out))
+	if err != nil {
+		return nil, err
+	}
+	if maxPixels > 0 && cfg.Width*cfg.Height > maxPixels {
+		return nil, ErrImageTooLarge
+	}
+	return png.Decode(bytes.NewReader(out))
+}
+
+// Encode implements ImageEncoder
+func (c *ExecImageCodec) Encode(w io.Writer, img image.Image, quality int) error {
+	if len(c.EncodeCommand) == 0 {
+		return fmt.Errorf("no encode command for %s images", c.ImageFormat)
+	}
+
+	var in bytes.Buffer
+	if err := (&png.Encoder{CompressionLevel: png.NoCompression}).Encode(&in, img); err != nil {
+		return err
+	}
+
+	args := make([]string, len(c.EncodeCommand))
+	for i, arg := range c.EncodeCommand {
+		args[i] = strings.ReplaceAll(arg, "{quality}", strconv.Itoa(quality))
+	}
+	out, err := runCommand(context.Background(), c.Timeout, args, &in, 0)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(out)
+	return err
+}
+
+// errOutputTooLarge is returned by runCommand for a command which writes more than its limit
+var errOutputTooLarge = errors.New("command output too large")
+
+// cappedBuffer collects up to max bytes, if max is positive, failing writes beyond it
+type cappedBuffer struct {
+	buf      bytes.Buffer
+	max      int64
+	exceeded bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if b.max > 0 && int64(b.buf.Len()+len(p)) > b.max {
+		b.exceeded = true
+		return 0, errOutputTooLarge
+	}
+	return b.buf.Write(p)
+}
+
+// runCommand runs an external command with stdin, returning its output, which is refused with
+// errOutputTooLarge beyond maxOutput bytes if that is positive. Timeout defaults to 30 seconds.
+func runCommand(ctx context.Context, timeout time.Duration, args []string, stdin io.Reader, maxOutput int64) ([]byte, error) {
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	stdout := &cappedBuffer{max: maxOutput}
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = stdin, stdout, &stderr
+	err := cmd.Run()
+	// the command fails, or is killed by SIGPIPE, once its output is refused
+	if stdout.exceeded {
+		return nil, fmt.Errorf("%s: %w", args[0], errOutputTooLarge)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.buf.Bytes(), nil
+}
+
+// BrowserImageFormat returns the format to serve an image in, given the format it is stored
+// in and the request's Accept header: JPEG, PNG and GIF are kept, and other formats, such as
+// HEIC, are converted to WebP if the browser accepts it and an encoder is registered, or to
+// JPEG if not.
+func BrowserImageFormat(format ImageFormat, accept string) ImageFormat {
+	switch format {
+	case ImageJPEG, ImagePNG, ImageGIF:
+		return format
+	case ImageWebP:
+		if strings.Contains(accept, "image/webp") {
+			return format
+		}
+	}
+
+	if strings.Contains(accept, "image/webp") && imageEncoderFor(ImageWebP) != nil {
+		return ImageWebP
+	}
+	return ImageJPEG
+}
+
+// ConvertImage decodes an image in any supported format and encodes it in the format
+// BrowserImageFormat chooses for accept, which it returns
+func ConvertImage(dst io.Writer, src io.Reader, accept string, quality, maxPixels int) (ImageFormat, error) {
+	img, format, err := DecodeImage(src, maxPixels)
+	if err != nil {
+		return "", err
+	}
+
+	target := BrowserImageFormat(format, accept)
+	return target, EncodeImage(dst, img, target, quality)
+}
@@ -0,0 +1,222 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeHEICCodec decodes fake HEIC files, which are a HEIC file header followed by a PNG
+type fakeHEICCodec struct{}
+
+func (fakeHEICCodec) Format() ImageFormat { return ImageHEIC }
+
+func (fakeHEICCodec) Match(header []byte) bool { return MatchImageFormat(ImageHEIC, header) }
+
+func (fakeHEICCodec) Decode(r io.Reader, maxPixels int) (image.Image, error) {
+	if _, err := io.CopyN(io.Discard, r, 12); err != nil {
+		return nil, err
+	}
+	return png.Decode(r)
+}
+
+var registerFakeHEIC sync.Once
+
+func fakeHEIC(t *testing.T, w, h int) []byte {
+	registerFakeHEIC.Do(func() { RegisterImageCodec(fakeHEICCodec{}) })
+
+	buf := bytes.NewBufferString("\x00\x00\x00\x18ftypheic")
+	if err := png.Encode(buf, testImage(w, h)); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestMatchImageFormat(t *testing.T) {
+	var tests = []struct {
+		name   string
+		format ImageFormat
+		header string
+		exp    bool
+	}{
+		{"heic", ImageHEIC, "\x00\x00\x00\x18ftypheic\x00\x00", true},
+		{"heif mif1", ImageHEIC, "\x00\x00\x00\x18ftypmif1\x00\x00", true},
+		{"avif", ImageAVIF, "\x00\x00\x00\x1cftypavif\x00\x00", true},
+		{"avif as heic", ImageHEIC, "\x00\x00\x00\x1cftypavif\x00\x00", false},
+		{"mp4", ImageHEIC, "\x00\x00\x00\x18ftypisom\x00\x00", false},
+		{"webp", ImageWebP, "RIFF\x10\x00\x00\x00WEBPVP8 ", true},
+		{"wav", ImageWebP, "RIFF\x10\x00\x00\x00WAVEfmt ", false},
+		{"short", ImageHEIC, "\x00\x00\x00\x18ftyp", false},
+		{"jpeg", ImageJPEG, "\xff\xd8\xff\xe0\x00\x10JFIF\x00\x01", false},
+	}
+
+	for _, e := range tests {
+		if got := MatchImageFormat(e.format, []byte(e.header)); got != e.exp {
+			t.Errorf("%s: expected %v but got %v", e.name, e.exp, got)
+		}
+	}
+}
+
+func TestDecodeImage_Codec(t *testing.T) {
+	img, format, err := DecodeImage(bytes.NewReader(fakeHEIC(t, 8, 4)), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != ImageHEIC {
+		t.Errorf("expected heic but got %s", format)
+	}
+	if b := img.Bounds(); b.Dx() != 8 || b.Dy() != 4 {
+		t.Errorf("expected 8x4 but got %dx%d", b.Dx(), b.Dy())
+	}
+}
+
+type fakeWebPEncoder struct{}
+
+func (fakeWebPEncoder) Format() ImageFormat { return ImageWebP }
+
+func (fakeWebPEncoder) Encode(w io.Writer, img image.Image, quality int) error {
+	_, err := io.WriteString(w, "RIFF\x00\x00\x00\x00WEBP")
+	return err
+}
+
+func TestBrowserImageFormat(t *testing.T) {
+	var tests = []struct {
+		format ImageFormat
+		accept string
+		exp    ImageFormat
+	}{
+		{ImageJPEG, "image/webp,*/*", ImageJPEG},
+		{ImagePNG, "", ImagePNG},
+		{ImageHEIC, "image/webp,*/*", ImageJPEG},
+		{ImageHEIC, "", ImageJPEG},
+		{ImageAVIF, "text/html", ImageJPEG},
+		{ImageWebP, "image/webp", ImageWebP},
+	}
+
+	for _, e := range tests {
+		if got := BrowserImageFormat(e.format, e.accept); got != e.exp {
+			t.Errorf("%s for %q: expected %s but got %s", e.format, e.accept, e.exp, got)
+		}
+	}
+
+	// with a WebP encoder, browsers which accept WebP get it
+	RegisterImageEncoder(fakeWebPEncoder{})
+	t.Cleanup(func() {
+		imageCodecs.Lock()
+		delete(imageCodecs.encoders, ImageWebP)
+		imageCodecs.Unlock()
+	})
+	if got := BrowserImageFormat(ImageHEIC, "image/avif,image/webp,*/*"); got != ImageWebP {
+		t.Errorf("expected webp but got %s", got)
+	}
+	if got := BrowserImageFormat(ImageHEIC, "image/png"); got != ImageJPEG {
+		t.Errorf("expected jpeg but got %s", got)
+	}
+}
+
+func TestConvertImage(t *testing.T) {
+	var buf bytes.Buffer
+	format, err := ConvertImage(&buf, bytes.NewReader(fakeHEIC(t, 8, 4)), "text/html", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != ImageJPEG {
+		t.Fatalf("expected jpeg but got %s", format)
+	}
+	cfg, err := jpeg.DecodeConfig(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Width != 8 || cfg.Height != 4 {
+		t.Errorf("expected 8x4 but got %dx%d", cfg.Width, cfg.Height)
+	}
+}
+
+func TestExecImageCodec(t *testing.T) {
+	for _, name := range []string{"tail", "cat", "head"} {
+		if _, err := exec.LookPath(name); err != nil {
+			t.Skip(name, "is not installed")
+		}
+	}
+
+	// tail strips the fake HEIC header, leaving the PNG
+	c := &ExecImageCodec{
+		ImageFormat:   ImageHEIC,
+		DecodeCommand: []string{"tail", "-c", "+13"},
+		EncodeCommand: []string{"cat"},
+	}
+	if !c.Match(fakeHEIC(t, 1, 1)) {
+		t.Error("expected the codec to match a heic header")
+	}
+
+	img, err := c.Decode(bytes.NewReader(fakeHEIC(t, 8, 4)), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 8 || b.Dy() != 4 {
+		t.Errorf("expected 8x4 but got %dx%d", b.Dx(), b.Dy())
+	}
+
+	if _, err = c.Decode(bytes.NewReader(fakeHEIC(t, 8, 4)), 10); err != ErrImageTooLarge {
+		t.Errorf("expected ErrImageTooLarge but got %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err = c.Encode(&buf, img, 80); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = png.DecodeConfig(&buf); err != nil {
+		t.Errorf("expected the encoded png to be passed through: %v", err)
+	}
+
+	// output beyond what maxPixels allows is refused while the command runs
+	c.DecodeCommand = []string{"head", "-c", "4000000", "/dev/zero"}
+	if _, err = c.Decode(strings.NewReader("x"), 10); err != ErrImageTooLarge {
+		t.Errorf("expected ErrImageTooLarge for a large output but got %v", err)
+	}
+
+	c.DecodeCommand = []string{"false"}
+	if _, err = c.Decode(strings.NewReader("x"), 0); err == nil {
+		t.Error("expected an error from a failing command")
+	}
+}
+
+func TestIngest_ConvertImages(t *testing.T) {
+	store := &FileStorage{Dir: t.TempDir()}
+	in := &Ingest{Storage: store, Prefix: "in/"}
+	in.ConvertImages = true
+	ctx := context.Background()
+
+	f, err := in.File(ctx, "IMG_0001.HEIC", bytes.NewReader(fakeHEIC(t, 8, 4)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(f.NewFileName, ".jpg") || f.OriginalFileName != "IMG_0001.jpg" {
+		t.Errorf("expected a jpeg but got %s from %s", f.NewFileName, f.OriginalFileName)
+	}
+
+	rc, err := store.Get(ctx, "in/"+f.NewFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	if _, err = jpeg.DecodeConfig(rc); err != nil {
+		t.Errorf("expected a stored jpeg: %v", err)
+	}
+
+	// without conversion, the original is stored
+	in.ConvertImages = false
+	if f, err = in.File(ctx, "IMG_0001.HEIC", bytes.NewReader(fakeHEIC(t, 8, 4))); err != nil {
+		t.Fatal(err)
+	}
+	if strings.HasSuffix(f.NewFileName, ".jpg") {
+		t.Errorf("expected the original but got %s", f.NewFileName)
+	}
+}
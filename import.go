@@ -0,0 +1,500 @@
+package toolkit
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kaliadmen/toolkit/concurrency"
+)
+
+// ImportRow is a row read from an uploaded file, keyed by the header row
+type ImportRow struct {
+	Line   int
+	Values map[string]string
+}
+
+// RowError records why a row was rejected
+type RowError struct {
+	Line   int               `json:"line"`
+	Error  string            `json:"error"`
+	Values map[string]string `json:"values,omitempty"`
+}
+
+// ImportProgress is reported while an import runs
+type ImportProgress struct {
+	Processed int `json:"processed"`
+	Imported  int `json:"imported"`
+	Failed    int `json:"failed"`
+}
+
+// ImportReport is the outcome of an import
+type ImportReport struct {
+	Columns  []string   `json:"columns"`
+	Total    int        `json:"total"`
+	Imported int        `json:"imported"`
+	Failed   int        `json:"failed"`
+	Errors   []RowError `json:"errors,omitempty"`
+	// Aborted is set if the import stopped early because MaxErrors was reached
+	Aborted bool `json:"aborted,omitempty"`
+}
+
+// ErrorRows returns the rejected rows, with their line number and error, as a RowIterator,
+// so the error report can be downloaded with WriteTable or generated by the ExportManager
+func (rep *ImportReport) ErrorRows() RowIterator {
+	rows := &SliceRows{Cols: append([]string{"line", "error"}, rep.Columns...)}
+	for _, e := range rep.Errors {
+		row := []any{e.Line, e.Error}
+		for _, col := range rep.Columns {
+			row = append(row, e.Values[col])
+		}
+		rows.Rows = append(rows.Rows, row)
+	}
+	return rows
+}
+
+// Importer streams the rows of an uploaded CSV or XLSX file through validation into a
+// callback, collecting an error for each row that is rejected
+type Importer struct {
+	// Validate, if set, is called for each row before Handle. Rows which fail are not handled
+	Validate func(row ImportRow) error
+	// Handle is called for each valid row, e.g. to insert it into a database
+	Handle func(ctx context.Context, row ImportRow) error
+	// MaxErrors stops the import once this many rows have failed. Zero means no limit
+	MaxErrors int
+	// ProgressEvery is the number of rows between progress reports. Defaults to 100
+	ProgressEvery int
+	// Progress, if set, is called every ProgressEvery rows
+	Progress func(p ImportProgress)
+}
+
+// Import reads every row from r, which holds a file in the given format (FormatCSV or FormatXLSX).
+// The first row must contain the column names. Errors from individual rows are collected in the
+// report; the returned error is only set if the file itself cannot be read.
+func (im *Importer) Import(ctx context.Context, r io.Reader, format ExportFormat) (*ImportReport, error) {
+	var rr tableReader
+	switch format {
+	case FormatCSV:
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = -1
+		rr = cr
+	case FormatXLSX:
+		xr, err := newXLSXReader(r)
+		if err != nil {
+			return nil, err
+		}
+		rr = xr
+	default:
+		return nil, fmt.Errorf("unsupported import format %q", format)
+	}
+
+	header, err := rr.Read()
+	if err == io.EOF {
+		return nil, errors.New("import file is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i := range header {
+		header[i] = strings.TrimSpace(header[i])
+	}
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+
+	every := im.ProgressEvery
+	if every <= 0 {
+		every = 100
+	}
+
+	report := &ImportReport{Columns: header}
+	for {
+		if err = ctx.Err(); err != nil {
+			return report, err
+		}
+
+		record, err := rr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return report, err
+		}
+		if isBlankRecord(record) {
+			continue
+		}
+		line, _ := rr.FieldPos(0)
+
+		row := ImportRow{Line: line, Values: make(map[string]string, len(header))}
+		for i, col := range header {
+			if i < len(record) {
+				row.Values[col] = record[i]
+			} else {
+				row.Values[col] = ""
+			}
+		}
+
+		report.Total++
+		if err = im.process(ctx, row); err != nil {
+			report.Failed++
+			report.Errors = append(report.Errors, RowError{Line: line, Error: err.Error(), Values: row.Values})
+		} else {
+			report.Imported++
+		}
+
+		if im.Progress != nil && report.Total%every == 0 {
+			im.Progress(ImportProgress{Processed: report.Total, Imported: report.Imported, Failed: report.Failed})
+		}
+
+		if im.MaxErrors > 0 && report.Failed >= im.MaxErrors {
+			report.Aborted = true
+			break
+		}
+	}
+
+	if im.Progress != nil && report.Total%every != 0 {
+		im.Progress(ImportProgress{Processed: report.Total, Imported: report.Imported, Failed: report.Failed})
+	}
+
+	return report, nil
+}
+
+func (im *Importer) process(ctx context.Context, row ImportRow) error {
+	if im.Validate != nil {
+		if err := im.Validate(row); err != nil {
+			return err
+		}
+	}
+	if im.Handle != nil {
+		return im.Handle(ctx, row)
+	}
+	return nil
+}
+
+// Handler returns a handler which imports the first file of a multipart upload. The format is
+// taken from the file's extension. If the client accepts text/event-stream, progress events are
+// streamed while the import runs, followed by a "report" event; otherwise the report is
+// written as JSON when the import finishes.
+func (im *Importer) Handler(t *Tools) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		maxSize := int64(1024 * 1024 * 1024)
+		if t.MaxFileSize > 0 {
+			maxSize = int64(t.MaxFileSize)
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxSize)
+		if err := r.ParseMultipartForm(32 << 20); err != nil {
+			_ = t.ErrorJSON(w, err)
+			return
+		}
+		defer r.MultipartForm.RemoveAll()
+
+		var names []string
+		for name := range r.MultipartForm.File {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if len(names) == 0 || len(r.MultipartForm.File[names[0]]) == 0 {
+			_ = t.ErrorJSON(w, errors.New("no file uploaded"))
+			return
+		}
+
+		hdr := r.MultipartForm.File[names[0]][0]
+		format := ExportFormat(strings.ToLower(strings.TrimPrefix(filepath.Ext(hdr.Filename), ".")))
+		if format != FormatCSV && format != FormatXLSX {
+			_ = t.ErrorJSON(w, fmt.Errorf("unsupported import file type %q", filepath.Ext(hdr.Filename)), http.StatusUnsupportedMediaType)
+			return
+		}
+
+		f, err := hdr.Open()
+		if err != nil {
+			_ = t.ErrorJSON(w, err)
+			return
+		}
+		defer f.Close()
+
+		worker := *im
+		var sse *SSEWriter
+		var sent sync.Mutex
+		finished := false
+		if wantsEventStream(r) {
+			if sse, err = NewSSEWriter(w); err == nil {
+				// progress events are sent at most every 250ms, the latest of each burst, so a
+				// fast import doesn't flood the stream
+				throttle := &concurrency.Throttler{Interval: 250 * time.Millisecond}
+				defer throttle.Stop()
+				progress := im.Progress
+				worker.Progress = func(p ImportProgress) {
+					if progress != nil {
+						progress(p)
+					}
+					throttle.Do(func() {
+						sent.Lock()
+						defer sent.Unlock()
+						if !finished {
+							_ = sse.Send("progress", p)
+						}
+					})
+				}
+			}
+		}
+
+		report, err := worker.Import(r.Context(), f, format)
+		if sse != nil {
+			// a progress event held back by the throttle would come after the report
+			sent.Lock()
+			defer sent.Unlock()
+			finished = true
+			if err != nil {
+				_ = sse.Send("error", JSONResponse{Error: true, Message: err.Error()})
+				return
+			}
+			_ = sse.Send("report", report)
+			return
+		}
+
+		if err != nil {
+			_ = t.ErrorJSON(w, err)
+			return
+		}
+		_ = t.WriteJSON(w, http.StatusOK, report)
+	})
+}
+
+func isBlankRecord(record []string) bool {
+	for _, v := range record {
+		if strings.TrimSpace(v) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// tableReader reads one record at a time, like csv.Reader
+type tableReader interface {
+	Read() ([]string, error)
+	// FieldPos returns the line of the most recently read record, as csv.Reader does
+	FieldPos(field int) (line, column int)
+}
+
+// xlsxReader streams the rows of the first worksheet in a workbook
+type xlsxReader struct {
+	line   int
+	shared []string
+	dec    *xml.Decoder
+	rc     io.ReadCloser
+}
+
+func newXLSXReader(r io.Reader) (*xlsxReader, error) {
+	var ra io.ReaderAt
+	var size int64
+
+	// multipart files can be read in place; anything else is buffered
+	if f, ok := r.(interface {
+		io.ReaderAt
+		io.Seeker
+	}); ok {
+		end, err := f.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, err
+		}
+		ra, size = f, end
+	} else {
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		ra, size = bytes.NewReader(b), int64(len(b))
+	}
+
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		return nil, fmt.Errorf("not a valid xlsx file: %w", err)
+	}
+
+	var sheet *zip.File
+	xr := &xlsxReader{}
+	for _, f := range zr.File {
+		switch {
+		case f.Name == "xl/sharedStrings.xml":
+			if xr.shared, err = readSharedStrings(f); err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(f.Name, "xl/worksheets/sheet") && strings.HasSuffix(f.Name, ".xml"):
+			if sheet == nil || f.Name < sheet.Name {
+				sheet = f
+			}
+		}
+	}
+	if sheet == nil {
+		return nil, errors.New("xlsx file has no worksheets")
+	}
+
+	if xr.rc, err = sheet.Open(); err != nil {
+		return nil, err
+	}
+	xr.dec = xml.NewDecoder(xr.rc)
+	return xr, nil
+}
+
+func readSharedStrings(f *zip.File) ([]string, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var out []string
+	var current strings.Builder
+	inText := false
+
+	dec := xml.NewDecoder(rc)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch el := tok.(type) {
+		case xml.StartElement:
+			switch el.Name.Local {
+			case "si":
+				current.Reset()
+			case "t":
+				inText = true
+			case "rPh":
+				// phonetic hints are not part of the value
+				if err = dec.Skip(); err != nil {
+					return nil, err
+				}
+			}
+		case xml.EndElement:
+			switch el.Name.Local {
+			case "si":
+				out = append(out, current.String())
+			case "t":
+				inText = false
+			}
+		case xml.CharData:
+			if inText {
+				current.Write(el)
+			}
+		}
+	}
+}
+
+// Read returns the next row of the sheet
+func (xr *xlsxReader) Read() ([]string, error) {
+	var record []string
+	inRow := false
+
+	var cellType string
+	var cellCol int
+	var value strings.Builder
+	inValue := false
+
+	for {
+		tok, err := xr.dec.Token()
+		if err == io.EOF {
+			xr.rc.Close()
+			return nil, io.EOF
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch el := tok.(type) {
+		case xml.StartElement:
+			switch el.Name.Local {
+			case "row":
+				inRow = true
+				xr.line++
+				for _, a := range el.Attr {
+					if a.Name.Local == "r" {
+						if n, err := strconv.Atoi(a.Value); err == nil {
+							xr.line = n
+						}
+					}
+				}
+			case "c":
+				cellType, cellCol = "", len(record)
+				value.Reset()
+				for _, a := range el.Attr {
+					switch a.Name.Local {
+					case "t":
+						cellType = a.Value
+					case "r":
+						if col, ok := xlsxColumnIndex(a.Value); ok {
+							cellCol = col
+						}
+					}
+				}
+			case "v", "t":
+				inValue = true
+			}
+		case xml.EndElement:
+			switch el.Name.Local {
+			case "v", "t":
+				inValue = false
+			case "c":
+				for len(record) < cellCol {
+					record = append(record, "")
+				}
+				v := value.String()
+				if cellType == "s" {
+					i, err := strconv.Atoi(v)
+					if err != nil || i < 0 || i >= len(xr.shared) {
+						return nil, fmt.Errorf("invalid shared string reference %q", v)
+					}
+					v = xr.shared[i]
+				}
+				if cellType == "b" {
+					v = strconv.FormatBool(v == "1")
+				}
+				record = append(record, v)
+			case "row":
+				if inRow {
+					return record, nil
+				}
+			}
+		case xml.CharData:
+			if inValue {
+				value.Write(el)
+			}
+		}
+	}
+}
+
+// FieldPos returns the row number of the most recently read row
+func (xr *xlsxReader) FieldPos(field int) (int, int) {
+	return xr.line, field + 1
+}
+
+// xlsxColumnIndex converts a cell reference such as "AB12" to a zero based column index
+func xlsxColumnIndex(ref string) (int, bool) {
+	col := 0
+	n := 0
+	for _, c := range ref {
+		if c < 'A' || c > 'Z' {
+			break
+		}
+		col = col*26 + int(c-'A'+1)
+		n++
+	}
+	return col - 1, n > 0
+}
@@ -0,0 +1,144 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func testImporter(imported *[]ImportRow) *Importer {
+	return &Importer{
+		Validate: func(row ImportRow) error {
+			if row.Values["qty"] == "" {
+				return errors.New("qty is required")
+			}
+			return nil
+		},
+		Handle: func(ctx context.Context, row ImportRow) error {
+			*imported = append(*imported, row)
+			return nil
+		},
+		ProgressEvery: 1,
+	}
+}
+
+func TestImporter_Import(t *testing.T) {
+	var imported []ImportRow
+	var progress []ImportProgress
+
+	im := testImporter(&imported)
+	im.Progress = func(p ImportProgress) { progress = append(progress, p) }
+
+	csvFile := "\ufeffname,qty\nwidget,3\ngadget,\n\nsprocket,7\n"
+	report, err := im.Import(context.Background(), strings.NewReader(csvFile), FormatCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Total != 3 || report.Imported != 2 || report.Failed != 1 {
+		t.Errorf("wrong report totals: %+v", report)
+	}
+	if len(report.Errors) != 1 || report.Errors[0].Line != 3 {
+		t.Errorf("wrong row errors: %+v", report.Errors)
+	}
+	if len(imported) != 2 || imported[1].Values["name"] != "sprocket" {
+		t.Errorf("wrong rows handled: %+v", imported)
+	}
+	if len(progress) != 3 {
+		t.Error("expected 3 progress reports, got", len(progress))
+	}
+
+	// the error report can be written like any other table
+	var buf bytes.Buffer
+	if err = WriteRows(&buf, FormatCSV, report.ErrorRows()); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "line,error,name,qty\n3,qty is required,gadget,\n" {
+		t.Error("wrong error report:", buf.String())
+	}
+
+	// stop early once MaxErrors is reached
+	im.MaxErrors = 1
+	report, _ = im.Import(context.Background(), strings.NewReader("name,qty\na,\nb,\n"), FormatCSV)
+	if !report.Aborted || report.Total != 1 {
+		t.Errorf("expected the import to abort after one error: %+v", report)
+	}
+}
+
+func TestImporter_ImportXLSX(t *testing.T) {
+	var xlsx bytes.Buffer
+	err := WriteRows(&xlsx, FormatXLSX, &SliceRows{
+		Cols: []string{"name", "qty", "active"},
+		Rows: [][]any{
+			{"widget", 3, true},
+			{"gadget & co", nil, false},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var imported []ImportRow
+	report, err := testImporter(&imported).Import(context.Background(), bytes.NewReader(xlsx.Bytes()), FormatXLSX)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Imported != 1 || report.Failed != 1 {
+		t.Errorf("wrong report totals: %+v", report)
+	}
+	if imported[0].Values["qty"] != "3" || imported[0].Values["active"] != "true" {
+		t.Errorf("wrong values read: %+v", imported[0].Values)
+	}
+	if report.Errors[0].Values["name"] != "gadget & co" {
+		t.Errorf("wrong values in error: %+v", report.Errors[0].Values)
+	}
+}
+
+func TestImporter_Handler(t *testing.T) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, _ := mw.CreateFormFile("file", "items.csv")
+	_, _ = io.WriteString(part, "name,qty\nwidget,3\ngadget,\n")
+	_ = mw.Close()
+
+	var imported []ImportRow
+	var testTools Tools
+	handler := testImporter(&imported).Handler(&testTools)
+
+	// a plain request gets a JSON report
+	req := httptest.NewRequest("POST", "/", bytes.NewReader(body.Bytes()))
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	var report ImportReport
+	if err := json.NewDecoder(rr.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Imported != 1 || report.Failed != 1 {
+		t.Errorf("wrong report: %+v", report)
+	}
+
+	// an event stream request gets progress events and the report
+	req = httptest.NewRequest("POST", "/", bytes.NewReader(body.Bytes()))
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("Accept", "text/event-stream")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Header().Get("Content-Type") != "text/event-stream" {
+		t.Error("wrong content type", rr.Header().Get("Content-Type"))
+	}
+	// progress is throttled, so the second row's is held back, and dropped for the report
+	stream := rr.Body.String()
+	if strings.Count(stream, "event: progress\n") != 1 || strings.Index(stream, "event: report\n") < strings.Index(stream, "event: progress\n") {
+		t.Error("wrong event stream:", stream)
+	}
+}
@@ -0,0 +1,269 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+// ErrFileTypeNotAllowed is returned when an ingested file's detected type is not allowed
+var ErrFileTypeNotAllowed = errors.New("file type is not allowed")
+
+// Ingest runs files which don't arrive as HTTP uploads, such as files dropped over SFTP or
+// attached to email, through the steps of an upload: a size limit, content type detection,
+// SVG sanitization, scanning, moderation, and deduplicated storage under the SHA-256 of the
+// contents.
+type Ingest struct {
+	Storage Storage
+	// Prefix is prepended to the keys files are stored under
+	Prefix string
+	// MaxFileSize is the largest file accepted. Defaults to 1GB
+	MaxFileSize int64
+	// AllowedTypes are the MIME types accepted, such as "application/pdf". Empty allows any
+	AllowedTypes []string
+	// Scan, if set, checks each file before it is stored, such as with a virus scanner, and
+	// returns an error to reject it. Wrap it in a ScanCache to skip contents scanned recently
+	Scan func(ctx context.Context, name, contentType string, r io.Reader) error
+	// Quarantine, if set, holds the files Scan rejects for review, instead of discarding them
+	Quarantine *Quarantine
+	// Moderation, if set, checks images and text files as UploadFile does
+	Moderation *Moderation
+	// ConvertImages converts HEIC and AVIF images, which most browsers can't show, to JPEG
+	// before they are checked and stored. It needs an ImageCodec registered for the format.
+	ConvertImages bool
+	// TextExtraction, if set, extracts the text of each file for indexing once it is stored
+	TextExtraction *TextExtraction
+	// ImageHashes, if set, indexes the perceptual hash of each image once it is stored, and
+	// lists the near duplicates already in it in the record
+	ImageHashes *ImageHashIndex
+}
+
+// quarantine holds a file Scan rejected, returning the scan's error
+func (in *Ingest) quarantine(ctx context.Context, record *UploadedFile, contentType string, tmp *os.File, scanErr error) error {
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	f := QuarantinedFile{
+		Name:        record.OriginalFileName,
+		ContentType: contentType,
+		Size:        record.FileSize,
+		Checksum:    record.Checksum,
+		Reason:      scanErr.Error(),
+		Source:      "ingest",
+	}
+	if _, err := in.Quarantine.Hold(ctx, f, tmp); err != nil {
+		return fmt.Errorf("%w; quarantining the file failed: %v", scanErr, err)
+	}
+	return scanErr
+}
+
+// File runs one file through the pipeline. The returned record's NewFileName is the key it was
+// stored under, without the prefix. A file whose contents are already stored is not stored again.
+func (in *Ingest) File(ctx context.Context, name string, r io.Reader) (*UploadedFile, error) {
+	maxSize := in.MaxFileSize
+	if maxSize <= 0 {
+		maxSize = 1024 * 1024 * 1024
+	}
+
+	// spool to a temporary file, so the contents can be read by each step
+	tmp, sum, size, err := spoolIngest(r, maxSize)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if in.ConvertImages {
+		converted, err := convertIngestImage(tmp)
+		if err != nil {
+			return nil, err
+		}
+		if converted != nil {
+			defer os.Remove(converted.Name())
+			defer converted.Close()
+			if _, err = converted.Seek(0, io.SeekStart); err != nil {
+				return nil, err
+			}
+			if tmp, sum, size, err = spoolIngest(converted, maxSize); err != nil {
+				return nil, err
+			}
+			defer os.Remove(tmp.Name())
+			defer tmp.Close()
+			name = strings.TrimSuffix(name, path.Ext(name)) + ".jpg"
+		}
+	}
+
+	if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	mt, err := mimetype.DetectReader(tmp)
+	if err != nil {
+		return nil, err
+	}
+	if len(in.AllowedTypes) > 0 && !mimeAllowed(mt, in.AllowedTypes) {
+		return nil, ErrFileTypeNotAllowed
+	}
+
+	// SVGs are sanitized, so they can't run scripts when served back
+	if mt.Is(SVGContentType) {
+		if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		var clean bytes.Buffer
+		if err = SanitizeSVG(&clean, tmp); err != nil {
+			return nil, err
+		}
+		if tmp, sum, size, err = spoolIngest(&clean, maxSize); err != nil {
+			return nil, err
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+	}
+
+	record := &UploadedFile{
+		NewFileName:      sum + mt.Extension(),
+		OriginalFileName: baseFileName(name),
+		FileSize:         size,
+		Checksum:         sum,
+	}
+
+	if in.Scan != nil {
+		if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		if err = in.Scan(ctx, name, mt.String(), tmp); err != nil {
+			if in.Quarantine != nil && ctx.Err() == nil {
+				return nil, in.quarantine(ctx, record, mt.String(), tmp, err)
+			}
+			return nil, err
+		}
+	}
+
+	if in.Moderation != nil && in.Moderation.Moderator != nil {
+		if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		// OnFlag is given a request; ingested files get one which only carries the context
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, "/", nil)
+		if err != nil {
+			return nil, err
+		}
+		if record.Flagged, err = in.Moderation.checkUpload(req, record.OriginalFileName, mt.String(), tmp); err != nil {
+			return nil, err
+		}
+	}
+
+	key := in.Prefix + record.NewFileName
+	if _, err = in.Storage.Stat(ctx, key); err != nil {
+		if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		if err = in.Storage.Put(ctx, key, tmp); err != nil {
+			return nil, err
+		}
+	}
+
+	if in.ImageHashes != nil {
+		if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		record.NearDuplicates = in.ImageHashes.check(record.NewFileName, mt.String(), tmp)
+	}
+
+	if in.TextExtraction != nil {
+		if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		in.TextExtraction.run(ctx, record, mt, tmp)
+	}
+	return record, nil
+}
+
+// spoolIngest copies r to a temporary file, and returns it with the hex SHA-256 and size of
+// the contents
+func spoolIngest(r io.Reader, maxSize int64) (*os.File, string, int64, error) {
+	tmp, err := os.CreateTemp("", "toolkit-ingest-*")
+	if err != nil {
+		return nil, "", 0, err
+	}
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), io.LimitReader(r, maxSize+1))
+	if err == nil && size > maxSize {
+		err = &BodyTooLargeError{Limit: maxSize}
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, "", 0, err
+	}
+	return tmp, hex.EncodeToString(h.Sum(nil)), size, nil
+}
+
+// convertIngestImage converts f to a JPEG in a new temporary file if it is a HEIC or AVIF
+// image with a registered codec, and returns nil if it isn't
+func convertIngestImage(f *os.File) (*os.File, error) {
+	header := make([]byte, 64)
+	n, _ := f.ReadAt(header, 0)
+	codec := imageCodecFor(header[:n])
+	if codec == nil || (codec.Format() != ImageHEIC && codec.Format() != ImageAVIF) {
+		return nil, nil
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	out, err := os.CreateTemp("", "toolkit-ingest-*.jpg")
+	if err != nil {
+		return nil, err
+	}
+	if _, err = ConvertImage(out, f, "", 0, 0); err != nil {
+		out.Close()
+		os.Remove(out.Name())
+		return nil, err
+	}
+	return out, nil
+}
+
+// mimeAllowed reports whether a detected type, or one of its parents, is in allowed
+func mimeAllowed(mt *mimetype.MIME, allowed []string) bool {
+	for ; mt != nil; mt = mt.Parent() {
+		for _, a := range allowed {
+			if mt.Is(a) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// IngestSource delivers files from outside HTTP to an Ingest. DirectoryWatcher is one; an SFTP
+// server embedded with a library such as github.com/pkg/sftp can be another, by calling handle
+// from its write handler as each upload completes.
+type IngestSource interface {
+	// Serve calls handle for each file delivered until ctx is done. The error from handle
+	// tells the source whether the file was accepted.
+	Serve(ctx context.Context, handle func(ctx context.Context, name string, r io.Reader) error) error
+}
+
+// Serve ingests the files delivered by src until ctx is done. done, if set, is called with the
+// outcome of each file.
+func (in *Ingest) Serve(ctx context.Context, src IngestSource, done func(name string, f *UploadedFile, err error)) error {
+	return src.Serve(ctx, func(ctx context.Context, name string, r io.Reader) error {
+		f, err := in.File(ctx, name, r)
+		if done != nil {
+			done(name, f, err)
+		}
+		return err
+	})
+}
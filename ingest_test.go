@@ -0,0 +1,100 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIngest_File(t *testing.T) {
+	store := &FileStorage{Dir: t.TempDir()}
+	in := &Ingest{Storage: store, Prefix: "in/"}
+	ctx := context.Background()
+
+	f, err := in.File(ctx, "notes/report.txt", strings.NewReader("hello world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.OriginalFileName != "report.txt" || f.FileSize != 11 || !strings.HasSuffix(f.NewFileName, ".txt") {
+		t.Errorf("unexpected record %+v", f)
+	}
+	if f.Checksum != "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9" {
+		t.Errorf("unexpected checksum %s", f.Checksum)
+	}
+	if _, err = store.Stat(ctx, "in/"+f.NewFileName); err != nil {
+		t.Errorf("file was not stored: %v", err)
+	}
+
+	again, err := in.File(ctx, "copy.txt", strings.NewReader("hello world"))
+	if err != nil || again.NewFileName != f.NewFileName {
+		t.Errorf("expected duplicate to map to the same key, got %+v %v", again, err)
+	}
+
+	var tests = []struct {
+		name    string
+		setup   func(in *Ingest)
+		content string
+		err     error
+	}{
+		{"too large", func(in *Ingest) { in.MaxFileSize = 4 }, "hello", &BodyTooLargeError{Limit: 4}},
+		{"type not allowed", func(in *Ingest) { in.AllowedTypes = []string{"image/png"} }, "hello", ErrFileTypeNotAllowed},
+		{"scan rejects", func(in *Ingest) {
+			in.Scan = func(context.Context, string, string, io.Reader) error { return errors.New("infected") }
+		}, "hello", errors.New("infected")},
+	}
+
+	for _, e := range tests {
+		in := &Ingest{Storage: &FileStorage{Dir: t.TempDir()}, Prefix: "in/"}
+		e.setup(in)
+		_, err := in.File(ctx, "f.txt", strings.NewReader(e.content))
+		if err == nil || err.Error() != e.err.Error() {
+			t.Errorf("%s: expected %v, got %v", e.name, e.err, err)
+		}
+	}
+}
+
+func TestDirectoryWatcher(t *testing.T) {
+	store := &FileStorage{Dir: t.TempDir()}
+	in := &Ingest{Storage: store, Prefix: "in/"}
+	drop, err := os.MkdirTemp("", "drop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(drop)
+
+	_ = os.WriteFile(filepath.Join(drop, "a.txt"), []byte("aaa"), 0644)
+	_ = os.WriteFile(filepath.Join(drop, "b.csv.filepart"), []byte("partial"), 0644)
+
+	dw := &DirectoryWatcher{Dir: drop, SettleTime: time.Nanosecond, DoneDir: filepath.Join(drop, "done")}
+	var ingested []string
+	handle := func(ctx context.Context, name string, r io.Reader) error {
+		f, err := in.File(ctx, name, r)
+		if err == nil {
+			ingested = append(ingested, f.OriginalFileName)
+		}
+		return err
+	}
+
+	// the first poll only notes the file, which is picked up once it has settled
+	_ = dw.Poll(context.Background(), handle)
+	if len(ingested) != 0 {
+		t.Fatal("file was ingested before it settled")
+	}
+	time.Sleep(time.Millisecond)
+	_ = dw.Poll(context.Background(), handle)
+
+	if len(ingested) != 1 || ingested[0] != "a.txt" {
+		t.Errorf("expected a.txt to be ingested, got %v", ingested)
+	}
+	if _, err = os.Stat(filepath.Join(drop, "done", "a.txt")); err != nil {
+		t.Error("expected ingested file to be moved to the done directory")
+	}
+	if objects, _ := store.List(context.Background(), "in/"); len(objects) != 1 {
+		t.Errorf("expected one stored object, got %d", len(objects))
+	}
+}
@@ -0,0 +1,229 @@
+// Package ioutil provides the streaming helpers used by the toolkit's uploads and downloads:
+// counting and progress reporting, throttling, and copying one stream to several consumers.
+package ioutil
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CountingReader counts the bytes read through it. Count is safe to call while reading.
+type CountingReader struct {
+	R io.Reader
+	n int64
+}
+
+// NewCountingReader returns a CountingReader reading from r
+func NewCountingReader(r io.Reader) *CountingReader {
+	return &CountingReader{R: r}
+}
+
+func (cr *CountingReader) Read(p []byte) (int, error) {
+	n, err := cr.R.Read(p)
+	atomic.AddInt64(&cr.n, int64(n))
+	return n, err
+}
+
+// Count returns the number of bytes read so far
+func (cr *CountingReader) Count() int64 {
+	return atomic.LoadInt64(&cr.n)
+}
+
+// CountingWriter counts the bytes written through it. Count is safe to call while writing.
+type CountingWriter struct {
+	W io.Writer
+	n int64
+}
+
+// NewCountingWriter returns a CountingWriter writing to w
+func NewCountingWriter(w io.Writer) *CountingWriter {
+	return &CountingWriter{W: w}
+}
+
+func (cw *CountingWriter) Write(p []byte) (int, error) {
+	n, err := cw.W.Write(p)
+	atomic.AddInt64(&cw.n, int64(n))
+	return n, err
+}
+
+// Count returns the number of bytes written so far
+func (cw *CountingWriter) Count() int64 {
+	return atomic.LoadInt64(&cw.n)
+}
+
+// ProgressReader calls OnProgress as data is read, at most once per Every, and once more
+// when the reader reaches the end
+type ProgressReader struct {
+	R io.Reader
+	// Total is the expected size, passed on to OnProgress. Use -1 if unknown
+	Total      int64
+	OnProgress func(read, total int64)
+	// Every is the least time between calls. Defaults to 500 milliseconds
+	Every time.Duration
+
+	read int64
+	last time.Time
+}
+
+func (pr *ProgressReader) Read(p []byte) (int, error) {
+	n, err := pr.R.Read(p)
+	pr.read += int64(n)
+
+	every := pr.Every
+	if every <= 0 {
+		every = 500 * time.Millisecond
+	}
+	if pr.OnProgress != nil && (err == io.EOF || time.Since(pr.last) >= every) {
+		pr.last = time.Now()
+		pr.OnProgress(pr.read, pr.Total)
+	}
+	return n, err
+}
+
+// RateLimit is a token bucket of bytes. The ThrottledReaders sharing one read at no more than
+// its rate between them, such as all the uploads of one client.
+type RateLimit struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimit returns a RateLimit of bytesPerSecond, which allows burst bytes at once after
+// being idle. The burst defaults to bytesPerSecond. A rate of zero or less is unlimited
+func NewRateLimit(bytesPerSecond, burst int) *RateLimit {
+	if bytesPerSecond <= 0 {
+		return &RateLimit{}
+	}
+	if burst < 1 {
+		burst = bytesPerSecond
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimit{rate: float64(bytesPerSecond), burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// Reader returns a reader which reads from r within the limit
+func (l *RateLimit) Reader(ctx context.Context, r io.Reader) *ThrottledReader {
+	return &ThrottledReader{r: r, ctx: ctx, limit: l}
+}
+
+// Full reports whether the whole burst is available, as it is once the limit has been unused
+// for a while
+func (l *RateLimit) Full() bool {
+	if l.rate <= 0 {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.tokens+time.Since(l.last).Seconds()*l.rate >= l.burst
+}
+
+// take spends n tokens, which may leave the bucket in debt, and returns how long to wait
+// until the debt is paid
+func (l *RateLimit) take(n int) time.Duration {
+	if l.rate <= 0 {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// ThrottledReader limits the rate data is read at. It waits after reads which take its limit
+// into debt rather than failing, and stops waiting with the context's error if its context
+// is done.
+type ThrottledReader struct {
+	r     io.Reader
+	ctx   context.Context
+	limit *RateLimit
+}
+
+// NewThrottledReader returns a reader which reads from r at no more than bytesPerSecond
+func NewThrottledReader(ctx context.Context, r io.Reader, bytesPerSecond int) *ThrottledReader {
+	return NewRateLimit(bytesPerSecond, bytesPerSecond).Reader(ctx, r)
+}
+
+func (tr *ThrottledReader) Read(p []byte) (int, error) {
+	// read no more than a burst at a time, so a large buffer doesn't run far into debt
+	if burst := int(tr.limit.burst); burst > 0 && len(p) > burst {
+		p = p[:burst]
+	}
+
+	n, err := tr.r.Read(p)
+	if n > 0 {
+		if wait := tr.limit.take(n); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-tr.ctx.Done():
+				timer.Stop()
+				return n, tr.ctx.Err()
+			}
+		}
+	}
+	return n, err
+}
+
+// Tee returns a reader which writes everything read from r to each of writers, such as a
+// hash and a progress counter. A failed write is returned from Read.
+func Tee(r io.Reader, writers ...io.Writer) io.Reader {
+	return io.TeeReader(r, io.MultiWriter(writers...))
+}
+
+// Broadcast copies src to n readers which are consumed concurrently, such as an upload to
+// storage and a virus scan of the same stream. Each reader must be read to the end or
+// closed, or the others will stall. An error reading src is returned to every reader.
+func Broadcast(src io.Reader, n int) []io.ReadCloser {
+	readers := make([]io.ReadCloser, n)
+	writers := make([]*io.PipeWriter, n)
+	for i := range readers {
+		readers[i], writers[i] = io.Pipe()
+	}
+
+	go func() {
+		buf := make([]byte, 32*1024)
+		closed := make([]bool, n)
+		for {
+			nr, err := src.Read(buf)
+			if nr > 0 {
+				for i, w := range writers {
+					if closed[i] {
+						continue
+					}
+					// a reader which was closed early is dropped, so it doesn't stop the rest
+					if _, werr := w.Write(buf[:nr]); werr != nil {
+						closed[i] = true
+					}
+				}
+			}
+			if err != nil {
+				if err == io.EOF {
+					err = nil
+				}
+				for _, w := range writers {
+					_ = w.CloseWithError(err)
+				}
+				return
+			}
+		}
+	}()
+
+	return readers
+}
@@ -0,0 +1,151 @@
+package ioutil
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCounting(t *testing.T) {
+	cr := NewCountingReader(strings.NewReader("hello world"))
+	var buf bytes.Buffer
+	cw := NewCountingWriter(&buf)
+
+	if _, err := io.Copy(cw, cr); err != nil {
+		t.Fatal(err)
+	}
+	if cr.Count() != 11 || cw.Count() != 11 {
+		t.Errorf("expected 11 bytes counted, got %d and %d", cr.Count(), cw.Count())
+	}
+}
+
+func TestProgressReader(t *testing.T) {
+	var calls []int64
+	pr := &ProgressReader{
+		R:          io.LimitReader(strings.NewReader(strings.Repeat("x", 100)), 100),
+		Total:      100,
+		OnProgress: func(read, total int64) { calls = append(calls, read) },
+		Every:      time.Hour,
+	}
+
+	buf := make([]byte, 10)
+	for {
+		if _, err := pr.Read(buf); err != nil {
+			break
+		}
+	}
+
+	// the first read reports immediately, then only the end is reported
+	if len(calls) != 2 || calls[0] != 10 || calls[1] != 100 {
+		t.Errorf("unexpected progress calls %v", calls)
+	}
+}
+
+func TestThrottledReader(t *testing.T) {
+	data := strings.Repeat("x", 3000)
+
+	start := time.Now()
+	tr := NewThrottledReader(context.Background(), strings.NewReader(data), 10000)
+	out, err := io.ReadAll(tr)
+	if err != nil || string(out) != data {
+		t.Fatalf("unexpected read %d %v", len(out), err)
+	}
+	// the first 10000 bytes are a burst, so 3000 bytes should be quick
+	if time.Since(start) > 200*time.Millisecond {
+		t.Errorf("burst was throttled: %s", time.Since(start))
+	}
+
+	start = time.Now()
+	tr = NewThrottledReader(context.Background(), strings.NewReader(strings.Repeat("x", 3000)), 10000)
+	tr.limit.tokens = 0
+	_, _ = io.ReadAll(tr)
+	if elapsed := time.Since(start); elapsed < 250*time.Millisecond {
+		t.Errorf("expected about 300ms at 10000 bytes a second, took %s", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	tr = NewThrottledReader(ctx, strings.NewReader(data), 1)
+	tr.limit.tokens = 0
+	if _, err = tr.Read(make([]byte, 10)); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context error, got %v", err)
+	}
+}
+
+func TestRateLimit_Shared(t *testing.T) {
+	// two readers sharing a limit: 6000 bytes at 20000 a second, after a burst of 2000, take
+	// at least 200ms
+	limit := NewRateLimit(20000, 2000)
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = io.Copy(io.Discard, limit.Reader(context.Background(), bytes.NewReader(make([]byte, 3000))))
+		}()
+	}
+	wg.Wait()
+	if elapsed := time.Since(start); elapsed < 180*time.Millisecond {
+		t.Errorf("expected about 200ms, took %s", elapsed)
+	}
+	if limit.Full() {
+		t.Error("expected the limit to be in use")
+	}
+}
+
+func TestRateLimit_Unlimited(t *testing.T) {
+	for _, rate := range []int{0, -1} {
+		limit := NewRateLimit(rate, 0)
+		b, err := io.ReadAll(limit.Reader(context.Background(), strings.NewReader("unlimited")))
+		if err != nil || string(b) != "unlimited" {
+			t.Errorf("rate %d: expected everything read, got %q %v", rate, b, err)
+		}
+		if !limit.Full() {
+			t.Errorf("rate %d: expected an unlimited limit to be full", rate)
+		}
+	}
+}
+
+func TestTee(t *testing.T) {
+	h := sha256.New()
+	cw := NewCountingWriter(io.Discard)
+
+	_, _ = io.Copy(io.Discard, Tee(strings.NewReader("abc"), h, cw))
+	expected := sha256.Sum256([]byte("abc"))
+	if !bytes.Equal(h.Sum(nil), expected[:]) || cw.Count() != 3 {
+		t.Error("expected every writer to see the data")
+	}
+}
+
+func TestBroadcast(t *testing.T) {
+	data := strings.Repeat("broadcast ", 10000)
+	readers := Broadcast(strings.NewReader(data), 3)
+
+	// one consumer gives up early, and must not block the others
+	readers[2].Close()
+
+	var wg sync.WaitGroup
+	results := make([]string, 2)
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			b, _ := io.ReadAll(readers[i])
+			results[i] = string(b)
+		}(i)
+	}
+	wg.Wait()
+
+	for i, r := range results {
+		if r != data {
+			t.Errorf("reader %d got %d bytes, expected %d", i, len(r), len(data))
+		}
+	}
+}
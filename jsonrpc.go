@@ -0,0 +1,297 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// Standard JSON-RPC 2.0 error codes
+const (
+	JSONRPCParseError     = -32700
+	JSONRPCInvalidRequest = -32600
+	JSONRPCMethodNotFound = -32601
+	JSONRPCInvalidParams  = -32602
+	JSONRPCInternalError  = -32603
+	// JSONRPCServerError is the code of errors returned by methods, which carry their gRPC code
+	// and HTTP status in Data
+	JSONRPCServerError = -32000
+)
+
+// JSONRPCError is a JSON-RPC 2.0 error object. Methods may return one to choose the code.
+type JSONRPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+func (e *JSONRPCError) Error() string {
+	return fmt.Sprintf("jsonrpc error %d: %s", e.Code, e.Message)
+}
+
+// JSONRPCErrorData is the Data of errors returned by methods, classed as by GRPCCodeOf
+type JSONRPCErrorData struct {
+	Reason string `json:"reason"`
+	Status int    `json:"status"`
+}
+
+// rawJSON is an undecoded JSON value, as json.RawMessage
+type rawJSON []byte
+
+func (r rawJSON) MarshalJSON() ([]byte, error) {
+	if r == nil {
+		return []byte("null"), nil
+	}
+	return r, nil
+}
+
+func (r *rawJSON) UnmarshalJSON(data []byte) error {
+	*r = append((*r)[:0], data...)
+	return nil
+}
+
+type jsonrpcRequest struct {
+	JSONRPC string  `json:"jsonrpc"`
+	Method  string  `json:"method"`
+	Params  rawJSON `json:"params"`
+	ID      rawJSON `json:"id"`
+}
+
+type jsonrpcResponse struct {
+	JSONRPC string        `json:"jsonrpc"`
+	Result  any           `json:"result,omitempty"`
+	Error   *JSONRPCError `json:"error,omitempty"`
+	ID      rawJSON       `json:"id"`
+}
+
+type jsonrpcMethod func(ctx context.Context, params rawJSON) (any, error)
+
+// JSONRPCServer serves JSON-RPC 2.0 over HTTP POST, including batches and notifications. Add
+// methods with RegisterJSONRPC.
+type JSONRPCServer struct {
+	// MaxBatch caps the calls in a batch. Defaults to 100
+	MaxBatch int
+	// BatchConcurrency is the number of calls of a batch run at once. Defaults to 10
+	BatchConcurrency int
+	// MaxBodySize defaults to Tools.ReadJSON's limit of one megabyte
+	MaxBodySize int
+	// ErrorLog receives errors of methods which aren't a *JSONRPCError, as these are usually bugs
+	ErrorLog func(err error)
+
+	mu      sync.RWMutex
+	methods map[string]jsonrpcMethod
+}
+
+// RegisterJSONRPC adds a method to s, whose params are decoded into a P: by name from an object,
+// or, for a struct, by position from an array into its exported fields in order. Unknown
+// fields are invalid params.
+func RegisterJSONRPC[P, R any](s *JSONRPCServer, name string, fn func(ctx context.Context, params P) (R, error)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.methods == nil {
+		s.methods = make(map[string]jsonrpcMethod)
+	}
+	s.methods[name] = func(ctx context.Context, raw rawJSON) (any, error) {
+		var params P
+		if err := decodeJSONRPCParams(raw, &params); err != nil {
+			return nil, &JSONRPCError{Code: JSONRPCInvalidParams, Message: "invalid params: " + err.Error()}
+		}
+		return fn(ctx, params)
+	}
+}
+
+// Methods returns the names of the registered methods
+func (s *JSONRPCServer) Methods() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	names := make([]string, 0, len(s.methods))
+	for name := range s.methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func decodeJSONRPCParams(raw rawJSON, params any) error {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return nil
+	}
+
+	v := reflect.ValueOf(params).Elem()
+	if raw[0] == '[' && v.Kind() == reflect.Struct {
+		var positional []rawJSON
+		if err := json.Unmarshal(raw, &positional); err != nil {
+			return err
+		}
+		var fields []reflect.Value
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				fields = append(fields, v.Field(i))
+			}
+		}
+		if len(positional) > len(fields) {
+			return fmt.Errorf("expected at most %d params, got %d", len(fields), len(positional))
+		}
+		for i, p := range positional {
+			if err := json.Unmarshal(p, fields[i].Addr().Interface()); err != nil {
+				return fmt.Errorf("param %d: %w", i, err)
+			}
+		}
+		return nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	return dec.Decode(params)
+}
+
+// ServeHTTP answers a JSON-RPC request or batch
+func (s *JSONRPCServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var t Tools
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		_ = t.ErrorJSON(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	}
+	t.MaxFileSize = s.MaxBodySize
+
+	var body rawJSON
+	if err := t.ReadJSON(w, r, &body); err != nil {
+		_ = t.WriteJSON(w, http.StatusOK, jsonrpcResponse{
+			JSONRPC: "2.0",
+			Error:   &JSONRPCError{Code: JSONRPCParseError, Message: "parse error: " + err.Error()},
+			ID:      rawJSON("null"),
+		})
+		return
+	}
+	body = bytes.TrimSpace(body)
+
+	if len(body) == 0 || body[0] != '[' {
+		if res, ok := s.call(r.Context(), body); ok {
+			_ = t.WriteJSON(w, http.StatusOK, res)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	var batch []rawJSON
+	if err := json.Unmarshal(body, &batch); err != nil || len(batch) == 0 {
+		_ = t.WriteJSON(w, http.StatusOK, invalidJSONRPCRequest(nil))
+		return
+	}
+	maxBatch := s.MaxBatch
+	if maxBatch <= 0 {
+		maxBatch = 100
+	}
+	if len(batch) > maxBatch {
+		_ = t.WriteJSON(w, http.StatusOK, jsonrpcResponse{
+			JSONRPC: "2.0",
+			Error:   &JSONRPCError{Code: JSONRPCInvalidRequest, Message: fmt.Sprintf("batch of %d calls exceeds the limit of %d", len(batch), maxBatch)},
+			ID:      rawJSON("null"),
+		})
+		return
+	}
+
+	concurrency := s.BatchConcurrency
+	if concurrency <= 0 {
+		concurrency = 10
+	}
+	// calls not run because the client went away are left out, as no one will read the response
+	results, _ := MapN(r.Context(), concurrency, batch, func(ctx context.Context, raw rawJSON) (*jsonrpcResponse, error) {
+		res, _ := s.call(ctx, raw)
+		return res, nil
+	})
+
+	responses := make([]*jsonrpcResponse, 0, len(results))
+	for _, res := range results {
+		if res != nil {
+			responses = append(responses, res)
+		}
+	}
+	if len(responses) == 0 {
+		// a batch of notifications gets no response
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	_ = t.WriteJSON(w, http.StatusOK, responses)
+}
+
+func invalidJSONRPCRequest(id rawJSON) *jsonrpcResponse {
+	if id == nil {
+		id = rawJSON("null")
+	}
+	return &jsonrpcResponse{JSONRPC: "2.0", Error: &JSONRPCError{Code: JSONRPCInvalidRequest, Message: "invalid request"}, ID: id}
+}
+
+// call runs a single request, returning false for notifications, which get no response
+func (s *JSONRPCServer) call(ctx context.Context, raw rawJSON) (*jsonrpcResponse, bool) {
+	var req jsonrpcRequest
+	if err := json.Unmarshal(raw, &req); err != nil || req.JSONRPC != "2.0" || req.Method == "" {
+		return invalidJSONRPCRequest(req.ID), true
+	}
+	notification := req.ID == nil
+
+	s.mu.RLock()
+	method, ok := s.methods[req.Method]
+	s.mu.RUnlock()
+	if !ok {
+		return &jsonrpcResponse{
+			JSONRPC: "2.0",
+			Error:   &JSONRPCError{Code: JSONRPCMethodNotFound, Message: "method not found: " + req.Method},
+			ID:      req.ID,
+		}, !notification
+	}
+
+	result, err := s.invoke(ctx, method, req.Params)
+	if notification {
+		return nil, false
+	}
+	if err != nil {
+		return &jsonrpcResponse{JSONRPC: "2.0", Error: s.toJSONRPCError(err), ID: req.ID}, true
+	}
+	if result == nil {
+		result = rawJSON("null")
+	}
+	return &jsonrpcResponse{JSONRPC: "2.0", Result: result, ID: req.ID}, true
+}
+
+// invoke calls a method, recovering its panics as internal errors
+func (s *JSONRPCServer) invoke(ctx context.Context, method jsonrpcMethod, params rawJSON) (result any, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = &JSONRPCError{Code: JSONRPCInternalError, Message: "internal error"}
+			if s.ErrorLog != nil {
+				s.ErrorLog(fmt.Errorf("jsonrpc method panicked: %v", p))
+			}
+		}
+	}()
+	return method(ctx, params)
+}
+
+// toJSONRPCError classes a method's error by its gRPC code
+func (s *JSONRPCServer) toJSONRPCError(err error) *JSONRPCError {
+	var je *JSONRPCError
+	if errors.As(err, &je) {
+		return je
+	}
+	code := GRPCCodeOf(err)
+	if code == GRPCUnknown && s.ErrorLog != nil {
+		s.ErrorLog(err)
+	}
+	if code == GRPCInvalidArgument {
+		return &JSONRPCError{Code: JSONRPCInvalidParams, Message: err.Error()}
+	}
+	return &JSONRPCError{
+		Code:    JSONRPCServerError,
+		Message: err.Error(),
+		Data:    JSONRPCErrorData{Reason: code.String(), Status: code.HTTPStatus()},
+	}
+}
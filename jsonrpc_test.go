@@ -0,0 +1,121 @@
+package toolkit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestJSONRPCServer() *JSONRPCServer {
+	s := &JSONRPCServer{MaxBatch: 3}
+	type addParams struct {
+		A int `json:"a"`
+		B int `json:"b"`
+	}
+	RegisterJSONRPC(s, "add", func(ctx context.Context, p addParams) (int, error) {
+		return p.A + p.B, nil
+	})
+	RegisterJSONRPC(s, "get", func(ctx context.Context, p struct {
+		ID string `json:"id"`
+	}) (map[string]string, error) {
+		if p.ID != "1" {
+			return nil, fmt.Errorf("widget %s: %w", p.ID, ErrNotFound)
+		}
+		return map[string]string{"id": "1"}, nil
+	})
+	RegisterJSONRPC(s, "fail", func(ctx context.Context, p []string) (any, error) {
+		if len(p) > 0 {
+			return nil, &JSONRPCError{Code: 42, Message: p[0]}
+		}
+		panic("boom")
+	})
+	return s
+}
+
+func TestJSONRPCServer(t *testing.T) {
+	var tests = []struct {
+		name   string
+		body   string
+		status int
+		want   string
+	}{
+		{name: "by name", body: `{"jsonrpc":"2.0","method":"add","params":{"a":1,"b":2},"id":1}`, status: 200,
+			want: `{"jsonrpc":"2.0","result":3,"id":1}`},
+		{name: "by position", body: `{"jsonrpc":"2.0","method":"add","params":[4,5],"id":"x"}`, status: 200,
+			want: `{"jsonrpc":"2.0","result":9,"id":"x"}`},
+		{name: "too many params", body: `{"jsonrpc":"2.0","method":"add","params":[1,2,3],"id":1}`, status: 200,
+			want: `{"jsonrpc":"2.0","error":{"code":-32602,"message":"invalid params: expected at most 2 params, got 3"},"id":1}`},
+		{name: "unknown param", body: `{"jsonrpc":"2.0","method":"add","params":{"c":1},"id":1}`, status: 200,
+			want: `{"jsonrpc":"2.0","error":{"code":-32602,"message":"invalid params: json: unknown field \"c\""},"id":1}`},
+		{name: "not found", body: `{"jsonrpc":"2.0","method":"get","params":{"id":"2"},"id":2}`, status: 200,
+			want: `{"jsonrpc":"2.0","error":{"code":-32000,"message":"widget 2: object not found","data":{"reason":"NOT_FOUND","status":404}},"id":2}`},
+		{name: "custom error", body: `{"jsonrpc":"2.0","method":"fail","params":["nope"],"id":3}`, status: 200,
+			want: `{"jsonrpc":"2.0","error":{"code":42,"message":"nope"},"id":3}`},
+		{name: "panic", body: `{"jsonrpc":"2.0","method":"fail","id":3}`, status: 200,
+			want: `{"jsonrpc":"2.0","error":{"code":-32603,"message":"internal error"},"id":3}`},
+		{name: "no method", body: `{"jsonrpc":"2.0","method":"nope","id":4}`, status: 200,
+			want: `{"jsonrpc":"2.0","error":{"code":-32601,"message":"method not found: nope"},"id":4}`},
+		{name: "bad version", body: `{"jsonrpc":"1.0","method":"add","id":5}`, status: 200,
+			want: `{"jsonrpc":"2.0","error":{"code":-32600,"message":"invalid request"},"id":5}`},
+		{name: "parse error", body: `{"jsonrpc":`, status: 200,
+			want: `{"jsonrpc":"2.0","error":{"code":-32700,"message":"parse error: unexpected EOF"},"id":null}`},
+		{name: "notification", body: `{"jsonrpc":"2.0","method":"add","params":[1,2]}`, status: 204},
+		{name: "batch", body: `[{"jsonrpc":"2.0","method":"add","params":[1,1],"id":1},{"jsonrpc":"2.0","method":"add","params":[1,2]},{"jsonrpc":"2.0","method":"get","params":{"id":"1"},"id":2}]`, status: 200,
+			want: `[{"jsonrpc":"2.0","result":2,"id":1},{"jsonrpc":"2.0","result":{"id":"1"},"id":2}]`},
+		{name: "batch of notifications", body: `[{"jsonrpc":"2.0","method":"add","params":[1,1]}]`, status: 204},
+		{name: "empty batch", body: `[]`, status: 200,
+			want: `{"jsonrpc":"2.0","error":{"code":-32600,"message":"invalid request"},"id":null}`},
+		{name: "batch too large", body: `[1,2,3,4]`, status: 200,
+			want: `{"jsonrpc":"2.0","error":{"code":-32600,"message":"batch of 4 calls exceeds the limit of 3"},"id":null}`},
+		{name: "invalid batch member", body: `[1]`, status: 200,
+			want: `[{"jsonrpc":"2.0","error":{"code":-32600,"message":"invalid request"},"id":null}]`},
+	}
+
+	s := newTestJSONRPCServer()
+	for _, e := range tests {
+		rr := httptest.NewRecorder()
+		s.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(e.body)))
+		if rr.Code != e.status {
+			t.Errorf("%s: expected status %d, got %d", e.name, e.status, rr.Code)
+			continue
+		}
+		if got := strings.TrimSpace(rr.Body.String()); got != e.want {
+			t.Errorf("%s: expected\n%s\ngot\n%s", e.name, e.want, got)
+		}
+	}
+}
+
+func TestJSONRPCServer_ErrorLog(t *testing.T) {
+	s := newTestJSONRPCServer()
+	var logged []error
+	s.ErrorLog = func(err error) { logged = append(logged, err) }
+	RegisterJSONRPC(s, "bug", func(ctx context.Context, p any) (any, error) {
+		return nil, errors.New("nil pointer")
+	})
+
+	rr := httptest.NewRecorder()
+	s.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(`{"jsonrpc":"2.0","method":"bug","id":1}`)))
+	var res struct {
+		Error JSONRPCError `json:"error"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil || res.Error.Code != JSONRPCServerError {
+		t.Errorf("expected a server error, got %s", rr.Body.String())
+	}
+	if len(logged) != 1 {
+		t.Errorf("expected the unclassified error to be logged, got %v", logged)
+	}
+
+	rr = httptest.NewRecorder()
+	s.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/rpc", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected GET to be refused, got %d", rr.Code)
+	}
+	if got := strings.Join(s.Methods(), ","); got != "add,bug,fail,get" {
+		t.Errorf("unexpected methods %s", got)
+	}
+}
@@ -0,0 +1,101 @@
+package toolkit
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// LanguagePreference is one entry of an Accept-Language header
+type LanguagePreference struct {
+	Tag     string
+	Quality float64
+}
+
+// ParseAcceptLanguage parses an Accept-Language header into language tags ordered by
+// descending quality. Entries with a quality of zero, or which are malformed, are dropped.
+func ParseAcceptLanguage(header string) []LanguagePreference {
+	var prefs []LanguagePreference
+
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		tag, params, _ := strings.Cut(part, ";")
+		tag = strings.TrimSpace(tag)
+		q := 1.0
+
+		for _, param := range strings.Split(params, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if !ok || strings.TrimSpace(key) != "q" {
+				continue
+			}
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil || parsed < 0 || parsed > 1 {
+				q = 0
+			} else {
+				q = parsed
+			}
+		}
+
+		if tag == "" || q == 0 {
+			continue
+		}
+		prefs = append(prefs, LanguagePreference{Tag: tag, Quality: q})
+	}
+
+	sort.SliceStable(prefs, func(i, j int) bool { return prefs[i].Quality > prefs[j].Quality })
+	return prefs
+}
+
+// NegotiateLanguage picks the best of the supported language tags for the request's
+// Accept-Language header. Matching is case-insensitive, and falls back from a region or
+// script to its parent language, e.g. "de-AT" matches "de", and "zh-Hant-TW" matches "zh-Hant"
+// before "zh". A request for a bare language such as "en" matches the first supported
+// regional variant, e.g. "en-US". If nothing matches, the first supported tag is returned.
+func NegotiateLanguage(r *http.Request, supported []string) string {
+	return MatchLanguage(r.Header.Get("Accept-Language"), supported)
+}
+
+// MatchLanguage is NegotiateLanguage for a raw Accept-Language header value
+func MatchLanguage(header string, supported []string) string {
+	if len(supported) == 0 {
+		return ""
+	}
+
+	for _, pref := range ParseAcceptLanguage(header) {
+		if pref.Tag == "*" {
+			return supported[0]
+		}
+
+		// try the tag itself, then each parent, dropping one subtag at a time
+		for tag := pref.Tag; tag != ""; tag = parentLanguage(tag) {
+			for _, s := range supported {
+				if strings.EqualFold(s, tag) {
+					return s
+				}
+			}
+		}
+
+		// a bare language matches a regional variant
+		base := strings.SplitN(pref.Tag, "-", 2)[0]
+		for _, s := range supported {
+			if strings.EqualFold(strings.SplitN(s, "-", 2)[0], base) {
+				return s
+			}
+		}
+	}
+
+	return supported[0]
+}
+
+func parentLanguage(tag string) string {
+	i := strings.LastIndex(tag, "-")
+	if i < 0 {
+		return ""
+	}
+	return tag[:i]
+}
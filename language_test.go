@@ -0,0 +1,48 @@
+package toolkit
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseAcceptLanguage(t *testing.T) {
+	prefs := ParseAcceptLanguage("fr-CH, fr;q=0.9, en;q=0.8, de;q=0.7, *;q=0.5, es;q=0, it;q=oops")
+
+	want := []string{"fr-CH", "fr", "en", "de", "*"}
+	if len(prefs) != len(want) {
+		t.Fatal("wrong preferences", prefs)
+	}
+	for i, p := range prefs {
+		if p.Tag != want[i] {
+			t.Errorf("position %d: expected %s, got %s", i, want[i], p.Tag)
+		}
+	}
+}
+
+func TestNegotiateLanguage(t *testing.T) {
+	supported := []string{"en-US", "de", "zh-Hant", "zh", "pt-BR"}
+
+	var tests = []struct {
+		header string
+		want   string
+	}{
+		{"", "en-US"},
+		{"de-AT, en;q=0.5", "de"},
+		{"zh-Hant-TW", "zh-Hant"},
+		{"zh-Hans-CN", "zh"},
+		{"en", "en-US"},
+		{"pt-PT", "pt-BR"},
+		{"ja, *;q=0.1", "en-US"},
+		{"ja;q=0.9, de;q=1.0", "de"},
+		{"EN-us", "en-US"},
+		{"ja", "en-US"},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Language", e.header)
+		if got := NegotiateLanguage(req, supported); got != e.want {
+			t.Errorf("%q: expected %s, got %s", e.header, e.want, got)
+		}
+	}
+}
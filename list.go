@@ -0,0 +1,104 @@
+package toolkit
+
+import (
+	"sort"
+	"time"
+)
+
+// Tombstone stands in for a deleted item in a List, so that clients keeping a copy of the
+// list can remove it
+type Tombstone struct {
+	ID        string    `json:"id"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// List is a page of items for WriteJSON. Deleted holds tombstones for items deleted since the
+// client last synced, and Next the cursor of the following page, if there is one.
+type List[T any] struct {
+	Items   []T         `json:"items"`
+	Deleted []Tombstone `json:"deleted,omitempty"`
+	Next    string      `json:"next,omitempty"`
+}
+
+// NewList merges live items with tombstones of deleted ones. A tombstone for an ID which is
+// live again is dropped, duplicate tombstones are collapsed into the latest, and the
+// remaining tombstones are sorted by deletion time.
+func NewList[T any](live []T, deleted []Tombstone, id func(T) string) List[T] {
+	ids := make(map[string]bool, len(live))
+	for _, item := range live {
+		ids[id(item)] = true
+	}
+
+	latest := make(map[string]time.Time, len(deleted))
+	for _, ts := range deleted {
+		if ids[ts.ID] {
+			continue
+		}
+		if at, ok := latest[ts.ID]; !ok || ts.DeletedAt.After(at) {
+			latest[ts.ID] = ts.DeletedAt
+		}
+	}
+
+	l := List[T]{Items: live}
+	if l.Items == nil {
+		l.Items = []T{}
+	}
+	for tsID, at := range latest {
+		l.Deleted = append(l.Deleted, Tombstone{ID: tsID, DeletedAt: at})
+	}
+	sort.Slice(l.Deleted, func(i, j int) bool {
+		if l.Deleted[i].DeletedAt.Equal(l.Deleted[j].DeletedAt) {
+			return l.Deleted[i].ID < l.Deleted[j].ID
+		}
+		return l.Deleted[i].DeletedAt.Before(l.Deleted[j].DeletedAt)
+	})
+	return l
+}
+
+// SoftDeleted splits soft-deleted records into live items and tombstones, for stores which
+// mark records as deleted rather than removing them. deletedAt returns nil for live records.
+func SoftDeleted[T any](records []T, id func(T) string, deletedAt func(T) *time.Time) List[T] {
+	var live []T
+	var deleted []Tombstone
+	for _, rec := range records {
+		if at := deletedAt(rec); at != nil {
+			deleted = append(deleted, Tombstone{ID: id(rec), DeletedAt: *at})
+			continue
+		}
+		live = append(live, rec)
+	}
+	return NewList(live, deleted, id)
+}
+
+// Apply reconciles a client's copy of a list with a page of it: items in the page replace or
+// are added to local, and tombstoned items are removed. The order of local is kept, with new
+// items appended.
+func (l List[T]) Apply(local []T, id func(T) string) []T {
+	gone := make(map[string]bool, len(l.Deleted))
+	for _, ts := range l.Deleted {
+		gone[ts.ID] = true
+	}
+	updated := make(map[string]T, len(l.Items))
+	for _, item := range l.Items {
+		updated[id(item)] = item
+	}
+
+	merged := make([]T, 0, len(local)+len(l.Items))
+	for _, item := range local {
+		itemID := id(item)
+		if gone[itemID] {
+			continue
+		}
+		if u, ok := updated[itemID]; ok {
+			item = u
+			delete(updated, itemID)
+		}
+		merged = append(merged, item)
+	}
+	for _, item := range l.Items {
+		if _, ok := updated[id(item)]; ok {
+			merged = append(merged, item)
+		}
+	}
+	return merged
+}
@@ -0,0 +1,70 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type listItem struct {
+	ID      string     `json:"id"`
+	Name    string     `json:"name"`
+	Deleted *time.Time `json:"-"`
+}
+
+func listItemID(i listItem) string { return i.ID }
+
+func TestNewList(t *testing.T) {
+	t1 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+
+	l := NewList([]listItem{{ID: "a", Name: "A"}}, []Tombstone{
+		{ID: "b", DeletedAt: t1},
+		{ID: "c", DeletedAt: t2},
+		{ID: "b", DeletedAt: t2},
+		{ID: "a", DeletedAt: t1},
+	}, listItemID)
+
+	out, err := json.Marshal(l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"items":[{"id":"a","name":"A"}],"deleted":[{"id":"b","deleted_at":"2024-01-01T01:00:00Z"},{"id":"c","deleted_at":"2024-01-01T01:00:00Z"}]}`
+	if string(out) != expected {
+		t.Errorf("expected %s, got %s", expected, out)
+	}
+
+	out, _ = json.Marshal(NewList(nil, nil, listItemID))
+	if string(out) != `{"items":[]}` {
+		t.Errorf("expected an empty list, got %s", out)
+	}
+}
+
+func TestSoftDeleted(t *testing.T) {
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := SoftDeleted([]listItem{{ID: "a"}, {ID: "b", Deleted: &at}}, listItemID, func(i listItem) *time.Time {
+		return i.Deleted
+	})
+
+	if len(l.Items) != 1 || l.Items[0].ID != "a" {
+		t.Errorf("unexpected items %v", l.Items)
+	}
+	if !reflect.DeepEqual(l.Deleted, []Tombstone{{ID: "b", DeletedAt: at}}) {
+		t.Errorf("unexpected tombstones %v", l.Deleted)
+	}
+}
+
+func TestList_Apply(t *testing.T) {
+	local := []listItem{{ID: "a", Name: "old"}, {ID: "b"}, {ID: "c"}}
+	page := List[listItem]{
+		Items:   []listItem{{ID: "d"}, {ID: "a", Name: "new"}},
+		Deleted: []Tombstone{{ID: "b"}},
+	}
+
+	got := page.Apply(local, listItemID)
+	expected := []listItem{{ID: "a", Name: "new"}, {ID: "c"}, {ID: "d"}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
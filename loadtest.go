@@ -0,0 +1,270 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// loadTestBuckets are the upper bounds of the latency histogram's buckets
+var loadTestBuckets = []time.Duration{
+	time.Millisecond, 2 * time.Millisecond, 5 * time.Millisecond,
+	10 * time.Millisecond, 20 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 200 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2 * time.Second, 5 * time.Second, 10 * time.Second,
+}
+
+// LoadTest sends requests to a URL from concurrent workers, for benchmarking endpoints
+// without external tools
+type LoadTest struct {
+	URL string
+	// Method defaults to GET, or POST when there is a Payload
+	Method string
+	Header http.Header
+	// Payload is a text/template for request bodies, rendered for each request with a *Faker
+	// as its data, e.g. {"name": "{{ .Name }}", "email": "{{ .Email }}"}
+	Payload string
+	// Concurrency is the number of workers. Defaults to 10
+	Concurrency int
+	// Duration is how long the test runs. Defaults to 10 seconds
+	Duration time.Duration
+	// Requests, if positive, stops the test after this many requests
+	Requests int
+	// Client defaults to a client with a 30 second timeout
+	Client *http.Client
+	// Seed seeds the fakers of the payload template
+	Seed int64
+}
+
+// LatencyBucket is a bar of a latency histogram: the requests which took up to UpTo, and
+// longer than the previous bucket's UpTo. The last bucket's UpTo is zero, for slower requests.
+type LatencyBucket struct {
+	UpTo  time.Duration `json:"up_to"`
+	Count int           `json:"count"`
+}
+
+// LoadTestResult summarizes a load test
+type LoadTestResult struct {
+	Requests int `json:"requests"`
+	// Errors are requests which got no response
+	Errors int `json:"errors"`
+	// FirstError is the first of the errors
+	FirstError string        `json:"first_error,omitempty"`
+	Statuses   map[int]int   `json:"statuses"`
+	Bytes      int64         `json:"bytes"`
+	Duration   time.Duration `json:"duration"`
+	Min        time.Duration `json:"min"`
+	Mean       time.Duration `json:"mean"`
+	P50        time.Duration `json:"p50"`
+	P90        time.Duration `json:"p90"`
+	P99        time.Duration `json:"p99"`
+	Max        time.Duration `json:"max"`
+	// Histogram holds the latencies of the requests which got a response
+	Histogram []LatencyBucket `json:"histogram"`
+}
+
+// Run runs the test until its duration or request count is reached, or ctx is done
+func (lt *LoadTest) Run(ctx context.Context) (*LoadTestResult, error) {
+	if lt.URL == "" {
+		return nil, errors.New("load test has no URL")
+	}
+	var payload *template.Template
+	if lt.Payload != "" {
+		var err error
+		if payload, err = template.New("payload").Option("missingkey=error").Parse(lt.Payload); err != nil {
+			return nil, err
+		}
+	}
+	method := lt.Method
+	if method == "" {
+		method = http.MethodGet
+		if payload != nil {
+			method = http.MethodPost
+		}
+	}
+	concurrency := lt.Concurrency
+	if concurrency <= 0 {
+		concurrency = 10
+	}
+	duration := lt.Duration
+	if duration <= 0 {
+		duration = 10 * time.Second
+	}
+	client := lt.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+
+	var (
+		mu        sync.Mutex
+		result    = &LoadTestResult{Statuses: make(map[int]int)}
+		latencies []time.Duration
+		started   int
+		wg        sync.WaitGroup
+		renderErr error
+	)
+	// next claims a request, returning false once the test is over
+	next := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		if ctx.Err() != nil || renderErr != nil || (lt.Requests > 0 && started >= lt.Requests) {
+			return false
+		}
+		started++
+		return true
+	}
+
+	start := time.Now()
+	for i := 0; i < concurrency; i++ {
+		faker := NewFaker(lt.Seed + int64(i))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for next() {
+				var body io.Reader
+				if payload != nil {
+					var b strings.Builder
+					if err := payload.Execute(&b, faker); err != nil {
+						mu.Lock()
+						renderErr = err
+						mu.Unlock()
+						return
+					}
+					body = strings.NewReader(b.String())
+				}
+				req, err := http.NewRequestWithContext(ctx, method, lt.URL, body)
+				if err != nil {
+					mu.Lock()
+					renderErr = err
+					mu.Unlock()
+					return
+				}
+				for k, v := range lt.Header {
+					req.Header[k] = v
+				}
+				if payload != nil && req.Header.Get("Content-Type") == "" {
+					req.Header.Set("Content-Type", "application/json")
+				}
+
+				sent := time.Now()
+				res, err := client.Do(req)
+				var n int64
+				if err == nil {
+					n, err = io.Copy(io.Discard, res.Body)
+					res.Body.Close()
+				}
+				latency := time.Since(sent)
+
+				mu.Lock()
+				switch {
+				case err != nil && ctx.Err() != nil:
+					// cut short by the end of the test, so not counted
+				case err != nil:
+					result.Requests++
+					result.Errors++
+					if result.FirstError == "" {
+						result.FirstError = err.Error()
+					}
+				default:
+					result.Requests++
+					result.Statuses[res.StatusCode]++
+					result.Bytes += n
+					latencies = append(latencies, latency)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	result.Duration = time.Since(start)
+	if renderErr != nil {
+		return nil, renderErr
+	}
+
+	result.summarize(latencies)
+	return result, nil
+}
+
+func (r *LoadTestResult) summarize(latencies []time.Duration) {
+	r.Histogram = make([]LatencyBucket, len(loadTestBuckets)+1)
+	for i, upTo := range loadTestBuckets {
+		r.Histogram[i].UpTo = upTo
+	}
+	if len(latencies) == 0 {
+		return
+	}
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	var total time.Duration
+	for _, l := range latencies {
+		total += l
+		i := sort.Search(len(loadTestBuckets), func(i int) bool { return l <= loadTestBuckets[i] })
+		r.Histogram[i].Count++
+	}
+	percentile := func(p int) time.Duration {
+		return latencies[(len(latencies)-1)*p/100]
+	}
+	r.Min, r.Max = latencies[0], latencies[len(latencies)-1]
+	r.Mean = total / time.Duration(len(latencies))
+	r.P50, r.P90, r.P99 = percentile(50), percentile(90), percentile(99)
+}
+
+// Rate returns the requests per second
+func (r *LoadTestResult) Rate() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Requests) / r.Duration.Seconds()
+}
+
+// WriteReport writes the result as text, with the histogram as bars
+func (r *LoadTestResult) WriteReport(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d requests in %s (%.1f/s), %d errors\n", r.Requests, r.Duration.Round(time.Millisecond), r.Rate(), r.Errors)
+	if r.FirstError != "" {
+		fmt.Fprintf(&b, "first error: %s\n", r.FirstError)
+	}
+
+	statuses := make([]int, 0, len(r.Statuses))
+	for status := range r.Statuses {
+		statuses = append(statuses, status)
+	}
+	sort.Ints(statuses)
+	for _, status := range statuses {
+		fmt.Fprintf(&b, "status %d: %d\n", status, r.Statuses[status])
+	}
+
+	fmt.Fprintf(&b, "latency min %s, mean %s, p50 %s, p90 %s, p99 %s, max %s\n",
+		r.Min.Round(time.Microsecond), r.Mean.Round(time.Microsecond), r.P50.Round(time.Microsecond),
+		r.P90.Round(time.Microsecond), r.P99.Round(time.Microsecond), r.Max.Round(time.Microsecond))
+
+	most := 0
+	for _, bucket := range r.Histogram {
+		if bucket.Count > most {
+			most = bucket.Count
+		}
+	}
+	for _, bucket := range r.Histogram {
+		if bucket.Count == 0 {
+			continue
+		}
+		label := "> " + loadTestBuckets[len(loadTestBuckets)-1].String()
+		if bucket.UpTo > 0 {
+			label = "<= " + bucket.UpTo.String()
+		}
+		fmt.Fprintf(&b, "%10s %8d %s\n", label, bucket.Count, strings.Repeat("#", (bucket.Count*40+most-1)/most))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
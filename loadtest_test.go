@@ -0,0 +1,86 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLoadTest_Run(t *testing.T) {
+	var mu sync.Mutex
+	var emails []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct{ Email string }
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || r.Method != http.MethodPost || r.Header.Get("X-Test") != "yes" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		emails = append(emails, body.Email)
+		n := len(emails)
+		mu.Unlock()
+		if n%5 == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	lt := &LoadTest{
+		URL:         srv.URL,
+		Header:      http.Header{"X-Test": {"yes"}},
+		Payload:     `{"name": "{{ .Name }}", "email": "{{ .Email }}"}`,
+		Concurrency: 4,
+		Requests:    50,
+	}
+	result, err := lt.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Requests != 50 || result.Errors != 0 || result.Statuses[http.StatusOK] != 40 || result.Statuses[http.StatusServiceUnavailable] != 10 || result.Bytes != 100 {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if len(emails) != 50 || !strings.Contains(emails[0], "@example.") || emails[0] == emails[1] {
+		t.Errorf("expected rendered payloads, got %v", emails)
+	}
+	count := 0
+	for _, b := range result.Histogram {
+		count += b.Count
+	}
+	if count != 50 || result.Min > result.P50 || result.P50 > result.P99 || result.P99 > result.Max {
+		t.Errorf("unexpected latencies %+v", result)
+	}
+
+	var report bytes.Buffer
+	if err = result.WriteReport(&report); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"50 requests in", "status 200: 40", "status 503: 10", "latency min", "#"} {
+		if !strings.Contains(report.String(), want) {
+			t.Errorf("expected the report to contain %q:\n%s", want, report.String())
+		}
+	}
+}
+
+func TestLoadTest_Errors(t *testing.T) {
+	if _, err := (&LoadTest{}).Run(context.Background()); err == nil {
+		t.Error("expected an error without a URL")
+	}
+	if _, err := (&LoadTest{URL: "http://127.0.0.1", Payload: "{{ .Nope }}"}).Run(context.Background()); err == nil {
+		t.Error("expected an error for a bad payload template")
+	}
+
+	// requests which get no response are counted as errors
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.Close()
+	result, err := (&LoadTest{URL: srv.URL, Concurrency: 1, Requests: 3, Duration: time.Second}).Run(context.Background())
+	if err != nil || result.Errors != 3 || result.FirstError == "" {
+		t.Errorf("unexpected result %+v %v", result, err)
+	}
+}
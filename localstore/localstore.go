@@ -0,0 +1,311 @@
+// Package localstore provides durable stores kept in a single file on local disk, so that small
+// self-hosted deployments keep their quotas and metered usage across restarts without running
+// a database server. The file is a journal of changes, synced on every update and replayed when
+// opened, and compacted as it grows. Only one process may open a file at a time.
+//
+// It is a journal rather than SQLite or bbolt so that the toolkit keeps to the standard
+// library, without cgo or new dependencies. That suits the small data it holds, which is kept
+// in memory; use the redis package's stores for more, or for several instances.
+package localstore
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrClosed is returned by a DB which has been closed
+	ErrClosed = errors.New("localstore: database is closed")
+	// ErrCorrupt is returned by Open for a journal damaged before its last change
+	ErrCorrupt = errors.New("localstore: journal is corrupt")
+)
+
+// DB is a key-value store kept in a journal file. It is safe for concurrent use.
+type DB struct {
+	path string
+
+	mu      sync.Mutex
+	f       *os.File
+	data    map[string]record
+	entries int
+}
+
+type record struct {
+	value   []byte
+	expires time.Time
+}
+
+// entry is a journal line: the change to one key
+type entry struct {
+	Key     string `json:"k"`
+	Value   []byte `json:"v,omitempty"`
+	Expires int64  `json:"e,omitempty"`
+	Delete  bool   `json:"d,omitempty"`
+}
+
+// Open opens the store in the file at path, creating it if needed. A last change torn by a
+// crash is discarded, but damage before it fails with ErrCorrupt, rather than losing the
+// changes after it.
+func Open(path string) (*DB, error) {
+	db := &DB{path: path, data: make(map[string]record)}
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		if err = writeSynced(path, nil); err != nil {
+			return nil, err
+		}
+	}
+	f, err := os.OpenFile(path, os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	valid, err := db.replay(f)
+	if err == nil {
+		// drop a torn last change, and write from the end of the valid ones
+		if err = f.Truncate(valid); err == nil {
+			_, err = f.Seek(valid, io.SeekStart)
+		}
+	}
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	db.f = f
+	return db, nil
+}
+
+// replay applies the journal, returning the length of its complete changes
+func (db *DB) replay(r io.Reader) (int64, error) {
+	br := bufio.NewReader(r)
+	var valid int64
+	for {
+		line, err := br.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// a last line without its newline was torn
+			return valid, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		var tx []entry
+		if err = json.Unmarshal(line, &tx); err != nil {
+			if _, peekErr := br.Peek(1); errors.Is(peekErr, io.EOF) {
+				return valid, nil
+			}
+			return 0, fmt.Errorf("%w: at byte %d: %v", ErrCorrupt, valid, err)
+		}
+		db.apply(tx)
+		valid += int64(len(line))
+	}
+}
+
+func (db *DB) apply(tx []entry) {
+	for _, e := range tx {
+		db.entries++
+		if e.Delete {
+			delete(db.data, e.Key)
+			continue
+		}
+		r := record{value: e.Value}
+		if e.Expires != 0 {
+			r.expires = time.UnixMilli(e.Expires)
+		}
+		db.data[e.Key] = r
+	}
+}
+
+// Tx reads and changes the store within Update
+type Tx struct {
+	db      *DB
+	now     time.Time
+	changes []entry
+	pending map[string]entry
+}
+
+// Get returns the value of key, and false if there is none or it has expired
+func (tx *Tx) Get(key string) ([]byte, bool) {
+	if e, ok := tx.pending[key]; ok {
+		return e.Value, !e.Delete
+	}
+	r, ok := tx.db.data[key]
+	if !ok || !r.expires.IsZero() && !tx.now.Before(r.expires) {
+		return nil, false
+	}
+	return r.value, true
+}
+
+// Put sets key to value until expires, or forever if expires is zero
+func (tx *Tx) Put(key string, value []byte, expires time.Time) {
+	e := entry{Key: key, Value: value}
+	if !expires.IsZero() {
+		e.Expires = expires.UnixMilli()
+	}
+	tx.record(e)
+}
+
+// Delete removes key
+func (tx *Tx) Delete(key string) {
+	tx.record(entry{Key: key, Delete: true})
+}
+
+// Keys returns the unexpired keys starting with prefix, in order
+func (tx *Tx) Keys(prefix string) []string {
+	var keys []string
+	for k := range tx.db.data {
+		if _, pending := tx.pending[k]; !pending && strings.HasPrefix(k, prefix) {
+			if _, ok := tx.Get(k); ok {
+				keys = append(keys, k)
+			}
+		}
+	}
+	for k, e := range tx.pending {
+		if !e.Delete && strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (tx *Tx) record(e entry) {
+	if tx.pending == nil {
+		tx.pending = make(map[string]entry)
+	}
+	tx.changes = append(tx.changes, e)
+	tx.pending[e.Key] = e
+}
+
+// View runs fn with a read-only transaction
+func (db *DB) View(fn func(tx *Tx) error) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.f == nil {
+		return ErrClosed
+	}
+	return fn(&Tx{db: db, now: time.Now()})
+}
+
+// Update runs fn in a transaction whose changes are made together, and synced to disk before
+// Update returns, if fn returns nil. Updates run one at a time, so keep fn short.
+func (db *DB) Update(fn func(tx *Tx) error) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.f == nil {
+		return ErrClosed
+	}
+	tx := &Tx{db: db, now: time.Now()}
+	if err := fn(tx); err != nil || len(tx.changes) == 0 {
+		return err
+	}
+
+	line, err := json.Marshal(tx.changes)
+	if err != nil {
+		return err
+	}
+	end, err := db.f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err = db.f.Write(append(line, '\n')); err == nil {
+		err = db.f.Sync()
+	}
+	if err != nil {
+		// remove a partial change, so the next one isn't written after it
+		if db.f.Truncate(end) == nil {
+			_, _ = db.f.Seek(end, io.SeekStart)
+		}
+		return err
+	}
+	db.apply(tx.changes)
+
+	if db.entries > 1000 && db.entries > 2*len(db.data) {
+		return db.compactLocked()
+	}
+	return nil
+}
+
+// Compact rewrites the journal with only the current, unexpired values
+func (db *DB) Compact() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.f == nil {
+		return ErrClosed
+	}
+	return db.compactLocked()
+}
+
+func (db *DB) compactLocked() error {
+	now := time.Now()
+	var buf bytes.Buffer
+	entries := 0
+	for k, r := range db.data {
+		if !r.expires.IsZero() && !now.Before(r.expires) {
+			delete(db.data, k)
+			continue
+		}
+		e := entry{Key: k, Value: r.value}
+		if !r.expires.IsZero() {
+			e.Expires = r.expires.UnixMilli()
+		}
+		line, err := json.Marshal([]entry{e})
+		if err != nil {
+			return err
+		}
+		buf.Write(append(line, '\n'))
+		entries++
+	}
+
+	tmp := db.path + ".tmp"
+	if err := writeSynced(tmp, buf.Bytes()); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, db.path); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	f, err := os.OpenFile(db.path, os.O_RDWR, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Seek(0, io.SeekEnd); err != nil {
+		_ = f.Close()
+		return err
+	}
+	_ = db.f.Close()
+	db.f = f
+	db.entries = entries
+	return nil
+}
+
+func writeSynced(path string, data []byte) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Close closes the file
+func (db *DB) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.f == nil {
+		return nil
+	}
+	err := db.f.Close()
+	db.f = nil
+	return err
+}
@@ -0,0 +1,184 @@
+package localstore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func openTestDB(t *testing.T) (*DB, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "store.db")
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return db, path
+}
+
+func get(t *testing.T, db *DB, key string) (string, bool) {
+	t.Helper()
+	var value []byte
+	var found bool
+	if err := db.View(func(tx *Tx) error {
+		value, found = tx.Get(key)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return string(value), found
+}
+
+func TestDB(t *testing.T) {
+	db, path := openTestDB(t)
+
+	err := db.Update(func(tx *Tx) error {
+		tx.Put("a", []byte("1"), time.Time{})
+		tx.Put("b", []byte("2"), time.Time{})
+		tx.Put("gone", []byte("x"), time.Now().Add(-time.Second))
+		tx.Put("later", []byte("y"), time.Now().Add(time.Hour))
+		if v, ok := tx.Get("a"); !ok || string(v) != "1" {
+			t.Errorf("expected a transaction to see its own changes, got %q", v)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a failed transaction changes nothing
+	failed := errors.New("failed")
+	if err = db.Update(func(tx *Tx) error {
+		tx.Delete("a")
+		return failed
+	}); !errors.Is(err, failed) {
+		t.Errorf("expected the transaction's error, got %v", err)
+	}
+	_ = db.Update(func(tx *Tx) error {
+		tx.Delete("b")
+		return nil
+	})
+
+	var tests = []struct {
+		key   string
+		value string
+		found bool
+	}{
+		{key: "a", value: "1", found: true},
+		{key: "b"},
+		{key: "gone"},
+		{key: "later", value: "y", found: true},
+		{key: "missing"},
+	}
+	check := func(db *DB) {
+		for _, e := range tests {
+			if value, found := get(t, db, e.key); value != e.value || found != e.found {
+				t.Errorf("%s: expected %q and %v, got %q and %v", e.key, e.value, e.found, value, found)
+			}
+		}
+	}
+	check(db)
+
+	// the changes survive reopening, even with a change torn by a crash at the end
+	_ = db.Close()
+	if err = db.Update(func(tx *Tx) error { return nil }); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if err = os.WriteFile(path, append(data, `[{"k":"torn","v":"`...), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	db, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	check(db)
+	if _, found := get(t, db, "torn"); found {
+		t.Error("expected the torn change to be discarded")
+	}
+	_ = db.Update(func(tx *Tx) error {
+		tx.Put("after", []byte("z"), time.Time{})
+		return nil
+	})
+	if value, _ := get(t, db, "after"); value != "z" {
+		t.Errorf("expected writes after a torn change to work, got %q", value)
+	}
+
+	var keys []string
+	_ = db.View(func(tx *Tx) error {
+		keys = tx.Keys("")
+		return nil
+	})
+	if want := []string{"a", "after", "later"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("expected keys %v, got %v", want, keys)
+	}
+}
+
+func TestOpen_Corrupt(t *testing.T) {
+	good := `[{"k":"a","v":"MQ=="}]` + "\n"
+	var tests = []struct {
+		name    string
+		journal string
+		corrupt bool
+	}{
+		{name: "torn last line", journal: good + `[{"k":"b","v":` + "\n"},
+		{name: "damaged last line", journal: good + "\x00\x00\x00\n"},
+		{name: "damaged middle line", journal: good + "\x00\x00\x00\n" + good, corrupt: true},
+	}
+	for _, e := range tests {
+		path := filepath.Join(t.TempDir(), "store.db")
+		if err := os.WriteFile(path, []byte(e.journal), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		db, err := Open(path)
+		if e.corrupt {
+			if !errors.Is(err, ErrCorrupt) {
+				t.Errorf("%s: expected ErrCorrupt, got %v", e.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", e.name, err)
+			continue
+		}
+		if value, _ := get(t, db, "a"); value != "1" {
+			t.Errorf("%s: expected the changes before it, got %q", e.name, value)
+		}
+		_ = db.Close()
+	}
+}
+
+func TestDB_Compact(t *testing.T) {
+	db, path := openTestDB(t)
+
+	for i := 0; i < 1200; i++ {
+		_ = db.Update(func(tx *Tx) error {
+			tx.Put("counter", []byte{byte(i)}, time.Time{})
+			return nil
+		})
+	}
+	// the journal was compacted once it held far more changes than keys
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() > 40*1024 {
+		t.Errorf("expected a compacted journal, got %d bytes", info.Size())
+	}
+
+	_ = db.Compact()
+	_ = db.Close()
+	db, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if value, found := get(t, db, "counter"); !found || value != string([]byte{byte(1199 % 256)}) {
+		t.Errorf("expected the last value after compaction, got %q", value)
+	}
+}
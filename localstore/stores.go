@@ -0,0 +1,143 @@
+package localstore
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/kaliadmen/toolkit"
+)
+
+// NonceStore is a toolkit.NonceStore
+type NonceStore struct {
+	DB *DB
+}
+
+// Use records a nonce as used until expires
+func (s *NonceStore) Use(_ context.Context, nonce string, expires time.Time) error {
+	if !time.Now().Before(expires) {
+		// expired nonces are refused by their signatures, so there's nothing to remember
+		return nil
+	}
+	k := "nonce/" + nonce
+	return s.DB.Update(func(tx *Tx) error {
+		if _, ok := tx.Get(k); ok {
+			return toolkit.ErrNonceUsed
+		}
+		tx.Put(k, nil, expires)
+		return nil
+	})
+}
+
+// QuotaStore is a toolkit.QuotaStore
+type QuotaStore struct {
+	DB *DB
+	// Retention is how long a window's usage is kept after it starts. Defaults to 35 days, to
+	// outlast monthly windows
+	Retention time.Duration
+}
+
+// Increment adds to the usage of key in the window starting at start, and returns the total
+func (s *QuotaStore) Increment(_ context.Context, key string, start time.Time, requests, bytes int64) (toolkit.QuotaUsage, error) {
+	retention := s.Retention
+	if retention <= 0 {
+		retention = 35 * 24 * time.Hour
+	}
+	k := "quota/" + key + "/" + strconv.FormatInt(start.Unix(), 10)
+
+	var usage toolkit.QuotaUsage
+	err := s.DB.Update(func(tx *Tx) error {
+		if data, ok := tx.Get(k); ok {
+			if err := json.Unmarshal(data, &usage); err != nil {
+				return err
+			}
+		}
+		usage.Requests += requests
+		usage.Bytes += bytes
+		data, err := json.Marshal(usage)
+		if err != nil {
+			return err
+		}
+		tx.Put(k, data, start.Add(retention))
+		return nil
+	})
+	return usage, err
+}
+
+// UsageLog is a toolkit.UsageSink which totals metered usage by key and day, for billing
+type UsageLog struct {
+	DB *DB
+	// Location sets where days start. Defaults to UTC
+	Location *time.Location
+	// Retention is how long daily totals are kept. Defaults to 400 days
+	Retention time.Duration
+}
+
+const usageDay = "2006-01-02"
+
+func (s *UsageLog) location() *time.Location {
+	if s.Location != nil {
+		return s.Location
+	}
+	return time.UTC
+}
+
+// WriteUsage adds each usage to its key's total for the day the usage ended in
+func (s *UsageLog) WriteUsage(_ context.Context, usage []toolkit.Usage) error {
+	retention := s.Retention
+	if retention <= 0 {
+		retention = 400 * 24 * time.Hour
+	}
+	return s.DB.Update(func(tx *Tx) error {
+		for _, u := range usage {
+			end := u.To.In(s.location())
+			y, m, d := end.Date()
+			day := time.Date(y, m, d, 0, 0, 0, 0, s.location())
+			k := "usage/" + u.Key + "/" + day.Format(usageDay)
+
+			total := toolkit.Usage{Key: u.Key, From: day, To: day.AddDate(0, 0, 1)}
+			if data, ok := tx.Get(k); ok {
+				if err := json.Unmarshal(data, &total); err != nil {
+					return err
+				}
+			}
+			total.Requests += u.Requests
+			total.ClientErrors += u.ClientErrors
+			total.Errors += u.Errors
+			total.BytesIn += u.BytesIn
+			total.BytesOut += u.BytesOut
+			data, err := json.Marshal(total)
+			if err != nil {
+				return err
+			}
+			tx.Put(k, data, day.Add(retention))
+		}
+		return nil
+	})
+}
+
+// Usage returns key's daily totals for the days from from to to, inclusive, in order
+func (s *UsageLog) Usage(key string, from, to time.Time) ([]toolkit.Usage, error) {
+	first := from.In(s.location()).Format(usageDay)
+	last := to.In(s.location()).Format(usageDay)
+	prefix := "usage/" + key + "/"
+
+	var days []toolkit.Usage
+	err := s.DB.View(func(tx *Tx) error {
+		for _, k := range tx.Keys(prefix) {
+			day := k[len(prefix):]
+			if len(day) != len(usageDay) || day < first || day > last {
+				continue
+			}
+			data, _ := tx.Get(k)
+			var u toolkit.Usage
+			if err := json.Unmarshal(data, &u); err != nil {
+				return err
+			}
+			days = append(days, u)
+		}
+		return nil
+	})
+	return days, err
+}
@@ -0,0 +1,135 @@
+package localstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kaliadmen/toolkit"
+)
+
+var (
+	_ toolkit.NonceStore = (*NonceStore)(nil)
+	_ toolkit.QuotaStore = (*QuotaStore)(nil)
+	_ toolkit.UsageSink  = (*UsageLog)(nil)
+)
+
+func TestNonceStore(t *testing.T) {
+	db, path := openTestDB(t)
+	s := &NonceStore{DB: db}
+	ctx := context.Background()
+	expires := time.Now().Add(time.Hour)
+
+	var tests = []struct {
+		nonce   string
+		expires time.Time
+		want    error
+	}{
+		{nonce: "n1", expires: expires},
+		{nonce: "n1", expires: expires, want: toolkit.ErrNonceUsed},
+		{nonce: "n2", expires: expires},
+		{nonce: "old", expires: time.Now().Add(-time.Second)},
+		{nonce: "old", expires: time.Now().Add(-time.Second)},
+	}
+	for i, e := range tests {
+		if err := s.Use(ctx, e.nonce, e.expires); !errors.Is(err, e.want) {
+			t.Errorf("%d: expected %v, got %v", i, e.want, err)
+		}
+	}
+
+	// used nonces survive a restart
+	_ = db.Close()
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	s.DB = db
+	if err = s.Use(ctx, "n2", expires); !errors.Is(err, toolkit.ErrNonceUsed) {
+		t.Errorf("expected ErrNonceUsed after reopening, got %v", err)
+	}
+}
+
+func TestQuotaStore(t *testing.T) {
+	db, path := openTestDB(t)
+	s := &QuotaStore{DB: db}
+	ctx := context.Background()
+	start := time.Now().Truncate(time.Hour)
+
+	var tests = []struct {
+		start    time.Time
+		requests int64
+		bytes    int64
+		want     toolkit.QuotaUsage
+	}{
+		{start: start, requests: 1, bytes: 100, want: toolkit.QuotaUsage{Requests: 1, Bytes: 100}},
+		{start: start, requests: 1, bytes: 50, want: toolkit.QuotaUsage{Requests: 2, Bytes: 150}},
+		{start: start.Add(time.Hour), requests: 1, bytes: 10, want: toolkit.QuotaUsage{Requests: 1, Bytes: 10}},
+	}
+	for i, e := range tests {
+		got, err := s.Increment(ctx, "key", e.start, e.requests, e.bytes)
+		if err != nil || got != e.want {
+			t.Errorf("%d: expected %+v, got %+v and %v", i, e.want, got, err)
+		}
+	}
+
+	// usage survives a restart
+	_ = db.Close()
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	s.DB = db
+	got, err := s.Increment(ctx, "key", start, 1, 0)
+	if want := (toolkit.QuotaUsage{Requests: 3, Bytes: 150}); err != nil || got != want {
+		t.Errorf("expected %+v after reopening, got %+v and %v", want, got, err)
+	}
+}
+
+func TestUsageLog(t *testing.T) {
+	db, _ := openTestDB(t)
+	s := &UsageLog{DB: db}
+	ctx := context.Background()
+	y, m, d := time.Now().UTC().AddDate(0, 0, -3).Date()
+	day := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+
+	err := s.WriteUsage(ctx, []toolkit.Usage{
+		{Key: "k1", Requests: 10, Errors: 1, BytesOut: 500, From: day.Add(time.Hour), To: day.Add(2 * time.Hour)},
+		{Key: "k2", Requests: 3, From: day.Add(time.Hour), To: day.Add(2 * time.Hour)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = s.WriteUsage(ctx, []toolkit.Usage{
+		{Key: "k1", Requests: 5, BytesIn: 20, From: day.Add(3 * time.Hour), To: day.Add(4 * time.Hour)},
+		{Key: "k1", Requests: 7, From: day.AddDate(0, 0, 1), To: day.AddDate(0, 0, 1).Add(time.Hour)},
+	})
+
+	var tests = []struct {
+		from, to time.Time
+		requests []int64
+	}{
+		{from: day, to: day, requests: []int64{15}},
+		{from: day, to: day.AddDate(0, 0, 1), requests: []int64{15, 7}},
+		{from: day.AddDate(0, 0, 2), to: day.AddDate(0, 0, 5)},
+	}
+	for i, e := range tests {
+		days, err := s.Usage("k1", e.from, e.to)
+		if err != nil || len(days) != len(e.requests) {
+			t.Errorf("%d: expected %d days, got %d and %v", i, len(e.requests), len(days), err)
+			continue
+		}
+		for j, u := range days {
+			if u.Requests != e.requests[j] || u.Key != "k1" {
+				t.Errorf("%d: expected %d requests on day %d, got %+v", i, e.requests[j], j, u)
+			}
+		}
+	}
+
+	days, _ := s.Usage("k1", day, day)
+	if u := days[0]; u.Errors != 1 || u.BytesIn != 20 || u.BytesOut != 500 || !u.From.Equal(day) || !u.To.Equal(day.AddDate(0, 0, 1)) {
+		t.Errorf("unexpected daily total %+v", u)
+	}
+}
@@ -0,0 +1,594 @@
+package toolkit
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrLoginState is returned when the state of a login callback is missing, expired or forged
+var ErrLoginState = errors.New("login state is missing or invalid")
+
+// ErrInvalidIDToken is returned when an OpenID Connect ID token fails verification
+var ErrInvalidIDToken = errors.New("invalid id token")
+
+// loginStateTTL is how long a user has to complete a login at the provider
+const loginStateTTL = 10 * time.Minute
+
+// OAuthProvider configures an OAuth2 or OpenID Connect identity provider. For OIDC providers,
+// setting Issuer is enough; the endpoints are discovered from the provider metadata.
+type OAuthProvider struct {
+	Name        string
+	Issuer      string
+	AuthURL     string
+	TokenURL    string
+	UserInfoURL string
+	JWKSURL     string
+
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+
+	mu   sync.Mutex
+	keys map[string]*rsa.PublicKey
+}
+
+// GoogleProvider returns the provider config for signing in with Google
+func GoogleProvider(clientID, clientSecret, redirectURL string) *OAuthProvider {
+	return &OAuthProvider{
+		Name:         "google",
+		Issuer:       "https://accounts.google.com",
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		Scopes:       []string{"openid", "email", "profile"},
+	}
+}
+
+// GitHubProvider returns the provider config for signing in with GitHub, which is plain OAuth2
+func GitHubProvider(clientID, clientSecret, redirectURL string) *OAuthProvider {
+	return &OAuthProvider{
+		Name:         "github",
+		AuthURL:      "https://github.com/login/oauth/authorize",
+		TokenURL:     "https://github.com/login/oauth/access_token",
+		UserInfoURL:  "https://api.github.com/user",
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		Scopes:       []string{"read:user", "user:email"},
+	}
+}
+
+// Discover fills in the provider's endpoints from its OpenID Connect metadata. Endpoints
+// which are already set are kept.
+func (p *OAuthProvider) Discover(ctx context.Context, client *http.Client) error {
+	if p.Issuer == "" {
+		return errors.New("provider has no issuer to discover")
+	}
+
+	var meta struct {
+		Issuer      string `json:"issuer"`
+		AuthURL     string `json:"authorization_endpoint"`
+		TokenURL    string `json:"token_endpoint"`
+		UserInfoURL string `json:"userinfo_endpoint"`
+		JWKSURL     string `json:"jwks_uri"`
+	}
+	if err := getJSON(ctx, client, strings.TrimSuffix(p.Issuer, "/")+"/.well-known/openid-configuration", "", &meta); err != nil {
+		return err
+	}
+	if meta.Issuer != p.Issuer {
+		return fmt.Errorf("provider metadata is for issuer %q, not %q", meta.Issuer, p.Issuer)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, e := range []struct {
+		field *string
+		value string
+	}{
+		{&p.AuthURL, meta.AuthURL},
+		{&p.TokenURL, meta.TokenURL},
+		{&p.UserInfoURL, meta.UserInfoURL},
+		{&p.JWKSURL, meta.JWKSURL},
+	} {
+		if *e.field == "" {
+			*e.field = e.value
+		}
+	}
+	return nil
+}
+
+// Identity is the user returned by a provider after a successful login
+type Identity struct {
+	Provider     string         `json:"provider"`
+	Subject      string         `json:"subject"`
+	Email        string         `json:"email,omitempty"`
+	Name         string         `json:"name,omitempty"`
+	Claims       map[string]any `json:"claims,omitempty"`
+	AccessToken  string         `json:"-"`
+	RefreshToken string         `json:"-"`
+	Expiry       time.Time      `json:"-"`
+	// ReturnTo is the local path the user was on when they started logging in
+	ReturnTo string `json:"return_to,omitempty"`
+}
+
+// Login runs the authorization code flow with PKCE against one or more providers. Mount
+// Handler under a prefix; it serves /<provider>/login and /<provider>/callback, and each
+// provider's RedirectURL must point at its callback.
+type Login struct {
+	Providers map[string]*OAuthProvider
+	// Key signs the short-lived cookie which holds the state, nonce and PKCE verifier
+	Key []byte
+	// StartSession is called once a user has logged in. It should create the application's
+	// session and write a response, usually a redirect to the identity's ReturnTo.
+	StartSession func(w http.ResponseWriter, r *http.Request, id *Identity) error
+	// Client is used to call the providers. Defaults to http.DefaultClient
+	Client *http.Client
+	// Insecure allows the state cookie to be sent over plain http, for local development
+	Insecure bool
+	ErrorLog func(err error)
+}
+
+type loginState struct {
+	Provider string `json:"p"`
+	State    string `json:"s"`
+	Nonce    string `json:"n"`
+	Verifier string `json:"v"`
+	ReturnTo string `json:"r,omitempty"`
+	Expires  int64  `json:"e"`
+}
+
+// Handler serves the login and callback endpoints for every provider
+func (l *Login) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var t Tools
+
+		dir, action := path.Split(path.Clean(r.URL.Path))
+		provider, ok := l.Providers[path.Base(dir)]
+		if !ok || r.Method != http.MethodGet {
+			_ = t.ErrorJSON(w, errors.New("not found"), http.StatusNotFound)
+			return
+		}
+
+		switch action {
+		case "login":
+			l.redirectToProvider(w, r, path.Base(dir), provider)
+		case "callback":
+			l.callback(w, r, path.Base(dir), provider)
+		default:
+			_ = t.ErrorJSON(w, errors.New("not found"), http.StatusNotFound)
+		}
+	})
+}
+
+// localPath reports whether p is a path on this site. Browsers ignore tabs and newlines in
+// URLs and treat backslashes as slashes, so "/\t/evil.example" would be another site.
+func localPath(p string) bool {
+	if !strings.HasPrefix(p, "/") || (len(p) > 1 && (p[1] == '/' || p[1] == '\\')) {
+		return false
+	}
+	for i := 0; i < len(p); i++ {
+		if p[i] < ' ' || p[i] == 0x7f || p[i] == '\\' {
+			return false
+		}
+	}
+	return true
+}
+
+func (l *Login) redirectToProvider(w http.ResponseWriter, r *http.Request, name string, p *OAuthProvider) {
+	var t Tools
+
+	if err := l.ensureEndpoints(r.Context(), p); err != nil {
+		l.fail(w, err, http.StatusBadGateway)
+		return
+	}
+
+	st := loginState{Provider: name, Expires: time.Now().Add(loginStateTTL).Unix()}
+	for _, v := range []*string{&st.State, &st.Nonce, &st.Verifier} {
+		s, err := randomHex(32)
+		if err != nil {
+			_ = t.ErrorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+		*v = s
+	}
+
+	// only allow local paths, so the login can't be used as an open redirect
+	if next := r.URL.Query().Get("next"); localPath(next) {
+		st.ReturnTo = next
+	}
+
+	cookie, err := l.sealState(st)
+	if err != nil {
+		_ = t.ErrorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     l.cookieName(name),
+		Value:    cookie,
+		Path:     "/",
+		MaxAge:   int(loginStateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   !l.Insecure,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	challenge := sha256.Sum256([]byte(st.Verifier))
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", p.ClientID)
+	q.Set("redirect_uri", p.RedirectURL)
+	q.Set("scope", strings.Join(p.Scopes, " "))
+	q.Set("state", st.State)
+	q.Set("nonce", st.Nonce)
+	q.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	q.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(p.AuthURL, "?") {
+		sep = "&"
+	}
+	http.Redirect(w, r, p.AuthURL+sep+q.Encode(), http.StatusFound)
+}
+
+func (l *Login) callback(w http.ResponseWriter, r *http.Request, name string, p *OAuthProvider) {
+	ctx := r.Context()
+	q := r.URL.Query()
+
+	// the state cookie is single use
+	http.SetCookie(w, &http.Cookie{Name: l.cookieName(name), Path: "/", MaxAge: -1, HttpOnly: true, Secure: !l.Insecure})
+
+	if e := q.Get("error"); e != "" {
+		l.fail(w, fmt.Errorf("login refused by provider: %s", e), http.StatusUnauthorized)
+		return
+	}
+
+	cookie, err := r.Cookie(l.cookieName(name))
+	if err != nil {
+		l.fail(w, ErrLoginState, http.StatusBadRequest)
+		return
+	}
+	st, err := l.openState(cookie.Value)
+	if err != nil || st.Provider != name || !hmac.Equal([]byte(st.State), []byte(q.Get("state"))) {
+		l.fail(w, ErrLoginState, http.StatusBadRequest)
+		return
+	}
+
+	if err = l.ensureEndpoints(ctx, p); err != nil {
+		l.fail(w, err, http.StatusBadGateway)
+		return
+	}
+
+	id, err := l.exchange(ctx, p, q.Get("code"), st)
+	if err != nil {
+		l.fail(w, err, http.StatusUnauthorized)
+		return
+	}
+	id.Provider = name
+	id.ReturnTo = st.ReturnTo
+
+	if l.StartSession == nil {
+		l.fail(w, errors.New("login has no session handler"), http.StatusInternalServerError)
+		return
+	}
+	if err = l.StartSession(w, r, id); err != nil {
+		l.fail(w, err, http.StatusInternalServerError)
+	}
+}
+
+type loginTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	IDToken      string `json:"id_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+	Error        string `json:"error"`
+}
+
+// exchange swaps the authorization code for tokens, and builds the user's identity from the
+// verified ID token, or the user info endpoint for plain OAuth2 providers
+func (l *Login) exchange(ctx context.Context, p *OAuthProvider, code string, st *loginState) (*Identity, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.RedirectURL)
+	form.Set("client_id", p.ClientID)
+	form.Set("client_secret", p.ClientSecret)
+	form.Set("code_verifier", st.Verifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	res, err := l.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var tr loginTokenResponse
+	if err = json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(&tr); err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK || tr.AccessToken == "" {
+		return nil, fmt.Errorf("code exchange failed with status %d %s", res.StatusCode, tr.Error)
+	}
+
+	id := &Identity{AccessToken: tr.AccessToken, RefreshToken: tr.RefreshToken}
+	if tr.ExpiresIn > 0 {
+		id.Expiry = time.Now().Add(time.Duration(tr.ExpiresIn) * time.Second)
+	}
+
+	if tr.IDToken != "" {
+		if id.Claims, err = p.verifyIDToken(ctx, l.client(), tr.IDToken, st.Nonce); err != nil {
+			return nil, err
+		}
+	} else {
+		if p.UserInfoURL == "" {
+			return nil, errors.New("provider returned no id token and has no user info endpoint")
+		}
+		if err = getJSON(ctx, l.client(), p.UserInfoURL, tr.AccessToken, &id.Claims); err != nil {
+			return nil, err
+		}
+	}
+
+	id.Subject = claimString(id.Claims, "sub")
+	if id.Subject == "" {
+		// GitHub identifies users by a numeric id
+		id.Subject = claimString(id.Claims, "id")
+	}
+	id.Email = claimString(id.Claims, "email")
+	id.Name = claimString(id.Claims, "name")
+	if id.Subject == "" {
+		return nil, errors.New("provider did not identify the user")
+	}
+	return id, nil
+}
+
+func (l *Login) ensureEndpoints(ctx context.Context, p *OAuthProvider) error {
+	p.mu.Lock()
+	discovered := p.AuthURL != "" && p.TokenURL != ""
+	p.mu.Unlock()
+
+	if discovered {
+		return nil
+	}
+	return p.Discover(ctx, l.client())
+}
+
+func (l *Login) client() *http.Client {
+	if l.Client != nil {
+		return l.Client
+	}
+	return http.DefaultClient
+}
+
+func (l *Login) cookieName(provider string) string {
+	return "login_" + provider
+}
+
+func (l *Login) fail(w http.ResponseWriter, err error, status int) {
+	if l.ErrorLog != nil {
+		l.ErrorLog(err)
+	}
+
+	var t Tools
+	_ = t.ErrorJSON(w, err, status)
+}
+
+// sealState encodes the login state as base64 JSON followed by its HMAC
+func (l *Login) sealState(st loginState) (string, error) {
+	if len(l.Key) == 0 {
+		return "", errors.New("login has no signing key")
+	}
+
+	js, err := json.Marshal(st)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(js)
+	return payload + "." + l.stateMAC(payload), nil
+}
+
+func (l *Login) openState(value string) (*loginState, error) {
+	payload, mac, ok := strings.Cut(value, ".")
+	if !ok || len(l.Key) == 0 || !hmac.Equal([]byte(mac), []byte(l.stateMAC(payload))) {
+		return nil, ErrLoginState
+	}
+
+	js, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, ErrLoginState
+	}
+
+	var st loginState
+	if err = json.Unmarshal(js, &st); err != nil || time.Now().Unix() > st.Expires {
+		return nil, ErrLoginState
+	}
+	return &st, nil
+}
+
+func (l *Login) stateMAC(payload string) string {
+	mac := hmac.New(sha256.New, l.Key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifyIDToken checks the signature and claims of an RS256 ID token, and returns its claims
+func (p *OAuthProvider) verifyIDToken(ctx context.Context, client *http.Client, raw, nonce string) (map[string]any, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidIDToken
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, ErrInvalidIDToken
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidIDToken, header.Alg)
+	}
+
+	key, err := p.publicKey(ctx, client, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidIDToken
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig); err != nil {
+		return nil, fmt.Errorf("%w: bad signature", ErrInvalidIDToken)
+	}
+
+	var claims map[string]any
+	if err = decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, ErrInvalidIDToken
+	}
+
+	if p.Issuer != "" && claimString(claims, "iss") != p.Issuer {
+		return nil, fmt.Errorf("%w: wrong issuer", ErrInvalidIDToken)
+	}
+	if !audienceContains(claims["aud"], p.ClientID) {
+		return nil, fmt.Errorf("%w: wrong audience", ErrInvalidIDToken)
+	}
+	if exp, ok := claims["exp"].(float64); !ok || time.Now().After(time.Unix(int64(exp), 0)) {
+		return nil, fmt.Errorf("%w: expired", ErrInvalidIDToken)
+	}
+	if claimString(claims, "nonce") != nonce {
+		return nil, fmt.Errorf("%w: wrong nonce", ErrInvalidIDToken)
+	}
+	return claims, nil
+}
+
+// publicKey returns the provider's signing key with the given id, refetching the key set once
+// if it is unknown, as providers rotate their keys
+func (p *OAuthProvider) publicKey(ctx context.Context, client *http.Client, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	key, ok := p.keys[kid]
+	jwksURL := p.JWKSURL
+	p.mu.Unlock()
+
+	if ok {
+		return key, nil
+	}
+	if jwksURL == "" {
+		return nil, errors.New("provider has no key set")
+	}
+
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := getJSON(ctx, client, jwksURL, "", &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, err1 := base64.RawURLEncoding.DecodeString(k.N)
+		e, err2 := base64.RawURLEncoding.DecodeString(k.E)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+
+	p.mu.Lock()
+	p.keys = keys
+	p.mu.Unlock()
+
+	if key, ok = keys[kid]; !ok {
+		return nil, fmt.Errorf("%w: unknown key %q", ErrInvalidIDToken, kid)
+	}
+	return key, nil
+}
+
+func decodeJWTPart(part string, v any) error {
+	js, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(js, v)
+}
+
+func audienceContains(aud any, clientID string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == clientID
+	case []any:
+		for _, a := range v {
+			if a == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// claimString returns a claim as a string, formatting numbers such as GitHub's user id
+func claimString(claims map[string]any, name string) string {
+	switch v := claims[name].(type) {
+	case string:
+		return v
+	case float64:
+		return fmt.Sprintf("%.0f", v)
+	}
+	return ""
+}
+
+// getJSON fetches a JSON document, with a bearer token if one is given
+func getJSON(ctx context.Context, client *http.Client, url, token string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned status %d", url, res.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(v)
+}
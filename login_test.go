@@ -0,0 +1,175 @@
+package toolkit
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeOIDC is a minimal OpenID Connect provider for testing logins
+type fakeOIDC struct {
+	*httptest.Server
+	key       *rsa.PrivateKey
+	nonce     string
+	challenge string
+}
+
+func newFakeOIDC(t *testing.T) *fakeOIDC {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &fakeOIDC{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 f.URL,
+			"authorization_endpoint": f.URL + "/authorize",
+			"token_endpoint":         f.URL + "/token",
+			"jwks_uri":               f.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "k1",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		verifier := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		if r.FormValue("code") != "the-code" || base64.RawURLEncoding.EncodeToString(verifier[:]) != f.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "access",
+			"expires_in":   3600,
+			"id_token": f.sign(t, map[string]any{
+				"iss":   f.URL,
+				"aud":   "client",
+				"sub":   "user-1",
+				"email": "user@example.com",
+				"exp":   time.Now().Add(time.Hour).Unix(),
+				"nonce": f.nonce,
+			}),
+		})
+	})
+	f.Server = httptest.NewServer(mux)
+	return f
+}
+
+func (f *fakeOIDC) sign(t *testing.T, claims map[string]any) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "k1"})
+	body, _ := json.Marshal(claims)
+	signing := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(body)
+	digest := sha256.Sum256([]byte(signing))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, f.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signing + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestLogin_Handler(t *testing.T) {
+	provider := newFakeOIDC(t)
+	defer provider.Close()
+
+	var got *Identity
+	login := &Login{
+		Providers: map[string]*OAuthProvider{
+			"test": {Issuer: provider.URL, ClientID: "client", ClientSecret: "secret", RedirectURL: "http://app/auth/test/callback", Scopes: []string{"openid"}},
+		},
+		Key: []byte("secret key"),
+		StartSession: func(w http.ResponseWriter, r *http.Request, id *Identity) error {
+			got = id
+			http.Redirect(w, r, id.ReturnTo, http.StatusFound)
+			return nil
+		},
+	}
+	handler := http.StripPrefix("/auth", login.Handler())
+
+	// start the login, which redirects to the provider
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/auth/test/login?next=/dashboard", nil))
+	if rr.Code != http.StatusFound {
+		t.Fatalf("expected redirect, got %d %s", rr.Code, rr.Body.String())
+	}
+	loc, _ := url.Parse(rr.Header().Get("Location"))
+	if !strings.HasPrefix(loc.String(), provider.URL+"/authorize") {
+		t.Fatalf("unexpected redirect to %s", loc)
+	}
+	q := loc.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("client_id") != "client" {
+		t.Errorf("unexpected authorization request %s", loc.RawQuery)
+	}
+	provider.nonce, provider.challenge = q.Get("nonce"), q.Get("code_challenge")
+	cookies := rr.Result().Cookies()
+
+	var tests = []struct {
+		name     string
+		query    string
+		cookie   bool
+		expected int
+	}{
+		{"wrong state", "state=forged&code=the-code", true, http.StatusBadRequest},
+		{"no cookie", "state=" + q.Get("state") + "&code=the-code", false, http.StatusBadRequest},
+		{"bad code", "state=" + q.Get("state") + "&code=wrong", true, http.StatusUnauthorized},
+		{"provider error", "error=access_denied", true, http.StatusUnauthorized},
+		{"valid", "state=" + q.Get("state") + "&code=the-code", true, http.StatusFound},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("GET", "/auth/test/callback?"+e.query, nil)
+		if e.cookie {
+			for _, c := range cookies {
+				req.AddCookie(c)
+			}
+		}
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != e.expected {
+			t.Errorf("%s: expected %d, got %d %s", e.name, e.expected, rr.Code, rr.Body.String())
+		}
+	}
+
+	if got == nil || got.Subject != "user-1" || got.Email != "user@example.com" || got.Provider != "test" {
+		t.Fatalf("unexpected identity %+v", got)
+	}
+	if got.ReturnTo != "/dashboard" || rr.Header().Get("Location") != "/dashboard" {
+		t.Errorf("expected return to /dashboard, got %q", got.ReturnTo)
+	}
+}
+
+func TestLogin_OpenRedirect(t *testing.T) {
+	login := &Login{
+		Providers: map[string]*OAuthProvider{"gh": GitHubProvider("client", "secret", "http://app/callback")},
+		Key:       []byte("key"),
+	}
+
+	for _, next := range []string{"https://evil.example", "//evil.example", "/\\evil.example", "/\t/evil.example", "/\n/evil.example", "/a\\..\\\\evil.example"} {
+		rr := httptest.NewRecorder()
+		login.Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/gh/login?next="+url.QueryEscape(next), nil))
+
+		st, err := login.openState(rr.Result().Cookies()[0].Value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st.ReturnTo != "" {
+			t.Errorf("%s should not be allowed as a return path", next)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package toolkit
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+)
+
+// LogLevel is the severity of a log message
+type LogLevel int32
+
+// Log levels, from most to least verbose
+const (
+	LevelDebug LogLevel = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var logLevelNames = []string{"debug", "info", "warn", "error"}
+
+// String returns the lower case name of the level
+func (l LogLevel) String() string {
+	if l < LevelDebug || int(l) >= len(logLevelNames) {
+		return fmt.Sprintf("level(%d)", int32(l))
+	}
+	return logLevelNames[l]
+}
+
+// ParseLogLevel converts a level name, such as "warn", into a LogLevel
+func ParseLogLevel(s string) (LogLevel, error) {
+	for i, name := range logLevelNames {
+		if strings.EqualFold(name, s) {
+			return LogLevel(i), nil
+		}
+	}
+	if strings.EqualFold(s, "warning") {
+		return LevelWarn, nil
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q", s)
+}
+
+// LevelVar is a LogLevel which can be changed safely at runtime. The zero value is LevelDebug.
+type LevelVar struct {
+	level int32
+}
+
+// Level returns the current level
+func (v *LevelVar) Level() LogLevel {
+	return LogLevel(atomic.LoadInt32(&v.level))
+}
+
+// Set changes the current level
+func (v *LevelVar) Set(l LogLevel) {
+	atomic.StoreInt32(&v.level, int32(l))
+}
+
+// Enabled reports whether messages at level l should be logged
+func (v *LevelVar) Enabled(l LogLevel) bool {
+	return l >= v.Level()
+}
+
+// Logger writes messages at or above its level, for a component of an application. Give each
+// component its own Logger and LevelVar, and list the LevelVars in Admin.LogLevels, to turn up
+// one component's logging at runtime without drowning in the others'.
+type Logger struct {
+	// Output receives the messages. Defaults to the standard logger
+	Output *log.Logger
+	// Level is the least severe level logged. If nil, every message is logged
+	Level *LevelVar
+	// Component, if set, is written before each message, as "[storage]"
+	Component string
+}
+
+// Enabled reports whether messages at level l are logged
+func (l *Logger) Enabled(level LogLevel) bool {
+	return l.Level == nil || l.Level.Enabled(level)
+}
+
+// Logf logs a message at level, formatted as by fmt.Sprintf
+func (l *Logger) Logf(level LogLevel, format string, args ...any) {
+	if !l.Enabled(level) {
+		return
+	}
+	prefix := level.String() + ": "
+	if l.Component != "" {
+		prefix = "[" + l.Component + "] " + prefix
+	}
+	out := l.Output
+	if out == nil {
+		out = log.Default()
+	}
+	_ = out.Output(3, prefix+fmt.Sprintf(format, args...))
+}
+
+// Debugf logs a message at LevelDebug
+func (l *Logger) Debugf(format string, args ...any) { l.Logf(LevelDebug, format, args...) }
+
+// Infof logs a message at LevelInfo
+func (l *Logger) Infof(format string, args ...any) { l.Logf(LevelInfo, format, args...) }
+
+// Warnf logs a message at LevelWarn
+func (l *Logger) Warnf(format string, args ...any) { l.Logf(LevelWarn, format, args...) }
+
+// Errorf logs a message at LevelError
+func (l *Logger) Errorf(format string, args ...any) { l.Logf(LevelError, format, args...) }
@@ -0,0 +1,99 @@
+package toolkit
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// LogSampler keeps a flood of log messages from swamping the log pipeline, such as a client
+// making the same failing request in a loop. In each Period it lets through the first First
+// copies of a message, then one in Thereafter, and no more than PerKey messages from any one
+// key, such as a client's address. The zero value is ready to use, and safe for concurrent use.
+type LogSampler struct {
+	// Period is how long counts last. Defaults to one minute
+	Period time.Duration
+	// First is the number of copies of a message logged each period before sampling.
+	// Defaults to 10
+	First int
+	// Thereafter logs one in this many copies of a message after the first. Defaults to 100
+	Thereafter int
+	// PerKey is the most messages logged for a key each period. Defaults to 20
+	PerKey int
+	// Now defaults to time.Now
+	Now func() time.Time
+
+	mu         sync.Mutex
+	period     int64
+	messages   map[string]int
+	keys       map[string]int
+	suppressed int64
+}
+
+// Allow reports whether a message logged for key should be written. An empty key is only
+// sampled by message.
+func (s *LogSampler) Allow(key, msg string) bool {
+	now := time.Now()
+	if s.Now != nil {
+		now = s.Now()
+	}
+	period := s.Period
+	if period <= 0 {
+		period = time.Minute
+	}
+	first, thereafter, perKey := s.First, s.Thereafter, s.PerKey
+	if first <= 0 {
+		first = 10
+	}
+	if thereafter <= 0 {
+		thereafter = 100
+	}
+	if perKey <= 0 {
+		perKey = 20
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p := now.UnixNano() / int64(period); p != s.period || s.messages == nil {
+		s.period = p
+		s.messages = make(map[string]int)
+		s.keys = make(map[string]int)
+	}
+
+	if key != "" && s.keys[key] >= perKey {
+		s.suppressed++
+		return false
+	}
+	s.messages[msg]++
+	if n := s.messages[msg]; n > first && (n-first)%thereafter != 0 {
+		s.suppressed++
+		return false
+	}
+	if key != "" {
+		s.keys[key]++
+	}
+	return true
+}
+
+// TakeSuppressed returns the number of messages suppressed since it was last called
+func (s *LogSampler) TakeSuppressed() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := s.suppressed
+	s.suppressed = 0
+	return n
+}
+
+// LogRequestError logs an error met serving r, as LogError does, sampled by the client's
+// address as well as by message when LogSampler is set. Call it on error paths which clients
+// can trigger at will, such as before ErrorJSON.
+func (t *Tools) LogRequestError(r *http.Request, err error) {
+	if err == nil {
+		return
+	}
+	key := r.RemoteAddr
+	if ip := requestClientIP(r, nil); ip != nil {
+		key = ip.String()
+	}
+	t.logError(key, err)
+}
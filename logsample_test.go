@@ -0,0 +1,85 @@
+package toolkit
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogSampler(t *testing.T) {
+	now := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	s := &LogSampler{First: 3, Thereafter: 5, PerKey: 100, Now: func() time.Time { return now }}
+
+	logged := 0
+	for i := 0; i < 23; i++ {
+		if s.Allow("", "same message") {
+			logged++
+		}
+	}
+	// the first 3, then the 8th, 13th, 18th and 23rd
+	if logged != 7 {
+		t.Errorf("expected 7 messages logged, got %d", logged)
+	}
+	if n := s.TakeSuppressed(); n != 16 {
+		t.Errorf("expected 16 suppressed, got %d", n)
+	}
+	if n := s.TakeSuppressed(); n != 0 {
+		t.Errorf("expected the count to be reset, got %d", n)
+	}
+	if !s.Allow("", "another message") {
+		t.Error("expected a different message to be logged")
+	}
+
+	now = now.Add(time.Minute)
+	if !s.Allow("", "same message") {
+		t.Error("expected counts to reset each period")
+	}
+}
+
+func TestLogSampler_PerKey(t *testing.T) {
+	s := &LogSampler{PerKey: 2}
+	var tests = []struct {
+		key, msg string
+		want     bool
+	}{
+		{"203.0.113.9", "bad request 1", true},
+		{"203.0.113.9", "bad request 2", true},
+		{"203.0.113.9", "bad request 3", false},
+		{"198.51.100.4", "bad request 3", true},
+		{"", "bad request 4", true},
+	}
+	for _, e := range tests {
+		if got := s.Allow(e.key, e.msg); got != e.want {
+			t.Errorf("%s %q: expected %v, got %v", e.key, e.msg, e.want, got)
+		}
+	}
+}
+
+func TestTools_LogRequestError(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	tools := Tools{RecentErrors: &ErrorRing{}, LogSampler: &LogSampler{PerKey: 2}}
+	r := httptest.NewRequest("GET", "/", nil)
+	for i := 0; i < 5; i++ {
+		tools.LogRequestError(r, errors.New("invalid token"))
+	}
+	tools.LogError(errors.New("disk full"))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 lines logged, got %q", lines)
+	}
+	if !strings.HasSuffix(lines[2], "error: disk full (3 log messages suppressed)") {
+		t.Errorf("expected the suppressed count with the next message, got %q", lines[2])
+	}
+	if n := len(tools.RecentErrors.Errors()); n != 6 {
+		t.Errorf("expected every error to be recorded, got %d", n)
+	}
+}
@@ -0,0 +1,63 @@
+package toolkit
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Notifier wakes up every goroutine waiting on it. The zero value is ready to use.
+type Notifier struct {
+	mu sync.Mutex
+	ch chan struct{}
+}
+
+// Wait returns a channel which is closed on the next call to Notify
+func (n *Notifier) Wait() <-chan struct{} {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.ch == nil {
+		n.ch = make(chan struct{})
+	}
+	return n.ch
+}
+
+// Notify wakes up everyone currently waiting
+func (n *Notifier) Notify() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.ch != nil {
+		close(n.ch)
+		n.ch = nil
+	}
+}
+
+// LongPoll parks a request until there is something new for the client, for clients which
+// cannot use server-sent events or websockets. Check is called immediately, and again each
+// time n is notified; once it reports a change, its data is written as JSON with a 200.
+// If nothing changes within timeout, a 304 Not Modified is written so the client polls again.
+// If the client disconnects first, nothing is written and the context's error is returned.
+func (t *Tools) LongPoll(w http.ResponseWriter, r *http.Request, n *Notifier, timeout time.Duration, check func() (data any, changed bool)) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		// take the wait channel before checking, so a change between the two isn't missed
+		wake := n.Wait()
+
+		if data, changed := check(); changed {
+			return t.WriteJSON(w, http.StatusOK, data)
+		}
+
+		select {
+		case <-wake:
+		case <-timer.C:
+			w.WriteHeader(http.StatusNotModified)
+			return nil
+		case <-r.Context().Done():
+			return r.Context().Err()
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package toolkit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTools_LongPoll(t *testing.T) {
+	var testTools Tools
+	var n Notifier
+	var version int64
+
+	check := func(since int64) func() (any, bool) {
+		return func() (any, bool) {
+			v := atomic.LoadInt64(&version)
+			return map[string]int64{"version": v}, v > since
+		}
+	}
+
+	// already changed: returns straight away
+	rr := httptest.NewRecorder()
+	atomic.StoreInt64(&version, 1)
+	if err := testTools.LongPoll(rr, httptest.NewRequest("GET", "/", nil), &n, time.Second, check(0)); err != nil {
+		t.Error(err)
+	}
+	if rr.Code != http.StatusOK {
+		t.Error("expected 200 for an immediate change, got", rr.Code)
+	}
+
+	// a change while waiting wakes the request
+	rr = httptest.NewRecorder()
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		n.Notify() // spurious wake up, nothing changed yet
+		atomic.StoreInt64(&version, 2)
+		n.Notify()
+	}()
+	start := time.Now()
+	if err := testTools.LongPoll(rr, httptest.NewRequest("GET", "/", nil), &n, 5*time.Second, check(1)); err != nil {
+		t.Error(err)
+	}
+	if rr.Code != http.StatusOK || time.Since(start) > 4*time.Second {
+		t.Error("expected to be woken with a 200, got", rr.Code)
+	}
+	if rr.Body.String() != `{"version":2}` {
+		t.Error("wrong body", rr.Body.String())
+	}
+
+	// no change before the timeout
+	rr = httptest.NewRecorder()
+	if err := testTools.LongPoll(rr, httptest.NewRequest("GET", "/", nil), &n, 10*time.Millisecond, check(2)); err != nil {
+		t.Error(err)
+	}
+	if rr.Code != http.StatusNotModified {
+		t.Error("expected 304 on timeout, got", rr.Code)
+	}
+
+	// the client goes away
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rr = httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+	if err := testTools.LongPoll(rr, req, &n, time.Second, check(2)); err != context.Canceled {
+		t.Error("expected context.Canceled, got", err)
+	}
+}
@@ -0,0 +1,362 @@
+package toolkit
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// ErrUnmappable is wrapped by the errors Mapper returns for fields whose types can't be mapped
+var ErrUnmappable = errors.New("field cannot be mapped")
+
+// Mapper copies the fields of one struct onto another of a different type, such as a decoded
+// request DTO onto a domain model and back. Fields are matched by name, ignoring case, or by
+// their map tag: map:"name" renames a field and map:"-" skips it. Fields of embedded structs
+// are matched as if they were the outer struct's, except through embedded pointers to
+// unexported types, which reflect can't follow. Fields without a match are left alone.
+//
+// A field's value is mapped onto its match when it is assignable, a number or string
+// convertible without overflow, a pointer to or from one, a struct mapped in turn, or a slice
+// or map of these. Other pairs of types need a converter registered with RegisterConverter;
+// without one, Map fails with ErrUnmappable rather than silently skipping the field. The plan
+// for each pair of types is worked out once and cached, so mapping is cheap after the first
+// call. The zero value is ready to use, and safe for concurrent use.
+type Mapper struct {
+	// Tag is the struct tag naming fields. Defaults to "map"
+	Tag string
+
+	mu         sync.RWMutex
+	converters map[[2]reflect.Type]func(src reflect.Value) (reflect.Value, error)
+	plans      sync.Map // [2]reflect.Type{dst, src} -> *mapPlan
+}
+
+var defaultMapper Mapper
+
+// MapStruct maps src onto dst with a shared Mapper using the map tag
+func MapStruct(dst, src any) error {
+	return defaultMapper.Map(dst, src)
+}
+
+// RegisterConverter registers fn to convert S values to D, for fields Mapper can't map
+// itself, such as a string to a time.Time. It replaces a converter registered before for the
+// same types.
+func RegisterConverter[S, D any](m *Mapper, fn func(S) (D, error)) {
+	srcType := reflect.TypeOf((*S)(nil)).Elem()
+	dstType := reflect.TypeOf((*D)(nil)).Elem()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.converters == nil {
+		m.converters = make(map[[2]reflect.Type]func(reflect.Value) (reflect.Value, error))
+	}
+	m.converters[[2]reflect.Type{srcType, dstType}] = func(src reflect.Value) (reflect.Value, error) {
+		d, err := fn(src.Interface().(S))
+		return reflect.ValueOf(&d).Elem(), err
+	}
+	// plans may have been made without the converter
+	m.plans.Range(func(key, _ any) bool {
+		m.plans.Delete(key)
+		return true
+	})
+}
+
+// Map copies the fields of src, a struct or pointer to one, onto the struct dst points to
+func (m *Mapper) Map(dst, src any) error {
+	dv := reflect.ValueOf(dst)
+	if dv.Kind() != reflect.Ptr || dv.IsNil() || dv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("mapper destination must be a pointer to a struct, not %T", dst)
+	}
+	sv := reflect.ValueOf(src)
+	for sv.Kind() == reflect.Ptr && !sv.IsNil() {
+		sv = sv.Elem()
+	}
+	if sv.Kind() != reflect.Struct {
+		return fmt.Errorf("mapper source must be a struct, not %T", src)
+	}
+
+	plan, err := m.plan(dv.Elem().Type(), sv.Type())
+	if err != nil {
+		return err
+	}
+	return plan.run(dv.Elem(), sv)
+}
+
+// mapConvert sets dst, which is settable, from src
+type mapConvert func(dst, src reflect.Value) error
+
+type mapStep struct {
+	name     string
+	src, dst []int
+	convert  mapConvert
+}
+
+type mapPlan struct {
+	steps []mapStep
+}
+
+func (p *mapPlan) run(dst, src reflect.Value) error {
+	for _, step := range p.steps {
+		sf, ok := fieldByIndex(src, step.src, false)
+		if !ok {
+			// a nil embedded pointer has no fields to map
+			continue
+		}
+		df, _ := fieldByIndex(dst, step.dst, true)
+		if err := step.convert(df, sf); err != nil {
+			return fmt.Errorf("field %s: %w", step.name, err)
+		}
+	}
+	return nil
+}
+
+// fieldByIndex is reflect.Value.FieldByIndex, allocating nil embedded pointers if alloc is set
+// and reporting false for them otherwise
+func fieldByIndex(v reflect.Value, index []int, alloc bool) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !alloc {
+					return reflect.Value{}, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+func (m *Mapper) plan(dst, src reflect.Type) (*mapPlan, error) {
+	key := [2]reflect.Type{dst, src}
+	if plan, ok := m.plans.Load(key); ok {
+		return plan.(*mapPlan), nil
+	}
+
+	srcFields := make(map[string]reflect.StructField)
+	for _, f := range m.fields(src) {
+		srcFields[strings.ToLower(m.fieldName(f))] = f
+	}
+
+	plan := &mapPlan{}
+	for _, df := range m.fields(dst) {
+		name := m.fieldName(df)
+		sf, ok := srcFields[strings.ToLower(name)]
+		if !ok {
+			continue
+		}
+		convert, err := m.converter(df.Type, sf.Type)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", name, err)
+		}
+		plan.steps = append(plan.steps, mapStep{name: name, src: sf.Index, dst: df.Index, convert: convert})
+	}
+
+	m.plans.Store(key, plan)
+	return plan, nil
+}
+
+// fields returns the exported fields of typ which aren't skipped, with embedded structs'
+// fields promoted
+func (m *Mapper) fields(typ reflect.Type) []reflect.StructField {
+	tag := m.Tag
+	if tag == "" {
+		tag = "map"
+	}
+	var fields []reflect.StructField
+	for _, f := range reflect.VisibleFields(typ) {
+		if !f.IsExported() || f.Tag.Get(tag) == "-" {
+			continue
+		}
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && ft.Kind() == reflect.Struct && f.Tag.Get(tag) == "" {
+			// its fields are promoted
+			continue
+		}
+		if len(f.Index) > 1 && behindUnexportedPointer(typ, f.Index) {
+			continue
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// behindUnexportedPointer reports whether the field at index is promoted through an embedded
+// pointer to an unexported type, which reflect can't allocate or read through
+func behindUnexportedPointer(typ reflect.Type, index []int) bool {
+	for _, x := range index[:len(index)-1] {
+		f := typ.Field(x)
+		if f.Type.Kind() == reflect.Ptr {
+			if !f.IsExported() {
+				return true
+			}
+			typ = f.Type.Elem()
+		} else {
+			typ = f.Type
+		}
+	}
+	return false
+}
+
+func (m *Mapper) fieldName(f reflect.StructField) string {
+	tag := m.Tag
+	if tag == "" {
+		tag = "map"
+	}
+	if name, _, _ := strings.Cut(f.Tag.Get(tag), ","); name != "" {
+		return name
+	}
+	return f.Name
+}
+
+func isNumberKind(k reflect.Kind) bool {
+	return k >= reflect.Int && k <= reflect.Float64
+}
+
+// converter returns how to set a dst from a src
+func (m *Mapper) converter(dst, src reflect.Type) (mapConvert, error) {
+	m.mu.RLock()
+	fn, ok := m.converters[[2]reflect.Type{src, dst}]
+	m.mu.RUnlock()
+	if ok {
+		return func(d, s reflect.Value) error {
+			v, err := fn(s)
+			if err == nil {
+				d.Set(v)
+			}
+			return err
+		}, nil
+	}
+
+	switch {
+	case src.AssignableTo(dst):
+		return func(d, s reflect.Value) error {
+			d.Set(s)
+			return nil
+		}, nil
+	case isNumberKind(src.Kind()) && isNumberKind(dst.Kind()):
+		return convertNumber, nil
+	case src.Kind() == reflect.String && dst.Kind() == reflect.String,
+		src.Kind() == reflect.Bool && dst.Kind() == reflect.Bool:
+		return func(d, s reflect.Value) error {
+			d.Set(s.Convert(dst))
+			return nil
+		}, nil
+	case src.Kind() == reflect.Ptr:
+		elem, err := m.converter(dst, src.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return func(d, s reflect.Value) error {
+			if s.IsNil() {
+				d.Set(reflect.Zero(dst))
+				return nil
+			}
+			return elem(d, s.Elem())
+		}, nil
+	case dst.Kind() == reflect.Ptr:
+		elem, err := m.converter(dst.Elem(), src)
+		if err != nil {
+			return nil, err
+		}
+		return func(d, s reflect.Value) error {
+			p := reflect.New(dst.Elem())
+			if err := elem(p.Elem(), s); err != nil {
+				return err
+			}
+			d.Set(p)
+			return nil
+		}, nil
+	case src.Kind() == reflect.Struct && dst.Kind() == reflect.Struct:
+		// planned when first used, so that recursive types work
+		return func(d, s reflect.Value) error {
+			plan, err := m.plan(dst, src)
+			if err != nil {
+				return err
+			}
+			return plan.run(d, s)
+		}, nil
+	case src.Kind() == reflect.Slice && dst.Kind() == reflect.Slice:
+		elem, err := m.converter(dst.Elem(), src.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return func(d, s reflect.Value) error {
+			if s.IsNil() {
+				d.Set(reflect.Zero(dst))
+				return nil
+			}
+			out := reflect.MakeSlice(dst, s.Len(), s.Len())
+			for i := 0; i < s.Len(); i++ {
+				if err := elem(out.Index(i), s.Index(i)); err != nil {
+					return fmt.Errorf("index %d: %w", i, err)
+				}
+			}
+			d.Set(out)
+			return nil
+		}, nil
+	case src.Kind() == reflect.Map && dst.Kind() == reflect.Map && src.Key().AssignableTo(dst.Key()):
+		elem, err := m.converter(dst.Elem(), src.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return func(d, s reflect.Value) error {
+			if s.IsNil() {
+				d.Set(reflect.Zero(dst))
+				return nil
+			}
+			out := reflect.MakeMapWithSize(dst, s.Len())
+			iter := s.MapRange()
+			for iter.Next() {
+				v := reflect.New(dst.Elem()).Elem()
+				if err := elem(v, iter.Value()); err != nil {
+					return fmt.Errorf("key %v: %w", iter.Key(), err)
+				}
+				out.SetMapIndex(iter.Key(), v)
+			}
+			d.Set(out)
+			return nil
+		}, nil
+	}
+	return nil, fmt.Errorf("%w from %s to %s", ErrUnmappable, src, dst)
+}
+
+// convertNumber converts between numeric kinds, failing rather than overflowing or losing a
+// sign
+func convertNumber(d, s reflect.Value) error {
+	switch {
+	case s.CanInt():
+		n := s.Int()
+		switch {
+		case d.CanInt() && !d.OverflowInt(n),
+			d.CanUint() && n >= 0 && !d.OverflowUint(uint64(n)),
+			d.CanFloat():
+			d.Set(s.Convert(d.Type()))
+			return nil
+		}
+	case s.CanUint():
+		n := s.Uint()
+		switch {
+		case d.CanInt() && n <= 1<<63-1 && !d.OverflowInt(int64(n)),
+			d.CanUint() && !d.OverflowUint(n),
+			d.CanFloat():
+			d.Set(s.Convert(d.Type()))
+			return nil
+		}
+	default:
+		f := s.Float()
+		switch {
+		case d.CanFloat() && !d.OverflowFloat(f),
+			d.CanInt() && f == float64(int64(f)) && !d.OverflowInt(int64(f)),
+			d.CanUint() && f >= 0 && f == float64(uint64(f)) && !d.OverflowUint(uint64(f)):
+			d.Set(s.Convert(d.Type()))
+			return nil
+		}
+	}
+	return fmt.Errorf("%v does not fit in %s", s.Interface(), d.Type())
+}
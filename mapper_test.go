@@ -0,0 +1,185 @@
+package toolkit
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// MapperAudit is exported so that mapperUser can embed a pointer to it
+type MapperAudit struct {
+	CreatedBy string
+	Version   int
+}
+
+type mapperAddress struct {
+	Street string
+	City   string
+}
+
+type mapperUserDTO struct {
+	Name     string           `json:"name"`
+	Email    *string          `json:"email"`
+	Age      int64            `json:"age"`
+	Zip      string           `json:"zip" map:"PostCode"`
+	Address  *mapperAddress   `json:"address"`
+	Tags     []string         `json:"tags"`
+	Scores   map[string]int32 `json:"scores"`
+	Born     string           `json:"born"`
+	Password string           `json:"password" map:"-"`
+	MapperAudit
+}
+
+type mapperAddressModel struct {
+	Street string
+	City   string
+	Line2  string
+}
+
+type mapperUser struct {
+	ID       int
+	Name     string
+	Email    string
+	Age      uint8
+	PostCode string
+	Address  mapperAddressModel
+	Tags     []string
+	Scores   map[string]float64
+	Born     time.Time
+	Password string
+	*MapperAudit
+}
+
+func TestMapper(t *testing.T) {
+	var m Mapper
+	RegisterConverter(&m, func(s string) (time.Time, error) {
+		return time.Parse("2006-01-02", s)
+	})
+
+	email := "ann@example.com"
+	dto := mapperUserDTO{
+		Name:        "Ann",
+		Email:       &email,
+		Age:         42,
+		Zip:         "12345",
+		Address:     &mapperAddress{Street: "1 Main St", City: "Springfield"},
+		Tags:        []string{"a", "b"},
+		Scores:      map[string]int32{"x": 1},
+		Born:        "1982-03-04",
+		Password:    "secret",
+		MapperAudit: MapperAudit{CreatedBy: "admin", Version: 3},
+	}
+	user := mapperUser{ID: 7, Password: "hash"}
+	if err := m.Map(&user, &dto); err != nil {
+		t.Fatal(err)
+	}
+
+	want := mapperUser{
+		ID:          7,
+		Name:        "Ann",
+		Email:       email,
+		Age:         42,
+		PostCode:    "12345",
+		Address:     mapperAddressModel{Street: "1 Main St", City: "Springfield"},
+		Tags:        []string{"a", "b"},
+		Scores:      map[string]float64{"x": 1},
+		Born:        time.Date(1982, 3, 4, 0, 0, 0, 0, time.UTC),
+		Password:    "hash",
+		MapperAudit: &MapperAudit{CreatedBy: "admin", Version: 3},
+	}
+	if !reflect.DeepEqual(user, want) {
+		t.Errorf("expected %+v, got %+v", want, user)
+	}
+
+	// and back, where the missing converter for time.Time to string is an error
+	var back mapperUserDTO
+	if err := m.Map(&back, user); !errors.Is(err, ErrUnmappable) || !strings.Contains(err.Error(), "Born") {
+		t.Errorf("expected ErrUnmappable for Born, got %v", err)
+	}
+	RegisterConverter(&m, func(t time.Time) (string, error) {
+		return t.Format("2006-01-02"), nil
+	})
+	user.Password = "hash"
+	if err := m.Map(&back, user); err != nil {
+		t.Fatal(err)
+	}
+	if back.Born != "1982-03-04" || back.Email == nil || *back.Email != email || back.Address.City != "Springfield" || back.Password != "" || back.CreatedBy != "admin" {
+		t.Errorf("unexpected reverse mapping %+v", back)
+	}
+}
+
+func TestMapper_numbers(t *testing.T) {
+	type small struct{ N int8 }
+	type unsigned struct{ N uint }
+	type float struct{ N float64 }
+
+	var tests = []struct {
+		name    string
+		src     any
+		dst     any
+		want    any
+		wantErr bool
+	}{
+		{name: "fits", src: struct{ N int }{100}, dst: &small{}, want: &small{100}},
+		{name: "overflow", src: struct{ N int }{300}, dst: &small{}, wantErr: true},
+		{name: "negative to unsigned", src: struct{ N int }{-1}, dst: &unsigned{}, wantErr: true},
+		{name: "whole float", src: struct{ N float64 }{3}, dst: &small{}, want: &small{3}},
+		{name: "fractional float", src: struct{ N float64 }{3.5}, dst: &small{}, wantErr: true},
+		{name: "int to float", src: struct{ N int }{3}, dst: &float{}, want: &float{3}},
+		{name: "string to int", src: struct{ N string }{"3"}, dst: &small{}, wantErr: true},
+	}
+
+	for _, e := range tests {
+		err := MapStruct(e.dst, e.src)
+		if e.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected an error", e.name)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(e.dst, e.want) {
+			t.Errorf("%s: expected %+v, got %+v and %v", e.name, e.want, e.dst, err)
+		}
+	}
+
+	if err := MapStruct(small{}, small{}); err == nil {
+		t.Error("expected a non-pointer destination to be refused")
+	}
+}
+
+type mapperNode struct {
+	Name     string
+	Children []*mapperNode
+}
+
+type mapperNodeDTO struct {
+	Name     string
+	Children []mapperNodeDTO
+}
+
+func TestMapper_recursive(t *testing.T) {
+	src := mapperNodeDTO{Name: "root", Children: []mapperNodeDTO{{Name: "a"}, {Name: "b", Children: []mapperNodeDTO{{Name: "c"}}}}}
+	var dst mapperNode
+	if err := MapStruct(&dst, src); err != nil {
+		t.Fatal(err)
+	}
+	if len(dst.Children) != 2 || dst.Children[1].Children[0].Name != "c" {
+		t.Errorf("unexpected tree %+v", dst)
+	}
+}
+
+func BenchmarkMapper(b *testing.B) {
+	email := "ann@example.com"
+	dto := mapperUserDTO{Name: "Ann", Email: &email, Age: 42, Zip: "12345", Tags: []string{"a"}}
+	var m Mapper
+	RegisterConverter(&m, func(s string) (time.Time, error) { return time.Time{}, nil })
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var user mapperUser
+		if err := m.Map(&user, &dto); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
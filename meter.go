@@ -0,0 +1,266 @@
+package toolkit
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kaliadmen/toolkit/ioutil"
+)
+
+// UsageOtherKey is the key usage is counted under once a Meter tracks as many keys as it may
+const UsageOtherKey = "(other)"
+
+// Usage is the traffic of one API key or tenant over a period
+type Usage struct {
+	Key          string    `json:"key"`
+	Requests     int64     `json:"requests"`
+	ClientErrors int64     `json:"client_errors"`
+	Errors       int64     `json:"errors"`
+	BytesIn      int64     `json:"bytes_in"`
+	BytesOut     int64     `json:"bytes_out"`
+	From         time.Time `json:"from"`
+	To           time.Time `json:"to"`
+}
+
+// UsageSink receives metered usage, for billing or abuse detection
+type UsageSink interface {
+	WriteUsage(ctx context.Context, usage []Usage) error
+}
+
+// UsageSinkFunc adapts a function to a UsageSink
+type UsageSinkFunc func(ctx context.Context, usage []Usage) error
+
+// WriteUsage calls f
+func (f UsageSinkFunc) WriteUsage(ctx context.Context, usage []Usage) error {
+	return f(ctx, usage)
+}
+
+// Meter counts requests, bytes in and out, and errors per API key, and periodically flushes
+// the counts to a sink
+type Meter struct {
+	// Key identifies the API key or tenant of a request once it has been authenticated. Keys
+	// are sent to the sink, so it must return an identifier such as an account ID, and not
+	// the secret key itself. Defaults to the user ID in the request's context, set by
+	// RequestContext
+	Key func(r *http.Request) string
+	// MaxKeys is the number of keys counted between flushes; the usage of any more is counted
+	// under UsageOtherKey. Defaults to 10000
+	MaxKeys int
+	// Sink receives the counts on each flush
+	Sink UsageSink
+	// Interval is how often Run flushes. Defaults to one minute
+	Interval time.Duration
+	ErrorLog func(err error)
+
+	mu     sync.Mutex
+	counts map[string]*Usage
+	since  time.Time
+}
+
+// Middleware meters each request. Requests without a key are not counted.
+func (m *Meter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, _ := UserIDFromContext(r.Context())
+		if m.Key != nil {
+			key = m.Key(r)
+		}
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body := countBody(r)
+		cw := newCountingWriter(w)
+
+		next.ServeHTTP(cw, r)
+		m.add(key, cw.Status(), body.Count(), cw.Count())
+	})
+}
+
+func (m *Meter) add(key string, status int, in, out int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.counts == nil {
+		m.counts = make(map[string]*Usage)
+		m.since = time.Now()
+	}
+	u, ok := m.counts[key]
+	if !ok {
+		if len(m.counts) >= m.maxKeys() {
+			key = UsageOtherKey
+		}
+		if u, ok = m.counts[key]; !ok {
+			u = &Usage{Key: key}
+			m.counts[key] = u
+		}
+	}
+
+	u.Requests++
+	u.BytesIn += in
+	u.BytesOut += out
+	switch {
+	case status >= 500:
+		u.Errors++
+	case status >= 400:
+		u.ClientErrors++
+	}
+}
+
+func (m *Meter) maxKeys() int {
+	if m.MaxKeys > 0 {
+		return m.MaxKeys
+	}
+	return 10000
+}
+
+// Snapshot returns the counts since the last flush, sorted by key
+func (m *Meter) Snapshot() []Usage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.snapshotLocked(time.Now())
+}
+
+func (m *Meter) snapshotLocked(now time.Time) []Usage {
+	usage := make([]Usage, 0, len(m.counts))
+	for _, u := range m.counts {
+		c := *u
+		c.From, c.To = m.since, now
+		usage = append(usage, c)
+	}
+	sort.Slice(usage, func(i, j int) bool { return usage[i].Key < usage[j].Key })
+	return usage
+}
+
+// Flush sends the counts since the last flush to the sink, and resets them. If the sink fails,
+// the counts are kept, and sent with the next flush.
+func (m *Meter) Flush(ctx context.Context) error {
+	m.mu.Lock()
+	if len(m.counts) == 0 || m.Sink == nil {
+		m.mu.Unlock()
+		return nil
+	}
+	usage := m.snapshotLocked(time.Now())
+	counts, since := m.counts, m.since
+	m.counts = nil
+	m.mu.Unlock()
+
+	err := m.Sink.WriteUsage(ctx, usage)
+	if err != nil {
+		m.mu.Lock()
+		// merge back, keeping the earlier start time
+		for key, u := range m.counts {
+			if _, ok := counts[key]; !ok && len(counts) >= m.maxKeys() {
+				key = UsageOtherKey
+			}
+			if old, ok := counts[key]; ok {
+				old.Requests += u.Requests
+				old.ClientErrors += u.ClientErrors
+				old.Errors += u.Errors
+				old.BytesIn += u.BytesIn
+				old.BytesOut += u.BytesOut
+			} else {
+				u.Key = key
+				counts[key] = u
+			}
+		}
+		m.counts, m.since = counts, since
+		m.mu.Unlock()
+	}
+	return err
+}
+
+// Run flushes the counts every Interval until ctx is done, then flushes one last time
+func (m *Meter) Run(ctx context.Context) {
+	interval := m.Interval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.flushAndLog(ctx)
+		case <-ctx.Done():
+			// the context is done, so give the last flush its own deadline
+			final, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			m.flushAndLog(final)
+			cancel()
+			return
+		}
+	}
+}
+
+func (m *Meter) flushAndLog(ctx context.Context) {
+	if err := m.Flush(ctx); err != nil && m.ErrorLog != nil {
+		m.ErrorLog(err)
+	}
+}
+
+// countBody replaces r's body with one which counts the bytes read from it
+func countBody(r *http.Request) *ioutil.CountingReader {
+	body := ioutil.NewCountingReader(r.Body)
+	if r.Body != nil {
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{body, r.Body}
+	}
+	return body
+}
+
+// countingWriter records the status and number of bytes of a response
+type countingWriter struct {
+	http.ResponseWriter
+	status int
+	body   *ioutil.CountingWriter
+}
+
+func newCountingWriter(w http.ResponseWriter) *countingWriter {
+	return &countingWriter{ResponseWriter: w, body: ioutil.NewCountingWriter(w)}
+}
+
+func (cw *countingWriter) WriteHeader(status int) {
+	if cw.status == 0 {
+		cw.status = status
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	return cw.body.Write(p)
+}
+
+// Count returns the number of bytes written so far
+func (cw *countingWriter) Count() int64 {
+	return cw.body.Count()
+}
+
+// Status returns the response status, which is 200 if nothing was written
+func (cw *countingWriter) Status() int {
+	if cw.status == 0 {
+		return http.StatusOK
+	}
+	return cw.status
+}
+
+// Flush implements http.Flusher when the underlying writer does
+func (cw *countingWriter) Flush() {
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer
+func (cw *countingWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
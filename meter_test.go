@@ -0,0 +1,99 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMeter_Middleware(t *testing.T) {
+	var flushed []Usage
+	failing := true
+	m := &Meter{Sink: UsageSinkFunc(func(ctx context.Context, usage []Usage) error {
+		if failing {
+			return errors.New("sink unavailable")
+		}
+		flushed = usage
+		return nil
+	})}
+
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.ReadAll(r.Body)
+		switch r.URL.Path {
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case "/broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			_, _ = w.Write([]byte("hello"))
+		}
+	}))
+
+	var tests = []struct {
+		key  string
+		path string
+		body string
+	}{
+		{"a", "/", "1234"},
+		{"a", "/missing", ""},
+		{"b", "/broken", ""},
+		{"", "/", "anonymous requests are not metered"},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("POST", e.path, strings.NewReader(e.body))
+		if e.key != "" {
+			req = req.WithContext(ContextWithUserID(req.Context(), e.key))
+		}
+		// the secret key is never used as the identifier
+		req.Header.Set("X-API-Key", "secret")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if err := m.Flush(context.Background()); err == nil {
+		t.Fatal("expected the sink error")
+	}
+
+	// counts are kept after a failed flush, and merged with new ones
+	req := httptest.NewRequest("GET", "/", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req.WithContext(ContextWithUserID(req.Context(), "a")))
+
+	failing = false
+	if err := m.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(flushed) != 2 {
+		t.Fatalf("expected usage for 2 keys, got %v", flushed)
+	}
+	a, b := flushed[0], flushed[1]
+	if a.Key != "a" || a.Requests != 3 || a.BytesIn != 4 || a.BytesOut != 10 || a.ClientErrors != 1 {
+		t.Errorf("unexpected usage for a: %+v", a)
+	}
+	if b.Requests != 1 || b.Errors != 1 {
+		t.Errorf("unexpected usage for b: %+v", b)
+	}
+
+	if len(m.Snapshot()) != 0 {
+		t.Error("expected counts to be reset after a flush")
+	}
+}
+
+func TestMeter_MaxKeys(t *testing.T) {
+	m := &Meter{MaxKeys: 2}
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, key := range []string{"a", "b", "c", "d", "a"} {
+		req := httptest.NewRequest("GET", "/", nil)
+		handler.ServeHTTP(httptest.NewRecorder(), req.WithContext(ContextWithUserID(req.Context(), key)))
+	}
+
+	usage := m.Snapshot()
+	if len(usage) != 3 || usage[0].Key != UsageOtherKey || usage[0].Requests != 2 || usage[1].Key != "a" || usage[1].Requests != 2 {
+		t.Errorf("expected a, b and the others counted, got %+v", usage)
+	}
+}
@@ -0,0 +1,177 @@
+package toolkit
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// MethodOverride lets clients which can only send GET and POST, such as HTML forms and old
+// proxies, send other methods: a POST with an X-HTTP-Method-Override header, or a form
+// field named _method, is passed on with that method instead.
+type MethodOverride struct {
+	// Header names the override header. Defaults to X-HTTP-Method-Override
+	Header string
+	// FormField names the override field of URL-encoded form bodies. Defaults to _method; set
+	// it to "-" to ignore forms
+	FormField string
+	// Methods are those a POST may be changed to. Default to PUT, PATCH and DELETE
+	Methods []string
+	// Allow decides whether a request may override its method, such as only once it's been
+	// authenticated. Requests which may not are passed on as POSTs. Defaults to allowing all
+	Allow func(r *http.Request) bool
+}
+
+// Middleware applies the override of POST requests to next. A form body is only read once
+// Allow has passed, and is left for next to read again.
+func (mo *MethodOverride) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			method := r.Header.Get(mo.header())
+			readForm := method == "" && mo.readsForm(r)
+			if (method != "" || readForm) && (mo.Allow == nil || mo.Allow(r)) {
+				if readForm {
+					method = mo.formValue(r)
+				}
+				if method = mo.method(method); method != "" {
+					r2 := r.Clone(r.Context())
+					r2.Method = method
+					r2.Header.Del(mo.header())
+					r = r2
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (mo *MethodOverride) header() string {
+	if mo.Header == "" {
+		return "X-HTTP-Method-Override"
+	}
+	return mo.Header
+}
+
+// readsForm reports whether the override may be in the request's form. Only URL-encoded forms
+// are read, so multipart uploads aren't read into memory here
+func (mo *MethodOverride) readsForm(r *http.Request) bool {
+	ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mo.FormField != "-" && ct == "application/x-www-form-urlencoded" && r.Body != nil
+}
+
+// formValue returns the override field of the request's form, putting the body back for the
+// handler. Bodies over 10MB, the most ParseForm reads, are not searched.
+func (mo *MethodOverride) formValue(r *http.Request) string {
+	field := mo.FormField
+	if field == "" {
+		field = "_method"
+	}
+
+	const maxFormSize = 10 << 20
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxFormSize+1))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+	if err != nil || len(body) > maxFormSize {
+		return ""
+	}
+	form, _ := url.ParseQuery(string(body))
+	return form.Get(field)
+}
+
+// method returns method if a POST may be changed to it, or ""
+func (mo *MethodOverride) method(method string) string {
+	method = strings.ToUpper(strings.TrimSpace(method))
+
+	methods := mo.Methods
+	if methods == nil {
+		methods = []string{http.MethodPut, http.MethodPatch, http.MethodDelete}
+	}
+	for _, m := range methods {
+		if method == strings.ToUpper(m) {
+			return method
+		}
+	}
+	return ""
+}
+
+// HeadMiddleware answers HEAD requests with next's GET response, without its body, so handlers
+// which only serve GET, such as those checking r.Method, answer load balancer probes. The
+// Content-Length is that of the GET body, unless next sets one itself or flushes early.
+func HeadMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		r2 := r.Clone(r.Context())
+		r2.Method = http.MethodGet
+		serveHead(w, r2, next)
+	})
+}
+
+// serveHead runs h for a HEAD request, discarding its body
+func serveHead(w http.ResponseWriter, r *http.Request, h http.Handler) {
+	hw := &headWriter{ResponseWriter: w}
+	h.ServeHTTP(hw, r)
+	hw.commit()
+}
+
+// headWriter counts and discards a response body, holding the header back until the end to
+// give it a Content-Length
+type headWriter struct {
+	http.ResponseWriter
+	status    int
+	n         int64
+	committed bool
+}
+
+func (hw *headWriter) WriteHeader(status int) {
+	if hw.status == 0 {
+		hw.status = status
+	}
+}
+
+func (hw *headWriter) Write(p []byte) (int, error) {
+	if hw.status == 0 {
+		hw.status = http.StatusOK
+	}
+	hw.n += int64(len(p))
+	return len(p), nil
+}
+
+func (hw *headWriter) commit() {
+	if hw.committed {
+		return
+	}
+	hw.committed = true
+	if hw.status == 0 {
+		hw.status = http.StatusOK
+	}
+	h := hw.Header()
+	if h.Get("Content-Length") == "" && h.Get("Transfer-Encoding") == "" && hw.status >= 200 && hw.status != http.StatusNoContent && hw.status != http.StatusNotModified {
+		h.Set("Content-Length", strconv.FormatInt(hw.n, 10))
+	}
+	hw.ResponseWriter.WriteHeader(hw.status)
+}
+
+// Flush sends the header without a Content-Length, for streaming handlers
+func (hw *headWriter) Flush() {
+	if !hw.committed && hw.status != 0 {
+		hw.committed = true
+		hw.ResponseWriter.WriteHeader(hw.status)
+	}
+	if f, ok := hw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer
+func (hw *headWriter) Unwrap() http.ResponseWriter {
+	return hw.ResponseWriter
+}
@@ -0,0 +1,100 @@
+package toolkit
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// readTracker records whether it has been read from
+type readTracker struct {
+	io.Reader
+	read bool
+}
+
+func (rt *readTracker) Read(p []byte) (int, error) {
+	rt.read = true
+	return rt.Reader.Read(p)
+}
+
+func TestMethodOverride(t *testing.T) {
+	// the handler gets the method, and the body, which the override must leave for it
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write([]byte(strings.TrimSpace(r.Method + " " + string(body))))
+	})
+	var body *readTracker
+	var readEarly bool
+	mo := &MethodOverride{Allow: func(r *http.Request) bool {
+		readEarly = body.read
+		return r.Header.Get("Authorization") != ""
+	}}
+	h := mo.Middleware(echo)
+
+	var tests = []struct {
+		name   string
+		method string
+		header string
+		form   string
+		authed bool
+		want   string
+	}{
+		{name: "header", method: "POST", header: "delete", authed: true, want: "DELETE"},
+		{name: "form field", method: "POST", form: "_method=PUT&name=x", authed: true, want: "PUT _method=PUT&name=x"},
+		{name: "form not allowed", method: "POST", form: "_method=PUT&name=x", want: "POST _method=PUT&name=x"},
+		{name: "form without field", method: "POST", form: "name=x", authed: true, want: "POST name=x"},
+		{name: "not allowed", method: "POST", header: "DELETE", want: "POST"},
+		{name: "method not listed", method: "POST", header: "CONNECT", authed: true, want: "POST"},
+		{name: "only POST", method: "GET", header: "DELETE", authed: true, want: "GET"},
+	}
+	for _, e := range tests {
+		body = &readTracker{Reader: strings.NewReader(e.form)}
+		readEarly = false
+		r := httptest.NewRequest(e.method, "/", body)
+		if e.form != "" {
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		if e.header != "" {
+			r.Header.Set("X-HTTP-Method-Override", e.header)
+		}
+		if e.authed {
+			r.Header.Set("Authorization", "Bearer x")
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, r)
+		if rr.Body.String() != e.want {
+			t.Errorf("%s: expected %s, got %s", e.name, e.want, rr.Body)
+		}
+		if readEarly {
+			t.Errorf("%s: the body was read before Allow", e.name)
+		}
+	}
+}
+
+func TestHeadMiddleware(t *testing.T) {
+	var tools Tools
+	h := HeadMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		_ = tools.WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	}))
+
+	get := httptest.NewRecorder()
+	h.ServeHTTP(get, httptest.NewRequest("GET", "/", nil))
+	head := httptest.NewRecorder()
+	h.ServeHTTP(head, httptest.NewRequest("HEAD", "/", nil))
+
+	if head.Code != http.StatusOK || head.Body.Len() != 0 {
+		t.Fatalf("unexpected HEAD response %d %q", head.Code, head.Body)
+	}
+	if got := head.Header().Get("Content-Length"); got != "15" || get.Body.Len() != 15 {
+		t.Errorf("expected the GET body's length, got %s for %q", got, get.Body)
+	}
+	if head.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("expected the GET headers, got %v", head.Header())
+	}
+}
@@ -0,0 +1,174 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+)
+
+// MockServer is a test server with canned JSON responses, latencies and failure rates, for
+// integration tests of code which calls partners with PushJSONToRemote or CallJSON. Failures
+// are drawn from a seeded source, so a test sees the same sequence on every run.
+type MockServer struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	seed   int64
+	routes map[string]*MockRoute
+	calls  []MockCall
+}
+
+// MockCall is a request received by a MockServer
+type MockCall struct {
+	Method string
+	Path   string
+	Header http.Header
+	Body   []byte
+}
+
+// MockRoute is the canned behaviour of one route of a MockServer
+type MockRoute struct {
+	status        int
+	body          any
+	generate      func(f *Faker) any
+	header        http.Header
+	latency       time.Duration
+	failureRate   float64
+	failureStatus int
+	failFirst     int
+	calls         int
+	rand          *rand.Rand
+	faker         *Faker
+}
+
+// NewMockServer starts a mock server whose random failures are drawn from seed. Unknown
+// routes get a 404. Close it when the test is done.
+func NewMockServer(seed int64) *MockServer {
+	m := &MockServer{seed: seed, routes: make(map[string]*MockRoute)}
+	m.Server = httptest.NewServer(http.HandlerFunc(m.serve))
+	return m
+}
+
+// Route declares a route, answered with 200 and no body until configured
+func (m *MockServer) Route(method, path string) *MockRoute {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// each route has its own sources, so calls to one route don't change another's responses
+	seed := m.seed + int64(len(m.routes))
+	route := &MockRoute{
+		status:        http.StatusOK,
+		failureStatus: http.StatusServiceUnavailable,
+		rand:          rand.New(rand.NewSource(seed)),
+		faker:         NewFaker(seed),
+	}
+	m.routes[method+" "+path] = route
+	return route
+}
+
+// Respond sets the status and JSON body of the route's successful responses
+func (mr *MockRoute) Respond(status int, body any) *MockRoute {
+	mr.status, mr.body, mr.generate = status, body, nil
+	return mr
+}
+
+// Generate sets the status of the route's successful responses, and a function generating
+// the JSON body of each one with fake data from the server's seed
+func (mr *MockRoute) Generate(status int, generate func(f *Faker) any) *MockRoute {
+	mr.status, mr.body, mr.generate = status, nil, generate
+	return mr
+}
+
+// Header adds a header to the route's responses
+func (mr *MockRoute) Header(key, value string) *MockRoute {
+	if mr.header == nil {
+		mr.header = make(http.Header)
+	}
+	mr.header.Add(key, value)
+	return mr
+}
+
+// Latency delays every response of the route
+func (mr *MockRoute) Latency(d time.Duration) *MockRoute {
+	mr.latency = d
+	return mr
+}
+
+// Fail makes the route fail with status for the given fraction of requests, from 0 to 1
+func (mr *MockRoute) Fail(rate float64, status int) *MockRoute {
+	mr.failureRate, mr.failureStatus = rate, status
+	return mr
+}
+
+// FailFirst makes the first n requests to the route fail, for testing retries
+func (mr *MockRoute) FailFirst(n int, status int) *MockRoute {
+	mr.failFirst, mr.failureStatus = n, status
+	return mr
+}
+
+// Calls returns the requests received for a route, or for every route if method and path
+// are both empty
+func (m *MockServer) Calls(method, path string) []MockCall {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var calls []MockCall
+	for _, c := range m.calls {
+		if (method == "" && path == "") || (c.Method == method && c.Path == path) {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+func (m *MockServer) serve(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	m.mu.Lock()
+	m.calls = append(m.calls, MockCall{Method: r.Method, Path: r.URL.Path, Header: r.Header.Clone(), Body: body})
+	route, ok := m.routes[r.Method+" "+r.URL.Path]
+	var status int
+	var payload any
+	var latency time.Duration
+	if ok {
+		route.calls++
+		status, payload, latency = route.status, route.body, route.latency
+		if route.generate != nil {
+			payload = route.generate(route.faker)
+		}
+		if route.calls <= route.failFirst || (route.failureRate > 0 && route.rand.Float64() < route.failureRate) {
+			status, payload = route.failureStatus, JSONResponse{Error: true, Message: http.StatusText(route.failureStatus)}
+		}
+		for k, v := range route.header {
+			w.Header()[k] = v
+		}
+	}
+	m.mu.Unlock()
+
+	if !ok {
+		var t Tools
+		_ = t.ErrorJSON(w, errors.New("no mock route for "+r.Method+" "+r.URL.Path), http.StatusNotFound)
+		return
+	}
+
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	if payload == nil {
+		w.WriteHeader(status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(payload)
+}
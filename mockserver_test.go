@@ -0,0 +1,113 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestMockServer(t *testing.T) {
+	mock := NewMockServer(42)
+	defer mock.Close()
+
+	mock.Route("POST", "/hooks").Respond(http.StatusCreated, map[string]string{"id": "1"}).FailFirst(2, http.StatusBadGateway)
+	mock.Route("GET", "/slow").Latency(50*time.Millisecond).Header("X-Mock", "yes")
+	mock.Route("GET", "/flaky").Fail(0.5, http.StatusServiceUnavailable)
+
+	var testTools Tools
+	client := &http.Client{}
+
+	// the first two calls fail, then the canned response is sent
+	for i, expected := range []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusCreated} {
+		status, err := testTools.PushJSONToRemote(client, mock.URL+"/hooks", map[string]int{"n": i})
+		if err != nil || status != expected {
+			t.Errorf("call %d: expected %d, got %d %v", i, expected, status, err)
+		}
+	}
+	if calls := mock.Calls("POST", "/hooks"); len(calls) != 3 || string(calls[2].Body) != "{\n\t\"n\": 2\n}" {
+		t.Errorf("unexpected calls %v", calls)
+	}
+
+	start := time.Now()
+	res, err := client.Get(mock.URL + "/slow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if time.Since(start) < 50*time.Millisecond || res.Header.Get("X-Mock") != "yes" {
+		t.Error("expected a slow response with the canned header")
+	}
+
+	// the same seed gives the same failures
+	sequence := func(m *MockServer) []int {
+		var statuses []int
+		for i := 0; i < 10; i++ {
+			res, err := client.Get(m.URL + "/flaky")
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+			statuses = append(statuses, res.StatusCode)
+		}
+		return statuses
+	}
+	other := NewMockServer(42)
+	defer other.Close()
+	other.Route("POST", "/hooks")
+	other.Route("GET", "/slow")
+	other.Route("GET", "/flaky").Fail(0.5, http.StatusServiceUnavailable)
+
+	first, second := sequence(mock), sequence(other)
+	failures := 0
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("expected identical sequences, got %v and %v", first, second)
+		}
+		if first[i] != http.StatusOK {
+			failures++
+		}
+	}
+	if failures == 0 || failures == 10 {
+		t.Errorf("expected some failures, got %v", first)
+	}
+
+	res, _ = client.Get(mock.URL + "/unknown")
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown route, got %d", res.StatusCode)
+	}
+}
+
+func TestMockRoute_Generate(t *testing.T) {
+	users := func(m *MockServer) []string {
+		m.Route("GET", "/users").Generate(http.StatusOK, func(f *Faker) any {
+			return map[string]string{"name": f.Name(), "email": f.Email()}
+		})
+		var names []string
+		for i := 0; i < 3; i++ {
+			res, err := http.Get(m.URL + "/users")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var user map[string]string
+			_ = json.NewDecoder(res.Body).Decode(&user)
+			res.Body.Close()
+			names = append(names, user["name"]+" "+user["email"])
+		}
+		return names
+	}
+
+	a, b := NewMockServer(9), NewMockServer(9)
+	defer a.Close()
+	defer b.Close()
+	first, second := users(a), users(b)
+	if first[0] == "" || first[0] == first[1] {
+		t.Errorf("expected a generated user per request, got %v", first)
+	}
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("expected the same users from the same seed, got %v and %v", first, second)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package toolkit
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// Verdict is the outcome of a moderation check
+type Verdict int
+
+// Moderation verdicts
+const (
+	// VerdictAllow accepts the content
+	VerdictAllow Verdict = iota
+	// VerdictFlag accepts the content, but reports it for review
+	VerdictFlag
+	// VerdictBlock rejects the content
+	VerdictBlock
+)
+
+// String returns the lower case name of the verdict
+func (v Verdict) String() string {
+	switch v {
+	case VerdictAllow:
+		return "allow"
+	case VerdictFlag:
+		return "flag"
+	case VerdictBlock:
+		return "block"
+	default:
+		return fmt.Sprintf("verdict(%d)", int(v))
+	}
+}
+
+// ModerationResult is returned by a Moderator
+type ModerationResult struct {
+	Verdict Verdict `json:"verdict"`
+	Reason  string  `json:"reason,omitempty"`
+}
+
+// Moderator checks user content, typically by calling an external moderation API
+type Moderator interface {
+	// CheckImage checks an uploaded image of the given MIME type
+	CheckImage(ctx context.Context, contentType string, r io.Reader) (ModerationResult, error)
+	// CheckText checks a text value. Field is the JSON path of a request field, or the name of an uploaded file
+	CheckText(ctx context.Context, field, text string) (ModerationResult, error)
+}
+
+// ModerationError is returned when content is blocked by the moderator
+type ModerationError struct {
+	Field  string
+	Result ModerationResult
+}
+
+func (e *ModerationError) Error() string {
+	msg := "content was rejected by moderation"
+	if e.Field != "" {
+		msg = fmt.Sprintf("%s was rejected by moderation", e.Field)
+	}
+	if e.Result.Reason != "" {
+		msg += ": " + e.Result.Reason
+	}
+	return msg
+}
+
+// Moderation plugs a Moderator into UploadFile and ReadJSON. In ReadJSON, only string fields
+// (and slices of strings) tagged `moderate:"true"` are checked.
+type Moderation struct {
+	Moderator Moderator
+	// OnFlag, if set, is called for content which was flagged but accepted
+	OnFlag func(r *http.Request, field string, result ModerationResult)
+	// MaxTextSize is the number of bytes of an uploaded text file which are checked. Defaults to 1MB
+	MaxTextSize int64
+}
+
+// verdict applies a moderation result, returning an error if the content is blocked
+func (m *Moderation) verdict(r *http.Request, field string, res ModerationResult, err error) (bool, error) {
+	if err != nil {
+		return false, err
+	}
+
+	switch res.Verdict {
+	case VerdictBlock:
+		return false, &ModerationError{Field: field, Result: res}
+	case VerdictFlag:
+		if m.OnFlag != nil {
+			m.OnFlag(r, field, res)
+		}
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// checkFields runs the moderator over the tagged fields of data, which is usually a pointer
+// to a struct decoded by ReadJSON
+func (m *Moderation) checkFields(r *http.Request, data any) error {
+	return walkStringFields(reflect.ValueOf(data), "", func(field, value string, tag reflect.StructTag) error {
+		if tag.Get("moderate") != "true" || value == "" {
+			return nil
+		}
+		res, err := m.Moderator.CheckText(r.Context(), field, value)
+		_, err = m.verdict(r, field, res, err)
+		return err
+	})
+}
+
+// checkUpload runs the moderator over an uploaded image or text file, and reports whether
+// it was flagged
+func (m *Moderation) checkUpload(r *http.Request, fileName, contentType string, f io.Reader) (bool, error) {
+	switch {
+	case strings.HasPrefix(contentType, "image/"):
+		res, err := m.Moderator.CheckImage(r.Context(), contentType, f)
+		return m.verdict(r, fileName, res, err)
+	case strings.HasPrefix(contentType, "text/"):
+		limit := m.MaxTextSize
+		if limit <= 0 {
+			limit = 1024 * 1024
+		}
+		text, err := io.ReadAll(io.LimitReader(f, limit))
+		if err != nil {
+			return false, err
+		}
+		res, err := m.Moderator.CheckText(r.Context(), fileName, string(text))
+		return m.verdict(r, fileName, res, err)
+	default:
+		return false, nil
+	}
+}
@@ -0,0 +1,113 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+type testModerator struct {
+	imageVerdict Verdict
+}
+
+func (m testModerator) CheckImage(ctx context.Context, contentType string, r io.Reader) (ModerationResult, error) {
+	return ModerationResult{Verdict: m.imageVerdict, Reason: "image check"}, nil
+}
+
+func (m testModerator) CheckText(ctx context.Context, field, text string) (ModerationResult, error) {
+	switch {
+	case strings.Contains(text, "spam"):
+		return ModerationResult{Verdict: VerdictBlock, Reason: "spam"}, nil
+	case strings.Contains(text, "meh"):
+		return ModerationResult{Verdict: VerdictFlag, Reason: "borderline"}, nil
+	}
+	return ModerationResult{Verdict: VerdictAllow}, nil
+}
+
+func TestTools_ReadJSONModeration(t *testing.T) {
+	var flagged []string
+	testTools := Tools{
+		Moderation: &Moderation{
+			Moderator: testModerator{},
+			OnFlag: func(r *http.Request, field string, res ModerationResult) {
+				flagged = append(flagged, field)
+			},
+		},
+	}
+
+	var comment struct {
+		Author string   `json:"author"`
+		Body   string   `json:"body" moderate:"true"`
+		Tags   []string `json:"tags" moderate:"true"`
+	}
+
+	var tests = []struct {
+		name    string
+		json    string
+		blocked string
+		flagged int
+	}{
+		{"allowed", `{"author":"spam bot","body":"hello","tags":["a"]}`, "", 0},
+		{"flagged", `{"body":"meh","tags":["ok","meh"]}`, "", 2},
+		{"blocked body", `{"body":"buy spam"}`, "body", 0},
+		{"blocked tag", `{"body":"hi","tags":["ok","spam"]}`, "tags[1]", 0},
+	}
+
+	for _, e := range tests {
+		flagged = nil
+		req := httptest.NewRequest("POST", "/", strings.NewReader(e.json))
+		err := testTools.ReadJSON(httptest.NewRecorder(), req, &comment)
+
+		var modErr *ModerationError
+		if e.blocked == "" && err != nil {
+			t.Errorf("%s: unexpected error %v", e.name, err)
+		}
+		if e.blocked != "" && (!errors.As(err, &modErr) || modErr.Field != e.blocked) {
+			t.Errorf("%s: expected %s to be blocked, got %v", e.name, e.blocked, err)
+		}
+		if len(flagged) != e.flagged {
+			t.Errorf("%s: expected %d flags, got %v", e.name, e.flagged, flagged)
+		}
+	}
+}
+
+func TestTools_UploadFileModeration(t *testing.T) {
+	upload := func(testTools *Tools) (*UploadedFile, error) {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		part, _ := mw.CreateFormFile("file", "ds.png")
+		img, _ := os.ReadFile("./testdata/ds.png")
+		_, _ = part.Write(img)
+		_ = mw.Close()
+
+		req := httptest.NewRequest("POST", "/", &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		return testTools.UploadFile(req, "./testdata/uploads/")
+	}
+
+	blocking := Tools{Moderation: &Moderation{Moderator: testModerator{imageVerdict: VerdictBlock}}}
+	if _, err := upload(&blocking); err == nil {
+		t.Error("expected blocked image to fail upload")
+	}
+
+	flagging := Tools{Moderation: &Moderation{Moderator: testModerator{imageVerdict: VerdictFlag}}}
+	uploaded, err := upload(&flagging)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("./testdata/uploads/" + uploaded.NewFileName)
+
+	if !uploaded.Flagged {
+		t.Error("expected flagged image to be marked")
+	}
+	if fi, err := os.Stat("./testdata/uploads/" + uploaded.NewFileName); err != nil || fi.Size() != uploaded.FileSize {
+		t.Error("flagged image was not stored in full", err)
+	}
+}
@@ -0,0 +1,201 @@
+package toolkit
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrCertificateRevoked is returned when a client certificate has been revoked
+var ErrCertificateRevoked = errors.New("certificate has been revoked")
+
+// ErrSANNotAllowed is returned when a client certificate has no allowed subject alternative name
+var ErrSANNotAllowed = errors.New("certificate subject is not allowed")
+
+// LoadCertPool builds a certificate pool from one or more PEM files
+func LoadCertPool(files ...string) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	for _, f := range files {
+		pem, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", f)
+		}
+	}
+	return pool, nil
+}
+
+// ClientCertPolicy describes how inbound client certificates are verified
+type ClientCertPolicy struct {
+	// ClientCAs are the authorities client certificates must chain to
+	ClientCAs *x509.CertPool
+	// AllowedSANs restricts clients to certificates with one of these DNS names, email
+	// addresses or URIs. A leading "*." matches a single DNS label. Empty allows any.
+	AllowedSANs []string
+	// CheckRevocation is called with each verified leaf certificate and its issuer, for CRL
+	// or OCSP checks. Return an error to refuse the connection.
+	CheckRevocation func(cert, issuer *x509.Certificate) error
+	// Optional makes client certificates optional, rather than required
+	Optional bool
+}
+
+// TLSConfig returns a server tls.Config which verifies client certificates against the policy
+func (p *ClientCertPolicy) TLSConfig() (*tls.Config, error) {
+	if p.ClientCAs == nil {
+		return nil, errors.New("client cert policy has no client CAs")
+	}
+
+	clientAuth := tls.RequireAndVerifyClientCert
+	if p.Optional {
+		clientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ClientAuth: clientAuth,
+		ClientCAs:  p.ClientCAs,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			if len(cs.VerifiedChains) == 0 {
+				return nil
+			}
+			return p.verify(cs.VerifiedChains[0])
+		},
+	}, nil
+}
+
+func (p *ClientCertPolicy) verify(chain []*x509.Certificate) error {
+	leaf := chain[0]
+	if len(p.AllowedSANs) > 0 && !sanAllowed(leaf, p.AllowedSANs) {
+		return ErrSANNotAllowed
+	}
+
+	if p.CheckRevocation != nil {
+		issuer := leaf
+		if len(chain) > 1 {
+			issuer = chain[1]
+		}
+		return p.CheckRevocation(leaf, issuer)
+	}
+	return nil
+}
+
+func sanAllowed(cert *x509.Certificate, allowed []string) bool {
+	var names []string
+	names = append(names, cert.DNSNames...)
+	names = append(names, cert.EmailAddresses...)
+	for _, u := range cert.URIs {
+		names = append(names, u.String())
+	}
+
+	for _, a := range allowed {
+		for _, n := range names {
+			if strings.EqualFold(a, n) {
+				return true
+			}
+			if strings.HasPrefix(a, "*.") {
+				if _, parent, ok := strings.Cut(n, "."); ok && strings.EqualFold(a[2:], parent) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// CRLCheck returns a revocation check for ClientCertPolicy which refuses certificates listed in
+// a DER or PEM encoded certificate revocation list. The list must be signed by the issuer.
+func CRLCheck(crl []byte) (func(cert, issuer *x509.Certificate) error, error) {
+	list, err := x509.ParseCRL(crl)
+	if err != nil {
+		return nil, err
+	}
+
+	revoked := make(map[string]bool)
+	for _, rc := range list.TBSCertList.RevokedCertificates {
+		revoked[rc.SerialNumber.String()] = true
+	}
+
+	return func(cert, issuer *x509.Certificate) error {
+		if err := issuer.CheckCRLSignature(list); err != nil {
+			return err
+		}
+		if list.HasExpired(time.Now()) {
+			return errors.New("certificate revocation list has expired")
+		}
+		if revoked[cert.SerialNumber.String()] {
+			return ErrCertificateRevoked
+		}
+		return nil
+	}, nil
+}
+
+// ClientIdentity is the verified identity of a client which presented a certificate
+type ClientIdentity struct {
+	CommonName   string
+	Organization []string
+	DNSNames     []string
+	Emails       []string
+	URIs         []string
+	SerialNumber string
+	Certificate  *x509.Certificate
+}
+
+type clientIdentityContextKey struct{}
+
+// ClientIdentityFromContext returns the client identity stored by ClientCertMiddleware
+func ClientIdentityFromContext(ctx context.Context) (*ClientIdentity, bool) {
+	id, ok := ctx.Value(clientIdentityContextKey{}).(*ClientIdentity)
+	return id, ok
+}
+
+// ClientCertMiddleware puts the identity from the verified client certificate into the request
+// context. Requests without a verified certificate are refused with a 401 JSON error.
+func ClientCertMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+			var t Tools
+			_ = t.ErrorJSON(w, errors.New("a client certificate is required"), http.StatusUnauthorized)
+			return
+		}
+
+		cert := r.TLS.VerifiedChains[0][0]
+		id := &ClientIdentity{
+			CommonName:   cert.Subject.CommonName,
+			Organization: cert.Subject.Organization,
+			DNSNames:     cert.DNSNames,
+			Emails:       cert.EmailAddresses,
+			SerialNumber: cert.SerialNumber.String(),
+			Certificate:  cert,
+		}
+		for _, u := range cert.URIs {
+			id.URIs = append(id.URIs, u.String())
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientIdentityContextKey{}, id)))
+	})
+}
+
+// ClientCertClient returns an http.Client which presents the certificate in certFile and keyFile
+// to servers, for calling partners which require mTLS. If roots is nil, the system roots are used.
+func ClientCertClient(certFile, keyFile string, roots *x509.CertPool) (*http.Client, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      roots,
+	}
+	return &http.Client{Transport: transport}, nil
+}
@@ -0,0 +1,154 @@
+package toolkit
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key}
+}
+
+// issue returns a client certificate for the given name, as PEM encoded cert and key
+func (ca *testCA) issue(t *testing.T, serial int64, dnsName string) (certPEM, keyPEM []byte) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: dnsName, Organization: []string{"Acme"}},
+		DNSNames:     []string{dnsName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestClientCertPolicy_TLSConfig(t *testing.T) {
+	ca := newTestCA(t)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+
+	crl, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:              big.NewInt(1),
+		ThisUpdate:          time.Now().Add(-time.Minute),
+		NextUpdate:          time.Now().Add(time.Hour),
+		RevokedCertificates: []pkix.RevokedCertificate{{SerialNumber: big.NewInt(3), RevocationTime: time.Now()}},
+	}, ca.cert, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check, err := CRLCheck(crl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy := &ClientCertPolicy{ClientCAs: pool, AllowedSANs: []string{"*.internal"}, CheckRevocation: check}
+	config, err := policy.TLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewUnstartedServer(ClientCertMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, _ := ClientIdentityFromContext(r.Context())
+		_, _ = w.Write([]byte(id.CommonName))
+	})))
+	srv.TLS = config
+	srv.StartTLS()
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+	dir, _ := os.MkdirTemp("", "mtls")
+	defer os.RemoveAll(dir)
+
+	var tests = []struct {
+		name    string
+		serial  int64
+		dnsName string
+		allowed bool
+	}{
+		{"allowed", 2, "billing.internal", true},
+		{"revoked", 3, "billing.internal", false},
+		{"wrong san", 4, "billing.example.com", false},
+	}
+
+	for _, e := range tests {
+		certPEM, keyPEM := ca.issue(t, e.serial, e.dnsName)
+		certFile, keyFile := filepath.Join(dir, e.name+".crt"), filepath.Join(dir, e.name+".key")
+		_ = os.WriteFile(certFile, certPEM, 0600)
+		_ = os.WriteFile(keyFile, keyPEM, 0600)
+
+		client, err := ClientCertClient(certFile, keyFile, roots)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := client.Get(srv.URL)
+		if e.allowed {
+			if err != nil {
+				t.Errorf("%s: unexpected error %s", e.name, err)
+				continue
+			}
+			if res.StatusCode != http.StatusOK {
+				t.Errorf("%s: expected 200, got %d", e.name, res.StatusCode)
+			}
+			res.Body.Close()
+		} else if err == nil {
+			res.Body.Close()
+			t.Errorf("%s: expected the handshake to fail", e.name)
+		}
+	}
+
+	// without a certificate, the handshake fails
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	if res, err := client.Get(srv.URL); err == nil {
+		res.Body.Close()
+		t.Error("expected a request without a client certificate to fail")
+	}
+}
+
+func TestClientCertMiddleware(t *testing.T) {
+	rr := httptest.NewRecorder()
+	ClientCertMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for plain http, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,144 @@
+package toolkit
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// MultiError collects the errors of work which carries on past failures, such as validating
+// every field of a request or processing each file of an upload, to report them together.
+// Append is safe for concurrent use, so goroutines can share one. ErrorJSON sends a MultiError
+// as an array of ErrorDetail in its data.
+type MultiError struct {
+	Errors []error
+	// Threshold is the number of errors after which Append reports that the work should stop.
+	// Zero never stops it
+	Threshold int
+
+	mu sync.Mutex
+}
+
+// Append adds the errors which aren't nil, flattening those which are MultiErrors themselves,
+// and reports whether the threshold has been reached
+func (m *MultiError) Append(errs ...error) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, err := range errs {
+		var nested *MultiError
+		switch {
+		case err == nil:
+		case errors.As(err, &nested) && nested != m:
+			m.Errors = append(m.Errors, nested.errors()...)
+		default:
+			m.Errors = append(m.Errors, err)
+		}
+	}
+	return m.Threshold > 0 && len(m.Errors) >= m.Threshold
+}
+
+func (m *MultiError) errors() []error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]error(nil), m.Errors...)
+}
+
+// Len returns the number of errors
+func (m *MultiError) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.Errors)
+}
+
+// Err returns m if it has any errors, and otherwise nil, so a function can end with
+// return errs.Err()
+func (m *MultiError) Err() error {
+	if m == nil || m.Len() == 0 {
+		return nil
+	}
+	return m
+}
+
+func (m *MultiError) Error() string {
+	errs := m.errors()
+	if len(errs) == 1 {
+		return errs[0].Error()
+	}
+	msgs := make([]string, 0, 3)
+	for i := 0; i < len(errs) && i < 3; i++ {
+		msgs = append(msgs, errs[i].Error())
+	}
+	if len(errs) > 3 {
+		msgs = append(msgs, fmt.Sprintf("and %d more", len(errs)-3))
+	}
+	return fmt.Sprintf("%d errors: %s", len(errs), strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the errors, for errors.Is and errors.As in Go 1.20 and later
+func (m *MultiError) Unwrap() []error {
+	return m.errors()
+}
+
+// Is reports whether any of the errors is target
+func (m *MultiError) Is(target error) bool {
+	for _, err := range m.errors() {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first of the errors matching target
+func (m *MultiError) As(target any) bool {
+	for _, err := range m.errors() {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrorDetail is an error of a MultiError or ItemErrors as ErrorJSON sends it
+type ErrorDetail struct {
+	Message string `json:"message"`
+	// Index is the position of the failed item, for ItemError
+	Index *int `json:"index,omitempty"`
+	// Field and Rule locate a ContractMismatch
+	Field string `json:"field,omitempty"`
+	Rule  string `json:"rule,omitempty"`
+}
+
+// Details describes each of the errors
+func (m *MultiError) Details() []ErrorDetail {
+	errs := m.errors()
+	details := make([]ErrorDetail, len(errs))
+	for i, err := range errs {
+		details[i] = errorDetail(err)
+	}
+	return details
+}
+
+// Details describes each item's error
+func (e ItemErrors) Details() []ErrorDetail {
+	details := make([]ErrorDetail, len(e))
+	for i, ie := range e {
+		details[i] = errorDetail(ie)
+	}
+	return details
+}
+
+func errorDetail(err error) ErrorDetail {
+	d := ErrorDetail{Message: err.Error()}
+	var item ItemError
+	if errors.As(err, &item) {
+		index := item.Index
+		d.Index, d.Message = &index, item.Err.Error()
+	}
+	var mismatch ContractMismatch
+	if errors.As(err, &mismatch) {
+		d.Field, d.Rule, d.Message = mismatch.Field, mismatch.Rule, mismatch.Message
+	}
+	return d
+}
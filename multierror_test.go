@@ -0,0 +1,134 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestMultiError(t *testing.T) {
+	var errs MultiError
+	if errs.Err() != nil {
+		t.Error("expected no error from an empty MultiError")
+	}
+
+	var nested MultiError
+	nested.Append(errors.New("second"), fs.ErrNotExist)
+	errs.Append(errors.New("first"), nil, &nested)
+	if errs.Len() != 3 {
+		t.Fatalf("expected nil skipped and nested errors flattened, got %v", errs.Errors)
+	}
+	err := errs.Err()
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Error("expected errors.Is to find a collected error")
+	}
+	var pathErr *fs.PathError
+	errs.Append(&fs.PathError{Op: "open", Path: "x", Err: fs.ErrPermission})
+	if !errors.As(err, &pathErr) || pathErr.Path != "x" {
+		t.Error("expected errors.As to find a collected error")
+	}
+	if got := err.Error(); got != "4 errors: first; second; file does not exist; and 1 more" {
+		t.Errorf("unexpected message %q", got)
+	}
+
+	// appending concurrently, stopping at the threshold
+	limited := MultiError{Threshold: 5}
+	var wg sync.WaitGroup
+	stopped := make(chan bool, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stopped <- limited.Append(errors.New("failed"))
+		}()
+	}
+	wg.Wait()
+	close(stopped)
+	n := 0
+	for s := range stopped {
+		if s {
+			n++
+		}
+	}
+	if limited.Len() != 10 || n != 6 {
+		t.Errorf("expected 10 errors, 6 past the threshold, got %d and %d", limited.Len(), n)
+	}
+}
+
+func TestErrorJSON_MultiError(t *testing.T) {
+	c, err := ParseOpenAPI([]byte(testOpenAPI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("POST", "/v1/users", nil)
+	r.Header.Set("X-Request-ID", "short")
+
+	var tests = []struct {
+		name string
+		err  error
+		want []ErrorDetail
+	}{
+		{
+			name: "contract",
+			err:  c.ValidateRequest(r, nil),
+			want: []ErrorDetail{
+				{Field: "X-Request-ID", Rule: "minLength", Message: "must have at least 8 characters"},
+				{Rule: "bodyRequired", Message: "body is required"},
+			},
+		},
+		{
+			name: "items",
+			err:  ItemErrors{{Index: 0, Err: errors.New("too big")}, {Index: 3, Err: errors.New("bad type")}},
+			want: []ErrorDetail{{Message: "too big", Index: new(int)}, {Message: "bad type", Index: func() *int { i := 3; return &i }()}},
+		},
+	}
+	for _, e := range tests {
+		rr := httptest.NewRecorder()
+		var tools Tools
+		_ = tools.ErrorJSON(rr, e.err)
+
+		var body struct {
+			Error bool          `json:"error"`
+			Data  []ErrorDetail `json:"data"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if rr.Code != http.StatusBadRequest || !body.Error || len(body.Data) != len(e.want) {
+			t.Errorf("%s: unexpected %d %s", e.name, rr.Code, rr.Body)
+			continue
+		}
+		for i, d := range body.Data {
+			w := e.want[i]
+			if d.Message != w.Message || d.Field != w.Field || d.Rule != w.Rule || (d.Index == nil) != (w.Index == nil) || d.Index != nil && *d.Index != *w.Index {
+				t.Errorf("%s: expected %+v, got %+v", e.name, w, d)
+			}
+		}
+	}
+
+	// an item too large still gets the details of each item, with the 413 of the limit
+	rr := httptest.NewRecorder()
+	var tools Tools
+	_ = tools.ErrorJSON(rr, ItemErrors{{Index: 1, Err: &BodyTooLargeError{Limit: 10}}})
+	var body struct {
+		Data []ErrorDetail `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if rr.Code != http.StatusRequestEntityTooLarge || len(body.Data) != 1 || body.Data[0].Index == nil || *body.Data[0].Index != 1 {
+		t.Errorf("expected item details with a 413, got %d %s", rr.Code, rr.Body)
+	}
+
+	if err := c.ValidateRequest(httptest.NewRequest("GET", "/v1/users?limit=5", nil), nil); err != nil {
+		t.Errorf("expected a valid request to pass, got %v", err)
+	}
+	if !strings.Contains(c.ValidateRequest(r, nil).Error(), "2 errors") {
+		t.Error("expected both mismatches in the message")
+	}
+}
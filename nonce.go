@@ -0,0 +1,65 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrNonceUsed is returned when a nonce which has already been used is presented again
+var ErrNonceUsed = errors.New("nonce has already been used")
+
+// NonceStore remembers nonces until they expire, to protect signed requests and one-time
+// tokens against replay
+type NonceStore interface {
+	// Use records a nonce as used until expires. It returns ErrNonceUsed if the nonce has been
+	// used before and has not expired yet.
+	Use(ctx context.Context, nonce string, expires time.Time) error
+}
+
+// MemoryNonceStore keeps nonces in memory. It only protects a single instance; use a shared
+// store when running several. The zero value is ready to use.
+type MemoryNonceStore struct {
+	// MaxEntries bounds memory use. When full, new nonces are refused with an error, as
+	// forgetting unexpired ones would allow replays. Defaults to 1,000,000
+	MaxEntries int
+
+	mu    sync.Mutex
+	seen  map[string]time.Time
+	sweep time.Time
+}
+
+// Use records a nonce as used until expires
+func (s *MemoryNonceStore) Use(_ context.Context, nonce string, expires time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if s.seen == nil {
+		s.seen = make(map[string]time.Time)
+	}
+	if now.Sub(s.sweep) > time.Minute {
+		s.sweep = now
+		for n, exp := range s.seen {
+			if now.After(exp) {
+				delete(s.seen, n)
+			}
+		}
+	}
+
+	if exp, ok := s.seen[nonce]; ok && !now.After(exp) {
+		return ErrNonceUsed
+	}
+
+	maxEntries := s.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = 1000000
+	}
+	if len(s.seen) >= maxEntries {
+		return errors.New("nonce store is full")
+	}
+
+	s.seen[nonce] = expires
+	return nil
+}
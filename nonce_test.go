@@ -0,0 +1,60 @@
+package toolkit
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestMemoryNonceStore_Use(t *testing.T) {
+	var store MemoryNonceStore
+	ctx := context.Background()
+
+	var tests = []struct {
+		nonce   string
+		expires time.Time
+		err     error
+	}{
+		{"a", time.Now().Add(time.Minute), nil},
+		{"a", time.Now().Add(time.Minute), ErrNonceUsed},
+		{"b", time.Now().Add(-time.Second), nil},
+		{"b", time.Now().Add(time.Minute), nil},
+	}
+
+	for i, e := range tests {
+		if err := store.Use(ctx, e.nonce, e.expires); err != e.err {
+			t.Errorf("%d: expected %v, got %v", i, e.err, err)
+		}
+	}
+
+	full := MemoryNonceStore{MaxEntries: 1}
+	_ = full.Use(ctx, "a", time.Now().Add(time.Minute))
+	if err := full.Use(ctx, "b", time.Now().Add(time.Minute)); err == nil {
+		t.Error("expected a full store to refuse new nonces")
+	}
+}
+
+func TestURLSigner_Nonces(t *testing.T) {
+	signer := &URLSigner{Key: []byte("secret"), Nonces: &MemoryNonceStore{}}
+
+	signed, err := signer.Sign("https://example.com/download?file=a.zip", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(signed)
+
+	if err = signer.Verify(u); err != nil {
+		t.Errorf("first use should verify: %s", err)
+	}
+	if err = signer.Verify(u); err != ErrNonceUsed {
+		t.Errorf("expected ErrNonceUsed on reuse, got %v", err)
+	}
+
+	// a url signed without a nonce is refused by a single use signer
+	plain, _ := (&URLSigner{Key: []byte("secret")}).Sign("https://example.com/download", time.Now().Add(time.Hour))
+	u, _ = url.Parse(plain)
+	if err = signer.Verify(u); err != ErrInvalidSignature {
+		t.Errorf("expected ErrInvalidSignature, got %v", err)
+	}
+}
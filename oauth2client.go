@@ -0,0 +1,255 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ClientCredentials fetches and caches OAuth2 access tokens using the client credentials
+// grant, for calling partner APIs. Use Transport to build an http.Client for PushJSONToRemote
+// and CallJSON which authenticates every request.
+type ClientCredentials struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	// Client is used to request tokens. Defaults to http.DefaultClient
+	Client *http.Client
+	// RefreshBefore is how long before expiry a token is replaced. Defaults to 30 seconds
+	RefreshBefore time.Duration
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Error       string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+// Token returns a valid access token, fetching a new one if the cached token is missing
+// or about to expire
+func (c *ClientCredentials) Token(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	refreshBefore := c.RefreshBefore
+	if refreshBefore <= 0 {
+		refreshBefore = 30 * time.Second
+	}
+
+	if c.token != "" && (c.expiry.IsZero() || time.Now().Add(refreshBefore).Before(c.expiry)) {
+		return c.token, nil
+	}
+
+	token, expiry, err := c.fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+	c.token, c.expiry = token, expiry
+	return token, nil
+}
+
+// Invalidate discards the cached token, so the next call to Token fetches a new one
+func (c *ClientCredentials) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.token = ""
+}
+
+func (c *ClientCredentials) fetch(ctx context.Context) (string, time.Time, error) {
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	if len(c.Scopes) > 0 {
+		form.Set("scope", strings.Join(c.Scopes, " "))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(c.ClientID), url.QueryEscape(c.ClientSecret))
+
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer res.Body.Close()
+
+	var tr tokenResponse
+	if err = json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(&tr); err != nil {
+		return "", time.Time{}, fmt.Errorf("oauth2: cannot decode token response (status %d): %w", res.StatusCode, err)
+	}
+	if res.StatusCode != http.StatusOK || tr.AccessToken == "" {
+		if tr.Error != "" {
+			return "", time.Time{}, fmt.Errorf("oauth2: %s: %s", tr.Error, tr.Description)
+		}
+		return "", time.Time{}, fmt.Errorf("oauth2: token request failed with status %d", res.StatusCode)
+	}
+
+	var expiry time.Time
+	if tr.ExpiresIn > 0 {
+		expiry = time.Now().Add(time.Duration(tr.ExpiresIn) * time.Second)
+	}
+	return tr.AccessToken, expiry, nil
+}
+
+// Transport returns a RoundTripper which adds a bearer token to each request made through base
+// (http.DefaultTransport if nil). If the server responds with 401, the token is refreshed and
+// the request retried once, provided its body can be replayed.
+func (c *ClientCredentials) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &bearerTransport{source: c, base: base}
+}
+
+type bearerTransport struct {
+	source *ClientCredentials
+	base   http.RoundTripper
+}
+
+func (bt *bearerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := bt.send(req)
+	if err != nil || res.StatusCode != http.StatusUnauthorized {
+		return res, err
+	}
+
+	// the token may have been revoked early; refresh and retry once if the body allows it
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return res, nil
+	}
+	res.Body.Close()
+	bt.source.Invalidate()
+
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	return bt.send(retry)
+}
+
+func (bt *bearerTransport) send(req *http.Request) (*http.Response, error) {
+	token, err := bt.source.Token(req.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	// a RoundTripper must not modify the caller's request
+	authed := req.Clone(req.Context())
+	authed.Header.Set("Authorization", "Bearer "+token)
+	return bt.base.RoundTrip(authed)
+}
+
+// StatusError is returned by CallJSON for responses with a non-2xx status
+type StatusError struct {
+	Method string
+	URL    string
+	Status int
+	// RetryAfter is the delay the server asked for in its Retry-After header, or zero
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s %s returned status %d", e.Method, e.URL, e.Status)
+}
+
+// parseRetryAfter reads a Retry-After header in seconds or as an HTTP date
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(v); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(v); err == nil {
+		if d := time.Until(at); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// CallJSON sends data as JSON to url with the given method, and decodes a JSON response into
+// out, unless out is nil. It returns the response status code. Responses with a non-2xx status
+// are not decoded, and return an error.
+func (t *Tools) CallJSON(client *http.Client, method, url string, data, out any) (int, error) {
+	return t.CallJSONContext(context.Background(), client, method, url, data, out)
+}
+
+// CallJSONContext is CallJSON with a context. If ctx has a deadline, such as an inbound
+// request's, the call stops slightly before it, as with OutboundContext, and the server is told
+// the remaining time in RequestTimeoutHeader.
+func (t *Tools) CallJSONContext(ctx context.Context, client *http.Client, method, url string, data, out any) (int, error) {
+	ctx, cancel := OutboundContext(ctx)
+	defer cancel()
+
+	var body io.Reader
+	if data != nil {
+		jsonData, err := json.Marshal(data)
+		if err != nil {
+			return 0, err
+		}
+		body = bytes.NewReader(jsonData)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return 0, err
+	}
+	if data != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	request.Header.Set("Accept", "application/json")
+	setTimeoutHeader(request)
+
+	response, err := client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 1<<16))
+		return response.StatusCode, &StatusError{
+			Method:     method,
+			URL:        url,
+			Status:     response.StatusCode,
+			RetryAfter: parseRetryAfter(response.Header.Get("Retry-After")),
+		}
+	}
+
+	if out != nil && response.StatusCode != http.StatusNoContent {
+		if err = json.NewDecoder(response.Body).Decode(out); err != nil && !errors.Is(err, io.EOF) {
+			return response.StatusCode, err
+		}
+	}
+	return response.StatusCode, nil
+}
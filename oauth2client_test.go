@@ -0,0 +1,108 @@
+package toolkit
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestClientCredentials_Transport(t *testing.T) {
+	var issued int32
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if id != "client" || secret != "secret" || r.FormValue("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":"invalid_client"}`))
+			return
+		}
+		if r.FormValue("scope") != "read write" {
+			t.Errorf("unexpected scope %q", r.FormValue("scope"))
+		}
+		n := atomic.AddInt32(&issued, 1)
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "token" + string(rune('0'+n)),
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+		})
+	}))
+	defer tokenServer.Close()
+
+	// the api rejects the first token, as if it had been revoked
+	var bodies []string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if r.Header.Get("Authorization") != "Bearer token2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer api.Close()
+
+	cc := &ClientCredentials{TokenURL: tokenServer.URL, ClientID: "client", ClientSecret: "secret", Scopes: []string{"read", "write"}}
+	client := &http.Client{Transport: cc.Transport(nil)}
+
+	var testTools Tools
+	var out struct {
+		OK bool `json:"ok"`
+	}
+	status, err := testTools.CallJSON(client, http.MethodPost, api.URL, map[string]string{"foo": "bar"}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != http.StatusOK || !out.OK {
+		t.Errorf("unexpected response %d %v", status, out)
+	}
+	if issued != 2 {
+		t.Errorf("expected 2 tokens to be issued, got %d", issued)
+	}
+	if len(bodies) != 2 || bodies[1] != `{"foo":"bar"}` {
+		t.Errorf("request body was not replayed on retry: %q", bodies)
+	}
+
+	// the cached token is reused
+	status, err = testTools.PushJSONToRemote(client, api.URL, out)
+	if err != nil || status != http.StatusOK {
+		t.Errorf("push failed: %d %v", status, err)
+	}
+	if issued != 2 {
+		t.Errorf("expected cached token to be reused, %d issued", issued)
+	}
+
+	// a second 401 is returned rather than retried again
+	bodies = nil
+	cc.Invalidate()
+	cc.ClientSecret = "wrong"
+	if _, err = testTools.CallJSON(client, http.MethodGet, api.URL, nil, nil); err == nil {
+		t.Error("expected an error with bad client credentials")
+	}
+	if len(bodies) != 0 {
+		t.Error("api should not be called without a token")
+	}
+}
+
+func TestClientCredentials_Token(t *testing.T) {
+	var issued int32
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&issued, 1)
+		_, _ = w.Write([]byte(`{"access_token":"abc","expires_in":10}`))
+	}))
+	defer tokenServer.Close()
+
+	// tokens expiring within RefreshBefore are always refetched
+	cc := &ClientCredentials{TokenURL: tokenServer.URL}
+	for i := 0; i < 3; i++ {
+		token, err := cc.Token(context.Background())
+		if err != nil || token != "abc" {
+			t.Fatalf("unexpected token %q %v", token, err)
+		}
+	}
+	if issued != 3 {
+		t.Errorf("expected token to be refreshed before expiry, %d issued", issued)
+	}
+}
@@ -0,0 +1,785 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// ContractMismatch is a difference between a request or response and an OpenAPI document
+type ContractMismatch struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	// Operation is the operation's ID, or its method and path template
+	Operation string `json:"operation,omitempty"`
+	// In is where the mismatch is: path, query, header, cookie, request or response
+	In string `json:"in"`
+	// Field locates the mismatch, such as a parameter name or body.items.0.name
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+	// Rule is the schema rule which failed, such as minLength, and Params its values, for
+	// translating the message with ValidationMessage
+	Rule   string `json:"rule,omitempty"`
+	Params []any  `json:"params,omitempty"`
+}
+
+// Error lets mismatches be collected in a MultiError
+func (m ContractMismatch) Error() string {
+	return m.String()
+}
+
+func (m ContractMismatch) String() string {
+	s := m.Method + " " + m.Path + ": " + m.In
+	if m.Field != "" {
+		s += " " + m.Field
+	}
+	return s + ": " + m.Message
+}
+
+// OpenAPIContract is an OpenAPI 3 document which requests and responses are checked against.
+// Schemas support the common JSON Schema keywords: type, nullable, enum, const, properties,
+// required, additionalProperties, items, the length, size and range limits, pattern, the
+// date-time, date, email, uuid and uri formats, allOf, anyOf, oneOf, not and local $refs.
+type OpenAPIContract struct {
+	doc    map[string]any
+	base   string
+	routes []openAPIRoute
+
+	mu       sync.Mutex
+	patterns map[string]*regexp.Regexp
+}
+
+type openAPIRoute struct {
+	template string
+	segments []string
+	literals int
+	item     map[string]any
+}
+
+// ParseOpenAPI parses an OpenAPI 3 document in JSON or YAML. Paths are matched below the path
+// of the first server's URL, if any.
+func ParseOpenAPI(data []byte) (*OpenAPIContract, error) {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) == 0 || trimmed[0] != '{' {
+		v, err := parseYAML(data)
+		if err != nil {
+			return nil, err
+		}
+		if data, err = json.Marshal(v); err != nil {
+			return nil, err
+		}
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if version, _ := doc["openapi"].(string); !strings.HasPrefix(version, "3.") {
+		return nil, errors.New("not an OpenAPI 3 document")
+	}
+
+	c := &OpenAPIContract{doc: doc}
+	if servers, _ := doc["servers"].([]any); len(servers) > 0 {
+		server, _ := servers[0].(map[string]any)
+		raw, _ := server["url"].(string)
+		if u, err := url.Parse(raw); err == nil {
+			c.base = strings.TrimSuffix(u.Path, "/")
+		}
+	}
+
+	paths, _ := doc["paths"].(map[string]any)
+	for template, item := range paths {
+		m, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		route := openAPIRoute{template: template, segments: strings.Split(strings.Trim(template, "/"), "/"), item: c.resolve(m)}
+		for _, s := range route.segments {
+			if !strings.HasPrefix(s, "{") {
+				route.literals++
+			}
+		}
+		c.routes = append(c.routes, route)
+	}
+	// routes with more literal segments win, as /users/me over /users/{id}
+	sort.Slice(c.routes, func(i, j int) bool {
+		if c.routes[i].literals != c.routes[j].literals {
+			return c.routes[i].literals > c.routes[j].literals
+		}
+		return c.routes[i].template < c.routes[j].template
+	})
+	return c, nil
+}
+
+// resolve follows a local $ref, such as #/components/schemas/User
+func (c *OpenAPIContract) resolve(v map[string]any) map[string]any {
+	for i := 0; i < 32; i++ {
+		ref, ok := v["$ref"].(string)
+		if !ok || !strings.HasPrefix(ref, "#/") {
+			return v
+		}
+		var target any = c.doc
+		for _, part := range strings.Split(ref[2:], "/") {
+			part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+			m, _ := target.(map[string]any)
+			target = m[part]
+		}
+		if v, ok = target.(map[string]any); !ok {
+			return nil
+		}
+	}
+	return v
+}
+
+// operation finds the operation of a request, and the values of its path parameters
+func (c *OpenAPIContract) operation(r *http.Request) (route *openAPIRoute, op map[string]any, params map[string]string, mismatch *ContractMismatch) {
+	m := ContractMismatch{Method: r.Method, Path: r.URL.Path, In: "request"}
+	p := r.URL.Path
+	if c.base != "" {
+		if p != c.base && !strings.HasPrefix(p, c.base+"/") {
+			m.Message = "path is outside the server's base path " + c.base
+			return nil, nil, nil, &m
+		}
+		p = strings.TrimPrefix(p, c.base)
+	}
+	segments := strings.Split(strings.Trim(p, "/"), "/")
+
+	for i := range c.routes {
+		rt := &c.routes[i]
+		if len(rt.segments) != len(segments) {
+			continue
+		}
+		values := make(map[string]string)
+		matched := true
+		for j, s := range rt.segments {
+			if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") && segments[j] != "" {
+				values[s[1:len(s)-1]], _ = url.PathUnescape(segments[j])
+			} else if s != segments[j] {
+				matched = false
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+
+		method := strings.ToLower(r.Method)
+		o, ok := rt.item[method].(map[string]any)
+		if !ok && method == "head" {
+			o, ok = rt.item["get"].(map[string]any)
+		}
+		if !ok {
+			m.Operation = rt.template
+			m.Message = "method is not documented for " + rt.template
+			return nil, nil, nil, &m
+		}
+		return rt, o, values, nil
+	}
+	m.Message = "path is not documented"
+	return nil, nil, nil, &m
+}
+
+func operationName(rt *openAPIRoute, op map[string]any, method string) string {
+	if id, ok := op["operationId"].(string); ok && id != "" {
+		return id
+	}
+	return method + " " + rt.template
+}
+
+// ValidateRequest checks a request as CheckRequest does, returning its mismatches as a
+// MultiError, which ErrorJSON sends as a 400 listing them, or nil if it matches
+func (c *OpenAPIContract) ValidateRequest(r *http.Request, body []byte) error {
+	var errs MultiError
+	for _, m := range c.CheckRequest(r, body) {
+		errs.Append(m)
+	}
+	return errs.Err()
+}
+
+// CheckRequest checks a request, whose body has been read into body, against the contract
+func (c *OpenAPIContract) CheckRequest(r *http.Request, body []byte) []ContractMismatch {
+	rt, op, pathValues, mismatch := c.operation(r)
+	if mismatch != nil {
+		return []ContractMismatch{*mismatch}
+	}
+	var out []ContractMismatch
+	base := ContractMismatch{Method: r.Method, Path: r.URL.Path, Operation: operationName(rt, op, r.Method)}
+
+	// operation parameters override the path item's
+	params := make(map[string]map[string]any)
+	var order []string
+	for _, list := range []any{rt.item["parameters"], op["parameters"]} {
+		items, _ := list.([]any)
+		for _, item := range items {
+			m, _ := item.(map[string]any)
+			p := c.resolve(m)
+			if p == nil {
+				continue
+			}
+			in, _ := p["in"].(string)
+			name, _ := p["name"].(string)
+			key := in + " " + name
+			if _, ok := params[key]; !ok {
+				order = append(order, key)
+			}
+			params[key] = p
+		}
+	}
+
+	query := r.URL.Query()
+	for _, key := range order {
+		p := params[key]
+		in, _ := p["in"].(string)
+		name, _ := p["name"].(string)
+		var values []string
+		switch in {
+		case "path":
+			if v, ok := pathValues[name]; ok {
+				values = []string{v}
+			}
+		case "query":
+			values = query[name]
+		case "header":
+			values = r.Header.Values(name)
+		case "cookie":
+			if cookie, err := r.Cookie(name); err == nil {
+				values = []string{cookie.Value}
+			}
+		default:
+			continue
+		}
+
+		m := base
+		m.In, m.Field = in, name
+		if len(values) == 0 {
+			if required, _ := p["required"].(bool); required || in == "path" {
+				m.Message, m.Rule = "is required", "required"
+				out = append(out, m)
+			}
+			continue
+		}
+		schema, _ := p["schema"].(map[string]any)
+		if schema == nil {
+			continue
+		}
+		schema = c.resolve(schema)
+		v, err := coerceParameter(schema, values)
+		if err != nil {
+			m.Message = err.Error()
+			var te parameterTypeError
+			if errors.As(err, &te) {
+				m.Rule, m.Params = "type", []any{string(te)}
+			}
+			out = append(out, m)
+			continue
+		}
+		c.validate(schema, v, name, true, m, &out, 0)
+	}
+
+	requestBody, _ := op["requestBody"].(map[string]any)
+	requestBody = c.resolve(requestBody)
+	if requestBody == nil {
+		return out
+	}
+	m := base
+	m.In = "request"
+	if len(body) == 0 {
+		if required, _ := requestBody["required"].(bool); required {
+			m.Message, m.Rule = "body is required", "bodyRequired"
+			out = append(out, m)
+		}
+		return out
+	}
+	return c.checkContent(requestBody, r.Header.Get("Content-Type"), body, true, m, out)
+}
+
+// CheckResponse checks a response to a request against the contract. A nil body skips the
+// body's checks, such as when it was too large to capture.
+func (c *OpenAPIContract) CheckResponse(r *http.Request, status int, header http.Header, body []byte) []ContractMismatch {
+	rt, op, _, mismatch := c.operation(r)
+	if mismatch != nil {
+		mismatch.In = "response"
+		return []ContractMismatch{*mismatch}
+	}
+	m := ContractMismatch{Method: r.Method, Path: r.URL.Path, Operation: operationName(rt, op, r.Method), In: "response"}
+
+	responses, _ := op["responses"].(map[string]any)
+	code := strconv.Itoa(status)
+	var response map[string]any
+	for _, key := range []string{code, code[:1] + "XX", code[:1] + "xx", "default"} {
+		if v, ok := responses[key].(map[string]any); ok {
+			response = c.resolve(v)
+			break
+		}
+	}
+	if response == nil {
+		m.Field = "status"
+		m.Message = fmt.Sprintf("status %d is not documented", status)
+		return []ContractMismatch{m}
+	}
+	if len(body) == 0 || r.Method == http.MethodHead {
+		return nil
+	}
+	if _, ok := response["content"]; !ok {
+		m.Message = fmt.Sprintf("status %d is documented without a body", status)
+		return []ContractMismatch{m}
+	}
+	return c.checkContent(response, header.Get("Content-Type"), body, false, m, nil)
+}
+
+// checkContent checks a body against the media types of a request body or response
+func (c *OpenAPIContract) checkContent(spec map[string]any, contentType string, body []byte, request bool, m ContractMismatch, out []ContractMismatch) []ContractMismatch {
+	content, _ := spec["content"].(map[string]any)
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = "application/octet-stream"
+	}
+	var media map[string]any
+	for _, key := range []string{mediaType, mediaType[:strings.Index(mediaType+"/", "/")] + "/*", "*/*"} {
+		if v, ok := content[key].(map[string]any); ok {
+			media = v
+			break
+		}
+	}
+	if media == nil {
+		m.Field = "content-type"
+		m.Message = fmt.Sprintf("content type %s is not documented", mediaType)
+		return append(out, m)
+	}
+
+	schema, _ := media["schema"].(map[string]any)
+	if schema == nil || !(mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")) {
+		return out
+	}
+	var v any
+	if err = json.Unmarshal(body, &v); err != nil {
+		m.Field = "body"
+		m.Message = "body is not valid JSON"
+		return append(out, m)
+	}
+	c.validate(c.resolve(schema), v, "body", request, m, &out, 0)
+	return out
+}
+
+// coerceParameter converts a parameter's text to the type of its schema
+func coerceParameter(schema map[string]any, values []string) (any, error) {
+	if schemaTypes(schema)["array"] {
+		if len(values) == 1 && strings.Contains(values[0], ",") {
+			values = strings.Split(values[0], ",")
+		}
+		items, _ := schema["items"].(map[string]any)
+		out := make([]any, len(values))
+		for i, v := range values {
+			var err error
+			if out[i], err = coerceScalar(items, v); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	}
+	return coerceScalar(schema, values[0])
+}
+
+// parameterTypeError is a parameter which can't be read as its schema's type
+type parameterTypeError string
+
+func (e parameterTypeError) Error() string {
+	if e == "integer" {
+		return "must be an integer"
+	}
+	return "must be a " + string(e)
+}
+
+func coerceScalar(schema map[string]any, s string) (any, error) {
+	types := schemaTypes(schema)
+	switch {
+	case types["integer"] || types["number"]:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			if types["integer"] {
+				return nil, parameterTypeError("integer")
+			}
+			return nil, parameterTypeError("number")
+		}
+		return f, nil
+	case types["boolean"]:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, parameterTypeError("boolean")
+		}
+		return b, nil
+	}
+	return s, nil
+}
+
+// schemaTypes returns the types a schema allows, from a type string or, in OpenAPI 3.1, list
+func schemaTypes(schema map[string]any) map[string]bool {
+	types := make(map[string]bool)
+	switch t := schema["type"].(type) {
+	case string:
+		types[t] = true
+	case []any:
+		for _, e := range t {
+			if s, ok := e.(string); ok {
+				types[s] = true
+			}
+		}
+	}
+	return types
+}
+
+func jsonType(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	}
+	return "object"
+}
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// validate checks a value against a schema, adding a mismatch, based on m, for each problem.
+// Read-only properties aren't required in requests, nor write-only ones in responses.
+func (c *OpenAPIContract) validate(schema map[string]any, v any, field string, request bool, m ContractMismatch, out *[]ContractMismatch, depth int) {
+	if schema == nil || depth > 64 {
+		return
+	}
+	fail := func(rule, format string, args ...any) {
+		mm := m
+		if field != "" {
+			mm.Field = field
+		}
+		mm.Message = fmt.Sprintf(format, args...)
+		mm.Rule, mm.Params = rule, args
+		*out = append(*out, mm)
+	}
+
+	for _, key := range []string{"allOf", "anyOf", "oneOf"} {
+		list, _ := schema[key].([]any)
+		if len(list) == 0 {
+			continue
+		}
+		matches := 0
+		for _, sub := range list {
+			s, _ := sub.(map[string]any)
+			if key == "allOf" {
+				c.validate(c.resolve(s), v, field, request, m, out, depth+1)
+				continue
+			}
+			var probe []ContractMismatch
+			c.validate(c.resolve(s), v, field, request, m, &probe, depth+1)
+			if len(probe) == 0 {
+				matches++
+			}
+		}
+		switch {
+		case key == "anyOf" && matches == 0:
+			fail("anyOf", "doesn't match any of the allowed schemas")
+		case key == "oneOf" && matches != 1:
+			fail("oneOf", "matches %d of the schemas, not exactly one", matches)
+		}
+	}
+	if not, ok := schema["not"].(map[string]any); ok {
+		var probe []ContractMismatch
+		c.validate(c.resolve(not), v, field, request, m, &probe, depth+1)
+		if len(probe) == 0 {
+			fail("not", "matches a schema it must not")
+		}
+	}
+
+	types := schemaTypes(schema)
+	actual := jsonType(v)
+	if v == nil {
+		if nullable, _ := schema["nullable"].(bool); !nullable && len(types) > 0 && !types["null"] {
+			fail("null", "must not be null")
+		}
+		return
+	}
+	if len(types) > 0 && !types[actual] && !(actual == "integer" && types["number"]) {
+		names := make([]string, 0, len(types))
+		for t := range types {
+			names = append(names, t)
+		}
+		sort.Strings(names)
+		fail("type", "must be of type %s", strings.Join(names, " or "))
+		return
+	}
+
+	if enum, ok := schema["enum"].([]any); ok {
+		found := false
+		for _, e := range enum {
+			found = found || reflect.DeepEqual(e, v)
+		}
+		if !found {
+			fail("enum", "must be one of %v", enum)
+		}
+	}
+	if constant, ok := schema["const"]; ok && !reflect.DeepEqual(constant, v) {
+		fail("const", "must be %v", constant)
+	}
+
+	switch v := v.(type) {
+	case string:
+		n := float64(utf8.RuneCountInString(v))
+		if limit, ok := schema["minLength"].(float64); ok && n < limit {
+			fail("minLength", "must have at least %v characters", limit)
+		}
+		if limit, ok := schema["maxLength"].(float64); ok && n > limit {
+			fail("maxLength", "must have at most %v characters", limit)
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			if re := c.pattern(pattern); re != nil && !re.MatchString(v) {
+				fail("pattern", "must match %s", pattern)
+			}
+		}
+		if format, _ := schema["format"].(string); !validFormat(format, v) {
+			fail("format", "must be a valid %s", format)
+		}
+
+	case float64:
+		if limit, ok := schema["minimum"].(float64); ok {
+			if exclusive, _ := schema["exclusiveMinimum"].(bool); v < limit || exclusive && v == limit {
+				fail("minimum", "must be at least %v", limit)
+			}
+		}
+		if limit, ok := schema["maximum"].(float64); ok {
+			if exclusive, _ := schema["exclusiveMaximum"].(bool); v > limit || exclusive && v == limit {
+				fail("maximum", "must be at most %v", limit)
+			}
+		}
+		if limit, ok := schema["exclusiveMinimum"].(float64); ok && v <= limit {
+			fail("exclusiveMinimum", "must be more than %v", limit)
+		}
+		if limit, ok := schema["exclusiveMaximum"].(float64); ok && v >= limit {
+			fail("exclusiveMaximum", "must be less than %v", limit)
+		}
+		if step, ok := schema["multipleOf"].(float64); ok && step > 0 && math.Abs(math.Remainder(v, step)) > 1e-9 {
+			fail("multipleOf", "must be a multiple of %v", step)
+		}
+
+	case []any:
+		n := float64(len(v))
+		if limit, ok := schema["minItems"].(float64); ok && n < limit {
+			fail("minItems", "must have at least %v items", limit)
+		}
+		if limit, ok := schema["maxItems"].(float64); ok && n > limit {
+			fail("maxItems", "must have at most %v items", limit)
+		}
+		if unique, _ := schema["uniqueItems"].(bool); unique {
+		items:
+			for i := range v {
+				for j := 0; j < i; j++ {
+					if reflect.DeepEqual(v[i], v[j]) {
+						fail("uniqueItems", "items must be unique")
+						break items
+					}
+				}
+			}
+		}
+		if items, ok := schema["items"].(map[string]any); ok {
+			items = c.resolve(items)
+			for i, e := range v {
+				c.validate(items, e, joinField(field, strconv.Itoa(i)), request, m, out, depth+1)
+			}
+		}
+
+	case map[string]any:
+		properties, _ := schema["properties"].(map[string]any)
+		required, _ := schema["required"].([]any)
+		for _, r := range required {
+			name, _ := r.(string)
+			if _, ok := v[name]; ok {
+				continue
+			}
+			prop, _ := properties[name].(map[string]any)
+			prop = c.resolve(prop)
+			if readOnly, _ := prop["readOnly"].(bool); readOnly && request {
+				continue
+			}
+			if writeOnly, _ := prop["writeOnly"].(bool); writeOnly && !request {
+				continue
+			}
+			mm := m
+			mm.Field = joinField(field, name)
+			mm.Message, mm.Rule = "is required", "required"
+			*out = append(*out, mm)
+		}
+
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if prop, ok := properties[name].(map[string]any); ok {
+				c.validate(c.resolve(prop), v[name], joinField(field, name), request, m, out, depth+1)
+				continue
+			}
+			switch extra := schema["additionalProperties"].(type) {
+			case bool:
+				if !extra {
+					mm := m
+					mm.Field = joinField(field, name)
+					mm.Message, mm.Rule = "is not an allowed property", "additionalProperties"
+					*out = append(*out, mm)
+				}
+			case map[string]any:
+				c.validate(c.resolve(extra), v[name], joinField(field, name), request, m, out, depth+1)
+			}
+		}
+	}
+}
+
+func (c *OpenAPIContract) pattern(expr string) *regexp.Regexp {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if re, ok := c.patterns[expr]; ok {
+		return re
+	}
+	if c.patterns == nil {
+		c.patterns = make(map[string]*regexp.Regexp)
+	}
+	// patterns the regexp package can't compile are not checked
+	re, _ := regexp.Compile(expr)
+	c.patterns[expr] = re
+	return re
+}
+
+// validFormat checks the formats it knows, accepting any value of other formats
+func validFormat(format, v string) bool {
+	switch format {
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, v)
+		return err == nil
+	case "date":
+		_, err := time.Parse("2006-01-02", v)
+		return err == nil
+	case "email":
+		a, err := mail.ParseAddress(v)
+		return err == nil && a.Address == v
+	case "uuid":
+		return uuidPattern.MatchString(v)
+	case "uri":
+		u, err := url.Parse(v)
+		return err == nil && u.Scheme != ""
+	}
+	return true
+}
+
+// ContractVerifier checks live requests and responses against an OpenAPI contract, reporting
+// mismatches. Requests can also be enforced, but responses are only reported, as they have
+// been sent by the time they are checked.
+type ContractVerifier struct {
+	Contract *OpenAPIContract
+	// Report receives the mismatches of each request and its response, such as to log them
+	Report func(r *http.Request, mismatches []ContractMismatch)
+	// EnforceRequests answers requests which don't match the contract with a 400 listing
+	// the mismatches, instead of passing them on
+	EnforceRequests bool
+	// Localize translates the 400 answers of EnforceRequests into the language the request
+	// prefers, with LocalizeMismatches; Report still receives the English messages
+	Localize bool
+	// MaxBodySize is the size of request and response bodies checked; larger bodies are
+	// passed on unchecked. Defaults to 1MB
+	MaxBodySize int
+}
+
+// Middleware checks the requests to next, and next's responses
+func (cv *ContractVerifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := cv.MaxBodySize
+		if limit <= 0 {
+			limit = 1 << 20
+		}
+
+		// read the start of the body, then put it back in front of the rest
+		var body []byte
+		complete := true
+		if r.Body != nil {
+			body, _ = io.ReadAll(io.LimitReader(r.Body, int64(limit)+1))
+			complete = len(body) <= limit
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		}
+
+		var mismatches []ContractMismatch
+		if complete {
+			mismatches = cv.Contract.CheckRequest(r, body)
+		}
+		if len(mismatches) > 0 && cv.EnforceRequests {
+			cv.report(r, mismatches)
+			message := "request does not match the API contract"
+			if cv.Localize {
+				var lang string
+				mismatches, lang = LocalizeMismatches(r, mismatches)
+				if localized, ok := ValidationMessage(lang, "contract"); ok {
+					message = localized
+				}
+				w.Header().Set("Content-Language", lang)
+			}
+			var t Tools
+			_ = t.WriteJSON(w, http.StatusBadRequest, JSONResponse{Error: true, Message: message, Data: mismatches})
+			return
+		}
+
+		cw := &captureWriter{ResponseWriter: w, status: http.StatusOK, limit: limit}
+		next.ServeHTTP(cw, r)
+
+		var responseBody []byte
+		if !cw.truncated {
+			responseBody = cw.body.Bytes()
+		}
+		mismatches = append(mismatches, cv.Contract.CheckResponse(r, cw.status, w.Header(), responseBody)...)
+		cv.report(r, mismatches)
+	})
+}
+
+func (cv *ContractVerifier) report(r *http.Request, mismatches []ContractMismatch) {
+	if len(mismatches) > 0 && cv.Report != nil {
+		cv.Report(r, mismatches)
+	}
+}
+
+// ContractT is the part of testing.TB used by OpenAPIContract.TestHandler
+type ContractT interface {
+	Helper()
+	Errorf(format string, args ...any)
+}
+
+// TestHandler wraps a handler under test, failing the test for each request or response
+// which doesn't match the contract
+func (c *OpenAPIContract) TestHandler(t ContractT, next http.Handler) http.Handler {
+	cv := &ContractVerifier{Contract: c, Report: func(_ *http.Request, mismatches []ContractMismatch) {
+		t.Helper()
+		for _, m := range mismatches {
+			t.Errorf("contract mismatch: %s", m)
+		}
+	}}
+	return cv.Middleware(next)
+}
@@ -0,0 +1,244 @@
+package toolkit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testOpenAPI = `
+openapi: 3.0.3
+servers:
+  - url: https://api.example.com/v1
+paths:
+  /users:
+    get:
+      operationId: listUsers
+      parameters:
+        - name: limit
+          in: query
+          schema: {type: integer, minimum: 1, maximum: 100}
+        - name: tags
+          in: query
+          schema:
+            type: array
+            items: {type: string, enum: [admin, staff]}
+      responses:
+        "200":
+          description: OK
+          content:
+            application/json:
+              schema:
+                type: array
+                items: {$ref: "#/components/schemas/User"}
+    post:
+      operationId: createUser
+      parameters:
+        - $ref: "#/components/parameters/RequestID"
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema: {$ref: "#/components/schemas/User"}
+      responses:
+        "201":
+          description: Created
+          content:
+            application/json:
+              schema: {$ref: "#/components/schemas/User"}
+        4XX:
+          description: Invalid
+          content:
+            application/json:
+              schema: {type: object}
+  /users/{id}:
+    parameters:
+      - name: id
+        in: path
+        required: true
+        schema: {type: string, format: uuid}
+    get:
+      responses:
+        "200":
+          description: OK
+          content:
+            application/json:
+              schema: {$ref: "#/components/schemas/User"}
+    delete:
+      responses:
+        "204":
+          description: Deleted
+  /users/me:
+    get:
+      operationId: me
+      responses:
+        "200":
+          description: OK
+          content:
+            application/json:
+              schema: {$ref: "#/components/schemas/User"}
+components:
+  parameters:
+    RequestID:
+      name: X-Request-ID
+      in: header
+      required: true
+      schema: {type: string, minLength: 8}
+  schemas:
+    User:
+      type: object
+      required: [id, email, name]
+      additionalProperties: false
+      properties:
+        id: {type: string, format: uuid, readOnly: true}
+        email: {type: string, format: email}
+        name: {type: string, minLength: 1, maxLength: 20}
+        age: {type: integer, minimum: 0, nullable: true}
+        role:
+          oneOf:
+            - {type: string, enum: [admin, staff]}
+            - {type: "null"}
+        password: {type: string, writeOnly: true}
+`
+
+func TestOpenAPIContract_CheckRequest(t *testing.T) {
+	c, err := ParseOpenAPI([]byte(testOpenAPI))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		name     string
+		method   string
+		target   string
+		header   string
+		body     string
+		expected []string
+	}{
+		{"valid list", "GET", "/v1/users?limit=10&tags=admin,staff", "", "", nil},
+		{"bad limit", "GET", "/v1/users?limit=1000", "", "", []string{"query limit: must be at most 100"}},
+		{"limit not a number", "GET", "/v1/users?limit=ten", "", "", []string{"query limit: must be an integer"}},
+		{"bad tag", "GET", "/v1/users?tags=admin&tags=root", "", "", []string{"query tags.1: must be one of"}},
+		{"valid create", "POST", "/v1/users", "abcdefgh", `{"email": "a@example.com", "name": "Ann", "age": null, "password": "x"}`, nil},
+		{"missing header", "POST", "/v1/users", "", `{"email": "a@example.com", "name": "Ann"}`, []string{"header X-Request-ID: is required"}},
+		{"invalid body", "POST", "/v1/users", "abcdefgh", `{"email": "nope", "name": "", "age": 1.5, "extra": 1}`, []string{"body.age: must be of type integer", "body.email: must be a valid email", "body.extra: is not an allowed property", "body.name: must have at least 1 characters"}},
+		{"missing body", "POST", "/v1/users", "abcdefgh", "", []string{"request: body is required"}},
+		{"body not json", "POST", "/v1/users", "abcdefgh", "{", []string{"body: body is not valid JSON"}},
+		{"one of", "POST", "/v1/users", "abcdefgh", `{"email": "a@example.com", "name": "Ann", "role": "root"}`, []string{"body.role: matches 0 of the schemas"}},
+		{"path parameter", "GET", "/v1/users/not-a-uuid", "", "", []string{"path id: must be a valid uuid"}},
+		{"literal path wins", "GET", "/v1/users/me", "", "", nil},
+		{"undocumented method", "PATCH", "/v1/users", "", "", []string{"method is not documented"}},
+		{"undocumented path", "GET", "/v1/teams", "", "", []string{"path is not documented"}},
+		{"outside base path", "GET", "/users", "", "", []string{"outside the server's base path"}},
+	}
+
+	for _, e := range tests {
+		r := httptest.NewRequest(e.method, e.target, strings.NewReader(e.body))
+		r.Header.Set("Content-Type", "application/json")
+		if e.header != "" {
+			r.Header.Set("X-Request-ID", e.header)
+		}
+		got := c.CheckRequest(r, []byte(e.body))
+		if len(got) != len(e.expected) {
+			t.Errorf("%s: expected %d mismatches but got %v", e.name, len(e.expected), got)
+			continue
+		}
+		for i, m := range got {
+			if !strings.Contains(m.String(), e.expected[i]) {
+				t.Errorf("%s: expected %q, got %q", e.name, e.expected[i], m.String())
+			}
+		}
+	}
+
+	if _, err = ParseOpenAPI([]byte(`{"swagger": "2.0"}`)); err == nil {
+		t.Error("expected an error for a Swagger 2 document")
+	}
+}
+
+func TestContractVerifier_Middleware(t *testing.T) {
+	c, err := ParseOpenAPI([]byte(testOpenAPI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const id = "3f2504e0-4f89-41d3-9a0c-0305e82c3301"
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var tools Tools
+		switch {
+		case r.Method == http.MethodDelete:
+			w.WriteHeader(http.StatusAccepted)
+		case r.URL.Path == "/v1/users/"+id:
+			// the password is write-only, so it is not required, and the name is missing
+			_ = tools.WriteJSON(w, http.StatusOK, map[string]any{"id": id, "email": "a@example.com"})
+		default:
+			_ = tools.WriteJSON(w, http.StatusTeapot, map[string]any{"error": true})
+		}
+	})
+
+	var reported []ContractMismatch
+	cv := &ContractVerifier{Contract: c, Report: func(_ *http.Request, m []ContractMismatch) { reported = append(reported, m...) }}
+	h := cv.Middleware(handler)
+
+	var tests = []struct {
+		name     string
+		method   string
+		target   string
+		status   int
+		expected []string
+	}{
+		{"response missing a field", "GET", "/v1/users/" + id, http.StatusOK, []string{"response body.name: is required"}},
+		{"status in a range", "POST", "/v1/users", http.StatusTeapot, []string{"header X-Request-ID: is required", "request: body is required"}},
+		{"undocumented status", "DELETE", "/v1/users/" + id, http.StatusAccepted, []string{"response status: status 202 is not documented"}},
+	}
+
+	for _, e := range tests {
+		reported = nil
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(e.method, e.target, nil))
+		if rr.Code != e.status || len(reported) != len(e.expected) {
+			t.Errorf("%s: unexpected %d %v", e.name, rr.Code, reported)
+			continue
+		}
+		for i, m := range reported {
+			if !strings.Contains(m.String(), e.expected[i]) {
+				t.Errorf("%s: expected %q, got %q", e.name, e.expected[i], m.String())
+			}
+		}
+	}
+
+	// enforcing rejects invalid requests before the handler
+	cv.EnforceRequests = true
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("POST", "/v1/users", nil))
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "X-Request-ID") {
+		t.Errorf("expected a 400 listing the mismatches, got %d %s", rr.Code, rr.Body)
+	}
+}
+
+// contractT records the failures of a TestHandler
+type contractT struct{ errors []string }
+
+func (c *contractT) Helper() {}
+
+func (c *contractT) Errorf(format string, args ...any) { c.errors = append(c.errors, format) }
+
+func TestOpenAPIContract_TestHandler(t *testing.T) {
+	c, err := ParseOpenAPI([]byte(testOpenAPI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ct := &contractT{}
+	h := c.TestHandler(ct, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var tools Tools
+		_ = tools.WriteJSON(w, http.StatusOK, []any{})
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/v1/users", nil))
+	if len(ct.errors) != 0 {
+		t.Errorf("unexpected failures %v", ct.errors)
+	}
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/v1/nope", nil))
+	if len(ct.errors) != 2 {
+		t.Errorf("expected the request and response to fail, got %v", ct.errors)
+	}
+}
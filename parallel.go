@@ -0,0 +1,132 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// ItemError is the error of one item of ForEachN or MapN
+type ItemError struct {
+	Index int
+	Err   error
+}
+
+func (e ItemError) Error() string {
+	return fmt.Sprintf("item %d: %v", e.Index, e.Err)
+}
+
+func (e ItemError) Unwrap() error {
+	return e.Err
+}
+
+// ItemErrors are the errors of the items of ForEachN or MapN which failed, in item order.
+// errors.Is and errors.As look through each of them.
+type ItemErrors []ItemError
+
+func (e ItemErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	msgs := make([]string, 0, 3)
+	for i := 0; i < len(e) && i < 3; i++ {
+		msgs = append(msgs, e[i].Error())
+	}
+	if len(e) > 3 {
+		msgs = append(msgs, fmt.Sprintf("and %d more", len(e)-3))
+	}
+	return fmt.Sprintf("%d items failed: %s", len(e), strings.Join(msgs, "; "))
+}
+
+// Is reports whether any item's error is target
+func (e ItemErrors) Is(target error) bool {
+	for _, ie := range e {
+		if errors.Is(ie.Err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first item's error matching target
+func (e ItemErrors) As(target any) bool {
+	for _, ie := range e {
+		if errors.As(ie.Err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// ForEachN calls fn for each item, running at most n calls at once, or GOMAXPROCS if n isn't
+// positive. Every item is run even if some fail, and their errors are returned together as
+// ItemErrors. Once ctx ends no more items are started, and the first item not run is reported
+// with ctx's error; calls already running are left to notice ctx themselves.
+func ForEachN[T any](ctx context.Context, n int, items []T, fn func(ctx context.Context, item T) error) error {
+	_, err := MapN(ctx, n, items, func(ctx context.Context, item T) (struct{}, error) {
+		return struct{}{}, fn(ctx, item)
+	})
+	return err
+}
+
+// MapN calls fn for each item as ForEachN does, returning its results in item order. The
+// results of items which failed, or weren't run, are zero.
+func MapN[T, R any](ctx context.Context, n int, items []T, fn func(ctx context.Context, item T) (R, error)) ([]R, error) {
+	if n <= 0 {
+		n = runtime.GOMAXPROCS(0)
+	}
+	if n > len(items) {
+		n = len(items)
+	}
+
+	results := make([]R, len(items))
+	errs := make([]error, len(items))
+	var (
+		mu      sync.Mutex
+		next    int
+		skipped = -1
+	)
+	// take returns the index of the next item to run, or false when there are none left
+	take := func() (int, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		if next == len(items) {
+			return 0, false
+		}
+		if ctx.Err() != nil {
+			skipped, next = next, len(items)
+			return 0, false
+		}
+		next++
+		return next - 1, true
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i, ok := take(); ok; i, ok = take() {
+				results[i], errs[i] = fn(ctx, items[i])
+			}
+		}()
+	}
+	wg.Wait()
+
+	var failed ItemErrors
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, ItemError{Index: i, Err: err})
+		}
+	}
+	if skipped >= 0 {
+		failed = append(failed, ItemError{Index: skipped, Err: ctx.Err()})
+	}
+	if failed != nil {
+		return results, failed
+	}
+	return results, nil
+}
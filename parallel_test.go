@@ -0,0 +1,89 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMapN(t *testing.T) {
+	items := []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	var running, peak int32
+	results, err := MapN(context.Background(), 3, items, func(ctx context.Context, n int) (string, error) {
+		now := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if now <= p || atomic.CompareAndSwapInt32(&peak, p, now) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		return fmt.Sprint(n * n), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if peak > 3 {
+		t.Errorf("expected at most 3 calls at once, got %d", peak)
+	}
+	for i, n := range items {
+		if results[i] != fmt.Sprint(n*n) {
+			t.Errorf("expected results in item order, got %v", results)
+			break
+		}
+	}
+}
+
+func TestForEachN_Errors(t *testing.T) {
+	errOdd := errors.New("odd")
+	var calls int32
+	err := ForEachN(context.Background(), 0, []int{1, 2, 3, 4, 5}, func(ctx context.Context, n int) error {
+		atomic.AddInt32(&calls, 1)
+		if n%2 == 1 {
+			return fmt.Errorf("%d: %w", n, errOdd)
+		}
+		return nil
+	})
+	if calls != 5 {
+		t.Errorf("expected every item to run, got %d", calls)
+	}
+	var failed ItemErrors
+	if !errors.As(err, &failed) || len(failed) != 3 {
+		t.Fatalf("expected 3 item errors, got %v", err)
+	}
+	if failed[0].Index != 0 || failed[1].Index != 2 || failed[2].Index != 4 {
+		t.Errorf("expected errors in item order, got %v", failed)
+	}
+	if !errors.Is(err, errOdd) {
+		t.Error("expected errors.Is to find the items' error")
+	}
+	if want := "3 items failed: item 0: 1: odd; item 2: 3: odd; item 4: 5: odd"; err.Error() != want {
+		t.Errorf("expected %q, got %q", want, err.Error())
+	}
+}
+
+func TestForEachN_Context(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var calls int32
+	err := ForEachN(ctx, 1, make([]int, 10), func(ctx context.Context, _ int) error {
+		if atomic.AddInt32(&calls, 1) == 3 {
+			cancel()
+		}
+		return nil
+	})
+	if calls != 3 {
+		t.Errorf("expected no items to start after the context ended, got %d calls", calls)
+	}
+	var failed ItemErrors
+	if !errors.Is(err, context.Canceled) || !errors.As(err, &failed) || failed[0].Index != 3 {
+		t.Errorf("expected the first item not run to be reported, got %v", err)
+	}
+
+	if err := ForEachN(context.Background(), 4, []int(nil), func(context.Context, int) error { return nil }); err != nil {
+		t.Errorf("expected no error for no items, got %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+package toolkit
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrPasswordMismatch is returned by CheckPassword when the password is wrong
+var ErrPasswordMismatch = errors.New("password does not match")
+
+// PasswordIterations is the PBKDF2 iteration count of new hashes, as recommended by OWASP for
+// PBKDF2-HMAC-SHA256. Hashes record their count, so raising it doesn't invalidate old ones.
+var PasswordIterations = 600000
+
+// HashPassword hashes a password with PBKDF2-HMAC-SHA256 and a random salt, returning a string
+// of the form pbkdf2-sha256$iterations$salt$hash for storing
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := pbkdf2SHA256([]byte(password), salt, PasswordIterations, 32)
+	return fmt.Sprintf("pbkdf2-sha256$%d$%s$%s", PasswordIterations,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// CheckPassword checks a password against a hash from HashPassword, returning
+// ErrPasswordMismatch if it is wrong
+func CheckPassword(hash, password string) error {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != "pbkdf2-sha256" {
+		return errors.New("unrecognized password hash")
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations < 1 {
+		return errors.New("invalid password hash iterations")
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return err
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil || len(want) == 0 {
+		return errors.New("invalid password hash")
+	}
+
+	got := pbkdf2SHA256([]byte(password), salt, iterations, len(want))
+	if subtle.ConstantTimeCompare(got, want) != 1 {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
+
+// pbkdf2SHA256 derives a key as in RFC 8018, section 5.2
+func pbkdf2SHA256(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	var key []byte
+	for block := uint32(1); len(key) < keyLen; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write([]byte{byte(block >> 24), byte(block >> 16), byte(block >> 8), byte(block)})
+		u := prf.Sum(nil)
+		t := append([]byte(nil), u...)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
@@ -0,0 +1,58 @@
+package toolkit
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func TestPBKDF2SHA256(t *testing.T) {
+	// test vectors from RFC 7914, section 11
+	var tests = []struct {
+		password, salt string
+		iterations     int
+		want           string
+	}{
+		{"passwd", "salt", 1, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"},
+		{"Password", "NaCl", 80000, "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56a1d425a1225833549adb841b51c9b3176a272bdebba1d078478f62b397f33c8d"},
+	}
+
+	for _, e := range tests {
+		got := hex.EncodeToString(pbkdf2SHA256([]byte(e.password), []byte(e.salt), e.iterations, 64))
+		if got != e.want {
+			t.Errorf("%s: expected %s but got %s", e.password, e.want, got)
+		}
+	}
+}
+
+func TestHashPassword(t *testing.T) {
+	old := PasswordIterations
+	PasswordIterations = 1000
+	t.Cleanup(func() { PasswordIterations = old })
+
+	hash, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _ := HashPassword("correct horse")
+	if hash == again {
+		t.Error("expected hashes of the same password to be salted differently")
+	}
+
+	var tests = []struct {
+		name     string
+		hash     string
+		password string
+		err      error
+	}{
+		{"correct", hash, "correct horse", nil},
+		{"wrong", hash, "battery staple", ErrPasswordMismatch},
+		{"not a hash", "plain", "correct horse", errors.New("unrecognized password hash")},
+	}
+	for _, e := range tests {
+		err := CheckPassword(e.hash, e.password)
+		if (err == nil) != (e.err == nil) || (err != nil && err.Error() != e.err.Error()) {
+			t.Errorf("%s: expected %v but got %v", e.name, e.err, err)
+		}
+	}
+}
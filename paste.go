@@ -0,0 +1,254 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Paste is a shared text snippet
+type Paste struct {
+	ID     string `json:"id"`
+	Text   string `json:"text,omitempty"`
+	Syntax string `json:"syntax,omitempty"`
+	// BurnAfterRead deletes the paste the first time it is read
+	BurnAfterRead bool      `json:"burn_after_read"`
+	CreatedAt     time.Time `json:"created_at"`
+	ExpiresAt     time.Time `json:"expires_at"`
+	// URL is the signed link to the paste, which is only set when it is created
+	URL string `json:"url,omitempty"`
+}
+
+// PasteRequest is the body of a request to create a paste
+type PasteRequest struct {
+	Text          string `json:"text"`
+	Syntax        string `json:"syntax"`
+	TTL           int    `json:"ttl"` // seconds
+	BurnAfterRead bool   `json:"burn_after_read"`
+}
+
+var (
+	pasteID     = regexp.MustCompile(`^[a-f0-9]{32}$`)
+	pasteSyntax = regexp.MustCompile(`^[a-z0-9+#-]{0,32}$`)
+)
+
+// Pastebin stores text snippets in a Storage, each readable through a signed link until it
+// expires, or only once if it burns after reading
+type Pastebin struct {
+	Storage Storage
+	// Signer signs the links to pastes
+	Signer *URLSigner
+	// BaseURL is the URL the handler is mounted at, e.g. "https://example.com/paste"
+	BaseURL string
+	// Prefix is prepended to storage keys. Defaults to "pastes/"
+	Prefix string
+	// MaxSize is the largest paste accepted, in bytes. Defaults to 512KB
+	MaxSize int
+	// DefaultTTL is how long pastes last if the request doesn't say. Defaults to 24 hours
+	DefaultTTL time.Duration
+	// MaxTTL is the longest a paste can last. Defaults to 30 days
+	MaxTTL time.Duration
+
+	// burning serialises reads of burn-after-read pastes, so only one reader gets each. It
+	// only protects a single instance.
+	burning sync.Mutex
+}
+
+func (p *Pastebin) prefix() string {
+	if p.Prefix != "" {
+		return p.Prefix
+	}
+	return "pastes/"
+}
+
+func (p *Pastebin) maxSize() int {
+	if p.MaxSize > 0 {
+		return p.MaxSize
+	}
+	return 512 * 1024
+}
+
+// Create stores a paste and returns it with its signed URL
+func (p *Pastebin) Create(ctx context.Context, req PasteRequest) (Paste, error) {
+	if p.Storage == nil || p.Signer == nil {
+		return Paste{}, errors.New("pastebin needs storage and a signer")
+	}
+	if req.Text == "" {
+		return Paste{}, errors.New("paste must not be empty")
+	}
+	if len(req.Text) > p.maxSize() {
+		return Paste{}, fmt.Errorf("paste must not be larger than %d bytes", p.maxSize())
+	}
+	if !pasteSyntax.MatchString(req.Syntax) {
+		return Paste{}, errors.New("invalid syntax name")
+	}
+
+	ttl := time.Duration(req.TTL) * time.Second
+	if ttl <= 0 {
+		ttl = p.DefaultTTL
+		if ttl <= 0 {
+			ttl = 24 * time.Hour
+		}
+	}
+	maxTTL := p.MaxTTL
+	if maxTTL <= 0 {
+		maxTTL = 30 * 24 * time.Hour
+	}
+	if ttl > maxTTL {
+		ttl = maxTTL
+	}
+
+	id, err := randomHex(16)
+	if err != nil {
+		return Paste{}, err
+	}
+
+	now := time.Now()
+	paste := Paste{
+		ID:            id,
+		Text:          req.Text,
+		Syntax:        req.Syntax,
+		BurnAfterRead: req.BurnAfterRead,
+		CreatedAt:     now,
+		ExpiresAt:     now.Add(ttl),
+	}
+
+	stored, err := json.Marshal(paste)
+	if err != nil {
+		return Paste{}, err
+	}
+	if err = p.Storage.Put(ctx, p.prefix()+id, bytes.NewReader(stored)); err != nil {
+		return Paste{}, err
+	}
+
+	paste.URL, err = p.Signer.Sign(strings.TrimSuffix(p.BaseURL, "/")+"/"+id, paste.ExpiresAt)
+	if err != nil {
+		return Paste{}, err
+	}
+	return paste, nil
+}
+
+// Read returns a paste, and deletes it if it burns after reading. Expired pastes are deleted
+// and reported as ErrNotFound.
+func (p *Pastebin) Read(ctx context.Context, id string) (Paste, error) {
+	paste, err := p.load(ctx, id)
+	if err != nil {
+		return Paste{}, err
+	}
+	if !paste.BurnAfterRead {
+		return paste, nil
+	}
+
+	p.burning.Lock()
+	defer p.burning.Unlock()
+
+	// load again now that no one else can be reading it
+	if paste, err = p.load(ctx, id); err != nil {
+		return Paste{}, err
+	}
+	if err = p.Storage.Delete(ctx, p.prefix()+id); err != nil {
+		return Paste{}, err
+	}
+	return paste, nil
+}
+
+func (p *Pastebin) load(ctx context.Context, id string) (Paste, error) {
+	if !pasteID.MatchString(id) {
+		return Paste{}, ErrNotFound
+	}
+
+	rc, err := p.Storage.Get(ctx, p.prefix()+id)
+	if err != nil {
+		return Paste{}, err
+	}
+	defer rc.Close()
+
+	var paste Paste
+	if err = json.NewDecoder(rc).Decode(&paste); err != nil {
+		return Paste{}, err
+	}
+	if time.Now().After(paste.ExpiresAt) {
+		_ = p.Storage.Delete(ctx, p.prefix()+id)
+		return Paste{}, ErrNotFound
+	}
+	return paste, nil
+}
+
+// Sweep deletes expired pastes. Expired pastes are never served, but are only removed from
+// storage when read or swept.
+func (p *Pastebin) Sweep(ctx context.Context) error {
+	objects, err := p.Storage.List(ctx, p.prefix())
+	if err != nil {
+		return err
+	}
+	for _, obj := range objects {
+		// load deletes the paste if it has expired
+		if _, err = p.load(ctx, strings.TrimPrefix(obj.Key, p.prefix())); err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Handler serves the pastebin: POST / creates a paste from a PasteRequest and responds with
+// it and its signed URL, and GET /<id> on a signed URL returns the paste as JSON, or as plain
+// text if the request accepts text/plain. Mount it at BaseURL, e.g.
+// mux.Handle("/paste/", http.StripPrefix("/paste", p.Handler())).
+func (p *Pastebin) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t := Tools{MaxFileSize: p.maxSize() + 4096}
+		id := strings.Trim(r.URL.Path, "/")
+
+		switch {
+		case r.Method == http.MethodPost && id == "":
+			var req PasteRequest
+			if err := t.ReadJSON(w, r, &req); err != nil {
+				_ = t.ErrorJSON(w, err)
+				return
+			}
+			paste, err := p.Create(r.Context(), req)
+			if err != nil {
+				_ = t.ErrorJSON(w, err)
+				return
+			}
+			_ = t.WriteJSON(w, http.StatusCreated, paste)
+
+		case r.Method == http.MethodGet && id != "":
+			// the signature covers the full path the client requested
+			if err := p.Signer.Verify(requestURL(r)); err != nil {
+				_ = t.ErrorJSON(w, err, http.StatusForbidden)
+				return
+			}
+
+			paste, err := p.Read(r.Context(), id)
+			if errors.Is(err, ErrNotFound) {
+				_ = t.ErrorJSON(w, err, http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				_ = t.ErrorJSON(w, err, http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Cache-Control", "no-store")
+			if strings.HasPrefix(r.Header.Get("Accept"), "text/plain") {
+				w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+				w.Header().Set("X-Content-Type-Options", "nosniff")
+				_, _ = w.Write([]byte(paste.Text))
+				return
+			}
+			_ = t.WriteJSON(w, http.StatusOK, paste)
+
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			_ = t.ErrorJSON(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		}
+	})
+}
@@ -0,0 +1,89 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPastebin(t *testing.T) {
+	dir, err := os.MkdirTemp("", "paste")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	p := &Pastebin{
+		Storage: &FileStorage{Dir: dir},
+		Signer:  &URLSigner{Key: []byte("0123456789abcdef0123456789abcdef")},
+		BaseURL: srv.URL + "/paste",
+	}
+	mux.Handle("/paste/", http.StripPrefix("/paste", p.Handler()))
+
+	create := func(body string) (int, Paste) {
+		res, err := http.Post(srv.URL+"/paste/", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		var paste Paste
+		_ = json.NewDecoder(res.Body).Decode(&paste)
+		return res.StatusCode, paste
+	}
+	read := func(u, accept string) (int, string) {
+		req, _ := http.NewRequest(http.MethodGet, u, nil)
+		req.Header.Set("Accept", accept)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		var buf bytes.Buffer
+		_, _ = buf.ReadFrom(res.Body)
+		return res.StatusCode, buf.String()
+	}
+
+	status, paste := create(`{"text":"fmt.Println(1)","syntax":"go","ttl":60}`)
+	if status != http.StatusCreated || paste.URL == "" {
+		t.Fatalf("unexpected create: %d %+v", status, paste)
+	}
+	if d := time.Until(paste.ExpiresAt); d > time.Minute || d < 50*time.Second {
+		t.Errorf("unexpected expiry %v", paste.ExpiresAt)
+	}
+
+	for i := 0; i < 2; i++ {
+		if status, body := read(paste.URL, "text/plain"); status != http.StatusOK || body != "fmt.Println(1)" {
+			t.Errorf("read %d: unexpected %d %q", i, status, body)
+		}
+	}
+	if status, body := read(paste.URL, "application/json"); status != http.StatusOK || !strings.Contains(body, `"syntax":"go"`) {
+		t.Errorf("unexpected json read %d %s", status, body)
+	}
+	if status, _ := read(strings.Replace(paste.URL, paste.ID, strings.Repeat("0", 32), 1), ""); status != http.StatusForbidden {
+		t.Errorf("expected unsigned id to be refused, got %d", status)
+	}
+
+	_, burn := create(`{"text":"secret","burn_after_read":true}`)
+	if status, _ := read(burn.URL, "text/plain"); status != http.StatusOK {
+		t.Errorf("expected first read to succeed, got %d", status)
+	}
+	if status, _ := read(burn.URL, "text/plain"); status != http.StatusNotFound {
+		t.Errorf("expected burned paste to be gone, got %d", status)
+	}
+
+	if status, _ := create(`{"text":"x","syntax":"<script>"}`); status != http.StatusBadRequest {
+		t.Errorf("expected bad syntax name to be refused, got %d", status)
+	}
+	if status, _ := create(`{"text":""}`); status != http.StatusBadRequest {
+		t.Errorf("expected empty paste to be refused, got %d", status)
+	}
+}
@@ -0,0 +1,133 @@
+package toolkit
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// TrailingSlash is what PathNormalizer does with a slash at the end of a path
+type TrailingSlash int
+
+// The trailing slash policies
+const (
+	// KeepTrailingSlash leaves paths as they are, the default
+	KeepTrailingSlash TrailingSlash = iota
+	// StripTrailingSlash removes the slash, so /users/ becomes /users
+	StripTrailingSlash
+	// AddTrailingSlash adds one, so /users becomes /users/
+	AddTrailingSlash
+)
+
+// PathNormalizer gives request paths a canonical form, so route matching and signed URL
+// verification see the same path whichever proxy rewrote it on the way. It:
+//
+//   - collapses duplicate slashes, so /a//b becomes /a/b
+//   - resolves dot segments, so /a/./b/../c becomes /a/c
+//   - normalizes percent-encoding, writing escapes in upper case and decoding those of
+//     letters, digits, hyphens, periods, underscores and tildes, so /%7euser/a%2fb becomes
+//     /~user/a%2Fb; an escaped slash stays escaped, as it's part of a segment
+//   - applies its TrailingSlash policy to paths other than /
+//
+// Requests with other paths are rewritten in place, or redirected if Redirect is set.
+type PathNormalizer struct {
+	TrailingSlash TrailingSlash
+	// Redirect answers requests whose paths aren't canonical with a redirect to the canonical
+	// path: a 301 for GET and HEAD, and a 308, which keeps the method and body, otherwise
+	Redirect bool
+}
+
+// Middleware normalizes the paths of requests to next
+func (pn *PathNormalizer) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		escaped := r.URL.EscapedPath()
+		normalized := NormalizePath(escaped, pn.TrailingSlash)
+		if normalized == escaped {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if pn.Redirect {
+			target := normalized
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			status := http.StatusPermanentRedirect
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				status = http.StatusMovedPermanently
+			}
+			http.Redirect(w, r, target, status)
+			return
+		}
+
+		r2 := r.Clone(r.Context())
+		r2.URL.Path, _ = url.PathUnescape(normalized)
+		r2.URL.RawPath = normalized
+		next.ServeHTTP(w, r2)
+	})
+}
+
+// NormalizePath returns the canonical form of an escaped URL path, as PathNormalizer
+// describes
+func NormalizePath(escaped string, trailing TrailingSlash) string {
+	if escaped == "" {
+		escaped = "/"
+	}
+	p := path.Clean(normalizePercentEncoding(escaped))
+	if p == "/" || p == "." {
+		return "/"
+	}
+	switch {
+	case trailing == AddTrailingSlash,
+		trailing == KeepTrailingSlash && strings.HasSuffix(escaped, "/"):
+		p += "/"
+	}
+	return p
+}
+
+// normalizePercentEncoding decodes the escapes of unreserved characters, which mean the same
+// escaped or not, and writes the others in upper case, as RFC 3986 section 6.2.2 recommends
+func normalizePercentEncoding(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' || i+2 >= len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		hi, lo := unhex(s[i+1]), unhex(s[i+2])
+		if hi < 0 || lo < 0 {
+			b.WriteByte(s[i])
+			continue
+		}
+		c := byte(hi<<4 | lo)
+		if isUnreserved(c) {
+			b.WriteByte(c)
+		} else {
+			b.WriteString("%" + strings.ToUpper(s[i+1:i+3]))
+		}
+		i += 2
+	}
+	return b.String()
+}
+
+func unhex(c byte) int {
+	switch {
+	case '0' <= c && c <= '9':
+		return int(c - '0')
+	case 'a' <= c && c <= 'f':
+		return int(c - 'a' + 10)
+	case 'A' <= c && c <= 'F':
+		return int(c - 'A' + 10)
+	}
+	return -1
+}
+
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
@@ -0,0 +1,65 @@
+package toolkit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNormalizePath(t *testing.T) {
+	var tests = []struct {
+		in       string
+		trailing TrailingSlash
+		want     string
+	}{
+		{in: "/a//b", want: "/a/b"},
+		{in: "/a/./b/../c", want: "/a/c"},
+		{in: "/../../etc", want: "/etc"},
+		{in: "/%7euser/a%2fb", want: "/~user/a%2Fb"},
+		{in: "/%2e%2e/secret", want: "/secret"},
+		{in: "/caf%c3%a9", want: "/caf%C3%A9"},
+		{in: "/100%", want: "/100%"},
+		{in: "/users/", want: "/users/"},
+		{in: "/users/", trailing: StripTrailingSlash, want: "/users"},
+		{in: "/users", trailing: AddTrailingSlash, want: "/users/"},
+		{in: "//", trailing: StripTrailingSlash, want: "/"},
+		{in: "", want: "/"},
+	}
+	for _, e := range tests {
+		if got := NormalizePath(e.in, e.trailing); got != e.want {
+			t.Errorf("NormalizePath(%q, %d): expected %q, got %q", e.in, e.trailing, e.want, got)
+		}
+	}
+}
+
+func TestPathNormalizer(t *testing.T) {
+	var seen string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.URL.Path + " " + r.URL.EscapedPath()
+	})
+
+	pn := &PathNormalizer{TrailingSlash: StripTrailingSlash}
+	rr := httptest.NewRecorder()
+	pn.Middleware(next).ServeHTTP(rr, httptest.NewRequest("GET", "/files//a%2fb/", nil))
+	if seen != "/files/a/b /files/a%2Fb" {
+		t.Errorf("unexpected rewritten path %q", seen)
+	}
+
+	pn.Redirect = true
+	var tests = []struct {
+		method, target string
+		status         int
+		location       string
+	}{
+		{method: "GET", target: "/users//42/?tab=posts", status: http.StatusMovedPermanently, location: "/users/42?tab=posts"},
+		{method: "POST", target: "/users/", status: http.StatusPermanentRedirect, location: "/users"},
+		{method: "GET", target: "/users/42", status: http.StatusOK},
+	}
+	for _, e := range tests {
+		rr := httptest.NewRecorder()
+		pn.Middleware(next).ServeHTTP(rr, httptest.NewRequest(e.method, e.target, nil))
+		if rr.Code != e.status || rr.Header().Get("Location") != e.location {
+			t.Errorf("%s %s: expected %d %q, got %d %q", e.method, e.target, e.status, e.location, rr.Code, rr.Header().Get("Location"))
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package toolkit
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"math/bits"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ImageHash is a 64 bit perceptual hash of an image. Images which look alike have hashes which
+// differ in few bits, even when resized, recompressed or slightly edited, unlike checksums.
+type ImageHash uint64
+
+// Distance returns the number of bits two hashes differ in: 0 for the same picture, and
+// usually no more than 10 for near duplicates
+func (h ImageHash) Distance(other ImageHash) int {
+	return bits.OnesCount64(uint64(h ^ other))
+}
+
+// String returns the hash as 16 hex digits
+func (h ImageHash) String() string {
+	return fmt.Sprintf("%016x", uint64(h))
+}
+
+// ParseImageHash parses a hash formatted by String
+func ParseImageHash(s string) (ImageHash, error) {
+	n, err := strconv.ParseUint(s, 16, 64)
+	return ImageHash(n), err
+}
+
+// grayscale returns the luminance of img scaled to width x height
+func grayscale(img image.Image, width, height int) []float64 {
+	small := ResizeImage(img, width, height)
+	gray := make([]float64, width*height)
+	for i := range gray {
+		p := small.Pix[i*4 : i*4+4]
+		gray[i] = 0.299*float64(p[0]) + 0.587*float64(p[1]) + 0.114*float64(p[2])
+	}
+	return gray
+}
+
+// DHash returns the difference hash of img, which compares the brightness of neighbouring
+// pixels. It is quick and good at finding resized copies.
+func DHash(img image.Image) ImageHash {
+	gray := grayscale(img, 9, 8)
+
+	var h ImageHash
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			h <<= 1
+			if gray[y*9+x] < gray[y*9+x+1] {
+				h |= 1
+			}
+		}
+	}
+	return h
+}
+
+// dctCos holds cos((2x+1)uπ/64), for a 32 point DCT
+var dctCos = func() [32][32]float64 {
+	var c [32][32]float64
+	for u := 0; u < 32; u++ {
+		for x := 0; x < 32; x++ {
+			c[u][x] = math.Cos(float64(2*x+1) * float64(u) * math.Pi / 64)
+		}
+	}
+	return c
+}()
+
+// PHash returns the DCT hash of img, which compares the low frequencies of the image with
+// their median. It is slower than DHash, but better at finding recompressed and edited copies.
+func PHash(img image.Image) ImageHash {
+	gray := grayscale(img, 32, 32)
+
+	// the 8x8 lowest frequencies of a 2D DCT, one dimension at a time
+	var rows [32][8]float64
+	for y := 0; y < 32; y++ {
+		for u := 0; u < 8; u++ {
+			var sum float64
+			for x := 0; x < 32; x++ {
+				sum += gray[y*32+x] * dctCos[u][x]
+			}
+			rows[y][u] = sum
+		}
+	}
+	var freq [64]float64
+	for v := 0; v < 8; v++ {
+		for u := 0; u < 8; u++ {
+			var sum float64
+			for y := 0; y < 32; y++ {
+				sum += rows[y][u] * dctCos[v][y]
+			}
+			freq[v*8+u] = sum
+		}
+	}
+
+	sorted := freq
+	sort.Float64s(sorted[:])
+	median := (sorted[31] + sorted[32]) / 2
+
+	var h ImageHash
+	for _, f := range freq {
+		h <<= 1
+		if f > median {
+			h |= 1
+		}
+	}
+	return h
+}
+
+// ImageMatch is an image found to be similar to another
+type ImageMatch struct {
+	ID       string `json:"id"`
+	Distance int    `json:"distance"`
+}
+
+// ImageHashIndex holds the perceptual hashes of images for finding near duplicates, such as a
+// screenshot uploaded again. Set it on Tools or Ingest, and uploaded images are hashed and
+// added, with the near duplicates already in it listed in their records' NearDuplicates.
+// Lookups compare every hash, which takes around a millisecond per hundred thousand images.
+type ImageHashIndex struct {
+	// MaxDistance is the most bits the hashes of near duplicates differ in. Defaults to 10
+	MaxDistance int
+	// MaxPixels is the largest image hashed. Defaults to DefaultMaxPixels
+	MaxPixels int
+
+	mu     sync.RWMutex
+	hashes map[string]ImageHash
+}
+
+// Add adds an image's hash, replacing any with the same ID
+func (ix *ImageHashIndex) Add(id string, h ImageHash) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	if ix.hashes == nil {
+		ix.hashes = make(map[string]ImageHash)
+	}
+	ix.hashes[id] = h
+}
+
+// Remove removes an image
+func (ix *ImageHashIndex) Remove(id string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	delete(ix.hashes, id)
+}
+
+// Len returns the number of images in the index
+func (ix *ImageHashIndex) Len() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	return len(ix.hashes)
+}
+
+// Similar returns the images whose hashes are within maxDistance of h, closest first. A
+// maxDistance of 0 means MaxDistance.
+func (ix *ImageHashIndex) Similar(h ImageHash, maxDistance int) []ImageMatch {
+	if maxDistance <= 0 {
+		maxDistance = ix.MaxDistance
+		if maxDistance <= 0 {
+			maxDistance = 10
+		}
+	}
+
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	var matches []ImageMatch
+	for id, other := range ix.hashes {
+		if d := h.Distance(other); d <= maxDistance {
+			matches = append(matches, ImageMatch{ID: id, Distance: d})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Distance != matches[j].Distance {
+			return matches[i].Distance < matches[j].Distance
+		}
+		return matches[i].ID < matches[j].ID
+	})
+	return matches
+}
+
+// AddImage decodes and hashes an image, adds it under id, and returns the near duplicates
+// which were already in the index
+func (ix *ImageHashIndex) AddImage(id string, r io.Reader) ([]ImageMatch, error) {
+	img, _, err := DecodeImage(r, ix.MaxPixels)
+	if err != nil {
+		return nil, err
+	}
+	h := PHash(img)
+
+	var matches []ImageMatch
+	for _, m := range ix.Similar(h, 0) {
+		if m.ID != id {
+			matches = append(matches, m)
+		}
+	}
+	ix.Add(id, h)
+	return matches, nil
+}
+
+// check adds an uploaded image to the index and returns the IDs of its near duplicates. Other
+// files, and images which can't be decoded, are skipped.
+func (ix *ImageHashIndex) check(id, contentType string, r io.Reader) []string {
+	if !strings.HasPrefix(contentType, "image/") {
+		return nil
+	}
+	matches, err := ix.AddImage(id, r)
+	if err != nil || len(matches) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(matches))
+	for _, m := range matches {
+		ids = append(ids, m.ID)
+	}
+	return ids
+}
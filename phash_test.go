@@ -0,0 +1,158 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// sceneImage draws a gradient with a bright disc, at any size, so scaled copies look alike.
+// flip mirrors the scene, for an image which looks different.
+func sceneImage(w, h int, flip bool) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			fx, fy := float64(x)/float64(w), float64(y)/float64(h)
+			if flip {
+				fx, fy = 1-fx, 1-fy
+			}
+			v := uint8(200 * fx * fy)
+			if dx, dy := fx-0.3, fy-0.6; dx*dx+dy*dy < 0.04 {
+				v = 250
+			}
+			img.Set(x, y, color.RGBA{R: v, G: v / 2, B: 255 - v, A: 255})
+		}
+	}
+	return img
+}
+
+func TestImageHash(t *testing.T) {
+	original := sceneImage(400, 300, false)
+	resized := ResizeImage(original, 160, 120)
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, original, &jpeg.Options{Quality: 30}); err != nil {
+		t.Fatal(err)
+	}
+	recompressed, _ := jpeg.Decode(&buf)
+	different := sceneImage(400, 300, true)
+
+	for name, hash := range map[string]func(image.Image) ImageHash{"dhash": DHash, "phash": PHash} {
+		h := hash(original)
+		if d := h.Distance(hash(original)); d != 0 {
+			t.Errorf("%s: expected the same image to hash the same, distance %d", name, d)
+		}
+		if d := h.Distance(hash(resized)); d > 6 {
+			t.Errorf("%s: expected a resized copy to be close, distance %d", name, d)
+		}
+		if d := h.Distance(hash(recompressed)); d > 6 {
+			t.Errorf("%s: expected a recompressed copy to be close, distance %d", name, d)
+		}
+		if d := h.Distance(hash(different)); d < 20 {
+			t.Errorf("%s: expected a different image to be far, distance %d", name, d)
+		}
+	}
+}
+
+func TestParseImageHash(t *testing.T) {
+	h := PHash(sceneImage(64, 64, false))
+	parsed, err := ParseImageHash(h.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed != h || len(h.String()) != 16 {
+		t.Errorf("expected %s but got %s", h, parsed)
+	}
+	if _, err = ParseImageHash("not hex"); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestImageHashIndex_Similar(t *testing.T) {
+	var ix ImageHashIndex
+	ix.Add("a", 0x0f)
+	ix.Add("b", 0x0e)
+	ix.Add("c", 0xf0f0)
+	ix.Add("d", 0x00)
+
+	var tests = []struct {
+		hash        ImageHash
+		maxDistance int
+		exp         []ImageMatch
+	}{
+		{0x0f, 1, []ImageMatch{{"a", 0}, {"b", 1}}},
+		{0x0f, 4, []ImageMatch{{"a", 0}, {"b", 1}, {"d", 4}}},
+		{0xffff0000, 2, nil},
+	}
+
+	for _, e := range tests {
+		got := ix.Similar(e.hash, e.maxDistance)
+		if len(got) != len(e.exp) {
+			t.Errorf("%s: expected %v but got %v", e.hash, e.exp, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != e.exp[i] {
+				t.Errorf("%s: expected %v but got %v", e.hash, e.exp, got)
+				break
+			}
+		}
+	}
+
+	ix.Remove("a")
+	if ix.Len() != 3 || len(ix.Similar(0x0f, 1)) != 1 {
+		t.Errorf("expected a to be removed")
+	}
+}
+
+func TestIngest_ImageHashes(t *testing.T) {
+	in := &Ingest{Storage: &FileStorage{Dir: t.TempDir()}, Prefix: "in/"}
+	in.ImageHashes = &ImageHashIndex{}
+	ctx := context.Background()
+
+	encode := func(img image.Image) []byte {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	first, err := in.File(ctx, "screenshot.png", bytes.NewReader(encode(sceneImage(400, 300, false))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first.NearDuplicates) != 0 {
+		t.Errorf("expected no near duplicates but got %v", first.NearDuplicates)
+	}
+
+	again, err := in.File(ctx, "screenshot (1).png", bytes.NewReader(encode(sceneImage(200, 150, false))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again.NearDuplicates) != 1 || again.NearDuplicates[0] != first.NewFileName {
+		t.Errorf("expected %s as a near duplicate but got %v", first.NewFileName, again.NearDuplicates)
+	}
+
+	other, err := in.File(ctx, "photo.png", bytes.NewReader(encode(sceneImage(400, 300, true))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(other.NearDuplicates) != 0 {
+		t.Errorf("expected no near duplicates but got %v", other.NearDuplicates)
+	}
+
+	// exact duplicates aren't their own near duplicates, and other files aren't hashed
+	if f, _ := in.File(ctx, "copy.png", bytes.NewReader(encode(sceneImage(400, 300, false)))); len(f.NearDuplicates) != 1 {
+		t.Errorf("expected one near duplicate but got %v", f.NearDuplicates)
+	}
+	if _, err = in.File(ctx, "notes.txt", bytes.NewReader([]byte("hello"))); err != nil {
+		t.Fatal(err)
+	}
+	if in.ImageHashes.Len() != 3 {
+		t.Errorf("expected 3 images but got %d", in.ImageHashes.Len())
+	}
+}
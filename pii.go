@@ -0,0 +1,242 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Kinds of PII found by the built-in patterns
+const (
+	PIIEmail      = "email"
+	PIISSN        = "ssn"
+	PIICardNumber = "card_number"
+)
+
+// PIIFinding is a likely piece of personal data found in a request field or document
+type PIIFinding struct {
+	// Kind is what was found, such as PIIEmail, or a Dictionary entry's kind
+	Kind string `json:"kind"`
+	// Field is the JSON path of the request field, or the file name, it was found in
+	Field string `json:"field"`
+	// Masked is the value with all but its last four characters masked, so reports don't
+	// spread the data they are about
+	Masked string `json:"masked"`
+}
+
+// PIIDetector finds PII in text. The built-in PatternPIIDetector uses regular expressions and
+// word lists; implement it to call a machine learning model or a service such as Amazon
+// Comprehend or Google DLP.
+type PIIDetector interface {
+	DetectPII(ctx context.Context, field, text string) ([]PIIFinding, error)
+}
+
+var defaultPIIPatterns = map[string]*regexp.Regexp{
+	PIIEmail:      regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`),
+	PIISSN:        regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`),
+	PIICardNumber: regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`),
+}
+
+// PatternPIIDetector is a PIIDetector which matches regular expressions and lists of words.
+// The zero value finds email addresses, US social security numbers, and card numbers which
+// pass the Luhn check.
+type PatternPIIDetector struct {
+	// Patterns maps kinds of PII to the expressions which find them, adding to or replacing
+	// the built-in ones
+	Patterns map[string]*regexp.Regexp
+	// Dictionary maps kinds of PII to words or phrases, such as the names of patients, which
+	// are found case-insensitively as whole words
+	Dictionary map[string][]string
+}
+
+// DetectPII implements PIIDetector
+func (d *PatternPIIDetector) DetectPII(_ context.Context, field, text string) ([]PIIFinding, error) {
+	patterns := make(map[string]*regexp.Regexp, len(defaultPIIPatterns)+len(d.Patterns))
+	for kind, re := range defaultPIIPatterns {
+		patterns[kind] = re
+	}
+	for kind, re := range d.Patterns {
+		patterns[kind] = re
+	}
+
+	var findings []PIIFinding
+	for kind, re := range patterns {
+		for _, m := range re.FindAllString(text, -1) {
+			if kind == PIICardNumber && d.Patterns[PIICardNumber] == nil && !luhnValid(m) {
+				continue
+			}
+			findings = append(findings, PIIFinding{Kind: kind, Field: field, Masked: maskPII(m)})
+		}
+	}
+
+	lower := strings.ToLower(text)
+	for kind, words := range d.Dictionary {
+		for _, word := range words {
+			if word != "" && containsWord(lower, strings.ToLower(word)) {
+				findings = append(findings, PIIFinding{Kind: kind, Field: field, Masked: maskPII(word)})
+			}
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool { return findings[i].Kind < findings[j].Kind })
+	return findings, nil
+}
+
+// luhnValid reports whether the digits of s pass the Luhn check card numbers carry
+func luhnValid(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && sum%10 == 0
+}
+
+// containsWord reports whether word appears in text without letters or digits either side
+func containsWord(text, word string) bool {
+	isWord := func(b byte) bool {
+		return b >= 'a' && b <= 'z' || b >= '0' && b <= '9' || b >= 0x80
+	}
+	for start := 0; ; {
+		i := strings.Index(text[start:], word)
+		if i < 0 {
+			return false
+		}
+		i += start
+		end := i + len(word)
+		if (i == 0 || !isWord(text[i-1])) && (end == len(text) || !isWord(text[end])) {
+			return true
+		}
+		start = i + 1
+	}
+}
+
+func maskPII(s string) string {
+	if len(s) <= 4 {
+		return strings.Repeat("*", len(s))
+	}
+	return strings.Repeat("*", len(s)-4) + s[len(s)-4:]
+}
+
+// PIIReport lists the PII found in a request body or file
+type PIIReport struct {
+	// Source is "request" for request bodies, or "file" for the text of files
+	Source string `json:"source"`
+	// Name is the request's method and path, or the stored file name
+	Name     string       `json:"name"`
+	Findings []PIIFinding `json:"findings"`
+}
+
+// PIIScanning flags likely PII in JSON request bodies and in the text extracted from uploaded
+// files, and reports it, such as to an audit log. It only reports; requests and files are
+// never rejected.
+type PIIScanning struct {
+	// Detectors find the PII. Defaults to a zero PatternPIIDetector
+	Detectors []PIIDetector
+	// Report receives what was found
+	Report func(ctx context.Context, report PIIReport)
+	// MaxBodySize is the most of a request body which is scanned. Defaults to 1MB
+	MaxBodySize int64
+	// ErrorLog receives errors from detectors. Defaults to the standard logger
+	ErrorLog *log.Logger
+}
+
+func (ps *PIIScanning) detect(ctx context.Context, field, text string) []PIIFinding {
+	detectors := ps.Detectors
+	if len(detectors) == 0 {
+		detectors = []PIIDetector{&PatternPIIDetector{}}
+	}
+
+	var findings []PIIFinding
+	for _, d := range detectors {
+		found, err := d.DetectPII(ctx, field, text)
+		if err != nil {
+			if ps.ErrorLog != nil {
+				ps.ErrorLog.Printf("detecting pii in %s: %v", field, err)
+			} else {
+				log.Printf("detecting pii in %s: %v", field, err)
+			}
+			continue
+		}
+		findings = append(findings, found...)
+	}
+	return findings
+}
+
+func (ps *PIIScanning) report(ctx context.Context, source, name string, findings []PIIFinding) {
+	if len(findings) > 0 && ps.Report != nil {
+		ps.Report(ctx, PIIReport{Source: source, Name: name, Findings: findings})
+	}
+}
+
+// Middleware scans the string fields of JSON request bodies before passing requests on with
+// the body intact. Bodies larger than MaxBodySize are passed on unscanned.
+func (ps *PIIScanning) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Body == nil || !strings.Contains(r.Header.Get("Content-Type"), "json") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		maxSize := ps.MaxBodySize
+		if maxSize <= 0 {
+			maxSize = 1024 * 1024
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxSize+1))
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		if err != nil || int64(len(body)) > maxSize {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var data any
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		if dec.Decode(&data) == nil {
+			var findings []PIIFinding
+			_ = walkStringFields(reflect.ValueOf(data), "", func(field, value string, _ reflect.StructTag) error {
+				if value != "" {
+					findings = append(findings, ps.detect(r.Context(), field, value)...)
+				}
+				return nil
+			})
+			sort.SliceStable(findings, func(i, j int) bool { return findings[i].Field < findings[j].Field })
+			ps.report(r.Context(), "request", r.Method+" "+r.URL.Path, findings)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Index wraps a TextExtraction.Index callback, such as a SearchIndex's IndexFile, so the
+// text of each file is scanned before it is indexed. Next may be nil to only scan.
+func (ps *PIIScanning) Index(next func(ctx context.Context, file *UploadedFile, contentType, text string) error) func(ctx context.Context, file *UploadedFile, contentType, text string) error {
+	return func(ctx context.Context, file *UploadedFile, contentType, text string) error {
+		ps.report(ctx, "file", file.NewFileName, ps.detect(ctx, file.OriginalFileName, text))
+		if next == nil {
+			return nil
+		}
+		return next(ctx, file, contentType, text)
+	}
+}
@@ -0,0 +1,116 @@
+package toolkit
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestPatternPIIDetector(t *testing.T) {
+	d := &PatternPIIDetector{
+		Patterns:   map[string]*regexp.Regexp{"iban": regexp.MustCompile(`\bGB\d{2}[A-Z]{4}\d{14}\b`)},
+		Dictionary: map[string][]string{"patient": {"Ada Lovelace"}},
+	}
+
+	var tests = []struct {
+		name  string
+		text  string
+		kinds []string
+	}{
+		{"email", "write to jane.doe@example.com today", []string{PIIEmail}},
+		{"ssn", "ssn 078-05-1120", []string{PIISSN}},
+		{"card", "card 4111 1111 1111 1111 exp 12/30", []string{PIICardNumber}},
+		{"not a card", "order 4111 1111 1111 1112", nil},
+		{"custom pattern", "pay GB82WEST12345698765432", []string{"iban"}},
+		{"dictionary", "notes on ada lovelace's visit", []string{"patient"}},
+		{"dictionary inside a word", "adalovelaces", nil},
+		{"nothing", "the quick brown fox", nil},
+	}
+
+	for _, e := range tests {
+		findings, err := d.DetectPII(context.Background(), "notes", e.text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var kinds []string
+		for _, f := range findings {
+			kinds = append(kinds, f.Kind)
+			if f.Field != "notes" || strings.Contains(e.text, f.Masked) {
+				t.Errorf("%s: expected the finding to be masked, got %+v", e.name, f)
+			}
+		}
+		if strings.Join(kinds, ",") != strings.Join(e.kinds, ",") {
+			t.Errorf("%s: expected %v but got %v", e.name, e.kinds, kinds)
+		}
+	}
+}
+
+func TestPIIScanning_Middleware(t *testing.T) {
+	var reports []PIIReport
+	ps := &PIIScanning{Report: func(_ context.Context, r PIIReport) { reports = append(reports, r) }}
+
+	var received string
+	h := ps.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		received = string(b)
+	}))
+
+	var tests = []struct {
+		name        string
+		contentType string
+		body        string
+		fields      []string
+	}{
+		{"nested fields", "application/json", `{"user":{"email":"a@example.com"},"notes":["ssn 078-05-1120"]}`, []string{"notes[0]", "user.email"}},
+		{"clean", "application/json", `{"name":"Sam"}`, nil},
+		{"not json", "text/plain", `a@example.com`, nil},
+		{"invalid json", "application/json", `{"email":"a@example.com"`, nil},
+	}
+
+	for _, e := range tests {
+		reports = nil
+		req := httptest.NewRequest("POST", "/signup", strings.NewReader(e.body))
+		req.Header.Set("Content-Type", e.contentType)
+		h.ServeHTTP(httptest.NewRecorder(), req)
+
+		if received != e.body {
+			t.Errorf("%s: expected the body to be passed on, got %q", e.name, received)
+		}
+		var fields []string
+		for _, r := range reports {
+			if r.Source != "request" || r.Name != "POST /signup" {
+				t.Errorf("%s: unexpected report %+v", e.name, r)
+			}
+			for _, f := range r.Findings {
+				fields = append(fields, f.Field)
+			}
+		}
+		if strings.Join(fields, ",") != strings.Join(e.fields, ",") {
+			t.Errorf("%s: expected findings in %v but got %v", e.name, e.fields, fields)
+		}
+	}
+}
+
+func TestPIIScanning_Index(t *testing.T) {
+	var reports []PIIReport
+	ps := &PIIScanning{Report: func(_ context.Context, r PIIReport) { reports = append(reports, r) }}
+	idx := &MemoryIndex{}
+
+	te := &TextExtraction{Index: ps.Index(idx.IndexFile)}
+	in := &Ingest{Storage: &FileStorage{Dir: t.TempDir()}, Prefix: "in/"}
+	in.TextExtraction = te
+
+	if _, err := in.File(context.Background(), "contacts.txt", strings.NewReader("call bob@example.com")); err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 1 || reports[0].Source != "file" || reports[0].Findings[0].Field != "contacts.txt" {
+		t.Errorf("unexpected reports %+v", reports)
+	}
+	if res, _ := idx.Search(context.Background(), SearchQuery{Query: "call"}); res.Total != 1 {
+		t.Errorf("expected the file to be indexed too, got %+v", res)
+	}
+}
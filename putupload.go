@@ -0,0 +1,142 @@
+package toolkit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+var sha256Hex = regexp.MustCompile(`^[a-f0-9]{64}$`)
+
+// uploadFileNameMetadata is the metadata key the original file name of an upload is kept under
+const uploadFileNameMetadata = "original-filename"
+
+// ContentAddressedUploadHandler returns a handler for idempotent PUT uploads, for API clients
+// which cannot use multipart forms. The client PUTs the raw file to a URL ending in the
+// lower case hex SHA-256 of its contents, e.g. PUT /files/9f86d08...; the server verifies the
+// hash before storing the file under prefix + hash. The first successful upload responds with
+// 201, and replays of an upload which already exists respond with 200 and the same record,
+// without reading the body, so clients can retry safely. The original file name may be given
+// with a Content-Disposition header; it is kept as metadata where the store supports it, so
+// replays return the name of the first upload. SVG images are refused, as they can't be
+// sanitized without changing their hash.
+func (t *Tools) ContentAddressedUploadHandler(store Storage, prefix string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			w.Header().Set("Allow", http.MethodPut)
+			_ = t.ErrorJSON(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+			return
+		}
+
+		sum := strings.ToLower(path.Base(r.URL.Path))
+		if !sha256Hex.MatchString(sum) {
+			_ = t.ErrorJSON(w, errors.New("url must end with the sha-256 of the file"))
+			return
+		}
+
+		record := UploadedFile{
+			NewFileName:      sum,
+			OriginalFileName: uploadFileName(r),
+			Checksum:         sum,
+		}
+
+		// replays of a completed upload return the existing record
+		if info, err := store.Stat(r.Context(), prefix+sum); err == nil {
+			meta, _ := GetMetadata(r.Context(), store, prefix+sum)
+			record.OriginalFileName = meta[uploadFileNameMetadata]
+			record.FileSize = info.Size
+			_ = t.WriteJSON(w, http.StatusOK, record)
+			return
+		}
+
+		maxSize := int64(1024 * 1024 * 1024)
+		if t.MaxFileSize > 0 {
+			maxSize = int64(t.MaxFileSize)
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxSize)
+
+		// spool to a temporary file while hashing, so nothing unverified reaches storage
+		tmp, err := os.CreateTemp("", "toolkit-put-*")
+		if err != nil {
+			_ = t.ErrorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+
+		h := sha256.New()
+		size, err := io.Copy(io.MultiWriter(tmp, h), r.Body)
+		if err != nil {
+			_ = t.ErrorJSON(w, asBodyTooLarge(err, maxSize))
+			return
+		}
+
+		if hex.EncodeToString(h.Sum(nil)) != sum {
+			_ = t.ErrorJSON(w, errors.New("checksum does not match the uploaded content"), http.StatusUnprocessableEntity)
+			return
+		}
+
+		// SVGs can't be sanitized without changing their hash, so they are refused
+		if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+			_ = t.ErrorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+		mt, err := mimetype.DetectReader(tmp)
+		if err != nil {
+			_ = t.ErrorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+		if mt.Is(SVGContentType) {
+			_ = t.ErrorJSON(w, fmt.Errorf("%w: svg images must be uploaded with UploadFile or Ingest", ErrFileTypeNotAllowed), http.StatusUnsupportedMediaType)
+			return
+		}
+
+		if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+			_ = t.ErrorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+		if err = store.Put(r.Context(), prefix+sum, tmp); err != nil {
+			_ = t.ErrorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+		if record.OriginalFileName != "" {
+			meta := map[string]string{uploadFileNameMetadata: record.OriginalFileName}
+			if err = SetMetadata(r.Context(), store, prefix+sum, meta); err != nil && !errors.Is(err, ErrNotSupported) {
+				_ = t.ErrorJSON(w, err, http.StatusInternalServerError)
+				return
+			}
+		}
+
+		record.FileSize = size
+		_ = t.WriteJSON(w, http.StatusCreated, record)
+	})
+}
+
+// uploadFileName returns the file name from a Content-Disposition request header, if any
+func uploadFileName(r *http.Request) string {
+	_, params, err := mime.ParseMediaType(r.Header.Get("Content-Disposition"))
+	if err != nil {
+		return ""
+	}
+	return baseFileName(params["filename"])
+}
+
+// baseFileName returns the last element of a file name, or "" if it has none, where
+// path.Base would return "." or "/"
+func baseFileName(name string) string {
+	name = path.Base(name)
+	if name == "." || name == "/" || name == ".." {
+		return ""
+	}
+	return name
+}
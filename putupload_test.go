@@ -0,0 +1,93 @@
+package toolkit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestTools_ContentAddressedUploadHandler(t *testing.T) {
+	dir, err := os.MkdirTemp("", "toolkit-put")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	testTools := Tools{MaxFileSize: 1024}
+	handler := testTools.ContentAddressedUploadHandler(&FileStorage{Dir: dir}, "files/")
+
+	content := "hello, world"
+	h := sha256.Sum256([]byte(content))
+	sum := hex.EncodeToString(h[:])
+
+	put := func(p, name, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PUT", p, strings.NewReader(body))
+		req.Header.Set("Content-Disposition", `attachment; filename="`+name+`"`)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := put("/files/"+sum, "greeting.txt", content)
+	if rr.Code != http.StatusCreated {
+		t.Fatal("expected 201 on first upload, got", rr.Code, rr.Body.String())
+	}
+
+	var record UploadedFile
+	_ = json.NewDecoder(rr.Body).Decode(&record)
+	if record.FileSize != int64(len(content)) || record.OriginalFileName != "greeting.txt" || record.Checksum != sum {
+		t.Errorf("wrong record: %+v", record)
+	}
+
+	// a replay returns the existing record, with the name of the first upload
+	rr = put("/files/"+sum, "other.txt", content)
+	if rr.Code != http.StatusOK {
+		t.Error("expected 200 on replay, got", rr.Code)
+	}
+	record = UploadedFile{}
+	_ = json.NewDecoder(rr.Body).Decode(&record)
+	if record.FileSize != int64(len(content)) || record.OriginalFileName != "greeting.txt" || record.Checksum != sum {
+		t.Errorf("wrong replayed record: %+v", record)
+	}
+
+	// a missing file name is left empty
+	unnamed := sha256.Sum256([]byte("unnamed"))
+	rr = put("/files/"+hex.EncodeToString(unnamed[:]), "", "unnamed")
+	record = UploadedFile{}
+	_ = json.NewDecoder(rr.Body).Decode(&record)
+	if rr.Code != http.StatusCreated || record.OriginalFileName != "" {
+		t.Errorf("expected an unnamed upload, got %d %+v", rr.Code, record)
+	}
+
+	// a mismatched hash is rejected and nothing is stored
+	other := strings.Repeat("a", 64)
+	rr = put("/files/"+other, "greeting.txt", content)
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Error("expected 422 for a bad checksum, got", rr.Code)
+	}
+	if _, err = os.Stat(dir + "/files/" + other); !os.IsNotExist(err) {
+		t.Error("unverified upload was stored")
+	}
+
+	// svgs can't be sanitized without changing their hash
+	svgSum := sha256.Sum256([]byte(maliciousSVG))
+	rr = put("/files/"+hex.EncodeToString(svgSum[:]), "logo.svg", maliciousSVG)
+	if rr.Code != http.StatusUnsupportedMediaType {
+		t.Error("expected 415 for an svg, got", rr.Code)
+	}
+
+	rr = put("/files/not-a-hash", "greeting.txt", content)
+	if rr.Code != http.StatusBadRequest {
+		t.Error("expected 400 for a bad url, got", rr.Code)
+	}
+
+	rr = put("/files/"+other, "greeting.txt", strings.Repeat("x", 2048))
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Error("expected 413 for a large body, got", rr.Code)
+	}
+}
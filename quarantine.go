@@ -0,0 +1,223 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// QuarantinedFile describes a file held in a Quarantine
+type QuarantinedFile struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	Checksum    string `json:"checksum"`
+	// Reason is why the file was held, such as the scanner's verdict
+	Reason string `json:"reason"`
+	// Source is where the file came from, such as "ingest"
+	Source string    `json:"source,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+// Quarantine holds files a scanner rejected, instead of discarding them, so that a moderator
+// can review false positives. Set it as Ingest.Quarantine, and mount its Handler for review:
+//
+//	mux.Handle("/admin/quarantine/", http.StripPrefix("/admin/quarantine", q.Handler()))
+//
+// The handler never serves a held file's contents, only its metadata.
+type Quarantine struct {
+	// Storage holds the files, and their metadata alongside them
+	Storage Storage
+	// Prefix is prepended to the keys of held files. Defaults to "quarantine/"
+	Prefix string
+	// Release is given the contents of an approved file, such as to store it where it would
+	// have gone. Approval fails without it
+	Release func(ctx context.Context, f QuarantinedFile, r io.Reader) error
+	// Tools is used to read and write JSON
+	Tools *Tools
+	// Protect wraps the review handler, and should be an authentication middleware. If it is
+	// nil, every request is refused.
+	Protect func(http.Handler) http.Handler
+	// Audit, if set, receives each approval and deletion, with Setting "quarantine.<id>"
+	Audit func(ctx context.Context, e AdminChange)
+	// Actor names who made a change, for Audit. Defaults to the user ID stored by
+	// RequestContext, the basic auth user name, or the client's address
+	Actor func(r *http.Request) string
+}
+
+func (q *Quarantine) prefix() string {
+	if q.Prefix != "" {
+		return q.Prefix
+	}
+	return "quarantine/"
+}
+
+// Hold stores r in the quarantine, with the reason it was rejected
+func (q *Quarantine) Hold(ctx context.Context, f QuarantinedFile, r io.Reader) (QuarantinedFile, error) {
+	var t Tools
+	f.ID = t.UUID()
+	if f.At.IsZero() {
+		f.At = time.Now()
+	}
+	if err := q.Storage.Put(ctx, q.prefix()+f.ID, r); err != nil {
+		return f, err
+	}
+	meta, err := json.Marshal(f)
+	if err != nil {
+		return f, err
+	}
+	if err = q.Storage.Put(ctx, q.prefix()+f.ID+".json", bytes.NewReader(meta)); err != nil {
+		_ = q.Storage.Delete(ctx, q.prefix()+f.ID)
+		return f, err
+	}
+	return f, nil
+}
+
+// List returns the held files, newest first
+func (q *Quarantine) List(ctx context.Context) ([]QuarantinedFile, error) {
+	objects, err := q.Storage.List(ctx, q.prefix())
+	if err != nil {
+		return nil, err
+	}
+	files := []QuarantinedFile{}
+	for _, o := range objects {
+		id := strings.TrimPrefix(o.Key, q.prefix())
+		if !strings.HasSuffix(id, ".json") || strings.Contains(id, "/") {
+			continue
+		}
+		f, err := q.Get(ctx, strings.TrimSuffix(id, ".json"))
+		if errors.Is(err, ErrNotFound) {
+			// deleted while listing
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	sort.SliceStable(files, func(i, j int) bool { return files[i].At.After(files[j].At) })
+	return files, nil
+}
+
+// Get returns the metadata of a held file, or ErrNotFound
+func (q *Quarantine) Get(ctx context.Context, id string) (QuarantinedFile, error) {
+	var f QuarantinedFile
+	if id == "" || strings.ContainsAny(id, "/.") {
+		return f, ErrNotFound
+	}
+	r, err := q.Storage.Get(ctx, q.prefix()+id+".json")
+	if err != nil {
+		return f, err
+	}
+	defer r.Close()
+	err = json.NewDecoder(r).Decode(&f)
+	return f, err
+}
+
+// Approve gives a held file to Release, then removes it from the quarantine
+func (q *Quarantine) Approve(ctx context.Context, id string) error {
+	if q.Release == nil {
+		return errors.New("quarantine has no Release function")
+	}
+	f, err := q.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	r, err := q.Storage.Get(ctx, q.prefix()+id)
+	if err != nil {
+		return err
+	}
+	err = q.Release(ctx, f, r)
+	r.Close()
+	if err != nil {
+		return err
+	}
+	return q.Delete(ctx, id)
+}
+
+// Delete removes a held file for good
+func (q *Quarantine) Delete(ctx context.Context, id string) error {
+	if _, err := q.Get(ctx, id); err != nil {
+		return err
+	}
+	if err := q.Storage.Delete(ctx, q.prefix()+id); err != nil {
+		return err
+	}
+	return q.Storage.Delete(ctx, q.prefix()+id+".json")
+}
+
+// Handler returns the review endpoints, wrapped in the Protect middleware:
+//
+//	GET    /              the held files, newest first
+//	GET    /{id}          a held file's metadata
+//	POST   /{id}/approve  release the file and remove it from the quarantine
+//	DELETE /{id}          delete the file
+func (q *Quarantine) Handler() http.Handler {
+	if q.Protect == nil {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var t Tools
+			_ = t.ErrorJSON(w, errors.New("quarantine endpoints are not protected"), http.StatusForbidden)
+		})
+	}
+	return q.Protect(http.HandlerFunc(q.serve))
+}
+
+func (q *Quarantine) serve(w http.ResponseWriter, r *http.Request) {
+	t := q.Tools
+	if t == nil {
+		t = &Tools{}
+	}
+	id, action, _ := strings.Cut(strings.Trim(r.URL.Path, "/"), "/")
+
+	var err error
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		var files []QuarantinedFile
+		if files, err = q.List(r.Context()); err == nil {
+			_ = t.WriteJSON(w, http.StatusOK, files)
+			return
+		}
+	case action == "" && r.Method == http.MethodGet:
+		var f QuarantinedFile
+		if f, err = q.Get(r.Context(), id); err == nil {
+			_ = t.WriteJSON(w, http.StatusOK, f)
+			return
+		}
+	case action == "approve" && r.Method == http.MethodPost:
+		if err = q.Approve(r.Context(), id); err == nil {
+			q.audit(r, id, "approved")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	case action == "" && r.Method == http.MethodDelete:
+		if err = q.Delete(r.Context(), id); err == nil {
+			q.audit(r, id, "deleted")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	case id == "" || action == "" || action == "approve":
+		_ = t.ErrorJSON(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+		return
+	default:
+		err = ErrNotFound
+	}
+
+	if errors.Is(err, ErrNotFound) {
+		_ = t.ErrorJSON(w, ErrNotFound, http.StatusNotFound)
+		return
+	}
+	_ = t.ErrorJSON(w, err, http.StatusInternalServerError)
+}
+
+func (q *Quarantine) audit(r *http.Request, id, outcome string) {
+	if q.Audit != nil {
+		q.Audit(r.Context(), AdminChange{Actor: changeActor(r, q.Actor), Setting: "quarantine." + id, Old: "held", New: outcome, At: time.Now()})
+	}
+}
@@ -0,0 +1,108 @@
+package toolkit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestQuarantine(t *testing.T) {
+	store := &FileStorage{Dir: t.TempDir()}
+	in := &Ingest{Storage: store, Prefix: "in/"}
+	errInfected := errors.New("infected: Eicar-Test-Signature")
+	in.Scan = func(ctx context.Context, name, contentType string, r io.Reader) error {
+		data, _ := io.ReadAll(r)
+		if strings.Contains(string(data), "EICAR") {
+			return errInfected
+		}
+		return nil
+	}
+	var released []string
+	var changes []AdminChange
+	q := &Quarantine{
+		Storage: store,
+		Release: func(ctx context.Context, f QuarantinedFile, r io.Reader) error {
+			data, _ := io.ReadAll(r)
+			released = append(released, f.Name+":"+string(data))
+			return nil
+		},
+		Protect: func(next http.Handler) http.Handler { return next },
+		Audit:   func(ctx context.Context, c AdminChange) { changes = append(changes, c) },
+	}
+	in.Quarantine = q
+	ctx := context.Background()
+
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if _, err := in.File(ctx, name, strings.NewReader("EICAR "+name)); !errors.Is(err, errInfected) {
+			t.Fatalf("expected the scan to reject %s, got %v", name, err)
+		}
+	}
+	if _, err := in.File(ctx, "clean.txt", strings.NewReader("clean")); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := q.Handler()
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(method, path, nil))
+		return rr
+	}
+
+	rr := serve("GET", "/")
+	var files []QuarantinedFile
+	if err := json.NewDecoder(rr.Body).Decode(&files); err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected two held files, got %+v", files)
+	}
+	for _, f := range files {
+		if f.Reason != errInfected.Error() || f.Source != "ingest" || f.Size == 0 || len(f.Checksum) != 64 {
+			t.Errorf("unexpected metadata %+v", f)
+		}
+	}
+	byName := map[string]string{files[0].Name: files[0].ID, files[1].Name: files[1].ID}
+
+	var tests = []struct {
+		method, path string
+		status       int
+		contains     string
+	}{
+		{"GET", "/" + byName["a.txt"], http.StatusOK, `"name":"a.txt"`},
+		{"GET", "/missing", http.StatusNotFound, "not found"},
+		{"GET", "/../secrets", http.StatusNotFound, "not found"},
+		{"PUT", "/" + byName["a.txt"], http.StatusMethodNotAllowed, "method not allowed"},
+		{"POST", "/" + byName["a.txt"] + "/approve", http.StatusNoContent, ""},
+		{"POST", "/" + byName["a.txt"] + "/approve", http.StatusNotFound, "not found"},
+		{"DELETE", "/" + byName["b.txt"], http.StatusNoContent, ""},
+		{"GET", "/", http.StatusOK, "[]"},
+	}
+	for _, e := range tests {
+		rr := serve(e.method, e.path)
+		if rr.Code != e.status || !strings.Contains(rr.Body.String(), e.contains) {
+			t.Errorf("%s %s: expected %d containing %q, got %d %s", e.method, e.path, e.status, e.contains, rr.Code, rr.Body.String())
+		}
+	}
+
+	if len(released) != 1 || released[0] != "a.txt:EICAR a.txt" {
+		t.Errorf("expected the approved file to be released, got %v", released)
+	}
+	if len(changes) != 2 || changes[0].New != "approved" || changes[1].New != "deleted" || changes[1].Setting != "quarantine."+byName["b.txt"] {
+		t.Errorf("unexpected audit trail %+v", changes)
+	}
+	if objects, _ := store.List(ctx, "quarantine/"); len(objects) != 0 {
+		t.Errorf("expected the quarantine to be empty, got %v", objects)
+	}
+
+	var open Quarantine
+	rr = httptest.NewRecorder()
+	open.Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if rr.Code != http.StatusForbidden {
+		t.Error("expected an unprotected quarantine to refuse requests, got", rr.Code)
+	}
+}
@@ -0,0 +1,190 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrQuotaExceeded is sent when a key has used up its quota for the current window
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// ErrNoQuotaKey is sent when a request has no key to charge its quota to
+var ErrNoQuotaKey = errors.New("request has no quota key")
+
+// QuotaWindow is the calendar period a quota applies to
+type QuotaWindow int
+
+const (
+	// QuotaDaily resets at midnight
+	QuotaDaily QuotaWindow = iota
+	// QuotaMonthly resets at midnight on the first of the month
+	QuotaMonthly
+)
+
+// bounds returns the start of the window containing now, and the start of the next one
+func (qw QuotaWindow) bounds(now time.Time) (start, reset time.Time) {
+	y, m, d := now.Date()
+	if qw == QuotaMonthly {
+		start = time.Date(y, m, 1, 0, 0, 0, 0, now.Location())
+		return start, start.AddDate(0, 1, 0)
+	}
+	start = time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+	return start, start.AddDate(0, 0, 1)
+}
+
+// QuotaUsage is what a key has used in a window
+type QuotaUsage struct {
+	Requests int64 `json:"requests"`
+	Bytes    int64 `json:"bytes"`
+}
+
+// QuotaStore keeps quota usage, so that it can be shared between instances
+type QuotaStore interface {
+	// Increment adds to the usage of key in the window starting at start, and returns the total
+	Increment(ctx context.Context, key string, start time.Time, requests, bytes int64) (QuotaUsage, error)
+}
+
+// MemoryQuotaStore keeps quota usage in memory. The zero value is ready to use.
+type MemoryQuotaStore struct {
+	mu    sync.Mutex
+	usage map[string]*memoryQuota
+}
+
+type memoryQuota struct {
+	start time.Time
+	usage QuotaUsage
+}
+
+// Increment adds to the usage of key, starting afresh when the window changes
+func (s *MemoryQuotaStore) Increment(_ context.Context, key string, start time.Time, requests, bytes int64) (QuotaUsage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.usage == nil {
+		s.usage = make(map[string]*memoryQuota)
+	}
+	q, ok := s.usage[key]
+	if !ok || !q.start.Equal(start) {
+		q = &memoryQuota{start: start}
+		s.usage[key] = q
+	}
+	q.usage.Requests += requests
+	q.usage.Bytes += bytes
+	return q.usage, nil
+}
+
+// QuotaDetails is the data sent with a 429 response when a quota is exceeded
+type QuotaDetails struct {
+	Limit     int64     `json:"limit"`
+	Remaining int64     `json:"remaining"`
+	Reset     time.Time `json:"reset"`
+}
+
+// Quota enforces a number of requests and/or bytes per calendar day or month for each key.
+// Bytes are counted in both directions, and a request which takes a key over its byte quota
+// is allowed to finish.
+type Quota struct {
+	Window QuotaWindow
+	// Requests is the number of requests allowed per window. Zero is unlimited
+	Requests int64
+	// Bytes is the number of bytes allowed per window. Zero is unlimited
+	Bytes int64
+	// Limits, if set, returns the limits for a key, such as from its billing plan
+	Limits func(key string) (requests, bytes int64)
+	// Key identifies the client of a request once it has been authenticated, such as by
+	// looking up its API key. It must not return values the client controls unchecked, or
+	// clients could make up a new key for each request. Defaults to the user ID in the
+	// request's context, set by RequestContext
+	Key func(r *http.Request) string
+	// Location is the time zone the calendar windows are in. Defaults to UTC
+	Location *time.Location
+	// Store keeps usage. Defaults to an in-memory store
+	Store QuotaStore
+
+	once sync.Once
+}
+
+func (q *Quota) store() QuotaStore {
+	q.once.Do(func() {
+		if q.Store == nil {
+			q.Store = &MemoryQuotaStore{}
+		}
+	})
+	return q.Store
+}
+
+// Middleware enforces the quota. Every response carries X-Quota-Limit, X-Quota-Remaining and
+// X-Quota-Reset headers for the request quota; requests over quota get a 429 JSON error with
+// the reset time. Requests without a key are refused with a 401, so the quota can't be avoided.
+func (q *Quota) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var t Tools
+		key, _ := UserIDFromContext(r.Context())
+		if q.Key != nil {
+			key = q.Key(r)
+		}
+		if key == "" {
+			_ = t.ErrorJSON(w, ErrNoQuotaKey, http.StatusUnauthorized)
+			return
+		}
+
+		limitRequests, limitBytes := q.Requests, q.Bytes
+		if q.Limits != nil {
+			limitRequests, limitBytes = q.Limits(key)
+		}
+
+		loc := q.Location
+		if loc == nil {
+			loc = time.UTC
+		}
+		start, reset := q.Window.bounds(time.Now().In(loc))
+
+		usage, err := q.store().Increment(r.Context(), key, start, 1, 0)
+		if err != nil {
+			_ = t.ErrorJSON(w, err, http.StatusServiceUnavailable)
+			return
+		}
+
+		if limitRequests > 0 {
+			remaining := limitRequests - usage.Requests
+			if remaining < 0 {
+				remaining = 0
+			}
+			w.Header().Set("X-Quota-Limit", strconv.FormatInt(limitRequests, 10))
+			w.Header().Set("X-Quota-Remaining", strconv.FormatInt(remaining, 10))
+			w.Header().Set("X-Quota-Reset", strconv.FormatInt(reset.Unix(), 10))
+
+			if usage.Requests > limitRequests {
+				q.refuse(w, QuotaDetails{Limit: limitRequests, Reset: reset})
+				return
+			}
+		}
+		if limitBytes > 0 && usage.Bytes >= limitBytes {
+			q.refuse(w, QuotaDetails{Limit: limitBytes, Reset: reset})
+			return
+		}
+
+		body := countBody(r)
+		cw := newCountingWriter(w)
+		next.ServeHTTP(cw, r)
+
+		if limitBytes > 0 {
+			_, _ = q.store().Increment(r.Context(), key, start, 0, body.Count()+cw.Count())
+		}
+	})
+}
+
+func (q *Quota) refuse(w http.ResponseWriter, details QuotaDetails) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(details.Reset).Seconds())+1))
+
+	var t Tools
+	_ = t.WriteJSON(w, http.StatusTooManyRequests, JSONResponse{
+		Error:   true,
+		Message: ErrQuotaExceeded.Error(),
+		Data:    details,
+	})
+}
@@ -0,0 +1,87 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestQuotaWindow_bounds(t *testing.T) {
+	now := time.Date(2024, 12, 31, 15, 30, 0, 0, time.UTC)
+
+	var tests = []struct {
+		window QuotaWindow
+		start  time.Time
+		reset  time.Time
+	}{
+		{QuotaDaily, time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC), time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{QuotaMonthly, time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, e := range tests {
+		start, reset := e.window.bounds(now)
+		if !start.Equal(e.start) || !reset.Equal(e.reset) {
+			t.Errorf("window %d: expected %s - %s, got %s - %s", e.window, e.start, e.reset, start, reset)
+		}
+	}
+}
+
+func TestQuota_Middleware(t *testing.T) {
+	q := &Quota{
+		Window:   QuotaMonthly,
+		Requests: 2,
+		Limits: func(key string) (int64, int64) {
+			if key == "small" {
+				return 0, 10
+			}
+			return 2, 0
+		},
+	}
+	handler := q.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("0123456789"))
+	}))
+
+	var tests = []struct {
+		key       string
+		expected  int
+		remaining string
+	}{
+		{"a", http.StatusOK, "1"},
+		{"a", http.StatusOK, "0"},
+		{"a", http.StatusTooManyRequests, "0"},
+		{"b", http.StatusOK, "1"},
+		{"small", http.StatusOK, ""},
+		{"small", http.StatusTooManyRequests, ""},
+		{"", http.StatusUnauthorized, ""},
+	}
+
+	for i, e := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		if e.key != "" {
+			req = req.WithContext(ContextWithUserID(req.Context(), e.key))
+		}
+		// the header is the client's word, and is never used as the key
+		req.Header.Set("X-API-Key", "made-up")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expected {
+			t.Errorf("%d: expected %d, got %d", i, e.expected, rr.Code)
+		}
+		if rr.Header().Get("X-Quota-Remaining") != e.remaining {
+			t.Errorf("%d: expected %q remaining, got %q", i, e.remaining, rr.Header().Get("X-Quota-Remaining"))
+		}
+
+		if rr.Code == http.StatusTooManyRequests {
+			var resp struct {
+				Data QuotaDetails `json:"data"`
+			}
+			_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+			if resp.Data.Reset.Before(time.Now()) || rr.Header().Get("Retry-After") == "" {
+				t.Errorf("%d: expected a reset time in the future, got %s", i, rr.Body.String())
+			}
+		}
+	}
+}
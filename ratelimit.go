@@ -0,0 +1,208 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is sent to clients which have made too many requests
+var ErrRateLimited = errors.New("too many requests")
+
+// ErrBanned is sent to clients which have been temporarily banned
+var ErrBanned = errors.New("client is temporarily banned")
+
+// RateLimitStore counts requests in a store shared by several instances, such as the redis
+// package's Client. Allow counts a request by key, allowing limit requests per window, and
+// otherwise returns false and how long until the window resets.
+type RateLimitStore interface {
+	Allow(ctx context.Context, key string, limit int64, window time.Duration) (bool, time.Duration, error)
+}
+
+// RateLimiter limits each client to a steady rate of requests with bursts, using a token
+// bucket per key, and can ban keys outright for a while. The zero value allows one request per
+// second with a burst of one.
+type RateLimiter struct {
+	// Rate is the number of requests allowed per second
+	Rate float64
+	// Burst is the most requests allowed at once
+	Burst int
+	// Key identifies the client of a request. Defaults to its IP address
+	Key            func(r *http.Request) string
+	TrustedProxies []*net.IPNet
+	// Store, if set, counts the Middleware's requests instead of the buckets in memory, so the
+	// limit holds across instances: Burst requests are allowed in each window of Burst/Rate
+	// seconds. Bans are still kept in memory
+	Store RateLimitStore
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	bans    map[string]time.Time
+	sweep   time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Allow takes a token for key. If none is left, or the key is banned, it returns false and
+// how long the client should wait before trying again.
+func (rl *RateLimiter) Allow(key string) (bool, time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	rl.sweepLocked(now)
+
+	if until, ok := rl.bans[key]; ok && now.Before(until) {
+		return false, until.Sub(now)
+	}
+
+	rate, burst := rl.limits()
+	b, ok := rl.buckets[key]
+	if !ok {
+		if rl.buckets == nil {
+			rl.buckets = make(map[string]*tokenBucket)
+		}
+		b = &tokenBucket{tokens: burst, last: now}
+		rl.buckets[key] = b
+	}
+
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// SetLimits changes the rate and burst safely while the limiter is in use, such as when the
+// configuration is reloaded
+func (rl *RateLimiter) SetLimits(rate float64, burst int) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.Rate, rl.Burst = rate, burst
+}
+
+// Ban refuses every request from key for d
+func (rl *RateLimiter) Ban(key string, d time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if rl.bans == nil {
+		rl.bans = make(map[string]time.Time)
+	}
+	until := time.Now().Add(d)
+	if until.After(rl.bans[key]) {
+		rl.bans[key] = until
+	}
+}
+
+// Unban lifts a ban early
+func (rl *RateLimiter) Unban(key string) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	delete(rl.bans, key)
+}
+
+// Banned reports whether key is currently banned
+func (rl *RateLimiter) Banned(key string) bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	until, ok := rl.bans[key]
+	return ok && time.Now().Before(until)
+}
+
+// KeyOf returns the key a request is limited by
+func (rl *RateLimiter) KeyOf(r *http.Request) string {
+	if rl.Key != nil {
+		return rl.Key(r)
+	}
+	if ip := requestClientIP(r, rl.TrustedProxies); ip != nil {
+		return ip.String()
+	}
+	return r.RemoteAddr
+}
+
+// Middleware refuses requests over the limit, or from banned clients, with a 429 JSON error
+// and a Retry-After header. If the Store fails, requests are refused with a 503.
+func (rl *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var t Tools
+		key := rl.KeyOf(r)
+		ok, wait, err := rl.allow(r.Context(), key)
+		if err != nil {
+			_ = t.ErrorJSON(w, err, http.StatusServiceUnavailable)
+			return
+		}
+		if !ok {
+			err := ErrRateLimited
+			if rl.Banned(key) {
+				err = ErrBanned
+			}
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			_ = t.ErrorJSON(w, err, http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allow is Allow, counting the request in the Store if there is one
+func (rl *RateLimiter) allow(ctx context.Context, key string) (bool, time.Duration, error) {
+	if rl.Store == nil {
+		ok, wait := rl.Allow(key)
+		return ok, wait, nil
+	}
+
+	now := time.Now()
+	rl.mu.Lock()
+	rl.sweepLocked(now)
+	until, banned := rl.bans[key]
+	rate, burst := rl.limits()
+	rl.mu.Unlock()
+	if banned && now.Before(until) {
+		return false, until.Sub(now), nil
+	}
+	return rl.Store.Allow(ctx, key, int64(burst), time.Duration(burst/rate*float64(time.Second)))
+}
+
+func (rl *RateLimiter) limits() (rate, burst float64) {
+	rate, burst = rl.Rate, float64(rl.Burst)
+	if rate <= 0 {
+		rate = 1
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return rate, burst
+}
+
+// sweepLocked forgets full buckets and expired bans once a minute, so memory does not grow
+// with the number of clients ever seen
+func (rl *RateLimiter) sweepLocked(now time.Time) {
+	if now.Sub(rl.sweep) < time.Minute {
+		return
+	}
+	rl.sweep = now
+
+	rate, burst := rl.limits()
+	for key, b := range rl.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*rate >= burst {
+			delete(rl.buckets, key)
+		}
+	}
+	for key, until := range rl.bans {
+		if !now.Before(until) {
+			delete(rl.bans, key)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_Allow(t *testing.T) {
+	rl := &RateLimiter{Rate: 10, Burst: 2}
+
+	for i, expected := range []bool{true, true, false} {
+		if ok, _ := rl.Allow("a"); ok != expected {
+			t.Errorf("request %d: expected %v", i, expected)
+		}
+	}
+	if ok, _ := rl.Allow("b"); !ok {
+		t.Error("keys should be limited separately")
+	}
+
+	time.Sleep(120 * time.Millisecond)
+	if ok, _ := rl.Allow("a"); !ok {
+		t.Error("expected a token to have been refilled")
+	}
+
+	rl.Ban("b", time.Minute)
+	if ok, wait := rl.Allow("b"); ok || wait < 59*time.Second {
+		t.Errorf("expected banned key to be refused for a minute, got %v %s", ok, wait)
+	}
+	rl.Unban("b")
+	if rl.Banned("b") {
+		t.Error("expected ban to be lifted")
+	}
+}
+
+func TestRateLimiter_Middleware(t *testing.T) {
+	rl := &RateLimiter{Rate: 1, Burst: 1}
+	handler := rl.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	var tests = []struct {
+		remoteAddr string
+		expected   int
+	}{
+		{"10.0.0.1:1234", http.StatusOK},
+		{"10.0.0.1:1235", http.StatusTooManyRequests},
+		{"10.0.0.2:1234", http.StatusOK},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = e.remoteAddr
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != e.expected {
+			t.Errorf("%s: expected %d, got %d", e.remoteAddr, e.expected, rr.Code)
+		}
+		if rr.Code == http.StatusTooManyRequests && rr.Header().Get("Retry-After") != "1" {
+			t.Errorf("unexpected Retry-After %q", rr.Header().Get("Retry-After"))
+		}
+	}
+}
+
+func TestRateLimiter_ContextClientIP(t *testing.T) {
+	rl := &RateLimiter{}
+	// the address RequestContext stored is used over the connection's
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.9:1234"
+	req = req.WithContext(ContextWithClientIP(req.Context(), net.ParseIP("203.0.113.7")))
+	if key := rl.KeyOf(req); key != "203.0.113.7" {
+		t.Errorf("expected the context's client address, got %s", key)
+	}
+}
+
+// countingStore is a RateLimitStore which counts requests without windows
+type countingStore struct {
+	counts map[string]int64
+	window time.Duration
+	err    error
+}
+
+func (s *countingStore) Allow(ctx context.Context, key string, limit int64, window time.Duration) (bool, time.Duration, error) {
+	if s.err != nil {
+		return false, 0, s.err
+	}
+	s.counts[key]++
+	s.window = window
+	if s.counts[key] > limit {
+		return false, window, nil
+	}
+	return true, 0, nil
+}
+
+func TestRateLimiter_Store(t *testing.T) {
+	store := &countingStore{counts: make(map[string]int64)}
+	rl := &RateLimiter{Rate: 2, Burst: 4, Store: store}
+	handler := rl.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	request := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	for i, expected := range []int{http.StatusOK, http.StatusOK, http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		if rr := request(); rr.Code != expected {
+			t.Errorf("request %d: expected %d, got %d", i, expected, rr.Code)
+		}
+	}
+	if store.counts["10.0.0.1"] != 5 || store.window != 2*time.Second {
+		t.Errorf("expected the store to count 5 requests in 2s windows, got %d in %s", store.counts["10.0.0.1"], store.window)
+	}
+
+	// bans are checked before the store
+	rl.Ban("10.0.0.1", time.Minute)
+	if rr := request(); rr.Code != http.StatusTooManyRequests || store.counts["10.0.0.1"] != 5 {
+		t.Errorf("expected a banned client refused without counting, got %d", rr.Code)
+	}
+	rl.Unban("10.0.0.1")
+
+	store.err = errors.New("connection refused")
+	if rr := request(); rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 when the store fails, got %d", rr.Code)
+	}
+}
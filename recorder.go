@@ -0,0 +1,246 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Exchange is a recorded request and its response
+type Exchange struct {
+	Time           time.Time     `json:"time"`
+	Method         string        `json:"method"`
+	Path           string        `json:"path"`
+	Query          string        `json:"query,omitempty"`
+	Status         int           `json:"status"`
+	Duration       time.Duration `json:"duration"`
+	RequestHeader  http.Header   `json:"request_header"`
+	RequestBody    string        `json:"request_body,omitempty"`
+	ResponseHeader http.Header   `json:"response_header"`
+	ResponseBody   string        `json:"response_body,omitempty"`
+	Truncated      bool          `json:"truncated,omitempty"`
+}
+
+// Recorder is an opt-in debugging aid which captures sanitized request and response bodies
+// for matching routes into a ring buffer and, optionally, a file or other writer.
+type Recorder struct {
+	// Routes are path prefixes to record. If empty, every request is recorded
+	Routes []string
+	// Redactor scrubs headers and bodies before they are stored. The credential headers, such
+	// as Authorization and Cookie, are masked whether or not it is set
+	Redactor *Redactor
+	// Size is the number of exchanges kept in memory. Defaults to 100
+	Size int
+	// MaxBodySize is the number of body bytes captured per request and response. Defaults to 64KB.
+	// With a Redactor, longer bodies aren't recorded, as their fields can't be found to redact
+	MaxBodySize int
+	// Output, if set, receives every exchange as a line of JSON
+	Output io.Writer
+
+	mu   sync.Mutex
+	ring []Exchange
+	next int
+}
+
+func (rec *Recorder) matches(r *http.Request) bool {
+	if len(rec.Routes) == 0 {
+		return true
+	}
+	for _, route := range rec.Routes {
+		if strings.HasPrefix(r.URL.Path, route) {
+			return true
+		}
+	}
+	return false
+}
+
+func (rec *Recorder) maxBody() int {
+	if rec.MaxBodySize > 0 {
+		return rec.MaxBodySize
+	}
+	return 64 * 1024
+}
+
+// Middleware records the requests that match the recorder's routes, and their responses
+func (rec *Recorder) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !rec.matches(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		limit := rec.maxBody()
+		start := time.Now()
+
+		// capture the start of the body, then put it back in front of the rest
+		var reqBody []byte
+		truncated := false
+		if r.Body != nil {
+			reqBody, _ = io.ReadAll(io.LimitReader(r.Body, int64(limit)+1))
+			if len(reqBody) > limit {
+				truncated = true
+			}
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(reqBody), r.Body), r.Body}
+			if truncated {
+				reqBody = reqBody[:limit]
+			}
+		}
+
+		cw := &captureWriter{ResponseWriter: w, status: http.StatusOK, limit: limit}
+		next.ServeHTTP(cw, r)
+
+		rec.add(Exchange{
+			Time:           start,
+			Method:         r.Method,
+			Path:           r.URL.Path,
+			Query:          rec.Redactor.RedactString(r.URL.RawQuery),
+			Status:         cw.status,
+			Duration:       time.Since(start),
+			RequestHeader:  rec.redactHeader(r.Header),
+			RequestBody:    rec.redactBody(reqBody, truncated),
+			ResponseHeader: rec.redactHeader(w.Header()),
+			ResponseBody:   rec.redactBody(cw.body.Bytes(), cw.truncated),
+			Truncated:      truncated || cw.truncated,
+		})
+	})
+}
+
+// recordedCredentialHeaders are masked in every recorded exchange
+var recordedCredentialHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+func (rec *Recorder) redactHeader(h http.Header) http.Header {
+	out := rec.Redactor.RedactHeader(h)
+	mask := defaultRedactMask
+	if rec.Redactor != nil {
+		mask = rec.Redactor.mask()
+	}
+	for _, name := range recordedCredentialHeaders {
+		if _, ok := out[name]; ok {
+			out[name] = []string{mask}
+		}
+	}
+	return out
+}
+
+// redactBody redacts a captured body, and then cuts it to the limit, as masks may lengthen it.
+// A truncated body isn't valid JSON, so with a Redactor it is dropped rather than recorded
+// with its fields in clear text.
+func (rec *Recorder) redactBody(b []byte, truncated bool) string {
+	if rec.Redactor != nil && truncated {
+		return ""
+	}
+	out := rec.Redactor.RedactJSON(b)
+	if limit := rec.maxBody(); len(out) > limit {
+		out = out[:limit]
+	}
+	return string(out)
+}
+
+func (rec *Recorder) add(ex Exchange) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	size := rec.Size
+	if size <= 0 {
+		size = 100
+	}
+
+	if len(rec.ring) < size {
+		rec.ring = append(rec.ring, ex)
+	} else {
+		rec.ring[rec.next] = ex
+	}
+	rec.next = (rec.next + 1) % size
+
+	if rec.Output != nil {
+		line, err := json.Marshal(ex)
+		if err == nil {
+			_, _ = rec.Output.Write(append(line, '\n'))
+		}
+	}
+}
+
+// Exchanges returns the recorded exchanges, oldest first
+func (rec *Recorder) Exchanges() []Exchange {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	out := make([]Exchange, 0, len(rec.ring))
+	if rec.next >= len(rec.ring) {
+		return append(out, rec.ring...)
+	}
+
+	// the buffer has wrapped, so the oldest entry is the next one to be overwritten
+	out = append(out, rec.ring[rec.next:]...)
+	return append(out, rec.ring[:rec.next]...)
+}
+
+// Reset discards all recorded exchanges
+func (rec *Recorder) Reset() {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	rec.ring = nil
+	rec.next = 0
+}
+
+// Handler returns an admin handler which dumps the recent exchanges as JSON. It should be
+// mounted behind authentication.
+func (rec *Recorder) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var t Tools
+		_ = t.WriteJSON(w, http.StatusOK, rec.Exchanges())
+	})
+}
+
+// captureWriter wraps a ResponseWriter, recording the status code and the start of the body
+type captureWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	limit       int
+	body        bytes.Buffer
+	truncated   bool
+}
+
+func (cw *captureWriter) WriteHeader(status int) {
+	if !cw.wroteHeader {
+		cw.status = status
+		cw.wroteHeader = true
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *captureWriter) Write(b []byte) (int, error) {
+	cw.wroteHeader = true
+	if room := cw.limit - cw.body.Len(); room > 0 {
+		if len(b) > room {
+			cw.body.Write(b[:room])
+			cw.truncated = true
+		} else {
+			cw.body.Write(b)
+		}
+	} else if len(b) > 0 {
+		cw.truncated = true
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher when the underlying writer does
+func (cw *captureWriter) Flush() {
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer
+func (cw *captureWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
@@ -0,0 +1,129 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRecorder_Middleware(t *testing.T) {
+	var out bytes.Buffer
+	rec := Recorder{
+		Routes: []string{"/partner"},
+		Redactor: &Redactor{
+			Fields:  []string{"password"},
+			Headers: []string{"Authorization"},
+		},
+		Size:   2,
+		Output: &out,
+	}
+
+	handler := rec.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the handler must still be able to read the full body
+		body, _ := io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write(body)
+	}))
+
+	for _, p := range []string{"/partner/a", "/other", "/partner/b", "/partner/c"} {
+		req := httptest.NewRequest("POST", p, strings.NewReader(`{"user":"jack","password":"secret"}`))
+		req.Header.Set("Authorization", "Bearer token")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if !strings.Contains(rr.Body.String(), "secret") {
+			t.Error("handler did not receive the original body")
+		}
+	}
+
+	exchanges := rec.Exchanges()
+	if len(exchanges) != 2 {
+		t.Fatal("expected 2 exchanges in the ring, got", len(exchanges))
+	}
+	if exchanges[0].Path != "/partner/b" || exchanges[1].Path != "/partner/c" {
+		t.Error("exchanges are not oldest first:", exchanges[0].Path, exchanges[1].Path)
+	}
+
+	ex := exchanges[1]
+	if ex.Status != http.StatusCreated {
+		t.Error("wrong status recorded", ex.Status)
+	}
+	if strings.Contains(ex.RequestBody, "secret") || strings.Contains(ex.ResponseBody, "secret") {
+		t.Error("password was not redacted", ex.RequestBody, ex.ResponseBody)
+	}
+	if ex.RequestHeader.Get("Authorization") != defaultRedactMask {
+		t.Error("authorization header was not redacted", ex.RequestHeader.Get("Authorization"))
+	}
+
+	if strings.Count(out.String(), "\n") != 3 {
+		t.Error("expected 3 lines written to output, got", strings.Count(out.String(), "\n"))
+	}
+
+	// dump via the admin handler
+	rr := httptest.NewRecorder()
+	rec.Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+
+	var dumped []Exchange
+	if err := json.NewDecoder(rr.Body).Decode(&dumped); err != nil {
+		t.Error(err)
+	}
+	if len(dumped) != 2 {
+		t.Error("expected 2 exchanges from the handler, got", len(dumped))
+	}
+}
+
+func TestRedactor_RedactJSON(t *testing.T) {
+	r := Redactor{Fields: []string{"token"}}
+
+	out := r.RedactJSON([]byte(`{"items":[{"Token":"abc","id":1}]}`))
+	if strings.Contains(string(out), "abc") {
+		t.Error("nested field was not redacted:", string(out))
+	}
+	if !strings.Contains(string(out), `"id":1`) {
+		t.Error("unredacted field was lost:", string(out))
+	}
+}
+
+func TestRecorder_Truncated(t *testing.T) {
+	var tests = []struct {
+		name     string
+		redactor *Redactor
+		wantBody bool
+	}{
+		{name: "redacted", redactor: &Redactor{Fields: []string{"password"}}, wantBody: false},
+		{name: "no redactor", redactor: nil, wantBody: true},
+	}
+
+	for _, e := range tests {
+		rec := Recorder{Redactor: e.redactor, MaxBodySize: 16}
+		handler := rec.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc"})
+			_, _ = io.Copy(w, r.Body)
+		}))
+
+		req := httptest.NewRequest("POST", "/", strings.NewReader(`{"password":"secret","user":"jack"}`))
+		req.Header.Set("Authorization", "Bearer token")
+		req.Header.Set("Cookie", "session=abc")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		ex := rec.Exchanges()[0]
+		if !ex.Truncated {
+			t.Errorf("%s: expected the exchange to be marked truncated", e.name)
+		}
+		if e.wantBody == (ex.RequestBody == "") || e.wantBody == (ex.ResponseBody == "") {
+			t.Errorf("%s: unexpected bodies %q and %q", e.name, ex.RequestBody, ex.ResponseBody)
+		}
+		if e.redactor != nil && strings.Contains(ex.RequestBody+ex.ResponseBody, "secret") {
+			t.Errorf("%s: password recorded in clear text", e.name)
+		}
+		for _, h := range []string{ex.RequestHeader.Get("Authorization"), ex.RequestHeader.Get("Cookie"), ex.ResponseHeader.Get("Set-Cookie")} {
+			if h != defaultRedactMask {
+				t.Errorf("%s: credential header not masked: %q", e.name, h)
+			}
+		}
+	}
+}
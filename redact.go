@@ -0,0 +1,124 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+const defaultRedactMask = "[REDACTED]"
+
+// Redactor holds the rules used to scrub sensitive values from headers, JSON bodies, and strings
+// before they are logged, recorded, or displayed.
+type Redactor struct {
+	// Fields are JSON keys (matched case-insensitively, at any depth) whose values are masked
+	Fields []string
+	// Headers are header names whose values are masked
+	Headers []string
+	// Patterns are applied to free text, such as non-JSON bodies; every match is masked
+	Patterns []*regexp.Regexp
+	// Mask replaces redacted values. Defaults to "[REDACTED]"
+	Mask string
+}
+
+func (r *Redactor) mask() string {
+	if r.Mask != "" {
+		return r.Mask
+	}
+	return defaultRedactMask
+}
+
+// IsRedacted reports whether the given field or header name is covered by the redaction rules
+func (r *Redactor) IsRedacted(name string) bool {
+	if r == nil {
+		return false
+	}
+	for _, f := range r.Fields {
+		if strings.EqualFold(f, name) {
+			return true
+		}
+	}
+	for _, h := range r.Headers {
+		if strings.EqualFold(h, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactHeader returns a copy of h with the values of redacted headers masked
+func (r *Redactor) RedactHeader(h http.Header) http.Header {
+	out := h.Clone()
+	if r == nil {
+		return out
+	}
+	for _, name := range r.Headers {
+		key := http.CanonicalHeaderKey(name)
+		if _, ok := out[key]; ok {
+			out[key] = []string{r.mask()}
+		}
+	}
+	return out
+}
+
+// RedactString masks every match of the redaction patterns in s
+func (r *Redactor) RedactString(s string) string {
+	if r == nil {
+		return s
+	}
+	for _, p := range r.Patterns {
+		s = p.ReplaceAllString(s, r.mask())
+	}
+	return s
+}
+
+// RedactJSON masks the values of redacted fields in a JSON document. If b is not valid JSON,
+// it is treated as text and only the patterns are applied.
+func (r *Redactor) RedactJSON(b []byte) []byte {
+	if r == nil {
+		return b
+	}
+
+	var doc any
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return []byte(r.RedactString(string(b)))
+	}
+
+	out, err := json.Marshal(r.RedactValue(doc))
+	if err != nil {
+		return []byte(r.RedactString(string(b)))
+	}
+	return out
+}
+
+// RedactValue walks a decoded JSON value (maps, slices, and scalars) and returns a copy
+// with redacted fields masked and patterns applied to strings
+func (r *Redactor) RedactValue(v any) any {
+	if r == nil {
+		return v
+	}
+
+	switch val := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(val))
+		for k, item := range val {
+			if r.IsRedacted(k) {
+				out[k] = r.mask()
+				continue
+			}
+			out[k] = r.RedactValue(item)
+		}
+		return out
+	case []any:
+		out := make([]any, len(val))
+		for i, item := range val {
+			out[i] = r.RedactValue(item)
+		}
+		return out
+	case string:
+		return r.RedactString(val)
+	default:
+		return v
+	}
+}
@@ -0,0 +1,331 @@
+// Package redis provides Redis backed implementations of the toolkit's stores, so that nonces,
+// quotas, scan results and object accesses are shared between instances, along with the locks
+// and rate limit windows which need a shared store to mean anything. It speaks the Redis
+// protocol itself, with pooled connections which are health checked before reuse, and
+// pipelines the commands of each operation into a single round trip.
+package redis
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrClosed is returned by a Client which has been closed
+var ErrClosed = errors.New("redis: client is closed")
+
+// Error is an error reply from the server
+type Error string
+
+func (e Error) Error() string {
+	return "redis: " + string(e)
+}
+
+// Client is a pool of connections to a Redis server. The zero value connects to
+// localhost:6379, and is safe for concurrent use.
+type Client struct {
+	// Addr is the server's host:port. Defaults to localhost:6379
+	Addr     string
+	Username string
+	Password string
+	// DB is the database selected on each connection
+	DB int
+	// TLSConfig enables TLS when set
+	TLSConfig *tls.Config
+	// MaxIdle is the most idle connections kept for reuse. Defaults to 4
+	MaxIdle int
+	// Timeout bounds dialing and each command, unless the context ends sooner. Defaults to 5s
+	Timeout time.Duration
+	// HealthCheckInterval is how long a connection may sit idle before it's checked with a
+	// PING when taken from the pool, so that connections the server or a proxy dropped are
+	// replaced rather than failing a command. Defaults to 30s
+	HealthCheckInterval time.Duration
+
+	mu     sync.Mutex
+	idle   []*conn
+	closed bool
+}
+
+type conn struct {
+	net.Conn
+	r    *bufio.Reader
+	used time.Time
+}
+
+func (c *Client) timeout() time.Duration {
+	if c.Timeout > 0 {
+		return c.Timeout
+	}
+	return 5 * time.Second
+}
+
+// Do runs a command, returning its reply: a string for simple and bulk strings, an int64 for
+// integers, a []any for arrays, and nil for a null reply. An error reply is returned as an
+// Error.
+func (c *Client) Do(ctx context.Context, args ...any) (any, error) {
+	replies, err := c.Pipeline(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	if e, ok := replies[0].(Error); ok {
+		return nil, e
+	}
+	return replies[0], nil
+}
+
+// Pipeline sends the commands together and returns their replies in order, as Do does, except
+// that error replies are returned in their place as Error values rather than failing the
+// pipeline. The commands are not atomic; other clients' commands may run between them.
+func (c *Client) Pipeline(ctx context.Context, cmds ...[]any) ([]any, error) {
+	var buf bytes.Buffer
+	for _, args := range cmds {
+		if err := writeCommand(&buf, args); err != nil {
+			return nil, err
+		}
+	}
+	cn, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	replies, err := c.roundTrip(ctx, cn, buf.Bytes(), len(cmds))
+	if err != nil {
+		// the connection's state is unknown after a network or protocol error
+		_ = cn.Close()
+		return nil, err
+	}
+	c.put(cn)
+	return replies, nil
+}
+
+// Ping checks that the server can be reached, for health checks
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.Do(ctx, "PING")
+	return err
+}
+
+// Close closes the idle connections, and connections in use as they are returned
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	for _, cn := range c.idle {
+		_ = cn.Close()
+	}
+	c.idle = nil
+	return nil
+}
+
+// roundTrip sends the encoded commands and reads n replies
+func (c *Client) roundTrip(ctx context.Context, cn *conn, cmds []byte, n int) ([]any, error) {
+	deadline := time.Now().Add(c.timeout())
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := cn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	if _, err := cn.Write(cmds); err != nil {
+		return nil, err
+	}
+
+	replies := make([]any, n)
+	for i := range replies {
+		reply, err := readReply(cn.r)
+		if err != nil {
+			return nil, err
+		}
+		replies[i] = reply
+	}
+	cn.used = time.Now()
+	return replies, nil
+}
+
+// get takes an idle connection, checking it first if it has been idle a while, or dials one
+func (c *Client) get(ctx context.Context) (*conn, error) {
+	interval := c.HealthCheckInterval
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	for {
+		c.mu.Lock()
+		if c.closed {
+			c.mu.Unlock()
+			return nil, ErrClosed
+		}
+		if len(c.idle) == 0 {
+			c.mu.Unlock()
+			return c.dial(ctx)
+		}
+		cn := c.idle[len(c.idle)-1]
+		c.idle = c.idle[:len(c.idle)-1]
+		c.mu.Unlock()
+
+		if time.Since(cn.used) < interval {
+			return cn, nil
+		}
+		if replies, err := c.roundTrip(ctx, cn, ping, 1); err == nil && replies[0] == "PONG" {
+			return cn, nil
+		}
+		_ = cn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (c *Client) put(cn *conn) {
+	maxIdle := c.MaxIdle
+	if maxIdle <= 0 {
+		maxIdle = 4
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed || len(c.idle) >= maxIdle {
+		_ = cn.Close()
+		return
+	}
+	c.idle = append(c.idle, cn)
+}
+
+func (c *Client) dial(ctx context.Context) (*conn, error) {
+	addr := c.Addr
+	if addr == "" {
+		addr = "localhost:6379"
+	}
+	d := net.Dialer{Timeout: c.timeout()}
+	nc, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if c.TLSConfig != nil {
+		config := c.TLSConfig.Clone()
+		if config.ServerName == "" {
+			config.ServerName, _, _ = net.SplitHostPort(addr)
+		}
+		tc := tls.Client(nc, config)
+		if err = tc.HandshakeContext(ctx); err != nil {
+			_ = nc.Close()
+			return nil, err
+		}
+		nc = tc
+	}
+
+	cn := &conn{Conn: nc, r: bufio.NewReader(nc)}
+	var setup bytes.Buffer
+	n := 0
+	if c.Password != "" {
+		n++
+		if c.Username != "" {
+			_ = writeCommand(&setup, []any{"AUTH", c.Username, c.Password})
+		} else {
+			_ = writeCommand(&setup, []any{"AUTH", c.Password})
+		}
+	}
+	if c.DB != 0 {
+		n++
+		_ = writeCommand(&setup, []any{"SELECT", c.DB})
+	}
+	if n > 0 {
+		replies, err := c.roundTrip(ctx, cn, setup.Bytes(), n)
+		if err == nil {
+			for _, reply := range replies {
+				if e, ok := reply.(Error); ok {
+					err = e
+					break
+				}
+			}
+		}
+		if err != nil {
+			_ = cn.Close()
+			return nil, err
+		}
+	}
+	return cn, nil
+}
+
+// ping is an encoded PING, for health checks
+var ping = []byte("*1\r\n$4\r\nPING\r\n")
+
+// writeCommand writes args as an array of bulk strings
+func writeCommand(w *bytes.Buffer, args []any) error {
+	fmt.Fprintf(w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		var s string
+		switch v := arg.(type) {
+		case string:
+			s = v
+		case []byte:
+			s = string(v)
+		case int:
+			s = strconv.Itoa(v)
+		case int64:
+			s = strconv.FormatInt(v, 10)
+		case float64:
+			s = strconv.FormatFloat(v, 'f', -1, 64)
+		case time.Duration:
+			s = strconv.FormatInt(v.Milliseconds(), 10)
+		default:
+			return fmt.Errorf("redis: unsupported argument type %T", arg)
+		}
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(s), s)
+	}
+	return nil
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return "", fmt.Errorf("redis: malformed reply %q", line)
+	}
+	return line[:len(line)-2], nil
+}
+
+func readReply(r *bufio.Reader) (any, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return Error(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err = io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]any, n)
+		for i := range items {
+			if items[i], err = readReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: malformed reply %q", line)
+}
@@ -0,0 +1,324 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testServer is an in-memory Redis server supporting the commands the package uses, with the
+// package's scripts run natively
+type testServer struct {
+	addr     string
+	password string
+
+	mu       sync.Mutex
+	data     map[string]string
+	hashes   map[string]map[string]int64
+	expires  map[string]time.Time
+	conns    []net.Conn
+	dials    int
+	commands []string
+}
+
+// newTestServer starts a server, which requires AUTH with password if it isn't empty
+func newTestServer(t *testing.T, password string) *testServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	s := &testServer{
+		addr:     ln.Addr().String(),
+		password: password,
+		data:     make(map[string]string),
+		hashes:   make(map[string]map[string]int64),
+		expires:  make(map[string]time.Time),
+	}
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns = append(s.conns, c)
+			s.dials++
+			s.mu.Unlock()
+			go s.serve(c)
+		}
+	}()
+	return s
+}
+
+// dropConns closes every connection, as a server restart would
+func (s *testServer) dropConns() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.conns {
+		_ = c.Close()
+	}
+	s.conns = nil
+}
+
+func (s *testServer) serve(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	w := bufio.NewWriter(c)
+	authed := s.password == ""
+	for {
+		reply, err := readReply(r)
+		if err != nil {
+			return
+		}
+		items, _ := reply.([]any)
+		args := make([]string, len(items))
+		for i, item := range items {
+			args[i], _ = item.(string)
+		}
+		if len(args) == 0 {
+			return
+		}
+
+		cmd := strings.ToUpper(args[0])
+		var out any
+		switch {
+		case cmd == "AUTH":
+			authed = args[len(args)-1] == s.password
+			out = status("OK")
+			if !authed {
+				out = Error("WRONGPASS invalid password")
+			}
+		case !authed:
+			out = Error("NOAUTH Authentication required")
+		default:
+			s.mu.Lock()
+			s.commands = append(s.commands, cmd)
+			out = s.exec(cmd, args[1:])
+			s.mu.Unlock()
+		}
+		writeTestReply(w, out)
+		if r.Buffered() == 0 {
+			_ = w.Flush()
+		}
+	}
+}
+
+type status string
+
+func (s *testServer) alive(key string) bool {
+	if exp, ok := s.expires[key]; ok && !time.Now().Before(exp) {
+		delete(s.data, key)
+		delete(s.hashes, key)
+		delete(s.expires, key)
+	}
+	_, ok := s.data[key]
+	_, hok := s.hashes[key]
+	return ok || hok
+}
+
+func (s *testServer) exec(cmd string, args []string) any {
+	switch cmd {
+	case "PING":
+		return status("PONG")
+	case "SELECT":
+		return status("OK")
+	case "GET":
+		if !s.alive(args[0]) {
+			return nil
+		}
+		return s.data[args[0]]
+	case "SET":
+		key, nx := args[0], false
+		var ttl time.Duration
+		for i := 2; i < len(args); i++ {
+			switch strings.ToUpper(args[i]) {
+			case "NX":
+				nx = true
+			case "PX":
+				ms, _ := strconv.Atoi(args[i+1])
+				ttl = time.Duration(ms) * time.Millisecond
+				i++
+			}
+		}
+		if nx && s.alive(key) {
+			return nil
+		}
+		s.data[key] = args[1]
+		delete(s.expires, key)
+		if ttl > 0 {
+			s.expires[key] = time.Now().Add(ttl)
+		}
+		return status("OK")
+	case "DEL":
+		existed := s.alive(args[0])
+		delete(s.data, args[0])
+		delete(s.expires, args[0])
+		if existed {
+			return int64(1)
+		}
+		return int64(0)
+	case "HINCRBY":
+		s.alive(args[0])
+		if s.hashes[args[0]] == nil {
+			s.hashes[args[0]] = make(map[string]int64)
+		}
+		n, _ := strconv.ParseInt(args[2], 10, 64)
+		s.hashes[args[0]][args[1]] += n
+		return s.hashes[args[0]][args[1]]
+	case "PEXPIREAT":
+		ms, _ := strconv.ParseInt(args[1], 10, 64)
+		s.expires[args[0]] = time.UnixMilli(ms)
+		return int64(1)
+	case "EVAL":
+		return s.eval(args[0], args[2], args[3:])
+	}
+	return Error("ERR unknown command '" + cmd + "'")
+}
+
+func (s *testServer) eval(script, key string, argv []string) any {
+	switch script {
+	case unlockScript, extendScript:
+		if !s.alive(key) || s.data[key] != argv[0] {
+			return int64(0)
+		}
+		if script == unlockScript {
+			delete(s.data, key)
+			delete(s.expires, key)
+		} else {
+			ms, _ := strconv.Atoi(argv[1])
+			s.expires[key] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		}
+		return int64(1)
+	case allowScript:
+		s.alive(key)
+		n, _ := strconv.ParseInt(s.data[key], 10, 64)
+		n++
+		s.data[key] = strconv.FormatInt(n, 10)
+		if n == 1 {
+			ms, _ := strconv.Atoi(argv[0])
+			s.expires[key] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		}
+		return []any{n, time.Until(s.expires[key]).Milliseconds()}
+	}
+	return Error("NOSCRIPT unknown script")
+}
+
+func writeTestReply(w *bufio.Writer, reply any) {
+	switch v := reply.(type) {
+	case nil:
+		fmt.Fprint(w, "$-1\r\n")
+	case status:
+		fmt.Fprintf(w, "+%s\r\n", v)
+	case Error:
+		fmt.Fprintf(w, "-%s\r\n", string(v))
+	case int64:
+		fmt.Fprintf(w, ":%d\r\n", v)
+	case string:
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+	case []any:
+		fmt.Fprintf(w, "*%d\r\n", len(v))
+		for _, item := range v {
+			writeTestReply(w, item)
+		}
+	}
+}
+
+func TestClient(t *testing.T) {
+	srv := newTestServer(t, "secret")
+	ctx := context.Background()
+
+	if err := (&Client{Addr: srv.addr}).Ping(ctx); err == nil || !strings.Contains(err.Error(), "NOAUTH") {
+		t.Errorf("expected an unauthenticated client to be refused, got %v", err)
+	}
+	if err := (&Client{Addr: srv.addr, Password: "wrong"}).Ping(ctx); err == nil {
+		t.Error("expected a wrong password to be refused")
+	}
+
+	c := &Client{Addr: srv.addr, Password: "secret", DB: 2}
+	t.Cleanup(func() { _ = c.Close() })
+	if err := c.Ping(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		args []any
+		want any
+	}{
+		{args: []any{"SET", "k", "v"}, want: "OK"},
+		{args: []any{"GET", "k"}, want: "v"},
+		{args: []any{"GET", "missing"}, want: nil},
+		{args: []any{"HINCRBY", "h", "f", int64(3)}, want: int64(3)},
+		{args: []any{"SET", "ttl", []byte("x"), "PX", time.Second}, want: "OK"},
+	}
+	for _, e := range tests {
+		got, err := c.Do(ctx, e.args...)
+		if err != nil || got != e.want {
+			t.Errorf("%v: expected %v, got %v and %v", e.args, e.want, got, err)
+		}
+	}
+
+	var rerr Error
+	if _, err := c.Do(ctx, "BOGUS"); !errors.As(err, &rerr) || !strings.Contains(err.Error(), "unknown command") {
+		t.Errorf("expected an error reply, got %v", err)
+	}
+	if _, err := c.Do(ctx, "SET", "k", struct{}{}); err == nil {
+		t.Error("expected an unsupported argument to fail")
+	}
+
+	// a pipeline is one round trip with its replies in order, error replies in place
+	replies, err := c.Pipeline(ctx, []any{"SET", "a", "1"}, []any{"BOGUS"}, []any{"GET", "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replies[0] != "OK" || replies[2] != "1" {
+		t.Errorf("unexpected pipeline replies %v", replies)
+	}
+	if _, ok := replies[1].(Error); !ok {
+		t.Errorf("expected an error reply in the pipeline, got %v", replies[1])
+	}
+
+	// everything so far ran on pooled connections, rather than one per command
+	srv.mu.Lock()
+	dials := srv.dials
+	srv.mu.Unlock()
+	if dials != 3 {
+		t.Errorf("expected 3 connections, got %d", dials)
+	}
+
+	_ = c.Close()
+	if err = c.Ping(ctx); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+}
+
+func TestClient_healthCheck(t *testing.T) {
+	srv := newTestServer(t, "")
+	ctx := context.Background()
+	c := &Client{Addr: srv.addr, HealthCheckInterval: time.Millisecond}
+	t.Cleanup(func() { _ = c.Close() })
+
+	if err := c.Ping(ctx); err != nil {
+		t.Fatal(err)
+	}
+	srv.dropConns()
+	time.Sleep(5 * time.Millisecond)
+
+	// the dropped connection fails its check and is replaced, rather than failing the command
+	if _, err := c.Do(ctx, "SET", "k", "v"); err != nil {
+		t.Fatalf("expected the command to run on a new connection, got %v", err)
+	}
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.dials != 2 {
+		t.Errorf("expected a second connection, got %d", srv.dials)
+	}
+}
@@ -0,0 +1,237 @@
+package redis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/kaliadmen/toolkit"
+)
+
+// ErrLocked is returned by Lock when another holder has the lock
+var ErrLocked = errors.New("redis: lock is held by another holder")
+
+// ErrLockLost is returned when a lock expired, or was taken over, before it was released or
+// extended
+var ErrLockLost = errors.New("redis: lock is no longer held")
+
+// NonceStore is a toolkit.NonceStore
+type NonceStore struct {
+	Client *Client
+	// Prefix is prepended to the keys. Defaults to toolkit:nonce:
+	Prefix string
+}
+
+// Use records a nonce as used until expires
+func (s *NonceStore) Use(ctx context.Context, nonce string, expires time.Time) error {
+	ttl := time.Until(expires)
+	if ttl < time.Millisecond {
+		// expired nonces are refused by their signatures, so there's nothing to remember
+		return nil
+	}
+	reply, err := s.Client.Do(ctx, "SET", prefixed(s.Prefix, "toolkit:nonce:", nonce), 1, "PX", ttl, "NX")
+	if err != nil {
+		return err
+	}
+	if reply == nil {
+		return toolkit.ErrNonceUsed
+	}
+	return nil
+}
+
+// QuotaStore is a toolkit.QuotaStore
+type QuotaStore struct {
+	Client *Client
+	// Prefix is prepended to the keys. Defaults to toolkit:quota:
+	Prefix string
+	// Retention is how long a window's usage is kept after it starts. Defaults to 35 days, to
+	// outlast monthly windows
+	Retention time.Duration
+}
+
+// Increment adds to the usage of key in the window starting at start, and returns the total
+func (s *QuotaStore) Increment(ctx context.Context, key string, start time.Time, requests, bytes int64) (toolkit.QuotaUsage, error) {
+	retention := s.Retention
+	if retention <= 0 {
+		retention = 35 * 24 * time.Hour
+	}
+	k := prefixed(s.Prefix, "toolkit:quota:", key) + ":" + strconv.FormatInt(start.Unix(), 10)
+	replies, err := s.Client.Pipeline(ctx,
+		[]any{"HINCRBY", k, "requests", requests},
+		[]any{"HINCRBY", k, "bytes", bytes},
+		[]any{"PEXPIREAT", k, start.Add(retention).UnixMilli()},
+	)
+	if err != nil {
+		return toolkit.QuotaUsage{}, err
+	}
+	var usage toolkit.QuotaUsage
+	if usage.Requests, err = replyInt(replies[0]); err != nil {
+		return toolkit.QuotaUsage{}, err
+	}
+	if usage.Bytes, err = replyInt(replies[1]); err != nil {
+		return toolkit.QuotaUsage{}, err
+	}
+	return usage, nil
+}
+
+// ScanResults is a toolkit.ScanResultStore
+type ScanResults struct {
+	Client *Client
+	// Prefix is prepended to the keys. Defaults to toolkit:scan:
+	Prefix string
+}
+
+// Get returns the result for sum, and false if there is none or it has expired
+func (s *ScanResults) Get(ctx context.Context, sum string) (string, bool, error) {
+	reply, err := s.Client.Do(ctx, "GET", prefixed(s.Prefix, "toolkit:scan:", sum))
+	if err != nil || reply == nil {
+		return "", false, err
+	}
+	result, ok := reply.(string)
+	if !ok {
+		return "", false, Error("unexpected reply to GET")
+	}
+	return result, true, nil
+}
+
+// Set stores the result for sum until expires
+func (s *ScanResults) Set(ctx context.Context, sum, result string, expires time.Time) error {
+	ttl := time.Until(expires)
+	if ttl < time.Millisecond {
+		return nil
+	}
+	_, err := s.Client.Do(ctx, "SET", prefixed(s.Prefix, "toolkit:scan:", sum), result, "PX", ttl)
+	return err
+}
+
+// AccessTracker is a toolkit.AccessTracker. Configure the server to persist its data, so
+// accesses survive restarts.
+type AccessTracker struct {
+	Client *Client
+	// Prefix is prepended to the keys. Defaults to toolkit:access:
+	Prefix string
+}
+
+// Touch records that key was read at at
+func (s *AccessTracker) Touch(ctx context.Context, key string, at time.Time) error {
+	_, err := s.Client.Do(ctx, "SET", prefixed(s.Prefix, "toolkit:access:", key), at.UnixMilli())
+	return err
+}
+
+// LastAccess returns when key was last read, and false if it hasn't been
+func (s *AccessTracker) LastAccess(ctx context.Context, key string) (time.Time, bool, error) {
+	reply, err := s.Client.Do(ctx, "GET", prefixed(s.Prefix, "toolkit:access:", key))
+	if err != nil || reply == nil {
+		return time.Time{}, false, err
+	}
+	ms, err := replyInt(reply)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return time.UnixMilli(ms), true, nil
+}
+
+// Lock is a lock held in Redis, which expires unless extended so that a crashed holder can't
+// hold it forever. It is only safe while a single server, or a primary with synchronous
+// replication, holds the data.
+type Lock struct {
+	client *Client
+	key    string
+	token  string
+}
+
+const unlockScript = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) end return 0`
+
+const extendScript = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("PEXPIRE", KEYS[1], ARGV[2]) end return 0`
+
+// Lock takes the lock called name for ttl, returning ErrLocked if another holder has it
+func (c *Client) Lock(ctx context.Context, name string, ttl time.Duration) (*Lock, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return nil, err
+	}
+	l := &Lock{client: c, key: "toolkit:lock:" + name, token: hex.EncodeToString(token)}
+	reply, err := c.Do(ctx, "SET", l.key, l.token, "PX", ttl, "NX")
+	if err != nil {
+		return nil, err
+	}
+	if reply == nil {
+		return nil, ErrLocked
+	}
+	return l, nil
+}
+
+// Extend sets the lock to expire ttl from now, returning ErrLockLost if it is no longer held
+func (l *Lock) Extend(ctx context.Context, ttl time.Duration) error {
+	return l.eval(ctx, extendScript, ttl)
+}
+
+// Unlock releases the lock, returning ErrLockLost if it is no longer held
+func (l *Lock) Unlock(ctx context.Context) error {
+	return l.eval(ctx, unlockScript)
+}
+
+func (l *Lock) eval(ctx context.Context, script string, args ...any) error {
+	reply, err := l.client.Do(ctx, append([]any{"EVAL", script, 1, l.key, l.token}, args...)...)
+	if err != nil {
+		return err
+	}
+	if n, _ := replyInt(reply); n == 0 {
+		return ErrLockLost
+	}
+	return nil
+}
+
+const allowScript = `local n = redis.call("INCR", KEYS[1])
+if n == 1 then redis.call("PEXPIRE", KEYS[1], ARGV[1]) end
+return {n, redis.call("PTTL", KEYS[1])}`
+
+// Allow counts a request by key in a fixed window, allowing limit requests per window across
+// every instance. When the limit is reached it returns false and how long until the window
+// resets, as toolkit.RateLimiter.Allow does. It is a toolkit.RateLimitStore, to set as a
+// RateLimiter's Store.
+func (c *Client) Allow(ctx context.Context, key string, limit int64, window time.Duration) (bool, time.Duration, error) {
+	reply, err := c.Do(ctx, "EVAL", allowScript, 1, "toolkit:ratelimit:"+key, window)
+	if err != nil {
+		return false, 0, err
+	}
+	items, ok := reply.([]any)
+	if !ok || len(items) != 2 {
+		return false, 0, Error("unexpected reply to rate limit script")
+	}
+	n, err := replyInt(items[0])
+	if err != nil {
+		return false, 0, err
+	}
+	if n <= limit {
+		return true, 0, nil
+	}
+	ttl, _ := replyInt(items[1])
+	if ttl < 0 {
+		ttl = window.Milliseconds()
+	}
+	return false, time.Duration(ttl) * time.Millisecond, nil
+}
+
+func prefixed(prefix, fallback, key string) string {
+	if prefix == "" {
+		prefix = fallback
+	}
+	return prefix + key
+}
+
+// replyInt reads an integer reply, or a bulk string holding one
+func replyInt(reply any) (int64, error) {
+	switch v := reply.(type) {
+	case int64:
+		return v, nil
+	case string:
+		return strconv.ParseInt(v, 10, 64)
+	case Error:
+		return 0, v
+	}
+	return 0, Error("unexpected reply type")
+}
@@ -0,0 +1,177 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kaliadmen/toolkit"
+)
+
+var (
+	_ toolkit.NonceStore      = (*NonceStore)(nil)
+	_ toolkit.QuotaStore      = (*QuotaStore)(nil)
+	_ toolkit.ScanResultStore = (*ScanResults)(nil)
+	_ toolkit.AccessTracker   = (*AccessTracker)(nil)
+	_ toolkit.RateLimitStore  = (*Client)(nil)
+)
+
+func TestNonceStore(t *testing.T) {
+	srv := newTestServer(t, "")
+	s := &NonceStore{Client: &Client{Addr: srv.addr}}
+	ctx := context.Background()
+
+	if err := s.Use(ctx, "n1", time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Use(ctx, "n1", time.Now().Add(time.Minute)); !errors.Is(err, toolkit.ErrNonceUsed) {
+		t.Errorf("expected ErrNonceUsed, got %v", err)
+	}
+	if err := s.Use(ctx, "n2", time.Now().Add(20*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if err := s.Use(ctx, "n2", time.Now().Add(time.Minute)); err != nil {
+		t.Errorf("expected an expired nonce to be forgotten, got %v", err)
+	}
+}
+
+func TestQuotaStore(t *testing.T) {
+	srv := newTestServer(t, "")
+	s := &QuotaStore{Client: &Client{Addr: srv.addr}}
+	ctx := context.Background()
+	start := time.Now().Truncate(time.Hour)
+
+	var tests = []struct {
+		start    time.Time
+		requests int64
+		bytes    int64
+		want     toolkit.QuotaUsage
+	}{
+		{start: start, requests: 1, bytes: 100, want: toolkit.QuotaUsage{Requests: 1, Bytes: 100}},
+		{start: start, requests: 1, bytes: 50, want: toolkit.QuotaUsage{Requests: 2, Bytes: 150}},
+		{start: start.Add(time.Hour), requests: 1, bytes: 10, want: toolkit.QuotaUsage{Requests: 1, Bytes: 10}},
+	}
+	for i, e := range tests {
+		got, err := s.Increment(ctx, "key", e.start, e.requests, e.bytes)
+		if err != nil || got != e.want {
+			t.Errorf("%d: expected %+v, got %+v and %v", i, e.want, got, err)
+		}
+	}
+
+	// the three commands of each increment were pipelined on one connection
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.dials != 1 || len(srv.commands) != 9 {
+		t.Errorf("expected 9 commands on 1 connection, got %d on %d", len(srv.commands), srv.dials)
+	}
+}
+
+func TestScanResults(t *testing.T) {
+	srv := newTestServer(t, "")
+	s := &ScanResults{Client: &Client{Addr: srv.addr}}
+	ctx := context.Background()
+
+	if _, found, err := s.Get(ctx, "sum"); found || err != nil {
+		t.Errorf("expected no result, got %v and %v", found, err)
+	}
+	_ = s.Set(ctx, "clean", "", time.Now().Add(time.Minute))
+	_ = s.Set(ctx, "bad", "virus found", time.Now().Add(time.Minute))
+	if result, found, _ := s.Get(ctx, "clean"); !found || result != "" {
+		t.Errorf("expected a clean result, got %q and %v", result, found)
+	}
+	if result, found, _ := s.Get(ctx, "bad"); !found || result != "virus found" {
+		t.Errorf("expected a rejection, got %q and %v", result, found)
+	}
+
+	// the store serves as a ScanCache's results, so each file is only scanned once
+	scans := 0
+	sc := &toolkit.ScanCache{Results: s, Scanner: func(ctx context.Context, name, contentType string, r io.Reader) error {
+		scans++
+		return nil
+	}}
+	for i := 0; i < 2; i++ {
+		if err := sc.Scan(ctx, "a.txt", "text/plain", strings.NewReader("hello")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if scans != 1 {
+		t.Errorf("expected 1 scan, got %d", scans)
+	}
+}
+
+func TestAccessTracker(t *testing.T) {
+	srv := newTestServer(t, "")
+	s := &AccessTracker{Client: &Client{Addr: srv.addr}}
+	ctx := context.Background()
+
+	if _, found, err := s.LastAccess(ctx, "a"); found || err != nil {
+		t.Errorf("expected no access, got %v and %v", found, err)
+	}
+	at := time.Now().Truncate(time.Millisecond)
+	if err := s.Touch(ctx, "a", at); err != nil {
+		t.Fatal(err)
+	}
+	if got, found, err := s.LastAccess(ctx, "a"); !found || err != nil || !got.Equal(at) {
+		t.Errorf("expected %v, got %v, %v and %v", at, got, found, err)
+	}
+}
+
+func TestLock(t *testing.T) {
+	srv := newTestServer(t, "")
+	c := &Client{Addr: srv.addr}
+	ctx := context.Background()
+
+	l, err := c.Lock(ctx, "job", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Lock(ctx, "job", time.Minute); !errors.Is(err, ErrLocked) {
+		t.Errorf("expected ErrLocked, got %v", err)
+	}
+	if err = l.Extend(ctx, time.Minute); err != nil {
+		t.Errorf("expected the lock to be extended, got %v", err)
+	}
+	if err = l.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err = l.Unlock(ctx); !errors.Is(err, ErrLockLost) {
+		t.Errorf("expected ErrLockLost, got %v", err)
+	}
+
+	// a lock which expired and was taken over can't be released by its first holder
+	old, _ := c.Lock(ctx, "short", 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	taken, err := c.Lock(ctx, "short", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = old.Unlock(ctx); !errors.Is(err, ErrLockLost) {
+		t.Errorf("expected ErrLockLost, got %v", err)
+	}
+	if err = taken.Unlock(ctx); err != nil {
+		t.Errorf("expected the new holder to release the lock, got %v", err)
+	}
+}
+
+func TestClient_Allow(t *testing.T) {
+	srv := newTestServer(t, "")
+	c := &Client{Addr: srv.addr}
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if ok, _, err := c.Allow(ctx, "ip", 3, time.Minute); !ok || err != nil {
+			t.Fatalf("%d: expected to be allowed, got %v", i, err)
+		}
+	}
+	ok, wait, err := c.Allow(ctx, "ip", 3, time.Minute)
+	if ok || err != nil || wait <= 0 || wait > time.Minute {
+		t.Errorf("expected to be limited for under a minute, got %v, %v and %v", ok, wait, err)
+	}
+	if ok, _, _ = c.Allow(ctx, "other", 3, time.Minute); !ok {
+		t.Error("expected keys to be limited separately")
+	}
+}
@@ -0,0 +1,178 @@
+package toolkit
+
+import (
+	"context"
+	"net"
+	"net/http"
+)
+
+// The keys of the values RequestContext stores, so every part of the toolkit, and the code
+// using it, finds them in the same place
+type (
+	requestIDContextKey struct{}
+	userIDContextKey    struct{}
+	tenantIDContextKey  struct{}
+	claimsContextKey    struct{}
+	loggerContextKey    struct{}
+	clientIPContextKey  struct{}
+)
+
+// RequestIDFromContext returns the request ID stored in ctx by RequestContext
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDContextKey{}).(string)
+	return id, ok
+}
+
+// ContextWithRequestID returns a copy of ctx carrying a request ID
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, id)
+}
+
+// UserIDFromContext returns the ID of the authenticated user stored in ctx
+func UserIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(userIDContextKey{}).(string)
+	return id, ok
+}
+
+// ContextWithUserID returns a copy of ctx carrying the ID of the authenticated user
+func ContextWithUserID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, userIDContextKey{}, id)
+}
+
+// TenantIDFromContext returns the ID of the tenant stored in ctx
+func TenantIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(tenantIDContextKey{}).(string)
+	return id, ok
+}
+
+// ContextWithTenantID returns a copy of ctx carrying the ID of the request's tenant
+func ContextWithTenantID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, tenantIDContextKey{}, id)
+}
+
+// ClaimsFromContext returns the claims of the authenticated user's token stored in ctx, such
+// as those of a LoginIdentity
+func ClaimsFromContext(ctx context.Context) (map[string]any, bool) {
+	claims, ok := ctx.Value(claimsContextKey{}).(map[string]any)
+	return claims, ok
+}
+
+// ContextWithClaims returns a copy of ctx carrying the claims of the user's token
+func ContextWithClaims(ctx context.Context, claims map[string]any) context.Context {
+	return context.WithValue(ctx, claimsContextKey{}, claims)
+}
+
+// LoggerFromContext returns the logger stored in ctx, or a Logger writing to the standard
+// logger if there's none, so it can always be used
+func LoggerFromContext(ctx context.Context) *Logger {
+	if l, ok := ctx.Value(loggerContextKey{}).(*Logger); ok {
+		return l
+	}
+	return &Logger{}
+}
+
+// ContextWithLogger returns a copy of ctx carrying l
+func ContextWithLogger(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, loggerContextKey{}, l)
+}
+
+// ClientIPFromContext returns the client address stored in ctx by RequestContext
+func ClientIPFromContext(ctx context.Context) (net.IP, bool) {
+	ip, ok := ctx.Value(clientIPContextKey{}).(net.IP)
+	return ip, ok
+}
+
+// ContextWithClientIP returns a copy of ctx carrying the client's address
+func ContextWithClientIP(ctx context.Context, ip net.IP) context.Context {
+	return context.WithValue(ctx, clientIPContextKey{}, ip)
+}
+
+// RequestContext stores the common values of a request in its context, where the accessors
+// above, and the toolkit's logs and audits, find them. Put it outside the other middleware,
+// with an authentication middleware between it and any which need the user.
+type RequestContext struct {
+	// RequestIDHeader names the header carrying the request ID, which is echoed in the
+	// response. Defaults to X-Request-ID
+	RequestIDHeader string
+	// TrustRequestID uses the ID a client or proxy sent, if it's at most 128 printable
+	// characters, instead of always generating one
+	TrustRequestID bool
+	// NewRequestID generates request IDs. Defaults to Tools.UUID
+	NewRequestID func() string
+	// TrustedProxies are the proxies whose X-Forwarded-For headers are believed for the
+	// client's address. The toolkit's middleware use the address stored here over their own
+	// TrustedProxies
+	TrustedProxies []*net.IPNet
+	// UserID, TenantID and Claims, if set, read the user, tenant and claims of a request, such
+	// as from a session or a verified token. Empty results aren't stored
+	UserID   func(r *http.Request) string
+	TenantID func(r *http.Request) string
+	Claims   func(r *http.Request) map[string]any
+	// Logger, if set, is stored for LoggerFromContext
+	Logger *Logger
+}
+
+// Middleware stores the request's values in its context before calling next
+func (rc *RequestContext) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := rc.RequestIDHeader
+		if header == "" {
+			header = "X-Request-ID"
+		}
+		id := r.Header.Get(header)
+		if !rc.TrustRequestID || !validRequestID(id) {
+			if rc.NewRequestID != nil {
+				id = rc.NewRequestID()
+			} else {
+				var t Tools
+				id = t.UUID()
+			}
+		}
+		w.Header().Set(header, id)
+
+		ctx := ContextWithRequestID(r.Context(), id)
+		if ip := ClientIP(r, rc.TrustedProxies); ip != nil {
+			ctx = ContextWithClientIP(ctx, ip)
+		}
+		if rc.UserID != nil {
+			if user := rc.UserID(r); user != "" {
+				ctx = ContextWithUserID(ctx, user)
+			}
+		}
+		if rc.TenantID != nil {
+			if tenant := rc.TenantID(r); tenant != "" {
+				ctx = ContextWithTenantID(ctx, tenant)
+			}
+		}
+		if rc.Claims != nil {
+			if claims := rc.Claims(r); claims != nil {
+				ctx = ContextWithClaims(ctx, claims)
+			}
+		}
+		if rc.Logger != nil {
+			ctx = ContextWithLogger(ctx, rc.Logger)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// requestClientIP returns the client address stored by RequestContext, so that middleware
+// agree on it, or else the address ClientIP finds with trustedProxies
+func requestClientIP(r *http.Request, trustedProxies []*net.IPNet) net.IP {
+	if ip, ok := ClientIPFromContext(r.Context()); ok {
+		return ip
+	}
+	return ClientIP(r, trustedProxies)
+}
@@ -0,0 +1,96 @@
+package toolkit
+
+import (
+	"bytes"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestContext(t *testing.T) {
+	var buf bytes.Buffer
+	logger := &Logger{Output: log.New(&buf, "", 0), Component: "api"}
+	rc := &RequestContext{
+		TrustRequestID: true,
+		TrustedProxies: []*net.IPNet{{IP: net.IPv4(10, 0, 0, 0), Mask: net.CIDRMask(8, 32)}},
+		UserID:         func(r *http.Request) string { return r.Header.Get("X-User") },
+		TenantID:       func(r *http.Request) string { return "acme" },
+		Claims:         func(r *http.Request) map[string]any { return map[string]any{"role": "admin"} },
+		Logger:         logger,
+	}
+
+	var got []string
+	h := rc.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		id, _ := RequestIDFromContext(ctx)
+		user, _ := UserIDFromContext(ctx)
+		tenant, _ := TenantIDFromContext(ctx)
+		claims, _ := ClaimsFromContext(ctx)
+		ip, _ := ClientIPFromContext(ctx)
+		got = []string{id, user, tenant, claims["role"].(string), ip.String()}
+		LoggerFromContext(ctx).Infof("handled")
+	}))
+
+	var tests = []struct {
+		name   string
+		header http.Header
+		want   []string
+	}{
+		{
+			name:   "trusted id",
+			header: http.Header{"X-Request-Id": {"req-1"}, "X-User": {"u7"}, "X-Forwarded-For": {"203.0.113.9"}},
+			want:   []string{"req-1", "u7", "acme", "admin", "203.0.113.9"},
+		},
+		{
+			name:   "bad id replaced",
+			header: http.Header{"X-Request-Id": {"has spaces"}},
+			want:   []string{"", "", "acme", "admin", "10.1.2.3"},
+		},
+	}
+	for _, e := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = "10.1.2.3:1234"
+		r.Header = e.header
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, r)
+
+		if e.want[0] == "" {
+			if len(got[0]) != 36 {
+				t.Errorf("%s: expected a generated ID, got %q", e.name, got[0])
+			}
+			e.want[0] = got[0]
+		}
+		if strings.Join(got, ",") != strings.Join(e.want, ",") {
+			t.Errorf("%s: expected %v, got %v", e.name, e.want, got)
+		}
+		if rr.Header().Get("X-Request-ID") != got[0] {
+			t.Errorf("%s: expected the request ID echoed, got %q", e.name, rr.Header().Get("X-Request-ID"))
+		}
+	}
+	if buf.String() != "[api] info: handled\n[api] info: handled\n" {
+		t.Errorf("unexpected log %q", buf.String())
+	}
+
+	// without a middleware, the accessors report nothing, and the logger still works
+	ctx := httptest.NewRequest("GET", "/", nil).Context()
+	if _, ok := UserIDFromContext(ctx); ok {
+		t.Error("expected no user")
+	}
+	if LoggerFromContext(ctx) == nil {
+		t.Error("expected a default logger")
+	}
+}
+
+func TestRequestContext_AccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	al := &AccessLog{Output: &buf, Format: JSONLogFormat}
+	rc := &RequestContext{NewRequestID: func() string { return "fixed" }, UserID: func(*http.Request) string { return "u1" }}
+	h := rc.Middleware(al.Middleware(http.NotFoundHandler()))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/x", nil))
+	if !strings.Contains(buf.String(), `"user":"u1","request_id":"fixed"`) {
+		t.Errorf("expected the user and request ID in the log, got %s", buf.String())
+	}
+}
@@ -0,0 +1,141 @@
+package toolkit
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrObjectChanged is sent when a download is resumed after the object was replaced, as the
+// bytes the client already has belong to the old version
+var ErrObjectChanged = errors.New("object has changed since the download started")
+
+// ResumeTokens lets clients resume large downloads which failed part way, even once the
+// signed URL they started from has expired. Downloads served through ServeObject carry a
+// token in their X-Resume-Token header, bound to the object's current version; a client whose
+// download breaks presents it to Handler with a Range header from the last byte it verified,
+// such as Range: bytes=734003200-, and gets the rest. Tokens are signed, so they need no
+// server-side state.
+type ResumeTokens struct {
+	// Key signs the tokens. It should be at least 32 random bytes, and differ from the key of
+	// any URLSigner
+	Key []byte
+	// Storage holds the objects downloaded
+	Storage Storage
+	// TTL is how long a download can be resumed for. Defaults to 24 hours
+	TTL time.Duration
+	// Tools writes errors and serves the objects. Defaults to the zero Tools
+	Tools *Tools
+}
+
+// ResumeToken is what a token grants: the rest of one version of an object
+type ResumeToken struct {
+	Key         string    `json:"k"`
+	DisplayName string    `json:"n,omitempty"`
+	Size        int64     `json:"s"`
+	ModTime     time.Time `json:"m"`
+	Expires     time.Time `json:"e"`
+}
+
+// Issue returns a token for resuming the download of an object
+func (rt *ResumeTokens) Issue(info ObjectInfo, displayName string) (string, error) {
+	if len(rt.Key) == 0 {
+		return "", errors.New("resume tokens have no key")
+	}
+	ttl := rt.TTL
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	payload, err := json.Marshal(ResumeToken{
+		Key:         info.Key,
+		DisplayName: displayName,
+		Size:        info.Size,
+		ModTime:     info.ModTime.UTC(),
+		Expires:     time.Now().Add(ttl).UTC().Truncate(time.Second),
+	})
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + rt.sign(encoded), nil
+}
+
+// Verify checks a token's signature and expiry, returning what it grants
+func (rt *ResumeTokens) Verify(token string) (ResumeToken, error) {
+	if len(rt.Key) == 0 {
+		return ResumeToken{}, errors.New("resume tokens have no key")
+	}
+	encoded, sig, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(rt.sign(encoded))) {
+		return ResumeToken{}, ErrInvalidSignature
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return ResumeToken{}, ErrInvalidSignature
+	}
+	var t ResumeToken
+	if err = json.Unmarshal(payload, &t); err != nil {
+		return ResumeToken{}, ErrInvalidSignature
+	}
+	if time.Now().After(t.Expires) {
+		return ResumeToken{}, ErrExpiredSignature
+	}
+	return t, nil
+}
+
+func (rt *ResumeTokens) sign(encoded string) string {
+	mac := hmac.New(sha256.New, rt.Key)
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (rt *ResumeTokens) tools() *Tools {
+	if rt.Tools != nil {
+		return rt.Tools
+	}
+	return &Tools{}
+}
+
+// ServeObject serves an object as Tools.ServeObject does, adding a resume token to the
+// response. Call it from handlers which have already checked the client may download the
+// object, such as by its signed URL.
+func (rt *ResumeTokens) ServeObject(w http.ResponseWriter, r *http.Request, key, displayName string) {
+	if info, err := rt.Storage.Stat(r.Context(), key); err == nil {
+		if token, err := rt.Issue(info, displayName); err == nil {
+			w.Header().Set("X-Resume-Token", token)
+		}
+	}
+	rt.tools().ServeObject(w, r, rt.Storage, key, displayName)
+}
+
+// Handler resumes downloads from the token in the X-Resume-Token header, or the token query
+// parameter. Invalid and expired tokens are refused with a 403, and tokens for objects which
+// have since been replaced or deleted with a 412 wrapping ErrObjectChanged.
+func (rt *ResumeTokens) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t := rt.tools()
+		token := r.Header.Get("X-Resume-Token")
+		if token == "" {
+			token = r.URL.Query().Get("token")
+		}
+		grant, err := rt.Verify(token)
+		if err != nil {
+			_ = t.ErrorJSON(w, err, http.StatusForbidden)
+			return
+		}
+
+		info, err := rt.Storage.Stat(r.Context(), grant.Key)
+		if err != nil || info.Size != grant.Size || !info.ModTime.Equal(grant.ModTime) {
+			_ = t.ErrorJSON(w, ErrObjectChanged, http.StatusPreconditionFailed)
+			return
+		}
+		// the token pins the version, so an If-Range the client sends can only agree with it
+		r.Header.Del("If-Range")
+		t.ServeObject(w, r, rt.Storage, grant.Key, grant.DisplayName)
+	})
+}
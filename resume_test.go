@@ -0,0 +1,73 @@
+package toolkit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResumeTokens(t *testing.T) {
+	dir, err := os.MkdirTemp("", "toolkit-resume")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := &FileStorage{Dir: dir}
+	ctx := context.Background()
+	if err = store.Put(ctx, "videos/talk.txt", strings.NewReader("0123456789abcdef")); err != nil {
+		t.Fatal(err)
+	}
+	rt := &ResumeTokens{Key: []byte("resume token key, not very secret"), Storage: store}
+
+	// the first download carries a token
+	rr := httptest.NewRecorder()
+	rt.ServeObject(rr, httptest.NewRequest("GET", "/download", nil), "videos/talk.txt", "talk.txt")
+	token := rr.Header().Get("X-Resume-Token")
+	if rr.Code != http.StatusOK || token == "" {
+		t.Fatalf("expected a download with a resume token, got %d %v", rr.Code, rr.Header())
+	}
+
+	resume := func(token, rng string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/resume", nil)
+		r.Header.Set("X-Resume-Token", token)
+		if rng != "" {
+			r.Header.Set("Range", rng)
+		}
+		rr := httptest.NewRecorder()
+		rt.Handler().ServeHTTP(rr, r)
+		return rr
+	}
+
+	rr = resume(token, "bytes=10-")
+	if rr.Code != http.StatusPartialContent || rr.Body.String() != "abcdef" {
+		t.Errorf("expected the rest of the file, got %d %q", rr.Code, rr.Body)
+	}
+	if !strings.Contains(rr.Header().Get("Content-Disposition"), "talk.txt") {
+		t.Errorf("expected the display name kept, got %v", rr.Header())
+	}
+
+	tampered := strings.Replace(token, token[:4], "eyJr", 1) + "x"
+	if rr = resume(tampered, ""); rr.Code != http.StatusForbidden {
+		t.Errorf("expected a tampered token refused, got %d", rr.Code)
+	}
+
+	expiring := &ResumeTokens{Key: rt.Key, Storage: store, TTL: time.Nanosecond}
+	old, _ := expiring.Issue(ObjectInfo{Key: "videos/talk.txt"}, "")
+	if _, err = rt.Verify(old); err != ErrExpiredSignature {
+		t.Errorf("expected an expired token, got %v", err)
+	}
+
+	// replacing the object invalidates the bytes the client has
+	time.Sleep(10 * time.Millisecond)
+	if err = store.Put(ctx, "videos/talk.txt", strings.NewReader("a new version")); err != nil {
+		t.Fatal(err)
+	}
+	if rr = resume(token, "bytes=10-"); rr.Code != http.StatusPreconditionFailed {
+		t.Errorf("expected a changed object refused, got %d %s", rr.Code, rr.Body)
+	}
+}
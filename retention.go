@@ -0,0 +1,178 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrObjectLocked is returned when an object under legal hold, or retained until a time which
+// hasn't passed, is deleted or overwritten
+var ErrObjectLocked = errors.New("object is locked by a legal hold or retention period")
+
+// The metadata keys holding an object's lock, stored with the object by SetLegalHold and
+// SetRetention
+const (
+	LegalHoldMetadata   = "legal-hold"
+	RetainUntilMetadata = "retain-until"
+)
+
+// ObjectLock is an object's legal hold and retention period
+type ObjectLock struct {
+	// LegalHold locks the object until the hold is removed, regardless of RetainUntil
+	LegalHold bool `json:"legal_hold"`
+	// RetainUntil, if set, locks the object until then
+	RetainUntil time.Time `json:"retain_until,omitempty"`
+}
+
+// Locked reports whether the lock prevents changes at now
+func (l ObjectLock) Locked(now time.Time) bool {
+	return l.LegalHold || now.Before(l.RetainUntil)
+}
+
+func objectLockFromMetadata(meta map[string]string) ObjectLock {
+	var l ObjectLock
+	l.LegalHold = meta[LegalHoldMetadata] == "true"
+	if until, err := time.Parse(time.RFC3339, meta[RetainUntilMetadata]); err == nil {
+		l.RetainUntil = until
+	}
+	return l
+}
+
+// GetObjectLock returns the lock on key, which is the zero ObjectLock if it has none. It
+// returns ErrNotSupported if the backend cannot store metadata.
+func GetObjectLock(ctx context.Context, s Storage, key string) (ObjectLock, error) {
+	meta, err := GetMetadata(ctx, s, key)
+	if err != nil {
+		return ObjectLock{}, err
+	}
+	return objectLockFromMetadata(meta), nil
+}
+
+// SetLegalHold places or removes a legal hold on key
+func SetLegalHold(ctx context.Context, s Storage, key string, hold bool) error {
+	meta, err := GetMetadata(ctx, s, key)
+	if err != nil {
+		return err
+	}
+	if hold {
+		meta[LegalHoldMetadata] = "true"
+	} else {
+		delete(meta, LegalHoldMetadata)
+	}
+	return setMetadata(ctx, s, key, meta)
+}
+
+// SetRetention retains key until the given time. As with S3's compliance mode, a retention
+// period can be extended but not shortened, so ErrObjectLocked is returned for an earlier time.
+func SetRetention(ctx context.Context, s Storage, key string, until time.Time) error {
+	meta, err := GetMetadata(ctx, s, key)
+	if err != nil {
+		return err
+	}
+	if current := objectLockFromMetadata(meta).RetainUntil; until.Before(current) {
+		return ErrObjectLocked
+	}
+	meta[RetainUntilMetadata] = until.UTC().Format(time.RFC3339)
+	return setMetadata(ctx, s, key, meta)
+}
+
+// setMetadata writes metadata past a LockedStorage, whose SetMetadata keeps the lock as it is
+func setMetadata(ctx context.Context, s Storage, key string, meta map[string]string) error {
+	if ls, ok := s.(*LockedStorage); ok {
+		s = ls.Storage
+	}
+	return SetMetadata(ctx, s, key, meta)
+}
+
+// LockedStorage is a Storage which enforces legal holds and retention periods, refusing to
+// delete or overwrite locked objects with ErrObjectLocked. Anything which cleans up storage
+// through it, such as ExportManager.Cleanup or Pastebin.Sweep, leaves locked objects alone.
+// Locks are kept in the objects' metadata, so the underlying Storage must be a
+// MetadataStorage; locks can be set through the LockedStorage with SetLegalHold and
+// SetRetention, but not removed or shortened with SetMetadata.
+type LockedStorage struct {
+	Storage Storage
+}
+
+func (ls *LockedStorage) check(ctx context.Context, key string) error {
+	lock, err := GetObjectLock(ctx, ls.Storage, key)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if lock.Locked(time.Now()) {
+		return ErrObjectLocked
+	}
+	return nil
+}
+
+// Put implements Storage, refusing to overwrite a locked object
+func (ls *LockedStorage) Put(ctx context.Context, key string, r io.Reader) error {
+	if err := ls.check(ctx, key); err != nil {
+		return err
+	}
+	return ls.Storage.Put(ctx, key, r)
+}
+
+// Get implements Storage
+func (ls *LockedStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	return ls.Storage.Get(ctx, key)
+}
+
+// Stat implements Storage
+func (ls *LockedStorage) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	return ls.Storage.Stat(ctx, key)
+}
+
+// Delete implements Storage, refusing to delete a locked object
+func (ls *LockedStorage) Delete(ctx context.Context, key string) error {
+	if err := ls.check(ctx, key); err != nil {
+		return err
+	}
+	return ls.Storage.Delete(ctx, key)
+}
+
+// List implements Storage
+func (ls *LockedStorage) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	return ls.Storage.List(ctx, prefix)
+}
+
+// Copy implements Copier, refusing to overwrite a locked object. Whether the lock is copied
+// with the metadata depends on the backend; FileStorage copies it.
+func (ls *LockedStorage) Copy(ctx context.Context, src, dst string) error {
+	if err := ls.check(ctx, dst); err != nil {
+		return err
+	}
+	return CopyObject(ctx, ls.Storage, src, dst)
+}
+
+// GetMetadata implements MetadataStorage
+func (ls *LockedStorage) GetMetadata(ctx context.Context, key string) (map[string]string, error) {
+	return GetMetadata(ctx, ls.Storage, key)
+}
+
+// SetMetadata implements MetadataStorage. The object's lock is kept as it is, whatever meta
+// holds.
+func (ls *LockedStorage) SetMetadata(ctx context.Context, key string, meta map[string]string) error {
+	current, err := GetMetadata(ctx, ls.Storage, key)
+	if err != nil {
+		return err
+	}
+
+	merged := make(map[string]string, len(meta))
+	for k, v := range meta {
+		if k != LegalHoldMetadata && k != RetainUntilMetadata {
+			merged[k] = v
+		}
+	}
+	for _, k := range []string{LegalHoldMetadata, RetainUntilMetadata} {
+		if v, ok := current[k]; ok {
+			merged[k] = v
+		}
+	}
+	return SetMetadata(ctx, ls.Storage, key, merged)
+}
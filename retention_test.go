@@ -0,0 +1,109 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLockedStorage(t *testing.T) {
+	ls := &LockedStorage{Storage: &FileStorage{Dir: t.TempDir()}}
+	ctx := context.Background()
+
+	for _, key := range []string{"free", "held", "retained", "expired"} {
+		if err := ls.Put(ctx, key, strings.NewReader(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := SetLegalHold(ctx, ls, "held", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetRetention(ctx, ls, "retained", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetRetention(ctx, ls, "expired", time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		key    string
+		locked bool
+	}{
+		{"free", false},
+		{"held", true},
+		{"retained", true},
+		{"expired", false},
+		{"missing", false},
+	}
+
+	for _, e := range tests {
+		err := ls.Put(ctx, e.key, strings.NewReader("overwritten"))
+		if e.locked != errors.Is(err, ErrObjectLocked) {
+			t.Errorf("%s: unexpected put error %v", e.key, err)
+		}
+		err = CopyObject(ctx, ls, "free", e.key)
+		if e.locked != errors.Is(err, ErrObjectLocked) {
+			t.Errorf("%s: unexpected copy error %v", e.key, err)
+		}
+		err = ls.Delete(ctx, e.key)
+		if e.locked != errors.Is(err, ErrObjectLocked) {
+			t.Errorf("%s: unexpected delete error %v", e.key, err)
+		}
+	}
+
+	// the lock can't be removed with SetMetadata
+	if err := ls.SetMetadata(ctx, "held", map[string]string{"owner": "legal"}); err != nil {
+		t.Fatal(err)
+	}
+	meta, _ := ls.GetMetadata(ctx, "held")
+	if meta["owner"] != "legal" || meta[LegalHoldMetadata] != "true" {
+		t.Errorf("unexpected metadata %v", meta)
+	}
+
+	// retention can be extended but not shortened
+	if err := SetRetention(ctx, ls, "retained", time.Now()); !errors.Is(err, ErrObjectLocked) {
+		t.Errorf("expected ErrObjectLocked shortening retention but got %v", err)
+	}
+	if err := SetRetention(ctx, ls, "retained", time.Now().Add(2*time.Hour)); err != nil {
+		t.Error(err)
+	}
+
+	// releasing the hold allows the object to be deleted
+	if err := SetLegalHold(ctx, ls, "held", false); err != nil {
+		t.Fatal(err)
+	}
+	if lock, err := GetObjectLock(ctx, ls, "held"); err != nil || lock.Locked(time.Now()) {
+		t.Errorf("expected the hold to be released, got %+v %v", lock, err)
+	}
+	if err := ls.Delete(ctx, "held"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestExportManager_CleanupLocked(t *testing.T) {
+	ls := &LockedStorage{Storage: &FileStorage{Dir: t.TempDir()}}
+	ctx := context.Background()
+
+	m := &ExportManager{Storage: ls}
+	_ = ls.Put(ctx, "exports/held.csv", strings.NewReader("a,b"))
+	_ = ls.Put(ctx, "exports/old.csv", strings.NewReader("c,d"))
+	_ = SetLegalHold(ctx, ls, "exports/held.csv", true)
+
+	past := time.Now().Add(-time.Minute)
+	m.exports = map[string]*Export{
+		"held": {ID: "held", Status: ExportReady, Key: "exports/held.csv", ExpiresAt: past},
+		"old":  {ID: "old", Status: ExportReady, Key: "exports/old.csv", ExpiresAt: past},
+	}
+
+	if err := m.Cleanup(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ls.Stat(ctx, "exports/held.csv"); err != nil {
+		t.Errorf("expected the held export to be kept: %v", err)
+	}
+	if _, err := ls.Stat(ctx, "exports/old.csv"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected the old export to be deleted but got %v", err)
+	}
+}
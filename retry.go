@@ -0,0 +1,252 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Jitter is how Retry randomises the delay between attempts, so that clients failing together
+// don't retry together
+type Jitter int
+
+const (
+	// FullJitter waits a random time up to the backoff delay. It spreads retries the most
+	FullJitter Jitter = iota
+	// EqualJitter waits half the backoff delay, and a random time up to the other half
+	EqualJitter
+	// DecorrelatedJitter waits a random time between the initial delay and three times the
+	// previous wait, capped at the maximum delay
+	DecorrelatedJitter
+	// NoJitter waits the backoff delay exactly
+	NoJitter
+)
+
+// RetryPolicy says how often, and how soon, a failed operation is retried. The zero value makes
+// three attempts with full jitter, backing off from 100ms.
+type RetryPolicy struct {
+	// MaxAttempts is the number of times the operation is run, including the first. Defaults
+	// to 3
+	MaxAttempts int
+	// InitialDelay is the backoff delay before the first retry. Defaults to 100ms
+	InitialDelay time.Duration
+	// MaxDelay caps the backoff delay. Defaults to 10 seconds
+	MaxDelay time.Duration
+	// Multiplier is the factor the backoff delay grows by for each retry. Defaults to 2
+	Multiplier float64
+	// Jitter defaults to FullJitter
+	Jitter Jitter
+	// MaxElapsed, if set, is the time after which no more retries are started, counted from
+	// the first attempt
+	MaxElapsed time.Duration
+	// Budget, if set, limits the retries made across all the operations sharing it
+	Budget *RetryBudget
+	// Retryable reports whether an error is worth retrying. Defaults to RetryableError
+	Retryable func(err error) bool
+}
+
+// DefaultRetryPolicy is used by Retry when given a nil policy
+var DefaultRetryPolicy = &RetryPolicy{}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying, whatever the policy's Retryable says. Retry returns
+// err itself, not the mark.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// RetryableError is the default RetryPolicy.Retryable. Every error is retried except context
+// errors, and *StatusError responses which won't succeed if sent again: client errors other
+// than 408 Request Timeout and 429 Too Many Requests, and 501 Not Implemented.
+func RetryableError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var se *StatusError
+	if errors.As(err, &se) {
+		switch {
+		case se.Status == http.StatusRequestTimeout, se.Status == http.StatusTooManyRequests:
+			return true
+		case se.Status < 500, se.Status == http.StatusNotImplemented:
+			return false
+		}
+	}
+	return true
+}
+
+// Retry runs op with policy, a nil one meaning DefaultRetryPolicy. See RetryPolicy.Do.
+func Retry(ctx context.Context, policy *RetryPolicy, op func() error) error {
+	if policy == nil {
+		policy = DefaultRetryPolicy
+	}
+	return policy.Do(ctx, op)
+}
+
+// Do runs op until it succeeds, or fails with an error which isn't retryable, or the attempts,
+// MaxElapsed, the budget or ctx run out, and returns its last error. Between attempts it waits
+// the backoff delay with jitter, or the delay a *StatusError asked for with Retry-After if that
+// is longer and no more than MaxDelay.
+func (p *RetryPolicy) Do(ctx context.Context, op func() error) error {
+	maxAttempts := p.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 3
+	}
+	initial := p.InitialDelay
+	if initial <= 0 {
+		initial = 100 * time.Millisecond
+	}
+	maxDelay := p.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = 10 * time.Second
+	}
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+	retryable := p.Retryable
+	if retryable == nil {
+		retryable = RetryableError
+	}
+
+	start := time.Now()
+	if p.Budget != nil {
+		p.Budget.deposit()
+	}
+	backoff, wait := initial, initial
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil {
+			return nil
+		}
+		var pe *permanentError
+		if errors.As(err, &pe) {
+			return pe.err
+		}
+		if attempt >= maxAttempts || !retryable(err) || ctx.Err() != nil {
+			return err
+		}
+
+		wait = p.jitter(backoff, wait, initial, maxDelay)
+		var se *StatusError
+		if errors.As(err, &se) && se.RetryAfter > wait && se.RetryAfter <= maxDelay {
+			wait = se.RetryAfter
+		}
+		if p.MaxElapsed > 0 && time.Since(start)+wait > p.MaxElapsed {
+			return err
+		}
+		if p.Budget != nil && !p.Budget.withdraw() {
+			return err
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		if backoff = time.Duration(float64(backoff) * multiplier); backoff > maxDelay {
+			backoff = maxDelay
+		}
+	}
+}
+
+// jitter returns the wait before the next retry, given its backoff delay and the last wait
+func (p *RetryPolicy) jitter(backoff, last, initial, maxDelay time.Duration) time.Duration {
+	switch p.Jitter {
+	case NoJitter:
+		return backoff
+	case EqualJitter:
+		return backoff/2 + randDuration(backoff/2)
+	case DecorrelatedJitter:
+		wait := initial + randDuration(3*last-initial)
+		if wait > maxDelay {
+			wait = maxDelay
+		}
+		return wait
+	}
+	return randDuration(backoff)
+}
+
+// randDuration returns a random duration from 0 up to d
+func randDuration(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+// RetryBudget limits retries to a fraction of the operations run, so that retries can't
+// multiply the load on a dependency which is already failing. Each operation adds Ratio of a
+// token, up to MinRetries, and each retry takes a whole one. Share one between the policies
+// calling the same dependency. The zero value allows retrying 10% of operations, and 10
+// retries in a burst.
+type RetryBudget struct {
+	// Ratio is the number of retries allowed per operation. Defaults to 0.1
+	Ratio float64
+	// MinRetries is the number of retries allowed before any operation has added to the
+	// budget, and the most it holds. Defaults to 10
+	MinRetries int
+
+	mu     sync.Mutex
+	init   bool
+	tokens float64
+}
+
+func (b *RetryBudget) max() float64 {
+	if b.MinRetries > 0 {
+		return float64(b.MinRetries)
+	}
+	return 10
+}
+
+func (b *RetryBudget) fill() {
+	if !b.init {
+		b.tokens = b.max()
+		b.init = true
+	}
+}
+
+func (b *RetryBudget) deposit() {
+	ratio := b.Ratio
+	if ratio <= 0 {
+		ratio = 0.1
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.fill()
+	if b.tokens += ratio; b.tokens > b.max() {
+		b.tokens = b.max()
+	}
+}
+
+func (b *RetryBudget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.fill()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// Remaining returns the number of retries the budget allows now
+func (b *RetryBudget) Remaining() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.fill()
+	return int(b.tokens)
+}
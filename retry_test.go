@@ -0,0 +1,125 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetry(t *testing.T) {
+	errFlaky := errors.New("flaky")
+	fast := RetryPolicy{InitialDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+
+	var tests = []struct {
+		name      string
+		policy    RetryPolicy
+		failures  int
+		err       error
+		wantCalls int
+		wantErr   error
+	}{
+		{name: "succeeds at once", policy: fast, wantCalls: 1},
+		{name: "succeeds on retry", policy: fast, failures: 2, err: errFlaky, wantCalls: 3},
+		{name: "runs out of attempts", policy: fast, failures: 5, err: errFlaky, wantCalls: 3, wantErr: errFlaky},
+		{name: "more attempts", policy: RetryPolicy{MaxAttempts: 5, InitialDelay: time.Millisecond, Jitter: NoJitter}, failures: 4, err: errFlaky, wantCalls: 5},
+		{name: "permanent", policy: fast, failures: 5, err: Permanent(errFlaky), wantCalls: 1, wantErr: errFlaky},
+		{name: "client error", policy: fast, failures: 5, err: &StatusError{Status: http.StatusBadRequest}, wantCalls: 1},
+		{name: "server error", policy: fast, failures: 1, err: &StatusError{Status: http.StatusBadGateway}, wantCalls: 2},
+		{name: "too many requests", policy: fast, failures: 1, err: &StatusError{Status: http.StatusTooManyRequests}, wantCalls: 2},
+		{name: "context error", policy: fast, failures: 5, err: context.DeadlineExceeded, wantCalls: 1, wantErr: context.DeadlineExceeded},
+		{name: "not retryable", policy: RetryPolicy{Retryable: func(error) bool { return false }}, failures: 5, err: errFlaky, wantCalls: 1, wantErr: errFlaky},
+		{name: "equal jitter", policy: RetryPolicy{InitialDelay: time.Millisecond, Jitter: EqualJitter}, failures: 2, err: errFlaky, wantCalls: 3},
+		{name: "decorrelated jitter", policy: RetryPolicy{InitialDelay: time.Millisecond, MaxDelay: 3 * time.Millisecond, Jitter: DecorrelatedJitter}, failures: 2, err: errFlaky, wantCalls: 3},
+		{name: "elapsed", policy: RetryPolicy{MaxAttempts: 10, InitialDelay: 50 * time.Millisecond, MaxElapsed: 10 * time.Millisecond, Jitter: NoJitter}, failures: 5, err: errFlaky, wantCalls: 1, wantErr: errFlaky},
+	}
+
+	for _, e := range tests {
+		policy := e.policy
+		calls := 0
+		err := policy.Do(context.Background(), func() error {
+			calls++
+			if calls <= e.failures {
+				return e.err
+			}
+			return nil
+		})
+		if calls != e.wantCalls {
+			t.Errorf("%s: expected %d calls, got %d", e.name, e.wantCalls, calls)
+		}
+		if e.wantErr != nil {
+			if !errors.Is(err, e.wantErr) {
+				t.Errorf("%s: expected %v, got %v", e.name, e.wantErr, err)
+			}
+			var pe *permanentError
+			if errors.As(err, &pe) {
+				t.Errorf("%s: expected the permanent mark to be removed", e.name)
+			}
+		} else if calls > e.failures && err != nil {
+			t.Errorf("%s: unexpected error %v", e.name, err)
+		}
+	}
+}
+
+func TestRetry_RetryAfter(t *testing.T) {
+	calls := 0
+	start := time.Now()
+	err := Retry(context.Background(), &RetryPolicy{InitialDelay: time.Millisecond, MaxDelay: time.Second}, func() error {
+		if calls++; calls == 1 {
+			return &StatusError{Status: http.StatusServiceUnavailable, RetryAfter: 30 * time.Millisecond}
+		}
+		return nil
+	})
+	if err != nil || calls != 2 {
+		t.Fatalf("expected success on the second call, got %d calls and %v", calls, err)
+	}
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("expected to wait for Retry-After, waited %v", elapsed)
+	}
+}
+
+func TestRetry_Context(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	errFlaky := errors.New("flaky")
+	calls := 0
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	err := Retry(ctx, &RetryPolicy{MaxAttempts: 100, InitialDelay: time.Hour, Jitter: NoJitter}, func() error {
+		calls++
+		return errFlaky
+	})
+	if !errors.Is(err, errFlaky) || calls != 1 {
+		t.Errorf("expected the wait to end with the context, got %d calls and %v", calls, err)
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	budget := &RetryBudget{Ratio: 0.5, MinRetries: 2}
+	policy := &RetryPolicy{MaxAttempts: 5, InitialDelay: time.Microsecond, Jitter: NoJitter, Budget: budget}
+	errDown := errors.New("down")
+
+	calls := 0
+	_ = policy.Do(context.Background(), func() error {
+		calls++
+		return errDown
+	})
+	// two retries from the initial budget, and the half token the operation added isn't enough
+	// for a third
+	if calls != 3 {
+		t.Errorf("expected 3 calls, got %d", calls)
+	}
+	if n := budget.Remaining(); n != 0 {
+		t.Errorf("expected the budget to be spent, got %d", n)
+	}
+
+	// successful operations refill it
+	for i := 0; i < 4; i++ {
+		_ = policy.Do(context.Background(), func() error { return nil })
+	}
+	if n := budget.Remaining(); n != 2 {
+		t.Errorf("expected the budget to refill to its maximum, got %d", n)
+	}
+}
@@ -0,0 +1,130 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrRetryQueued is returned by RetryQueue.Call when a call was rate limited and has been
+// rescheduled; its outcome is passed to the done function
+var ErrRetryQueued = errors.New("call was rate limited and has been queued")
+
+// RetryQueue reschedules outbound calls which a downstream refuses with a 429, or a 503, and a
+// Retry-After header, instead of failing them, running them again on a Runner once the delay
+// the server asked for has passed
+type RetryQueue struct {
+	// Runner runs the rescheduled calls. If nil, they run behind DefaultGuard. With a *Drainer,
+	// calls which come due after a drain has begun fail with ErrDraining.
+	Runner Runner
+	// MaxDelay is the longest Retry-After which is waited for; calls asked to wait longer fail
+	// at once. Defaults to one minute
+	MaxDelay time.Duration
+	// MaxDepth is the number of calls which may wait at once; calls beyond it fail at once.
+	// Defaults to 100
+	MaxDepth int
+	// MaxAttempts is the number of times a call is made, including the first. Defaults to 5
+	MaxAttempts int
+
+	mu      sync.Mutex
+	waiting int
+}
+
+func (q *RetryQueue) maxDelay() time.Duration {
+	if q.MaxDelay > 0 {
+		return q.MaxDelay
+	}
+	return time.Minute
+}
+
+func (q *RetryQueue) maxDepth() int {
+	if q.MaxDepth > 0 {
+		return q.MaxDepth
+	}
+	return 100
+}
+
+func (q *RetryQueue) maxAttempts() int {
+	if q.MaxAttempts > 0 {
+		return q.MaxAttempts
+	}
+	return 5
+}
+
+// Waiting returns the number of calls waiting to be retried
+func (q *RetryQueue) Waiting() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.waiting
+}
+
+// Call makes a call, such as a closure around CallJSONContext, with ctx. If it fails with a
+// *StatusError asking to retry later, the call is queued and ErrRetryQueued is returned;
+// done, if set, is later called with the outcome of the final attempt. Retries are made
+// with a background context, as ctx usually ends with the request which made the call.
+// Otherwise the call's own error is returned, and done is not called.
+func (q *RetryQueue) Call(ctx context.Context, call func(ctx context.Context) error, done func(err error)) error {
+	err := call(ctx)
+	delay, ok := q.retryable(err)
+	if !ok || !q.reserve() {
+		return err
+	}
+	q.schedule(call, done, delay, 2)
+	return ErrRetryQueued
+}
+
+// retryable returns the delay asked for by err, if the call may be retried after it
+func (q *RetryQueue) retryable(err error) (time.Duration, bool) {
+	var se *StatusError
+	if !errors.As(err, &se) || se.RetryAfter <= 0 || se.RetryAfter > q.maxDelay() {
+		return 0, false
+	}
+	if se.Status != http.StatusTooManyRequests && se.Status != http.StatusServiceUnavailable {
+		return 0, false
+	}
+	return se.RetryAfter, true
+}
+
+// reserve takes a place in the queue, if there is one
+func (q *RetryQueue) reserve() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.waiting >= q.maxDepth() {
+		return false
+	}
+	q.waiting++
+	return true
+}
+
+func (q *RetryQueue) schedule(call func(ctx context.Context) error, done func(err error), delay time.Duration, attempt int) {
+	time.AfterFunc(delay, func() {
+		run := func() {
+			err := call(context.Background())
+			if delay, ok := q.retryable(err); ok && attempt < q.maxAttempts() {
+				// keep the place in the queue
+				q.schedule(call, done, delay, attempt+1)
+				return
+			}
+			q.finish(done, err)
+		}
+
+		if q.Runner == nil {
+			Go(run)
+			return
+		}
+		if err := q.Runner.Go(run); err != nil {
+			q.finish(done, err)
+		}
+	})
+}
+
+func (q *RetryQueue) finish(done func(err error), err error) {
+	q.mu.Lock()
+	q.waiting--
+	q.mu.Unlock()
+	if done != nil {
+		done(err)
+	}
+}
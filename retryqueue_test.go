@@ -0,0 +1,155 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRetryQueue_Call(t *testing.T) {
+	limited := &StatusError{Status: http.StatusTooManyRequests, RetryAfter: 10 * time.Millisecond}
+	noRetryAfter := &StatusError{Status: http.StatusTooManyRequests}
+	failure := errors.New("failed")
+
+	var tests = []struct {
+		name      string
+		queue     *RetryQueue
+		responses []error
+		wantCall  error
+		wantDone  error
+		attempts  int
+	}{
+		{name: "success", queue: &RetryQueue{}, responses: []error{nil}, attempts: 1},
+		{name: "other error", queue: &RetryQueue{}, responses: []error{failure}, wantCall: failure, attempts: 1},
+		{name: "retried", queue: &RetryQueue{}, responses: []error{limited, limited, nil}, wantCall: ErrRetryQueued, attempts: 3},
+		{name: "retry fails", queue: &RetryQueue{}, responses: []error{limited, failure}, wantCall: ErrRetryQueued, wantDone: failure, attempts: 2},
+		{name: "attempts", queue: &RetryQueue{MaxAttempts: 2}, responses: []error{limited, limited, nil}, wantCall: ErrRetryQueued, wantDone: limited, attempts: 2},
+		{name: "too long", queue: &RetryQueue{MaxDelay: time.Millisecond}, responses: []error{limited}, wantCall: limited, attempts: 1},
+		{name: "no retry after", queue: &RetryQueue{}, responses: []error{noRetryAfter}, wantCall: noRetryAfter, attempts: 1},
+	}
+
+	for _, e := range tests {
+		var mu sync.Mutex
+		attempts := 0
+		call := func(ctx context.Context) error {
+			mu.Lock()
+			defer mu.Unlock()
+			err := e.responses[attempts]
+			attempts++
+			return err
+		}
+		finished := make(chan error, 1)
+
+		err := e.queue.Call(context.Background(), call, func(err error) { finished <- err })
+		if !errors.Is(err, e.wantCall) {
+			t.Errorf("%s: expected %v, got %v", e.name, e.wantCall, err)
+			continue
+		}
+		if err == ErrRetryQueued {
+			select {
+			case err = <-finished:
+				if err != e.wantDone {
+					t.Errorf("%s: expected done with %v, got %v", e.name, e.wantDone, err)
+				}
+			case <-time.After(time.Second):
+				t.Errorf("%s: the queued call never finished", e.name)
+				continue
+			}
+		}
+		mu.Lock()
+		if attempts != e.attempts {
+			t.Errorf("%s: expected %d attempts, got %d", e.name, e.attempts, attempts)
+		}
+		mu.Unlock()
+		if n := e.queue.Waiting(); n != 0 {
+			t.Errorf("%s: expected an empty queue, got %d waiting", e.name, n)
+		}
+	}
+}
+
+func TestRetryQueue_MaxDepth(t *testing.T) {
+	q := RetryQueue{MaxDepth: 1}
+	release := make(chan struct{})
+	limited := func(ctx context.Context) error {
+		select {
+		case <-release:
+			return nil
+		default:
+			return &StatusError{Status: http.StatusServiceUnavailable, RetryAfter: 10 * time.Millisecond}
+		}
+	}
+	finished := make(chan error, 1)
+
+	if err := q.Call(context.Background(), limited, func(err error) { finished <- err }); err != ErrRetryQueued {
+		t.Fatalf("expected the first call to be queued, got %v", err)
+	}
+	var se *StatusError
+	if err := q.Call(context.Background(), limited, nil); !errors.As(err, &se) {
+		t.Errorf("expected a full queue to fail the call, got %v", err)
+	}
+	close(release)
+	if err := <-finished; err != nil {
+		t.Errorf("expected the queued call to succeed, got %v", err)
+	}
+}
+
+func TestRetryQueue_Runner(t *testing.T) {
+	var d Drainer
+	q := RetryQueue{Runner: &d}
+	call := func(ctx context.Context) error {
+		return &StatusError{Status: http.StatusTooManyRequests, RetryAfter: 20 * time.Millisecond}
+	}
+	finished := make(chan error, 1)
+	if err := q.Call(context.Background(), call, func(err error) { finished <- err }); err != ErrRetryQueued {
+		t.Fatalf("expected the call to be queued, got %v", err)
+	}
+	if err := d.Drain(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-finished; err != ErrDraining {
+		t.Errorf("expected a call due after the drain to fail with ErrDraining, got %v", err)
+	}
+}
+
+func TestTools_CallJSON_StatusError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "3")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	var tools Tools
+	status, err := tools.CallJSON(srv.Client(), http.MethodGet, srv.URL, nil, nil)
+	var se *StatusError
+	if status != http.StatusTooManyRequests || !errors.As(err, &se) {
+		t.Fatalf("expected a status error, got %d %v", status, err)
+	}
+	if se.RetryAfter != 3*time.Second {
+		t.Errorf("expected a 3s Retry-After, got %s", se.RetryAfter)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	var tests = []struct {
+		value string
+		min   time.Duration
+		max   time.Duration
+	}{
+		{value: "", min: 0, max: 0},
+		{value: "120", min: 2 * time.Minute, max: 2 * time.Minute},
+		{value: "-1", min: 0, max: 0},
+		{value: "soon", min: 0, max: 0},
+		{value: time.Now().Add(time.Minute).UTC().Format(http.TimeFormat), min: 58 * time.Second, max: time.Minute},
+		{value: time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat), min: 0, max: 0},
+	}
+
+	for _, e := range tests {
+		if got := parseRetryAfter(e.value); got < e.min || got > e.max {
+			t.Errorf("%q: expected between %s and %s, got %s", e.value, e.min, e.max, got)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Route is an entry of a Router's table
+type Route struct {
+	// Method is the request method the route answers, such as GET. Empty answers any method
+	Method string
+	// Pattern is the path the route answers, whose segments are literals, parameters such as
+	// {id}, which match one segment, or a final {name...}, which matches the rest of the path,
+	// as in /files/{path...}
+	Pattern string
+	Handler http.Handler
+	// Middleware wraps Handler, the first outermost
+	Middleware []func(http.Handler) http.Handler
+}
+
+// Router dispatches requests to the handler of the route matching their method and path. It's
+// an http.Handler, so it can be served, mounted under a prefix with http.StripPrefix, or
+// wrapped in middleware like any other. Routes are matched most specific first, whatever
+// their order: literal segments win over parameters, which win over a trailing {name...}, so
+// /users/me wins over /users/{id}.
+//
+// A path matched by routes for other methods only is answered with a 405 and an Allow header
+// listing them, and OPTIONS requests without a route of their own with a 204 and the same
+// header. HEAD requests without a route of their own are answered by the GET route, without
+// the body, as HeadMiddleware does. The table is built on the first request, so routes must be added before serving.
+type Router struct {
+	Routes []Route
+	// Middleware wraps every route's handler, outside the route's own middleware
+	Middleware []func(http.Handler) http.Handler
+	// NotFound answers requests no route matches. Defaults to a JSON 404
+	NotFound http.Handler
+	// Tools writes the 404 and 405 errors. Defaults to the zero Tools
+	Tools *Tools
+
+	once  sync.Once
+	table []compiledRoute
+}
+
+type compiledRoute struct {
+	method   string
+	segments []string
+	// rank orders routes by specificity, one character per segment
+	rank    string
+	handler http.Handler
+}
+
+type routeParamsContextKey struct{}
+
+// Handle adds a route for method and pattern to the table
+func (rt *Router) Handle(method, pattern string, h http.Handler, middleware ...func(http.Handler) http.Handler) {
+	rt.Routes = append(rt.Routes, Route{Method: method, Pattern: pattern, Handler: h, Middleware: middleware})
+}
+
+// HandleFunc adds a route for method and pattern to the table
+func (rt *Router) HandleFunc(method, pattern string, h http.HandlerFunc, middleware ...func(http.Handler) http.Handler) {
+	rt.Handle(method, pattern, h, middleware...)
+}
+
+func (rt *Router) compile() {
+	for _, route := range rt.Routes {
+		h := route.Handler
+		for i := len(route.Middleware) - 1; i >= 0; i-- {
+			h = route.Middleware[i](h)
+		}
+		for i := len(rt.Middleware) - 1; i >= 0; i-- {
+			h = rt.Middleware[i](h)
+		}
+		c := compiledRoute{method: strings.ToUpper(route.Method), segments: splitRoutePath(route.Pattern), handler: h}
+		var rank strings.Builder
+		for _, s := range c.segments {
+			switch {
+			case strings.HasSuffix(s, "...}"):
+				rank.WriteByte('c')
+			case strings.HasPrefix(s, "{"):
+				rank.WriteByte('b')
+			default:
+				rank.WriteByte('a')
+			}
+		}
+		c.rank = rank.String()
+		rt.table = append(rt.table, c)
+	}
+	sort.SliceStable(rt.table, func(i, j int) bool {
+		a, b := rt.table[i], rt.table[j]
+		if a.rank != b.rank {
+			// a trailing {name...} matches any longer path, so it goes after them all
+			if wa, wb := strings.HasSuffix(a.rank, "c"), strings.HasSuffix(b.rank, "c"); wa != wb {
+				return wb
+			}
+			return a.rank < b.rank
+		}
+		// routes for a method before those for any method
+		return a.method != "" && b.method == ""
+	})
+}
+
+func splitRoutePath(p string) []string {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return nil
+	}
+	return strings.Split(p, "/")
+}
+
+// match reports whether the route matches the path's segments, and the values of its
+// parameters
+func (c *compiledRoute) match(segments []string) (map[string]string, bool) {
+	var params map[string]string
+	for i, s := range c.segments {
+		if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "...}") {
+			if params == nil {
+				params = make(map[string]string)
+			}
+			rest := make([]string, 0, len(segments)-i)
+			for _, seg := range segments[i:] {
+				v, _ := url.PathUnescape(seg)
+				rest = append(rest, v)
+			}
+			params[s[1:len(s)-4]] = strings.Join(rest, "/")
+			return params, true
+		}
+		if i >= len(segments) {
+			return nil, false
+		}
+		if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
+			if segments[i] == "" {
+				return nil, false
+			}
+			if params == nil {
+				params = make(map[string]string)
+			}
+			params[s[1:len(s)-1]], _ = url.PathUnescape(segments[i])
+		} else if s != segments[i] {
+			return nil, false
+		}
+	}
+	return params, len(segments) == len(c.segments)
+}
+
+// ServeHTTP dispatches the request to the matching route
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rt.once.Do(rt.compile)
+	p := r.URL.EscapedPath()
+	segments := splitRoutePath(p)
+
+	var allowed []string
+	var head *compiledRoute
+	var headParams map[string]string
+	for i := range rt.table {
+		c := &rt.table[i]
+		params, ok := c.match(segments)
+		if !ok {
+			continue
+		}
+		if c.method != "" && c.method != r.Method {
+			allowed = appendMethod(allowed, c.method)
+			if c.method == http.MethodGet {
+				allowed = appendMethod(allowed, http.MethodHead)
+				if r.Method == http.MethodHead && head == nil {
+					head, headParams = c, params
+				}
+			}
+			continue
+		}
+		rt.serve(w, r, c, params)
+		return
+	}
+	if head != nil {
+		// a HEAD request without a route of its own is answered by the GET route
+		r = r.Clone(r.Context())
+		r.Method = http.MethodGet
+		hw := &headWriter{ResponseWriter: w}
+		rt.serve(hw, r, head, headParams)
+		hw.commit()
+		return
+	}
+
+	t := rt.Tools
+	if t == nil {
+		t = &Tools{}
+	}
+	switch {
+	case len(allowed) > 0 && r.Method == http.MethodOptions:
+		w.Header().Set("Allow", strings.Join(appendMethod(allowed, http.MethodOptions), ", "))
+		w.WriteHeader(http.StatusNoContent)
+	case len(allowed) > 0:
+		w.Header().Set("Allow", strings.Join(appendMethod(allowed, http.MethodOptions), ", "))
+		_ = t.ErrorJSON(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+	case rt.NotFound != nil:
+		rt.NotFound.ServeHTTP(w, r)
+	default:
+		_ = t.ErrorJSON(w, errors.New("not found"), http.StatusNotFound)
+	}
+}
+
+func (rt *Router) serve(w http.ResponseWriter, r *http.Request, c *compiledRoute, params map[string]string) {
+	if len(params) > 0 {
+		r = r.WithContext(context.WithValue(r.Context(), routeParamsContextKey{}, params))
+	}
+	c.handler.ServeHTTP(w, r)
+}
+
+func appendMethod(methods []string, method string) []string {
+	for _, m := range methods {
+		if m == method {
+			return methods
+		}
+	}
+	return append(methods, method)
+}
+
+// PathParam returns the value of the route parameter name for a request dispatched by a
+// Router, such as the id of /users/{id}, or "" if there's none
+func PathParam(r *http.Request, name string) string {
+	params, _ := r.Context().Value(routeParamsContextKey{}).(map[string]string)
+	return params[name]
+}
+
+// PathParams returns all the route parameters of a request dispatched by a Router
+func PathParams(r *http.Request) map[string]string {
+	params, _ := r.Context().Value(routeParamsContextKey{}).(map[string]string)
+	return params
+}
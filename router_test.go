@@ -0,0 +1,106 @@
+package toolkit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRouter(t *testing.T) {
+	reply := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			params := PathParams(r)
+			keys := make([]string, 0, len(params))
+			for _, k := range []string{"id", "path", "version"} {
+				if v, ok := params[k]; ok {
+					keys = append(keys, k+"="+v)
+				}
+			}
+			_, _ = w.Write([]byte(strings.Join(append([]string{name}, keys...), " ")))
+		}
+	}
+	tag := func(name string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Add("X-Middleware", name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	rt := &Router{
+		Routes: []Route{
+			{Method: "GET", Pattern: "/users/{id}", Handler: reply("get user")},
+			{Method: "GET", Pattern: "/users/me", Handler: reply("me")},
+		},
+		Middleware: []func(http.Handler) http.Handler{tag("router")},
+	}
+	rt.HandleFunc("DELETE", "/users/{id}", reply("delete user"), tag("route"))
+	rt.HandleFunc("GET", "/files/{path...}", reply("file"))
+	rt.HandleFunc("", "/api/{version}/ping", reply("ping"))
+	rt.HandleFunc("GET", "/", reply("home"))
+
+	var tests = []struct {
+		method, target string
+		status         int
+		body           string
+		allow          string
+	}{
+		{method: "GET", target: "/users/42", status: 200, body: "get user id=42"},
+		{method: "GET", target: "/users/me", status: 200, body: "me"},
+		// a less specific route answers the methods the literal one doesn't
+		{method: "DELETE", target: "/users/me", status: 200, body: "delete user id=me"},
+		{method: "GET", target: "/users/a%20b", status: 200, body: "get user id=a b"},
+		{method: "GET", target: "/files/docs/a.txt", status: 200, body: "file path=docs/a.txt"},
+		{method: "POST", target: "/api/v2/ping", status: 200, body: "ping version=v2"},
+		{method: "GET", target: "/", status: 200, body: "home"},
+		{method: "PUT", target: "/users/42", status: 405, allow: "GET, HEAD, DELETE, OPTIONS"},
+		{method: "OPTIONS", target: "/users/42", status: 204, allow: "GET, HEAD, DELETE, OPTIONS"},
+		{method: "HEAD", target: "/users/42", status: 200, body: ""},
+		{method: "GET", target: "/users/", status: 404},
+		{method: "GET", target: "/users/42/posts", status: 404},
+	}
+	for _, e := range tests {
+		rr := httptest.NewRecorder()
+		rt.ServeHTTP(rr, httptest.NewRequest(e.method, e.target, nil))
+		if rr.Code != e.status {
+			t.Errorf("%s %s: expected %d, got %d", e.method, e.target, e.status, rr.Code)
+			continue
+		}
+		if (e.body != "" || e.method == "HEAD") && rr.Body.String() != e.body {
+			t.Errorf("%s %s: expected %q, got %q", e.method, e.target, e.body, rr.Body)
+		}
+		if got := rr.Header().Get("Allow"); got != e.allow {
+			t.Errorf("%s %s: expected Allow %q, got %q", e.method, e.target, e.allow, got)
+		}
+	}
+
+	// the router's middleware wraps the route's
+	rr := httptest.NewRecorder()
+	rt.ServeHTTP(rr, httptest.NewRequest("DELETE", "/users/1", nil))
+	if got := rr.Header()["X-Middleware"]; strings.Join(got, ",") != "router,route" {
+		t.Errorf("unexpected middleware order %v", got)
+	}
+}
+
+func TestRouter_Mount(t *testing.T) {
+	api := &Router{}
+	api.HandleFunc("GET", "/items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(PathParam(r, "id")))
+	})
+	mux := http.NewServeMux()
+	mux.Handle("/api/", http.StripPrefix("/api", api))
+	mux.Handle("/missing", &Router{NotFound: http.NotFoundHandler()})
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/api/items/7", nil))
+	if rr.Code != 200 || rr.Body.String() != "7" {
+		t.Errorf("unexpected %d %q", rr.Code, rr.Body)
+	}
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/missing", nil))
+	if rr.Code != 404 || !strings.Contains(rr.Body.String(), "404 page not found") {
+		t.Errorf("expected the NotFound handler, got %d %q", rr.Code, rr.Body)
+	}
+}
@@ -0,0 +1,302 @@
+// Package scaffold generates CRUD handler skeletons for a struct: a store interface, handlers
+// wired to the toolkit's ReadJSON, WriteJSON and ErrorJSON, validation from the struct's
+// validate tags, an OpenAPI description of the routes, and tests. Run it with go generate:
+//
+//	//go:generate go run github.com/kaliadmen/toolkit/cmd/scaffold -type Widget
+//
+// The output is a starting point to edit, so existing files are not overwritten.
+package scaffold
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Field is a field of the scaffolded struct
+type Field struct {
+	Name string
+	// Type is the field's Go type, as written
+	Type string
+	// JSON is the field's name in JSON
+	JSON string
+	// Kind is the field's JSON schema type: string, integer, number, boolean, array or object
+	Kind string
+	// Format is the JSON schema format, such as date-time, if any
+	Format string
+	// Checks are the Go conditions, on v, which make the field invalid, with their messages
+	Checks []Check
+	// Required is set by the required rule
+	Required bool
+	// Sample is a Go expression for a value which passes the checks, or "" if the zero value does
+	Sample string
+}
+
+// Check is a validation generated from a validate tag
+type Check struct {
+	Invalid string
+	Message string
+}
+
+// Spec describes the struct handlers are generated for
+type Spec struct {
+	Package string
+	Type    string
+	Fields  []Field
+	// IDField is the field holding the ID, which must be a string
+	IDField string
+}
+
+// Parse finds the struct named typeName in a Go source file. The struct must have a string
+// ID field. Validate tags may use the rules required, min=N and max=N, which limit the length
+// of strings and slices and the value of numbers.
+func Parse(filename string, src []byte, typeName string) (*Spec, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, src, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var st *ast.StructType
+	ast.Inspect(f, func(n ast.Node) bool {
+		if ts, ok := n.(*ast.TypeSpec); ok && ts.Name.Name == typeName {
+			st, _ = ts.Type.(*ast.StructType)
+			return false
+		}
+		return st == nil
+	})
+	if st == nil {
+		return nil, fmt.Errorf("struct %s not found in %s", typeName, filename)
+	}
+
+	spec := &Spec{Package: f.Name.Name, Type: typeName}
+	for _, field := range st.Fields.List {
+		var tag reflect.StructTag
+		if field.Tag != nil {
+			unquoted, _ := strconv.Unquote(field.Tag.Value)
+			tag = reflect.StructTag(unquoted)
+		}
+		jsonName, _, _ := strings.Cut(tag.Get("json"), ",")
+		if jsonName == "-" {
+			continue
+		}
+
+		for _, name := range field.Names {
+			if !name.IsExported() {
+				continue
+			}
+			fd := Field{Name: name.Name, Type: types.ExprString(field.Type), JSON: jsonName}
+			if fd.JSON == "" {
+				fd.JSON = name.Name
+			}
+			fd.Kind, fd.Format = schemaType(field.Type)
+			if fd.Checks, err = checks(fd, tag.Get("validate")); err != nil {
+				return nil, err
+			}
+			fd.Required, fd.Sample = sample(fd, tag.Get("validate"))
+			if name.Name == "ID" {
+				if fd.Type != "string" {
+					return nil, fmt.Errorf("%s.ID must be a string", typeName)
+				}
+				// the store assigns IDs, so they aren't validated
+				fd.Checks, fd.Required, fd.Sample = nil, false, ""
+				spec.IDField = fd.JSON
+			}
+			spec.Fields = append(spec.Fields, fd)
+		}
+	}
+	if spec.IDField == "" {
+		return nil, fmt.Errorf("%s has no ID field", typeName)
+	}
+	return spec, nil
+}
+
+func schemaType(expr ast.Expr) (kind, format string) {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		switch {
+		case t.Name == "string":
+			return "string", ""
+		case t.Name == "bool":
+			return "boolean", ""
+		case strings.HasPrefix(t.Name, "int") || strings.HasPrefix(t.Name, "uint"):
+			return "integer", ""
+		case strings.HasPrefix(t.Name, "float"):
+			return "number", ""
+		}
+	case *ast.SelectorExpr:
+		if types.ExprString(t) == "time.Time" {
+			return "string", "date-time"
+		}
+	case *ast.StarExpr:
+		return schemaType(t.X)
+	case *ast.ArrayType:
+		if types.ExprString(t) == "[]byte" {
+			return "string", "byte"
+		}
+		return "array", ""
+	}
+	return "object", ""
+}
+
+func checks(f Field, tag string) ([]Check, error) {
+	if tag == "" {
+		return nil, nil
+	}
+
+	field := "v." + f.Name
+	var out []Check
+	for _, rule := range strings.Split(tag, ",") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		switch name {
+		case "required":
+			var invalid string
+			switch {
+			case f.Type == "time.Time":
+				invalid = field + ".IsZero()"
+			case f.Kind == "string" && f.Type == "string":
+				invalid = field + ` == ""`
+			case f.Kind == "integer" || f.Kind == "number":
+				invalid = field + " == 0"
+			case f.Kind == "boolean":
+				invalid = "!" + field
+			case strings.HasPrefix(f.Type, "*") || f.Kind == "array" || strings.HasPrefix(f.Type, "map["):
+				invalid = field + " == nil"
+			default:
+				return nil, fmt.Errorf("%s: required is not supported for %s", f.Name, f.Type)
+			}
+			out = append(out, Check{invalid, f.JSON + " is required"})
+
+		case "min", "max":
+			n, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid %s rule %q", f.Name, name, rule)
+			}
+			op, word := "<", "at least"
+			if name == "max" {
+				op, word = ">", "at most"
+			}
+			switch f.Kind {
+			case "string", "array":
+				if f.Type == "time.Time" || strings.HasPrefix(f.Type, "*") {
+					return nil, fmt.Errorf("%s: %s is not supported for %s", f.Name, name, f.Type)
+				}
+				if f.Kind == "array" {
+					out = append(out, Check{fmt.Sprintf("len(%s) %s %s", field, op, arg), fmt.Sprintf("%s must have %s %s items", f.JSON, word, arg)})
+				} else {
+					out = append(out, Check{fmt.Sprintf("utf8.RuneCountInString(%s) %s %s", field, op, arg), fmt.Sprintf("%s must have %s %s characters", f.JSON, word, arg)})
+				}
+			case "integer", "number":
+				if f.Kind == "integer" && n != float64(int64(n)) {
+					return nil, fmt.Errorf("%s: %s must be a whole number", f.Name, name)
+				}
+				out = append(out, Check{fmt.Sprintf("%s %s %s", field, op, arg), fmt.Sprintf("%s must be %s %s", f.JSON, word, arg)})
+			default:
+				return nil, fmt.Errorf("%s: %s is not supported for %s", f.Name, name, f.Type)
+			}
+
+		default:
+			return nil, fmt.Errorf("%s: unsupported validate rule %q", f.Name, rule)
+		}
+	}
+	return out, nil
+}
+
+// sample returns whether a field is required, and a value for it which passes its checks if
+// its zero value doesn't
+func sample(f Field, tag string) (bool, string) {
+	required, minimum := false, ""
+	for _, rule := range strings.Split(tag, ",") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		switch name {
+		case "required":
+			required = true
+		case "min":
+			minimum = arg
+		}
+	}
+	least, _ := strconv.ParseFloat(minimum, 64)
+	if !required && least <= 0 {
+		return false, ""
+	}
+
+	switch {
+	case f.Type == "time.Time":
+		return required, "time.Now()"
+	case f.Type == "string":
+		return required, strconv.Quote(strings.Repeat("x", maxInt(int(least), 1)))
+	case f.Kind == "integer" || f.Kind == "number":
+		if least > 0 {
+			return required, minimum
+		}
+		return required, "1"
+	case f.Kind == "boolean":
+		return required, "true"
+	case strings.HasPrefix(f.Type, "*"):
+		return required, "new(" + f.Type[1:] + ")"
+	case strings.HasPrefix(f.Type, "map["):
+		return required, f.Type + "{}"
+	case f.Kind == "array":
+		return required, fmt.Sprintf("make(%s, %d)", f.Type, int(least))
+	}
+	return required, ""
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// Generate returns the source of the handlers and of their tests
+func Generate(spec *Spec) (handlers, tests []byte, err error) {
+	if spec.IDField == "" {
+		return nil, nil, errors.New("spec has no ID field")
+	}
+	data := struct {
+		*Spec
+		Path     string
+		UsesUTF8 bool
+		// UsesTime is set when the test sample needs the time package
+		UsesTime bool
+		// ZeroInvalid is set when the zero value fails validation
+		ZeroInvalid bool
+	}{Spec: spec, Path: strings.ToLower(spec.Type) + "s"}
+	for _, f := range spec.Fields {
+		for _, c := range f.Checks {
+			data.UsesUTF8 = data.UsesUTF8 || strings.Contains(c.Invalid, "utf8.")
+		}
+		data.UsesTime = data.UsesTime || strings.HasPrefix(f.Sample, "time.")
+		data.ZeroInvalid = data.ZeroInvalid || f.Sample != ""
+	}
+
+	if handlers, err = execute(handlersTemplate, data); err != nil {
+		return nil, nil, err
+	}
+	if tests, err = execute(testsTemplate, data); err != nil {
+		return nil, nil, err
+	}
+	return handlers, tests, nil
+}
+
+func execute(tmpl *template.Template, data any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting generated code: %w", err)
+	}
+	return src, nil
+}
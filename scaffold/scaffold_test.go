@@ -0,0 +1,134 @@
+package scaffold
+
+import (
+	"go/parser"
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const widgetSource = `package widgets
+
+import "time"
+
+type Widget struct {
+	ID       string            ` + "`json:\"id\"`" + `
+	Name     string            ` + "`json:\"name\" validate:\"required,max=40\"`" + `
+	Price    float64           ` + "`json:\"price\" validate:\"min=1\"`" + `
+	Stock    int               ` + "`json:\"stock,omitempty\" validate:\"max=1000\"`" + `
+	Tags     []string          ` + "`json:\"tags\" validate:\"min=1\"`" + `
+	Released time.Time         ` + "`json:\"released\" validate:\"required\"`" + `
+	Labels   map[string]string ` + "`json:\"labels,omitempty\"`" + `
+	internal bool
+	Secret   string ` + "`json:\"-\"`" + `
+}
+`
+
+func TestParse(t *testing.T) {
+	spec, err := Parse("widget.go", []byte(widgetSource), "Widget")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.Package != "widgets" || spec.IDField != "id" || len(spec.Fields) != 7 {
+		t.Fatalf("unexpected spec %+v", spec)
+	}
+
+	var tests = []struct {
+		name     string
+		kind     string
+		format   string
+		checks   int
+		required bool
+		sample   string
+	}{
+		{"ID", "string", "", 0, false, ""},
+		{"Name", "string", "", 2, true, `"x"`},
+		{"Price", "number", "", 1, false, "1"},
+		{"Stock", "integer", "", 1, false, ""},
+		{"Tags", "array", "", 1, false, "make([]string, 1)"},
+		{"Released", "string", "date-time", 1, true, "time.Now()"},
+		{"Labels", "object", "", 0, false, ""},
+	}
+
+	for i, e := range tests {
+		f := spec.Fields[i]
+		if f.Name != e.name || f.Kind != e.kind || f.Format != e.format || len(f.Checks) != e.checks || f.Required != e.required || f.Sample != e.sample {
+			t.Errorf("%s: unexpected field %+v", e.name, f)
+		}
+	}
+
+	var errTests = []struct {
+		name   string
+		source string
+	}{
+		{"missing type", "package p\ntype Other struct{ ID string }"},
+		{"no id", "package p\ntype Widget struct{ Name string }"},
+		{"int id", "package p\ntype Widget struct{ ID int }"},
+		{"unsupported rule", "package p\ntype Widget struct{ ID string; Email string `validate:\"email\"` }"},
+		{"bad bound", "package p\ntype Widget struct{ ID string; N int `validate:\"min=x\"` }"},
+		{"min on bool", "package p\ntype Widget struct{ ID string; B bool `validate:\"min=1\"` }"},
+	}
+
+	for _, e := range errTests {
+		if _, err := Parse("p.go", []byte(e.source), "Widget"); err == nil {
+			t.Errorf("%s: expected an error", e.name)
+		}
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	spec, err := Parse("widget.go", []byte(widgetSource), "Widget")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handlers, tests, err := Generate(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fset := token.NewFileSet()
+	for name, src := range map[string][]byte{"handlers": handlers, "tests": tests} {
+		if _, err := parser.ParseFile(fset, name, src, 0); err != nil {
+			t.Errorf("%s don't parse: %v", name, err)
+		}
+	}
+	for _, want := range []string{"func (h *WidgetHandlers) ServeHTTP", `utf8.RuneCountInString(v.Name) > 40`, `errors.New("tags must have at least 1 items")`, `"date-time"`, `"required": []string{"name", "released"}`} {
+		if !strings.Contains(string(handlers), want) {
+			t.Errorf("expected the handlers to contain %s", want)
+		}
+	}
+
+	// the generated tests pass against the generated handlers
+	if testing.Short() {
+		t.Skip("skipping running the generated tests in short mode")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go is not on the PATH")
+	}
+	if err = os.MkdirAll("testdata", 0755); err != nil {
+		t.Fatal(err)
+	}
+	dir, err := os.MkdirTemp("testdata", "widgets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = os.RemoveAll(dir)
+		_ = os.Remove("testdata")
+	})
+
+	files := map[string][]byte{"widget.go": []byte(widgetSource), "widget_handlers.go": handlers, "widget_handlers_test.go": tests}
+	for name, src := range files {
+		if err = os.WriteFile(filepath.Join(dir, name), src, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cmd := exec.Command(goTool, "test", "./"+filepath.ToSlash(dir))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("the generated tests failed: %v\n%s", err, out)
+	}
+}
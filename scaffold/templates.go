@@ -0,0 +1,320 @@
+package scaffold
+
+import "text/template"
+
+var handlersTemplate = template.Must(template.New("handlers").Parse(`// Code generated by scaffold from {{.Type}}. It is a starting point: edit it freely.
+
+package {{.Package}}
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+{{- if .UsesUTF8}}
+	"unicode/utf8"
+{{- end}}
+
+	"github.com/kaliadmen/toolkit"
+)
+
+// {{.Type}}Store stores {{.Type}} records for {{.Type}}Handlers
+type {{.Type}}Store interface {
+	List(ctx context.Context) ([]{{.Type}}, error)
+	// Get returns toolkit.ErrNotFound if there is no record with the id
+	Get(ctx context.Context, id string) ({{.Type}}, error)
+	// Create stores a new record, and sets its ID
+	Create(ctx context.Context, v *{{.Type}}) error
+	// Update replaces a record, returning toolkit.ErrNotFound if there is none with its ID
+	Update(ctx context.Context, v {{.Type}}) error
+	// Delete removes a record. Deleting a missing record is not an error
+	Delete(ctx context.Context, id string) error
+}
+
+// {{.Type}}Handlers serves the CRUD routes of {{.Type}} records
+type {{.Type}}Handlers struct {
+	Store {{.Type}}Store
+	Tools toolkit.Tools
+}
+
+// ServeHTTP serves GET and POST on the collection, and GET, PUT and DELETE on /{id}. Mount it
+// with http.StripPrefix, e.g. mux.Handle("/{{.Path}}/", http.StripPrefix("/{{.Path}}", h)).
+func (h *{{.Type}}Handlers) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(r.URL.Path, "/")
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		h.list(w, r)
+	case id == "" && r.Method == http.MethodPost:
+		h.create(w, r)
+	case id != "" && r.Method == http.MethodGet:
+		h.get(w, r, id)
+	case id != "" && r.Method == http.MethodPut:
+		h.update(w, r, id)
+	case id != "" && r.Method == http.MethodDelete:
+		h.delete(w, r, id)
+	default:
+		_ = h.Tools.ErrorJSON(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *{{.Type}}Handlers) storeError(w http.ResponseWriter, err error) {
+	if errors.Is(err, toolkit.ErrNotFound) {
+		_ = h.Tools.ErrorJSON(w, err, http.StatusNotFound)
+		return
+	}
+	_ = h.Tools.ErrorJSON(w, err, http.StatusInternalServerError)
+}
+
+func (h *{{.Type}}Handlers) list(w http.ResponseWriter, r *http.Request) {
+	items, err := h.Store.List(r.Context())
+	if err != nil {
+		h.storeError(w, err)
+		return
+	}
+	if items == nil {
+		items = []{{.Type}}{}
+	}
+	_ = h.Tools.WriteJSON(w, http.StatusOK, items)
+}
+
+func (h *{{.Type}}Handlers) get(w http.ResponseWriter, r *http.Request, id string) {
+	v, err := h.Store.Get(r.Context(), id)
+	if err != nil {
+		h.storeError(w, err)
+		return
+	}
+	_ = h.Tools.WriteJSON(w, http.StatusOK, v)
+}
+
+func (h *{{.Type}}Handlers) create(w http.ResponseWriter, r *http.Request) {
+	var v {{.Type}}
+	if err := h.Tools.ReadJSON(w, r, &v); err != nil {
+		_ = h.Tools.ErrorJSON(w, err)
+		return
+	}
+	if err := validate{{.Type}}(&v); err != nil {
+		_ = h.Tools.ErrorJSON(w, err, http.StatusUnprocessableEntity)
+		return
+	}
+	if err := h.Store.Create(r.Context(), &v); err != nil {
+		h.storeError(w, err)
+		return
+	}
+	_ = h.Tools.WriteJSON(w, http.StatusCreated, v)
+}
+
+func (h *{{.Type}}Handlers) update(w http.ResponseWriter, r *http.Request, id string) {
+	var v {{.Type}}
+	if err := h.Tools.ReadJSON(w, r, &v); err != nil {
+		_ = h.Tools.ErrorJSON(w, err)
+		return
+	}
+	v.ID = id
+	if err := validate{{.Type}}(&v); err != nil {
+		_ = h.Tools.ErrorJSON(w, err, http.StatusUnprocessableEntity)
+		return
+	}
+	if err := h.Store.Update(r.Context(), v); err != nil {
+		h.storeError(w, err)
+		return
+	}
+	_ = h.Tools.WriteJSON(w, http.StatusOK, v)
+}
+
+func (h *{{.Type}}Handlers) delete(w http.ResponseWriter, r *http.Request, id string) {
+	if err := h.Store.Delete(r.Context(), id); err != nil {
+		h.storeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// validate{{.Type}} applies the rules of {{.Type}}'s validate tags
+func validate{{.Type}}(v *{{.Type}}) error {
+{{- range .Fields}}{{range .Checks}}
+	if {{.Invalid}} {
+		return errors.New({{printf "%q" .Message}})
+	}
+{{- end}}{{end}}
+	return nil
+}
+
+// {{.Type}}OpenAPI describes the routes, mounted at prefix, as OpenAPI 3 paths and a schema,
+// to merge into the app's document
+func {{.Type}}OpenAPI(prefix string) map[string]any {
+	ref := map[string]any{"$ref": "#/components/schemas/{{.Type}}"}
+	body := map[string]any{"required": true, "content": map[string]any{"application/json": map[string]any{"schema": ref}}}
+	reply := func(description string, schema any) map[string]any {
+		r := map[string]any{"description": description}
+		if schema != nil {
+			r["content"] = map[string]any{"application/json": map[string]any{"schema": schema}}
+		}
+		return r
+	}
+	idParam := []any{map[string]any{"name": "id", "in": "path", "required": true, "schema": map[string]any{"type": "string"}}}
+
+	return map[string]any{
+		"paths": map[string]any{
+			prefix: map[string]any{
+				"get":  map[string]any{"operationId": "list{{.Type}}", "responses": map[string]any{"200": reply("OK", map[string]any{"type": "array", "items": ref})}},
+				"post": map[string]any{"operationId": "create{{.Type}}", "requestBody": body, "responses": map[string]any{"201": reply("Created", ref), "422": reply("Invalid", nil)}},
+			},
+			prefix + "/{id}": map[string]any{
+				"parameters": idParam,
+				"get":        map[string]any{"operationId": "get{{.Type}}", "responses": map[string]any{"200": reply("OK", ref), "404": reply("Not found", nil)}},
+				"put":        map[string]any{"operationId": "update{{.Type}}", "requestBody": body, "responses": map[string]any{"200": reply("OK", ref), "404": reply("Not found", nil), "422": reply("Invalid", nil)}},
+				"delete":     map[string]any{"operationId": "delete{{.Type}}", "responses": map[string]any{"204": reply("Deleted", nil)}},
+			},
+		},
+		"components": map[string]any{
+			"schemas": map[string]any{
+				"{{.Type}}": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+{{- range .Fields}}
+						{{printf "%q" .JSON}}: map[string]any{"type": {{printf "%q" .Kind}}{{if .Format}}, "format": {{printf "%q" .Format}}{{end}}},
+{{- end}}
+					},
+					"required": []string{ {{- range .Fields}}{{if .Required}}{{printf "%q" .JSON}}, {{end}}{{end -}} },
+				},
+			},
+		},
+	}
+}
+`))
+
+var testsTemplate = template.Must(template.New("tests").Parse(`// Code generated by scaffold from {{.Type}}. It is a starting point: edit it freely.
+
+package {{.Package}}
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+{{- if .UsesTime}}
+	"time"
+{{- end}}
+
+	"github.com/kaliadmen/toolkit"
+)
+
+// memory{{.Type}}Store is a {{.Type}}Store for the tests
+type memory{{.Type}}Store struct {
+	mu    sync.Mutex
+	items map[string]{{.Type}}
+	next  int
+}
+
+func (s *memory{{.Type}}Store) List(context.Context) ([]{{.Type}}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var items []{{.Type}}
+	for _, v := range s.items {
+		items = append(items, v)
+	}
+	return items, nil
+}
+
+func (s *memory{{.Type}}Store) Get(_ context.Context, id string) ({{.Type}}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.items[id]
+	if !ok {
+		return v, toolkit.ErrNotFound
+	}
+	return v, nil
+}
+
+func (s *memory{{.Type}}Store) Create(_ context.Context, v *{{.Type}}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.items == nil {
+		s.items = make(map[string]{{.Type}})
+	}
+	s.next++
+	v.ID = strconv.Itoa(s.next)
+	s.items[v.ID] = *v
+	return nil
+}
+
+func (s *memory{{.Type}}Store) Update(_ context.Context, v {{.Type}}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.items[v.ID]; !ok {
+		return toolkit.ErrNotFound
+	}
+	s.items[v.ID] = v
+	return nil
+}
+
+func (s *memory{{.Type}}Store) Delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.items, id)
+	return nil
+}
+
+// valid{{.Type}} returns a record which passes validation
+func valid{{.Type}}() {{.Type}} {
+	return {{.Type}}{
+{{- range .Fields}}{{if .Sample}}
+		{{.Name}}: {{.Sample}},
+{{- end}}{{end}}
+	}
+}
+
+func Test{{.Type}}Handlers(t *testing.T) {
+	h := &{{.Type}}Handlers{Store: &memory{{.Type}}Store{}}
+	do := func(method, path string, body any) *httptest.ResponseRecorder {
+		var b []byte
+		if body != nil {
+			b, _ = json.Marshal(body)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(method, path, bytes.NewReader(b)))
+		return rr
+	}
+
+	rr := do("POST", "/", valid{{.Type}}())
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201 creating, got %d %s", rr.Code, rr.Body)
+	}
+	var created {{.Type}}
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil || created.ID == "" {
+		t.Fatalf("expected the created record with an id, got %s", rr.Body)
+	}
+{{- if .ZeroInvalid}}
+
+	if rr = do("POST", "/", {{.Type}}{}); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422 creating an invalid record, got %d", rr.Code)
+	}
+{{- end}}
+
+	var tests = []struct {
+		name   string
+		method string
+		path   string
+		body   any
+		status int
+	}{
+		{"get", "GET", "/" + created.ID, nil, http.StatusOK},
+		{"list", "GET", "/", nil, http.StatusOK},
+		{"update", "PUT", "/" + created.ID, valid{{.Type}}(), http.StatusOK},
+		{"update missing", "PUT", "/missing", valid{{.Type}}(), http.StatusNotFound},
+		{"delete", "DELETE", "/" + created.ID, nil, http.StatusNoContent},
+		{"get deleted", "GET", "/" + created.ID, nil, http.StatusNotFound},
+		{"method not allowed", "PATCH", "/", nil, http.StatusMethodNotAllowed},
+	}
+
+	for _, e := range tests {
+		if rr = do(e.method, e.path, e.body); rr.Code != e.status {
+			t.Errorf("%s: expected %d but got %d %s", e.name, e.status, rr.Code, rr.Body)
+		}
+	}
+}
+`))
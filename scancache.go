@@ -0,0 +1,188 @@
+package toolkit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/kaliadmen/toolkit/ioutil"
+)
+
+// ErrScanRejected is wrapped by the errors ScanCache returns for files a cached scan rejected
+var ErrScanRejected = errors.New("file was rejected by a previous scan")
+
+// ScanResultStore keeps the results of scans by the SHA-256 of the scanned contents. A result
+// is "" for a clean file, or the reason it was rejected.
+type ScanResultStore interface {
+	// Get returns the result for sum, and false if there is none or it has expired
+	Get(ctx context.Context, sum string) (string, bool, error)
+	Set(ctx context.Context, sum, result string, expires time.Time) error
+}
+
+// ScanCache wraps a scanner, such as a virus scanner, so that contents scanned recently are
+// not scanned again; users tend to upload the same attachments over and over. Its Scan method
+// can be used as Ingest.Scan.
+type ScanCache struct {
+	// Scanner is the scan being cached
+	Scanner func(ctx context.Context, name, contentType string, r io.Reader) error
+	// Results defaults to a MemoryScanResults shared by the cache
+	Results ScanResultStore
+	// TTL is how long clean results are trusted, which should be short enough that new
+	// signatures get a chance to catch files. Defaults to an hour
+	TTL time.Duration
+	// RejectedTTL is how long rejections are remembered. Defaults to TTL
+	RejectedTTL time.Duration
+
+	once     sync.Once
+	fallback ScanResultStore
+}
+
+func (sc *ScanCache) results() ScanResultStore {
+	if sc.Results != nil {
+		return sc.Results
+	}
+	sc.once.Do(func() { sc.fallback = &MemoryScanResults{} })
+	return sc.fallback
+}
+
+// Scan scans r unless the same contents have been scanned within the TTL, in which case the
+// earlier result is returned. The contents are hashed first when r is an io.Seeker, such as
+// the temporary files Ingest spools to; otherwise the cache can only be filled, not used.
+// Errors from the store are ignored, and the file scanned as if it weren't cached.
+func (sc *ScanCache) Scan(ctx context.Context, name, contentType string, r io.Reader) error {
+	if sc.Scanner == nil {
+		return errors.New("scan cache has no scanner")
+	}
+	store := sc.results()
+
+	h := sha256.New()
+	if seeker, ok := r.(io.Seeker); ok {
+		start, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		if _, err = io.Copy(h, r); err != nil {
+			return err
+		}
+		if _, err = seeker.Seek(start, io.SeekStart); err != nil {
+			return err
+		}
+
+		sum := hex.EncodeToString(h.Sum(nil))
+		if result, found, err := store.Get(ctx, sum); err == nil && found {
+			return scanResultError(result)
+		}
+		return sc.scan(ctx, store, sum, name, contentType, r)
+	}
+
+	// hash while scanning, reading whatever the scanner left so the hash is complete
+	tee := ioutil.Tee(r, h)
+	err := sc.Scanner(ctx, name, contentType, tee)
+	if _, copyErr := io.Copy(io.Discard, tee); copyErr != nil {
+		return err
+	}
+	sc.record(ctx, store, hex.EncodeToString(h.Sum(nil)), err)
+	return err
+}
+
+func (sc *ScanCache) scan(ctx context.Context, store ScanResultStore, sum, name, contentType string, r io.Reader) error {
+	err := sc.Scanner(ctx, name, contentType, r)
+	sc.record(ctx, store, sum, err)
+	return err
+}
+
+// record stores a scan's result, unless it failed because the context ended
+func (sc *ScanCache) record(ctx context.Context, store ScanResultStore, sum string, err error) {
+	if ctx.Err() != nil {
+		return
+	}
+
+	ttl := sc.TTL
+	if ttl <= 0 {
+		ttl = time.Hour
+	}
+	result := ""
+	if err != nil {
+		result = err.Error()
+		if sc.RejectedTTL > 0 {
+			ttl = sc.RejectedTTL
+		}
+	}
+	_ = store.Set(ctx, sum, result, time.Now().Add(ttl))
+}
+
+func scanResultError(result string) error {
+	if result == "" {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrScanRejected, result)
+}
+
+// MemoryScanResults keeps scan results in memory. The zero value is ready to use.
+type MemoryScanResults struct {
+	// MaxEntries bounds memory use. When full, the results closest to expiring are forgotten
+	// first. Defaults to 100,000
+	MaxEntries int
+
+	mu      sync.Mutex
+	results map[string]scanResult
+	sweep   time.Time
+}
+
+type scanResult struct {
+	result  string
+	expires time.Time
+}
+
+// Get implements ScanResultStore
+func (s *MemoryScanResults) Get(_ context.Context, sum string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.results[sum]
+	if !ok || time.Now().After(r.expires) {
+		return "", false, nil
+	}
+	return r.result, true, nil
+}
+
+// Set implements ScanResultStore
+func (s *MemoryScanResults) Set(_ context.Context, sum, result string, expires time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if s.results == nil {
+		s.results = make(map[string]scanResult)
+	}
+	if now.Sub(s.sweep) > time.Minute {
+		s.sweep = now
+		for k, r := range s.results {
+			if now.After(r.expires) {
+				delete(s.results, k)
+			}
+		}
+	}
+
+	maxEntries := s.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = 100000
+	}
+	if _, ok := s.results[sum]; !ok && len(s.results) >= maxEntries {
+		var oldest string
+		for k, r := range s.results {
+			if oldest == "" || r.expires.Before(s.results[oldest].expires) {
+				oldest = k
+			}
+		}
+		delete(s.results, oldest)
+	}
+
+	s.results[sum] = scanResult{result: result, expires: expires}
+	return nil
+}
@@ -0,0 +1,111 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScanCache_Ingest(t *testing.T) {
+	ctx := context.Background()
+	in := &Ingest{Storage: &FileStorage{Dir: t.TempDir()}, Prefix: "in/"}
+
+	scans := 0
+	cache := &ScanCache{Scanner: func(_ context.Context, _, _ string, r io.Reader) error {
+		scans++
+		b, _ := io.ReadAll(r)
+		if bytes.Contains(b, []byte("EICAR")) {
+			return errors.New("infected")
+		}
+		return nil
+	}}
+	in.Scan = cache.Scan
+
+	var tests = []struct {
+		name    string
+		content string
+		scans   int
+		wantErr error
+	}{
+		{"first upload", "quarterly report", 1, nil},
+		{"same contents", "quarterly report", 1, nil},
+		{"other contents", "minutes", 2, nil},
+		{"infected", "EICAR test", 3, nil},
+		{"infected again", "EICAR test", 3, ErrScanRejected},
+	}
+
+	for _, e := range tests {
+		_, err := in.File(ctx, "f.txt", strings.NewReader(e.content))
+		if scans != e.scans {
+			t.Errorf("%s: expected %d scans but got %d", e.name, e.scans, scans)
+		}
+		if strings.HasPrefix(e.content, "EICAR") {
+			if err == nil || !strings.Contains(err.Error(), "infected") {
+				t.Errorf("%s: expected the file to be rejected, got %v", e.name, err)
+			}
+			if e.wantErr != nil && !errors.Is(err, e.wantErr) {
+				t.Errorf("%s: expected %v but got %v", e.name, e.wantErr, err)
+			}
+		} else if err != nil {
+			t.Errorf("%s: %v", e.name, err)
+		}
+	}
+}
+
+func TestScanCache_Expiry(t *testing.T) {
+	ctx := context.Background()
+	store := &MemoryScanResults{}
+
+	scans := 0
+	cache := &ScanCache{
+		Scanner: func(context.Context, string, string, io.Reader) error { scans++; return nil },
+		Results: store,
+		TTL:     time.Millisecond,
+	}
+
+	_ = cache.Scan(ctx, "a", "text/plain", strings.NewReader("contents"))
+	time.Sleep(5 * time.Millisecond)
+	_ = cache.Scan(ctx, "a", "text/plain", strings.NewReader("contents"))
+	if scans != 2 {
+		t.Errorf("expected an expired result to be scanned again, got %d scans", scans)
+	}
+
+	// readers which can't seek fill the cache, but can't use it
+	cache.TTL = time.Hour
+	r := struct{ io.Reader }{strings.NewReader("streamed")}
+	_ = cache.Scan(ctx, "b", "text/plain", r)
+	_ = cache.Scan(ctx, "b", "text/plain", strings.NewReader("streamed"))
+	if scans != 3 {
+		t.Errorf("expected the streamed result to be cached, got %d scans", scans)
+	}
+
+	// scans cut short by the context are not cached
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	cache.Scanner = func(ctx context.Context, _, _ string, _ io.Reader) error { scans++; return ctx.Err() }
+	_ = cache.Scan(cancelled, "c", "text/plain", strings.NewReader("cancelled"))
+	if err := cache.Scan(ctx, "c", "text/plain", strings.NewReader("cancelled")); err != nil || scans != 5 {
+		t.Errorf("expected a cancelled scan to be repeated, got %v after %d scans", err, scans)
+	}
+}
+
+func TestMemoryScanResults_MaxEntries(t *testing.T) {
+	ctx := context.Background()
+	s := &MemoryScanResults{MaxEntries: 2}
+	now := time.Now()
+
+	_ = s.Set(ctx, "a", "", now.Add(time.Minute))
+	_ = s.Set(ctx, "b", "", now.Add(time.Hour))
+	_ = s.Set(ctx, "c", "infected", now.Add(time.Hour))
+
+	if _, found, _ := s.Get(ctx, "a"); found {
+		t.Error("expected the result closest to expiring to be forgotten")
+	}
+	if result, found, _ := s.Get(ctx, "c"); !found || result != "infected" {
+		t.Errorf("unexpected result %q, %v", result, found)
+	}
+}
@@ -0,0 +1,297 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SearchDocument is a document in a search index. Title and Text are searched, and Fields are
+// returned with results and can be filtered on.
+type SearchDocument struct {
+	ID     string
+	Title  string
+	Text   string
+	Fields map[string]string
+}
+
+// SearchQuery is a full-text search. Every term of Query must match; an empty Query matches
+// every document which passes the filters.
+type SearchQuery struct {
+	Query string
+	// Filters must equal the documents' fields
+	Filters map[string]string
+	// Limit is the most hits returned. Defaults to 20
+	Limit  int
+	Offset int
+}
+
+// SearchHit is a document which matched a search
+type SearchHit struct {
+	ID     string            `json:"id"`
+	Title  string            `json:"title"`
+	Score  float64           `json:"score"`
+	Fields map[string]string `json:"fields,omitempty"`
+	// Snippet is the text around the first match
+	Snippet string `json:"snippet,omitempty"`
+}
+
+// SearchResults are a page of search hits, best first
+type SearchResults struct {
+	Total int         `json:"total"`
+	Hits  []SearchHit `json:"hits"`
+}
+
+// SearchIndex is a full-text index. MemoryIndex is a small embedded one; larger indexes, such
+// as Bleve or Elasticsearch, can be adapted to it.
+type SearchIndex interface {
+	Index(ctx context.Context, doc SearchDocument) error
+	Delete(ctx context.Context, id string) error
+	Search(ctx context.Context, q SearchQuery) (SearchResults, error)
+}
+
+// MemoryIndex is an in-memory inverted index, for up to some tens of thousands of documents.
+// Documents are ranked by TF-IDF, with title matches counting double.
+type MemoryIndex struct {
+	mu       sync.RWMutex
+	docs     map[string]SearchDocument
+	postings map[string]map[string]int // term to document ID to weighted count
+}
+
+// Index adds a document, replacing any with the same ID
+func (idx *MemoryIndex) Index(ctx context.Context, doc SearchDocument) error {
+	if doc.ID == "" {
+		return errors.New("search document needs an id")
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if idx.docs == nil {
+		idx.docs = make(map[string]SearchDocument)
+		idx.postings = make(map[string]map[string]int)
+	}
+	idx.remove(doc.ID)
+
+	idx.docs[doc.ID] = doc
+	for _, term := range searchTerms(doc.Title) {
+		idx.post(term, doc.ID, 2)
+	}
+	for _, term := range searchTerms(doc.Text) {
+		idx.post(term, doc.ID, 1)
+	}
+	return nil
+}
+
+// IndexFile indexes an uploaded file under its NewFileName, by its original name and text.
+// It has the signature of TextExtraction's Index, so an index can be fed by extraction:
+// TextExtraction{Index: idx.IndexFile}.
+func (idx *MemoryIndex) IndexFile(ctx context.Context, file *UploadedFile, contentType, text string) error {
+	return idx.Index(ctx, SearchDocument{
+		ID:    file.NewFileName,
+		Title: file.OriginalFileName,
+		Text:  text,
+		Fields: map[string]string{
+			"name":         file.OriginalFileName,
+			"content_type": contentType,
+			"flagged":      strconv.FormatBool(file.Flagged),
+		},
+	})
+}
+
+// Delete removes a document
+func (idx *MemoryIndex) Delete(ctx context.Context, id string) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.remove(id)
+	return nil
+}
+
+func (idx *MemoryIndex) post(term, id string, weight int) {
+	ids, ok := idx.postings[term]
+	if !ok {
+		ids = make(map[string]int)
+		idx.postings[term] = ids
+	}
+	ids[id] += weight
+}
+
+func (idx *MemoryIndex) remove(id string) {
+	doc, ok := idx.docs[id]
+	if !ok {
+		return
+	}
+	delete(idx.docs, id)
+	for _, term := range append(searchTerms(doc.Title), searchTerms(doc.Text)...) {
+		if ids, ok := idx.postings[term]; ok {
+			delete(ids, id)
+			if len(ids) == 0 {
+				delete(idx.postings, term)
+			}
+		}
+	}
+}
+
+// Search returns the documents matching every term of the query and all the filters
+func (idx *MemoryIndex) Search(ctx context.Context, q SearchQuery) (SearchResults, error) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	terms := searchTerms(q.Query)
+	scores := make(map[string]float64)
+	if len(terms) == 0 {
+		for id := range idx.docs {
+			scores[id] = 0
+		}
+	}
+	for i, term := range terms {
+		ids := idx.postings[term]
+		idf := math.Log(1 + float64(len(idx.docs))/float64(len(ids)+1))
+		for id, count := range ids {
+			if _, ok := scores[id]; ok || i == 0 {
+				scores[id] += float64(count) * idf
+			}
+		}
+		// drop documents missing this term
+		for id := range scores {
+			if _, ok := ids[id]; !ok {
+				delete(scores, id)
+			}
+		}
+	}
+
+	hits := make([]SearchHit, 0, len(scores))
+	for id, score := range scores {
+		doc := idx.docs[id]
+		if !searchFiltersMatch(doc.Fields, q.Filters) {
+			continue
+		}
+		hits = append(hits, SearchHit{
+			ID:      id,
+			Title:   doc.Title,
+			Score:   score,
+			Fields:  doc.Fields,
+			Snippet: searchSnippet(doc.Text, terms),
+		})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID < hits[j].ID
+	})
+
+	results := SearchResults{Total: len(hits), Hits: []SearchHit{}}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = 20
+	}
+	if q.Offset < len(hits) && q.Offset >= 0 {
+		hits = hits[q.Offset:]
+		if len(hits) > limit {
+			hits = hits[:limit]
+		}
+		results.Hits = hits
+	}
+	return results, nil
+}
+
+func searchFiltersMatch(fields, filters map[string]string) bool {
+	for k, v := range filters {
+		if fields[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// searchTerms splits text into lower case words
+func searchTerms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// searchSnippet returns about 160 bytes of text around the first of the terms found in it
+func searchSnippet(text string, terms []string) string {
+	const width = 160
+
+	lower := strings.ToLower(text)
+	at := -1
+	for _, term := range terms {
+		if i := strings.Index(lower, term); i >= 0 && (at < 0 || i < at) {
+			at = i
+		}
+	}
+	if at < 0 || len(lower) != len(text) {
+		// no match, or lower casing changed the offsets
+		at = 0
+	}
+
+	start := at - width/4
+	if start < 0 {
+		start = 0
+	}
+	end := start + width
+	if end > len(text) {
+		end = len(text)
+	}
+	for start > 0 && !utf8.RuneStart(text[start]) {
+		start--
+	}
+	for end < len(text) && !utf8.RuneStart(text[end]) {
+		end--
+	}
+
+	snippet := strings.Join(strings.Fields(text[start:end]), " ")
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if end < len(text) {
+		snippet += "…"
+	}
+	return snippet
+}
+
+// SearchHandler serves searches of idx as JSON SearchResults. The query is in the q parameter,
+// with limit and offset for paging; the parameters named by filters filter on those fields,
+// e.g. SearchHandler(idx, "content_type") serves ?q=invoice&content_type=application/pdf.
+func SearchHandler(idx SearchIndex, filters ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var t Tools
+
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			_ = t.ErrorJSON(w, errors.New("method not allowed"), http.StatusMethodNotAllowed)
+			return
+		}
+
+		params := r.URL.Query()
+		q := SearchQuery{Query: params.Get("q"), Filters: make(map[string]string)}
+		q.Limit, _ = strconv.Atoi(params.Get("limit"))
+		q.Offset, _ = strconv.Atoi(params.Get("offset"))
+		if q.Limit > 100 {
+			q.Limit = 100
+		}
+		for _, f := range filters {
+			if v := params.Get(f); v != "" {
+				q.Filters[f] = v
+			}
+		}
+
+		results, err := idx.Search(r.Context(), q)
+		if err != nil {
+			_ = t.ErrorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+		_ = t.WriteJSON(w, http.StatusOK, results)
+	})
+}
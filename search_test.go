@@ -0,0 +1,154 @@
+package toolkit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newSearchTest(t *testing.T) *MemoryIndex {
+	idx := &MemoryIndex{}
+	ctx := context.Background()
+
+	files := []struct {
+		file        UploadedFile
+		contentType string
+		text        string
+	}{
+		{UploadedFile{NewFileName: "a.pdf", OriginalFileName: "Invoice March.pdf"}, "application/pdf", "Invoice for consulting services in March. Total due: 1200 EUR."},
+		{UploadedFile{NewFileName: "b.pdf", OriginalFileName: "contract.pdf"}, "application/pdf", "This contract covers consulting services. The invoice is sent monthly."},
+		{UploadedFile{NewFileName: "c.txt", OriginalFileName: "notes.txt"}, "text/plain", "Meeting notes: discussed the Zürich office move."},
+	}
+	for _, f := range files {
+		f := f
+		if err := idx.IndexFile(ctx, &f.file, f.contentType, f.text); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return idx
+}
+
+func searchIDs(res SearchResults) string {
+	ids := make([]string, len(res.Hits))
+	for i, h := range res.Hits {
+		ids[i] = h.ID
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestMemoryIndex_Search(t *testing.T) {
+	idx := newSearchTest(t)
+
+	var tests = []struct {
+		name  string
+		query SearchQuery
+		exp   string
+		total int
+	}{
+		{"one term", SearchQuery{Query: "consulting"}, "a.pdf,b.pdf", 2},
+		{"title ranks higher", SearchQuery{Query: "invoice"}, "a.pdf,b.pdf", 2},
+		{"all terms", SearchQuery{Query: "invoice monthly"}, "b.pdf", 1},
+		{"case and punctuation", SearchQuery{Query: "ZÜRICH!"}, "c.txt", 1},
+		{"no match", SearchQuery{Query: "invoice zürich"}, "", 0},
+		{"filter", SearchQuery{Query: "notes", Filters: map[string]string{"content_type": "text/plain"}}, "c.txt", 1},
+		{"filter excludes", SearchQuery{Query: "consulting", Filters: map[string]string{"content_type": "text/plain"}}, "", 0},
+		{"empty query", SearchQuery{Filters: map[string]string{"content_type": "application/pdf"}}, "a.pdf,b.pdf", 2},
+		{"limit", SearchQuery{Query: "consulting", Limit: 1}, "a.pdf", 2},
+		{"offset", SearchQuery{Query: "consulting", Limit: 1, Offset: 1}, "b.pdf", 2},
+		{"offset past end", SearchQuery{Query: "consulting", Offset: 5}, "", 2},
+	}
+
+	for _, e := range tests {
+		res, err := idx.Search(context.Background(), e.query)
+		if err != nil {
+			t.Errorf("%s: %v", e.name, err)
+			continue
+		}
+		if got := searchIDs(res); got != e.exp || res.Total != e.total {
+			t.Errorf("%s: expected %q (%d) but got %q (%d)", e.name, e.exp, e.total, got, res.Total)
+		}
+	}
+}
+
+func TestMemoryIndex_Reindex(t *testing.T) {
+	idx := newSearchTest(t)
+	ctx := context.Background()
+
+	if err := idx.Index(ctx, SearchDocument{ID: "c.txt", Title: "notes.txt", Text: "budget review"}); err != nil {
+		t.Fatal(err)
+	}
+	if res, _ := idx.Search(ctx, SearchQuery{Query: "zürich"}); res.Total != 0 {
+		t.Errorf("expected old text to be unindexed, got %s", searchIDs(res))
+	}
+	if res, _ := idx.Search(ctx, SearchQuery{Query: "budget"}); searchIDs(res) != "c.txt" {
+		t.Errorf("expected c.txt but got %s", searchIDs(res))
+	}
+
+	_ = idx.Delete(ctx, "c.txt")
+	if res, _ := idx.Search(ctx, SearchQuery{Query: "budget"}); res.Total != 0 {
+		t.Errorf("expected nothing after delete, got %s", searchIDs(res))
+	}
+	if len(idx.postings["budget"]) != 0 {
+		t.Error("expected postings to be removed")
+	}
+
+	if err := idx.Index(ctx, SearchDocument{}); err == nil {
+		t.Error("expected an error for a document without an id")
+	}
+}
+
+func TestSearchSnippet(t *testing.T) {
+	text := strings.Repeat("filler ", 50) + "the needle is here " + strings.Repeat("more ", 50)
+	snippet := searchSnippet(text, []string{"needle"})
+	if !strings.Contains(snippet, "needle") || !strings.HasPrefix(snippet, "…") || !strings.HasSuffix(snippet, "…") {
+		t.Errorf("unexpected snippet %q", snippet)
+	}
+	if got := searchSnippet("short text", []string{"missing"}); got != "short text" {
+		t.Errorf("expected the whole text but got %q", got)
+	}
+}
+
+func TestSearchHandler(t *testing.T) {
+	idx := newSearchTest(t)
+	handler := SearchHandler(idx, "content_type")
+
+	req := httptest.NewRequest(http.MethodGet, "/?q=consulting&content_type=application/pdf&name=contract.pdf&limit=1", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 but got %d", rr.Code)
+	}
+	var res SearchResults
+	if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	// name isn't an allowed filter, so it is ignored
+	if res.Total != 2 || searchIDs(res) != "a.pdf" || res.Hits[0].Snippet == "" {
+		t.Errorf("unexpected results %+v", res)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 but got %d", rr.Code)
+	}
+}
+
+func TestMemoryIndex_TextExtraction(t *testing.T) {
+	in := &Ingest{Storage: &FileStorage{Dir: t.TempDir()}, Prefix: "in/"}
+	idx := &MemoryIndex{}
+	in.TextExtraction = &TextExtraction{Index: idx.IndexFile}
+
+	f, err := in.File(context.Background(), "minutes.txt", strings.NewReader("the board approved the budget"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, _ := idx.Search(context.Background(), SearchQuery{Query: "budget"})
+	if searchIDs(res) != f.NewFileName || res.Hits[0].Title != "minutes.txt" {
+		t.Errorf("expected the ingested file to be found, got %+v", res)
+	}
+}
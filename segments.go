@@ -0,0 +1,218 @@
+package toolkit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Segment is one part of a segmented download
+type Segment struct {
+	Index  int    `json:"index"`
+	Offset int64  `json:"offset"`
+	Length int64  `json:"length"`
+	URL    string `json:"url"`
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// SegmentManifest lists the segments of a stored file, so that clients can download them
+// in parallel and verify each one
+type SegmentManifest struct {
+	ID        string    `json:"id"`
+	Key       string    `json:"key"`
+	Size      int64     `json:"size"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Segments  []Segment `json:"segments"`
+}
+
+// SegmentedDownloads issues segment manifests for very large stored files, serves the
+// segments from signed URLs, and tracks which segments of each manifest have been delivered
+type SegmentedDownloads struct {
+	Storage Storage
+	Signer  *URLSigner
+	// BaseURL is the URL the Handler is mounted at
+	BaseURL string
+	// SegmentSize is the size of each segment. Defaults to 64MB
+	SegmentSize int64
+	// TTL is how long segment URLs are valid for. Defaults to one hour
+	TTL time.Duration
+	// Checksums adds the SHA-256 of each segment to the manifest. This reads the whole file
+	Checksums bool
+
+	mu        sync.Mutex
+	manifests map[string]*segmentProgress
+}
+
+type segmentProgress struct {
+	total     int
+	delivered map[int]bool
+	expires   time.Time
+}
+
+// Manifest builds the segment manifest for a stored file
+func (sd *SegmentedDownloads) Manifest(ctx context.Context, key string) (*SegmentManifest, error) {
+	if sd.Storage == nil || sd.Signer == nil {
+		return nil, errors.New("segmented downloads need storage and a signer")
+	}
+
+	info, err := sd.Storage.Stat(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	segmentSize := sd.SegmentSize
+	if segmentSize <= 0 {
+		segmentSize = 64 << 20
+	}
+	ttl := sd.TTL
+	if ttl <= 0 {
+		ttl = time.Hour
+	}
+
+	id, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &SegmentManifest{
+		ID:        id,
+		Key:       key,
+		Size:      info.Size,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+
+	for offset, i := int64(0), 0; offset < info.Size; offset, i = offset+segmentSize, i+1 {
+		length := segmentSize
+		if offset+length > info.Size {
+			length = info.Size - offset
+		}
+
+		q := url.Values{}
+		q.Set("manifest", id)
+		q.Set("key", key)
+		q.Set("segment", strconv.Itoa(i))
+		q.Set("offset", strconv.FormatInt(offset, 10))
+		q.Set("length", strconv.FormatInt(length, 10))
+
+		signed, err := sd.Signer.Sign(sd.BaseURL+"?"+q.Encode(), m.ExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+		m.Segments = append(m.Segments, Segment{Index: i, Offset: offset, Length: length, URL: signed})
+	}
+
+	if sd.Checksums {
+		if err = sd.hashSegments(ctx, m); err != nil {
+			return nil, err
+		}
+	}
+
+	sd.mu.Lock()
+	if sd.manifests == nil {
+		sd.manifests = make(map[string]*segmentProgress)
+	}
+	sd.manifests[id] = &segmentProgress{total: len(m.Segments), delivered: make(map[int]bool), expires: m.ExpiresAt}
+	sd.mu.Unlock()
+
+	return m, nil
+}
+
+func (sd *SegmentedDownloads) hashSegments(ctx context.Context, m *SegmentManifest) error {
+	rc, err := sd.Storage.Get(ctx, m.Key)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	for i := range m.Segments {
+		h := sha256.New()
+		if _, err = io.CopyN(h, rc, m.Segments[i].Length); err != nil {
+			return err
+		}
+		m.Segments[i].SHA256 = hex.EncodeToString(h.Sum(nil))
+	}
+	return nil
+}
+
+// Handler serves segments from their signed URLs. A segment only counts as delivered once
+// it has been written to the client in full.
+func (sd *SegmentedDownloads) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var t Tools
+
+		if err := sd.Signer.Verify(requestURL(r)); err != nil {
+			_ = t.ErrorJSON(w, err, http.StatusForbidden)
+			return
+		}
+
+		q := r.URL.Query()
+		index, err1 := strconv.Atoi(q.Get("segment"))
+		offset, err2 := strconv.ParseInt(q.Get("offset"), 10, 64)
+		length, err3 := strconv.ParseInt(q.Get("length"), 10, 64)
+		if err1 != nil || err2 != nil || err3 != nil {
+			_ = t.ErrorJSON(w, errors.New("malformed segment url"))
+			return
+		}
+
+		rc, err := openRange(r.Context(), sd.Storage, q.Get("key"), ByteRange{Start: offset, Length: length})
+		if err != nil {
+			_ = t.ErrorJSON(w, err, http.StatusNotFound)
+			return
+		}
+		defer rc.Close()
+
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+		n, err := io.Copy(w, rc)
+		if err == nil && n == length {
+			sd.markDelivered(q.Get("manifest"), index)
+		}
+	})
+}
+
+func (sd *SegmentedDownloads) markDelivered(id string, index int) {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+
+	if p, ok := sd.manifests[id]; ok {
+		p.delivered[index] = true
+	}
+}
+
+// Progress returns the number of segments of a manifest delivered so far, and the total
+func (sd *SegmentedDownloads) Progress(id string) (delivered, total int) {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+
+	p, ok := sd.manifests[id]
+	if !ok {
+		return 0, 0
+	}
+	return len(p.delivered), p.total
+}
+
+// Complete reports whether every segment of a manifest has been delivered
+func (sd *SegmentedDownloads) Complete(id string) bool {
+	delivered, total := sd.Progress(id)
+	return total > 0 && delivered == total
+}
+
+// Cleanup forgets manifests whose URLs have expired. Call it periodically.
+func (sd *SegmentedDownloads) Cleanup() {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+
+	now := time.Now()
+	for id, p := range sd.manifests {
+		if now.After(p.expires) {
+			delete(sd.manifests, id)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package toolkit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSegmentedDownloads(t *testing.T) {
+	dir, err := os.MkdirTemp("", "toolkit-segments")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := strings.Repeat("0123456789", 10) + "xyz"
+	store := &FileStorage{Dir: dir}
+	_ = store.Put(context.Background(), "big.bin", strings.NewReader(content))
+
+	sd := SegmentedDownloads{
+		Storage:     store,
+		Signer:      &URLSigner{Key: []byte("segment signing key for the tests")},
+		BaseURL:     "https://example.com/segments",
+		SegmentSize: 40,
+		Checksums:   true,
+	}
+
+	m, err := sd.Manifest(context.Background(), "big.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Size != 103 || len(m.Segments) != 3 || m.Segments[2].Length != 23 {
+		t.Fatalf("wrong manifest: %+v", m)
+	}
+
+	handler := sd.Handler()
+	var assembled strings.Builder
+	for i, seg := range m.Segments {
+		if sd.Complete(m.ID) {
+			t.Error("manifest complete too early")
+		}
+
+		u, _ := url.Parse(seg.URL)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", u.RequestURI(), nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("segment %d: expected 200, got %d", i, rr.Code)
+		}
+
+		sum := sha256.Sum256(rr.Body.Bytes())
+		if hex.EncodeToString(sum[:]) != seg.SHA256 {
+			t.Errorf("segment %d: checksum mismatch", i)
+		}
+		assembled.Write(rr.Body.Bytes())
+	}
+
+	if assembled.String() != content {
+		t.Error("segments do not reassemble the file")
+	}
+	if !sd.Complete(m.ID) {
+		t.Error("expected the manifest to be complete")
+	}
+
+	// segment urls can't be altered to read other parts of storage
+	u, _ := url.Parse(m.Segments[0].URL)
+	q := u.Query()
+	q.Set("length", "103")
+	u.RawQuery = q.Encode()
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", u.RequestURI(), nil))
+	if rr.Code != http.StatusForbidden {
+		t.Error("expected 403 for a tampered segment url, got", rr.Code)
+	}
+}
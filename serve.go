@@ -0,0 +1,254 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// ErrHostNotAllowed is returned when a certificate is requested for a host which is not allowed
+var ErrHostNotAllowed = errors.New("host is not allowed")
+
+// CertManager obtains TLS certificates automatically. *autocert.Manager from
+// golang.org/x/crypto/acme/autocert satisfies it. The toolkit doesn't speak ACME itself, as
+// that would take a dependency or a client of its own; it serves the manager's challenges,
+// restricts its hosts, and caches its certificates with StorageCertCache.
+type CertManager interface {
+	GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error)
+	HTTPHandler(fallback http.Handler) http.Handler
+}
+
+// ServeConfig configures Serve
+type ServeConfig struct {
+	// Addr is the address to listen on. Defaults to ":8080", or ":443" with a CertManager
+	Addr    string
+	Handler http.Handler
+	// Drainer, if set, wraps the handler, and is drained before the server shuts down
+	Drainer *Drainer
+	// ReadHeaderTimeout defaults to 10 seconds
+	ReadHeaderTimeout time.Duration
+	// ShutdownTimeout is how long in-flight requests have to finish. Defaults to 30 seconds
+	ShutdownTimeout time.Duration
+
+	// CertManager enables TLS with automatically issued certificates. TLS-ALPN-01 challenges
+	// are answered on Addr, and HTTP-01 challenges on HTTPAddr.
+	CertManager CertManager
+	// HTTPAddr answers HTTP-01 challenges and redirects everything else to https. Defaults to ":80"
+	HTTPAddr string
+	// AllowedHosts are the host names certificates may be requested for. Leave empty only if
+	// the CertManager has its own host policy.
+	AllowedHosts []string
+
+	// Log receives the startup banner: the build, as ReadBuildInfo describes it, and the
+	// addresses listened on. Defaults to the standard logger
+	Log *log.Logger
+	// Quiet turns the startup banner off
+	Quiet bool
+}
+
+// Serve runs an http server until ctx is done, then shuts it down gracefully. With a CertManager,
+// it serves https, and a second plain http server for ACME challenges and redirects.
+func Serve(ctx context.Context, cfg ServeConfig) error {
+	handler := cfg.Handler
+	if handler == nil {
+		handler = http.DefaultServeMux
+	}
+	if cfg.Drainer != nil {
+		handler = cfg.Drainer.Middleware(handler)
+	}
+
+	readHeaderTimeout := cfg.ReadHeaderTimeout
+	if readHeaderTimeout <= 0 {
+		readHeaderTimeout = 10 * time.Second
+	}
+
+	addr := cfg.Addr
+	if addr == "" {
+		addr = ":8080"
+		if cfg.CertManager != nil {
+			addr = ":443"
+		}
+	}
+
+	servers := []*http.Server{{Addr: addr, Handler: handler, ReadHeaderTimeout: readHeaderTimeout}}
+	listeners := []net.Listener{}
+
+	if cfg.CertManager != nil {
+		servers[0].TLSConfig = AutoTLSConfig(cfg.CertManager, cfg.AllowedHosts...)
+
+		httpAddr := cfg.HTTPAddr
+		if httpAddr == "" {
+			httpAddr = ":80"
+		}
+		servers = append(servers, &http.Server{
+			Addr:              httpAddr,
+			Handler:           cfg.CertManager.HTTPHandler(http.HandlerFunc(redirectToHTTPS)),
+			ReadHeaderTimeout: readHeaderTimeout,
+		})
+	}
+
+	for _, srv := range servers {
+		ln, err := net.Listen("tcp", srv.Addr)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return err
+		}
+		listeners = append(listeners, ln)
+	}
+
+	if !cfg.Quiet {
+		addrs := make([]string, len(listeners))
+		for i, ln := range listeners {
+			addrs[i] = ln.Addr().String()
+		}
+		logger := cfg.Log
+		if logger == nil {
+			logger = log.Default()
+		}
+		logger.Printf("starting %s, listening on %s", ReadBuildInfo(), strings.Join(addrs, " and "))
+	}
+
+	errs := make(chan error, len(servers))
+	for i, srv := range servers {
+		srv, ln := srv, listeners[i]
+		go func() {
+			var err error
+			if srv.TLSConfig != nil {
+				err = srv.ServeTLS(ln, "", "")
+			} else {
+				err = srv.Serve(ln)
+			}
+			if errors.Is(err, http.ErrServerClosed) {
+				err = nil
+			}
+			errs <- err
+		}()
+	}
+
+	var serveErr error
+	select {
+	case <-ctx.Done():
+	case serveErr = <-errs:
+	}
+
+	shutdownTimeout := cfg.ShutdownTimeout
+	if shutdownTimeout <= 0 {
+		shutdownTimeout = 30 * time.Second
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if cfg.Drainer != nil {
+		_ = cfg.Drainer.Drain(shutdownCtx)
+	}
+	for _, srv := range servers {
+		if err := srv.Shutdown(shutdownCtx); err != nil && serveErr == nil {
+			serveErr = err
+		}
+	}
+	return serveErr
+}
+
+// AutoTLSConfig returns a tls.Config which gets certificates from the manager, for the allowed
+// hosts only, and supports TLS-ALPN-01 challenges
+func AutoTLSConfig(m CertManager, allowedHosts ...string) *tls.Config {
+	allow := AllowHosts(allowedHosts...)
+
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"h2", "http/1.1", "acme-tls/1"},
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			if len(allowedHosts) > 0 {
+				if err := allow(hello.Context(), hello.ServerName); err != nil {
+					return nil, err
+				}
+			}
+			return m.GetCertificate(hello)
+		},
+	}
+}
+
+// AllowHosts returns a host policy which only allows the given host names, for use as
+// autocert.Manager's HostPolicy
+func AllowHosts(hosts ...string) func(ctx context.Context, host string) error {
+	allowed := make(map[string]bool, len(hosts))
+	for _, h := range hosts {
+		allowed[strings.ToLower(strings.TrimSuffix(h, "."))] = true
+	}
+
+	return func(_ context.Context, host string) error {
+		if !allowed[strings.ToLower(strings.TrimSuffix(host, "."))] {
+			return fmt.Errorf("%w: %q", ErrHostNotAllowed, host)
+		}
+		return nil
+	}
+}
+
+func redirectToHTTPS(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if host == "" {
+		http.Error(w, "missing host", http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+}
+
+// StorageCertCache stores certificates and ACME account keys in a Storage, so that they
+// survive restarts and are shared between instances. It satisfies autocert.Cache.
+type StorageCertCache struct {
+	Storage Storage
+	// Prefix is prepended to every key. Defaults to "certs"
+	Prefix string
+	// ErrCacheMiss is returned by Get when nothing is stored for a key. Set it to
+	// autocert.ErrCacheMiss, which autocert requires; otherwise ErrNotFound is returned.
+	ErrCacheMiss error
+}
+
+func (c *StorageCertCache) key(name string) string {
+	prefix := c.Prefix
+	if prefix == "" {
+		prefix = "certs"
+	}
+	return path.Join(prefix, strings.NewReplacer("/", "_", "\\", "_").Replace(name))
+}
+
+// Get returns the data stored for a key
+func (c *StorageCertCache) Get(ctx context.Context, name string) ([]byte, error) {
+	rc, err := c.Storage.Get(ctx, c.key(name))
+	if err != nil {
+		if errors.Is(err, ErrNotFound) && c.ErrCacheMiss != nil {
+			return nil, c.ErrCacheMiss
+		}
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// Put stores data for a key
+func (c *StorageCertCache) Put(ctx context.Context, name string, data []byte) error {
+	return c.Storage.Put(ctx, c.key(name), bytes.NewReader(data))
+}
+
+// Delete removes a key. Deleting a missing key is not an error.
+func (c *StorageCertCache) Delete(ctx context.Context, name string) error {
+	err := c.Storage.Delete(ctx, c.key(name))
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,177 @@
+package toolkit
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeCertManager serves one certificate for every host, and answers one challenge path
+type fakeCertManager struct {
+	cert tls.Certificate
+}
+
+func (m *fakeCertManager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return &m.cert, nil
+}
+
+func (m *fakeCertManager) HTTPHandler(fallback http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/.well-known/acme-challenge/token" {
+			_, _ = w.Write([]byte("challenge"))
+			return
+		}
+		fallback.ServeHTTP(w, r)
+	})
+}
+
+// lineWriter hands each line logged to it over a channel, dropping any it has no room for
+type lineWriter chan string
+
+func (w lineWriter) Write(p []byte) (int, error) {
+	select {
+	case w <- string(p):
+	default:
+	}
+	return len(p), nil
+}
+
+func freeAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+func TestServe(t *testing.T) {
+	ca := newTestCA(t)
+	certPEM, keyPEM := ca.issue(t, 2, "example.com")
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr, httpAddr := freeAddr(t), freeAddr(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	logged := make(lineWriter, 1)
+	go func() {
+		done <- Serve(ctx, ServeConfig{
+			Addr:         addr,
+			HTTPAddr:     httpAddr,
+			Handler:      http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte("hello")) }),
+			Drainer:      &Drainer{},
+			CertManager:  &fakeCertManager{cert: cert},
+			AllowedHosts: []string{"example.com"},
+			Log:          log.New(logged, "", 0),
+		})
+	}()
+
+	// the banner is logged once the listeners are open
+	var banner string
+	select {
+	case banner = <-logged:
+	case err = <-done:
+		t.Fatalf("Serve failed to start: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no startup banner")
+	}
+	if !strings.HasPrefix(banner, "starting ") || !strings.Contains(banner, "listening on "+addr+" and "+httpAddr) {
+		t.Errorf("unexpected startup banner %q", banner)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	var tests = []struct {
+		serverName string
+		allowed    bool
+	}{
+		{"example.com", true},
+		{"evil.example", false},
+	}
+
+	for _, e := range tests {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, ServerName: e.serverName, InsecureSkipVerify: !e.allowed}}}
+		res, err := client.Get("https://" + addr)
+		client.CloseIdleConnections()
+		if err == nil {
+			res.Body.Close()
+		}
+		if e.allowed && (err != nil || res.StatusCode != http.StatusOK) {
+			t.Errorf("%s: expected to be served, got %v", e.serverName, err)
+		}
+		if !e.allowed && err == nil {
+			t.Errorf("%s: expected the handshake to fail", e.serverName)
+		}
+	}
+
+	// the http server answers challenges and redirects everything else
+	client := &http.Client{
+		Transport:     &http.Transport{},
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	res, err := client.Get("http://" + httpAddr + "/.well-known/acme-challenge/token")
+	if err != nil || res.StatusCode != http.StatusOK {
+		t.Fatalf("challenge not served: %v", err)
+	}
+	res.Body.Close()
+
+	req, _ := http.NewRequest("GET", "http://"+httpAddr+"/page?x=1", nil)
+	req.Host = "example.com"
+	res, err = client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusMovedPermanently || res.Header.Get("Location") != "https://example.com/page?x=1" {
+		t.Errorf("unexpected redirect %d %s", res.StatusCode, res.Header.Get("Location"))
+	}
+
+	// connections the transport dialed but never used would hold up shutdown
+	client.CloseIdleConnections()
+	cancel()
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Errorf("unexpected error from Serve: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not shut down")
+	}
+}
+
+func TestStorageCertCache(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "certcache")
+	defer os.RemoveAll(dir)
+
+	errMiss := errors.New("cache miss")
+	cache := &StorageCertCache{Storage: &FileStorage{Dir: dir}, ErrCacheMiss: errMiss}
+	ctx := context.Background()
+
+	if _, err := cache.Get(ctx, "example.com+rsa"); err != errMiss {
+		t.Errorf("expected cache miss, got %v", err)
+	}
+	if err := cache.Put(ctx, "example.com+rsa", []byte("pem")); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := cache.Get(ctx, "example.com+rsa"); err != nil || string(data) != "pem" {
+		t.Errorf("unexpected cached data %q %v", data, err)
+	}
+	if err := cache.Delete(ctx, "example.com+rsa"); err != nil {
+		t.Error(err)
+	}
+	if err := cache.Delete(ctx, "example.com+rsa"); err != nil {
+		t.Errorf("deleting a missing key should not fail: %s", err)
+	}
+}
@@ -0,0 +1,209 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ShareStorage is a Storage on a network file share, such as a Windows SMB/CIFS share, reached
+// through the operating system: a UNC path like \\server\share\uploads on Windows, or the
+// mount point of the share elsewhere. It stores objects as FileStorage does, with two
+// differences for shares:
+//
+//   - Keys must be valid Windows file names, whatever the client's OS: no reserved device
+//     names such as CON or LPT1, none of the characters <>:"|?* or control characters, no
+//     name ending in a dot or space, and at most 255 characters per name. Names are compared
+//     without case on the share, so keys differing only in case are the same object.
+//   - Operations failing with a transient error, such as a share disconnect while the server
+//     fails over, are retried. Puts are only retried if the reader is an io.Seeker, as the
+//     data must be sent again.
+type ShareStorage struct {
+	// Dir is the share's UNC path or mount point
+	Dir string
+	// Retries is the number of times a failed operation is retried. Defaults to 3
+	Retries int
+	// RetryDelay is the wait before the first retry, doubling for each one. Defaults to 500ms
+	RetryDelay time.Duration
+	// IsTransient reports whether an error is worth retrying. Defaults to disconnects, stale
+	// handles, timeouts and I/O errors
+	IsTransient func(err error) bool
+}
+
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// validShareKey reports whether every name in key is valid on a Windows share
+func validShareKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, name := range strings.Split(key, "/") {
+		if name == "" || name == "." || name == ".." || len(name) > 255 {
+			return false
+		}
+		if strings.HasSuffix(name, ".") || strings.HasSuffix(name, " ") {
+			return false
+		}
+		if strings.ContainsAny(name, `<>:"|?*\`) {
+			return false
+		}
+		for _, r := range name {
+			if r < 32 {
+				return false
+			}
+		}
+		// reserved names are reserved with any extension, such as nul.txt
+		base, _, _ := strings.Cut(name, ".")
+		if windowsReservedNames[strings.ToUpper(strings.TrimRight(base, " "))] {
+			return false
+		}
+	}
+	return true
+}
+
+// transientShareErrors are the messages of system errors a share disconnect or failover
+// causes, matched on the error text as the codes differ between systems
+var transientShareErrors = []string{
+	"stale", "input/output error", "not connected", "host is down", "no route to host",
+	"connection reset", "network name is no longer available", "unexpected network error",
+	"network path was not found", "semaphore timeout",
+}
+
+// isTransientShareError reports errors a share disconnect or failover causes
+func isTransientShareError(err error) bool {
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return true
+	}
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return false
+	}
+	if errno.Timeout() || errno.Temporary() {
+		return true
+	}
+	msg := strings.ToLower(errno.Error())
+	for _, m := range transientShareErrors {
+		if strings.Contains(msg, m) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *ShareStorage) files() *FileStorage {
+	return &FileStorage{Dir: s.Dir}
+}
+
+// retry runs op until it succeeds, fails with an error which isn't transient, or the retries
+// or ctx run out
+func (s *ShareStorage) retry(ctx context.Context, op func() error) error {
+	retries := s.Retries
+	if retries <= 0 {
+		retries = 3
+	}
+	delay := s.RetryDelay
+	if delay <= 0 {
+		delay = 500 * time.Millisecond
+	}
+	transient := s.IsTransient
+	if transient == nil {
+		transient = isTransientShareError
+	}
+
+	policy := &RetryPolicy{
+		MaxAttempts:  retries + 1,
+		InitialDelay: delay,
+		MaxDelay:     delay << retries,
+		Jitter:       NoJitter,
+		Retryable:    transient,
+	}
+	return policy.Do(ctx, op)
+}
+
+// Put stores the object, retrying if r is an io.Seeker
+func (s *ShareStorage) Put(ctx context.Context, key string, r io.Reader) error {
+	if !validShareKey(key) {
+		return ErrInvalidKey
+	}
+	seeker, replayable := r.(io.Seeker)
+	first := true
+	return s.retry(ctx, func() error {
+		if !first {
+			if !replayable {
+				return errors.New("share disconnected during an upload which cannot be replayed")
+			}
+			if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+		}
+		first = false
+		return s.files().Put(ctx, key, r)
+	})
+}
+
+// Get opens the object for reading
+func (s *ShareStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	if !validShareKey(key) {
+		return nil, ErrInvalidKey
+	}
+	var rc io.ReadCloser
+	err := s.retry(ctx, func() (err error) {
+		rc, err = s.files().Get(ctx, key)
+		return err
+	})
+	return rc, err
+}
+
+// Stat describes the object
+func (s *ShareStorage) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	if !validShareKey(key) {
+		return ObjectInfo{}, ErrInvalidKey
+	}
+	var info ObjectInfo
+	err := s.retry(ctx, func() (err error) {
+		info, err = s.files().Stat(ctx, key)
+		return err
+	})
+	return info, err
+}
+
+// Delete removes the object
+func (s *ShareStorage) Delete(ctx context.Context, key string) error {
+	if !validShareKey(key) {
+		return ErrInvalidKey
+	}
+	return s.retry(ctx, func() error {
+		return s.files().Delete(ctx, key)
+	})
+}
+
+// List describes the objects under prefix
+func (s *ShareStorage) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	err := s.retry(ctx, func() (err error) {
+		objects, err = s.files().List(ctx, prefix)
+		return err
+	})
+	return objects, err
+}
+
+// Available reports whether the share can be reached, for health checks
+func (s *ShareStorage) Available(ctx context.Context) error {
+	return s.retry(ctx, func() error {
+		info, err := os.Stat(s.Dir)
+		if err == nil && !info.IsDir() {
+			return errors.New("share path is not a directory")
+		}
+		return err
+	})
+}
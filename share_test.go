@@ -0,0 +1,132 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidShareKey(t *testing.T) {
+	var tests = []struct {
+		key   string
+		valid bool
+	}{
+		{key: "uploads/report.pdf", valid: true},
+		{key: "uploads/2024 Q1/report (final).pdf", valid: true},
+		{key: "", valid: false},
+		{key: "uploads//report.pdf", valid: false},
+		{key: "../report.pdf", valid: false},
+		{key: "CON", valid: false},
+		{key: "uploads/nul.txt", valid: false},
+		{key: "uploads/Lpt1", valid: false},
+		{key: "uploads/console.txt", valid: true},
+		{key: "report.", valid: false},
+		{key: "report ", valid: false},
+		{key: "a:b.txt", valid: false},
+		{key: "what?.txt", valid: false},
+		{key: `a\b.txt`, valid: false},
+		{key: "tab\t.txt", valid: false},
+		{key: strings.Repeat("a", 256), valid: false},
+	}
+
+	for _, e := range tests {
+		if got := validShareKey(e.key); got != e.valid {
+			t.Errorf("%q: expected %v, got %v", e.key, e.valid, got)
+		}
+	}
+}
+
+func TestShareStorage(t *testing.T) {
+	dir, err := os.MkdirTemp("", "share")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	s := &ShareStorage{Dir: dir}
+	ctx := context.Background()
+	if err = s.Available(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Put(ctx, "uploads/report.txt", strings.NewReader("report")); err != nil {
+		t.Fatal(err)
+	}
+	r, err := s.Get(ctx, "uploads/report.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(r)
+	r.Close()
+	if string(data) != "report" {
+		t.Errorf("expected the contents, got %q", data)
+	}
+	if objects, err := s.List(ctx, "uploads/"); err != nil || len(objects) != 1 {
+		t.Errorf("expected one object, got %v %v", objects, err)
+	}
+	if err = s.Put(ctx, "uploads/aux.txt", strings.NewReader("x")); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("expected ErrInvalidKey, got %v", err)
+	}
+	if _, err = s.Stat(ctx, "uploads/missing.txt"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	if err = s.Delete(ctx, "uploads/report.txt"); err != nil {
+		t.Error(err)
+	}
+
+	missing := &ShareStorage{Dir: dir + "/missing", Retries: 1, RetryDelay: time.Millisecond}
+	if err = missing.Available(ctx); err == nil {
+		t.Error("expected a missing share to be unavailable")
+	}
+}
+
+func TestShareStorage_retry(t *testing.T) {
+	var tests = []struct {
+		name     string
+		failures int
+		err      error
+		attempts int
+		wantErr  bool
+	}{
+		{name: "transient", failures: 2, err: &os.PathError{Op: "open", Err: os.ErrDeadlineExceeded}, attempts: 3},
+		{name: "exhausted", failures: 5, err: &net.OpError{Op: "read", Net: "tcp", Err: os.ErrDeadlineExceeded}, attempts: 4, wantErr: true},
+		{name: "permanent", failures: 5, err: os.ErrPermission, attempts: 1, wantErr: true},
+	}
+
+	for _, e := range tests {
+		s := &ShareStorage{RetryDelay: time.Millisecond}
+		attempts := 0
+		err := s.retry(context.Background(), func() error {
+			attempts++
+			if attempts <= e.failures {
+				return e.err
+			}
+			return nil
+		})
+		if (err != nil) != e.wantErr || attempts != e.attempts {
+			t.Errorf("%s: expected %d attempts, got %d and %v", e.name, e.attempts, attempts, err)
+		}
+	}
+
+	// an upload which cannot be replayed is not retried
+	s := &ShareStorage{RetryDelay: time.Millisecond, IsTransient: func(err error) bool { return true }}
+	dir, _ := os.MkdirTemp("", "share")
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	s.Dir = dir
+	failing := io.MultiReader(strings.NewReader("part"), &errReader{err: errors.New("share disconnected")})
+	if err := s.Put(context.Background(), "a.txt", failing); err == nil || !strings.Contains(err.Error(), "replayed") {
+		t.Errorf("expected the upload not to be replayed, got %v", err)
+	}
+}
+
+type errReader struct {
+	err error
+}
+
+func (r *errReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
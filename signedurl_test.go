@@ -0,0 +1,104 @@
+package toolkit
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestURLSigner(t *testing.T) {
+	signer := URLSigner{Key: []byte("a very secret key of some length")}
+
+	signed, err := signer.Sign("https://example.com/files/report.pdf?user=7", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, _ := url.Parse(signed)
+	if err = signer.Verify(u); err != nil {
+		t.Error("valid url failed verification:", err)
+	}
+
+	tampered, _ := url.Parse(strings.Replace(signed, "user=7", "user=8", 1))
+	if err = signer.Verify(tampered); err != ErrInvalidSignature {
+		t.Error("expected tampered url to fail, got", err)
+	}
+
+	expired, _ := signer.Sign("https://example.com/files/report.pdf", time.Now().Add(-time.Minute))
+	u, _ = url.Parse(expired)
+	if err = signer.Verify(u); err != ErrExpiredSignature {
+		t.Error("expected expired url to fail, got", err)
+	}
+
+	other := URLSigner{Key: []byte("another key entirely, also long")}
+	u, _ = url.Parse(signed)
+	if err = other.Verify(u); err != ErrInvalidSignature {
+		t.Error("expected url signed with another key to fail, got", err)
+	}
+
+	// the path is compared cleaned, so proxies adding slashes don't break links
+	u, _ = url.Parse(strings.Replace(signed, "/files/", "/files//./", 1))
+	if err = signer.Verify(u); err != nil {
+		t.Error("expected url with a rewritten path to verify, got", err)
+	}
+}
+
+func TestURLSigner_Cache(t *testing.T) {
+	signer := &URLSigner{Key: []byte("a very secret key of some length"), CacheSize: 2}
+
+	var links []*url.URL
+	for _, name := range []string{"a", "b", "c"} {
+		signed, _ := signer.Sign("https://example.com/files/"+name, time.Now().Add(time.Hour))
+		u, _ := url.Parse(signed)
+		if err := signer.Verify(u); err != nil {
+			t.Fatal(err)
+		}
+		if err := signer.Verify(u); err != nil {
+			t.Error("cached url failed verification:", err)
+		}
+		links = append(links, u)
+	}
+	if len(signer.verified) != 2 {
+		t.Errorf("expected the cache to stay within its size, got %d", len(signer.verified))
+	}
+
+	// tampering changes the cache key, so it's verified afresh
+	tampered, _ := url.Parse(strings.Replace(links[2].String(), "/c", "/d", 1))
+	if err := signer.Verify(tampered); err != ErrInvalidSignature {
+		t.Error("expected tampered url to fail, got", err)
+	}
+
+	// cached links expire when their signatures do
+	signer.verified[links[2].EscapedPath()+"?"+links[2].RawQuery] = time.Now().Add(-time.Minute).Unix()
+	if err := signer.Verify(links[2]); err != ErrExpiredSignature {
+		t.Error("expected expired cached url to fail, got", err)
+	}
+
+	// rotating the key revokes cached links
+	signer.Key = []byte("another key entirely, also long")
+	if err := signer.Verify(links[1]); err != ErrInvalidSignature {
+		t.Error("expected url signed with the old key to fail, got", err)
+	}
+}
+
+func benchmarkURLSignerVerify(b *testing.B, cacheSize int) {
+	signer := &URLSigner{Key: []byte("a very secret key of some length"), CacheSize: cacheSize}
+	signed, _ := signer.Sign("https://example.com/files/report.pdf?user=7&disposition=attachment", time.Now().Add(time.Hour))
+	u, _ := url.Parse(signed)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := signer.Verify(u); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkURLSigner_Verify(b *testing.B) {
+	benchmarkURLSignerVerify(b, 0)
+}
+
+func BenchmarkURLSigner_VerifyCached(b *testing.B) {
+	benchmarkURLSignerVerify(b, 1000)
+}
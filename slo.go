@@ -0,0 +1,293 @@
+package toolkit
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Objective is a service level objective for a route: the fraction of its requests which must
+// be good. A request is bad if it fails with a 5xx status, or takes longer than Latency.
+type Objective struct {
+	// Target is the fraction of requests which must be good, such as 0.999
+	Target float64
+	// Latency, if set, makes slower requests bad
+	Latency time.Duration
+}
+
+// BurnAlert fires when a route spends its error budget Rate times faster than the objective
+// allows, measured over both Long and Short. The long window keeps brief blips from alerting;
+// the short one stops the alert soon after the problem is fixed.
+type BurnAlert struct {
+	Long  time.Duration `json:"long"`
+	Short time.Duration `json:"short"`
+	Rate  float64       `json:"rate"`
+}
+
+// DefaultBurnAlerts page when a 30 day budget would be spent in about two days, or in five
+var DefaultBurnAlerts = []BurnAlert{
+	{Long: time.Hour, Short: 5 * time.Minute, Rate: 14.4},
+	{Long: 6 * time.Hour, Short: 30 * time.Minute, Rate: 6},
+}
+
+// BurnEvent is a BurnAlert firing for a route
+type BurnEvent struct {
+	Route     string    `json:"route"`
+	Alert     BurnAlert `json:"alert"`
+	LongRate  float64   `json:"long_rate"`
+	ShortRate float64   `json:"short_rate"`
+	At        time.Time `json:"at"`
+}
+
+// SLOReport is the state of a route's objective
+type SLOReport struct {
+	Route     string    `json:"route"`
+	Objective Objective `json:"objective"`
+	// Total and Bad count the requests over the compliance window
+	Total int64 `json:"total"`
+	Bad   int64 `json:"bad"`
+	// Compliance is the fraction of good requests over the compliance window
+	Compliance float64 `json:"compliance"`
+	// BudgetRemaining is the fraction of the error budget left, negative once overspent
+	BudgetRemaining float64 `json:"budget_remaining"`
+	// BurnRates are the burn rates over each alert's long window
+	BurnRates []float64 `json:"burn_rates"`
+}
+
+// SLOTracker measures requests against the objectives of their routes, and calls OnBurn when
+// a route's error budget is burning too fast. Its Report suits an Admin state function.
+type SLOTracker struct {
+	// Objectives maps a route, as named by Route, to its objective. Requests to other routes
+	// aren't tracked
+	Objectives map[string]Objective
+	// Route names the route of a request. Defaults to its method and path, as "GET /users"
+	Route func(r *http.Request) string
+	// Window is the compliance window. Defaults to 30 days
+	Window time.Duration
+	// Alerts default to DefaultBurnAlerts
+	Alerts []BurnAlert
+	// MinRequests is the number of requests in an alert's short window before it may fire,
+	// so that a handful of requests can't page anyone. Defaults to 20
+	MinRequests int64
+	// OnBurn receives an event when an alert starts firing for a route. It fires again only
+	// after the burn rate has dropped below the alert's
+	OnBurn func(ctx context.Context, e BurnEvent)
+	// Now defaults to time.Now
+	Now func() time.Time
+
+	mu     sync.Mutex
+	routes map[string]*sloRoute
+}
+
+type sloCounts struct {
+	total, bad int64
+}
+
+// sloRing counts requests in buckets of a fixed size, covering a span of time
+type sloRing struct {
+	size    time.Duration
+	buckets []sloCounts
+	// last is the number of the bucket most recently added to
+	last int64
+}
+
+func newSLORing(size, span time.Duration) *sloRing {
+	n := int(span / size)
+	if span%size != 0 {
+		n++
+	}
+	return &sloRing{size: size, buckets: make([]sloCounts, n+1)}
+}
+
+func (r *sloRing) add(now time.Time, bad bool) {
+	b := now.UnixNano() / int64(r.size)
+	r.advance(b)
+	c := &r.buckets[b%int64(len(r.buckets))]
+	c.total++
+	if bad {
+		c.bad++
+	}
+}
+
+// advance clears the buckets between the last one and b
+func (r *sloRing) advance(b int64) {
+	if b <= r.last {
+		return
+	}
+	for i := r.last + 1; i <= b && i-r.last <= int64(len(r.buckets)); i++ {
+		r.buckets[i%int64(len(r.buckets))] = sloCounts{}
+	}
+	r.last = b
+}
+
+// sum counts the requests of the last span
+func (r *sloRing) sum(now time.Time, span time.Duration) sloCounts {
+	b := now.UnixNano() / int64(r.size)
+	r.advance(b)
+	n := int64(span / r.size)
+	if n < 1 {
+		n = 1
+	}
+	if n > int64(len(r.buckets)) {
+		n = int64(len(r.buckets))
+	}
+	var c sloCounts
+	for i := b - n + 1; i <= b; i++ {
+		bucket := r.buckets[i%int64(len(r.buckets))]
+		c.total += bucket.total
+		c.bad += bucket.bad
+	}
+	return c
+}
+
+type sloRoute struct {
+	// recent counts by minute for the alerts, and history by hour for compliance
+	recent  *sloRing
+	history *sloRing
+	firing  map[BurnAlert]bool
+}
+
+func (t *SLOTracker) now() time.Time {
+	if t.Now != nil {
+		return t.Now()
+	}
+	return time.Now()
+}
+
+func (t *SLOTracker) window() time.Duration {
+	if t.Window > 0 {
+		return t.Window
+	}
+	return 30 * 24 * time.Hour
+}
+
+func (t *SLOTracker) alerts() []BurnAlert {
+	if t.Alerts != nil {
+		return t.Alerts
+	}
+	return DefaultBurnAlerts
+}
+
+func (t *SLOTracker) minRequests() int64 {
+	if t.MinRequests > 0 {
+		return t.MinRequests
+	}
+	return 20
+}
+
+// Middleware times each request, and records it against its route's objective
+func (t *SLOTracker) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := r.Method + " " + r.URL.Path
+		if t.Route != nil {
+			route = t.Route(r)
+		}
+		if _, ok := t.Objectives[route]; !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		cw := &countingWriter{ResponseWriter: w}
+		next.ServeHTTP(cw, r)
+		t.Record(r.Context(), route, cw.Status(), time.Since(start))
+	})
+}
+
+// Record records a request to route, with its response status and latency, for traffic which
+// doesn't pass through Middleware
+func (t *SLOTracker) Record(ctx context.Context, route string, status int, latency time.Duration) {
+	objective, ok := t.Objectives[route]
+	if !ok {
+		return
+	}
+	bad := status >= 500 || (objective.Latency > 0 && latency > objective.Latency)
+	events := t.record(route, objective, bad, t.now())
+	if t.OnBurn != nil {
+		for _, e := range events {
+			t.OnBurn(ctx, e)
+		}
+	}
+}
+
+func (t *SLOTracker) route(name string) *sloRoute {
+	if t.routes == nil {
+		t.routes = make(map[string]*sloRoute)
+	}
+	s, ok := t.routes[name]
+	if !ok {
+		var longest time.Duration
+		for _, a := range t.alerts() {
+			if a.Long > longest {
+				longest = a.Long
+			}
+		}
+		s = &sloRoute{
+			recent:  newSLORing(time.Minute, longest),
+			history: newSLORing(time.Hour, t.window()),
+			firing:  make(map[BurnAlert]bool),
+		}
+		t.routes[name] = s
+	}
+	return s
+}
+
+// burnRate is how many times faster than the objective allows the budget is being spent
+func burnRate(c sloCounts, objective Objective) float64 {
+	if c.total == 0 {
+		return 0
+	}
+	budget := 1 - objective.Target
+	if budget <= 0 {
+		budget = 1e-9
+	}
+	return float64(c.bad) / float64(c.total) / budget
+}
+
+func (t *SLOTracker) record(name string, objective Objective, bad bool, now time.Time) []BurnEvent {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := t.route(name)
+	s.recent.add(now, bad)
+	s.history.add(now, bad)
+
+	var events []BurnEvent
+	for _, a := range t.alerts() {
+		short := s.recent.sum(now, a.Short)
+		longRate := burnRate(s.recent.sum(now, a.Long), objective)
+		shortRate := burnRate(short, objective)
+		burning := short.total >= t.minRequests() && longRate > a.Rate && shortRate > a.Rate
+		if burning && !s.firing[a] {
+			events = append(events, BurnEvent{Route: name, Alert: a, LongRate: longRate, ShortRate: shortRate, At: now})
+		}
+		s.firing[a] = burning
+	}
+	return events
+}
+
+// Report returns the state of each route's objective, by route
+func (t *SLOTracker) Report() []SLOReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	reports := make([]SLOReport, 0, len(t.Objectives))
+	for name, objective := range t.Objectives {
+		s := t.route(name)
+		c := s.history.sum(now, t.window())
+		report := SLOReport{Route: name, Objective: objective, Total: c.total, Bad: c.bad, Compliance: 1, BudgetRemaining: 1}
+		if c.total > 0 {
+			report.Compliance = 1 - float64(c.bad)/float64(c.total)
+			report.BudgetRemaining = 1 - burnRate(c, objective)
+		}
+		for _, a := range t.alerts() {
+			report.BurnRates = append(report.BurnRates, burnRate(s.recent.sum(now, a.Long), objective))
+		}
+		reports = append(reports, report)
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Route < reports[j].Route })
+	return reports
+}
@@ -0,0 +1,96 @@
+package toolkit
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSLOTracker(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	var events []BurnEvent
+	tracker := &SLOTracker{
+		Objectives: map[string]Objective{
+			"GET /search": {Target: 0.99, Latency: 100 * time.Millisecond},
+		},
+		Alerts:      []BurnAlert{{Long: time.Hour, Short: 5 * time.Minute, Rate: 10}},
+		MinRequests: 10,
+		OnBurn:      func(ctx context.Context, e BurnEvent) { events = append(events, e) },
+		Now:         func() time.Time { return now },
+	}
+	ctx := context.Background()
+
+	// an hour of good traffic, with the odd slow request
+	for i := 0; i < 60; i++ {
+		now = now.Add(time.Minute)
+		for j := 0; j < 10; j++ {
+			latency := 20 * time.Millisecond
+			if i%20 == 0 && j == 0 {
+				latency = time.Second
+			}
+			tracker.Record(ctx, "GET /search", http.StatusOK, latency)
+		}
+	}
+	if len(events) != 0 {
+		t.Fatalf("expected no alerts for good traffic, got %v", events)
+	}
+	report := tracker.Report()
+	if len(report) != 1 || report[0].Total != 600 || report[0].Bad != 3 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if math.Abs(report[0].Compliance-0.995) > 1e-9 || math.Abs(report[0].BudgetRemaining-0.5) > 1e-9 {
+		t.Errorf("expected 99.5%% compliance and half the budget left, got %+v", report[0])
+	}
+
+	// an outage fires the alert once
+	for i := 0; i < 10; i++ {
+		now = now.Add(time.Minute)
+		for j := 0; j < 10; j++ {
+			tracker.Record(ctx, "GET /search", http.StatusBadGateway, time.Millisecond)
+		}
+	}
+	if len(events) != 1 || events[0].Route != "GET /search" || math.Abs(events[0].ShortRate-100) > 1e-6 {
+		t.Fatalf("expected one burn event, got %+v", events)
+	}
+
+	// and again after recovering and failing anew
+	for i := 0; i < 90; i++ {
+		now = now.Add(time.Minute)
+		for j := 0; j < 10; j++ {
+			tracker.Record(ctx, "GET /search", http.StatusOK, time.Millisecond)
+		}
+	}
+	for i := 0; i < 10; i++ {
+		now = now.Add(time.Minute)
+		for j := 0; j < 10; j++ {
+			tracker.Record(ctx, "GET /search", http.StatusInternalServerError, time.Millisecond)
+		}
+	}
+	if len(events) != 2 {
+		t.Errorf("expected the alert to fire again, got %d events", len(events))
+	}
+	if rates := tracker.Report()[0].BurnRates; len(rates) != 1 || rates[0] <= 10 {
+		t.Errorf("expected a high burn rate, got %v", rates)
+	}
+}
+
+func TestSLOTracker_Middleware(t *testing.T) {
+	tracker := &SLOTracker{Objectives: map[string]Objective{"GET /slow": {Target: 0.9, Latency: 5 * time.Millisecond}}}
+	handler := tracker.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(10 * time.Millisecond)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	for _, p := range []string{"/slow", "/fast", "/slow"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", p, nil))
+	}
+	report := tracker.Report()
+	if len(report) != 1 || report[0].Total != 2 || report[0].Bad != 2 {
+		t.Errorf("expected two slow requests to be tracked, got %+v", report)
+	}
+}
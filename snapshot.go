@@ -0,0 +1,254 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ScrubbedValue replaces scrubbed values in snapshots
+const ScrubbedValue = "<scrubbed>"
+
+// SnapshotT is the part of testing.TB used by Snapshot
+type SnapshotT interface {
+	Helper()
+	Errorf(format string, args ...any)
+	Fatalf(format string, args ...any)
+	Logf(format string, args ...any)
+}
+
+// Snapshot compares JSON responses, such as those written by WriteJSON, with golden files,
+// failing the test with the changed fields when they differ. A missing golden file is
+// recorded from the response; run the tests with $UPDATE_SNAPSHOTS set to rewrite them all
+// after an intended change. Volatile values, such as IDs and timestamps, are scrubbed before
+// comparing.
+type Snapshot struct {
+	// Dir holds the golden files. Defaults to testdata/snapshots
+	Dir string
+	// Scrub names the fields whose values are scrubbed. A name without dots, such as
+	// "created_at", matches the field at any depth; a dotted path, such as "data.*.id",
+	// matches from the top, with * matching any key or array index
+	Scrub []string
+	// ScrubPatterns scrub string values they match anywhere, such as UUIDs
+	ScrubPatterns []*regexp.Regexp
+	// Update rewrites the golden files instead of comparing. Defaults to whether
+	// $UPDATE_SNAPSHOTS is set
+	Update bool
+}
+
+func (s *Snapshot) path(name string) (string, error) {
+	dir := s.Dir
+	if dir == "" {
+		dir = filepath.Join("testdata", "snapshots")
+	}
+	clean := filepath.Clean(filepath.FromSlash(name))
+	if name == "" || filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(filepath.ToSlash(clean), "../") {
+		return "", fmt.Errorf("invalid snapshot name %q", name)
+	}
+	return filepath.Join(dir, clean+".json"), nil
+}
+
+// MatchJSON compares a JSON document with the golden file of the given name, such as t.Name()
+func (s *Snapshot) MatchJSON(t SnapshotT, name string, data []byte) {
+	t.Helper()
+	v, err := decodeSnapshotJSON(data)
+	if err != nil {
+		t.Fatalf("snapshot %s: %v", name, err)
+		return
+	}
+	s.match(t, name, s.scrub(v, nil))
+}
+
+// MatchResponse compares a recorded response's status, content type and body with the golden
+// file of the given name. Bodies which aren't JSON are compared as text.
+func (s *Snapshot) MatchResponse(t SnapshotT, name string, rr *httptest.ResponseRecorder) {
+	t.Helper()
+	var body any = rr.Body.String()
+	if v, err := decodeSnapshotJSON(rr.Body.Bytes()); err == nil {
+		body = s.scrub(v, nil)
+	}
+	s.match(t, name, map[string]any{
+		"status":       rr.Code,
+		"content_type": rr.Header().Get("Content-Type"),
+		"body":         body,
+	})
+}
+
+func (s *Snapshot) match(t SnapshotT, name string, got any) {
+	t.Helper()
+	p, err := s.path(name)
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+		return
+	}
+	encoded, err := encodeSnapshotJSON(got, "\t")
+	if err != nil {
+		t.Fatalf("snapshot %s: %v", name, err)
+		return
+	}
+
+	golden, err := os.ReadFile(p)
+	if update := s.Update || os.Getenv("UPDATE_SNAPSHOTS") != ""; update || errors.Is(err, os.ErrNotExist) {
+		if err = os.MkdirAll(filepath.Dir(p), 0755); err == nil {
+			err = os.WriteFile(p, encoded, 0644)
+		}
+		if err != nil {
+			t.Fatalf("snapshot %s: %v", name, err)
+			return
+		}
+		t.Logf("snapshot %s: wrote %s", name, p)
+		return
+	}
+	if err != nil {
+		t.Fatalf("snapshot %s: %v", name, err)
+		return
+	}
+	if bytes.Equal(golden, encoded) {
+		return
+	}
+
+	want, err := decodeSnapshotJSON(golden)
+	if err != nil {
+		t.Fatalf("snapshot %s: %s: %v", name, p, err)
+		return
+	}
+	// compare the encoded form, so values read back from the file compare alike
+	gotValue, _ := decodeSnapshotJSON(encoded)
+	var changes []Change
+	diffJSON("", want, gotValue, &changes)
+	if len(changes) == 0 {
+		return
+	}
+
+	var b strings.Builder
+	for _, c := range changes {
+		old, _ := encodeSnapshotJSON(c.Old, "")
+		updated, _ := encodeSnapshotJSON(c.New, "")
+		field := c.Field
+		if field == "" {
+			field = "(root)"
+		}
+		fmt.Fprintf(&b, "\n\t%s: %s -> %s", field, bytes.TrimSpace(old), bytes.TrimSpace(updated))
+	}
+	t.Errorf("snapshot %s differs from %s; set $UPDATE_SNAPSHOTS to accept it:%s", name, p, b.String())
+}
+
+// encodeSnapshotJSON encodes v without escaping HTML, so scrubbed values stay readable
+func encodeSnapshotJSON(v any, indent string) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", indent)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeSnapshotJSON(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("unexpected data after the JSON value")
+	}
+	return v, nil
+}
+
+// scrub replaces the values of scrubbed fields, and strings matching the patterns
+func (s *Snapshot) scrub(v any, path []string) any {
+	for _, rule := range s.Scrub {
+		if scrubRuleMatches(rule, path) {
+			return ScrubbedValue
+		}
+	}
+
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			v[k] = s.scrub(e, append(path[:len(path):len(path)], k))
+		}
+	case []any:
+		for i, e := range v {
+			v[i] = s.scrub(e, append(path[:len(path):len(path)], strconv.Itoa(i)))
+		}
+	case string:
+		for _, re := range s.ScrubPatterns {
+			v = re.ReplaceAllString(v, ScrubbedValue)
+		}
+		return v
+	}
+	return v
+}
+
+func scrubRuleMatches(rule string, path []string) bool {
+	if len(path) == 0 {
+		return false
+	}
+	if !strings.Contains(rule, ".") {
+		return rule == "*" || rule == path[len(path)-1]
+	}
+	parts := strings.Split(rule, ".")
+	if len(parts) != len(path) {
+		return false
+	}
+	for i, part := range parts {
+		if part != "*" && part != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// diffJSON lists the differences between two decoded JSON values, by dotted path
+func diffJSON(field string, old, new any, changes *[]Change) {
+	switch o := old.(type) {
+	case map[string]any:
+		if n, ok := new.(map[string]any); ok {
+			keys := make(map[string]bool)
+			for k := range o {
+				keys[k] = true
+			}
+			for k := range n {
+				keys[k] = true
+			}
+			names := make([]string, 0, len(keys))
+			for k := range keys {
+				names = append(names, k)
+			}
+			sort.Strings(names)
+			for _, k := range names {
+				ov, inOld := o[k]
+				nv, inNew := n[k]
+				if !inOld || !inNew {
+					*changes = append(*changes, Change{Field: joinField(field, k), Old: ov, New: nv})
+					continue
+				}
+				diffJSON(joinField(field, k), ov, nv, changes)
+			}
+			return
+		}
+	case []any:
+		if n, ok := new.([]any); ok && len(n) == len(o) {
+			for i := range o {
+				diffJSON(joinField(field, strconv.Itoa(i)), o[i], n[i], changes)
+			}
+			return
+		}
+	}
+	if !reflect.DeepEqual(old, new) {
+		*changes = append(*changes, Change{Field: field, Old: old, New: new})
+	}
+}
@@ -0,0 +1,129 @@
+package toolkit
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// fakeSnapshotT records the failures of a Snapshot
+type fakeSnapshotT struct {
+	errors []string
+	fatal  bool
+}
+
+func (f *fakeSnapshotT) Helper() {}
+
+func (f *fakeSnapshotT) Errorf(format string, args ...any) {
+	f.errors = append(f.errors, fmt.Sprintf(format, args...))
+}
+
+func (f *fakeSnapshotT) Fatalf(format string, args ...any) {
+	f.Errorf(format, args...)
+	f.fatal = true
+}
+
+func (f *fakeSnapshotT) Logf(string, ...any) {}
+
+func TestSnapshot_MatchJSON(t *testing.T) {
+	dir, err := os.MkdirTemp("", "snapshots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	s := &Snapshot{
+		Dir:           dir,
+		Scrub:         []string{"created_at", "data.*.id"},
+		ScrubPatterns: []*regexp.Regexp{regexp.MustCompile(`tok_[a-z0-9]+`)},
+	}
+
+	var tests = []struct {
+		name    string
+		json    string
+		changes []string
+	}{
+		{"records", `{"data": [{"id": 1, "name": "a", "created_at": "2020-01-01"}], "link": "/x?t=tok_abc", "total": 1}`, nil},
+		{"volatile fields change", `{"data": [{"id": 2, "name": "a", "created_at": "2021-06-01"}], "link": "/x?t=tok_xyz", "total": 1}`, nil},
+		{"value changes", `{"data": [{"id": 3, "name": "b", "created_at": "2021-06-01"}], "link": "/x?t=tok_xyz", "total": 2}`, []string{`data.0.name: "a" -> "b"`, "total: 1 -> 2"}},
+		{"field added and removed", `{"data": [{"id": 3, "name": "a"}], "link": "/x?t=tok_xyz", "total": 1, "more": true}`, []string{`data.0.created_at: "<scrubbed>" -> null`, "more: null -> true"}},
+		{"array grows", `{"data": [{"id": 1, "name": "a", "created_at": "x"}, {"id": 2}], "link": "/x?t=tok_abc", "total": 1}`, []string{"data: "}},
+	}
+
+	for _, e := range tests {
+		ft := &fakeSnapshotT{}
+		s.MatchJSON(ft, "api/list", []byte(e.json))
+		if len(e.changes) == 0 && len(ft.errors) > 0 {
+			t.Errorf("%s: unexpected failure %v", e.name, ft.errors)
+		}
+		for _, change := range e.changes {
+			if len(ft.errors) != 1 || !strings.Contains(ft.errors[0], change) {
+				t.Errorf("%s: expected a failure listing %q, got %v", e.name, change, ft.errors)
+			}
+		}
+	}
+
+	golden, _ := os.ReadFile(filepath.Join(dir, "api", "list.json"))
+	if !strings.Contains(string(golden), `"id": "<scrubbed>"`) || !strings.Contains(string(golden), `"/x?t=<scrubbed>"`) {
+		t.Errorf("unexpected golden file %s", golden)
+	}
+
+	// updating accepts the change
+	s.Update = true
+	s.MatchJSON(&fakeSnapshotT{}, "api/list", []byte(`{"total": 5}`))
+	s.Update = false
+	ft := &fakeSnapshotT{}
+	s.MatchJSON(ft, "api/list", []byte(`{"total": 5}`))
+	if len(ft.errors) != 0 {
+		t.Errorf("expected the updated snapshot to match, got %v", ft.errors)
+	}
+
+	for _, bad := range []struct{ name, json string }{{"../escape", `{}`}, {"ok", `not json`}} {
+		ft = &fakeSnapshotT{}
+		s.MatchJSON(ft, bad.name, []byte(bad.json))
+		if !ft.fatal {
+			t.Errorf("expected %s to fail", bad.name)
+		}
+	}
+}
+
+func TestSnapshot_MatchResponse(t *testing.T) {
+	dir, err := os.MkdirTemp("", "snapshots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	s := &Snapshot{Dir: dir}
+
+	respond := func(status int, message string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		var tools Tools
+		_ = tools.WriteJSON(rr, status, JSONResponse{Message: message})
+		return rr
+	}
+
+	s.MatchResponse(&fakeSnapshotT{}, "created", respond(http.StatusCreated, "done"))
+	ft := &fakeSnapshotT{}
+	s.MatchResponse(ft, "created", respond(http.StatusCreated, "done"))
+	if len(ft.errors) != 0 {
+		t.Errorf("unexpected failure %v", ft.errors)
+	}
+	s.MatchResponse(ft, "created", respond(http.StatusOK, "done"))
+	if len(ft.errors) != 1 || !strings.Contains(ft.errors[0], "status: 201 -> 200") {
+		t.Errorf("expected a status change, got %v", ft.errors)
+	}
+
+	// text bodies are compared as text
+	rr := httptest.NewRecorder()
+	rr.WriteString("plain")
+	s.MatchResponse(&fakeSnapshotT{}, "text", rr)
+	golden, _ := os.ReadFile(filepath.Join(dir, "text.json"))
+	if !strings.Contains(string(golden), `"body": "plain"`) {
+		t.Errorf("unexpected golden file %s", golden)
+	}
+}
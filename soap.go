@@ -0,0 +1,222 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SOAP 1.1 and WS-Security namespaces
+const (
+	SOAPEnvelopeNS = "http://schemas.xmlsoap.org/soap/envelope/"
+	wsseNS         = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd"
+	wsuNS          = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd"
+	wssTokenNS     = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-username-token-profile-1.0"
+	wssMessageNS   = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-soap-message-security-1.0"
+)
+
+// SOAPFault is a fault returned by a SOAP service
+type SOAPFault struct {
+	Code   string `xml:"faultcode"`
+	String string `xml:"faultstring"`
+	Actor  string `xml:"faultactor,omitempty"`
+	// Detail is the raw XML inside the fault's detail element
+	Detail string `xml:"-"`
+}
+
+type soapFaultXML struct {
+	SOAPFault
+	Detail struct {
+		Content string `xml:",innerxml"`
+	} `xml:"detail"`
+}
+
+func (f *SOAPFault) Error() string {
+	return fmt.Sprintf("soap fault %s: %s", f.Code, f.String)
+}
+
+// WSSecurity adds a WS-Security UsernameToken to SOAP requests
+type WSSecurity struct {
+	Username string
+	Password string
+	// Digest sends a password digest, with a nonce and timestamp, instead of the password
+	Digest bool
+}
+
+type wsseSecurity struct {
+	XMLName        xml.Name          `xml:"wsse:Security"`
+	WSSE           string            `xml:"xmlns:wsse,attr"`
+	WSU            string            `xml:"xmlns:wsu,attr"`
+	MustUnderstand string            `xml:"soap:mustUnderstand,attr"`
+	Token          wsseUsernameToken `xml:"wsse:UsernameToken"`
+}
+
+type wsseUsernameToken struct {
+	Username string       `xml:"wsse:Username"`
+	Password wssePassword `xml:"wsse:Password"`
+	Nonce    *wsseEncoded `xml:"wsse:Nonce,omitempty"`
+	Created  string       `xml:"wsu:Created,omitempty"`
+}
+
+type wssePassword struct {
+	Type  string `xml:"Type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type wsseEncoded struct {
+	EncodingType string `xml:"EncodingType,attr"`
+	Value        string `xml:",chardata"`
+}
+
+func (s *WSSecurity) header(now time.Time) wsseSecurity {
+	token := wsseUsernameToken{
+		Username: s.Username,
+		Password: wssePassword{Type: wssTokenNS + "#PasswordText", Value: s.Password},
+	}
+	if s.Digest {
+		nonce := make([]byte, 16)
+		_, _ = rand.Read(nonce)
+		created := now.UTC().Format("2006-01-02T15:04:05.000Z")
+		// PasswordDigest = Base64(SHA-1(nonce + created + password))
+		sum := sha1.Sum(append(append(append([]byte{}, nonce...), created...), s.Password...))
+		token.Password = wssePassword{Type: wssTokenNS + "#PasswordDigest", Value: base64.StdEncoding.EncodeToString(sum[:])}
+		token.Nonce = &wsseEncoded{EncodingType: wssMessageNS + "#Base64Binary", Value: base64.StdEncoding.EncodeToString(nonce)}
+		token.Created = created
+	}
+	return wsseSecurity{WSSE: wsseNS, WSU: wsuNS, MustUnderstand: "1", Token: token}
+}
+
+type soapEnvelope struct {
+	XMLName xml.Name    `xml:"soap:Envelope"`
+	NS      string      `xml:"xmlns:soap,attr"`
+	Header  *soapHeader `xml:"soap:Header,omitempty"`
+	Body    soapBody    `xml:"soap:Body"`
+}
+
+type soapHeader struct {
+	Content []byte `xml:",innerxml"`
+}
+
+type soapBody struct {
+	Content []byte `xml:",innerxml"`
+}
+
+// BuildSOAPEnvelope wraps body, which is marshaled with encoding/xml and so should carry its
+// namespace in its XMLName, in a SOAP 1.1 envelope, with a WS-Security header if security is
+// set
+func BuildSOAPEnvelope(body any, security *WSSecurity) ([]byte, error) {
+	env := soapEnvelope{NS: SOAPEnvelopeNS}
+	if body != nil {
+		content, err := xml.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		env.Body.Content = content
+	}
+	if security != nil {
+		content, err := xml.Marshal(security.header(time.Now()))
+		if err != nil {
+			return nil, err
+		}
+		env.Header = &soapHeader{Content: content}
+	}
+
+	data, err := xml.Marshal(env)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// ParseSOAPEnvelope decodes the first element of a SOAP envelope's body into out, unless out is
+// nil. A fault in the body is returned as a *SOAPFault.
+func ParseSOAPEnvelope(data []byte, out any) error {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	inBody := false
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			return errors.New("soap envelope has no body")
+		}
+		if err != nil {
+			return err
+		}
+
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			if end, ok := tok.(xml.EndElement); ok && inBody && end.Name.Local == "Body" {
+				// an empty body
+				return nil
+			}
+			continue
+		}
+		switch {
+		case !inBody && start.Name.Local == "Body" && start.Name.Space == SOAPEnvelopeNS:
+			inBody = true
+		case inBody && start.Name.Local == "Fault" && start.Name.Space == SOAPEnvelopeNS:
+			var decoded soapFaultXML
+			if err = dec.DecodeElement(&decoded, &start); err != nil {
+				return err
+			}
+			fault := decoded.SOAPFault
+			fault.Detail = strings.TrimSpace(decoded.Detail.Content)
+			return &fault
+		case inBody:
+			if out == nil {
+				return nil
+			}
+			return dec.DecodeElement(out, &start)
+		}
+	}
+}
+
+// CallSOAP sends in to a SOAP 1.1 service, with the SOAPAction action, and decodes the response
+// body into out, unless out is nil. A fault is returned as a *SOAPFault, whatever the status.
+// The call's deadline is applied as in CallJSONContext.
+func (t *Tools) CallSOAP(ctx context.Context, client *http.Client, url, action string, in, out any, security *WSSecurity) error {
+	ctx, cancel := OutboundContext(ctx)
+	defer cancel()
+
+	envelope, err := BuildSOAPEnvelope(in, security)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(envelope))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "text/xml; charset=utf-8")
+	request.Header.Set("SOAPAction", `"`+action+`"`)
+	setTimeoutHeader(request)
+
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(response.Body, 16<<20))
+	if err != nil {
+		return err
+	}
+	err = ParseSOAPEnvelope(data, out)
+	var fault *SOAPFault
+	if response.StatusCode >= 200 && response.StatusCode <= 299 || errors.As(err, &fault) {
+		return err
+	}
+	return &StatusError{
+		Method:     http.MethodPost,
+		URL:        url,
+		Status:     response.StatusCode,
+		RetryAfter: parseRetryAfter(response.Header.Get("Retry-After")),
+	}
+}
@@ -0,0 +1,158 @@
+package toolkit
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type getQuote struct {
+	XMLName xml.Name `xml:"urn:quotes GetQuote"`
+	Symbol  string   `xml:"Symbol"`
+}
+
+type getQuoteResponse struct {
+	XMLName xml.Name `xml:"urn:quotes GetQuoteResponse"`
+	Price   float64  `xml:"Price"`
+}
+
+// soapRequest is the part of an envelope the test server reads
+type soapRequest struct {
+	Header struct {
+		Security struct {
+			Token struct {
+				Username string `xml:"Username"`
+				Password struct {
+					Type  string `xml:"Type,attr"`
+					Value string `xml:",chardata"`
+				} `xml:"Password"`
+				Nonce   string `xml:"Nonce"`
+				Created string `xml:"Created"`
+			} `xml:"UsernameToken"`
+		} `xml:"Security"`
+	} `xml:"Header"`
+	Body struct {
+		Quote getQuote
+	} `xml:"Body"`
+}
+
+func TestBuildSOAPEnvelope(t *testing.T) {
+	var tests = []struct {
+		name     string
+		security *WSSecurity
+		password string
+	}{
+		{name: "no security"},
+		{name: "text", security: &WSSecurity{Username: "partner", Password: "secret"}, password: "secret"},
+		{name: "digest", security: &WSSecurity{Username: "partner", Password: "secret", Digest: true}},
+	}
+
+	for _, e := range tests {
+		data, err := BuildSOAPEnvelope(getQuote{Symbol: "ACME"}, e.security)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var req soapRequest
+		if err = xml.Unmarshal(data, &req); err != nil {
+			t.Fatalf("%s: %v\n%s", e.name, err, data)
+		}
+		if req.Body.Quote.Symbol != "ACME" || req.Body.Quote.XMLName.Space != "urn:quotes" {
+			t.Errorf("%s: unexpected body %+v", e.name, req.Body.Quote)
+		}
+		token := req.Header.Security.Token
+		switch {
+		case e.security == nil:
+			if strings.Contains(string(data), "Header") {
+				t.Errorf("%s: expected no header", e.name)
+			}
+		case e.security.Digest:
+			nonce, _ := base64.StdEncoding.DecodeString(token.Nonce)
+			sum := sha1.Sum([]byte(string(nonce) + token.Created + "secret"))
+			if token.Password.Value != base64.StdEncoding.EncodeToString(sum[:]) || !strings.HasSuffix(token.Password.Type, "#PasswordDigest") {
+				t.Errorf("%s: invalid digest %+v", e.name, token)
+			}
+		default:
+			if token.Username != "partner" || token.Password.Value != e.password || !strings.HasSuffix(token.Password.Type, "#PasswordText") {
+				t.Errorf("%s: unexpected token %+v", e.name, token)
+			}
+		}
+	}
+}
+
+func TestParseSOAPEnvelope(t *testing.T) {
+	const prefix = `<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body>`
+	const suffix = `</s:Body></s:Envelope>`
+
+	var tests = []struct {
+		name  string
+		body  string
+		price float64
+		fault *SOAPFault
+		err   bool
+	}{
+		{name: "response", body: `<q:GetQuoteResponse xmlns:q="urn:quotes"><q:Price>12.5</q:Price></q:GetQuoteResponse>`, price: 12.5},
+		{name: "fault", body: `<s:Fault><faultcode>s:Client</faultcode><faultstring>Unknown symbol</faultstring><detail><code>42</code></detail></s:Fault>`,
+			fault: &SOAPFault{Code: "s:Client", String: "Unknown symbol", Detail: "<code>42</code>"}},
+		{name: "empty body"},
+		{name: "wrong element", body: `<Other/>`, err: true},
+	}
+
+	for _, e := range tests {
+		var out getQuoteResponse
+		err := ParseSOAPEnvelope([]byte(prefix+e.body+suffix), &out)
+		var fault *SOAPFault
+		switch {
+		case e.fault != nil:
+			if !errors.As(err, &fault) || *fault != *e.fault {
+				t.Errorf("%s: expected %+v, got %v", e.name, e.fault, err)
+			}
+		case e.err:
+			if err == nil {
+				t.Errorf("%s: expected an error", e.name)
+			}
+		case err != nil || out.Price != e.price:
+			t.Errorf("%s: expected %v, got %v %v", e.name, e.price, out.Price, err)
+		}
+	}
+
+	if err := ParseSOAPEnvelope([]byte(`<Envelope/>`), nil); err == nil {
+		t.Error("expected an envelope without a body to fail")
+	}
+}
+
+func TestTools_CallSOAP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		var req soapRequest
+		_ = xml.Unmarshal(data, &req)
+		w.Header().Set("Content-Type", "text/xml")
+
+		if r.Header.Get("SOAPAction") != `"urn:quotes#GetQuote"` || req.Header.Security.Token.Username != "partner" {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = io.WriteString(w, `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body><s:Fault><faultcode>s:Client</faultcode><faultstring>Not authorized</faultstring></s:Fault></s:Body></s:Envelope>`)
+			return
+		}
+		_, _ = io.WriteString(w, `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body><GetQuoteResponse xmlns="urn:quotes"><Price>9.75</Price></GetQuoteResponse></s:Body></s:Envelope>`)
+	}))
+	defer srv.Close()
+
+	var tools Tools
+	var out getQuoteResponse
+	security := &WSSecurity{Username: "partner", Password: "secret", Digest: true}
+	if err := tools.CallSOAP(context.Background(), srv.Client(), srv.URL, "urn:quotes#GetQuote", getQuote{Symbol: "ACME"}, &out, security); err != nil || out.Price != 9.75 {
+		t.Fatalf("expected a price, got %v %v", out.Price, err)
+	}
+
+	err := tools.CallSOAP(context.Background(), srv.Client(), srv.URL, "urn:quotes#GetQuote", getQuote{Symbol: "ACME"}, &out, nil)
+	var fault *SOAPFault
+	if !errors.As(err, &fault) || fault.String != "Not authorized" {
+		t.Errorf("expected a fault, got %v", err)
+	}
+}
@@ -0,0 +1,384 @@
+package toolkit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned by Storage implementations when a key does not exist
+var ErrNotFound = errors.New("object not found")
+
+// ErrInvalidKey is returned when a storage key is empty or escapes the storage root
+var ErrInvalidKey = errors.New("invalid storage key")
+
+// ObjectInfo describes a stored object
+type ObjectInfo struct {
+	Key     string    `json:"key"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// Storage is the interface for object storage backends. Keys are slash separated paths,
+// such as "exports/abc.csv".
+type Storage interface {
+	// Put stores the contents of r under key, replacing any existing object
+	Put(ctx context.Context, key string, r io.Reader) error
+	// Get opens the object stored under key. It returns ErrNotFound if there is none
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Stat describes the object stored under key. It returns ErrNotFound if there is none
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+	// Delete removes the object stored under key. Deleting a missing object is not an error
+	Delete(ctx context.Context, key string) error
+	// List describes every object whose key starts with prefix, ordered by key
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+}
+
+// ErrNotSupported is returned when a storage backend does not support an operation
+var ErrNotSupported = errors.New("operation not supported by this storage backend")
+
+// Copier is implemented by storage backends which can copy objects without the data
+// passing through the application, such as S3's server-side copy
+type Copier interface {
+	Copy(ctx context.Context, src, dst string) error
+}
+
+// Composer is implemented by storage backends which can assemble an object from others,
+// such as S3's multipart upload completion or GCS's compose
+type Composer interface {
+	Compose(ctx context.Context, dst string, srcs []string) error
+}
+
+// MetadataStorage is implemented by storage backends which can store key/value metadata
+// alongside objects
+type MetadataStorage interface {
+	GetMetadata(ctx context.Context, key string) (map[string]string, error)
+	SetMetadata(ctx context.Context, key string, meta map[string]string) error
+}
+
+// CopyObject copies src to dst, using the backend's server-side copy if it has one, and
+// streaming the object through the application if not
+func CopyObject(ctx context.Context, s Storage, src, dst string) error {
+	if c, ok := s.(Copier); ok {
+		return c.Copy(ctx, src, dst)
+	}
+
+	r, err := s.Get(ctx, src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	return s.Put(ctx, dst, r)
+}
+
+// ComposeObjects assembles dst from srcs, in order, e.g. to complete a chunked upload. It uses
+// the backend's compose operation if it has one, and streams the parts through the application
+// if not. The source objects are left in place.
+func ComposeObjects(ctx context.Context, s Storage, dst string, srcs []string) error {
+	if len(srcs) == 0 {
+		return errors.New("compose needs at least one source object")
+	}
+	if c, ok := s.(Composer); ok {
+		return c.Compose(ctx, dst, srcs)
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		for _, src := range srcs {
+			r, err := s.Get(ctx, src)
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			_, err = io.Copy(pw, r)
+			r.Close()
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		pw.Close()
+	}()
+
+	err := s.Put(ctx, dst, pr)
+	pr.CloseWithError(err)
+	return err
+}
+
+// CompleteMultipart assembles dst from the uploaded parts, in order, and deletes the parts
+func CompleteMultipart(ctx context.Context, s Storage, dst string, parts []string) error {
+	if err := ComposeObjects(ctx, s, dst, parts); err != nil {
+		return err
+	}
+
+	for _, part := range parts {
+		if part == dst {
+			continue
+		}
+		if err := s.Delete(ctx, part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetMetadata returns the metadata stored with key, or ErrNotSupported if the backend
+// cannot store metadata
+func GetMetadata(ctx context.Context, s Storage, key string) (map[string]string, error) {
+	if m, ok := s.(MetadataStorage); ok {
+		return m.GetMetadata(ctx, key)
+	}
+	return nil, ErrNotSupported
+}
+
+// SetMetadata replaces the metadata stored with key, or returns ErrNotSupported if the backend
+// cannot store metadata
+func SetMetadata(ctx context.Context, s Storage, key string, meta map[string]string) error {
+	if m, ok := s.(MetadataStorage); ok {
+		return m.SetMetadata(ctx, key, meta)
+	}
+	return ErrNotSupported
+}
+
+// FileStorage is a Storage backed by a directory on the local file system. Metadata is kept
+// in JSON files under a hidden .meta directory in the root.
+type FileStorage struct {
+	// Dir is the root directory. It is created on first write if it does not exist
+	Dir string
+}
+
+func (fs *FileStorage) path(key string) (string, error) {
+	clean := filepath.ToSlash(filepath.Clean("/" + key))
+	if key == "" || clean == "/" || strings.Contains(key, "\\") || strings.HasPrefix(clean, "/"+fileMetaDir+"/") {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(fs.Dir, filepath.FromSlash(clean)), nil
+}
+
+// Put writes the object to a temporary file and renames it into place, so readers never
+// see a partially written object. As with S3, an overwritten object's metadata is removed.
+func (fs *FileStorage) Put(ctx context.Context, key string, r io.Reader) error {
+	p, err := fs.path(key)
+	if err != nil {
+		return err
+	}
+
+	var t Tools
+	if err = t.CreateDir(filepath.Dir(p)); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = io.Copy(tmp, contextReader{ctx, r}); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	if err = os.Remove(fs.metaPath(key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+// Get opens the object for reading
+func (fs *FileStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	p, err := fs.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+// Stat describes the object
+func (fs *FileStorage) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	p, err := fs.path(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	fi, err := os.Stat(p)
+	if errors.Is(err, os.ErrNotExist) || (err == nil && fi.IsDir()) {
+		return ObjectInfo{}, ErrNotFound
+	}
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	return ObjectInfo{Key: key, Size: fi.Size(), ModTime: fi.ModTime()}, nil
+}
+
+// Delete removes the object
+func (fs *FileStorage) Delete(ctx context.Context, key string) error {
+	p, err := fs.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(p)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	err = os.Remove(fs.metaPath(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// List walks the directory and returns the objects whose keys start with prefix
+func (fs *FileStorage) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var out []ObjectInfo
+
+	err := filepath.Walk(fs.Dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if fi.IsDir() && p == filepath.Join(fs.Dir, fileMetaDir) {
+			return filepath.SkipDir
+		}
+		if fi.IsDir() || strings.HasPrefix(fi.Name(), ".upload-") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(fs.Dir, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if strings.HasPrefix(key, prefix) {
+			out = append(out, ObjectInfo{Key: key, Size: fi.Size(), ModTime: fi.ModTime()})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out, nil
+}
+
+const fileMetaDir = ".meta"
+
+func (fs *FileStorage) metaPath(key string) string {
+	clean := filepath.FromSlash(filepath.Clean("/" + key))
+	return filepath.Join(fs.Dir, fileMetaDir, clean+".json")
+}
+
+// Copy copies the object on disk
+func (fs *FileStorage) Copy(ctx context.Context, src, dst string) error {
+	r, err := fs.Get(ctx, src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	// metadata travels with the object, as with S3's default copy directive. It's read first,
+	// as Put removes the metadata of the object it overwrites, which may be src
+	meta, err := fs.GetMetadata(ctx, src)
+	if err != nil {
+		return err
+	}
+	if err = fs.Put(ctx, dst, r); err != nil {
+		return err
+	}
+	if len(meta) == 0 {
+		return nil
+	}
+	return fs.SetMetadata(ctx, dst, meta)
+}
+
+// Compose concatenates the source objects into dst
+func (fs *FileStorage) Compose(ctx context.Context, dst string, srcs []string) error {
+	var readers []io.Reader
+	for _, src := range srcs {
+		r, err := fs.Get(ctx, src)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		readers = append(readers, r)
+	}
+
+	return fs.Put(ctx, dst, io.MultiReader(readers...))
+}
+
+// GetMetadata returns the object's metadata, which is empty if none has been set
+func (fs *FileStorage) GetMetadata(ctx context.Context, key string) (map[string]string, error) {
+	if _, err := fs.Stat(ctx, key); err != nil {
+		return nil, err
+	}
+
+	b, err := os.ReadFile(fs.metaPath(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	meta := make(map[string]string)
+	if err = json.Unmarshal(b, &meta); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// SetMetadata replaces the object's metadata
+func (fs *FileStorage) SetMetadata(ctx context.Context, key string, meta map[string]string) error {
+	if _, err := fs.Stat(ctx, key); err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+
+	p := fs.metaPath(key)
+	var t Tools
+	if err = t.CreateDir(filepath.Dir(p)); err != nil {
+		return err
+	}
+	return os.WriteFile(p, b, 0644)
+}
+
+// contextReader stops reading once its context is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
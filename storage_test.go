@@ -0,0 +1,154 @@
+package toolkit
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestFileStorage(t *testing.T) {
+	dir, err := os.MkdirTemp("", "toolkit-storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	fs := FileStorage{Dir: dir}
+
+	if err = fs.Put(ctx, "a/one.txt", strings.NewReader("one")); err != nil {
+		t.Fatal(err)
+	}
+	if err = fs.Put(ctx, "b/two.txt", strings.NewReader("two")); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := fs.Get(ctx, "a/one.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(f)
+	f.Close()
+	if string(b) != "one" {
+		t.Error("wrong contents", string(b))
+	}
+
+	info, err := fs.Stat(ctx, "b/two.txt")
+	if err != nil || info.Size != 3 {
+		t.Error("wrong stat", info, err)
+	}
+
+	list, err := fs.List(ctx, "a/")
+	if err != nil || len(list) != 1 || list[0].Key != "a/one.txt" {
+		t.Error("wrong listing", list, err)
+	}
+
+	if err = fs.Delete(ctx, "a/one.txt"); err != nil {
+		t.Error(err)
+	}
+	if _, err = fs.Get(ctx, "a/one.txt"); err != ErrNotFound {
+		t.Error("expected ErrNotFound after delete, got", err)
+	}
+	if err = fs.Delete(ctx, "a/one.txt"); err != nil {
+		t.Error("deleting a missing object should not fail", err)
+	}
+
+	// keys cannot escape the root
+	if err = fs.Put(ctx, "../../escape.txt", strings.NewReader("x")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(dir + "/escape.txt"); err != nil {
+		t.Error("expected traversal to be confined to the root", err)
+	}
+	if err = fs.Put(ctx, "", strings.NewReader("x")); err != ErrInvalidKey {
+		t.Error("expected ErrInvalidKey for an empty key, got", err)
+	}
+}
+
+// plainStorage hides the optional interfaces of FileStorage, to exercise the fallbacks
+type plainStorage struct {
+	Storage
+}
+
+func TestStorage_CopyComposeMetadata(t *testing.T) {
+	dir, err := os.MkdirTemp("", "toolkit-storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	fs := &FileStorage{Dir: dir}
+
+	for _, store := range []Storage{fs, plainStorage{fs}} {
+		_ = fs.Put(ctx, "parts/1", strings.NewReader("hello, "))
+		_ = fs.Put(ctx, "parts/2", strings.NewReader("world"))
+
+		if err = CompleteMultipart(ctx, store, "whole.txt", []string{"parts/1", "parts/2"}); err != nil {
+			t.Fatal(err)
+		}
+		if list, _ := fs.List(ctx, "parts/"); len(list) != 0 {
+			t.Error("parts were not deleted", list)
+		}
+
+		if err = CopyObject(ctx, store, "whole.txt", "tenant-b/whole.txt"); err != nil {
+			t.Fatal(err)
+		}
+
+		f, err := fs.Get(ctx, "tenant-b/whole.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(f)
+		f.Close()
+		if string(b) != "hello, world" {
+			t.Error("wrong composed contents", string(b))
+		}
+	}
+
+	if err = SetMetadata(ctx, fs, "whole.txt", map[string]string{"owner": "jack"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = CopyObject(ctx, fs, "whole.txt", "copy.txt"); err != nil {
+		t.Fatal(err)
+	}
+	meta, err := GetMetadata(ctx, fs, "copy.txt")
+	if err != nil || meta["owner"] != "jack" {
+		t.Error("metadata was not copied", meta, err)
+	}
+
+	// an overwritten object loses its metadata
+	if err = fs.Put(ctx, "copy.txt", strings.NewReader("new")); err != nil {
+		t.Fatal(err)
+	}
+	if meta, err = GetMetadata(ctx, fs, "copy.txt"); err != nil || len(meta) != 0 {
+		t.Error("metadata was kept for an overwritten object", meta, err)
+	}
+	if err = CopyObject(ctx, fs, "whole.txt", "whole.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if meta, err = GetMetadata(ctx, fs, "whole.txt"); err != nil || meta["owner"] != "jack" {
+		t.Error("metadata was lost copying an object onto itself", meta, err)
+	}
+
+	// metadata is not listed as an object, and goes away with its object
+	list, _ := fs.List(ctx, "")
+	for _, o := range list {
+		if strings.HasPrefix(o.Key, ".meta") {
+			t.Error("metadata listed as an object", o.Key)
+		}
+	}
+	_ = fs.Delete(ctx, "copy.txt")
+	if _, err = os.Stat(fs.metaPath("copy.txt")); !os.IsNotExist(err) {
+		t.Error("metadata was not deleted with its object")
+	}
+
+	if _, err = GetMetadata(ctx, plainStorage{fs}, "whole.txt"); err != ErrNotSupported {
+		t.Error("expected ErrNotSupported, got", err)
+	}
+	if err = SetMetadata(ctx, fs, "missing.txt", nil); err != ErrNotFound {
+		t.Error("expected ErrNotFound setting metadata on a missing object, got", err)
+	}
+}
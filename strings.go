@@ -0,0 +1,171 @@
+package toolkit
+
+import (
+	"strings"
+	"text/template"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Truncate returns s cut to at most n characters, counting runes rather than bytes, and never
+// cutting between a character and the combining marks, such as accents, which follow it
+func Truncate(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	count := 0
+	for i, r := range s {
+		if i > 0 && unicode.Is(unicode.Mn, r) {
+			// a combining mark belongs to the character before it
+			continue
+		}
+		if count == n {
+			return s[:i]
+		}
+		count++
+	}
+	return s
+}
+
+// Ellipsis returns s cut to at most n characters, as Truncate does, ending with an ellipsis
+// if it was cut. It cuts at the last space if that loses no more than a third of the text.
+func Ellipsis(s string, n int) string {
+	if Truncate(s, n) == s {
+		return s
+	}
+	if n <= 1 {
+		return Truncate("…", n)
+	}
+	cut := Truncate(s, n-1)
+	if i := strings.LastIndexFunc(cut, unicode.IsSpace); i > 0 && utf8.RuneCountInString(cut[:i]) >= (n-1)*2/3 {
+		cut = cut[:i]
+	}
+	return strings.TrimRightFunc(cut, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsPunct(r)
+	}) + "…"
+}
+
+// commonInitialisms are written in capitals in Go names, as golint suggests
+var commonInitialisms = map[string]bool{
+	"ACL": true, "API": true, "ASCII": true, "CPU": true, "CSS": true, "CSV": true, "DNS": true,
+	"EOF": true, "GUID": true, "HTML": true, "HTTP": true, "HTTPS": true, "ID": true, "IP": true,
+	"JSON": true, "JWT": true, "LHS": true, "QPS": true, "RAM": true, "RHS": true, "RPC": true,
+	"SLA": true, "SMTP": true, "SQL": true, "SSH": true, "TCP": true, "TLS": true, "TTL": true,
+	"UDP": true, "UI": true, "UID": true, "URI": true, "URL": true, "UTF8": true, "UUID": true,
+	"VM": true, "XML": true, "XMPP": true, "XSRF": true, "XSS": true,
+}
+
+// splitWords splits an identifier into its words: at underscores, hyphens, spaces and dots,
+// and at changes of case, keeping runs of capitals such as HTTP together
+func splitWords(s string) []string {
+	var words []string
+	runes := []rune(s)
+	start := -1
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			if start >= 0 {
+				words = append(words, string(runes[start:i]))
+				start = -1
+			}
+			continue
+		}
+		if start < 0 {
+			start = i
+			continue
+		}
+		prev := runes[i-1]
+		switch {
+		case unicode.IsUpper(r) && (unicode.IsLower(prev) || unicode.IsDigit(prev)),
+			// the last capital of a run starts the next word, as in HTTPServer, unless it's a
+			// plural, as in UserIDs
+			unicode.IsUpper(r) && unicode.IsUpper(prev) && i+1 < len(runes) && unicode.IsLower(runes[i+1]) && !isPluralS(runes, i+1):
+			words = append(words, string(runes[start:i]))
+			start = i
+		}
+	}
+	if start >= 0 {
+		words = append(words, string(runes[start:]))
+	}
+	return words
+}
+
+func isPluralS(runes []rune, i int) bool {
+	return runes[i] == 's' && (i+1 == len(runes) || !unicode.IsLower(runes[i+1]))
+}
+
+func joinWords(s, sep string) string {
+	words := splitWords(s)
+	for i, w := range words {
+		words[i] = strings.ToLower(w)
+	}
+	return strings.Join(words, sep)
+}
+
+// ToSnake converts an identifier to snake_case, the convention for database columns: UserID
+// and userId become user_id, and HTTPServer becomes http_server
+func ToSnake(s string) string {
+	return joinWords(s, "_")
+}
+
+// ToKebab converts an identifier to kebab-case, as used in URLs and headers
+func ToKebab(s string) string {
+	return joinWords(s, "-")
+}
+
+// ToCamel converts an identifier to lowerCamelCase, the usual convention for JSON names:
+// user_id becomes userId
+func ToCamel(s string) string {
+	words := splitWords(s)
+	var b strings.Builder
+	for i, w := range words {
+		w = strings.ToLower(w)
+		if i > 0 {
+			r, size := utf8.DecodeRuneInString(w)
+			w = string(unicode.ToUpper(r)) + w[size:]
+		}
+		b.WriteString(w)
+	}
+	return b.String()
+}
+
+// ToPascal converts an identifier to a Go exported name, with common initialisms in capitals:
+// user_id becomes UserID and http_server becomes HTTPServer
+func ToPascal(s string) string {
+	words := splitWords(s)
+	var b strings.Builder
+	for _, w := range words {
+		if upper := strings.ToUpper(w); commonInitialisms[upper] {
+			b.WriteString(upper)
+			continue
+		}
+		w = strings.ToLower(w)
+		r, size := utf8.DecodeRuneInString(w)
+		b.WriteString(string(unicode.ToUpper(r)) + w[size:])
+	}
+	return b.String()
+}
+
+// EscapeHTML escapes s for use as HTML text or a quoted attribute value
+func EscapeHTML(s string) string {
+	return template.HTMLEscapeString(s)
+}
+
+// EscapeJS escapes s for use inside a quoted JavaScript string, including one in an HTML
+// script element: quotes, backslashes, angle brackets, ampersands, equals signs and control
+// characters are written as escapes
+func EscapeJS(s string) string {
+	return template.JSEscapeString(s)
+}
+
+// StringFuncs returns the string helpers as template functions, named truncate, ellipsis,
+// snake, kebab, camel and pascal, for the Funcs method of text/template or html/template
+func StringFuncs() map[string]any {
+	return map[string]any{
+		"truncate": func(n int, s string) string { return Truncate(s, n) },
+		"ellipsis": func(n int, s string) string { return Ellipsis(s, n) },
+		"snake":    ToSnake,
+		"kebab":    ToKebab,
+		"camel":    ToCamel,
+		"pascal":   ToPascal,
+	}
+}
@@ -0,0 +1,101 @@
+package toolkit
+
+import (
+	"bytes"
+	"testing"
+	"text/template"
+)
+
+func TestTruncate(t *testing.T) {
+	var tests = []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{s: "hello", n: 10, want: "hello"},
+		{s: "hello", n: 5, want: "hello"},
+		{s: "hello", n: 3, want: "hel"},
+		{s: "hello", n: 0, want: ""},
+		{s: "héllo wörld", n: 4, want: "héll"},
+		{s: "日本語テキスト", n: 3, want: "日本語"},
+		// e followed by a combining acute accent is one character
+		{s: "cafe\u0301 noir", n: 4, want: "cafe\u0301"},
+		{s: "👍👍👍", n: 2, want: "👍👍"},
+	}
+	for _, e := range tests {
+		if got := Truncate(e.s, e.n); got != e.want {
+			t.Errorf("Truncate(%q, %d): expected %q, got %q", e.s, e.n, e.want, got)
+		}
+	}
+}
+
+func TestEllipsis(t *testing.T) {
+	var tests = []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{s: "short", n: 10, want: "short"},
+		{s: "the quick brown fox", n: 12, want: "the quick…"},
+		{s: "the quick brown fox", n: 16, want: "the quick brown…"},
+		{s: "supercalifragilistic", n: 8, want: "superca…"},
+		{s: "hello, world", n: 8, want: "hello…"},
+		{s: "日本語テキスト", n: 4, want: "日本語…"},
+		{s: "abc", n: 1, want: "…"},
+	}
+	for _, e := range tests {
+		if got := Ellipsis(e.s, e.n); got != e.want {
+			t.Errorf("Ellipsis(%q, %d): expected %q, got %q", e.s, e.n, e.want, got)
+		}
+	}
+}
+
+func TestCaseConversions(t *testing.T) {
+	var tests = []struct {
+		s                           string
+		snake, kebab, camel, pascal string
+	}{
+		{s: "UserID", snake: "user_id", kebab: "user-id", camel: "userId", pascal: "UserID"},
+		{s: "user_id", snake: "user_id", kebab: "user-id", camel: "userId", pascal: "UserID"},
+		{s: "userName", snake: "user_name", kebab: "user-name", camel: "userName", pascal: "UserName"},
+		{s: "HTTPServer", snake: "http_server", kebab: "http-server", camel: "httpServer", pascal: "HTTPServer"},
+		{s: "UserIDs", snake: "user_ids", kebab: "user-ids", camel: "userIds", pascal: "UserIds"},
+		{s: "api-key v2", snake: "api_key_v2", kebab: "api-key-v2", camel: "apiKeyV2", pascal: "APIKeyV2"},
+		{s: "Address2Line", snake: "address2_line", kebab: "address2-line", camel: "address2Line", pascal: "Address2Line"},
+		{s: "", snake: "", kebab: "", camel: "", pascal: ""},
+	}
+	for _, e := range tests {
+		if got := ToSnake(e.s); got != e.snake {
+			t.Errorf("ToSnake(%q): expected %q, got %q", e.s, e.snake, got)
+		}
+		if got := ToKebab(e.s); got != e.kebab {
+			t.Errorf("ToKebab(%q): expected %q, got %q", e.s, e.kebab, got)
+		}
+		if got := ToCamel(e.s); got != e.camel {
+			t.Errorf("ToCamel(%q): expected %q, got %q", e.s, e.camel, got)
+		}
+		if got := ToPascal(e.s); got != e.pascal {
+			t.Errorf("ToPascal(%q): expected %q, got %q", e.s, e.pascal, got)
+		}
+	}
+}
+
+func TestEscape(t *testing.T) {
+	if got := EscapeHTML(`<a href="x">Tom & 'Jerry'</a>`); got != "&lt;a href=&#34;x&#34;&gt;Tom &amp; &#39;Jerry&#39;&lt;/a&gt;" {
+		t.Errorf("unexpected html escape %s", got)
+	}
+	if got := EscapeJS(`</script><script>alert('x')`); got != `\u003C/script\u003E\u003Cscript\u003Ealert(\'x\')` {
+		t.Errorf("unexpected js escape %s", got)
+	}
+}
+
+func TestStringFuncs(t *testing.T) {
+	tmpl := template.Must(template.New("t").Funcs(StringFuncs()).Parse(`{{snake .Name}} {{camel .Name}} {{.Title | ellipsis 8}}`))
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, map[string]string{"Name": "UserID", "Title": "a very long title"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != "user_id userId a very…" {
+		t.Errorf("unexpected template output %q", got)
+	}
+}
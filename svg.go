@@ -0,0 +1,198 @@
+package toolkit
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// SVGContentType is the MIME type of SVG images, which UploadFile, Ingest and WebDAV sanitize
+const SVGContentType = "image/svg+xml"
+
+// svgBlockedElements are removed from SVGs along with their contents, as they run scripts or
+// embed other documents
+var svgBlockedElements = map[string]bool{
+	"script":        true,
+	"foreignobject": true,
+	"iframe":        true,
+	"embed":         true,
+	"object":        true,
+	"handler":       true,
+	"listener":      true,
+}
+
+var (
+	// svgURL matches CSS url() references, capturing the target
+	svgURL = regexp.MustCompile(`(?i)url\(\s*['"]?\s*([^'")\s]*)`)
+	// svgDataImage matches data URLs of raster images, which are safe to reference
+	svgDataImage = regexp.MustCompile(`(?i)^data:image/(png|jpeg|gif|webp)[;,]`)
+)
+
+// SanitizeSVG copies the SVG image in src to dst without the parts which can run scripts or
+// load other resources: script and foreignObject elements, event handler attributes, links
+// and url() references to anything but fragments of the image itself or embedded raster
+// images, stylesheets with @import, comments, DTDs and processing instructions. An SVG which
+// isn't well formed XML is an error. Uploads detected as SVG are sanitized automatically by
+// UploadFile, Ingest and WebDAV, and refused by ContentAddressedUploadHandler, so SVGs can be
+// allowed, such as for logos, and served back without running anything.
+func SanitizeSVG(dst io.Writer, src io.Reader) error {
+	d := xml.NewDecoder(src)
+	d.Strict = true
+
+	w := bufio.NewWriter(dst)
+	var (
+		stack []string // the open elements, to know when a skipped element ends
+		skip  int      // the depth of the element being skipped, or 0
+		style bool     // whether in a style element
+	)
+
+	for {
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			if len(stack) > 0 {
+				return fmt.Errorf("invalid svg: unclosed element %s", stack[len(stack)-1])
+			}
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("invalid svg: %w", err)
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			stack = append(stack, svgName(tok.Name))
+			if skip > 0 {
+				continue
+			}
+			if svgBlockedElements[strings.ToLower(tok.Name.Local)] {
+				skip = len(stack)
+				continue
+			}
+			style = strings.EqualFold(tok.Name.Local, "style")
+
+			// animations of links could set them to anything, whatever their values look like
+			animatesLink := svgAnimatesLink(tok)
+
+			w.WriteString("<" + svgName(tok.Name))
+			for _, attr := range tok.Attr {
+				if !svgAttrAllowed(attr) || (animatesLink && svgAnimationValues[strings.ToLower(attr.Name.Local)]) {
+					continue
+				}
+				w.WriteString(" " + svgName(attr.Name) + `="`)
+				_ = xml.EscapeText(w, []byte(attr.Value))
+				w.WriteString(`"`)
+			}
+			w.WriteString(">")
+
+		case xml.EndElement:
+			// RawToken doesn't match end elements to start elements
+			if len(stack) == 0 || stack[len(stack)-1] != svgName(tok.Name) {
+				return fmt.Errorf("invalid svg: unexpected end element %s", svgName(tok.Name))
+			}
+			stack = stack[:len(stack)-1]
+			if skip > 0 {
+				if len(stack) < skip {
+					skip = 0
+				}
+				continue
+			}
+			style = false
+			w.WriteString("</" + svgName(tok.Name) + ">")
+
+		case xml.CharData:
+			if skip > 0 || (style && !svgCSSAllowed(string(tok))) {
+				continue
+			}
+			_ = xml.EscapeText(w, tok)
+
+		case xml.ProcInst:
+			// only the XML declaration is kept; xml-stylesheet could load anything
+			if tok.Target == "xml" && len(stack) == 0 {
+				w.WriteString("<?xml " + string(tok.Inst) + "?>")
+			}
+		}
+	}
+
+	return w.Flush()
+}
+
+// svgName returns an element or attribute name with its namespace prefix, as written
+func svgName(name xml.Name) string {
+	if name.Space != "" {
+		return name.Space + ":" + name.Local
+	}
+	return name.Local
+}
+
+// svgAnimationValues are the attributes of set and animate elements giving the values set
+var svgAnimationValues = map[string]bool{"to": true, "from": true, "values": true, "by": true}
+
+// svgAnimatesLink reports whether el is a set or animate element changing a link
+func svgAnimatesLink(el xml.StartElement) bool {
+	local := strings.ToLower(el.Name.Local)
+	if local != "set" && !strings.HasPrefix(local, "animate") {
+		return false
+	}
+	for _, attr := range el.Attr {
+		if strings.EqualFold(attr.Name.Local, "attributeName") {
+			name := strings.ToLower(svgStripURLSpace(attr.Value))
+			if i := strings.LastIndexByte(name, ':'); i >= 0 {
+				name = name[i+1:]
+			}
+			return name == "href" || name == "src"
+		}
+	}
+	return false
+}
+
+// svgStripURLSpace removes the ASCII whitespace and control characters browsers ignore in URLs,
+// so "java&#9;script:" is seen as the scheme it is
+func svgStripURLSpace(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// svgAttrAllowed reports whether an attribute is safe to keep
+func svgAttrAllowed(attr xml.Attr) bool {
+	local := strings.ToLower(attr.Name.Local)
+	value := strings.ToLower(svgStripURLSpace(attr.Value))
+
+	switch {
+	case strings.HasPrefix(local, "on"):
+		return false
+	case attr.Name.Space == "xml" && local == "base":
+		return false
+	case local == "href" || local == "src":
+		return strings.HasPrefix(value, "#") || svgDataImage.MatchString(value)
+	case strings.Contains(value, "javascript:") || strings.Contains(value, "vbscript:"):
+		// e.g. <set attributeName="href" to="javascript:...">
+		return false
+	}
+	return svgCSSAllowed(value)
+}
+
+// svgCSSAllowed reports whether a style sheet or attribute value only references fragments
+// of the image itself or embedded raster images
+func svgCSSAllowed(css string) bool {
+	lower := strings.ToLower(svgStripURLSpace(css))
+	// escapes such as u\72l( could hide anything from the checks below
+	if strings.Contains(css, `\`) {
+		return false
+	}
+	if strings.Contains(lower, "@import") || strings.Contains(lower, "expression(") || strings.Contains(lower, "javascript:") {
+		return false
+	}
+	for _, m := range svgURL.FindAllStringSubmatch(css, -1) {
+		if !strings.HasPrefix(m[1], "#") && !svgDataImage.MatchString(m[1]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,156 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSanitizeSVG(t *testing.T) {
+	var tests = []struct {
+		name string
+		svg  string
+		exp  string
+	}{
+		{"clean", `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 10 10"><rect width="10" height="10" fill="red"/></svg>`,
+			`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 10 10"><rect width="10" height="10" fill="red"></rect></svg>`},
+		{"script", `<svg><script>alert(1)</script><circle r="1"/></svg>`,
+			`<svg><circle r="1"></circle></svg>`},
+		{"nested script", `<svg><g><script><![CDATA[alert(1)]]></script></g></svg>`,
+			`<svg><g></g></svg>`},
+		{"event handler", `<svg onload="alert(1)"><rect onClick="alert(1)" width="1"/></svg>`,
+			`<svg><rect width="1"></rect></svg>`},
+		{"foreign object", `<svg><foreignObject><body xmlns="http://www.w3.org/1999/xhtml"><iframe src="x"/></body></foreignObject><path d="M0 0"/></svg>`,
+			`<svg><path d="M0 0"></path></svg>`},
+		{"javascript link", `<svg xmlns:xlink="http://www.w3.org/1999/xlink"><a xlink:href="javascript:alert(1)"><text>hi</text></a></svg>`,
+			`<svg xmlns:xlink="http://www.w3.org/1999/xlink"><a><text>hi</text></a></svg>`},
+		{"external reference", `<svg><use href="https://evil.example/x.svg#a"/><image href="http://evil.example/x.png"/></svg>`,
+			`<svg><use></use><image></image></svg>`},
+		{"fragment reference", `<svg><use href="#a"/><rect fill="url(#grad)"/></svg>`,
+			`<svg><use href="#a"></use><rect fill="url(#grad)"></rect></svg>`},
+		{"external url", `<svg><rect fill="url(https://evil.example/track)" style="background: url('//evil.example/x')"/></svg>`,
+			`<svg><rect></rect></svg>`},
+		{"data image", `<svg><image href="data:image/png;base64,AAAA"/><image href="data:image/svg+xml;base64,AAAA"/></svg>`,
+			`<svg><image href="data:image/png;base64,AAAA"></image><image></image></svg>`},
+		{"animated href", `<svg><a><set attributeName="href" to="javascript:alert(1)"/></a></svg>`,
+			`<svg><a><set attributeName="href"></set></a></svg>`},
+		{"animated href with a tab", `<svg><a><animate attributeName="href" values="java&#9;script:alert(1)"/><text>x</text></a></svg>`,
+			`<svg><a><animate attributeName="href"></animate><text>x</text></a></svg>`},
+		{"animated xlink href", `<svg><a><set attributeName="xlink:href" to="#ok" from="#ok" by="#ok"/></a></svg>`,
+			`<svg><a><set attributeName="xlink:href"></set></a></svg>`},
+		{"animated fill", `<svg><rect><animate attributeName="fill" values="red;blue"/></rect></svg>`,
+			`<svg><rect><animate attributeName="fill" values="red;blue"></animate></rect></svg>`},
+		{"link with a newline", `<svg><a href="java&#10;script:alert(1)"><text>x</text></a><rect fill="java&#13;script:x"/></svg>`,
+			`<svg><a><text>x</text></a><rect></rect></svg>`},
+		{"css escaped url", `<svg><style>.a{background:u\72l(https://evil.example/t)}</style><rect style="background:u\72l(https://evil.example/t)"/></svg>`,
+			`<svg><style></style><rect></rect></svg>`},
+		{"css escaped import", `<svg><style>@\69mport "https://evil.example/x.css";</style></svg>`,
+			`<svg><style></style></svg>`},
+		{"style import", `<svg><style>@import url(https://evil.example/a.css);</style><style>.a{fill:red}</style></svg>`,
+			`<svg><style></style><style>.a{fill:red}</style></svg>`},
+		{"prolog", `<?xml version="1.0"?><?xml-stylesheet href="https://evil.example/a.css"?><!DOCTYPE svg><!-- hi --><svg></svg>`,
+			`<?xml version="1.0"?><svg></svg>`},
+		{"escaping", `<svg><text title="a &amp; &quot;b&quot;">1 &lt; 2</text></svg>`,
+			`<svg><text title="a &amp; &#34;b&#34;">1 &lt; 2</text></svg>`},
+	}
+
+	for _, e := range tests {
+		var out bytes.Buffer
+		if err := SanitizeSVG(&out, strings.NewReader(e.svg)); err != nil {
+			t.Errorf("%s: %v", e.name, err)
+			continue
+		}
+		if out.String() != e.exp {
+			t.Errorf("%s: expected\n%s\nbut got\n%s", e.name, e.exp, out.String())
+		}
+	}
+}
+
+func TestSanitizeSVG_Invalid(t *testing.T) {
+	var tests = []struct {
+		name string
+		svg  string
+	}{
+		{"unclosed", `<svg><rect>`},
+		{"entity", `<!DOCTYPE svg [<!ENTITY x "lol">]><svg>&x;</svg>`},
+		{"stray end", `<svg></svg></g>`},
+	}
+
+	for _, e := range tests {
+		if err := SanitizeSVG(io.Discard, strings.NewReader(e.svg)); err == nil {
+			t.Errorf("%s: expected an error", e.name)
+		}
+	}
+}
+
+const maliciousSVG = `<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg" onload="alert(1)"><script>alert(2)</script><rect width="10" height="10"/></svg>`
+
+func TestTools_UploadFile_SVG(t *testing.T) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", "logo.svg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = part.Write([]byte(maliciousSVG))
+	_ = writer.Close()
+
+	dir, err := os.MkdirTemp("", "upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	request := httptest.NewRequest("POST", "/", &body)
+	request.Header.Add("Content-Type", writer.FormDataContentType())
+
+	var testTools Tools
+	uploaded, err := testTools.UploadFile(request, dir+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := os.ReadFile(dir + "/" + uploaded.NewFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(stored, []byte("alert")) || !bytes.Contains(stored, []byte("<rect")) {
+		t.Errorf("expected a sanitized svg but got %s", stored)
+	}
+	if uploaded.FileSize != int64(len(stored)) {
+		t.Errorf("expected size %d but got %d", len(stored), uploaded.FileSize)
+	}
+}
+
+func TestIngest_SVG(t *testing.T) {
+	store := &FileStorage{Dir: t.TempDir()}
+	in := &Ingest{Storage: store, Prefix: "in/"}
+	ctx := context.Background()
+
+	f, err := in.File(ctx, "logo.svg", strings.NewReader(maliciousSVG))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rc, err := store.Get(ctx, "in/"+f.NewFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	stored, _ := io.ReadAll(rc)
+	if bytes.Contains(stored, []byte("alert")) {
+		t.Errorf("expected a sanitized svg but got %s", stored)
+	}
+	if f.FileSize != int64(len(stored)) || !strings.HasPrefix(f.NewFileName, f.Checksum) {
+		t.Errorf("expected the record to describe the sanitized svg: %+v", f)
+	}
+
+	if _, err = in.File(ctx, "broken.svg", strings.NewReader(`<svg xmlns="http://www.w3.org/2000/svg"><rect>`)); err == nil {
+		t.Error("expected an error for a malformed svg")
+	}
+}
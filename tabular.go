@@ -0,0 +1,358 @@
+package toolkit
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ExportFormat is a tabular file format
+type ExportFormat string
+
+// Supported tabular formats
+const (
+	FormatCSV  ExportFormat = "csv"
+	FormatXLSX ExportFormat = "xlsx"
+	FormatJSON ExportFormat = "json"
+)
+
+// ContentType returns the MIME type of the format
+func (f ExportFormat) ContentType() string {
+	switch f {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	case FormatZIP:
+		return "application/zip"
+	default:
+		return "application/json"
+	}
+}
+
+// RowIterator yields the rows of a table, one at a time, so that large tables never have to
+// be held in memory
+type RowIterator interface {
+	// Columns returns the column names
+	Columns() []string
+	// Next returns the next row, or io.EOF when there are no more rows
+	Next() ([]any, error)
+}
+
+// SliceRows is a RowIterator over rows held in memory
+type SliceRows struct {
+	Cols []string
+	Rows [][]any
+	pos  int
+}
+
+// Columns returns the column names
+func (s *SliceRows) Columns() []string {
+	return s.Cols
+}
+
+// Next returns the next row
+func (s *SliceRows) Next() ([]any, error) {
+	if s.pos >= len(s.Rows) {
+		return nil, io.EOF
+	}
+	s.pos++
+	return s.Rows[s.pos-1], nil
+}
+
+// WriteRows writes every row from rows to w in the given format
+func WriteRows(w io.Writer, format ExportFormat, rows RowIterator) error {
+	switch format {
+	case FormatCSV:
+		return writeCSV(w, rows)
+	case FormatXLSX:
+		return writeXLSX(w, rows)
+	case FormatJSON:
+		return writeJSONRows(w, rows)
+	default:
+		return fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+// WriteTable writes rows as a downloadable file in the given format. The file name is
+// used for the content disposition, and should not include an extension. If NeutralizeFormulas
+// is set, CSV and XLSX cells which could be interpreted as formulas are escaped.
+func (t *Tools) WriteTable(w http.ResponseWriter, format ExportFormat, fileName string, rows RowIterator) error {
+	switch format {
+	case FormatCSV, FormatXLSX, FormatJSON:
+	default:
+		return fmt.Errorf("unsupported format %q", format)
+	}
+
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.%s\"", fileName, format))
+
+	if t.NeutralizeFormulas && format != FormatJSON {
+		rows = SafeRows(rows)
+	}
+	return WriteRows(w, format, rows)
+}
+
+// NeutralizeFormula escapes a cell value which a spreadsheet would interpret as a formula,
+// by prefixing it with a single quote. Values starting with =, +, -, @, tab, or carriage
+// return are escaped, so that user generated content can be exported safely.
+func NeutralizeFormula(s string) string {
+	if s == "" {
+		return s
+	}
+	switch s[0] {
+	case '=', '+', '-', '@', '\t', '\r':
+		return "'" + s
+	}
+	return s
+}
+
+// SafeRows wraps a RowIterator, neutralizing formulas in every text cell and column name.
+// Numbers, booleans and other non-text values are passed through unchanged.
+func SafeRows(rows RowIterator) RowIterator {
+	return safeRows{rows}
+}
+
+type safeRows struct {
+	rows RowIterator
+}
+
+func (s safeRows) Columns() []string {
+	cols := s.rows.Columns()
+	out := make([]string, len(cols))
+	for i, col := range cols {
+		out[i] = NeutralizeFormula(col)
+	}
+	return out
+}
+
+func (s safeRows) Next() ([]any, error) {
+	row, err := s.rows.Next()
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]any, len(row))
+	for i, v := range row {
+		switch val := v.(type) {
+		case string:
+			out[i] = NeutralizeFormula(val)
+		case []byte:
+			out[i] = NeutralizeFormula(string(val))
+		case time.Time:
+			out[i] = v
+		case fmt.Stringer:
+			out[i] = NeutralizeFormula(val.String())
+		default:
+			out[i] = v
+		}
+	}
+	return out, nil
+}
+
+func writeCSV(w io.Writer, rows RowIterator) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(rows.Columns()); err != nil {
+		return err
+	}
+
+	record := make([]string, len(rows.Columns()))
+	for {
+		row, err := rows.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		record = record[:0]
+		for _, v := range row {
+			record = append(record, formatCell(v))
+		}
+		if err = cw.Write(record); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeJSONRows(w io.Writer, rows RowIterator) error {
+	cols := rows.Columns()
+	enc := json.NewEncoder(w)
+
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+
+	for i := 0; ; i++ {
+		row, err := rows.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		obj := make(map[string]any, len(cols))
+		for j, col := range cols {
+			if j < len(row) {
+				obj[col] = row[j]
+			}
+		}
+
+		if i > 0 {
+			if _, err = io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		if err = enc.Encode(obj); err != nil {
+			return err
+		}
+	}
+
+	_, err := io.WriteString(w, "]\n")
+	return err
+}
+
+func formatCell(v any) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case []byte:
+		return string(val)
+	case time.Time:
+		return val.Format(time.RFC3339)
+	case fmt.Stringer:
+		return val.String()
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+const xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`
+
+const xlsxRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`
+
+const xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Sheet1" sheetId="1" r:id="rId1"/></sheets></workbook>`
+
+const xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`
+
+// writeXLSX writes a minimal single-sheet workbook, streaming rows into the sheet
+func writeXLSX(w io.Writer, rows RowIterator) error {
+	zw := zip.NewWriter(w)
+
+	for _, part := range []struct{ name, body string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRels},
+		{"xl/workbook.xml", xlsxWorkbook},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+	} {
+		f, err := zw.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err = io.WriteString(f, part.body); err != nil {
+			return err
+		}
+	}
+
+	sheet, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(sheet, `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>`+
+		`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	if err != nil {
+		return err
+	}
+
+	header := make([]any, len(rows.Columns()))
+	for i, col := range rows.Columns() {
+		header[i] = col
+	}
+	if err = writeXLSXRow(sheet, 1, header); err != nil {
+		return err
+	}
+
+	for n := 2; ; n++ {
+		row, err := rows.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err = writeXLSXRow(sheet, n, row); err != nil {
+			return err
+		}
+	}
+
+	if _, err = io.WriteString(sheet, `</sheetData></worksheet>`); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func writeXLSXRow(w io.Writer, n int, row []any) error {
+	if _, err := fmt.Fprintf(w, `<row r="%d">`, n); err != nil {
+		return err
+	}
+
+	for i, v := range row {
+		ref := xlsxColumn(i) + strconv.Itoa(n)
+
+		var err error
+		switch val := v.(type) {
+		case nil:
+			continue
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+			_, err = fmt.Fprintf(w, `<c r="%s"><v>%v</v></c>`, ref, val)
+		case bool:
+			b := 0
+			if val {
+				b = 1
+			}
+			_, err = fmt.Fprintf(w, `<c r="%s" t="b"><v>%d</v></c>`, ref, b)
+		default:
+			if _, err = fmt.Fprintf(w, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">`, ref); err != nil {
+				return err
+			}
+			if err = xml.EscapeText(w, []byte(formatCell(val))); err != nil {
+				return err
+			}
+			_, err = io.WriteString(w, `</t></is></c>`)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := io.WriteString(w, `</row>`)
+	return err
+}
+
+// xlsxColumn converts a zero based column index to a spreadsheet column name, e.g. 27 to "AB"
+func xlsxColumn(i int) string {
+	name := ""
+	for i >= 0 {
+		name = string(rune('A'+i%26)) + name
+		i = i/26 - 1
+	}
+	return name
+}
@@ -0,0 +1,133 @@
+package toolkit
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func testRows() *SliceRows {
+	return &SliceRows{
+		Cols: []string{"name", "qty", "note"},
+		Rows: [][]any{
+			{"widget", 3, "a, b"},
+			{"gadget <big>", 1.5, nil},
+		},
+	}
+}
+
+func TestWriteRows(t *testing.T) {
+	var buf bytes.Buffer
+
+	if err := WriteRows(&buf, FormatCSV, testRows()); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "name,qty,note\nwidget,3,\"a, b\"\ngadget <big>,1.5,\n" {
+		t.Error("wrong csv output:", buf.String())
+	}
+
+	buf.Reset()
+	if err := WriteRows(&buf, FormatJSON, testRows()); err != nil {
+		t.Fatal(err)
+	}
+	var decoded []map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatal("invalid json output:", err, buf.String())
+	}
+	if len(decoded) != 2 || decoded[0]["name"] != "widget" {
+		t.Error("wrong json output:", decoded)
+	}
+
+	buf.Reset()
+	if err := WriteRows(&buf, FormatXLSX, testRows()); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal("xlsx output is not a zip file:", err)
+	}
+	for _, f := range zr.File {
+		if f.Name != "xl/worksheets/sheet1.xml" {
+			continue
+		}
+		rc, _ := f.Open()
+		sheet, _ := io.ReadAll(rc)
+		rc.Close()
+		if !strings.Contains(string(sheet), "gadget &lt;big&gt;") || !strings.Contains(string(sheet), `<c r="B2"><v>3</v></c>`) {
+			t.Error("wrong sheet contents:", string(sheet))
+		}
+	}
+
+	if err := WriteRows(&buf, "pdf", testRows()); err == nil {
+		t.Error("expected an error for an unsupported format")
+	}
+}
+
+func TestTools_WriteTable(t *testing.T) {
+	var testTools Tools
+
+	rr := httptest.NewRecorder()
+	if err := testTools.WriteTable(rr, FormatCSV, "report", testRows()); err != nil {
+		t.Fatal(err)
+	}
+
+	if rr.Header().Get("Content-Disposition") != "attachment; filename=\"report.csv\"" {
+		t.Error("wrong content disposition", rr.Header().Get("Content-Disposition"))
+	}
+	if !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/csv") {
+		t.Error("wrong content type", rr.Header().Get("Content-Type"))
+	}
+}
+
+func TestXLSXColumn(t *testing.T) {
+	for i, want := range map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 701: "ZZ", 702: "AAA"} {
+		if got := xlsxColumn(i); got != want {
+			t.Errorf("column %d: expected %s, got %s", i, want, got)
+		}
+	}
+}
+
+func TestNeutralizeFormula(t *testing.T) {
+	var tests = []struct {
+		in   string
+		want string
+	}{
+		{"", ""},
+		{"plain", "plain"},
+		{"=HYPERLINK(\"http://evil\")", "'=HYPERLINK(\"http://evil\")"},
+		{"+1", "'+1"},
+		{"-2+3", "'-2+3"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\tcmd", "'\tcmd"},
+		{"a=b", "a=b"},
+	}
+
+	for _, e := range tests {
+		if got := NeutralizeFormula(e.in); got != e.want {
+			t.Errorf("%q: expected %q, got %q", e.in, e.want, got)
+		}
+	}
+}
+
+func TestTools_WriteTableNeutralizeFormulas(t *testing.T) {
+	testTools := Tools{NeutralizeFormulas: true}
+
+	rows := &SliceRows{
+		Cols: []string{"name", "balance"},
+		Rows: [][]any{{"=cmd|' /C calc'!A0", -5}},
+	}
+
+	rr := httptest.NewRecorder()
+	if err := testTools.WriteTable(rr, FormatCSV, "report", rows); err != nil {
+		t.Fatal(err)
+	}
+
+	// text is escaped, but numbers are left alone
+	if rr.Body.String() != "name,balance\n'=cmd|' /C calc'!A0,-5\n" {
+		t.Error("formula was not neutralized:", rr.Body.String())
+	}
+}
@@ -0,0 +1,175 @@
+package toolkit
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrTooDeep is returned by WalkStrings for values nested more deeply than MaxWalkDepth,
+// which is usually a pointer cycle
+var ErrTooDeep = errors.New("value is nested too deeply")
+
+// MaxWalkDepth is how many levels of structs, slices and maps WalkStrings descends into
+const MaxWalkDepth = 64
+
+// FieldInfo describes a field of a struct type, as seen by encoding/json
+type FieldInfo struct {
+	// Name is the field's name in Go
+	Name string
+	// JSONName is the field's name in JSON: its json tag name, or Name if it has none. It is
+	// empty for embedded fields without a json name, whose fields are promoted
+	JSONName string
+	// Index is the field's index, for reflect.Value.Field
+	Index int
+	Type  reflect.Type
+	Tag   reflect.StructTag
+	// Embedded reports whether the field is an embedded struct whose fields are promoted
+	Embedded bool
+	// OmitEmpty reports whether the json tag has the omitempty option
+	OmitEmpty bool
+}
+
+var typeFieldsCache sync.Map // reflect.Type -> []FieldInfo
+
+// TypeFields returns the fields of a struct type which are visible to encoding/json: exported
+// fields not tagged json:"-", and embedded structs. The result is computed once per type and
+// shared, so later calls don't allocate; callers must not modify it. It returns nil for types
+// which aren't structs, or pointers to structs.
+func TypeFields(typ reflect.Type) []FieldInfo {
+	if typ == nil {
+		return nil
+	}
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return nil
+	}
+
+	if fields, ok := typeFieldsCache.Load(typ); ok {
+		return fields.([]FieldInfo)
+	}
+	fields, _ := typeFieldsCache.LoadOrStore(typ, typeFields(typ))
+	return fields.([]FieldInfo)
+}
+
+func typeFields(typ reflect.Type) []FieldInfo {
+	fields := make([]FieldInfo, 0, typ.NumField())
+	for i := 0; i < typ.NumField(); i++ {
+		sf := typ.Field(i)
+		if sf.PkgPath != "" && !sf.Anonymous {
+			continue
+		}
+
+		name, skip := jsonFieldName(sf)
+		if skip {
+			continue
+		}
+
+		ft := sf.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		// embedded structs without a json name are flattened, as encoding/json does
+		embedded := sf.Anonymous && name == "" && ft.Kind() == reflect.Struct
+		if sf.PkgPath != "" && !embedded {
+			continue
+		}
+		if name == "" && !embedded {
+			name = sf.Name
+		}
+
+		fields = append(fields, FieldInfo{
+			Name:      sf.Name,
+			JSONName:  name,
+			Index:     i,
+			Type:      sf.Type,
+			Tag:       sf.Tag,
+			Embedded:  embedded,
+			OmitEmpty: hasTagOption(sf.Tag.Get("json"), "omitempty"),
+		})
+	}
+	return fields
+}
+
+// WalkStrings calls fn for every string, and every element of a string slice or map, reachable
+// through the exported fields of v, with its JSON path and the tag of the field holding it.
+// Nil pointers are skipped, and it returns ErrTooDeep rather than following a cycle forever.
+func WalkStrings(v any, fn func(field, value string, tag reflect.StructTag) error) error {
+	return walkStringFields(reflect.ValueOf(v), "", fn)
+}
+
+// walkStringFields is WalkStrings for a reflect.Value, starting at path
+func walkStringFields(v reflect.Value, path string, fn func(field, value string, tag reflect.StructTag) error) (err error) {
+	// reflection on a value built by hand can still panic, for instance on an unexported
+	// field reached through an embedded pointer; report it instead of crashing the request
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("walking %s: %v", path, p)
+		}
+	}()
+	return walkStrings(v, path, "", 0, fn)
+}
+
+func walkStrings(v reflect.Value, path string, tag reflect.StructTag, depth int, fn func(string, string, reflect.StructTag) error) error {
+	if depth > MaxWalkDepth {
+		return ErrTooDeep
+	}
+
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return fn(path, v.String(), tag)
+	case reflect.Struct:
+		for _, f := range TypeFields(v.Type()) {
+			field := path
+			if !f.Embedded {
+				field = joinField(path, f.JSONName)
+			}
+			if err := walkStrings(v.Field(f.Index), field, f.Tag, depth+1, fn); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := walkStrings(v.Index(i), path+"["+strconv.Itoa(i)+"]", tag, depth+1, fn); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil
+		}
+		iter := v.MapRange()
+		for iter.Next() {
+			if err := walkStrings(iter.Value(), joinField(path, iter.Key().String()), tag, depth+1, fn); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// hasTagOption reports whether a comma separated struct tag value has option after its name
+func hasTagOption(tag, option string) bool {
+	_, opts, _ := strings.Cut(tag, ",")
+	for opts != "" {
+		var opt string
+		opt, opts, _ = strings.Cut(opts, ",")
+		if opt == option {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package toolkit
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type walkBase struct {
+	ID string `json:"id"`
+}
+
+type walkNode struct {
+	walkBase
+	Title   string            `json:"title,omitempty" moderate:"true"`
+	Tags    []string          `json:"tags"`
+	Meta    map[string]string `json:"meta"`
+	Secret  string            `json:"-"`
+	private string
+	Next    *walkNode `json:"next"`
+}
+
+func TestTypeFields(t *testing.T) {
+	fields := TypeFields(reflect.TypeOf(&walkNode{}))
+
+	var names []string
+	for _, f := range fields {
+		names = append(names, f.JSONName)
+	}
+	if !reflect.DeepEqual(names, []string{"", "title", "tags", "meta", "next"}) {
+		t.Fatalf("unexpected fields %q", names)
+	}
+	if !fields[0].Embedded || fields[0].Name != "walkBase" {
+		t.Error("embedded struct not marked as embedded")
+	}
+	if !fields[1].OmitEmpty || fields[1].Tag.Get("moderate") != "true" {
+		t.Error("tag options not recorded")
+	}
+
+	if TypeFields(reflect.TypeOf("")) != nil || TypeFields(nil) != nil {
+		t.Error("expected no fields for a non-struct type")
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		TypeFields(reflect.TypeOf(walkNode{}))
+	})
+	if allocs != 0 {
+		t.Errorf("cached lookup allocated %v times", allocs)
+	}
+}
+
+func TestWalkStrings(t *testing.T) {
+	v := &walkNode{
+		walkBase: walkBase{ID: "1"},
+		Title:    "hello",
+		Tags:     []string{"a", "b"},
+		Meta:     map[string]string{"k": "v"},
+		Secret:   "hidden",
+		private:  "hidden",
+		Next:     &walkNode{Title: "child"},
+	}
+
+	got := make(map[string]string)
+	err := WalkStrings(v, func(field, value string, tag reflect.StructTag) error {
+		got[field] = value
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"id": "1", "title": "hello", "tags[0]": "a", "tags[1]": "b", "meta.k": "v",
+		"next.id": "", "next.title": "child",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestWalkStrings_Cycle(t *testing.T) {
+	v := &walkNode{}
+	v.Next = v
+
+	err := WalkStrings(v, func(string, string, reflect.StructTag) error { return nil })
+	if !errors.Is(err, ErrTooDeep) {
+		t.Errorf("expected ErrTooDeep, got %v", err)
+	}
+
+	var nilNode *walkNode
+	if err = WalkStrings(nilNode, func(string, string, reflect.StructTag) error { return nil }); err != nil {
+		t.Errorf("expected nil pointer to be skipped, got %v", err)
+	}
+}
+
+func BenchmarkWalkStrings(b *testing.B) {
+	v := &walkNode{walkBase: walkBase{ID: "1"}, Title: "hello", Tags: []string{"a"}}
+	fn := func(string, string, reflect.StructTag) error { return nil }
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = WalkStrings(v, fn)
+	}
+}
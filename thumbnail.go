@@ -0,0 +1,194 @@
+package toolkit
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ThumbnailSize is a width and height thumbnails may be requested at. Images are scaled to fit
+// within it, keeping their aspect ratio; a zero side is unbounded.
+type ThumbnailSize struct {
+	Width  int
+	Height int
+}
+
+// Thumbnails serves resized renditions of images in a Storage, generating each on first
+// request and caching it in storage. Requests must be signed, and ask for one of the allowed
+// sizes and formats, so clients can't make the server render arbitrary sizes.
+type Thumbnails struct {
+	// Storage holds the original images
+	Storage Storage
+	// Cache holds the generated renditions. Defaults to Storage
+	Cache Storage
+	// CachePrefix is prepended to the keys of renditions. Defaults to "thumbnails/"
+	CachePrefix string
+	// Signer signs thumbnail URLs
+	Signer *URLSigner
+	// BaseURL is the URL the handler is mounted at, e.g. "https://example.com/thumbs"
+	BaseURL string
+	// Sizes are the sizes which may be requested. There must be at least one
+	Sizes []ThumbnailSize
+	// Formats are the formats which may be requested. Defaults to JPEG and PNG
+	Formats []ImageFormat
+	// Quality is the quality of lossy renditions, from 1 to 100. Defaults to 85
+	Quality int
+	// MaxPixels is the largest original accepted. Defaults to DefaultMaxPixels
+	MaxPixels int
+	// MaxAge is sent in the Cache-Control header of renditions. Defaults to a day
+	MaxAge time.Duration
+}
+
+// URL returns a signed URL for a rendition of key, valid until expires
+func (th *Thumbnails) URL(key string, size ThumbnailSize, format ImageFormat, expires time.Time) (string, error) {
+	q := url.Values{}
+	q.Set("key", key)
+	q.Set("w", strconv.Itoa(size.Width))
+	q.Set("h", strconv.Itoa(size.Height))
+	q.Set("format", string(format))
+	return th.Signer.Sign(strings.TrimSuffix(th.BaseURL, "/")+"/?"+q.Encode(), expires)
+}
+
+func (th *Thumbnails) cache() Storage {
+	if th.Cache != nil {
+		return th.Cache
+	}
+	return th.Storage
+}
+
+func (th *Thumbnails) formats() []ImageFormat {
+	if len(th.Formats) > 0 {
+		return th.Formats
+	}
+	return []ImageFormat{ImageJPEG, ImagePNG}
+}
+
+// ServeHTTP implements http.Handler
+func (th *Thumbnails) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var t Tools
+
+	if th.Signer == nil {
+		_ = t.ErrorJSON(w, errors.New("thumbnails need a signer"), http.StatusInternalServerError)
+		return
+	}
+	// the signature covers the full path the client requested
+	if err := th.Signer.Verify(requestURL(r)); err != nil {
+		_ = t.ErrorJSON(w, err, http.StatusForbidden)
+		return
+	}
+
+	q := r.URL.Query()
+	key := q.Get("key")
+	width, _ := strconv.Atoi(q.Get("w"))
+	height, _ := strconv.Atoi(q.Get("h"))
+	size := ThumbnailSize{Width: width, Height: height}
+	format := ImageFormat(q.Get("format"))
+
+	if !th.sizeAllowed(size) || !th.formatAllowed(format) {
+		_ = t.ErrorJSON(w, errors.New("thumbnail size or format is not allowed"))
+		return
+	}
+
+	prefix := th.CachePrefix
+	if prefix == "" {
+		prefix = "thumbnails/"
+	}
+	cacheKey := fmt.Sprintf("%s%s/%dx%d.%s", prefix, key, width, height, format)
+
+	maxAge := th.MaxAge
+	if maxAge <= 0 {
+		maxAge = 24 * time.Hour
+	}
+	w = &cacheControlWriter{ResponseWriter: w, value: fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds()))}
+
+	if _, err := th.cache().Stat(r.Context(), cacheKey); err == nil {
+		t.ServeObject(w, r, th.cache(), cacheKey, "")
+		return
+	}
+
+	src, err := th.Storage.Get(r.Context(), key)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrNotFound) || errors.Is(err, ErrInvalidKey) {
+			status = http.StatusNotFound
+		}
+		_ = t.ErrorJSON(w, err, status)
+		return
+	}
+	img, _, err := DecodeImage(src, th.MaxPixels)
+	src.Close()
+	if err != nil {
+		_ = t.ErrorJSON(w, err, http.StatusUnprocessableEntity)
+		return
+	}
+
+	b := img.Bounds()
+	tw, tht := FitSize(b.Dx(), b.Dy(), width, height)
+	if tw != b.Dx() || tht != b.Dy() {
+		img = ResizeImage(img, tw, tht)
+	}
+
+	var buf bytes.Buffer
+	if err = EncodeImage(&buf, img, format, th.Quality); err != nil {
+		_ = t.ErrorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+	// a failure to cache only costs a render next time
+	_ = th.cache().Put(r.Context(), cacheKey, bytes.NewReader(buf.Bytes()))
+
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return
+	}
+	_, _ = w.Write(buf.Bytes())
+}
+
+func (th *Thumbnails) sizeAllowed(size ThumbnailSize) bool {
+	for _, s := range th.Sizes {
+		if s == size {
+			return true
+		}
+	}
+	return false
+}
+
+func (th *Thumbnails) formatAllowed(format ImageFormat) bool {
+	for _, f := range th.formats() {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheControlWriter sets Cache-Control on successful responses only, so that caches don't
+// keep errors for as long as renditions
+type cacheControlWriter struct {
+	http.ResponseWriter
+	value string
+	wrote bool
+}
+
+func (cw *cacheControlWriter) WriteHeader(status int) {
+	if !cw.wrote {
+		cw.wrote = true
+		if status < http.StatusBadRequest {
+			cw.ResponseWriter.Header().Set("Cache-Control", cw.value)
+		}
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *cacheControlWriter) Write(p []byte) (int, error) {
+	if !cw.wrote {
+		cw.WriteHeader(http.StatusOK)
+	}
+	return cw.ResponseWriter.Write(p)
+}
@@ -0,0 +1,75 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestThumbnails(t *testing.T) {
+	dir, err := os.MkdirTemp("", "thumbs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := &FileStorage{Dir: dir}
+	var buf bytes.Buffer
+	_ = png.Encode(&buf, testImage(400, 200))
+	_ = store.Put(context.Background(), "photos/a.png", &buf)
+
+	th := &Thumbnails{
+		Storage: store,
+		Signer:  &URLSigner{Key: []byte("0123456789abcdef0123456789abcdef")},
+		BaseURL: "/thumbs",
+		Sizes:   []ThumbnailSize{{Width: 100, Height: 100}},
+	}
+
+	get := func(u string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, u, nil)
+		rr := httptest.NewRecorder()
+		th.ServeHTTP(rr, req)
+		return rr
+	}
+
+	u, err := th.URL("photos/a.png", ThumbnailSize{Width: 100, Height: 100}, ImageJPEG, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		rr := get(u)
+		if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "image/jpeg" {
+			t.Fatalf("request %d: unexpected %d %s", i, rr.Code, rr.Body.String())
+		}
+		if cc := rr.Header().Get("Cache-Control"); cc != "public, max-age=86400" {
+			t.Errorf("request %d: unexpected Cache-Control %q", i, cc)
+		}
+		img, err := jpeg.Decode(rr.Body)
+		if err != nil || img.Bounds().Dx() != 100 || img.Bounds().Dy() != 50 {
+			t.Errorf("request %d: unexpected rendition %v %v", i, img.Bounds(), err)
+		}
+	}
+	if _, err = store.Stat(context.Background(), "thumbnails/photos/a.png/100x100.jpeg"); err != nil {
+		t.Error("expected the rendition to be cached")
+	}
+
+	notAllowed, _ := th.URL("photos/a.png", ThumbnailSize{Width: 101, Height: 100}, ImageJPEG, time.Now().Add(time.Hour))
+	if rr := get(notAllowed); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected size outside the allowlist to be refused, got %d", rr.Code)
+	}
+	if rr := get(strings.Replace(u, "w=100", "w=101", 1)); rr.Code != http.StatusForbidden {
+		t.Errorf("expected tampered query to be refused, got %d", rr.Code)
+	}
+	missing, _ := th.URL("photos/missing.png", ThumbnailSize{Width: 100, Height: 100}, ImagePNG, time.Now().Add(time.Hour))
+	if rr := get(missing); rr.Code != http.StatusNotFound || rr.Header().Get("Cache-Control") != "" {
+		t.Errorf("expected an uncached 404 for a missing original, got %d %q", rr.Code, rr.Header().Get("Cache-Control"))
+	}
+}
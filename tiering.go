@@ -0,0 +1,250 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// StorageClasser is implemented by storage backends which can change the storage class of an
+// object in place, such as S3's STANDARD_IA or GLACIER_IR classes
+type StorageClasser interface {
+	StorageClass(ctx context.Context, key string) (string, error)
+	SetStorageClass(ctx context.Context, key, class string) error
+}
+
+// AccessTracker records when objects were last read, for TieredStorage. Keep it somewhere
+// durable, such as a database, so accesses survive restarts.
+type AccessTracker interface {
+	Touch(ctx context.Context, key string, at time.Time) error
+	// LastAccess returns when key was last read, and false if it hasn't been
+	LastAccess(ctx context.Context, key string) (time.Time, bool, error)
+}
+
+// MemoryAccessTracker is an AccessTracker which keeps accesses in memory
+type MemoryAccessTracker struct {
+	mu       sync.Mutex
+	accessed map[string]time.Time
+}
+
+// Touch implements AccessTracker
+func (m *MemoryAccessTracker) Touch(ctx context.Context, key string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.accessed == nil {
+		m.accessed = make(map[string]time.Time)
+	}
+	m.accessed[key] = at
+	return nil
+}
+
+// LastAccess implements AccessTracker
+func (m *MemoryAccessTracker) LastAccess(ctx context.Context, key string) (time.Time, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	at, ok := m.accessed[key]
+	return at, ok, nil
+}
+
+// TieredStorage is a Storage which moves objects that haven't been read for a while to
+// cheaper storage. Either Cold is set, and objects are moved there and restored to Hot when
+// next read, or ColdClass is, and objects stay in Hot with their storage class changed. Run
+// Tier periodically to apply the policy.
+type TieredStorage struct {
+	// Hot holds new and recently read objects
+	Hot Storage
+	// Cold holds objects which haven't been read for After
+	Cold Storage
+	// ColdClass is the storage class objects are changed to, if Hot is a StorageClasser and
+	// Cold isn't set
+	ColdClass string
+	// After is how long an object may go unread before it is tiered. Defaults to 30 days
+	After time.Duration
+	// Accesses records reads. Defaults to a MemoryAccessTracker; objects without a recorded
+	// read are tiered by when they were stored
+	Accesses AccessTracker
+
+	once sync.Once
+}
+
+func (ts *TieredStorage) tracker() AccessTracker {
+	ts.once.Do(func() {
+		if ts.Accesses == nil {
+			ts.Accesses = &MemoryAccessTracker{}
+		}
+	})
+	return ts.Accesses
+}
+
+// Put implements Storage, storing the object in Hot
+func (ts *TieredStorage) Put(ctx context.Context, key string, r io.Reader) error {
+	if err := ts.Hot.Put(ctx, key, r); err != nil {
+		return err
+	}
+	if ts.Cold != nil {
+		// a stale copy in cold storage would be listed alongside the new one
+		if err := ts.Cold.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+	return ts.tracker().Touch(ctx, key, time.Now())
+}
+
+// Get implements Storage. Objects in Cold are restored to Hot first.
+func (ts *TieredStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	rc, err := ts.Hot.Get(ctx, key)
+	if errors.Is(err, ErrNotFound) && ts.Cold != nil {
+		if err = ts.restore(ctx, key); err != nil {
+			return nil, err
+		}
+		rc, err = ts.Hot.Get(ctx, key)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = ts.tracker().Touch(ctx, key, time.Now()); err != nil {
+		rc.Close()
+		return nil, err
+	}
+	return rc, nil
+}
+
+// restore moves an object from Cold back to Hot
+func (ts *TieredStorage) restore(ctx context.Context, key string) error {
+	rc, err := ts.Cold.Get(ctx, key)
+	if errors.Is(err, ErrNotFound) {
+		// restored by a concurrent read, or never stored
+		if _, err := ts.Hot.Stat(ctx, key); err == nil {
+			return nil
+		}
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	err = ts.Hot.Put(ctx, key, rc)
+	rc.Close()
+	if err != nil {
+		return err
+	}
+	return ts.Cold.Delete(ctx, key)
+}
+
+// Stat implements Storage
+func (ts *TieredStorage) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	info, err := ts.Hot.Stat(ctx, key)
+	if errors.Is(err, ErrNotFound) && ts.Cold != nil {
+		return ts.Cold.Stat(ctx, key)
+	}
+	return info, err
+}
+
+// Delete implements Storage, deleting the object from both tiers
+func (ts *TieredStorage) Delete(ctx context.Context, key string) error {
+	if err := ts.Hot.Delete(ctx, key); err != nil {
+		return err
+	}
+	if ts.Cold != nil {
+		return ts.Cold.Delete(ctx, key)
+	}
+	return nil
+}
+
+// List implements Storage, listing the objects in both tiers
+func (ts *TieredStorage) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	objects, err := ts.Hot.List(ctx, prefix)
+	if err != nil || ts.Cold == nil {
+		return objects, err
+	}
+	cold, err := ts.Cold.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(objects))
+	for _, obj := range objects {
+		seen[obj.Key] = true
+	}
+	for _, obj := range cold {
+		if !seen[obj.Key] {
+			objects = append(objects, obj)
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
+
+// Tier moves the objects in Hot under prefix which haven't been read for After to Cold, or
+// changes their storage class to ColdClass, and returns how many it tiered
+func (ts *TieredStorage) Tier(ctx context.Context, prefix string) (int, error) {
+	classer, _ := ts.Hot.(StorageClasser)
+	if ts.Cold == nil && (classer == nil || ts.ColdClass == "") {
+		return 0, errors.New("tiered storage needs a cold storage or a storage class")
+	}
+
+	after := ts.After
+	if after <= 0 {
+		after = 30 * 24 * time.Hour
+	}
+	cutoff := time.Now().Add(-after)
+
+	objects, err := ts.Hot.List(ctx, prefix)
+	if err != nil {
+		return 0, err
+	}
+
+	tiered := 0
+	for _, obj := range objects {
+		if err = ctx.Err(); err != nil {
+			return tiered, err
+		}
+
+		last, ok, err := ts.tracker().LastAccess(ctx, obj.Key)
+		if err != nil {
+			return tiered, err
+		}
+		if !ok {
+			last = obj.ModTime
+		}
+		if last.After(cutoff) {
+			continue
+		}
+
+		if ts.Cold == nil {
+			class, err := classer.StorageClass(ctx, obj.Key)
+			if err != nil {
+				return tiered, err
+			}
+			if class == ts.ColdClass {
+				continue
+			}
+			if err = classer.SetStorageClass(ctx, obj.Key, ts.ColdClass); err != nil {
+				return tiered, err
+			}
+		} else if err = ts.demote(ctx, obj.Key); err != nil {
+			return tiered, err
+		}
+		tiered++
+	}
+	return tiered, nil
+}
+
+// demote moves an object from Hot to Cold
+func (ts *TieredStorage) demote(ctx context.Context, key string) error {
+	rc, err := ts.Hot.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	err = ts.Cold.Put(ctx, key, rc)
+	rc.Close()
+	if err != nil {
+		return err
+	}
+	return ts.Hot.Delete(ctx, key)
+}
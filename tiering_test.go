@@ -0,0 +1,128 @@
+package toolkit
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTieredStorage_Tier(t *testing.T) {
+	hot, cold := &FileStorage{Dir: t.TempDir()}, &FileStorage{Dir: t.TempDir()}
+	accesses := &MemoryAccessTracker{}
+	ts := &TieredStorage{Hot: hot, Cold: cold, After: time.Hour, Accesses: accesses}
+	ctx := context.Background()
+
+	for _, key := range []string{"files/old", "files/new", "other/old"} {
+		if err := ts.Put(ctx, key, strings.NewReader("contents of "+key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = accesses.Touch(ctx, "files/old", time.Now().Add(-2*time.Hour))
+	_ = accesses.Touch(ctx, "other/old", time.Now().Add(-2*time.Hour))
+
+	n, err := ts.Tier(ctx, "files/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 object tiered but got %d", n)
+	}
+	if _, err = hot.Stat(ctx, "files/old"); err != ErrNotFound {
+		t.Errorf("expected files/old to leave hot storage, got %v", err)
+	}
+	if _, err = cold.Stat(ctx, "files/old"); err != nil {
+		t.Errorf("expected files/old in cold storage, got %v", err)
+	}
+	if _, err = hot.Stat(ctx, "other/old"); err != nil {
+		t.Errorf("expected other/old to stay, outside the prefix, got %v", err)
+	}
+
+	// tiered objects are still listed and described
+	objects, err := ts.List(ctx, "files/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 2 || objects[0].Key != "files/new" || objects[1].Key != "files/old" {
+		t.Errorf("expected both files to be listed but got %+v", objects)
+	}
+	if info, err := ts.Stat(ctx, "files/old"); err != nil || info.Size != int64(len("contents of files/old")) {
+		t.Errorf("unexpected stat %+v, %v", info, err)
+	}
+
+	// reading restores the object
+	rc, err := ts.Get(ctx, "files/old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(b) != "contents of files/old" {
+		t.Errorf("unexpected contents %q", b)
+	}
+	if _, err = hot.Stat(ctx, "files/old"); err != nil {
+		t.Errorf("expected files/old to be restored, got %v", err)
+	}
+	if _, err = cold.Stat(ctx, "files/old"); err != ErrNotFound {
+		t.Errorf("expected files/old to leave cold storage, got %v", err)
+	}
+
+	// it was just read, so it isn't tiered again
+	if n, _ = ts.Tier(ctx, "files/"); n != 0 {
+		t.Errorf("expected nothing tiered but got %d", n)
+	}
+
+	if _, err = ts.Get(ctx, "files/missing"); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound but got %v", err)
+	}
+
+	_, _ = ts.Tier(ctx, "other/")
+	if err = ts.Delete(ctx, "other/old"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ts.Stat(ctx, "other/old"); err != ErrNotFound {
+		t.Errorf("expected other/old to be deleted from both tiers, got %v", err)
+	}
+}
+
+// classedStorage is a FileStorage with storage classes
+type classedStorage struct {
+	*FileStorage
+	classes map[string]string
+}
+
+func (cs *classedStorage) StorageClass(ctx context.Context, key string) (string, error) {
+	return cs.classes[key], nil
+}
+
+func (cs *classedStorage) SetStorageClass(ctx context.Context, key, class string) error {
+	cs.classes[key] = class
+	return nil
+}
+
+func TestTieredStorage_StorageClass(t *testing.T) {
+	hot := &FileStorage{Dir: t.TempDir()}
+	cs := &classedStorage{FileStorage: hot, classes: make(map[string]string)}
+	ts := &TieredStorage{Hot: cs, ColdClass: "GLACIER_IR", After: time.Hour}
+	ctx := context.Background()
+
+	if err := ts.Put(ctx, "a", strings.NewReader("a")); err != nil {
+		t.Fatal(err)
+	}
+	_ = ts.tracker().Touch(ctx, "a", time.Now().Add(-2*time.Hour))
+
+	if n, err := ts.Tier(ctx, ""); err != nil || n != 1 {
+		t.Fatalf("expected 1 object tiered but got %d, %v", n, err)
+	}
+	if cs.classes["a"] != "GLACIER_IR" {
+		t.Errorf("expected the storage class to change but got %q", cs.classes["a"])
+	}
+	if n, _ := ts.Tier(ctx, ""); n != 0 {
+		t.Errorf("expected an object already in the class to be skipped, got %d", n)
+	}
+
+	if _, err := (&TieredStorage{Hot: hot}).Tier(ctx, ""); err == nil {
+		t.Error("expected an error without a cold tier")
+	}
+}
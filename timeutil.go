@@ -0,0 +1,277 @@
+package toolkit
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidWindow is wrapped by the errors WindowParser returns for time windows it refuses
+var ErrInvalidWindow = errors.New("invalid time window")
+
+// TimeWindow is the span of time from From up to, but not including, To
+type TimeWindow struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// Duration is the length of the window
+func (w TimeWindow) Duration() time.Duration {
+	return w.To.Sub(w.From)
+}
+
+// Contains reports whether t is in the window
+func (w TimeWindow) Contains(t time.Time) bool {
+	return !t.Before(w.From) && t.Before(w.To)
+}
+
+// Days splits the window at midnight in loc, for reporting by day. Days are calendar days, so
+// those with a daylight saving change are 23 or 25 hours long; the first and last are cut to
+// the window.
+func (w TimeWindow) Days(loc *time.Location) []TimeWindow {
+	var days []TimeWindow
+	for from := w.From; from.Before(w.To); {
+		y, m, d := from.In(loc).Date()
+		to := time.Date(y, m, d+1, 0, 0, 0, 0, loc)
+		if to.After(w.To) {
+			to = w.To
+		}
+		days = append(days, TimeWindow{From: from, To: to})
+		from = to
+	}
+	return days
+}
+
+// WindowParser reads a time window from a request's query, such as ?from=2024-05-01&to=
+// 2024-05-07, for reporting endpoints. Each bound may be:
+//
+//   - an RFC 3339 time, such as 2024-05-01T09:00:00Z or 2024-05-01T09:00:00+02:00
+//   - a time without an offset, such as 2024-05-01T09:00:00, in the window's location
+//   - a date, such as 2024-05-01, meaning the start of the day as from, and the end of it as
+//     to, so that from=2024-05-01&to=2024-05-01 is the whole day
+//   - "now", or a time relative to now, such as -7d, -12h or -30m
+//
+// The window's location is the tz parameter, an IANA name such as Europe/Paris, or Location.
+type WindowParser struct {
+	// FromParam and ToParam name the query parameters. Default to from and to
+	FromParam string
+	ToParam   string
+	// TZParam names the time zone parameter. Defaults to tz
+	TZParam string
+	// Location is used when the request names no time zone. Defaults to UTC
+	Location *time.Location
+	// Default is the length of the window when a bound is missing: the window ends now, or
+	// runs for Default from or to the bound given. Defaults to 24 hours
+	Default time.Duration
+	// MaxSpan is the longest window allowed. Defaults to 366 days
+	MaxSpan time.Duration
+	// Clamp shortens windows longer than MaxSpan, keeping their end, instead of refusing them
+	Clamp bool
+	// Now defaults to time.Now
+	Now func() time.Time
+}
+
+// Parse reads the window from r's query. Windows which are empty, inverted or too long are
+// refused with an error wrapping ErrInvalidWindow, which ErrorJSON sends as a 400.
+func (p *WindowParser) Parse(r *http.Request) (TimeWindow, error) {
+	q := r.URL.Query()
+	fromParam, toParam, tzParam := p.FromParam, p.ToParam, p.TZParam
+	if fromParam == "" {
+		fromParam = "from"
+	}
+	if toParam == "" {
+		toParam = "to"
+	}
+	if tzParam == "" {
+		tzParam = "tz"
+	}
+
+	loc := p.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	if tz := q.Get(tzParam); tz != "" {
+		named, err := time.LoadLocation(tz)
+		if err != nil || tz == "Local" {
+			return TimeWindow{}, fmt.Errorf("%w: unknown time zone %q", ErrInvalidWindow, tz)
+		}
+		loc = named
+	}
+	return p.ParseBounds(q.Get(fromParam), q.Get(toParam), loc)
+}
+
+// ParseBounds reads a window from the values of its bounds, either of which may be empty, with
+// times without offsets in loc
+func (p *WindowParser) ParseBounds(fromValue, toValue string, loc *time.Location) (TimeWindow, error) {
+	now := time.Now()
+	if p.Now != nil {
+		now = p.Now()
+	}
+	length := p.Default
+	if length <= 0 {
+		length = 24 * time.Hour
+	}
+	maxSpan := p.MaxSpan
+	if maxSpan <= 0 {
+		maxSpan = 366 * 24 * time.Hour
+	}
+
+	var w TimeWindow
+	var err error
+	if fromValue != "" {
+		if w.From, err = parseWindowBound(fromValue, loc, now, false); err != nil {
+			return TimeWindow{}, err
+		}
+	}
+	if toValue != "" {
+		if w.To, err = parseWindowBound(toValue, loc, now, true); err != nil {
+			return TimeWindow{}, err
+		}
+	}
+	switch {
+	case fromValue == "" && toValue == "":
+		w = TimeWindow{From: now.Add(-length), To: now}
+	case toValue == "":
+		w.To = w.From.Add(length)
+	case fromValue == "":
+		w.From = w.To.Add(-length)
+	}
+
+	if !w.From.Before(w.To) {
+		return TimeWindow{}, fmt.Errorf("%w: from must be before to", ErrInvalidWindow)
+	}
+	if w.Duration() > maxSpan {
+		if !p.Clamp {
+			return TimeWindow{}, fmt.Errorf("%w: longer than %s", ErrInvalidWindow, HumanDuration(maxSpan))
+		}
+		w.From = w.To.Add(-maxSpan)
+	}
+	w.From, w.To = w.From.In(loc), w.To.In(loc)
+	return w, nil
+}
+
+func parseWindowBound(value string, loc *time.Location, now time.Time, end bool) (time.Time, error) {
+	if value == "now" {
+		return now, nil
+	}
+	if strings.HasPrefix(value, "-") || strings.HasPrefix(value, "+") {
+		if days := strings.TrimSuffix(value, "d"); days != value {
+			n, err := strconv.Atoi(days)
+			if err == nil {
+				// calendar days in loc, so the clock time is kept across daylight saving changes
+				return now.In(loc).AddDate(0, 0, n), nil
+			}
+		} else if d, err := time.ParseDuration(value); err == nil {
+			return now.Add(d), nil
+		}
+		return time.Time{}, fmt.Errorf("%w: bad relative time %q", ErrInvalidWindow, value)
+	}
+
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05.999999999", "2006-01-02T15:04"} {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, loc); err == nil {
+		if end {
+			// the end of a whole day is the following midnight
+			return t.AddDate(0, 0, 1), nil
+		}
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%w: bad time %q, expected RFC 3339 or a date", ErrInvalidWindow, value)
+}
+
+// Calendar counts business days: days which are neither weekend days nor holidays. Dates are
+// taken in the location of the times passed in, so a time's calendar day is the one its owner
+// sees. The zero value has Saturday and Sunday weekends and no holidays.
+type Calendar struct {
+	// Weekend defaults to Saturday and Sunday
+	Weekend []time.Weekday
+	// Holidays are dates which aren't business days; only their year, month and day are used
+	Holidays []time.Time
+	// IsHoliday reports other holidays, such as those recurring every year
+	IsHoliday func(date time.Time) bool
+}
+
+// IsBusinessDay reports whether t's date is a business day
+func (c *Calendar) IsBusinessDay(t time.Time) bool {
+	weekend := c.Weekend
+	if weekend == nil {
+		weekend = []time.Weekday{time.Saturday, time.Sunday}
+	}
+	for _, wd := range weekend {
+		if t.Weekday() == wd {
+			return false
+		}
+	}
+	y, m, d := t.Date()
+	for _, h := range c.Holidays {
+		if hy, hm, hd := h.Date(); hy == y && hm == m && hd == d {
+			return false
+		}
+	}
+	if c.IsHoliday != nil && c.IsHoliday(time.Date(y, m, d, 0, 0, 0, 0, t.Location())) {
+		return false
+	}
+	return true
+}
+
+// NextBusinessDay returns t if it's a business day, and otherwise the same time on the next one
+func (c *Calendar) NextBusinessDay(t time.Time) time.Time {
+	for i := 0; !c.IsBusinessDay(t); i++ {
+		if i > 366 {
+			// a calendar without business days
+			return t
+		}
+		t = t.AddDate(0, 0, 1)
+	}
+	return t
+}
+
+// AddBusinessDays moves t forward by n business days, or back for negative n, keeping its
+// clock time across daylight saving changes. Adding one business day to a Friday gives the following Monday.
+func (c *Calendar) AddBusinessDays(t time.Time, n int) time.Time {
+	step := 1
+	if n < 0 {
+		step, n = -1, -n
+	}
+	for skipped := 0; n > 0; {
+		t = t.AddDate(0, 0, step)
+		if c.IsBusinessDay(t) {
+			n--
+			skipped = 0
+		} else if skipped++; skipped > 366 {
+			break
+		}
+	}
+	return t
+}
+
+// BusinessDaysBetween counts the business days from from's date up to, but not including, to's
+// date, or negative if to is before from
+func (c *Calendar) BusinessDaysBetween(from, to time.Time) int {
+	sign := 1
+	if to.Before(from) {
+		from, to, sign = to, from, -1
+	}
+	y, m, d := from.Date()
+	day := time.Date(y, m, d, 12, 0, 0, 0, from.Location())
+	y, m, d = to.In(from.Location()).Date()
+	end := time.Date(y, m, d, 12, 0, 0, 0, from.Location())
+
+	n := 0
+	for day.Before(end) {
+		if c.IsBusinessDay(day) {
+			n++
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+	return sign * n
+}
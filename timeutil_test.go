@@ -0,0 +1,129 @@
+package toolkit
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWindowParser(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skip("no time zone database")
+	}
+	now := time.Date(2024, 5, 10, 15, 30, 0, 0, time.UTC)
+	p := &WindowParser{Now: func() time.Time { return now }}
+
+	var tests = []struct {
+		query    string
+		from, to time.Time
+		wantErr  bool
+	}{
+		{query: "", from: now.Add(-24 * time.Hour), to: now},
+		{query: "from=2024-05-01&to=2024-05-07", from: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), to: time.Date(2024, 5, 8, 0, 0, 0, 0, time.UTC)},
+		{query: "from=2024-05-01&to=2024-05-01&tz=Europe/Paris", from: time.Date(2024, 5, 1, 0, 0, 0, 0, paris), to: time.Date(2024, 5, 2, 0, 0, 0, 0, paris)},
+		{query: "from=2024-05-01T09:00:00%2B02:00&to=2024-05-01T10:00:00Z", from: time.Date(2024, 5, 1, 7, 0, 0, 0, time.UTC), to: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)},
+		{query: "from=2024-05-01T09:00&tz=Europe/Paris", from: time.Date(2024, 5, 1, 9, 0, 0, 0, paris), to: time.Date(2024, 5, 2, 9, 0, 0, 0, paris)},
+		{query: "from=-7d&to=now", from: now.AddDate(0, 0, -7), to: now},
+		{query: "from=-90m", from: now.Add(-90 * time.Minute), to: now.Add(-90 * time.Minute).Add(24 * time.Hour)},
+		{query: "to=2024-05-09", from: time.Date(2024, 5, 9, 0, 0, 0, 0, time.UTC), to: time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)},
+		{query: "from=2024-05-07&to=2024-05-01", wantErr: true},
+		{query: "from=2022-01-01&to=2024-05-01", wantErr: true},
+		{query: "from=yesterday", wantErr: true},
+		{query: "from=-7x", wantErr: true},
+		{query: "tz=Mars/Olympus", wantErr: true},
+	}
+
+	for _, e := range tests {
+		w, err := p.Parse(httptest.NewRequest("GET", "/report?"+e.query, nil))
+		if e.wantErr {
+			if !errors.Is(err, ErrInvalidWindow) {
+				t.Errorf("%q: expected ErrInvalidWindow, got %v", e.query, err)
+			}
+			continue
+		}
+		if err != nil || !w.From.Equal(e.from) || !w.To.Equal(e.to) {
+			t.Errorf("%q: expected %v to %v, got %v to %v and %v", e.query, e.from, e.to, w.From, w.To, err)
+		}
+	}
+
+	clamping := &WindowParser{MaxSpan: 7 * 24 * time.Hour, Clamp: true, Now: p.Now}
+	w, err := clamping.ParseBounds("2024-01-01", "2024-05-07", time.UTC)
+	if err != nil || !w.To.Equal(time.Date(2024, 5, 8, 0, 0, 0, 0, time.UTC)) || w.Duration() != 7*24*time.Hour {
+		t.Errorf("expected the window to be clamped to its last week, got %v to %v and %v", w.From, w.To, err)
+	}
+}
+
+func TestTimeWindow_Days(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skip("no time zone database")
+	}
+	// the clocks went forward on March 31st 2024 in Paris
+	w := TimeWindow{From: time.Date(2024, 3, 30, 12, 0, 0, 0, paris), To: time.Date(2024, 4, 1, 6, 0, 0, 0, paris)}
+	days := w.Days(paris)
+	if len(days) != 3 {
+		t.Fatalf("expected 3 days, got %d", len(days))
+	}
+	var lengths []time.Duration
+	for _, d := range days {
+		lengths = append(lengths, d.Duration())
+	}
+	if lengths[0] != 12*time.Hour || lengths[1] != 23*time.Hour || lengths[2] != 6*time.Hour {
+		t.Errorf("unexpected day lengths %v", lengths)
+	}
+	if !w.Contains(days[1].From) || w.Contains(w.To) {
+		t.Error("expected the window to contain its start and not its end")
+	}
+}
+
+func TestCalendar(t *testing.T) {
+	c := &Calendar{
+		Holidays: []time.Time{time.Date(2024, 12, 25, 0, 0, 0, 0, time.UTC)},
+		IsHoliday: func(date time.Time) bool {
+			return date.Month() == time.January && date.Day() == 1
+		},
+	}
+	day := func(m time.Month, d int) time.Time { return time.Date(2024, m, d, 9, 30, 0, 0, time.UTC) }
+
+	var tests = []struct {
+		name string
+		got  time.Time
+		want time.Time
+	}{
+		{name: "friday plus one", got: c.AddBusinessDays(day(5, 10), 1), want: day(5, 13)},
+		{name: "monday minus one", got: c.AddBusinessDays(day(5, 13), -1), want: day(5, 10)},
+		{name: "over christmas", got: c.AddBusinessDays(day(12, 24), 1), want: day(12, 26)},
+		{name: "saturday plus one", got: c.AddBusinessDays(day(5, 11), 1), want: day(5, 13)},
+		{name: "plus zero", got: c.AddBusinessDays(day(5, 11), 0), want: day(5, 11)},
+		{name: "plus ten", got: c.AddBusinessDays(day(5, 1), 10), want: day(5, 15)},
+		{name: "next from sunday", got: c.NextBusinessDay(day(5, 12)), want: day(5, 13)},
+		{name: "next from a business day", got: c.NextBusinessDay(day(5, 14)), want: day(5, 14)},
+	}
+	for _, e := range tests {
+		if !e.got.Equal(e.want) {
+			t.Errorf("%s: expected %v, got %v", e.name, e.want, e.got)
+		}
+	}
+
+	if n := c.BusinessDaysBetween(day(5, 1), day(5, 31)); n != 22 {
+		t.Errorf("expected 22 business days in May before the 31st, got %d", n)
+	}
+	if n := c.BusinessDaysBetween(day(5, 13), day(5, 6)); n != -5 {
+		t.Errorf("expected -5, got %d", n)
+	}
+	if c.IsBusinessDay(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Error("expected the recurring holiday to be a holiday")
+	}
+
+	// the clock time survives a daylight saving change
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no time zone database")
+	}
+	before := time.Date(2024, 3, 8, 9, 0, 0, 0, ny)
+	if got := c.AddBusinessDays(before, 1); got.Hour() != 9 || got.Day() != 11 {
+		t.Errorf("expected 9am on the 11th, got %v", got)
+	}
+}
@@ -2,10 +2,14 @@ package toolkit
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"log"
 	"net/http"
@@ -20,7 +24,26 @@ const randomStringSource = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ
 // Tools is the type for the package. Create a variable of this type, and you'll have access
 // to all the methods with the receiver type *Tools.
 type Tools struct {
-	MaxFileSize int
+	MaxFileSize        int
+	RecentErrors       *ErrorRing
+	NeutralizeFormulas bool
+	Moderation         *Moderation
+	ResponseMode       ResponseMode
+	// Checksums makes UploadFile compute a checksum of each file, hashed alongside the write
+	// to disk in a separate goroutine
+	Checksums bool
+	// NewHash returns the hash used for checksums. Defaults to SHA-256; any hash.Hash can be
+	// used, such as NewBLAKE3
+	NewHash func() hash.Hash
+	// TextExtraction, if set, extracts the text of each uploaded file for indexing
+	TextExtraction *TextExtraction
+	// ImageHashes, if set, indexes the perceptual hash of each uploaded image, and lists the
+	// near duplicates already in it in the record
+	ImageHashes *ImageHashIndex
+	// LogSampler, if set, samples the errors LogError and LogRequestError log
+	LogSampler *LogSampler
+	// Bandwidth, if set, limits the rate UploadFile reads each client's uploads at
+	Bandwidth *BandwidthLimiter
 }
 
 // JSONResponse is the type used for sending JSON
@@ -28,6 +51,7 @@ type JSONResponse struct {
 	Error   bool   `json:"error"`
 	Message string `json:"message"`
 	Data    any    `json:"data,omitempty"`
+	Warning string `json:"warning,omitempty"`
 }
 
 // ReadJSON attempts to read the body of a request and converts it into JSON
@@ -42,20 +66,36 @@ func (t *Tools) ReadJSON(w http.ResponseWriter, r *http.Request, data any) error
 	dec := json.NewDecoder(r.Body)
 	err := dec.Decode(data)
 	if err != nil {
-		return err
+		return asBodyTooLarge(err, int64(maxBytes))
 	}
 
 	err = dec.Decode(&struct{}{})
 	if err != io.EOF {
+		if err = asBodyTooLarge(err, int64(maxBytes)); errors.As(err, new(*BodyTooLargeError)) {
+			return err
+		}
 		return errors.New("body may have only one json value")
 	}
 
-	return nil
+	if t.Moderation != nil && t.Moderation.Moderator != nil {
+		if err = t.Moderation.checkFields(r, data); err != nil {
+			return err
+		}
+	}
+
+	return transformRequest(r, data)
 }
 
-// WriteJSON takes a response status code and arbitrary data and writes a json response to the client
+// WriteJSON takes a response status code and arbitrary data and writes a json response to the client.
+// In ResponseEnvelope mode the data is wrapped in a JSONResponse; wrap it with Bare or Enveloped
+// to override the mode for a single call.
 func (t *Tools) WriteJSON(w http.ResponseWriter, status int, data any, headers ...http.Header) error {
-	out, err := json.Marshal(data)
+	payload, err := t.responsePayload(w, status, data)
+	if err != nil {
+		return err
+	}
+
+	out, err := json.Marshal(payload)
 	if err != nil {
 		return err
 	}
@@ -76,11 +116,45 @@ func (t *Tools) WriteJSON(w http.ResponseWriter, status int, data any, headers .
 	return nil
 }
 
+// responsePayload applies the response transformations, envelope mode, audience masking and
+// deprecation warning to data
+func (t *Tools) responsePayload(w http.ResponseWriter, status int, data any) (any, error) {
+	data, err := transformResponse(w, status, data)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := t.applyResponseMode(status, data)
+	if audience, ok := responseAudience(w); ok {
+		payload = MaskFields(payload, audience)
+	}
+	switch env := payload.(type) {
+	case JSONResponse:
+		if env.Warning == "" {
+			env.Warning = responseWarning(w)
+			payload = env
+		}
+	case *JSONResponse:
+		// copied, so the caller's value isn't changed
+		if env != nil && env.Warning == "" {
+			copied := *env
+			copied.Warning = responseWarning(w)
+			payload = &copied
+		}
+	}
+	return payload, nil
+}
+
 // ErrorJSON takes an error, and optionally a response status code, generates and sends
-// a json error response
+// a json error response. A BodyTooLargeError defaults to 413, with the limit in the data.
 func (t *Tools) ErrorJSON(w http.ResponseWriter, err error, status ...int) error {
 	statusCode := http.StatusBadRequest
 
+	var tooLarge *BodyTooLargeError
+	if errors.As(err, &tooLarge) {
+		statusCode = http.StatusRequestEntityTooLarge
+	}
+
 	if len(status) > 0 {
 		statusCode = status[0]
 	}
@@ -88,6 +162,16 @@ func (t *Tools) ErrorJSON(w http.ResponseWriter, err error, status ...int) error
 	var payload JSONResponse
 	payload.Error = true
 	payload.Message = err.Error()
+	var multi *MultiError
+	var items ItemErrors
+	switch {
+	case errors.As(err, &multi):
+		payload.Data = multi.Details()
+	case errors.As(err, &items):
+		payload.Data = items.Details()
+	case tooLarge != nil:
+		payload.Data = tooLarge
+	}
 
 	return t.WriteJSON(w, statusCode, payload)
 }
@@ -103,9 +187,27 @@ func (t *Tools) RandomString(n int) string {
 	return string(s)
 }
 
+// UUID returns a random (version 4) UUID
+func (t *Tools) UUID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
 // PushJSONToRemote posts arbitrary json to an url, and returns an error,
 // if any, as well as the response status code
 func (t *Tools) PushJSONToRemote(client *http.Client, url string, data any) (int, error) {
+	return t.PushJSONToRemoteContext(context.Background(), client, url, data)
+}
+
+// PushJSONToRemoteContext is PushJSONToRemote with a context, whose deadline is applied as in
+// CallJSONContext
+func (t *Tools) PushJSONToRemoteContext(ctx context.Context, client *http.Client, url string, data any) (int, error) {
+	ctx, cancel := OutboundContext(ctx)
+	defer cancel()
+
 	// create json we'll send
 	jsonData, err := json.MarshalIndent(data, "", "\t")
 	if err != nil {
@@ -113,11 +215,12 @@ func (t *Tools) PushJSONToRemote(client *http.Client, url string, data any) (int
 	}
 
 	// build the request and set header
-	request, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	request, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return 0, err
 	}
 	request.Header.Set("Content-Type", "application/json")
+	setTimeoutHeader(request)
 
 	// call the uri
 	response, err := client.Do(request)
@@ -143,11 +246,21 @@ type UploadedFile struct {
 	NewFileName      string
 	OriginalFileName string
 	FileSize         int64
+	// Checksum is the hex SHA-256 of the file, or of Tools.NewHash for UploadFile
+	Checksum string
+	Flagged  bool
+	// NearDuplicates are the IDs of similar images already in an ImageHashIndex
+	NearDuplicates []string
 }
 
 // UploadFile uploads a file to a specified directory, and gives it a random name.
 // It returns the newly named file, the original file name, and a possible error.
 func (t *Tools) UploadFile(r *http.Request, uploadDir string) (*UploadedFile, error) {
+	// the multipart copy reads the body within the client's bandwidth limit
+	if t.Bandwidth != nil {
+		t.Bandwidth.LimitBody(r)
+	}
+
 	// parse the form so we have access to the file
 	err := r.ParseMultipartForm(1024 * 1024 * 1024)
 	if err != nil {
@@ -175,6 +288,28 @@ func (t *Tools) UploadFile(r *http.Request, uploadDir string) (*UploadedFile, er
 				return nil, err
 			}
 
+			if t.Moderation != nil && t.Moderation.Moderator != nil {
+				uploadedFile.Flagged, err = t.Moderation.checkUpload(r, hdr.Filename, ext.String(), infile)
+				if err != nil {
+					return nil, err
+				}
+
+				_, err = infile.Seek(0, 0)
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			// SVGs are sanitized, so they can't run scripts when served back
+			var src io.Reader = infile
+			if ext.Is(SVGContentType) {
+				var clean bytes.Buffer
+				if err = SanitizeSVG(&clean, infile); err != nil {
+					return nil, err
+				}
+				src = &clean
+			}
+
 			uploadedFile.NewFileName = t.RandomString(25) + ext.Extension()
 			uploadedFile.OriginalFileName = hdr.Filename
 
@@ -184,11 +319,40 @@ func (t *Tools) UploadFile(r *http.Request, uploadDir string) (*UploadedFile, er
 			if outfile, err = os.Create(uploadDir + uploadedFile.NewFileName); nil != err {
 				return nil, err
 			} else {
-				fileSize, err := io.Copy(outfile, infile)
+				var dst io.Writer = outfile
+				var checksum *pipelinedHash
+				if t.Checksums {
+					newHash := t.NewHash
+					if newHash == nil {
+						newHash = sha256.New
+					}
+					checksum = newPipelinedHash(newHash())
+					defer checksum.Close()
+					dst = io.MultiWriter(outfile, checksum)
+				}
+
+				fileSize, err := io.Copy(dst, src)
 				if err != nil {
 					return nil, err
 				}
 				uploadedFile.FileSize = fileSize
+				if checksum != nil {
+					uploadedFile.Checksum = hex.EncodeToString(checksum.Sum())
+				}
+			}
+
+			if t.TextExtraction != nil {
+				if _, err = outfile.Seek(0, io.SeekStart); err != nil {
+					return nil, err
+				}
+				t.TextExtraction.run(r.Context(), &uploadedFile, ext, outfile)
+			}
+
+			if t.ImageHashes != nil {
+				if _, err = outfile.Seek(0, io.SeekStart); err != nil {
+					return nil, err
+				}
+				uploadedFile.NearDuplicates = t.ImageHashes.check(uploadedFile.NewFileName, ext.String(), outfile)
 			}
 		}
 
@@ -208,9 +372,28 @@ func (t *Tools) CreateDir(path string) error {
 	return nil
 }
 
-//LogError checks if an error occurred and logs it
+// LogError checks if an error occurred and logs it. If RecentErrors is set, the error is also recorded there.
+// If LogSampler is set, floods of the same error are sampled.
 func (t *Tools) LogError(err error) {
 	if err != nil {
+		t.logError("", err)
+	}
+}
+
+func (t *Tools) logError(key string, err error) {
+	if t.RecentErrors != nil {
+		t.RecentErrors.Add(err)
+	}
+	if t.LogSampler == nil {
 		log.Printf("error: %v\n", err)
+		return
+	}
+	if !t.LogSampler.Allow(key, err.Error()) {
+		return
+	}
+	if n := t.LogSampler.TakeSuppressed(); n > 0 {
+		log.Printf("error: %v (%d log messages suppressed)\n", err, n)
+		return
 	}
+	log.Printf("error: %v\n", err)
 }
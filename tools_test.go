@@ -14,6 +14,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"regexp"
 	"strings"
 	"testing"
 )
@@ -162,6 +163,18 @@ func TestTools_RandomString(t *testing.T) {
 	}
 }
 
+func TestTools_UUID(t *testing.T) {
+	var testApp Tools
+
+	u := testApp.UUID()
+	if !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(u) {
+		t.Errorf("invalid uuid %s", u)
+	}
+	if u == testApp.UUID() {
+		t.Error("expected a new uuid each time")
+	}
+}
+
 func TestTools_DownloadFile(t *testing.T) {
 	rr := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", "/", nil)
@@ -0,0 +1,166 @@
+package toolkit
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// RequestTransform mutates a request struct after ReadJSON has decoded it
+type RequestTransform func(r *http.Request, data any) error
+
+// ResponseTransform returns the payload WriteJSON should send in place of data
+type ResponseTransform func(r *http.Request, status int, data any) (any, error)
+
+// Transforms holds request and response transformations registered under keys, such as a
+// route name or an API version. Routes wrapped with Use have the transformations for their
+// keys applied by ReadJSON and WriteJSON, so one handler can serve several shapes of payload.
+type Transforms struct {
+	mu        sync.RWMutex
+	requests  map[string][]RequestTransform
+	responses map[string][]ResponseTransform
+}
+
+// Request registers a transformation for decoded request structs under key
+func (tf *Transforms) Request(key string, fn RequestTransform) {
+	tf.mu.Lock()
+	defer tf.mu.Unlock()
+
+	if tf.requests == nil {
+		tf.requests = make(map[string][]RequestTransform)
+	}
+	tf.requests[key] = append(tf.requests[key], fn)
+}
+
+// Response registers a transformation for outgoing payloads under key
+func (tf *Transforms) Response(key string, fn ResponseTransform) {
+	tf.mu.Lock()
+	defer tf.mu.Unlock()
+
+	if tf.responses == nil {
+		tf.responses = make(map[string][]ResponseTransform)
+	}
+	tf.responses[key] = append(tf.responses[key], fn)
+}
+
+type transformContextKey struct{}
+
+type activeTransforms struct {
+	tf   *Transforms
+	keys []string
+}
+
+// Use returns middleware which applies the transformations registered under keys to the
+// requests it handles. Keys are applied in order, after the keys of any enclosing Use.
+func (tf *Transforms) Use(keys ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			active := &activeTransforms{tf: tf, keys: keys}
+			if outer, ok := r.Context().Value(transformContextKey{}).(*activeTransforms); ok && outer.tf == tf {
+				active.keys = append(append([]string{}, outer.keys...), keys...)
+			}
+
+			r = r.WithContext(context.WithValue(r.Context(), transformContextKey{}, active))
+			next.ServeHTTP(&transformWriter{ResponseWriter: w, r: r}, r)
+		})
+	}
+}
+
+// TransformKeys returns the transformation keys active for a request
+func TransformKeys(r *http.Request) []string {
+	if active, ok := r.Context().Value(transformContextKey{}).(*activeTransforms); ok {
+		return active.keys
+	}
+	return nil
+}
+
+// transformRequest applies the request transformations active for r to data
+func transformRequest(r *http.Request, data any) error {
+	active, ok := r.Context().Value(transformContextKey{}).(*activeTransforms)
+	if !ok {
+		return nil
+	}
+
+	active.tf.mu.RLock()
+	var fns []RequestTransform
+	for _, key := range active.keys {
+		fns = append(fns, active.tf.requests[key]...)
+	}
+	active.tf.mu.RUnlock()
+
+	for _, fn := range fns {
+		if err := fn(r, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// transformWriter carries the request to WriteJSON, which has no other way to see it
+type transformWriter struct {
+	http.ResponseWriter
+	r *http.Request
+}
+
+// Flush implements http.Flusher when the underlying writer does
+func (tw *transformWriter) Flush() {
+	if f, ok := tw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer
+func (tw *transformWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
+
+// transformResponse applies the response transformations active for the request being
+// written to w. Data marked with Bare or Enveloped is transformed inside its marker.
+func transformResponse(w http.ResponseWriter, status int, data any) (any, error) {
+	var tw *transformWriter
+	for tw == nil {
+		switch v := w.(type) {
+		case *transformWriter:
+			tw = v
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = v.Unwrap()
+		default:
+			return data, nil
+		}
+	}
+
+	active, ok := tw.r.Context().Value(transformContextKey{}).(*activeTransforms)
+	if !ok {
+		return data, nil
+	}
+
+	active.tf.mu.RLock()
+	var fns []ResponseTransform
+	for _, key := range active.keys {
+		fns = append(fns, active.tf.responses[key]...)
+	}
+	active.tf.mu.RUnlock()
+
+	inner := data
+	switch d := data.(type) {
+	case bareData:
+		inner = d.data
+	case envelopedData:
+		inner = d.data
+	}
+
+	var err error
+	for _, fn := range fns {
+		if inner, err = fn(tw.r, status, inner); err != nil {
+			return nil, err
+		}
+	}
+
+	switch d := data.(type) {
+	case bareData:
+		return bareData{data: inner}, nil
+	case envelopedData:
+		return envelopedData{data: inner, message: d.message}, nil
+	}
+	return inner, nil
+}
@@ -0,0 +1,98 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type transformUser struct {
+	Name     string `json:"name"`
+	FullName string `json:"full_name"`
+}
+
+func TestTransforms_Use(t *testing.T) {
+	var tf Transforms
+
+	// v1 clients send and expect "name"; the handler only knows full_name
+	tf.Request("v1", func(r *http.Request, data any) error {
+		u := data.(*transformUser)
+		u.FullName, u.Name = u.Name, ""
+		return nil
+	})
+	tf.Response("v1", func(r *http.Request, status int, data any) (any, error) {
+		u := data.(transformUser)
+		return map[string]string{"name": u.FullName}, nil
+	})
+	tf.Request("strict", func(r *http.Request, data any) error {
+		if data.(*transformUser).FullName == "" {
+			return errors.New("full_name is required")
+		}
+		return nil
+	})
+
+	var testTools Tools
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		var u transformUser
+		if err := testTools.ReadJSON(w, r, &u); err != nil {
+			_ = testTools.ErrorJSON(w, err)
+			return
+		}
+		_ = testTools.WriteJSON(w, http.StatusOK, u)
+	}
+
+	var tests = []struct {
+		name     string
+		keys     []string
+		body     string
+		expected string
+	}{
+		{"no transforms", nil, `{"full_name":"Ada"}`, `{"name":"","full_name":"Ada"}`},
+		{"v1", []string{"v1"}, `{"name":"Ada"}`, `{"name":"Ada"}`},
+		{"v1 then strict", []string{"v1", "strict"}, `{"name":"Ada"}`, `{"name":"Ada"}`},
+		{"strict fails", []string{"strict"}, `{"name":"Ada"}`, `"full_name is required"`},
+	}
+
+	for _, e := range tests {
+		h := http.Handler(http.HandlerFunc(handler))
+		if e.keys != nil {
+			h = tf.Use(e.keys...)(h)
+		}
+
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest("POST", "/users", strings.NewReader(e.body)))
+		if !strings.Contains(rr.Body.String(), e.expected) {
+			t.Errorf("%s: expected %s in %s", e.name, e.expected, rr.Body.String())
+		}
+	}
+}
+
+func TestTransforms_Nested(t *testing.T) {
+	var tf Transforms
+	tf.Response("outer", func(r *http.Request, status int, data any) (any, error) {
+		return data.(string) + "+outer", nil
+	})
+	tf.Response("inner", func(r *http.Request, status int, data any) (any, error) {
+		return data.(string) + "+inner", nil
+	})
+
+	var testTools Tools
+	h := tf.Use("outer")(tf.Use("inner")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if keys := TransformKeys(r); len(keys) != 2 {
+			t.Errorf("expected two keys, got %v", keys)
+		}
+		_ = testTools.WriteJSON(w, http.StatusOK, Enveloped("data"))
+	})))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+
+	var resp JSONResponse
+	_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+	if resp.Data != "data+outer+inner" {
+		t.Errorf("unexpected data %v", resp.Data)
+	}
+}
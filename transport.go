@@ -0,0 +1,216 @@
+package toolkit
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sort"
+	"sync"
+	"time"
+)
+
+// TransportConfig builds http.Transports for outbound calls, such as webhook delivery, from
+// the settings worth tuning. The zero value builds a transport like http.DefaultTransport.
+type TransportConfig struct {
+	// MaxIdleConns caps the idle connections kept across all hosts. Defaults to 100
+	MaxIdleConns int
+	// MaxIdleConnsPerHost caps the idle connections kept for each host. Defaults to 2, which
+	// is too few for frequent calls to a host
+	MaxIdleConnsPerHost int
+	// MaxConnsPerHost caps the connections to each host, idle or not. Zero is unlimited
+	MaxConnsPerHost int
+	// IdleConnTimeout is how long idle connections are kept. Defaults to 90 seconds
+	IdleConnTimeout time.Duration
+	// TLSHandshakeTimeout defaults to 10 seconds
+	TLSHandshakeTimeout time.Duration
+	// ResponseHeaderTimeout, if set, limits the wait for a response's headers
+	ResponseHeaderTimeout time.Duration
+	// TLSSessionCacheSize is the number of TLS sessions kept for resumption, which saves a
+	// round trip on new connections to known hosts. Defaults to 64; negative disables it
+	TLSSessionCacheSize int
+	// TLSConfig, if set, is cloned as the base TLS configuration
+	TLSConfig *tls.Config
+	// DisableHTTP2 keeps connections on HTTP/1.1
+	DisableHTTP2 bool
+	// DNSCache, if set, resolves and dials the connections
+	DNSCache *DNSCache
+	// Metrics, if set, records the transport's connection use
+	Metrics *PoolMetrics
+}
+
+// Transport builds a transport from the configuration
+func (c TransportConfig) Transport() http.RoundTripper {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if c.MaxIdleConns > 0 {
+		transport.MaxIdleConns = c.MaxIdleConns
+	}
+	if c.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = c.MaxIdleConnsPerHost
+	}
+	transport.MaxConnsPerHost = c.MaxConnsPerHost
+	if c.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = c.IdleConnTimeout
+	}
+	if c.TLSHandshakeTimeout > 0 {
+		transport.TLSHandshakeTimeout = c.TLSHandshakeTimeout
+	}
+	transport.ResponseHeaderTimeout = c.ResponseHeaderTimeout
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if c.TLSConfig != nil {
+		tlsConfig = c.TLSConfig.Clone()
+	}
+	switch {
+	case c.TLSSessionCacheSize < 0:
+		tlsConfig.ClientSessionCache = nil
+	case tlsConfig.ClientSessionCache == nil:
+		size := c.TLSSessionCacheSize
+		if size == 0 {
+			size = 64
+		}
+		tlsConfig.ClientSessionCache = tls.NewLRUClientSessionCache(size)
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	if c.DisableHTTP2 {
+		transport.ForceAttemptHTTP2 = false
+		// a non-nil, empty map stops the transport upgrading to HTTP/2
+		transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+	if c.DNSCache != nil {
+		transport.DialContext = c.DNSCache.DialContext
+	}
+
+	if c.Metrics == nil {
+		return transport
+	}
+	return &meteredTransport{base: transport, metrics: c.Metrics}
+}
+
+// Client builds a client with the configured transport and the given timeout
+func (c TransportConfig) Client(timeout time.Duration) *http.Client {
+	return &http.Client{Transport: c.Transport(), Timeout: timeout}
+}
+
+// PoolStats is the connection use of a host
+type PoolStats struct {
+	Host string `json:"host"`
+	// Requests is the number of requests which got a connection
+	Requests int64 `json:"requests"`
+	// Reused is the number of requests which reused an open connection
+	Reused int64 `json:"reused"`
+	// Dials counts the new connections made, and DialErrors the attempts which failed
+	Dials      int64 `json:"dials"`
+	DialErrors int64 `json:"dial_errors"`
+	// DialTime is the total time spent connecting, including TLS handshakes
+	DialTime time.Duration `json:"dial_time"`
+}
+
+// ReuseRatio returns the share of requests which reused a connection
+func (s PoolStats) ReuseRatio() float64 {
+	if s.Requests == 0 {
+		return 0
+	}
+	return float64(s.Reused) / float64(s.Requests)
+}
+
+// MeanDialTime returns the average time taken to connect
+func (s PoolStats) MeanDialTime() time.Duration {
+	if s.Dials == 0 {
+		return 0
+	}
+	return s.DialTime / time.Duration(s.Dials)
+}
+
+// PoolMetrics records the connection use of transports built by TransportConfig, per host
+type PoolMetrics struct {
+	mu    sync.Mutex
+	hosts map[string]*PoolStats
+}
+
+func (m *PoolMetrics) record(host string, fn func(s *PoolStats)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.hosts == nil {
+		m.hosts = make(map[string]*PoolStats)
+	}
+	s, ok := m.hosts[host]
+	if !ok {
+		s = &PoolStats{Host: host}
+		m.hosts[host] = s
+	}
+	fn(s)
+}
+
+// Snapshot returns the stats of each host, sorted by host
+func (m *PoolMetrics) Snapshot() []PoolStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stats := make([]PoolStats, 0, len(m.hosts))
+	for _, s := range m.hosts {
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Host < stats[j].Host })
+	return stats
+}
+
+// Total returns the stats of all hosts together
+func (m *PoolMetrics) Total() PoolStats {
+	var total PoolStats
+	for _, s := range m.Snapshot() {
+		total.Requests += s.Requests
+		total.Reused += s.Reused
+		total.Dials += s.Dials
+		total.DialErrors += s.DialErrors
+		total.DialTime += s.DialTime
+	}
+	return total
+}
+
+type meteredTransport struct {
+	base    http.RoundTripper
+	metrics *PoolMetrics
+}
+
+func (mt *meteredTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	var (
+		mu        sync.Mutex
+		dialStart time.Time
+	)
+	trace := &httptrace.ClientTrace{
+		GetConn: func(string) {
+			mu.Lock()
+			dialStart = time.Time{}
+			mu.Unlock()
+		},
+		ConnectStart: func(string, string) {
+			mu.Lock()
+			// with happy eyeballs, a dial may start more than one connection
+			if dialStart.IsZero() {
+				dialStart = time.Now()
+			}
+			mu.Unlock()
+		},
+		ConnectDone: func(network, addr string, err error) {
+			if err != nil {
+				mt.metrics.record(host, func(s *PoolStats) { s.DialErrors++ })
+			}
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			mu.Lock()
+			started := dialStart
+			mu.Unlock()
+			mt.metrics.record(host, func(s *PoolStats) {
+				s.Requests++
+				if info.Reused {
+					s.Reused++
+				} else if !started.IsZero() {
+					s.Dials++
+					s.DialTime += time.Since(started)
+				}
+			})
+		},
+	}
+	return mt.base.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+}
@@ -0,0 +1,80 @@
+package toolkit
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTransportConfig_Transport(t *testing.T) {
+	var tests = []struct {
+		name   string
+		config TransportConfig
+		check  func(tr *http.Transport) bool
+	}{
+		{name: "defaults", check: func(tr *http.Transport) bool {
+			return tr.MaxIdleConns == 100 && tr.MaxIdleConnsPerHost == 0 && tr.ForceAttemptHTTP2 && tr.TLSClientConfig.ClientSessionCache != nil
+		}},
+		{name: "pool", config: TransportConfig{MaxIdleConns: 500, MaxIdleConnsPerHost: 50, MaxConnsPerHost: 80, IdleConnTimeout: time.Minute}, check: func(tr *http.Transport) bool {
+			return tr.MaxIdleConns == 500 && tr.MaxIdleConnsPerHost == 50 && tr.MaxConnsPerHost == 80 && tr.IdleConnTimeout == time.Minute
+		}},
+		{name: "no session cache", config: TransportConfig{TLSSessionCacheSize: -1}, check: func(tr *http.Transport) bool {
+			return tr.TLSClientConfig.ClientSessionCache == nil
+		}},
+		{name: "no http2", config: TransportConfig{DisableHTTP2: true}, check: func(tr *http.Transport) bool {
+			return !tr.ForceAttemptHTTP2 && tr.TLSNextProto != nil && len(tr.TLSNextProto) == 0
+		}},
+		{name: "dns cache", config: TransportConfig{DNSCache: &DNSCache{}}, check: func(tr *http.Transport) bool {
+			return tr.DialContext != nil
+		}},
+	}
+
+	for _, e := range tests {
+		tr, ok := e.config.Transport().(*http.Transport)
+		if !ok {
+			t.Errorf("%s: expected an *http.Transport", e.name)
+			continue
+		}
+		if !e.check(tr) {
+			t.Errorf("%s: unexpected transport settings", e.name)
+		}
+	}
+}
+
+func TestPoolMetrics(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "OK")
+	}))
+	defer srv.Close()
+
+	metrics := &PoolMetrics{}
+	client := TransportConfig{Metrics: metrics, DNSCache: &DNSCache{}}.Client(5 * time.Second)
+	for i := 0; i < 4; i++ {
+		res, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+	}
+
+	stats := metrics.Snapshot()
+	if len(stats) != 1 || stats[0].Host != srv.Listener.Addr().String() {
+		t.Fatalf("expected stats for the server, got %+v", stats)
+	}
+	s := stats[0]
+	if s.Requests != 4 || s.Dials != 1 || s.Reused != 3 {
+		t.Errorf("expected 4 requests over one connection, got %+v", s)
+	}
+	if r := s.ReuseRatio(); r != 0.75 {
+		t.Errorf("expected a reuse ratio of 0.75, got %v", r)
+	}
+	if s.MeanDialTime() <= 0 {
+		t.Error("expected the dial time to be recorded")
+	}
+	if total := metrics.Total(); total.Requests != 4 {
+		t.Errorf("expected 4 requests in total, got %d", total.Requests)
+	}
+}
@@ -0,0 +1,172 @@
+package toolkit
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Device classes
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+	DeviceUnknown = "unknown"
+)
+
+// UserAgent is the result of parsing a User-Agent header and client hints
+type UserAgent struct {
+	Browser        string `json:"browser,omitempty"`
+	BrowserVersion string `json:"browser_version,omitempty"`
+	OS             string `json:"os,omitempty"`
+	Device         string `json:"device"`
+}
+
+// IsMobile reports whether the client is a phone or tablet
+func (ua UserAgent) IsMobile() bool {
+	return ua.Device == DeviceMobile || ua.Device == DeviceTablet
+}
+
+// IsBot reports whether the client identified itself as a crawler or script
+func (ua UserAgent) IsBot() bool {
+	return ua.Device == DeviceBot
+}
+
+var uaBrowsers = []struct {
+	name  string
+	match *regexp.Regexp
+}{
+	{"Edge", regexp.MustCompile(`Edg(?:e|A|iOS)?/([\d.]+)`)},
+	{"Opera", regexp.MustCompile(`(?:OPR|Opera)/([\d.]+)`)},
+	{"Samsung Internet", regexp.MustCompile(`SamsungBrowser/([\d.]+)`)},
+	{"Chrome", regexp.MustCompile(`(?:Chrome|CriOS)/([\d.]+)`)},
+	{"Firefox", regexp.MustCompile(`(?:Firefox|FxiOS)/([\d.]+)`)},
+	{"Safari", regexp.MustCompile(`Version/([\d.]+).*Safari/`)},
+	{"Internet Explorer", regexp.MustCompile(`(?:MSIE |Trident/.*rv:)([\d.]+)`)},
+}
+
+var uaOS = []struct {
+	name  string
+	match string
+}{
+	{"Windows", "Windows"},
+	{"iOS", "iPhone"},
+	{"iOS", "iPad"},
+	{"iOS", "iPod"},
+	{"Android", "Android"},
+	{"ChromeOS", "CrOS"},
+	{"macOS", "Mac OS X"},
+	{"Linux", "Linux"},
+}
+
+var uaBotPattern = regexp.MustCompile(`(?i)bot|crawl|spider|slurp|curl/|wget/|python-requests|go-http-client|httpclient|headless`)
+
+// ParseUserAgent parses a User-Agent string
+func ParseUserAgent(s string) UserAgent {
+	ua := UserAgent{Device: DeviceUnknown}
+	if s == "" {
+		return ua
+	}
+
+	if uaBotPattern.MatchString(s) {
+		ua.Device = DeviceBot
+	}
+
+	for _, b := range uaBrowsers {
+		if m := b.match.FindStringSubmatch(s); m != nil {
+			ua.Browser, ua.BrowserVersion = b.name, m[1]
+			break
+		}
+	}
+
+	for _, o := range uaOS {
+		if strings.Contains(s, o.match) {
+			ua.OS = o.name
+			break
+		}
+	}
+
+	if ua.Device == DeviceBot {
+		return ua
+	}
+
+	switch {
+	case strings.Contains(s, "iPad") || strings.Contains(s, "Tablet") ||
+		(strings.Contains(s, "Android") && !strings.Contains(s, "Mobile")):
+		ua.Device = DeviceTablet
+	case strings.Contains(s, "Mobi") || strings.Contains(s, "iPhone") || strings.Contains(s, "iPod"):
+		ua.Device = DeviceMobile
+	case ua.OS != "" || ua.Browser != "":
+		ua.Device = DeviceDesktop
+	}
+
+	return ua
+}
+
+var chBrandPattern = regexp.MustCompile(`"([^"]+)"\s*;\s*v="([^"]*)"`)
+
+// ParseRequestUserAgent parses the User-Agent header of r, preferring the low entropy client
+// hints (Sec-CH-UA, Sec-CH-UA-Mobile and Sec-CH-UA-Platform) when the browser sends them
+func ParseRequestUserAgent(r *http.Request) UserAgent {
+	ua := ParseUserAgent(r.UserAgent())
+
+	if platform := strings.Trim(r.Header.Get("Sec-CH-UA-Platform"), `"`); platform != "" && platform != "Unknown" {
+		ua.OS = strings.Replace(platform, "Chrome OS", "ChromeOS", 1)
+	}
+
+	if brands := r.Header.Get("Sec-CH-UA"); brands != "" {
+		var fallback []string
+		for _, m := range chBrandPattern.FindAllStringSubmatch(brands, -1) {
+			brand := m[1]
+			// GREASE brands, such as "Not=A?Brand", are meant to be ignored
+			if strings.Contains(brand, "Not") && strings.Contains(brand, "Brand") {
+				continue
+			}
+			if brand == "Chromium" {
+				fallback = []string{"Chromium", m[2]}
+				continue
+			}
+			ua.Browser, ua.BrowserVersion = strings.TrimPrefix(strings.TrimPrefix(brand, "Google "), "Microsoft "), m[2]
+			fallback = nil
+			break
+		}
+		if fallback != nil {
+			ua.Browser, ua.BrowserVersion = fallback[0], fallback[1]
+		}
+	}
+
+	switch r.Header.Get("Sec-CH-UA-Mobile") {
+	case "?1":
+		if ua.Device != DeviceTablet {
+			ua.Device = DeviceMobile
+		}
+	case "?0":
+		if ua.Device == DeviceUnknown || ua.Device == DeviceMobile {
+			ua.Device = DeviceDesktop
+		}
+	}
+
+	return ua
+}
+
+type userAgentContextKey struct{}
+
+// UserAgentFromContext returns the user agent stored in ctx by UserAgentMiddleware
+func UserAgentFromContext(ctx context.Context) (UserAgent, bool) {
+	ua, ok := ctx.Value(userAgentContextKey{}).(UserAgent)
+	return ua, ok
+}
+
+// UserAgentMiddleware parses the client's user agent and stores it in the request context.
+// It also asks browsers for the client hints it understands on later requests.
+func UserAgentMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Accept-CH", "Sec-CH-UA, Sec-CH-UA-Mobile, Sec-CH-UA-Platform")
+		w.Header().Add("Vary", "User-Agent, Sec-CH-UA, Sec-CH-UA-Mobile, Sec-CH-UA-Platform")
+
+		ctx := context.WithValue(r.Context(), userAgentContextKey{}, ParseRequestUserAgent(r))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,63 @@
+package toolkit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseUserAgent(t *testing.T) {
+	var tests = []struct {
+		ua      string
+		browser string
+		version string
+		os      string
+		device  string
+	}{
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/118.0.0.0 Safari/537.36", "Chrome", "118.0.0.0", "Windows", DeviceDesktop},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/118.0.0.0 Safari/537.36 Edg/118.0.2088.46", "Edge", "118.0.2088.46", "Windows", DeviceDesktop},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1", "Safari", "17.0", "iOS", DeviceMobile},
+		{"Mozilla/5.0 (iPad; CPU OS 16_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/118.0.5993.69 Mobile/15E148 Safari/604.1", "Chrome", "118.0.5993.69", "iOS", DeviceTablet},
+		{"Mozilla/5.0 (Linux; Android 13; SM-S908B) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/22.0 Chrome/111.0.5563.116 Mobile Safari/537.36", "Samsung Internet", "22.0", "Android", DeviceMobile},
+		{"Mozilla/5.0 (Macintosh; Intel Mac OS X 14.0; rv:109.0) Gecko/20100101 Firefox/118.0", "Firefox", "118.0", "macOS", DeviceDesktop},
+		{"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", "", "", "", DeviceBot},
+		{"curl/8.1.2", "", "", "", DeviceBot},
+		{"", "", "", "", DeviceUnknown},
+	}
+
+	for _, e := range tests {
+		ua := ParseUserAgent(e.ua)
+		if ua.Browser != e.browser || ua.BrowserVersion != e.version || ua.OS != e.os || ua.Device != e.device {
+			t.Errorf("%q: expected %s %s on %s (%s), got %+v", e.ua, e.browser, e.version, e.os, e.device, ua)
+		}
+	}
+}
+
+func TestUserAgentMiddleware(t *testing.T) {
+	var ua UserAgent
+	handler := UserAgentMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ua, _ = UserAgentFromContext(r.Context())
+	}))
+
+	// client hints take priority over the reduced user agent string
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/118.0.0.0 Mobile Safari/537.36")
+	req.Header.Set("Sec-CH-UA", `"Chromium";v="118", "Google Chrome";v="118", "Not=A?Brand";v="99"`)
+	req.Header.Set("Sec-CH-UA-Mobile", "?1")
+	req.Header.Set("Sec-CH-UA-Platform", `"Android"`)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if ua.Browser != "Chrome" || ua.BrowserVersion != "118" || ua.OS != "Android" || !ua.IsMobile() {
+		t.Errorf("wrong user agent from client hints: %+v", ua)
+	}
+	if rr.Header().Get("Accept-CH") == "" {
+		t.Error("expected an Accept-CH header")
+	}
+	// responses differ by the hints as well as the user agent
+	if vary := rr.Header().Get("Vary"); !strings.Contains(vary, "Sec-CH-UA-Mobile") {
+		t.Errorf("expected Vary to name the client hints, got %q", vary)
+	}
+}
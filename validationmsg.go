@@ -0,0 +1,114 @@
+package toolkit
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// validationCatalogFS holds the built-in messages, one JSON file of rule to fmt template per
+// language
+//
+//go:embed validation/*.json
+var validationCatalogFS embed.FS
+
+var validationCatalogs struct {
+	sync.Once
+	mu       sync.RWMutex
+	messages map[string]map[string]string
+}
+
+func loadValidationCatalogs() map[string]map[string]string {
+	validationCatalogs.Do(func() {
+		validationCatalogs.messages = map[string]map[string]string{}
+		files, _ := validationCatalogFS.ReadDir("validation")
+		for _, f := range files {
+			data, err := validationCatalogFS.ReadFile(path.Join("validation", f.Name()))
+			if err != nil {
+				continue
+			}
+			var messages map[string]string
+			if err := json.Unmarshal(data, &messages); err != nil {
+				panic(fmt.Sprintf("toolkit: bad validation catalog %s: %v", f.Name(), err))
+			}
+			validationCatalogs.messages[strings.TrimSuffix(f.Name(), ".json")] = messages
+		}
+	})
+	return validationCatalogs.messages
+}
+
+// RegisterValidationMessages adds messages for a language, by rule name, such as minLength,
+// to those built in for English, Spanish, French and German. Messages are fmt templates taking
+// the rule's params, as "must have at least %v characters"; they replace any message already
+// registered for the same rule, so a built-in catalog can be reworded in part.
+func RegisterValidationMessages(lang string, messages map[string]string) {
+	catalogs := loadValidationCatalogs()
+	lang = strings.ToLower(lang)
+	validationCatalogs.mu.Lock()
+	defer validationCatalogs.mu.Unlock()
+	catalog := catalogs[lang]
+	if catalog == nil {
+		catalog = map[string]string{}
+		catalogs[lang] = catalog
+	}
+	for rule, message := range messages {
+		catalog[rule] = message
+	}
+}
+
+// ValidationLanguages lists the languages with messages, English first, for NegotiateLanguage
+func ValidationLanguages() []string {
+	catalogs := loadValidationCatalogs()
+	validationCatalogs.mu.RLock()
+	defer validationCatalogs.mu.RUnlock()
+	langs := make([]string, 0, len(catalogs))
+	for lang := range catalogs {
+		if lang != "en" {
+			langs = append(langs, lang)
+		}
+	}
+	sort.Strings(langs)
+	return append([]string{"en"}, langs...)
+}
+
+// ValidationMessage writes the message for rule in lang with its params, falling back from a
+// regional language such as fr-CA to its parent. It reports false if there's no message.
+func ValidationMessage(lang, rule string, params ...any) (string, bool) {
+	catalogs := loadValidationCatalogs()
+	validationCatalogs.mu.RLock()
+	defer validationCatalogs.mu.RUnlock()
+	for lang = strings.ToLower(lang); lang != ""; {
+		if message, ok := catalogs[lang][rule]; ok {
+			return fmt.Sprintf(message, params...), true
+		}
+		i := strings.LastIndex(lang, "-")
+		if i < 0 {
+			break
+		}
+		lang = lang[:i]
+	}
+	return "", false
+}
+
+// LocalizeMismatches translates the messages of contract mismatches into the language the
+// request prefers, as negotiated from its Accept-Language header, returning the translated
+// copies and the language chosen. Mismatches without a rule, or whose rule has no message in
+// the language, keep their English message.
+func LocalizeMismatches(r *http.Request, mismatches []ContractMismatch) ([]ContractMismatch, string) {
+	lang := NegotiateLanguage(r, ValidationLanguages())
+	localized := make([]ContractMismatch, len(mismatches))
+	for i, m := range mismatches {
+		if m.Rule != "" {
+			if message, ok := ValidationMessage(lang, m.Rule, m.Params...); ok {
+				m.Message = message
+			}
+		}
+		localized[i] = m
+	}
+	return localized, lang
+}
@@ -0,0 +1,117 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestValidationCatalogs(t *testing.T) {
+	// every built-in language has a message for every English rule
+	en := loadValidationCatalogs()["en"]
+	for _, lang := range ValidationLanguages() {
+		for rule := range en {
+			if _, ok := ValidationMessage(lang, rule, 1); !ok {
+				t.Errorf("%s has no message for %s", lang, rule)
+			}
+		}
+	}
+	if langs := ValidationLanguages(); langs[0] != "en" || len(langs) < 4 {
+		t.Errorf("unexpected languages %v", langs)
+	}
+}
+
+func TestValidationMessage(t *testing.T) {
+	RegisterValidationMessages("es-MX", map[string]string{"required": "es requerido"})
+	RegisterValidationMessages("it", map[string]string{"minLength": "deve avere almeno %v caratteri"})
+
+	var tests = []struct {
+		lang   string
+		rule   string
+		params []any
+		want   string
+		ok     bool
+	}{
+		{lang: "en", rule: "minLength", params: []any{3}, want: "must have at least 3 characters", ok: true},
+		{lang: "fr", rule: "maximum", params: []any{100}, want: "doit être au plus 100", ok: true},
+		{lang: "de-AT", rule: "required", want: "ist erforderlich", ok: true},
+		{lang: "es-MX", rule: "required", want: "es requerido", ok: true},
+		// missing regional messages fall back to the parent language
+		{lang: "es-MX", rule: "minItems", params: []any{2}, want: "debe tener al menos 2 elementos", ok: true},
+		{lang: "it", rule: "minLength", params: []any{8}, want: "deve avere almeno 8 caratteri", ok: true},
+		{lang: "it", rule: "required", ok: false},
+		{lang: "en", rule: "unknown", ok: false},
+	}
+	for _, e := range tests {
+		got, ok := ValidationMessage(e.lang, e.rule, e.params...)
+		if got != e.want || ok != e.ok {
+			t.Errorf("ValidationMessage(%s, %s): expected %q %v, got %q %v", e.lang, e.rule, e.want, e.ok, got, ok)
+		}
+	}
+}
+
+func TestLocalizeMismatches(t *testing.T) {
+	c, err := ParseOpenAPI([]byte(testOpenAPI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("POST", "/v1/users", strings.NewReader(`{"email": "nope", "name": ""}`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("X-Request-ID", "abc")
+	r.Header.Set("Accept-Language", "fr-CH, de;q=0.5")
+	mismatches := c.CheckRequest(r, []byte(`{"email": "nope", "name": ""}`))
+
+	localized, lang := LocalizeMismatches(r, mismatches)
+	if lang != "fr" || len(localized) != len(mismatches) {
+		t.Fatalf("unexpected %s %v", lang, localized)
+	}
+	var expected = map[string]string{
+		"X-Request-ID": "doit contenir au moins 8 caractères",
+		"email":        "doit être un email valide",
+		"name":         "doit contenir au moins 1 caractères",
+		"id":           "est obligatoire",
+	}
+	for i, m := range localized {
+		if m.Rule == "" {
+			t.Errorf("mismatch %v has no rule", mismatches[i])
+		}
+		for field, message := range expected {
+			if strings.HasSuffix(m.Field, field) && m.Message != message {
+				t.Errorf("%s: expected %q, got %q", m.Field, message, m.Message)
+			}
+		}
+		if mismatches[i].Message == m.Message {
+			t.Errorf("expected %q to be translated", m.Message)
+		}
+	}
+}
+
+func TestContractVerifier_Localize(t *testing.T) {
+	c, err := ParseOpenAPI([]byte(testOpenAPI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cv := &ContractVerifier{Contract: c, EnforceRequests: true, Localize: true}
+	h := cv.Middleware(http.NotFoundHandler())
+
+	r := httptest.NewRequest("GET", "/v1/users?limit=lots", nil)
+	r.Header.Set("Accept-Language", "es")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, r)
+
+	var body struct {
+		Message string             `json:"message"`
+		Data    []ContractMismatch `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if rr.Code != http.StatusBadRequest || rr.Header().Get("Content-Language") != "es" {
+		t.Fatalf("unexpected %d %v", rr.Code, rr.Header())
+	}
+	if body.Message != "la solicitud no cumple el contrato de la API" || len(body.Data) != 1 || body.Data[0].Message != "debe ser de tipo integer" {
+		t.Errorf("unexpected body %s", rr.Body)
+	}
+}
@@ -0,0 +1,172 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// ErrUnsupportedVersion is sent when a client asks for an API version which is not registered
+var ErrUnsupportedVersion = errors.New("unsupported api version")
+
+// APIVersions negotiates the API version of each request, from a path prefix such as /v2/,
+// a header, or a media type parameter such as application/json; version=2, in that order.
+// Versions are registered oldest first. Handlers written for the latest version can serve
+// older clients through Up and Down transformations, and Dispatch serves versions with
+// handlers of their own.
+type APIVersions struct {
+	// Versions lists the supported versions, oldest first, such as "1", "2"
+	Versions []string
+	// Default is used when a request names no version. Defaults to the latest
+	Default string
+	// PathPrefix enables versions as the first path segment, such as /v2/users, which is
+	// stripped before the request is handled
+	PathPrefix bool
+	// Header is the request header naming the version. Defaults to "API-Version"
+	Header string
+	// MediaTypeParam is the Accept header parameter naming the version. Defaults to "version"
+	MediaTypeParam string
+
+	transforms Transforms
+}
+
+type apiVersionContextKey struct{}
+
+// APIVersionFromContext returns the version negotiated by APIVersions' middleware
+func APIVersionFromContext(ctx context.Context) string {
+	v, _ := ctx.Value(apiVersionContextKey{}).(string)
+	return v
+}
+
+// Up registers a transformation of request structs from version to the version after it
+func (av *APIVersions) Up(version string, fn RequestTransform) {
+	av.transforms.Request("up:"+version, fn)
+}
+
+// Down registers a transformation of response payloads from the version after version, down to it
+func (av *APIVersions) Down(version string, fn ResponseTransform) {
+	av.transforms.Response("down:"+version, fn)
+}
+
+// Extract returns the version a request asks for, and the path with any version prefix removed
+func (av *APIVersions) Extract(r *http.Request) (version, path string, err error) {
+	path = r.URL.Path
+
+	if av.PathPrefix {
+		segment, rest, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+		if len(segment) > 1 && (segment[0] == 'v' || segment[0] == 'V') && av.index(segment[1:]) >= 0 {
+			version, path = segment[1:], "/"+rest
+		}
+	}
+
+	header := av.Header
+	if header == "" {
+		header = "API-Version"
+	}
+	if version == "" {
+		version = strings.TrimSpace(r.Header.Get(header))
+	}
+
+	if version == "" {
+		param := av.MediaTypeParam
+		if param == "" {
+			param = "version"
+		}
+		for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+			if _, params, err := mime.ParseMediaType(strings.TrimSpace(accept)); err == nil && params[param] != "" {
+				version = params[param]
+				break
+			}
+		}
+	}
+
+	if version == "" {
+		version = av.Default
+		if version == "" && len(av.Versions) > 0 {
+			version = av.Versions[len(av.Versions)-1]
+		}
+	}
+
+	if av.index(version) < 0 {
+		return "", path, fmt.Errorf("%w: %q", ErrUnsupportedVersion, version)
+	}
+	return version, path, nil
+}
+
+func (av *APIVersions) index(version string) int {
+	for i, v := range av.Versions {
+		if v == version {
+			return i
+		}
+	}
+	return -1
+}
+
+// Middleware negotiates the version of each request, stores it in the context, echoes it in
+// the API-Version response header, and applies the Up and Down transformations between it
+// and the latest version. Unsupported versions are refused with a 400 JSON error.
+func (av *APIVersions) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		version, path, err := av.Extract(r)
+		if err != nil {
+			var t Tools
+			_ = t.ErrorJSON(w, err)
+			return
+		}
+
+		if path != r.URL.Path {
+			r2 := r.Clone(r.Context())
+			r2.URL.Path, r2.URL.RawPath = path, ""
+			r = r2
+		}
+		r = r.WithContext(context.WithValue(r.Context(), apiVersionContextKey{}, version))
+		w.Header().Set("API-Version", version)
+
+		keys := av.transformKeys(av.index(version), len(av.Versions)-1)
+		if len(keys) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		av.transforms.Use(keys...)(next).ServeHTTP(w, r)
+	})
+}
+
+// transformKeys returns the transformation keys between the versions at from and to: requests
+// step up from the client's version, and responses step back down
+func (av *APIVersions) transformKeys(from, to int) []string {
+	var keys []string
+	for _, v := range av.Versions[from:to] {
+		keys = append(keys, "up:"+v)
+	}
+	for j := to - 1; j >= from; j-- {
+		keys = append(keys, "down:"+av.Versions[j])
+	}
+	return keys
+}
+
+// Dispatch returns a handler which serves each request with the handler registered for its
+// version, or for the nearest newer version which has one. Handlers are written for the
+// version they are registered for, so requests are only transformed up to it, and not at all
+// for versions with a handler of their own. It must be used inside Middleware.
+func (av *APIVersions) Dispatch(handlers map[string]http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		i := av.index(APIVersionFromContext(r.Context()))
+		for j := i; j >= 0 && j < len(av.Versions); j++ {
+			h, ok := handlers[av.Versions[j]]
+			if !ok {
+				continue
+			}
+			// replace the transformations Middleware set up to the latest version
+			active := &activeTransforms{tf: &av.transforms, keys: av.transformKeys(i, j)}
+			r = r.WithContext(context.WithValue(r.Context(), transformContextKey{}, active))
+			h.ServeHTTP(&transformWriter{ResponseWriter: w, r: r}, r)
+			return
+		}
+
+		var t Tools
+		_ = t.ErrorJSON(w, ErrUnsupportedVersion, http.StatusNotFound)
+	})
+}
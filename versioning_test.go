@@ -0,0 +1,121 @@
+package toolkit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAPIVersions_Extract(t *testing.T) {
+	av := &APIVersions{Versions: []string{"1", "2", "3"}, PathPrefix: true}
+
+	var tests = []struct {
+		name     string
+		path     string
+		header   string
+		accept   string
+		expected string
+		newPath  string
+		errorExp bool
+	}{
+		{"default", "/users", "", "", "3", "/users", false},
+		{"path prefix", "/v1/users", "", "", "1", "/users", false},
+		{"header", "/users", "2", "", "2", "/users", false},
+		{"media type", "/users", "", "text/html, application/json; version=1", "1", "/users", false},
+		{"path wins", "/v2/users", "1", "", "2", "/users", false},
+		{"unknown path segment", "/v9/users", "", "", "3", "/v9/users", false},
+		{"unsupported header", "/users", "7", "", "", "/users", true},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("GET", e.path, nil)
+		if e.header != "" {
+			req.Header.Set("API-Version", e.header)
+		}
+		if e.accept != "" {
+			req.Header.Set("Accept", e.accept)
+		}
+
+		version, path, err := av.Extract(req)
+		if e.errorExp != (err != nil) {
+			t.Errorf("%s: unexpected error %v", e.name, err)
+		}
+		if version != e.expected || path != e.newPath {
+			t.Errorf("%s: expected %q %q, got %q %q", e.name, e.expected, e.newPath, version, path)
+		}
+	}
+}
+
+func TestAPIVersions_Middleware(t *testing.T) {
+	av := &APIVersions{Versions: []string{"1", "2", "3"}, PathPrefix: true}
+
+	// v1 sent "name"; v2 onwards send "full_name". v3 responses add a "kind" field
+	av.Up("1", func(r *http.Request, data any) error {
+		u := data.(*transformUser)
+		u.FullName, u.Name = u.Name, ""
+		return nil
+	})
+	av.Down("2", func(r *http.Request, status int, data any) (any, error) {
+		m := data.(map[string]string)
+		delete(m, "kind")
+		return m, nil
+	})
+	av.Down("1", func(r *http.Request, status int, data any) (any, error) {
+		m := data.(map[string]string)
+		m["name"] = m["full_name"]
+		delete(m, "full_name")
+		return m, nil
+	})
+
+	var testTools Tools
+	latest := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var u transformUser
+		if err := testTools.ReadJSON(w, r, &u); err != nil {
+			_ = testTools.ErrorJSON(w, err)
+			return
+		}
+		_ = testTools.WriteJSON(w, http.StatusOK, map[string]string{"full_name": u.FullName, "kind": "user", "path": r.URL.Path})
+	})
+	handler := av.Middleware(av.Dispatch(map[string]http.Handler{"3": latest}))
+
+	// a handler written for v1 gets v1 requests, and its responses are sent as they are
+	v1 := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var u map[string]string
+		_ = testTools.ReadJSON(w, r, &u)
+		_ = testTools.WriteJSON(w, http.StatusOK, map[string]string{"legacy": u["name"]})
+	})
+	both := av.Middleware(av.Dispatch(map[string]http.Handler{"1": v1, "3": latest}))
+
+	var tests = []struct {
+		handler  http.Handler
+		path     string
+		body     string
+		expected string
+	}{
+		{handler, "/v1/users", `{"name":"Ada"}`, `{"name":"Ada","path":"/users"}`},
+		{handler, "/v2/users", `{"full_name":"Ada"}`, `{"full_name":"Ada","path":"/users"}`},
+		{handler, "/v3/users", `{"full_name":"Ada"}`, `{"full_name":"Ada","kind":"user","path":"/users"}`},
+		{both, "/v1/users", `{"name":"Ada"}`, `{"legacy":"Ada"}`},
+		{both, "/v2/users", `{"full_name":"Ada"}`, `{"full_name":"Ada","path":"/users"}`},
+	}
+
+	for _, e := range tests {
+		rr := httptest.NewRecorder()
+		e.handler.ServeHTTP(rr, httptest.NewRequest("POST", e.path, strings.NewReader(e.body)))
+		if rr.Body.String() != e.expected {
+			t.Errorf("%s: expected %s, got %s", e.path, e.expected, rr.Body.String())
+		}
+		if rr.Header().Get("API-Version") != e.path[2:3] {
+			t.Errorf("%s: unexpected API-Version header %q", e.path, rr.Header().Get("API-Version"))
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/users", nil)
+	req.Header.Set("API-Version", "0")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for unsupported version, got %d", rr.Code)
+	}
+}
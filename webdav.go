@@ -0,0 +1,548 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+// webdavDirMarker is the object which keeps an empty collection created with MKCOL, as
+// storage keys have no directories of their own. It is hidden from listings
+const webdavDirMarker = ".webdav-collection"
+
+// WebDAV serves a Storage over WebDAV (class 1, with the no-op locking class 2 clients such as
+// Windows Explorer and macOS Finder need to write), so the upload area can be mounted as a
+// network drive. Collections are the slash separated prefixes of the keys. Wrap it in the
+// authentication middleware used for the rest of the application.
+type WebDAV struct {
+	Storage Storage
+	// Prefix is the path the handler is mounted on, such as "/dav", which is stripped from
+	// request paths to find keys
+	Prefix string
+	// ReadOnly refuses every method which changes the storage
+	ReadOnly bool
+	// MaxFileSize is the largest file which can be PUT. Defaults to 1GB
+	MaxFileSize int64
+}
+
+var webdavReadMethods = []string{"OPTIONS", "GET", "HEAD", "PROPFIND"}
+var webdavWriteMethods = []string{"PUT", "DELETE", "MKCOL", "COPY", "MOVE", "PROPPATCH", "LOCK", "UNLOCK"}
+
+// ServeHTTP implements http.Handler
+func (d *WebDAV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key, ok := d.key(r.URL.Path)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	if d.ReadOnly && containsString(webdavWriteMethods, r.Method) {
+		w.Header().Set("Allow", strings.Join(webdavReadMethods, ", "))
+		http.Error(w, "read only", http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodOptions:
+		d.options(w)
+	case http.MethodGet, http.MethodHead:
+		d.get(w, r, key)
+	case "PROPFIND":
+		d.propfind(w, r, key)
+	case http.MethodPut:
+		d.put(w, r, key)
+	case http.MethodDelete:
+		d.delete(w, r, key)
+	case "MKCOL":
+		d.mkcol(w, r, key)
+	case "COPY", "MOVE":
+		d.copyMove(w, r, key)
+	case "PROPPATCH":
+		d.proppatch(w, r, key)
+	case "LOCK":
+		d.lock(w, r)
+	case "UNLOCK":
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		d.options(w)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// key returns the storage key for a request path, which is empty for the root collection
+func (d *WebDAV) key(urlPath string) (string, bool) {
+	prefix := strings.TrimSuffix(d.Prefix, "/")
+	rest := strings.TrimPrefix(urlPath, prefix)
+	if !strings.HasPrefix(urlPath, prefix) || (rest != "" && rest[0] != '/') {
+		return "", false
+	}
+	return strings.TrimPrefix(path.Clean("/"+rest), "/"), true
+}
+
+// href returns the URL path of a key, with a trailing slash for collections
+func (d *WebDAV) href(key string, collection bool) string {
+	p := strings.TrimSuffix(d.Prefix, "/") + "/" + key
+	if collection && !strings.HasSuffix(p, "/") {
+		p += "/"
+	}
+	return (&url.URL{Path: p}).EscapedPath()
+}
+
+func (d *WebDAV) options(w http.ResponseWriter) {
+	methods := webdavReadMethods
+	w.Header().Set("DAV", "1")
+	if !d.ReadOnly {
+		methods = append(append([]string{}, webdavReadMethods...), webdavWriteMethods...)
+		w.Header().Set("DAV", "1, 2")
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	w.Header().Set("MS-Author-Via", "DAV")
+}
+
+// webdavEntry is a file or collection in a PROPFIND response
+type webdavEntry struct {
+	key        string
+	collection bool
+	info       ObjectInfo
+}
+
+// stat describes the file or collection at key
+func (d *WebDAV) stat(r *http.Request, key string) (webdavEntry, error) {
+	if key != "" {
+		info, err := d.Storage.Stat(r.Context(), key)
+		if err == nil {
+			return webdavEntry{key: key, info: info}, nil
+		}
+		if !errors.Is(err, ErrNotFound) {
+			return webdavEntry{}, err
+		}
+
+		children, err := d.Storage.List(r.Context(), key+"/")
+		if err != nil {
+			return webdavEntry{}, err
+		}
+		if len(children) == 0 {
+			return webdavEntry{}, ErrNotFound
+		}
+	}
+	return webdavEntry{key: key, collection: true}, nil
+}
+
+// children returns the files and collections directly inside a collection
+func (d *WebDAV) children(r *http.Request, key string) ([]webdavEntry, error) {
+	prefix := ""
+	if key != "" {
+		prefix = key + "/"
+	}
+	objects, err := d.Storage.List(r.Context(), prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []webdavEntry
+	seen := make(map[string]bool)
+	for _, obj := range objects {
+		rest := strings.TrimPrefix(obj.Key, prefix)
+		if name, _, nested := strings.Cut(rest, "/"); nested {
+			if !seen[name] {
+				seen[name] = true
+				entries = append(entries, webdavEntry{key: prefix + name, collection: true})
+			}
+			continue
+		}
+		if rest == webdavDirMarker || rest == "" {
+			continue
+		}
+		entries = append(entries, webdavEntry{key: obj.Key, info: obj})
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].key < entries[j].key })
+	return entries, nil
+}
+
+func (d *WebDAV) get(w http.ResponseWriter, r *http.Request, key string) {
+	entry, err := d.stat(r, key)
+	if err != nil {
+		webdavError(w, err)
+		return
+	}
+	if entry.collection {
+		d.listing(w, r, key)
+		return
+	}
+
+	var t Tools
+	t.ServeObject(w, r, d.Storage, key, "")
+}
+
+// listing serves a simple HTML index of a collection, for browsers
+func (d *WebDAV) listing(w http.ResponseWriter, r *http.Request, key string) {
+	entries, err := d.children(r, key)
+	if err != nil {
+		webdavError(w, err)
+		return
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("<!DOCTYPE html>\n<ul>\n")
+	for _, e := range entries {
+		name := path.Base(e.key)
+		if e.collection {
+			name += "/"
+		}
+		buf.WriteString(`<li><a href="` + d.href(e.key, e.collection) + `">`)
+		_ = xml.EscapeText(&buf, []byte(name))
+		buf.WriteString("</a></li>\n")
+	}
+	buf.WriteString("</ul>\n")
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if r.Method == http.MethodHead {
+		return
+	}
+	_, _ = w.Write(buf.Bytes())
+}
+
+func (d *WebDAV) propfind(w http.ResponseWriter, r *http.Request, key string) {
+	// every request is answered with all properties, which is what clients ask for in practice
+	_, _ = io.Copy(io.Discard, io.LimitReader(r.Body, 1<<20))
+
+	entry, err := d.stat(r, key)
+	if err != nil {
+		webdavError(w, err)
+		return
+	}
+
+	entries := []webdavEntry{entry}
+	if entry.collection && r.Header.Get("Depth") != "0" {
+		children, err := d.children(r, key)
+		if err != nil {
+			webdavError(w, err)
+			return
+		}
+		entries = append(entries, children...)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header + `<D:multistatus xmlns:D="DAV:">`)
+	for _, e := range entries {
+		d.writeResponse(&buf, e)
+	}
+	buf.WriteString(`</D:multistatus>`)
+
+	writeMultiStatus(w, buf.Bytes())
+}
+
+func (d *WebDAV) writeResponse(buf *bytes.Buffer, e webdavEntry) {
+	name := path.Base(e.key)
+	if e.key == "" {
+		name = "/"
+	}
+
+	buf.WriteString(`<D:response><D:href>`)
+	_ = xml.EscapeText(buf, []byte(d.href(e.key, e.collection)))
+	buf.WriteString(`</D:href><D:propstat><D:prop><D:displayname>`)
+	_ = xml.EscapeText(buf, []byte(name))
+	buf.WriteString(`</D:displayname>`)
+
+	if e.collection {
+		buf.WriteString(`<D:resourcetype><D:collection/></D:resourcetype>`)
+	} else {
+		contentType := mime.TypeByExtension(path.Ext(e.key))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		buf.WriteString(`<D:resourcetype/><D:getcontentlength>` + strconv.FormatInt(e.info.Size, 10) + `</D:getcontentlength>`)
+		buf.WriteString(`<D:getcontenttype>`)
+		_ = xml.EscapeText(buf, []byte(contentType))
+		buf.WriteString(`</D:getcontenttype>`)
+		if !e.info.ModTime.IsZero() {
+			buf.WriteString(`<D:getlastmodified>` + e.info.ModTime.UTC().Format(http.TimeFormat) + `</D:getlastmodified>`)
+			buf.WriteString(fmt.Sprintf(`<D:getetag>"%x-%x"</D:getetag>`, e.info.ModTime.UnixNano(), e.info.Size))
+		}
+	}
+	buf.WriteString(`</D:prop><D:status>HTTP/1.1 200 OK</D:status></D:propstat></D:response>`)
+}
+
+func (d *WebDAV) put(w http.ResponseWriter, r *http.Request, key string) {
+	if key == "" || strings.HasSuffix(r.URL.Path, "/") {
+		http.Error(w, "cannot put a collection", http.StatusMethodNotAllowed)
+		return
+	}
+
+	maxSize := d.MaxFileSize
+	if maxSize <= 0 {
+		maxSize = 1024 * 1024 * 1024
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize)
+
+	_, err := d.Storage.Stat(r.Context(), key)
+	existed := err == nil
+
+	// SVGs are sanitized, as with UploadFile, so they can't run scripts when served back
+	head := make([]byte, 3072)
+	n, err := io.ReadFull(r.Body, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		webdavError(w, asBodyTooLarge(err, maxSize))
+		return
+	}
+	body := io.MultiReader(bytes.NewReader(head[:n]), r.Body)
+	if mimetype.Detect(head[:n]).Is(SVGContentType) {
+		var clean bytes.Buffer
+		if err = SanitizeSVG(&clean, body); err != nil {
+			if err = asBodyTooLarge(err, maxSize); errors.As(err, new(*BodyTooLargeError)) {
+				webdavError(w, err)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+			return
+		}
+		body = &clean
+	}
+
+	if err = d.Storage.Put(r.Context(), key, body); err != nil {
+		webdavError(w, asBodyTooLarge(err, maxSize))
+		return
+	}
+	if existed {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (d *WebDAV) delete(w http.ResponseWriter, r *http.Request, key string) {
+	if key == "" {
+		http.Error(w, "cannot delete the root collection", http.StatusForbidden)
+		return
+	}
+	entry, err := d.stat(r, key)
+	if err != nil {
+		webdavError(w, err)
+		return
+	}
+
+	keys := []string{key}
+	if entry.collection {
+		if keys, err = d.keysUnder(r, key); err != nil {
+			webdavError(w, err)
+			return
+		}
+	}
+	for _, k := range keys {
+		if err = d.Storage.Delete(r.Context(), k); err != nil {
+			webdavError(w, err)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// keysUnder returns the keys of every object in a collection and the collections inside it
+func (d *WebDAV) keysUnder(r *http.Request, key string) ([]string, error) {
+	prefix := ""
+	if key != "" {
+		prefix = key + "/"
+	}
+	objects, err := d.Storage.List(r.Context(), prefix)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, len(objects))
+	for i, obj := range objects {
+		keys[i] = obj.Key
+	}
+	return keys, nil
+}
+
+func (d *WebDAV) mkcol(w http.ResponseWriter, r *http.Request, key string) {
+	if r.ContentLength > 0 {
+		http.Error(w, "mkcol bodies are not supported", http.StatusUnsupportedMediaType)
+		return
+	}
+	if _, err := d.stat(r, key); err == nil {
+		http.Error(w, "already exists", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := d.Storage.Put(r.Context(), key+"/"+webdavDirMarker, strings.NewReader("")); err != nil {
+		webdavError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (d *WebDAV) copyMove(w http.ResponseWriter, r *http.Request, key string) {
+	if key == "" {
+		http.Error(w, "cannot copy or move the root collection", http.StatusForbidden)
+		return
+	}
+	dest, err := url.Parse(r.Header.Get("Destination"))
+	if err != nil || dest.Path == "" {
+		http.Error(w, "bad destination", http.StatusBadRequest)
+		return
+	}
+	destKey, ok := d.key(dest.Path)
+	if !ok || destKey == "" || destKey == key {
+		http.Error(w, "bad destination", http.StatusForbidden)
+		return
+	}
+
+	entry, err := d.stat(r, key)
+	if err != nil {
+		webdavError(w, err)
+		return
+	}
+
+	_, err = d.stat(r, destKey)
+	existed := err == nil
+	if existed && r.Header.Get("Overwrite") == "F" {
+		http.Error(w, "destination exists", http.StatusPreconditionFailed)
+		return
+	}
+
+	srcs := []string{key}
+	if entry.collection {
+		if strings.HasPrefix(destKey+"/", key+"/") {
+			http.Error(w, "cannot copy a collection into itself", http.StatusForbidden)
+			return
+		}
+		if srcs, err = d.keysUnder(r, key); err != nil {
+			webdavError(w, err)
+			return
+		}
+	}
+
+	for _, src := range srcs {
+		dst := destKey + strings.TrimPrefix(src, key)
+		if err = CopyObject(r.Context(), d.Storage, src, dst); err != nil {
+			webdavError(w, err)
+			return
+		}
+		if r.Method == "MOVE" {
+			if err = d.Storage.Delete(r.Context(), src); err != nil {
+				webdavError(w, err)
+				return
+			}
+		}
+	}
+
+	if existed {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// proppatch accepts and discards property changes, such as the timestamps Windows sets after
+// an upload, which clients treat as a failed upload if they are refused
+func (d *WebDAV) proppatch(w http.ResponseWriter, r *http.Request, key string) {
+	entry, err := d.stat(r, key)
+	if err != nil {
+		webdavError(w, err)
+		return
+	}
+
+	var names []xml.Name
+	dec := xml.NewDecoder(io.LimitReader(r.Body, 1<<20))
+	depth, propDepth := 0, -1
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+			if t.Name.Space == "DAV:" && t.Name.Local == "prop" {
+				propDepth = depth
+			} else if propDepth >= 0 && depth == propDepth+1 {
+				names = append(names, t.Name)
+			}
+		case xml.EndElement:
+			if depth == propDepth {
+				propDepth = -1
+			}
+			depth--
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header + `<D:multistatus xmlns:D="DAV:"><D:response><D:href>`)
+	_ = xml.EscapeText(&buf, []byte(d.href(entry.key, entry.collection)))
+	buf.WriteString(`</D:href><D:propstat><D:prop>`)
+	for _, name := range names {
+		buf.WriteString(`<P:`)
+		_ = xml.EscapeText(&buf, []byte(name.Local))
+		buf.WriteString(` xmlns:P="`)
+		_ = xml.EscapeText(&buf, []byte(name.Space))
+		buf.WriteString(`"/>`)
+	}
+	buf.WriteString(`</D:prop><D:status>HTTP/1.1 200 OK</D:status></D:propstat></D:response></D:multistatus>`)
+
+	writeMultiStatus(w, buf.Bytes())
+}
+
+// lock grants every lock request without enforcing it. Clients which can only write with a
+// lock, such as Windows Explorer and Finder, work; concurrent writers are not kept apart.
+func (d *WebDAV) lock(w http.ResponseWriter, r *http.Request) {
+	_, _ = io.Copy(io.Discard, io.LimitReader(r.Body, 1<<20))
+
+	token, err := randomHex(16)
+	if err != nil {
+		webdavError(w, err)
+		return
+	}
+	token = "opaquelocktoken:" + token
+
+	timeout := "Second-" + strconv.Itoa(int(time.Hour/time.Second))
+	body := xml.Header + `<D:prop xmlns:D="DAV:"><D:lockdiscovery><D:activelock>` +
+		`<D:locktype><D:write/></D:locktype><D:lockscope><D:exclusive/></D:lockscope>` +
+		`<D:depth>infinity</D:depth><D:timeout>` + timeout + `</D:timeout>` +
+		`<D:locktoken><D:href>` + token + `</D:href></D:locktoken>` +
+		`</D:activelock></D:lockdiscovery></D:prop>`
+
+	w.Header().Set("Lock-Token", "<"+token+">")
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(body))
+}
+
+func writeMultiStatus(w http.ResponseWriter, body []byte) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	_, _ = w.Write(body)
+}
+
+func webdavError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrInvalidKey):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.As(err, new(*BodyTooLargeError)):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package toolkit
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newWebDAVTest(t *testing.T, readOnly bool) (*FileStorage, *httptest.Server) {
+	store := &FileStorage{Dir: t.TempDir()}
+	_ = store.Put(context.Background(), "docs/a.txt", strings.NewReader("hello"))
+	_ = store.Put(context.Background(), "docs/sub/b.txt", strings.NewReader("world"))
+
+	srv := httptest.NewServer(&WebDAV{Storage: store, Prefix: "/dav", ReadOnly: readOnly})
+	t.Cleanup(srv.Close)
+	return store, srv
+}
+
+func webdavDo(t *testing.T, method, url string, body string, headers map[string]string) (int, string) {
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	b, _ := io.ReadAll(res.Body)
+	return res.StatusCode, string(b)
+}
+
+func TestWebDAV_ReadWrite(t *testing.T) {
+	store, srv := newWebDAVTest(t, false)
+	ctx := context.Background()
+
+	status, body := webdavDo(t, "PROPFIND", srv.URL+"/dav/docs/", "", map[string]string{"Depth": "1"})
+	if status != http.StatusMultiStatus {
+		t.Fatalf("expected 207, got %d", status)
+	}
+	for _, want := range []string{"<D:href>/dav/docs/</D:href>", "<D:href>/dav/docs/a.txt</D:href>", "<D:href>/dav/docs/sub/</D:href>", "<D:getcontentlength>5</D:getcontentlength>"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %s in propfind response", want)
+		}
+	}
+	if strings.Contains(body, "b.txt") {
+		t.Error("depth 1 listed a nested file")
+	}
+
+	if status, body = webdavDo(t, http.MethodGet, srv.URL+"/dav/docs/a.txt", "", nil); status != http.StatusOK || body != "hello" {
+		t.Errorf("unexpected get: %d %q", status, body)
+	}
+
+	var tests = []struct {
+		method  string
+		path    string
+		body    string
+		headers map[string]string
+		status  int
+	}{
+		{http.MethodDelete, "/dav/", "", nil, http.StatusForbidden},
+		{"MOVE", "/dav/", "", map[string]string{"Destination": srv.URL + "/dav/x"}, http.StatusForbidden},
+		{"COPY", "/dav", "", map[string]string{"Destination": srv.URL + "/dav/x"}, http.StatusForbidden},
+		{http.MethodPut, "/dav/docs/c.txt", "new", nil, http.StatusCreated},
+		{http.MethodPut, "/dav/docs/c.txt", "newer", nil, http.StatusNoContent},
+		{"MKCOL", "/dav/empty", "", nil, http.StatusCreated},
+		{"MKCOL", "/dav/empty", "", nil, http.StatusMethodNotAllowed},
+		{"COPY", "/dav/docs/c.txt", "", map[string]string{"Destination": srv.URL + "/dav/docs/d.txt"}, http.StatusCreated},
+		{"COPY", "/dav/docs/c.txt", "", map[string]string{"Destination": srv.URL + "/dav/docs/d.txt", "Overwrite": "F"}, http.StatusPreconditionFailed},
+		{"MOVE", "/dav/docs/sub", "", map[string]string{"Destination": srv.URL + "/dav/moved"}, http.StatusCreated},
+		{"LOCK", "/dav/docs/c.txt", "", nil, http.StatusOK},
+		{"PROPPATCH", "/dav/docs/c.txt", `<D:propertyupdate xmlns:D="DAV:"><D:set><D:prop><Z:Win32LastModifiedTime xmlns:Z="urn:schemas-microsoft-com:"/></D:prop></D:set></D:propertyupdate>`, nil, http.StatusMultiStatus},
+		{http.MethodDelete, "/dav/docs/a.txt", "", nil, http.StatusNoContent},
+		{http.MethodDelete, "/dav/docs/a.txt", "", nil, http.StatusNotFound},
+	}
+
+	for _, e := range tests {
+		if status, body := webdavDo(t, e.method, srv.URL+e.path, e.body, e.headers); status != e.status {
+			t.Errorf("%s %s: expected %d, got %d %s", e.method, e.path, e.status, status, body)
+		}
+	}
+
+	for key, want := range map[string]string{"docs/c.txt": "newer", "docs/d.txt": "newer", "moved/b.txt": "world"} {
+		rc, err := store.Get(ctx, key)
+		if err != nil {
+			t.Errorf("%s: %s", key, err)
+			continue
+		}
+		b, _ := io.ReadAll(rc)
+		rc.Close()
+		if string(b) != want {
+			t.Errorf("%s: expected %q, got %q", key, want, b)
+		}
+	}
+	if _, err := store.Stat(ctx, "docs/sub/b.txt"); err == nil {
+		t.Error("expected move to remove the source")
+	}
+
+	// files over the limit are refused
+	rr := httptest.NewRecorder()
+	(&WebDAV{Storage: store, Prefix: "/dav", MaxFileSize: 4}).ServeHTTP(rr, httptest.NewRequest(http.MethodPut, "/dav/docs/big.txt", strings.NewReader("too big")))
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413 for a large file, got %d", rr.Code)
+	}
+	if _, err := store.Stat(ctx, "docs/big.txt"); err == nil {
+		t.Error("a file over the limit was stored")
+	}
+
+	// svgs are sanitized
+	if status, body = webdavDo(t, http.MethodPut, srv.URL+"/dav/docs/logo.svg", maliciousSVG, nil); status != http.StatusCreated {
+		t.Fatalf("expected the svg stored, got %d %s", status, body)
+	}
+	if _, body = webdavDo(t, http.MethodGet, srv.URL+"/dav/docs/logo.svg", "", nil); strings.Contains(body, "alert") || !strings.Contains(body, "<rect") {
+		t.Errorf("expected a sanitized svg, got %s", body)
+	}
+
+	status, body = webdavDo(t, "PROPFIND", srv.URL+"/dav/", "", map[string]string{"Depth": "1"})
+	if status != http.StatusMultiStatus || !strings.Contains(body, "<D:href>/dav/empty/</D:href>") {
+		t.Errorf("expected empty collection in listing, got %d %s", status, body)
+	}
+	if strings.Contains(body, webdavDirMarker) {
+		t.Error("collection marker was listed")
+	}
+}
+
+func TestWebDAV_ReadOnly(t *testing.T) {
+	_, srv := newWebDAVTest(t, true)
+
+	if status, _ := webdavDo(t, http.MethodPut, srv.URL+"/dav/docs/x.txt", "x", nil); status != http.StatusMethodNotAllowed {
+		t.Errorf("expected put to be refused, got %d", status)
+	}
+	if status, _ := webdavDo(t, "PROPFIND", srv.URL+"/dav/docs/a.txt", "", map[string]string{"Depth": "0"}); status != http.StatusMultiStatus {
+		t.Errorf("expected propfind to be allowed, got %d", status)
+	}
+	if status, _ := webdavDo(t, "PROPFIND", srv.URL+"/dav/missing", "", nil); status != http.StatusNotFound {
+		t.Errorf("expected 404 for a missing key, got %d", status)
+	}
+	if status, _ := webdavDo(t, http.MethodGet, srv.URL+"/davx/docs/a.txt", "", nil); status != http.StatusNotFound {
+		t.Errorf("expected paths outside the prefix to be refused, got %d", status)
+	}
+}
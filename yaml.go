@@ -0,0 +1,470 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseYAML parses the subset of YAML used for configuration and fixture files into the
+// values encoding/json would decode JSON into, with numbers as json.Number. It supports block
+// mappings and sequences, flow sequences and mappings, plain and quoted scalars, literal (|)
+// and folded (>) block scalars, and comments. Anchors, tags and multiple documents are not
+// supported.
+func parseYAML(data []byte) (any, error) {
+	p := &yamlParser{}
+	for i, line := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		if i == 0 && strings.TrimSpace(line) == "---" {
+			continue
+		}
+		p.lines = append(p.lines, yamlLine{n: i + 1, raw: line})
+	}
+	if err := p.prepare(); err != nil {
+		return nil, err
+	}
+
+	p.skipBlank()
+	if p.pos == len(p.lines) {
+		return nil, nil
+	}
+	v, err := p.block(p.lines[p.pos].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.skipBlank(); p.pos < len(p.lines) {
+		return nil, p.errorf("unexpected indentation")
+	}
+	return v, nil
+}
+
+type yamlLine struct {
+	n      int
+	raw    string
+	indent int
+	// text is the line without its indentation and comment, or "" for a blank line
+	text string
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+func (p *yamlParser) prepare() error {
+	for i := range p.lines {
+		l := &p.lines[i]
+		body := strings.TrimLeft(l.raw, " ")
+		l.indent = len(l.raw) - len(body)
+		if strings.HasPrefix(body, "\t") {
+			return fmt.Errorf("yaml: line %d: tabs can't be used for indentation", l.n)
+		}
+		l.text = strings.TrimRight(stripYAMLComment(body), " \t")
+	}
+	return nil
+}
+
+func (p *yamlParser) errorf(format string, args ...any) error {
+	n := 0
+	if p.pos < len(p.lines) {
+		n = p.lines[p.pos].n
+	} else if len(p.lines) > 0 {
+		n = p.lines[len(p.lines)-1].n
+	}
+	return fmt.Errorf("yaml: line %d: %s", n, fmt.Sprintf(format, args...))
+}
+
+func (p *yamlParser) skipBlank() {
+	for p.pos < len(p.lines) && p.lines[p.pos].text == "" {
+		p.pos++
+	}
+}
+
+// block parses the mapping or sequence starting at the current line
+func (p *yamlParser) block(indent int) (any, error) {
+	if isYAMLSequenceItem(p.lines[p.pos].text) {
+		return p.sequence(indent)
+	}
+	return p.mapping(indent)
+}
+
+func isYAMLSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+func (p *yamlParser) sequence(indent int) ([]any, error) {
+	out := []any{}
+	for p.skipBlank(); p.pos < len(p.lines); p.skipBlank() {
+		l := &p.lines[p.pos]
+		if l.indent < indent || l.indent == indent && !isYAMLSequenceItem(l.text) {
+			break
+		}
+		if l.indent > indent {
+			return nil, p.errorf("unexpected indentation")
+		}
+
+		content := strings.TrimLeft(strings.TrimPrefix(l.text, "-"), " ")
+		if content == "" {
+			p.pos++
+			v, err := p.nested(indent)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, v)
+			continue
+		}
+		if _, _, ok := splitYAMLKey(content); ok && !strings.HasPrefix(content, "[") && !strings.HasPrefix(content, "{") {
+			// "- key: value" starts a mapping indented to the key
+			l.indent += len(l.text) - len(content)
+			l.text = content
+			v, err := p.mapping(l.indent)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, v)
+			continue
+		}
+		v, err := p.inline(content, indent)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+func (p *yamlParser) mapping(indent int) (map[string]any, error) {
+	out := make(map[string]any)
+	for p.skipBlank(); p.pos < len(p.lines); p.skipBlank() {
+		l := p.lines[p.pos]
+		if l.indent < indent {
+			break
+		}
+		if l.indent > indent || isYAMLSequenceItem(l.text) {
+			return nil, p.errorf("unexpected indentation")
+		}
+		key, value, ok := splitYAMLKey(l.text)
+		if !ok {
+			return nil, p.errorf("expected a key")
+		}
+		if _, dup := out[key]; dup {
+			return nil, p.errorf("duplicate key %q", key)
+		}
+
+		var v any
+		var err error
+		if value == "" {
+			p.pos++
+			// a sequence may be indented as much as its key
+			if p.skipBlank(); p.pos < len(p.lines) && p.lines[p.pos].indent == indent && isYAMLSequenceItem(p.lines[p.pos].text) {
+				v, err = p.sequence(indent)
+			} else {
+				v, err = p.nested(indent)
+			}
+		} else {
+			v, err = p.inline(value, indent)
+		}
+		if err != nil {
+			return nil, err
+		}
+		out[key] = v
+	}
+	return out, nil
+}
+
+// nested parses the block indented more than indent which follows a key or "-" with no value
+func (p *yamlParser) nested(indent int) (any, error) {
+	if p.skipBlank(); p.pos == len(p.lines) || p.lines[p.pos].indent <= indent {
+		return nil, nil
+	}
+	return p.block(p.lines[p.pos].indent)
+}
+
+// inline parses a value on the current line, or a block scalar starting on it, and moves past it
+func (p *yamlParser) inline(value string, indent int) (any, error) {
+	if value[0] == '|' || value[0] == '>' {
+		return p.blockScalar(value, indent)
+	}
+	p.pos++
+	if value[0] == '[' || value[0] == '{' {
+		f := &yamlFlow{s: value}
+		v, err := f.value()
+		if err == nil && strings.TrimSpace(f.s[f.i:]) != "" {
+			err = fmt.Errorf("unexpected %q", f.s[f.i:])
+		}
+		if err != nil {
+			p.pos--
+			return nil, p.errorf("%v", err)
+		}
+		return v, nil
+	}
+	v, err := yamlScalar(value)
+	if err != nil {
+		p.pos--
+		return nil, p.errorf("%v", err)
+	}
+	return v, nil
+}
+
+func (p *yamlParser) blockScalar(header string, indent int) (string, error) {
+	chomp := strings.TrimLeft(header[1:], " ")
+	if chomp != "" && chomp != "-" && chomp != "+" {
+		return "", p.errorf("unsupported block scalar header %q", header)
+	}
+	p.pos++
+
+	var lines []string
+	content := -1
+	for ; p.pos < len(p.lines); p.pos++ {
+		raw := p.lines[p.pos].raw
+		body := strings.TrimLeft(raw, " ")
+		if body == "" {
+			lines = append(lines, "")
+			continue
+		}
+		n := len(raw) - len(body)
+		if content < 0 {
+			if n <= indent {
+				break
+			}
+			content = n
+		}
+		if n < content {
+			break
+		}
+		lines = append(lines, raw[content:])
+	}
+	// trailing blank lines belong to what follows, unless kept
+	trailing := 0
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines, trailing = lines[:len(lines)-1], trailing+1
+	}
+	p.pos -= trailing
+
+	var s string
+	if header[0] == '|' {
+		s = strings.Join(lines, "\n")
+	} else {
+		var b strings.Builder
+		for i, line := range lines {
+			switch {
+			case i == 0 || lines[i-1] == "" && line != "":
+			case line == "":
+				b.WriteString("\n")
+			default:
+				b.WriteString(" ")
+			}
+			b.WriteString(line)
+		}
+		s = b.String()
+	}
+	switch {
+	case chomp == "-" || s == "":
+	case chomp == "+":
+		s += strings.Repeat("\n", trailing+1)
+	default:
+		s += "\n"
+	}
+	return s, nil
+}
+
+// splitYAMLKey splits "key: value" or "key:", where the key may be quoted
+func splitYAMLKey(text string) (key, value string, ok bool) {
+	if text[0] == '"' || text[0] == '\'' {
+		end := quotedYAMLEnd(text)
+		if end < 0 || end+1 >= len(text) || text[end+1] != ':' {
+			return "", "", false
+		}
+		rest := text[end+2:]
+		if rest != "" && rest[0] != ' ' {
+			return "", "", false
+		}
+		k, err := yamlScalar(text[:end+1])
+		if err != nil {
+			return "", "", false
+		}
+		return k.(string), strings.TrimSpace(rest), true
+	}
+
+	for i := 0; i < len(text); i++ {
+		if text[i] == ':' && (i+1 == len(text) || text[i+1] == ' ') {
+			return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+1:]), i > 0
+		}
+	}
+	return "", "", false
+}
+
+// quotedYAMLEnd returns the index of the quote closing the string s starts with, or -1
+func quotedYAMLEnd(s string) int {
+	q := s[0]
+	for i := 1; i < len(s); i++ {
+		switch {
+		case q == '"' && s[i] == '\\':
+			i++
+		case s[i] == q && q == '\'' && i+1 < len(s) && s[i+1] == '\'':
+			i++
+		case s[i] == q:
+			return i
+		}
+	}
+	return -1
+}
+
+func stripYAMLComment(s string) string {
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '"' || s[i] == '\'':
+			if i > 0 && s[i-1] != ' ' && s[i-1] != '[' && s[i-1] != '{' && s[i-1] != ',' && s[i-1] != ':' {
+				// an apostrophe in a plain scalar
+				continue
+			}
+			end := quotedYAMLEnd(s[i:])
+			if end < 0 {
+				return s
+			}
+			i += end
+		case s[i] == '#' && (i == 0 || s[i-1] == ' ' || s[i-1] == '\t'):
+			return s[:i]
+		}
+	}
+	return s
+}
+
+// yamlScalar resolves a plain or quoted scalar
+func yamlScalar(s string) (any, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	switch s[0] {
+	case '"':
+		if quotedYAMLEnd(s) != len(s)-1 {
+			return nil, fmt.Errorf("invalid quoted string %s", s)
+		}
+		return strconv.Unquote(s)
+	case '\'':
+		if quotedYAMLEnd(s) != len(s)-1 {
+			return nil, fmt.Errorf("invalid quoted string %s", s)
+		}
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	case '&', '*', '!', '%', '@', '`':
+		return nil, fmt.Errorf("unsupported value %s", s)
+	}
+
+	switch s {
+	case "~", "null", "Null", "NULL":
+		return nil, nil
+	case "true", "True", "TRUE":
+		return true, nil
+	case "false", "False", "FALSE":
+		return false, nil
+	}
+	// numbers JSON can't hold as written, such as 012 or .5, are kept as strings, so that a zip
+	// code keeps its leading zero
+	if n := strings.TrimPrefix(s, "+"); json.Valid([]byte(n)) {
+		if _, err := strconv.ParseFloat(n, 64); err == nil {
+			return json.Number(n), nil
+		}
+	}
+	return s, nil
+}
+
+// yamlFlow parses a flow sequence or mapping, such as [a, b] or {a: 1}
+type yamlFlow struct {
+	s string
+	i int
+}
+
+func (f *yamlFlow) space() {
+	for f.i < len(f.s) && f.s[f.i] == ' ' {
+		f.i++
+	}
+}
+
+func (f *yamlFlow) value() (any, error) {
+	f.space()
+	if f.i == len(f.s) {
+		return nil, fmt.Errorf("unexpected end of %s", f.s)
+	}
+	switch f.s[f.i] {
+	case '[':
+		return f.sequence()
+	case '{':
+		return f.mapping()
+	}
+	return f.scalar()
+}
+
+func (f *yamlFlow) scalar() (any, error) {
+	start := f.i
+	if c := f.s[f.i]; c == '"' || c == '\'' {
+		end := quotedYAMLEnd(f.s[f.i:])
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated string in %s", f.s)
+		}
+		f.i += end + 1
+	} else {
+		for f.i < len(f.s) && !strings.ContainsRune(",]}", rune(f.s[f.i])) && !(f.s[f.i] == ':' && (f.i+1 == len(f.s) || f.s[f.i+1] == ' ')) {
+			f.i++
+		}
+	}
+	return yamlScalar(f.s[start:f.i])
+}
+
+func (f *yamlFlow) sequence() ([]any, error) {
+	f.i++
+	out := []any{}
+	for {
+		if f.space(); f.i < len(f.s) && f.s[f.i] == ']' {
+			f.i++
+			return out, nil
+		}
+		v, err := f.value()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+		if err = f.next(']'); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (f *yamlFlow) mapping() (map[string]any, error) {
+	f.i++
+	out := make(map[string]any)
+	for {
+		if f.space(); f.i < len(f.s) && f.s[f.i] == '}' {
+			f.i++
+			return out, nil
+		}
+		k, err := f.scalar()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(string)
+		if !ok || f.i == len(f.s) || f.s[f.i] != ':' {
+			return nil, fmt.Errorf("expected a key in %s", f.s)
+		}
+		f.i++
+		if out[key], err = f.value(); err != nil {
+			return nil, err
+		}
+		if err = f.next('}'); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// next consumes the comma after an item, leaving the closing bracket to the caller
+func (f *yamlFlow) next(end byte) error {
+	f.space()
+	switch {
+	case f.i < len(f.s) && f.s[f.i] == ',':
+		f.i++
+		return nil
+	case f.i < len(f.s) && f.s[f.i] == end:
+		return nil
+	}
+	return fmt.Errorf("expected , or %c in %s", end, f.s)
+}
@@ -0,0 +1,61 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	var tests = []struct {
+		name  string
+		yaml  string
+		json  string
+		isErr bool
+	}{
+		{"empty", "# nothing\n", "null", false},
+		{"scalars", "a: 1\nb: -2.5\nc: true\nd: ~\ne: hello world\nf: \"quoted: # not a comment\"\ng: 'it''s'\nh: 0x1F\n", `{"a":1,"b":-2.5,"c":true,"d":null,"e":"hello world","f":"quoted: # not a comment","g":"it's","h":"0x1F"}`, false},
+		{"numbers", "zip: 01234\na: .5\nb: -.5\nc: 1.\nd: +1\ne: 1e3\nf: -0.25\ng: 1_000\n", `{"zip":"01234","a":".5","b":"-.5","c":"1.","d":1,"e":1e3,"f":-0.25,"g":"1_000"}`, false},
+		{"comments", "# header\na: b # trailing\nc: d#e\n", `{"a":"b","c":"d#e"}`, false},
+		{"nested", "a:\n  b:\n    c: 1\n  d: 2\ne: 3\n", `{"a":{"b":{"c":1},"d":2},"e":3}`, false},
+		{"sequence", "- a\n- b\n-\n  - c\n", `["a","b",["c"]]`, false},
+		{"sequence of mappings", "items:\n  - name: a\n    size: 1\n  - name: b\n", `{"items":[{"name":"a","size":1},{"name":"b"}]}`, false},
+		{"sequence at key indent", "items:\n- a\n- b\nnext: c\n", `{"items":["a","b"],"next":"c"}`, false},
+		{"flow", "a: [1, \"two\", [3]]\nb: {x: 1, y: [a, b]}\nc: []\n", `{"a":[1,"two",[3]],"b":{"x":1,"y":["a","b"]},"c":[]}`, false},
+		{"literal", "a: |\n  line 1\n  line 2\n\nb: c\n", `{"a":"line 1\nline 2\n","b":"c"}`, false},
+		{"folded", "a: >-\n  one\n  two\n\n  three\n", `{"a":"one two\nthree"}`, false},
+		{"quoted key", "\"a b\": 1\n", `{"a b":1}`, false},
+		{"document start", "---\na: 1\n", `{"a":1}`, false},
+		{"bad indentation", "a: 1\n  b: 2\n", "", true},
+		{"tab", "a:\n\tb: 1\n", "", true},
+		{"duplicate key", "a: 1\na: 2\n", "", true},
+		{"anchor", "a: &x 1\n", "", true},
+		{"unterminated flow", "a: [1, 2\n", "", true},
+		{"not a key", "a: 1\njust text\n", "", true},
+	}
+
+	for _, e := range tests {
+		v, err := parseYAML([]byte(e.yaml))
+		if e.isErr {
+			if err == nil {
+				t.Errorf("%s: expected an error", e.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", e.name, err)
+			continue
+		}
+		var got, want any
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Errorf("%s: %v", e.name, err)
+			continue
+		}
+		_ = json.Unmarshal(b, &got)
+		_ = json.Unmarshal([]byte(e.json), &want)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: expected %s but got %s", e.name, e.json, b)
+		}
+	}
+}
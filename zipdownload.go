@@ -0,0 +1,272 @@
+package toolkit
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"io"
+	"math/big"
+	"net/http"
+	"time"
+)
+
+// ZipEntry is a file to add to a zip download
+type ZipEntry struct {
+	Name     string
+	Modified time.Time
+	// Open returns the contents of the file. It is called when the entry is written
+	Open func() (io.ReadCloser, error)
+}
+
+// StorageZipEntry returns a zip entry which reads key from store
+func StorageZipEntry(ctx context.Context, store Storage, key, name string) ZipEntry {
+	return ZipEntry{
+		Name: name,
+		Open: func() (io.ReadCloser, error) { return store.Get(ctx, key) },
+	}
+}
+
+// DownloadZip streams a zip of entries to the client as an attachment. If password is not
+// empty, every entry is encrypted with AES-256 in the WinZip AE-2 format, which 7-Zip,
+// WinZip and macOS's Archive Utility can open.
+func (t *Tools) DownloadZip(w http.ResponseWriter, displayName string, entries []ZipEntry, password string) error {
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", displayName))
+	return WriteZip(w, entries, password)
+}
+
+// WriteZip writes a zip of entries to w, encrypted with password if it is not empty
+func WriteZip(w io.Writer, entries []ZipEntry, password string) error {
+	zw := zip.NewWriter(w)
+
+	for _, e := range entries {
+		if err := writeZipEntry(zw, e, password); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func writeZipEntry(zw *zip.Writer, e ZipEntry, password string) error {
+	rc, err := e.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	modified := e.Modified
+	if modified.IsZero() {
+		modified = time.Now()
+	}
+
+	if password == "" {
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: e.Name, Method: zip.Deflate, Modified: modified})
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(fw, rc)
+		return err
+	}
+
+	// Entries are streamed, so the sizes are not known up front. Setting the data descriptor
+	// flag lets the sizes be filled in on the header after the data has been written; the zip
+	// writer reads them from the header when it writes the descriptor and central directory.
+	fh := &zip.FileHeader{
+		Name:     e.Name,
+		Method:   zipMethodAES,
+		Modified: modified,
+		Flags:    0x1 | 0x8,
+		Extra:    aesExtraField(zip.Deflate),
+	}
+	// CreateRaw does not fill in the MS-DOS times from Modified as CreateHeader does
+	fh.SetModTime(modified)
+	raw, err := zw.CreateRaw(fh)
+	if err != nil {
+		return err
+	}
+
+	ew, err := newAESZipWriter(raw, password)
+	if err != nil {
+		return err
+	}
+	fl, err := flate.NewWriter(ew, flate.DefaultCompression)
+	if err != nil {
+		return err
+	}
+
+	n, err := io.Copy(fl, rc)
+	if err != nil {
+		return err
+	}
+	if err = fl.Close(); err != nil {
+		return err
+	}
+	if err = ew.Close(); err != nil {
+		return err
+	}
+
+	// AE-2 entries carry no CRC; the authentication code protects the data instead
+	fh.CRC32 = 0
+	fh.UncompressedSize64 = uint64(n)
+	fh.CompressedSize64 = uint64(ew.written)
+
+	// the central directory uses the 32 bit sizes unless the entry needs zip64
+	fh.CompressedSize, fh.UncompressedSize = zipSize32(fh.CompressedSize64), zipSize32(fh.UncompressedSize64)
+	if fh.CompressedSize == zipUint32Max || fh.UncompressedSize == zipUint32Max {
+		fh.CompressedSize, fh.UncompressedSize = zipUint32Max, zipUint32Max
+	}
+	return nil
+}
+
+// NewZipPassword generates a random password for an encrypted zip, to be given to the user
+// over a different channel than the download itself
+func NewZipPassword() (string, error) {
+	const alphabet = "ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz23456789"
+
+	b := make([]byte, 20)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(alphabet))))
+		if err != nil {
+			return "", err
+		}
+		b[i] = alphabet[n.Int64()]
+	}
+	return string(b), nil
+}
+
+// zipMethodAES is the compression method of WinZip AES encrypted entries
+const zipMethodAES = 99
+
+const zipUint32Max = 1<<32 - 1
+
+func zipSize32(n uint64) uint32 {
+	if n >= zipUint32Max {
+		return zipUint32Max
+	}
+	return uint32(n)
+}
+
+// aesExtraField returns the WinZip AES extra field for an AE-2, AES-256 entry
+func aesExtraField(method uint16) []byte {
+	b := make([]byte, 11)
+	binary.LittleEndian.PutUint16(b[0:], 0x9901)
+	binary.LittleEndian.PutUint16(b[2:], 7)
+	binary.LittleEndian.PutUint16(b[4:], 2) // AE-2
+	copy(b[6:], "AE")
+	b[8] = 3 // AES-256
+	binary.LittleEndian.PutUint16(b[9:], method)
+	return b
+}
+
+// aesZipWriter encrypts an entry's data as WinZip AES: a salt and password verifier, the data
+// encrypted with AES in CTR mode with a little-endian counter, then a truncated HMAC-SHA1
+type aesZipWriter struct {
+	w       io.Writer
+	block   cipher.Block
+	mac     hash.Hash
+	counter [aes.BlockSize]byte
+	stream  [aes.BlockSize]byte
+	used    int
+	written int64
+}
+
+func newAESZipWriter(w io.Writer, password string) (*aesZipWriter, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	encKey, authKey, verifier := aesZipKeys(password, salt)
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, err
+	}
+
+	ew := &aesZipWriter{w: w, block: block, mac: hmac.New(sha1.New, authKey), used: aes.BlockSize}
+	if _, err = w.Write(salt); err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(verifier); err != nil {
+		return nil, err
+	}
+	ew.written = int64(len(salt) + len(verifier))
+	return ew, nil
+}
+
+// aesZipKeys derives the encryption key, authentication key and password verifier
+func aesZipKeys(password string, salt []byte) (encKey, authKey, verifier []byte) {
+	keys := pbkdf2SHA1([]byte(password), salt, 1000, 2*32+2)
+	return keys[:32], keys[32:64], keys[64:]
+}
+
+// xorKeyStream applies the WinZip CTR keystream, whose counter starts at 1 and is incremented
+// as a little-endian number, unlike cipher.NewCTR
+func (ew *aesZipWriter) xorKeyStream(dst, src []byte) {
+	for i := range src {
+		if ew.used == aes.BlockSize {
+			for j := range ew.counter {
+				ew.counter[j]++
+				if ew.counter[j] != 0 {
+					break
+				}
+			}
+			ew.block.Encrypt(ew.stream[:], ew.counter[:])
+			ew.used = 0
+		}
+		dst[i] = src[i] ^ ew.stream[ew.used]
+		ew.used++
+	}
+}
+
+func (ew *aesZipWriter) Write(p []byte) (int, error) {
+	buf := make([]byte, len(p))
+	ew.xorKeyStream(buf, p)
+	ew.mac.Write(buf)
+
+	n, err := ew.w.Write(buf)
+	ew.written += int64(n)
+	return n, err
+}
+
+// Close writes the authentication code. It does not close the underlying writer.
+func (ew *aesZipWriter) Close() error {
+	n, err := ew.w.Write(ew.mac.Sum(nil)[:10])
+	ew.written += int64(n)
+	return err
+}
+
+// pbkdf2SHA1 derives a key from a password, as specified by RFC 8018
+func pbkdf2SHA1(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha1.New, password)
+	var key []byte
+
+	for block := uint32(1); len(key) < keyLen; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		var index [4]byte
+		binary.BigEndian.PutUint32(index[:], block)
+		prf.Write(index[:])
+		u := prf.Sum(nil)
+
+		t := make([]byte, len(u))
+		copy(t, u)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
@@ -0,0 +1,141 @@
+package toolkit
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPBKDF2SHA1(t *testing.T) {
+	// test vectors from RFC 6070
+	var tests = []struct {
+		password   string
+		salt       string
+		iterations int
+		expected   string
+	}{
+		{"password", "salt", 1, "0c60c80f961f0e71f3a9b524af6012062fe037a6"},
+		{"password", "salt", 2, "ea6c014dc72d6f8ccd1ed92ace1d41f0d8de8957"},
+		{"password", "salt", 4096, "4b007901b765489abead49d926f721d065a429c1"},
+	}
+
+	for _, e := range tests {
+		got := hex.EncodeToString(pbkdf2SHA1([]byte(e.password), []byte(e.salt), e.iterations, 20))
+		if got != e.expected {
+			t.Errorf("%d iterations: expected %s, got %s", e.iterations, e.expected, got)
+		}
+	}
+}
+
+// decryptAESZipEntry reverses the WinZip AES encryption of an entry's raw data
+func decryptAESZipEntry(t *testing.T, raw []byte, password string) ([]byte, bool) {
+	salt, verifier, data, code := raw[:16], raw[16:18], raw[18:len(raw)-10], raw[len(raw)-10:]
+	encKey, authKey, expected := aesZipKeys(password, salt)
+	if !bytes.Equal(verifier, expected) {
+		return nil, false
+	}
+
+	mac := hmac.New(sha1.New, authKey)
+	mac.Write(data)
+	if !bytes.Equal(mac.Sum(nil)[:10], code) {
+		t.Fatal("authentication code does not match")
+	}
+
+	block, _ := aes.NewCipher(encKey)
+	ew := &aesZipWriter{block: block, used: aes.BlockSize}
+	plain := make([]byte, len(data))
+	ew.xorKeyStream(plain, data)
+
+	inflated, err := io.ReadAll(flate.NewReader(bytes.NewReader(plain)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return inflated, true
+}
+
+func TestTools_DownloadZip(t *testing.T) {
+	large := strings.Repeat("0123456789abcdef", 5000)
+	entries := []ZipEntry{
+		{Name: "customers.csv", Open: func() (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader("name,email\nada,ada@example.com\n")), nil
+		}},
+		{Name: "large.txt", Open: func() (io.ReadCloser, error) { return io.NopCloser(strings.NewReader(large)), nil }},
+	}
+
+	password, err := NewZipPassword()
+	if err != nil || len(password) != 20 {
+		t.Fatalf("unexpected password %q %v", password, err)
+	}
+
+	var testTools Tools
+	rr := httptest.NewRecorder()
+	if err = testTools.DownloadZip(rr, "export.zip", entries, password); err != nil {
+		t.Fatal(err)
+	}
+	if rr.Header().Get("Content-Disposition") != `attachment; filename="export.zip"` {
+		t.Errorf("unexpected content disposition %q", rr.Header().Get("Content-Disposition"))
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(rr.Body.Bytes()), int64(rr.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(zr.File) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(zr.File))
+	}
+
+	expected := []string{"name,email\nada,ada@example.com\n", large}
+	for i, f := range zr.File {
+		if f.Method != zipMethodAES || f.Flags&0x1 == 0 {
+			t.Errorf("%s: expected an encrypted entry", f.Name)
+		}
+		if f.UncompressedSize64 != uint64(len(expected[i])) {
+			t.Errorf("%s: expected size %d, got %d", f.Name, len(expected[i]), f.UncompressedSize64)
+		}
+
+		rc, err := f.OpenRaw()
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, _ := io.ReadAll(rc)
+		if bytes.Contains(raw, []byte("ada@example.com")) {
+			t.Errorf("%s: plain text found in encrypted entry", f.Name)
+		}
+
+		if _, ok := decryptAESZipEntry(t, raw, "wrong password"); ok {
+			t.Errorf("%s: wrong password was accepted", f.Name)
+		}
+		plain, ok := decryptAESZipEntry(t, raw, password)
+		if !ok || string(plain) != expected[i] {
+			t.Errorf("%s: contents do not round trip", f.Name)
+		}
+	}
+}
+
+func TestWriteZip_Plain(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteZip(&buf, []ZipEntry{
+		{Name: "a.txt", Open: func() (io.ReadCloser, error) { return io.NopCloser(strings.NewReader("hello")), nil }},
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zr, _ := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	rc, err := zr.File[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(rc)
+	if string(data) != "hello" {
+		t.Errorf("unexpected contents %q", data)
+	}
+}